@@ -30,6 +30,7 @@ validate-config                      = $(STATUS_FLAGS_DIR)/validate-image-config
 meta_user_data_tmp_dir               = $(IMAGEGEN_DIR)/meta-user-data_tmp
 image_package_cache_summary          = $(imggen_config_dir)/image_deps.json
 image_external_package_cache_summary = $(imggen_config_dir)/image_external_deps.json
+image_package_lockfile               = $(imggen_config_dir)/image_lock.json
 
 # Outputs
 artifact_dir             = $(IMAGES_DIR)/$(config_name)
@@ -64,7 +65,8 @@ fetch-external-image-packages: $(image_external_package_cache_summary)
 validate-image-config: $(validate-config)
 $(STATUS_FLAGS_DIR)/validate-image-config%.flag: $(go-imageconfigvalidator) $(depend_CONFIG_FILE) $(CONFIG_FILE) $(config_other_files)
 	$(go-imageconfigvalidator) \
-		--input=$(CONFIG_FILE) && \
+		--input=$(CONFIG_FILE) \
+		--base-dir=$(CONFIG_BASE_DIR) && \
 	touch $@
 
 
@@ -81,7 +83,7 @@ ifeq ($(USE_PREVIEW_REPO),y)
 imagepkgfetcher_extra_flags += --use-preview-repo
 endif
 
-$(image_package_cache_summary): $(go-imagepkgfetcher) $(chroot_worker) $(imggen_local_repo) $(depend_REPO_LIST) $(REPO_LIST) $(depend_CONFIG_FILE) $(CONFIG_FILE) $(validate-config) $(packagelist_files) $(RPMS_DIR) $(imggen_rpms)
+$(image_package_cache_summary): $(go-imagepkgfetcher) $(chroot_worker) $(imggen_local_repo) $(depend_REPO_LIST) $(REPO_LIST) $(depend_CONFIG_FILE) $(CONFIG_FILE) $(validate-config) $(packagelist_files) $(RPMS_DIR) $(imggen_rpms) $(IMAGE_LOCKFILE)
 	$(if $(CONFIG_FILE),,$(error Must set CONFIG_FILE=))
 	$(go-imagepkgfetcher) \
 		--input=$(CONFIG_FILE) \
@@ -91,12 +93,15 @@ $(image_package_cache_summary): $(go-imagepkgfetcher) $(chroot_worker) $(imggen_
 		--rpm-dir=$(RPMS_DIR) \
 		--tmp-dir=$(image_fetcher_tmp_dir) \
 		--tdnf-worker=$(chroot_worker) \
+		--cloner=$(REPO_CLONER) \
 		--tls-cert=$(TLS_CERT) \
 		--tls-key=$(TLS_KEY) \
 		$(foreach repo, $(imagefetcher_local_repo) $(imagefetcher_cloned_repo) $(REPO_LIST),--repo-file="$(repo)" ) \
 		$(imagepkgfetcher_extra_flags) \
 		--input-summary-file=$(IMAGE_CACHE_SUMMARY) \
 		--output-summary-file=$@ \
+		$(if $(IMAGE_LOCKFILE),--input-lockfile=$(IMAGE_LOCKFILE)) \
+		--output-lockfile=$(image_package_lockfile) \
 		--output-dir=$(local_and_external_rpm_cache)
 
 make-raw-image: $(imager_disk_output_dir)
@@ -118,6 +123,8 @@ $(STATUS_FLAGS_DIR)/imager_disk_output.flag: $(go-imager) $(image_package_cache_
 		--tdnf-worker $(BUILD_DIR)/worker/worker_chroot.tar.gz \
 		--repo-file=$(imggen_local_repo) \
 		--assets $(assets_dir) \
+		$(foreach format,$(SBOM_FORMATS),--sbom-format=$(format) ) \
+		--disk-backend=$(IMAGER_DISK_BACKEND) \
 		--output-dir $(imager_disk_output_dir) && \
 	touch $@
 
@@ -147,6 +154,7 @@ $(image_external_package_cache_summary): $(cached_file) $(go-imagepkgfetcher) $(
 		--rpm-dir=$(RPMS_DIR) \
 		--tmp-dir=$(image_fetcher_tmp_dir) \
 		--tdnf-worker=$(chroot_worker) \
+		--cloner=$(REPO_CLONER) \
 		--external-only \
 		--package-graph=$(graph_file) \
 		--tls-cert=$(TLS_CERT) \
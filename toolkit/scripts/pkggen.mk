@@ -29,9 +29,14 @@ validate-pkggen-config = $(STATUS_FLAGS_DIR)/validate-image-config-pkggen.flag
 # Outputs
 specs_file        = $(PKGBUILD_DIR)/specs.json
 graph_file        = $(PKGBUILD_DIR)/graph.dot
+cycle_report_file = $(PKGBUILD_DIR)/graph_cycles.json
 optimized_file    = $(PKGBUILD_DIR)/scrubbed_graph.dot
 cached_file       = $(PKGBUILD_DIR)/cached_graph.dot
 workplan          = $(PKGBUILD_DIR)/workplan.mk
+built_file        = $(PKGBUILD_DIR)/built_graph.dot
+
+# Records the inputs every SRPM was built from, kept outside $(PKGBUILD_DIR) since it describes the RPMs in $(RPMS_DIR)
+build_manifest_dir = $(BUILD_DIR)/build_manifest
 
 logging_command = --log-file $(LOGS_DIR)/pkggen/workplan/$(notdir $@).log --log-level $(LOG_LEVEL)
 $(call create_folder,$(LOGS_DIR)/pkggen/workplan)
@@ -52,11 +57,14 @@ clean-cache:
 	rm -rf $(cache_working_dir)
 
 # Parse all specs in $(BUILD_SPECS_DIR) and generate a specs.json file encoding all dependency information
-$(specs_file): $(BUILD_SPECS_DIR) $(build_specs) $(build_spec_dirs) $(go-specreader)
+$(specs_file): $(BUILD_SPECS_DIR) $(build_specs) $(build_spec_dirs) $(go-specreader) $(depend_BOOTSTRAP_SPEC_LIST)
 	$(go-specreader) \
 		--dir $(BUILD_SPECS_DIR) \
 		--srpm-dir $(BUILD_SRPMS_DIR) \
 		--dist-tag $(DIST_TAG) \
+		--spec-parser $(SPEC_PARSER) \
+		--bootstrap-specs="$(BOOTSTRAP_SPEC_LIST)" \
+		$(if $(TARGET_ARCH),--target-arch $(TARGET_ARCH)) \
 		$(logging_command) \
 		--output $@
 
@@ -64,6 +72,8 @@ $(specs_file): $(BUILD_SPECS_DIR) $(build_specs) $(build_spec_dirs) $(go-specrea
 $(graph_file): $(specs_file) $(go-grapher)
 	$(go-grapher) \
 		--input $(specs_file) \
+		--cycle-report $(cycle_report_file) \
+		$(if $(TARGET_ARCH),--target-arch $(TARGET_ARCH)) \
 		$(logging_command) \
 		--output $@
 
@@ -80,7 +90,12 @@ $(optimized_file): $(graph_file) $(go-graphoptimizer) $(depend_PACKAGE_BUILD_LIS
 		--input $(graph_file) \
 		--rpm-dir $(RPMS_DIR) \
 		--dist-tag $(DIST_TAG) \
-		--rebuild-missing-dep-chains \
+		--invalidate-dep-chains \
+		--build-manifest-dir $(build_manifest_dir) \
+		--specs-dir $(SPECS_DIR) \
+		--rpmmacros-file $(TOOLCHAIN_MANIFESTS_DIR)/macros.override \
+		--cached-rpms-dir $(CACHED_RPMS_DIR)/cache \
+		$(if $(TARGET_ARCH),--target-arch $(TARGET_ARCH)) \
 		--packages "$(PACKAGE_BUILD_LIST)" \
 		--rebuild-packages="$(PACKAGE_REBUILD_LIST)" \
 		--ignore-packages="$(PACKAGE_IGNORE_LIST)" \
@@ -114,6 +129,7 @@ $(cached_file): $(optimized_file) $(go-graphpkgfetcher) $(chroot_worker) $(pkgge
 		--rpm-dir=$(RPMS_DIR) \
 		--tmp-dir=$(cache_working_dir) \
 		--tdnf-worker=$(chroot_worker) \
+		--cloner=$(REPO_CLONER) \
 		--tls-cert=$(TLS_CERT) \
 		--tls-key=$(TLS_KEY) \
 		$(foreach repo, $(pkggen_local_repo) $(graphpkgfetcher_cloned_repo) $(REPO_LIST),--repo-file=$(repo) ) \
@@ -135,6 +151,9 @@ $(workplan): $(cached_file) $(go-unravel) $(depend_STOP_ON_PKG_FAIL)
 		--distro-release-version $(RELEASE_VERSION) \
 		--distro-build-number $(BUILD_NUMBER) \
 		--retry-attempts="$(PACKAGE_BUILD_RETRIES)" \
+		--build-manifest-dir $(build_manifest_dir) \
+		$(if $(TARGET_ARCH),--target-arch $(TARGET_ARCH)) \
+		--verify-reproducible $(VERIFY_REPRODUCIBLE_BUILDS) \
 		$(if $(filter y,$(STOP_ON_PKG_FAIL)),--stop-on-failure) \
 		$(logging_command) \
 		--output $@
@@ -144,7 +163,10 @@ $(workplan): $(cached_file) $(go-unravel) $(depend_STOP_ON_PKG_FAIL)
 pkggen_archive	= $(OUT_DIR)/rpms.tar.gz
 srpms_archive  	= $(OUT_DIR)/srpms.tar.gz
 
-.PHONY: build-packages clean-build-packages hydrate-rpms compress-rpms clean-compress-rpms compress-srpms clean-compress-srpms
+build_summary_file = $(LOGS_DIR)/pkggen/build_summary.json
+build_summary_junit_file = $(LOGS_DIR)/pkggen/build_summary.xml
+
+.PHONY: build-packages build-summary build-time-report lint-specs clean-build-packages hydrate-rpms compress-rpms clean-compress-rpms compress-srpms clean-compress-srpms
 
 # Execute the build plan encoded in the workplan makefile.
 build-packages: $(RPMS_DIR)
@@ -152,8 +174,11 @@ build-packages: $(RPMS_DIR)
 clean: clean-build-packages clean-compress-rpms clean-compress-srpms
 clean-build-packages:
 	rm -rf $(RPMS_DIR)
+	rm -rf $(build_manifest_dir)
 	rm -rf $(LOGS_DIR)/pkggen/failures.txt
 	rm -rf $(LOGS_DIR)/pkggen/rpmbuilding
+	rm -rf $(build_summary_file)
+	rm -rf $(build_summary_junit_file)
 	rm -rf $(STATUS_FLAGS_DIR)/build-rpms.flag
 	@echo Verifying no mountpoints present in $(CHROOT_DIR)
 	$(SCRIPTS_DIR)/safeunmount.sh "$(CHROOT_DIR)" && \
@@ -163,6 +188,32 @@ clean-compress-rpms:
 clean-compress-srpms:
 	rm -rf $(srpms_archive)
 
+# Collect the result of every package build into $(build_summary_file) and render it.
+# BUILD_SUMMARY_FORMAT=junit writes a JUnit XML report to $(build_summary_junit_file) instead of printing a table.
+build-summary: $(go-buildsummary) $(cached_file)
+	$(go-buildsummary) \
+		--results-dir $(LOGS_DIR)/pkggen/rpmbuilding \
+		--graph $(cached_file) \
+		--output-summary $(build_summary_file) \
+		--format $(BUILD_SUMMARY_FORMAT) \
+		$(if $(filter junit,$(BUILD_SUMMARY_FORMAT)),--output $(build_summary_junit_file)) \
+		$(logging_command)
+
+# Report the critical path and minimum wall time of a full package build, using the durations of the last build.
+build-time-report: $(go-buildtime) $(cached_file)
+	$(go-buildtime) \
+		--input $(cached_file) \
+		--results-dir $(LOGS_DIR)/pkggen/rpmbuilding \
+		$(if $(CONCURRENT_PACKAGE_BUILDS),--workers="$(CONCURRENT_PACKAGE_BUILDS)") \
+		$(logging_command)
+
+# Check every SPEC for problems which would otherwise only show up once it is built.
+lint-specs: $(go-speclint)
+	$(go-speclint) \
+		--dir $(SPECS_DIR) \
+		$(if $(TARGET_ARCH),--target-arch $(TARGET_ARCH)) \
+		$(logging_command)
+
 ifeq ($(REBUILD_PACKAGES),y)
 $(RPMS_DIR): $(STATUS_FLAGS_DIR)/build-rpms.flag
 	@touch $@
@@ -172,12 +223,53 @@ $(RPMS_DIR):
 	@touch $@
 endif
 
-$(STATUS_FLAGS_DIR)/build-rpms.flag: $(workplan) $(chroot_worker) $(go-pkgworker)
-	rm -f $(LOGS_DIR)/pkggen/failures.txt && \
+ifeq ($(USE_PACKAGE_SCHEDULER),y)
+# Build the packages directly from the graph, the scheduler records the result of each build in $(built_file)
+$(STATUS_FLAGS_DIR)/build-rpms.flag: $(cached_file) $(chroot_worker) $(go-pkgworker) $(go-scheduler) $(depend_STOP_ON_PKG_FAIL)
+	$(go-scheduler) \
+		--input $(cached_file) \
+		--pkg-worker $(go-pkgworker) \
+		--work-dir $(CHROOT_DIR) \
+		--worker-tar $(chroot_worker) \
+		--repo-file $(pkggen_local_repo) \
+		--rpms-dir $(RPMS_DIR) \
+		--srpms-dir $(SRPMS_DIR) \
+		--cache-dir $(CACHED_RPMS_DIR)/cache \
+		--build-logs-dir $(LOGS_DIR)/pkggen/rpmbuilding \
+		--rpmmacros-file $(TOOLCHAIN_MANIFESTS_DIR)/macros.override \
+		--dist-tag $(DIST_TAG) \
+		--distro-release-version $(RELEASE_VERSION) \
+		--distro-build-number $(BUILD_NUMBER) \
+		--retry-attempts="$(PACKAGE_BUILD_RETRIES)" \
+		$(if $(CONCURRENT_PACKAGE_BUILDS),--workers="$(CONCURRENT_PACKAGE_BUILDS)") \
+		$(if $(filter y,$(RUN_CHECK)),--run-check) \
+		$(if $(filter y,$(STOP_ON_PKG_FAIL)),--stop-on-failure) \
+		--build-manifest-dir $(build_manifest_dir) \
+		$(if $(TARGET_ARCH),--target-arch $(TARGET_ARCH)) \
+		$(if $(filter y,$(VERIFY_REPRODUCIBLE_BUILDS)),--verify-reproducible) \
+		--fetch-tmp-dir $(cache_working_dir) \
+		--tls-cert=$(TLS_CERT) \
+		--tls-key=$(TLS_KEY) \
+		$(foreach repo, $(pkggen_local_repo) $(graphpkgfetcher_cloned_repo) $(REPO_LIST),--fetch-repo-file=$(repo) ) \
+		$(graphpkgfetcher_extra_flags) \
+		--log-file $(LOGS_DIR)/pkggen/workplan/scheduler.log \
+		--log-level $(LOG_LEVEL) \
+		--output $(built_file) && \
+	touch $@
+else
+$(STATUS_FLAGS_DIR)/build-rpms.flag: $(workplan) $(chroot_worker) $(go-pkgworker) $(go-buildsummary)
+	rm -f $(LOGS_DIR)/pkggen/failures.txt $(LOGS_DIR)/pkggen/rpmbuilding/*.result.json && \
 	$(MAKE) --silent -f $(workplan) go-pkgworker=$(go-pkgworker) CHROOT_DIR=$(CHROOT_DIR) chroot_worker=$(chroot_worker) SRPMS_DIR=$(SRPMS_DIR) RPMS_DIR=$(RPMS_DIR) pkggen_local_repo=$(pkggen_local_repo) LOGS_DIR=$(LOGS_DIR) TOOLCHAIN_MANIFESTS_DIR=$(TOOLCHAIN_MANIFESTS_DIR) GOAL_PackagesToBuild && \
+	$(go-buildsummary) \
+		--results-dir $(LOGS_DIR)/pkggen/rpmbuilding \
+		--graph $(cached_file) \
+		--output-summary $(build_summary_file) \
+		--format none \
+		$(logging_command) && \
 	{ [ ! -f $(LOGS_DIR)/pkggen/failures.txt ] || \
 		$(call print_error,Failed to build: $$(cat $(LOGS_DIR)/pkggen/failures.txt)); } && \
 	touch $@
+endif
 
 # use temp tarball to avoid tar warning "file changed as we read it" 
 # that can sporadically occur when tarball is the dir that is compressed
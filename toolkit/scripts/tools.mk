@@ -15,10 +15,14 @@ $(call create_folder,$(BUILD_DIR)/tools)
 # List of go utilities in tools/ directory
 go_tool_list = \
 	boilerplate \
+	buildsummary \
+	buildtime \
 	depsearch \
+	graphdiff \
 	grapher \
 	graphoptimizer \
 	graphpkgfetcher \
+	graphview \
 	imageconfigvalidator \
 	imagepkgfetcher \
 	imager \
@@ -26,6 +30,8 @@ go_tool_list = \
 	liveinstaller \
 	pkgworker \
 	roast \
+	scheduler \
+	speclint \
 	specreader \
 	srpmpacker \
 	unravel \
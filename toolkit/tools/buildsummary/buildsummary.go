@@ -0,0 +1,166 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+// buildsummary is a tool to collect the results of a package build and render them for humans or CI systems
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+	"microsoft.com/pkggen/internal/buildreport"
+	"microsoft.com/pkggen/internal/exe"
+	"microsoft.com/pkggen/internal/logger"
+	"microsoft.com/pkggen/internal/pkggraph"
+)
+
+const (
+	formatTable = "table"
+	formatJUnit = "junit"
+	formatNone  = "none"
+)
+
+var (
+	app = kingpin.New("buildsummary", "Collects the result of every SRPM build into a single summary, and renders it as a table or a JUnit XML report.")
+
+	resultsDir   = app.Flag("results-dir", "Directory containing the per-SRPM result files written by pkgworker.").ExistingDir()
+	inputSummary = app.Flag("input-summary", "Path to an existing build summary to render instead of collecting the results.").ExistingFile()
+	inputGraph   = app.Flag("graph", "Optional DOT graph used for the build. SRPMs which needed a build but have no result are reported as blocked.").ExistingFile()
+
+	outputSummary = app.Flag("output-summary", "Optional path to save the collected build summary JSON to.").String()
+	output        = app.Flag("output", "Optional path to save the rendered summary to. Defaults to stdout.").String()
+
+	legalFormats = []string{formatTable, formatJUnit, formatNone}
+	format       = app.Flag("format", "Format to render the summary in.").PlaceHolder(exe.PlaceHolderize(legalFormats)).Default(formatTable).Enum(legalFormats...)
+
+	logFile  = exe.LogFileFlag(app)
+	logLevel = exe.LogLevelFlag(app)
+)
+
+func main() {
+	app.Version(exe.ToolkitVersion)
+	kingpin.MustParse(app.Parse(os.Args[1:]))
+	logger.InitBestEffort(*logFile, *logLevel)
+
+	var (
+		summary *buildreport.BuildSummary
+		err     error
+	)
+
+	switch {
+	case *inputSummary != "":
+		summary, err = buildreport.ReadBuildSummary(*inputSummary)
+		logger.PanicOnError(err, "Failed to read build summary '%s'.", *inputSummary)
+	case *resultsDir != "":
+		summary, err = buildreport.CollectBuildSummary(*resultsDir)
+		logger.PanicOnError(err, "Failed to collect build results from '%s'.", *resultsDir)
+	default:
+		logger.Log.Panic("Either --results-dir or --input-summary must be provided.")
+	}
+
+	if *inputGraph != "" {
+		err = addMissingResults(summary, *inputGraph)
+		logger.PanicOnError(err, "Failed to add the SRPMs from '%s' to the summary.", *inputGraph)
+	}
+
+	if *outputSummary != "" {
+		err = buildreport.WriteBuildSummary(*outputSummary, summary)
+		logger.PanicOnError(err, "Failed to write build summary '%s'.", *outputSummary)
+	}
+
+	if *format == formatNone {
+		return
+	}
+
+	out := os.Stdout
+	if *output != "" {
+		out, err = os.Create(*output)
+		logger.PanicOnError(err, "Failed to create output file '%s'.", *output)
+		defer out.Close()
+	}
+
+	switch *format {
+	case formatTable:
+		err = printTable(out, summary)
+	case formatJUnit:
+		err = writeJUnit(out, summary)
+	}
+	logger.PanicOnError(err, "Failed to render the build summary.")
+}
+
+// addMissingResults adds a blocked result for every SRPM in the graph which needed to be built but has no result.
+func addMissingResults(summary *buildreport.BuildSummary, graphFile string) (err error) {
+	pkgGraph := pkggraph.NewPkgGraph()
+	err = pkggraph.ReadDOTGraphFile(pkgGraph, graphFile)
+	if err != nil {
+		return
+	}
+
+	knownSRPMs := make(map[string]bool)
+	for _, result := range summary.Results {
+		knownSRPMs[filepath.Base(result.SrpmPath)] = true
+	}
+
+	for _, n := range pkgGraph.AllBuildNodes() {
+		if n.State != pkggraph.StateBuild && n.State != pkggraph.StateBlocked {
+			continue
+		}
+
+		srpmName := filepath.Base(n.SrpmPath)
+		if knownSRPMs[srpmName] {
+			continue
+		}
+		knownSRPMs[srpmName] = true
+
+		summary.Results = append(summary.Results, &buildreport.SrpmResult{
+			SrpmPath: n.SrpmPath,
+			Status:   buildreport.StatusBlocked,
+		})
+	}
+
+	summary.Sort()
+	return
+}
+
+// printTable renders the summary as a human readable table followed by a count of each status.
+func printTable(out io.Writer, summary *buildreport.BuildSummary) (err error) {
+	const (
+		minWidth = 0
+		tabWidth = 8
+		padding  = 2
+		padChar  = ' '
+		flags    = 0
+	)
+
+	writer := tabwriter.NewWriter(out, minWidth, tabWidth, padding, padChar, flags)
+	fmt.Fprintln(writer, "SRPM\tSTATUS\tATTEMPTS\tTIME (s)\tRPMS\tFIRST ERROR")
+	for _, result := range summary.Results {
+		fmt.Fprintf(writer, "%s\t%s\t%d\t%.1f\t%d\t%s\n",
+			filepath.Base(result.SrpmPath),
+			result.Status,
+			result.Attempts,
+			result.WallTimeSeconds,
+			len(result.BuiltRPMs),
+			result.FirstError,
+		)
+	}
+
+	err = writer.Flush()
+	if err != nil {
+		return
+	}
+
+	counts := []string{
+		fmt.Sprintf("%d %s", summary.Count(buildreport.StatusBuilt), strings.ToLower(string(buildreport.StatusBuilt))),
+		fmt.Sprintf("%d %s", summary.Count(buildreport.StatusFailed), strings.ToLower(string(buildreport.StatusFailed))),
+		fmt.Sprintf("%d %s", summary.Count(buildreport.StatusBlocked), strings.ToLower(string(buildreport.StatusBlocked))),
+	}
+	_, err = fmt.Fprintf(out, "\n%d SRPMs: %s\n", len(summary.Results), strings.Join(counts, ", "))
+	return
+}
@@ -0,0 +1,112 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"microsoft.com/pkggen/internal/buildreport"
+)
+
+const junitSuiteName = "pkggen"
+
+// junitTestSuites is the root element of a JUnit XML report.
+type junitTestSuites struct {
+	XMLName xml.Name          `xml:"testsuites"`
+	Suites  []*junitTestSuite `xml:"testsuite"`
+}
+
+// junitTestSuite holds one test case per SRPM.
+type junitTestSuite struct {
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Cases    []*junitTestCase `xml:"testcase"`
+}
+
+// junitTestCase is the result of a single SRPM build.
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+// junitFailure marks a failed SRPM build.
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// junitSkipped marks an SRPM which was never built.
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+// writeJUnit renders the summary as a JUnit XML report, with a test case for every SRPM.
+// Failed builds are reported as failures, blocked builds are reported as skipped.
+func writeJUnit(out io.Writer, summary *buildreport.BuildSummary) (err error) {
+	const blockedMessage = "Not built, a dependency failed to build"
+
+	suite := &junitTestSuite{Name: junitSuiteName}
+
+	var totalTime float64
+	for _, result := range summary.Results {
+		testCase := &junitTestCase{
+			Name:      filepath.Base(result.SrpmPath),
+			ClassName: junitSuiteName,
+			Time:      formatSeconds(result.WallTimeSeconds),
+		}
+
+		if result.LogPath != "" {
+			testCase.SystemOut = fmt.Sprintf("Log file: %s", result.LogPath)
+		}
+
+		switch result.Status {
+		case buildreport.StatusFailed:
+			suite.Failures++
+			testCase.Failure = &junitFailure{
+				Message: result.FirstError,
+				Text:    fmt.Sprintf("Failed after %d attempts. For details see log file: %s", result.Attempts, result.LogPath),
+			}
+		case buildreport.StatusBlocked:
+			suite.Skipped++
+			testCase.Skipped = &junitSkipped{Message: blockedMessage}
+		}
+
+		totalTime += result.WallTimeSeconds
+		suite.Tests++
+		suite.Cases = append(suite.Cases, testCase)
+	}
+	suite.Time = formatSeconds(totalTime)
+
+	report := &junitTestSuites{Suites: []*junitTestSuite{suite}}
+
+	_, err = io.WriteString(out, xml.Header)
+	if err != nil {
+		return
+	}
+
+	encoder := xml.NewEncoder(out)
+	encoder.Indent("", "  ")
+	err = encoder.Encode(report)
+	if err != nil {
+		return
+	}
+
+	_, err = io.WriteString(out, "\n")
+	return
+}
+
+// formatSeconds formats a duration the way JUnit expects it.
+func formatSeconds(seconds float64) string {
+	return fmt.Sprintf("%.3f", seconds)
+}
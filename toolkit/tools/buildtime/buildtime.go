@@ -0,0 +1,218 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+// buildtime is a tool to find what limits the wall time of a package build using the SRPM build durations
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+	"microsoft.com/pkggen/internal/buildreport"
+	"microsoft.com/pkggen/internal/exe"
+	"microsoft.com/pkggen/internal/logger"
+	"microsoft.com/pkggen/internal/pkggraph"
+)
+
+const (
+	formatText = "text"
+	formatJSON = "json"
+
+	defaultTopCount = 10
+)
+
+var (
+	app = kingpin.New("buildtime", "Reports the critical path, minimum wall time and per-SRPM slack of a package build from a dependency graph and SRPM build durations.")
+
+	inputGraphFile = exe.InputFlag(app, "Path to the DOT graph file of the build.")
+	resultsDir     = app.Flag("results-dir", "Directory containing the per-SRPM result files written by pkgworker.").ExistingDir()
+	inputSummary   = app.Flag("input-summary", "Path to a build summary written by buildsummary.").ExistingFile()
+	timingsFile    = app.Flag("timings", "Path to a JSON file mapping SRPM names to their build time in seconds. Takes precedence over the build results.").ExistingFile()
+
+	workers  = app.Flag("workers", "Number of concurrent package builds to compute the wall time for.").Default(strconv.Itoa(runtime.NumCPU())).Int()
+	topCount = app.Flag("top", "Number of SRPMs to report whose speed-up would shorten the build.").Default(strconv.Itoa(defaultTopCount)).Int()
+
+	output = app.Flag("output", "Optional path to save the report to. Defaults to stdout.").String()
+
+	legalFormats = []string{formatText, formatJSON}
+	format       = app.Flag("format", "Format to render the report in.").PlaceHolder(exe.PlaceHolderize(legalFormats)).Default(formatText).Enum(legalFormats...)
+
+	logFile  = exe.LogFileFlag(app)
+	logLevel = exe.LogLevelFlag(app)
+)
+
+func main() {
+	app.Version(exe.ToolkitVersion)
+	kingpin.MustParse(app.Parse(os.Args[1:]))
+	logger.InitBestEffort(*logFile, *logLevel)
+
+	if *workers <= 0 {
+		logger.Log.Panicf("Value in --workers must be greater than zero. Found %d", *workers)
+	}
+
+	timings, err := readTimings()
+	logger.PanicOnError(err, "Failed to read the SRPM build timings.")
+
+	pkgGraph := pkggraph.NewPkgGraph()
+	err = pkggraph.ReadDOTGraphFile(pkgGraph, *inputGraphFile)
+	logger.PanicOnError(err, "Failed to read DOT graph '%s'.", *inputGraphFile)
+
+	report, err := buildreport.AnalyzeBuildTime(pkgGraph, timings, *workers, *topCount)
+	logger.PanicOnError(err, "Failed to analyze the build time of '%s'.", *inputGraphFile)
+
+	if report.EstimatedSRPMs > 0 {
+		logger.Log.Warnf("%d SRPMs have no build timing and are assumed to take the median build time.", report.EstimatedSRPMs)
+	}
+
+	out := os.Stdout
+	if *output != "" {
+		out, err = os.Create(*output)
+		logger.PanicOnError(err, "Failed to create output file '%s'.", *output)
+		defer out.Close()
+	}
+
+	switch *format {
+	case formatText:
+		err = printReport(out, report)
+	case formatJSON:
+		err = writeJSON(out, report)
+	}
+	logger.PanicOnError(err, "Failed to render the build time report.")
+}
+
+// readTimings merges the build timings of every source given on the command line.
+func readTimings() (timings map[string]float64, err error) {
+	timings = make(map[string]float64)
+	addTimings := func(newTimings map[string]float64) {
+		for srpmName, seconds := range newTimings {
+			timings[srpmName] = seconds
+		}
+	}
+
+	if *resultsDir == "" && *inputSummary == "" && *timingsFile == "" {
+		err = fmt.Errorf("at least one of --results-dir, --input-summary or --timings must be provided")
+		return
+	}
+
+	if *inputSummary != "" {
+		var summary *buildreport.BuildSummary
+		summary, err = buildreport.ReadBuildSummary(*inputSummary)
+		if err != nil {
+			return
+		}
+		addTimings(buildreport.BuildTimingsFromSummary(summary))
+	}
+
+	if *resultsDir != "" {
+		var summary *buildreport.BuildSummary
+		summary, err = buildreport.CollectBuildSummary(*resultsDir)
+		if err != nil {
+			return
+		}
+		addTimings(buildreport.BuildTimingsFromSummary(summary))
+	}
+
+	if *timingsFile != "" {
+		var fileTimings map[string]float64
+		fileTimings, err = buildreport.ReadBuildTimings(*timingsFile)
+		if err != nil {
+			return
+		}
+		addTimings(fileTimings)
+	}
+
+	return
+}
+
+// formatSeconds renders a number of seconds as a duration rounded to the second, such as "1h2m3s".
+func formatSeconds(seconds float64) string {
+	return time.Duration(seconds * float64(time.Second)).Round(time.Second).String()
+}
+
+// printReport renders the report as a human readable overview followed by tables of the critical path,
+// the speed-up candidates and the slack of every SRPM.
+func printReport(out io.Writer, report *buildreport.BuildTimeReport) (err error) {
+	const (
+		minWidth = 0
+		tabWidth = 8
+		padding  = 2
+		padChar  = ' '
+		flags    = 0
+	)
+
+	fmt.Fprintf(out, "SRPMs:                %d (%d without timing)\n", len(report.Srpms), report.EstimatedSRPMs)
+	fmt.Fprintf(out, "Total work:           %s\n", formatSeconds(report.TotalWorkSeconds))
+	fmt.Fprintf(out, "Critical path:        %s\n", formatSeconds(report.CriticalPathSeconds))
+	fmt.Fprintf(out, "Minimum wall time:    %s with %d workers\n", formatSeconds(report.MinimumWallTimeSeconds), report.Workers)
+	fmt.Fprintf(out, "Simulated wall time:  %s with %d workers\n", formatSeconds(report.SimulatedWallTimeSeconds), report.Workers)
+
+	timings := make(map[string]*buildreport.SrpmTiming, len(report.Srpms))
+	for _, timing := range report.Srpms {
+		timings[timing.SrpmName] = timing
+	}
+
+	fmt.Fprintf(out, "\nCritical path (%d SRPMs):\n", len(report.CriticalPath))
+	writer := tabwriter.NewWriter(out, minWidth, tabWidth, padding, padChar, flags)
+	fmt.Fprintln(writer, "SRPM\tSTART\tDURATION")
+	for _, srpmName := range report.CriticalPath {
+		timing := timings[srpmName]
+		fmt.Fprintf(writer, "%s\t%s\t%s\n", srpmName, formatSeconds(timing.EarliestStartSeconds), formatDuration(timing))
+	}
+	err = writer.Flush()
+	if err != nil {
+		return
+	}
+
+	fmt.Fprintf(out, "\nTop %d SRPMs to speed up:\n", len(report.SpeedupCandidates))
+	writer = tabwriter.NewWriter(out, minWidth, tabWidth, padding, padChar, flags)
+	fmt.Fprintln(writer, "SRPM\tDURATION\tMAX SAVING")
+	for _, candidate := range report.SpeedupCandidates {
+		fmt.Fprintf(writer, "%s\t%s\t%s\n", candidate.SrpmName, formatSeconds(candidate.DurationSeconds), formatSeconds(candidate.SavingSeconds))
+	}
+	err = writer.Flush()
+	if err != nil {
+		return
+	}
+
+	fmt.Fprintln(out, "\nSlack per SRPM:")
+	writer = tabwriter.NewWriter(out, minWidth, tabWidth, padding, padChar, flags)
+	fmt.Fprintln(writer, "SRPM\tDURATION\tEARLIEST START\tLATEST START\tSLACK")
+	for _, timing := range report.Srpms {
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\n",
+			timing.SrpmName,
+			formatDuration(timing),
+			formatSeconds(timing.EarliestStartSeconds),
+			formatSeconds(timing.LatestStartSeconds),
+			formatSeconds(timing.SlackSeconds),
+		)
+	}
+	return writer.Flush()
+}
+
+// formatDuration renders the duration of an SRPM, marking the ones estimated from the median.
+func formatDuration(timing *buildreport.SrpmTiming) (duration string) {
+	duration = formatSeconds(timing.DurationSeconds)
+	if timing.Estimated {
+		duration += " (estimated)"
+	}
+	return
+}
+
+// writeJSON renders the report as indented JSON.
+func writeJSON(out io.Writer, report *buildreport.BuildTimeReport) (err error) {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return
+	}
+
+	_, err = fmt.Fprintln(out, string(data))
+	return
+}
@@ -9,7 +9,6 @@ import (
 	"path/filepath"
 	"strings"
 
-	"gonum.org/v1/gonum/graph"
 	"gopkg.in/alecthomas/kingpin.v2"
 
 	"microsoft.com/pkggen/internal/exe"
@@ -63,10 +62,10 @@ func main() {
 
 	if *reverseSearch {
 		logger.Log.Infof("Forward dependency search")
-		outputGraph, err = buildRequiresGraph(graph, nodeSet)
+		outputGraph, err = pkggraph.BuildRequiresGraph(graph, nodeSet)
 	} else {
 		logger.Log.Infof("Backwards dependants search")
-		outputGraph, err = buildDependsOnGraph(graph, nodeSet)
+		outputGraph, err = pkggraph.BuildDependsOnGraph(graph, nodeSet)
 	}
 
 	printSpecs(outputGraph)
@@ -110,50 +109,6 @@ func removeDuplicates(nodeList []*pkggraph.PkgNode) (uniqueNodeList []*pkggraph.
 	return
 }
 
-func buildRequiresGraph(graphIn *pkggraph.PkgGraph, nodeList []*pkggraph.PkgNode) (graphOut *pkggraph.PkgGraph, err error) {
-	newGraph := pkggraph.NewPkgGraph()
-
-	// Make a copy of the graph
-	newGraph, err = graphIn.DeepCopy()
-	if err != nil {
-		return
-	}
-
-	// Add a goal node to all the things we care about
-	root := newGraph.AddMetaNode(nil, nodeList)
-	graphOut, err = newGraph.CreateSubGraph(root)
-	if err != nil {
-		return
-	}
-
-	return
-}
-
-func buildDependsOnGraph(graphIn *pkggraph.PkgGraph, nodeList []*pkggraph.PkgNode) (graphOut *pkggraph.PkgGraph, err error) {
-	reversedGraph := pkggraph.NewPkgGraph()
-
-	// Make a copy of the graph
-	reversedGraph, err = graphIn.DeepCopy()
-	if err != nil {
-		return
-	}
-
-	// Then reverse every edge in the graph
-	for _, edge := range graph.EdgesOf(reversedGraph.Edges()) {
-		reversedGraph.RemoveEdge(edge.From().ID(), edge.To().ID())
-		reversedGraph.SetEdge(edge.ReversedEdge())
-	}
-
-	// Add a goal node to all the things we care about
-	root := reversedGraph.AddMetaNode(nil, nodeList)
-	graphOut, err = reversedGraph.CreateSubGraph(root)
-	if err != nil {
-		return
-	}
-
-	return
-}
-
 func printSpecs(graph *pkggraph.PkgGraph) {
 	specs := make(map[string]bool)
 	for _, n := range graph.AllNodes() {
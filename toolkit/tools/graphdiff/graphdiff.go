@@ -0,0 +1,145 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+// graphdiff is a tool to report how a dependency graph changed between two versions
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+	"microsoft.com/pkggen/internal/exe"
+	"microsoft.com/pkggen/internal/logger"
+	"microsoft.com/pkggen/internal/pkggraph"
+)
+
+const (
+	formatText = "text"
+	formatJSON = "json"
+)
+
+var (
+	app = kingpin.New("graphdiff", "Reports the packages, versions, dependencies, cycles and rebuilds which changed between two dependency graphs.")
+
+	oldGraphFile = app.Flag("old", "Path to the DOT graph file before the change.").Required().ExistingFile()
+	newGraphFile = app.Flag("new", "Path to the DOT graph file after the change.").Required().ExistingFile()
+
+	output = app.Flag("output", "Optional path to save the report to. Defaults to stdout.").String()
+
+	legalFormats = []string{formatText, formatJSON}
+	format       = app.Flag("format", "Format to render the report in.").PlaceHolder(exe.PlaceHolderize(legalFormats)).Default(formatText).Enum(legalFormats...)
+
+	logFile  = exe.LogFileFlag(app)
+	logLevel = exe.LogLevelFlag(app)
+)
+
+func main() {
+	app.Version(exe.ToolkitVersion)
+	kingpin.MustParse(app.Parse(os.Args[1:]))
+	logger.InitBestEffort(*logFile, *logLevel)
+
+	oldGraph := pkggraph.NewPkgGraph()
+	err := pkggraph.ReadDOTGraphFile(oldGraph, *oldGraphFile)
+	logger.PanicOnError(err, "Failed to read DOT graph '%s'.", *oldGraphFile)
+
+	newGraph := pkggraph.NewPkgGraph()
+	err = pkggraph.ReadDOTGraphFile(newGraph, *newGraphFile)
+	logger.PanicOnError(err, "Failed to read DOT graph '%s'.", *newGraphFile)
+
+	diff := pkggraph.DiffGraphs(oldGraph, newGraph)
+
+	out := os.Stdout
+	if *output != "" {
+		out, err = os.Create(*output)
+		logger.PanicOnError(err, "Failed to create output file '%s'.", *output)
+		defer out.Close()
+	}
+
+	switch *format {
+	case formatText:
+		err = printDiff(out, diff)
+	case formatJSON:
+		err = writeJSON(out, diff)
+	}
+	logger.PanicOnError(err, "Failed to render the graph diff.")
+}
+
+// printDiff renders the diff as a list of sections, skipping the ones without changes.
+func printDiff(out io.Writer, diff *pkggraph.GraphDiff) (err error) {
+	if diff.IsEmpty() {
+		_, err = fmt.Fprintln(out, "The graphs are equivalent.")
+		return
+	}
+
+	var lines []string
+	section := func(title string, entries []string) {
+		if len(entries) == 0 {
+			return
+		}
+		lines = append(lines, fmt.Sprintf("%s (%d):", title, len(entries)))
+		for _, entry := range entries {
+			lines = append(lines, "\t"+entry)
+		}
+		lines = append(lines, "")
+	}
+
+	section("Added nodes", nodeLines(diff.AddedNodes))
+	section("Removed nodes", nodeLines(diff.RemovedNodes))
+
+	var versionChanges []string
+	for _, change := range diff.VersionChanges {
+		versionChanges = append(versionChanges, fmt.Sprintf("%s %s: %s -> %s", change.Type, change.Name, change.OldVersion, change.NewVersion))
+	}
+	section("Version changes", versionChanges)
+
+	section("Added edges", edgeLines(diff.AddedEdges))
+	section("Removed edges", edgeLines(diff.RemovedEdges))
+	section("New cycles", cycleLines(diff.AddedCycles))
+	section("Resolved cycles", cycleLines(diff.RemovedCycles))
+	section("Packages which now must rebuild", nodeLines(diff.AddedRebuilds))
+	section("Packages which no longer must rebuild", nodeLines(diff.RemovedRebuilds))
+
+	_, err = fmt.Fprint(out, strings.Join(lines, "\n"))
+	return
+}
+
+func nodeLines(nodes []*pkggraph.DiffNode) (lines []string) {
+	for _, n := range nodes {
+		line := n.Label
+		if n.SrpmPath != "" {
+			line = fmt.Sprintf("%s (%s)", line, n.SrpmPath)
+		}
+		lines = append(lines, line)
+	}
+	return
+}
+
+func edgeLines(edges []*pkggraph.DiffEdge) (lines []string) {
+	for _, edge := range edges {
+		lines = append(lines, fmt.Sprintf("%s -> %s", edge.From, edge.To))
+	}
+	return
+}
+
+func cycleLines(cycles []*pkggraph.DiffCycle) (lines []string) {
+	for _, cycle := range cycles {
+		lines = append(lines, fmt.Sprintf("%s: %s", cycle.SrpmPath, strings.Join(cycle.Packages, ", ")))
+	}
+	return
+}
+
+// writeJSON renders the diff as indented JSON.
+func writeJSON(out io.Writer, diff *pkggraph.GraphDiff) (err error) {
+	data, err := json.MarshalIndent(diff, "", "  ")
+	if err != nil {
+		return
+	}
+
+	_, err = fmt.Fprintln(out, string(data))
+	return
+}
@@ -0,0 +1,196 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"fmt"
+
+	"microsoft.com/pkggen/internal/buildreport"
+	"microsoft.com/pkggen/internal/logger"
+	"microsoft.com/pkggen/internal/pkggraph"
+	"microsoft.com/pkggen/internal/pkgjson"
+)
+
+// bootstrapper breaks cycles through the BuildRequires of SPECs which may be built in bootstrap mode.
+// The bootstrap build of a SPEC only depends on its bootstrap BuildRequires, so a package in the cycle may depend
+// on the bootstrap build of the SPEC instead of the regular one. The regular build is then done once the rest
+// of the cycle has been built.
+type bootstrapper struct {
+	packages   map[string]*pkgjson.Package  // A bootstrappable package of each SRPM, by SRPM path
+	buildNodes map[string]*pkggraph.PkgNode // The bootstrap build node of each SRPM, by SRPM path
+	runNodes   map[int64]*pkggraph.PkgNode  // The bootstrap run node of each run node, by the ID of the run node
+}
+
+// newBootstrapper creates a bootstrapper for every bootstrappable package in repo.
+func newBootstrapper(repo *pkgjson.PackageRepo) (b *bootstrapper) {
+	b = &bootstrapper{
+		packages:   make(map[string]*pkgjson.Package),
+		buildNodes: make(map[string]*pkggraph.PkgNode),
+		runNodes:   make(map[int64]*pkggraph.PkgNode),
+	}
+
+	for _, pkg := range repo.Repo {
+		if pkg.Bootstrap {
+			b.packages[pkg.SrpmPath] = pkg
+		}
+	}
+
+	return
+}
+
+// bootstrapCycle attempts to break a cycle, where the last node of the cycle is the same as the first, with a
+// bootstrap build. The cycle must contain a build node whose edge to the next node of the cycle only comes from
+// BuildRequires its SPEC drops in bootstrap mode. The node of the cycle which depends on one of the SPEC's packages
+// is then made to depend on the bootstrap build of that package instead.
+// Returns false if none of the SPECs in the cycle can be bootstrapped to break it.
+func (b *bootstrapper) bootstrapCycle(g *pkggraph.PkgGraph, cycle []*pkggraph.PkgNode, origins edgeOrigins) (bootstrapped bool, err error) {
+	// Omit the last element of the cycle, since it is repeated as the first element
+	trimmedCycle := cycle[:len(cycle)-1]
+	cycleLength := len(trimmedCycle)
+
+	for i, buildNode := range trimmedCycle {
+		if buildNode.Type != pkggraph.TypeBuild || buildNode.Bootstrap {
+			continue
+		}
+
+		pkg := b.packages[buildNode.SrpmPath]
+		if pkg == nil {
+			continue
+		}
+
+		next := trimmedCycle[(i+1)%cycleLength]
+		if !droppedByBootstrap(pkg, origins[edgeKey{from: buildNode.ID(), to: next.ID()}]) {
+			continue
+		}
+
+		// Only a run node may lead to a build node, and it is itself required by the previous node of the cycle.
+		runNode := trimmedCycle[(i-1+cycleLength)%cycleLength]
+		dependant := trimmedCycle[(i-2+cycleLength)%cycleLength]
+		if runNode.Type != pkggraph.TypeRun || runNode.Bootstrap {
+			continue
+		}
+
+		var bootstrapRunNode *pkggraph.PkgNode
+		bootstrapRunNode, err = b.bootstrapRunNode(g, runNode, origins)
+		if err != nil {
+			return
+		}
+
+		g.RemoveEdge(dependant.ID(), runNode.ID())
+		g.SetEdge(g.NewEdge(dependant, bootstrapRunNode))
+		key := edgeKey{from: dependant.ID(), to: bootstrapRunNode.ID()}
+		origins[key] = append(origins[key], origins.remove(dependant.ID(), runNode.ID())...)
+
+		logger.Log.Infof("Breaking cycle through {%s} --> {%s}: {%s} now depends on {%s}", buildNode.FriendlyName(), next.FriendlyName(), dependant.FriendlyName(), bootstrapRunNode.FriendlyName())
+		bootstrapped = true
+		return
+	}
+
+	return
+}
+
+// droppedByBootstrap returns true if an edge only comes from BuildRequires of pkg which are not required in bootstrap mode.
+func droppedByBootstrap(pkg *pkgjson.Package, edgeOrigins []*dependencyOrigin) bool {
+	if len(edgeOrigins) == 0 {
+		return false
+	}
+
+	for _, origin := range edgeOrigins {
+		if origin.tag != buildreport.TagBuildRequires {
+			return false
+		}
+		for _, bootstrapDependency := range pkg.BootstrapBuildRequires {
+			if bootstrapDependency.String() == origin.dependency.String() {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// bootstrapRunNode returns the bootstrap copy of a run node, adding it if needed. The copy depends on the
+// bootstrap build of the run node's SRPM instead of the regular build, along with the same run-time requirements.
+func (b *bootstrapper) bootstrapRunNode(g *pkggraph.PkgGraph, runNode *pkggraph.PkgNode, origins edgeOrigins) (bootstrapRunNode *pkggraph.PkgNode, err error) {
+	bootstrapRunNode, found := b.runNodes[runNode.ID()]
+	if found {
+		return
+	}
+
+	bootstrapRunNode, err = g.AddBootstrapNode(runNode)
+	if err != nil {
+		return
+	}
+	b.runNodes[runNode.ID()] = bootstrapRunNode
+
+	for _, dependency := range graphNodesFrom(g, runNode) {
+		if dependency.Type == pkggraph.TypeBuild {
+			var bootstrapBuildNode *pkggraph.PkgNode
+			bootstrapBuildNode, err = b.bootstrapBuildNode(g, dependency, origins)
+			if err != nil {
+				return
+			}
+			g.SetEdge(g.NewEdge(bootstrapRunNode, bootstrapBuildNode))
+			continue
+		}
+
+		g.SetEdge(g.NewEdge(bootstrapRunNode, dependency))
+		key := edgeKey{from: bootstrapRunNode.ID(), to: dependency.ID()}
+		origins[key] = append(origins[key], origins[edgeKey{from: runNode.ID(), to: dependency.ID()}]...)
+	}
+
+	return
+}
+
+// bootstrapBuildNode returns the bootstrap build node of a build node's SRPM, adding it if needed.
+// The bootstrap build node depends on the bootstrap BuildRequires of the SRPM's SPEC.
+func (b *bootstrapper) bootstrapBuildNode(g *pkggraph.PkgGraph, buildNode *pkggraph.PkgNode, origins edgeOrigins) (bootstrapBuildNode *pkggraph.PkgNode, err error) {
+	bootstrapBuildNode, found := b.buildNodes[buildNode.SrpmPath]
+	if found {
+		return
+	}
+
+	pkg := b.packages[buildNode.SrpmPath]
+	if pkg == nil {
+		err = fmt.Errorf("(%s) is not bootstrappable", buildNode.SrpmPath)
+		return
+	}
+
+	bootstrapBuildNode, err = g.AddBootstrapNode(buildNode)
+	if err != nil {
+		return
+	}
+	b.buildNodes[buildNode.SrpmPath] = bootstrapBuildNode
+
+	for _, dependency := range pkg.BootstrapBuildRequires {
+		err = addSingleDependency(g, origins, bootstrapBuildNode, dependency, buildreport.TagBuildRequires)
+		if err != nil {
+			logger.Log.Errorf("Unable to add bootstrap build-time dependencies for %+v", pkg)
+			return
+		}
+	}
+
+	logger.Log.Debugf("Added %s with %d BuildRequires", bootstrapBuildNode.FriendlyName(), len(pkg.BootstrapBuildRequires))
+	return
+}
+
+// graphNodesFrom returns the nodes a node has edges to.
+func graphNodesFrom(g *pkggraph.PkgGraph, node *pkggraph.PkgNode) (nodes []*pkggraph.PkgNode) {
+	dependencies := g.From(node.ID())
+	for dependencies.Next() {
+		nodes = append(nodes, dependencies.Node().(*pkggraph.PkgNode).This)
+	}
+	return
+}
+
+// cycleExists returns true if every edge of a cycle, where the last node of the cycle is the same as the first,
+// is still in the graph. Fixing one cycle may break others found at the same time.
+func cycleExists(g *pkggraph.PkgGraph, cycle []*pkggraph.PkgNode) bool {
+	for i := 0; i < len(cycle)-1; i++ {
+		if !g.HasEdgeFromTo(cycle[i].ID(), cycle[i+1].ID()) {
+			return false
+		}
+	}
+	return true
+}
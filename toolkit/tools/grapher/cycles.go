@@ -0,0 +1,99 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"microsoft.com/pkggen/internal/buildreport"
+	"microsoft.com/pkggen/internal/logger"
+	"microsoft.com/pkggen/internal/pkggraph"
+	"microsoft.com/pkggen/internal/pkgjson"
+)
+
+// edgeKey identifies an edge of the graph by the IDs of its nodes.
+type edgeKey struct {
+	from int64
+	to   int64
+}
+
+// dependencyOrigin is the Requires or BuildRequires of a SPEC which created an edge.
+type dependencyOrigin struct {
+	specPath   string
+	tag        string
+	dependency *pkgjson.PackageVer
+}
+
+// edgeOrigins maps the edges of the graph to the requirements which created them.
+// Edges which are implied by the graph, such as the ones from a "Run" node to its "Build" node, have no origin.
+type edgeOrigins map[edgeKey][]*dependencyOrigin
+
+// add records the origin of the edge from -> to. Since the meta nodes of rich dependencies are created for a single
+// requirement, the edges to their operands are attributed to the same origin.
+func (o edgeOrigins) add(g *pkggraph.PkgGraph, from, to *pkggraph.PkgNode, origin *dependencyOrigin) {
+	key := edgeKey{from: from.ID(), to: to.ID()}
+	o[key] = append(o[key], origin)
+
+	if to.Type != pkggraph.TypePureMeta || to.VersionedPkg == nil || !to.VersionedPkg.IsRich() {
+		return
+	}
+
+	operands := g.From(to.ID())
+	for operands.Next() {
+		o.add(g, to, operands.Node().(*pkggraph.PkgNode).This, origin)
+	}
+}
+
+// remove forgets the origins of an edge and returns them.
+func (o edgeOrigins) remove(from, to int64) (origins []*dependencyOrigin) {
+	key := edgeKey{from: from, to: to}
+	origins = o[key]
+	delete(o, key)
+	return
+}
+
+// explainCycle describes every edge of a cycle, where the last node of the cycle is the same as the first,
+// along with the SPEC lines which created it.
+func explainCycle(cycle []*pkggraph.PkgNode, origins edgeOrigins) (edges []*buildreport.CycleEdge) {
+	for i := 0; i < len(cycle)-1; i++ {
+		from, to := cycle[i], cycle[i+1]
+		edge := &buildreport.CycleEdge{
+			From: from.FriendlyName(),
+			To:   to.FriendlyName(),
+			Type: edgeType(from, to),
+		}
+
+		for _, origin := range origins[edgeKey{from: from.ID(), to: to.ID()}] {
+			requirementOrigin := &buildreport.RequirementOrigin{
+				SpecPath:    origin.specPath,
+				Tag:         origin.tag,
+				Requirement: buildreport.FormatRequirement(origin.dependency),
+			}
+
+			var err error
+			requirementOrigin.Line, requirementOrigin.LineText, err = buildreport.FindRequirementLine(origin.specPath, origin.tag, origin.dependency)
+			if err != nil {
+				logger.Log.Debugf("Failed to search (%s) for the line requiring (%s): %s", origin.specPath, origin.dependency.Name, err)
+			}
+
+			edge.Origins = append(edge.Origins, requirementOrigin)
+		}
+
+		edges = append(edges, edge)
+	}
+
+	return
+}
+
+// edgeType returns the kind of dependency the edge from -> to represents.
+func edgeType(from, to *pkggraph.PkgNode) buildreport.EdgeType {
+	switch {
+	case from.Type == pkggraph.TypeBuild:
+		return buildreport.EdgeBuild
+	case from.Type == pkggraph.TypeRun && to.Type == pkggraph.TypeBuild:
+		return buildreport.EdgeBuiltFrom
+	case from.Type == pkggraph.TypeRun:
+		return buildreport.EdgeRun
+	default:
+		return buildreport.EdgeMeta
+	}
+}
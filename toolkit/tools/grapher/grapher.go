@@ -11,10 +11,12 @@ import (
 	"gonum.org/v1/gonum/graph"
 	"gonum.org/v1/gonum/graph/topo"
 	"gopkg.in/alecthomas/kingpin.v2"
+	"microsoft.com/pkggen/internal/buildreport"
 	"microsoft.com/pkggen/internal/exe"
 	"microsoft.com/pkggen/internal/logger"
 	"microsoft.com/pkggen/internal/pkggraph"
 	"microsoft.com/pkggen/internal/pkgjson"
+	"microsoft.com/pkggen/internal/rpm"
 )
 
 var (
@@ -26,6 +28,8 @@ var (
 	logLevel         = exe.LogLevelFlag(app)
 	strictGoals      = app.Flag("strict-goals", "Don't allow missing goal packages").Bool()
 	strictUnresolved = app.Flag("strict-unresolved", "Don't allow missing unresolved packages").Bool()
+	targetArch       = exe.TargetArchFlag(app)
+	cycleReport      = app.Flag("cycle-report", "Optional path to save a JSON report explaining every unfixable dependency cycle to").String()
 
 	depGraph = pkggraph.NewPkgGraph()
 )
@@ -43,12 +47,27 @@ func main() {
 		logger.Log.Panic(err)
 	}
 
-	err = populateGraph(depGraph, &localPackages)
+	buildArch, err := rpm.ResolveTargetArch(*targetArch)
 	if err != nil {
 		logger.Log.Panic(err)
 	}
 
-	err = validateGraph(depGraph)
+	err = validatePackageArchitectures(&localPackages, buildArch)
+	if err != nil {
+		logger.Log.Panic(err)
+	}
+
+	origins := make(edgeOrigins)
+	err = populateGraph(depGraph, &localPackages, origins)
+	if err != nil {
+		logger.Log.Panic(err)
+	}
+
+	report, err := validateGraph(depGraph, origins, newBootstrapper(&localPackages))
+	if *cycleReport != "" {
+		writeErr := buildreport.WriteCycleReport(*cycleReport, report)
+		logger.PanicOnError(writeErr, "Failed to write cycle report '%s'.", *cycleReport)
+	}
 	if err != nil {
 		logger.Log.Panic(err)
 	}
@@ -148,28 +167,16 @@ func addNodesForPackage(g *pkggraph.PkgGraph, pkgVer *pkgjson.PackageVer, pkg *p
 }
 
 // addSingleDependency will add an edge between packageNode and the "Run" node for the
-// dependency described in the PackageVer structure. Returns an error if the
-// addition failed.
-func addSingleDependency(g *pkggraph.PkgGraph, packageNode *pkggraph.PkgNode, dependency *pkgjson.PackageVer) error {
-	var dependentNode *pkggraph.PkgNode
+// dependency described in the PackageVer structure. Rich dependencies are linked through
+// a meta node instead, see addRichDependency. The edge is attributed to the requirement
+// tag of packageNode's SPEC in origins. Returns an error if the addition failed.
+func addSingleDependency(g *pkggraph.PkgGraph, origins edgeOrigins, packageNode *pkggraph.PkgNode, dependency *pkgjson.PackageVer, tag string) error {
 	logger.Log.Tracef("Adding a dependency from %+v to %+v", packageNode.VersionedPkg, dependency)
-	nodes, err := g.FindBestPkgNode(dependency)
+	dependentNode, err := findOrAddDependencyNode(g, packageNode.SrpmPath, dependency)
 	if err != nil {
-		logger.Log.Errorf("Unable to check lookup list for %+v (%s)", dependency, err)
 		return err
 	}
 
-	if nodes == nil {
-		dependentNode, err = addUnresolvedPackage(g, dependency)
-		if err != nil {
-			logger.Log.Errorf(`Could not add a package "%s"`, dependency.Name)
-			return err
-		}
-	} else {
-		// All dependencies are assumed to be "Run" dependencies
-		dependentNode = nodes.RunNode
-	}
-
 	// SetEdge panics on error, and does not support looping edges.
 	newEdge := g.NewEdge(packageNode, dependentNode)
 	defer func() {
@@ -181,11 +188,135 @@ func addSingleDependency(g *pkggraph.PkgGraph, packageNode *pkggraph.PkgNode, de
 		logger.Log.Warnf("Package %+v requires itself!", packageNode)
 	} else {
 		g.SetEdge(newEdge)
+		origins.add(g, packageNode, dependentNode, &dependencyOrigin{
+			specPath:   packageNode.SpecPath,
+			tag:        tag,
+			dependency: dependency,
+		})
 	}
 
 	return err
 }
 
+// findOrAddDependencyNode returns the node a package requiring the dependency should depend on.
+// This is the "Run" node of the best matching package, a new unresolved node if there is no match,
+// or a new meta node for rich dependencies.
+func findOrAddDependencyNode(g *pkggraph.PkgGraph, srpmPath string, dependency *pkgjson.PackageVer) (dependentNode *pkggraph.PkgNode, err error) {
+	if dependency.IsRich() {
+		return addRichDependency(g, srpmPath, dependency)
+	}
+
+	nodes, err := g.FindBestPkgNode(dependency)
+	if err != nil {
+		logger.Log.Errorf("Unable to check lookup list for %+v (%s)", dependency, err)
+		return
+	}
+
+	if nodes == nil {
+		dependentNode, err = addUnresolvedPackage(g, dependency)
+		if err != nil {
+			logger.Log.Errorf(`Could not add a package "%s"`, dependency.Name)
+		}
+		return
+	}
+
+	// All dependencies are assumed to be "Run" dependencies
+	dependentNode = nodes.RunNode
+	return
+}
+
+// addRichDependency adds a meta node representing a rich dependency, with edges to the nodes of the operands
+// which have to be satisfied (see requiredOperands). Nested rich dependencies get their own meta nodes.
+// The meta node is attributed to srpmPath so cycles through it can be fixed like any other cycle within a SPEC.
+func addRichDependency(g *pkggraph.PkgGraph, srpmPath string, dependency *pkgjson.PackageVer) (metaNode *pkggraph.PkgNode, err error) {
+	operands := requiredOperands(g, dependency)
+	if dependency.Operator == pkgjson.OperatorOr && !isLocallyProvided(g, operands[0]) {
+		logger.Log.Warnf("No local package satisfies any option of (%s), make sure (%s) is available. Please refer to 'docs/how_it_works/3_package_building.md#rich-dependencies' for explanation of limitations.", dependency.Name, operands[0].Name)
+	}
+
+	operandNodes := make([]*pkggraph.PkgNode, 0, len(operands))
+	for _, operand := range operands {
+		var operandNode *pkggraph.PkgNode
+		operandNode, err = findOrAddDependencyNode(g, srpmPath, operand)
+		if err != nil {
+			return
+		}
+		operandNodes = append(operandNodes, operandNode)
+	}
+
+	metaNode = g.AddMetaNode(nil, operandNodes)
+	metaNode.VersionedPkg = dependency
+	metaNode.SrpmPath = srpmPath
+
+	logger.Log.Debugf("Added %s for rich dependency %s requiring %d of its operands", metaNode.FriendlyName(), dependency.Name, len(operandNodes))
+	return
+}
+
+// requiredOperands picks the operands of a rich dependency which the graph should depend on.
+// Since the graph can't know what will be installed alongside a package, a package counts as
+// installed if it is built locally (see isLocallyProvided).
+// "and" and "with" require every operand. "or" requires its first locally provided operand, or its first
+// operand if none are. "if" requires its first operand if the condition is provided locally, otherwise its
+// "else" operand, if any. "unless" is the opposite of "if". "without" requires its first operand.
+func requiredOperands(g *pkggraph.PkgGraph, dependency *pkgjson.PackageVer) (operands []*pkgjson.PackageVer) {
+	const (
+		thenOperand      = 0
+		conditionOperand = 1
+		elseOperand      = 2
+	)
+
+	elseOperands := func() []*pkgjson.PackageVer {
+		if len(dependency.Operands) > elseOperand {
+			return dependency.Operands[elseOperand:]
+		}
+		return nil
+	}
+
+	switch dependency.Operator {
+	case pkgjson.OperatorAnd, pkgjson.OperatorWith:
+		operands = dependency.Operands
+	case pkgjson.OperatorOr:
+		for _, operand := range dependency.Operands {
+			if isLocallyProvided(g, operand) {
+				return []*pkgjson.PackageVer{operand}
+			}
+		}
+		operands = dependency.Operands[:1]
+	case pkgjson.OperatorIf:
+		if isLocallyProvided(g, dependency.Operands[conditionOperand]) {
+			operands = dependency.Operands[thenOperand : thenOperand+1]
+		} else {
+			operands = elseOperands()
+		}
+	case pkgjson.OperatorUnless:
+		if isLocallyProvided(g, dependency.Operands[conditionOperand]) {
+			operands = elseOperands()
+		} else {
+			operands = dependency.Operands[thenOperand : thenOperand+1]
+		}
+	case pkgjson.OperatorWithout:
+		operands = dependency.Operands[thenOperand : thenOperand+1]
+	}
+
+	return
+}
+
+// isLocallyProvided returns true if the dependency is satisfied by packages built from local SPECs.
+// A rich dependency is locally provided if every operand it requires is.
+func isLocallyProvided(g *pkggraph.PkgGraph, dependency *pkgjson.PackageVer) bool {
+	if dependency.IsRich() {
+		for _, operand := range requiredOperands(g, dependency) {
+			if !isLocallyProvided(g, operand) {
+				return false
+			}
+		}
+		return true
+	}
+
+	nodes, err := g.FindBestPkgNode(dependency)
+	return err == nil && nodes != nil && nodes.RunNode.Type == pkggraph.TypeRun
+}
+
 // addLocalPackage adds the package provided by the Package structure, and
 // updates the SRPM path name
 func addLocalPackage(g *pkggraph.PkgGraph, pkg *pkgjson.Package) error {
@@ -196,7 +327,7 @@ func addLocalPackage(g *pkggraph.PkgGraph, pkg *pkgjson.Package) error {
 // addDependencies adds edges for both build and runtime requirements for the
 // package described in the Package structure. Returns an error if the edges
 // could not be created.
-func addPkgDependencies(g *pkggraph.PkgGraph, pkg *pkgjson.Package) (dependenciesAdded int, err error) {
+func addPkgDependencies(g *pkggraph.PkgGraph, pkg *pkgjson.Package, origins edgeOrigins) (dependenciesAdded int, err error) {
 	provide := pkg.Provides
 	runDependencies := pkg.Requires
 	buildDependencies := pkg.BuildRequires
@@ -216,7 +347,7 @@ func addPkgDependencies(g *pkggraph.PkgGraph, pkg *pkgjson.Package) (dependencie
 	// For each run time and build time dependency, add the edges
 	logger.Log.Tracef("Adding run dependencies")
 	for _, dependency := range runDependencies {
-		err = addSingleDependency(g, runNode, dependency)
+		err = addSingleDependency(g, origins, runNode, dependency, buildreport.TagRequires)
 		if err != nil {
 			logger.Log.Errorf("Unable to add run-time dependencies for %+v", pkg)
 			return
@@ -226,7 +357,7 @@ func addPkgDependencies(g *pkggraph.PkgGraph, pkg *pkgjson.Package) (dependencie
 
 	logger.Log.Tracef("Adding build dependencies")
 	for _, dependency := range buildDependencies {
-		err = addSingleDependency(g, buildNode, dependency)
+		err = addSingleDependency(g, origins, buildNode, dependency, buildreport.TagBuildRequires)
 		if err != nil {
 			logger.Log.Errorf("Unable to add build-time dependencies for %+v", pkg)
 			return
@@ -237,9 +368,21 @@ func addPkgDependencies(g *pkggraph.PkgGraph, pkg *pkgjson.Package) (dependencie
 	return
 }
 
+// validatePackageArchitectures makes sure every local package is built for targetArch, catching
+// package lists which were generated for a different architecture than the one being built.
+func validatePackageArchitectures(repo *pkgjson.PackageRepo, targetArch string) (err error) {
+	for _, pkg := range repo.Repo {
+		if pkg.Architecture != targetArch && pkg.Architecture != rpm.NoArch {
+			return fmt.Errorf("package %+v from SRPM (%s) is built for architecture (%s) instead of the target architecture (%s)", pkg.Provides, pkg.SrpmPath, pkg.Architecture, targetArch)
+		}
+	}
+
+	return
+}
+
 // populateGraph adds all the data contained in the PackageRepo structure into
-// the graph.
-func populateGraph(g *pkggraph.PkgGraph, repo *pkgjson.PackageRepo) (err error) {
+// the graph, recording the requirement behind each dependency edge in origins.
+func populateGraph(g *pkggraph.PkgGraph, repo *pkgjson.PackageRepo, origins edgeOrigins) (err error) {
 	packages := repo.Repo
 
 	// Scan and add each package we know about
@@ -260,7 +403,7 @@ func populateGraph(g *pkggraph.PkgGraph, repo *pkgjson.PackageRepo) (err error)
 	dependenciesAdded := 0
 	for idx := range packages {
 		pkg := packages[idx]
-		num, err := addPkgDependencies(g, pkg)
+		num, err := addPkgDependencies(g, pkg, origins)
 		if err != nil {
 			logger.Log.Errorf("Failed to add dependency %+v", pkg)
 			return err
@@ -273,16 +416,15 @@ func populateGraph(g *pkggraph.PkgGraph, repo *pkgjson.PackageRepo) (err error)
 }
 
 // fixCycle attempts to fix a cycle. Cycles may be acceptable if all nodes are from the same spec file.
-// If a cycle can be fixed an additional meta node will be added to represent the interdependencies of the cycle.
-func fixCycle(g *pkggraph.PkgGraph, cycle []*pkggraph.PkgNode) (err error) {
+// If a cycle can be fixed an additional meta node will be added to represent the interdependencies of the cycle,
+// and the origins of the dependencies moved to it.
+func fixCycle(g *pkggraph.PkgGraph, cycle []*pkggraph.PkgNode, origins edgeOrigins) (err error) {
 	specFile := cycle[0].SrpmPath
 	// Omit the first element of the cycle, since it is repeated as the last element
 	trimmedCycle := cycle[1:]
 	logger.Log.Debugf("Found cycle starting at %s", cycle[0].FriendlyName())
 
-	// For each node, remove any edges which point to other nodes in the cycle, and move any remaining dependencies to a new
-	// meta node, then have everything in the cycle depend on the new meta node.
-	groupedDependencies := make(map[int64]bool)
+	// Check the whole cycle before changing the graph so unfixable cycles are left intact
 	for _, currentNode := range trimmedCycle {
 		logger.Log.Tracef("\tCycle node: %s", currentNode.FriendlyName())
 		if currentNode.SrpmPath != specFile {
@@ -291,6 +433,13 @@ func fixCycle(g *pkggraph.PkgGraph, cycle []*pkggraph.PkgNode) (err error) {
 		if currentNode.Type == pkggraph.TypeBuild {
 			return fmt.Errorf("cycle contains build dependencies, unresolvable")
 		}
+	}
+
+	// For each node, remove any edges which point to other nodes in the cycle, and move any remaining dependencies to a new
+	// meta node, then have everything in the cycle depend on the new meta node.
+	groupedDependencies := make(map[int64]bool)
+	groupedOrigins := make(map[int64][]*dependencyOrigin)
+	for _, currentNode := range trimmedCycle {
 		// Remove all links to other members of the cycle
 		for _, nodeInCycle := range trimmedCycle {
 			g.RemoveEdge(currentNode.ID(), nodeInCycle.ID())
@@ -300,6 +449,7 @@ func fixCycle(g *pkggraph.PkgGraph, cycle []*pkggraph.PkgNode) (err error) {
 		fromNodes := graph.NodesOf(g.From(currentNode.ID()))
 		for _, from := range fromNodes {
 			groupedDependencies[from.ID()] = true
+			groupedOrigins[from.ID()] = append(groupedOrigins[from.ID()], origins.remove(currentNode.ID(), from.ID())...)
 			g.RemoveEdge(currentNode.ID(), from.ID())
 		}
 	}
@@ -315,11 +465,18 @@ func fixCycle(g *pkggraph.PkgGraph, cycle []*pkggraph.PkgNode) (err error) {
 	// Enable cycle detection between meta nodes within the same spec file
 	metaNode.SrpmPath = specFile
 
+	for id, dependencyOrigins := range groupedOrigins {
+		origins[edgeKey{from: metaNode.ID(), to: id}] = dependencyOrigins
+	}
+
 	return
 }
 
-// validateGraph makes sure the graph is a directed acyclic graph (DAG)
-func validateGraph(g *pkggraph.PkgGraph) (err error) {
+// validateGraph makes sure the graph is a directed acyclic graph (DAG).
+// Cycles which can't be fixed are broken with bootstrap builds where possible.
+// Returns a report explaining every cycle which could not be fixed.
+func validateGraph(g *pkggraph.PkgGraph, origins edgeOrigins, bootstrap *bootstrapper) (report *buildreport.CycleReport, err error) {
+	report = &buildreport.CycleReport{}
 	cycles := topo.DirectedCyclesIn(g)
 
 	// Try to fix the cycles if we can before reporting them
@@ -333,8 +490,24 @@ func validateGraph(g *pkggraph.PkgGraph) (err error) {
 				pkgCycle = append(pkgCycle, node.(*pkggraph.PkgNode).This)
 			}
 
-			err = fixCycle(g, pkgCycle)
-			if err != nil {
+			// Fixing an earlier cycle may have broken this one, any remaining cycles are found again below
+			if !cycleExists(g, pkgCycle) {
+				continue
+			}
+
+			fixErr := fixCycle(g, pkgCycle, origins)
+			if fixErr != nil {
+				var bootstrapped bool
+				bootstrapped, err = bootstrap.bootstrapCycle(g, pkgCycle, origins)
+				if err != nil {
+					return
+				}
+				if bootstrapped {
+					continue
+				}
+
+				report.AddCycle(fixErr.Error(), explainCycle(pkgCycle, origins))
+
 				var cycleStringBuilder strings.Builder
 				fmt.Fprintf(&cycleStringBuilder, "{%s}", pkgCycle[0].FriendlyName())
 				for _, node := range pkgCycle[1:] {
@@ -346,8 +519,16 @@ func validateGraph(g *pkggraph.PkgGraph) (err error) {
 		}
 
 		if unfixableCycleCount > 0 {
+			report.SuggestBreaks()
+			for _, suggestion := range report.SuggestedBreaks {
+				if suggestion.Bootstrap {
+					logger.Log.Infof("Removing {%s} --> {%s} would break %d of the cycles, its SPEC may be declared as a bootstrap build without that requirement", suggestion.Edge.From, suggestion.Edge.To, suggestion.CycleCount)
+					continue
+				}
+				logger.Log.Infof("Removing {%s} --> {%s} would break %d of the cycles", suggestion.Edge.From, suggestion.Edge.To, suggestion.CycleCount)
+			}
 			err = fmt.Errorf("cycles detected in dependency graph")
-			return err
+			return
 		}
 
 		// Recalculate the list of cycles
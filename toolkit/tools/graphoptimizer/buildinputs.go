@@ -0,0 +1,292 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gonum.org/v1/gonum/graph"
+
+	"microsoft.com/pkggen/internal/buildmanifest"
+	"microsoft.com/pkggen/internal/file"
+	"microsoft.com/pkggen/internal/logger"
+	"microsoft.com/pkggen/internal/pkggraph"
+	"microsoft.com/pkggen/internal/pkgjson"
+	"microsoft.com/pkggen/internal/rpm"
+	"microsoft.com/pkggen/internal/versioncompare"
+)
+
+const (
+	specSuffix           = ".spec"
+	signaturesFileSuffix = ".signatures.json"
+	rpmSuffix            = ".rpm"
+)
+
+// buildInputs calculates the inputs an SRPM is built from so they can be compared against the build manifest.
+type buildInputs struct {
+	manifestDir    string
+	signatureFiles map[string]string // Signature files found in the SPECS directory, by SPEC name
+	macrosHash     string
+	cachedRPMs     map[string][]*cachedRPM // RPMs cached by graphpkgfetcher, by package name
+}
+
+// cachedRPM is an RPM graphpkgfetcher cached to satisfy a remote dependency.
+type cachedRPM struct {
+	pkgVer *pkgjson.PackageVer
+	nevra  string
+}
+
+// newBuildInputs prepares to check SRPMs against the build manifest in manifestDir.
+// specsDir is the optional directory holding the original SPEC files and their signatures files,
+// macroDir and rpmmacrosFile are the optional rpm macros the SRPMs will be built with,
+// cachedRPMsDir is the optional directory holding the RPMs graphpkgfetcher cached for remote dependencies.
+func newBuildInputs(manifestDir, specsDir, macroDir, rpmmacrosFile, cachedRPMsDir, distTag string) (inputs *buildInputs, err error) {
+	inputs = &buildInputs{
+		manifestDir:    manifestDir,
+		signatureFiles: make(map[string]string),
+		cachedRPMs:     make(map[string][]*cachedRPM),
+	}
+
+	if specsDir != "" {
+		err = filepath.Walk(specsDir, func(path string, info os.FileInfo, walkErr error) error {
+			if walkErr != nil {
+				return walkErr
+			}
+			if info.Mode().IsRegular() && strings.HasSuffix(info.Name(), signaturesFileSuffix) {
+				inputs.signatureFiles[strings.TrimSuffix(info.Name(), signaturesFileSuffix)] = path
+			}
+			return nil
+		})
+		if err != nil {
+			return
+		}
+	}
+
+	var macroFiles []string
+	if macroDir != "" {
+		var infos []os.FileInfo
+		infos, err = ioutil.ReadDir(macroDir)
+		if err != nil {
+			return
+		}
+		for _, info := range infos {
+			if info.Mode().IsRegular() {
+				macroFiles = append(macroFiles, filepath.Join(macroDir, info.Name()))
+			}
+		}
+	}
+	if rpmmacrosFile != "" {
+		macroFiles = append(macroFiles, rpmmacrosFile)
+	}
+
+	macroFilesHash, err := buildmanifest.HashFiles(macroFiles)
+	if err != nil {
+		return
+	}
+	inputs.macrosHash = buildmanifest.HashStrings([]string{macroFilesHash, fmt.Sprintf("dist_tag=%s", distTag)})
+
+	// The cache is only populated once graphpkgfetcher has run, so it may not exist yet.
+	if cachedRPMsDir != "" {
+		exists, _ := file.DirExists(cachedRPMsDir)
+		if exists {
+			err = inputs.readCachedRPMs(cachedRPMsDir)
+		}
+	}
+
+	return
+}
+
+// readCachedRPMs queries the name and version of every RPM in cachedRPMsDir.
+func (b *buildInputs) readCachedRPMs(cachedRPMsDir string) (err error) {
+	const (
+		queryFormat          = "%{NAME}\t%{EPOCH}\t%{VERSION}-%{RELEASE}\t%{ARCH}"
+		queryPackageArgument = "-p"
+		queryFieldCount      = 4
+		noEpoch              = "(none)"
+	)
+
+	return filepath.Walk(cachedRPMsDir, func(path string, info os.FileInfo, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		if !info.Mode().IsRegular() || !strings.HasSuffix(info.Name(), rpmSuffix) {
+			return nil
+		}
+
+		results, err := rpm.QueryPackage(path, queryFormat, nil, queryPackageArgument)
+		if err != nil {
+			return err
+		}
+
+		fields := strings.Split(strings.Join(results, ""), "\t")
+		if len(fields) != queryFieldCount {
+			return fmt.Errorf("unexpected rpm query result for (%s): %v", path, results)
+		}
+
+		name, epoch, version, arch := fields[0], fields[1], fields[2], fields[3]
+		if epoch == noEpoch {
+			epoch = ""
+		}
+
+		pkgVer := &pkgjson.PackageVer{Name: name, Epoch: epoch, Version: version, Condition: "="}
+		b.cachedRPMs[name] = append(b.cachedRPMs[name], &cachedRPM{
+			pkgVer: pkgVer,
+			nevra:  fmt.Sprintf("%s-%s.%s", name, pkgVer.EVR(), arch),
+		})
+		return nil
+	})
+}
+
+// cachedRPMFor returns the NEVRA of the newest cached RPM satisfying a remote dependency, the same one tdnf installs.
+// Dependencies which are not package names, such as files or virtual provides, are not found.
+func (b *buildInputs) cachedRPMFor(pkgVer *pkgjson.PackageVer) (nevra string, found bool) {
+	requiredInterval, err := pkgVer.Interval()
+	if err != nil {
+		return
+	}
+
+	var newestVersion *versioncompare.TolerantVersion
+	for _, cached := range b.cachedRPMs[pkgVer.Name] {
+		cachedInterval, err := cached.pkgVer.Interval()
+		if err != nil || !requiredInterval.Satisfies(&cachedInterval) {
+			continue
+		}
+
+		cachedVersion := versioncompare.New(cached.pkgVer.EVR())
+		if newestVersion == nil || cachedVersion.Compare(newestVersion) > 0 {
+			newestVersion = cachedVersion
+			nevra = cached.nevra
+			found = true
+		}
+	}
+
+	return
+}
+
+// resolvedBuildRequires lists the exact package each of the build nodes depends on.
+func (b *buildInputs) resolvedBuildRequires(pkgGraph *pkggraph.PkgGraph, buildNodes []*pkggraph.PkgNode) (buildRequires []string) {
+	seen := make(map[string]bool)
+	for _, buildNode := range buildNodes {
+		for _, dependency := range graph.NodesOf(pkgGraph.From(buildNode.ID())) {
+			dependencyNode := dependency.(*pkggraph.PkgNode)
+			if dependencyNode.VersionedPkg == nil {
+				continue
+			}
+
+			var resolved string
+			switch dependencyNode.Type {
+			case pkggraph.TypeRemote:
+				// Remote packages are versioned by the RPM graphpkgfetcher cached for them,
+				// record the requirement instead if nothing has been cached yet.
+				var found bool
+				resolved, found = b.cachedRPMFor(dependencyNode.VersionedPkg)
+				if !found {
+					resolved = fmt.Sprintf("%s %s%s (remote)", dependencyNode.VersionedPkg.Name, dependencyNode.VersionedPkg.Condition, dependencyNode.VersionedPkg.Version)
+				}
+			case pkggraph.TypePureMeta:
+				// Rich dependencies are represented by a meta node holding the whole expression.
+				resolved = dependencyNode.VersionedPkg.Name
+			default:
+				resolved = fmt.Sprintf("%s-%s", dependencyNode.VersionedPkg.Name, dependencyNode.VersionedPkg.Version)
+			}
+
+			if !seen[resolved] {
+				seen[resolved] = true
+				buildRequires = append(buildRequires, resolved)
+			}
+		}
+	}
+
+	sort.Strings(buildRequires)
+	return
+}
+
+// entryForSRPM calculates the manifest entry describing the current inputs of an SRPM.
+func (b *buildInputs) entryForSRPM(job *srpmBuildStateJob) (entry *buildmanifest.Entry, err error) {
+	specHash, err := file.GenerateSHA256(job.specFile)
+	if err != nil {
+		return
+	}
+
+	// Prefer the signatures file since it is far cheaper than hashing every source, fall back to
+	// the sources extracted from the SRPM when a SPEC has no signatures file.
+	specName := strings.TrimSuffix(filepath.Base(job.specFile), specSuffix)
+	var sourcesHash string
+	if signaturesFile, found := b.signatureFiles[specName]; found {
+		sourcesHash, err = buildmanifest.HashFiles([]string{signaturesFile})
+	} else {
+		specFileName := filepath.Base(job.specFile)
+		sourcesHash, err = buildmanifest.HashDirectory(job.sourceDir, func(name string) bool {
+			return name == specFileName
+		})
+	}
+	if err != nil {
+		return
+	}
+
+	entry = &buildmanifest.Entry{
+		SrpmPath: job.srpm,
+		Inputs: buildmanifest.Inputs{
+			SpecHash:          specHash,
+			SourcesHash:       sourcesHash,
+			BuildRequiresHash: buildmanifest.HashStrings(job.buildRequires),
+			MacrosHash:        b.macrosHash,
+		},
+		BuildRequires: job.buildRequires,
+	}
+
+	return
+}
+
+// inputsUnchanged returns true if an SRPM's current inputs match the ones it was last built from.
+// SRPMs with no committed entry which are already fully built have their current inputs adopted,
+// this avoids rebuilding every package the first time the manifest is used.
+func (b *buildInputs) inputsUnchanged(entry *buildmanifest.Entry) (unchanged bool, err error) {
+	previousEntry, err := buildmanifest.ReadEntry(b.manifestDir, entry.SrpmPath)
+	if err != nil {
+		return
+	}
+
+	if previousEntry == nil {
+		logger.Log.Debugf("No build manifest entry for (%s), recording its current inputs", entry.SrpmPath)
+		err = buildmanifest.WriteEntry(b.manifestDir, entry)
+		unchanged = (err == nil)
+		return
+	}
+
+	changed := previousEntry.Inputs.ChangedInputs(&entry.Inputs)
+	if len(changed) > 0 {
+		logger.Log.Infof("Inputs of (%s) changed since it was built: %s", entry.SrpmPath, strings.Join(changed, ", "))
+		return
+	}
+
+	unchanged = true
+	return
+}
+
+// writePendingEntries records the inputs of every SRPM which will be built.
+// The entries are committed by pkgworker once each SRPM is built successfully.
+func (b *buildInputs) writePendingEntries(srpmToNodes map[string][]*pkggraph.PkgNode, entries map[string]*buildmanifest.Entry) (err error) {
+	for srpm, nodes := range srpmToNodes {
+		if nodes[defaultNodeToCheck].State != pkggraph.StateBuild {
+			continue
+		}
+
+		entry, found := entries[srpm]
+		if !found {
+			continue
+		}
+
+		err = buildmanifest.WritePendingEntry(b.manifestDir, entry)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
@@ -16,6 +16,7 @@ import (
 
 	"microsoft.com/pkggen/imagegen/configuration"
 	"microsoft.com/pkggen/imagegen/installutils"
+	"microsoft.com/pkggen/internal/buildmanifest"
 	"microsoft.com/pkggen/internal/exe"
 	"microsoft.com/pkggen/internal/file"
 	"microsoft.com/pkggen/internal/logger"
@@ -25,15 +26,21 @@ import (
 )
 
 type srpmBuildStateJob struct {
-	sourceDir string
-	specFile  string
-	srpm      string
+	sourceDir     string
+	specFile      string
+	srpm          string
+	buildRequires []string
+}
+
+type srpmBuildStateResult struct {
+	srpm     string
+	prebuilt bool
+	entry    *buildmanifest.Entry // The SRPM's current build manifest entry, if the build manifest is in use
 }
 
 const (
 	defaultNodeToCheck = 0
 	defaultWorkerCount = "10"
-	emptyResult        = ""
 )
 
 var (
@@ -50,8 +57,15 @@ var (
 	rpmDir              = app.Flag("rpm-dir", "Directory that contains already built RPMs. Should contain top level directories for architecture.").Required().ExistingDir()
 	macroDir            = app.Flag("macro-dir", "Directory containing rpm macros.").Default("").String()
 	distTag             = app.Flag("dist-tag", "The distribution tag SRPMs will be built with.").Required().String()
-	invalidateDepChains = app.Flag("rebuild-missing-dep-chains", "If a package is built already, but its dependencies are not, rebuild the package anyways.").Bool()
+	invalidateDepChains = app.Flag("invalidate-dep-chains", "If a package is built already, but its dependencies are not or need to be rebuilt, rebuild the package anyways.").Bool()
+	rebuildMissingDeps  = app.Flag("rebuild-missing-dep-chains", "Deprecated alias for --invalidate-dep-chains.").Hidden().Bool()
 	workers             = app.Flag("workers", "Number of concurrent goroutines to parse with.").Default(defaultWorkerCount).Int()
+	targetArch          = exe.TargetArchFlag(app)
+
+	buildManifestDir = app.Flag("build-manifest-dir", "Optional directory holding the build manifest. When set, SRPMs whose spec, sources, BuildRequires or macros changed since they were built are rebuilt.").String()
+	specsDir         = app.Flag("specs-dir", "Optional directory containing the original SPEC files and their signatures files, used by the build manifest.").ExistingDir()
+	rpmmacrosFile    = app.Flag("rpmmacros-file", "Optional file containing the rpm macro overrides SRPMs are built with, used by the build manifest.").String()
+	cachedRPMsDir    = app.Flag("cached-rpms-dir", "Optional directory containing the RPMs cached by graphpkgfetcher, used by the build manifest to record the versions of remote BuildRequires.").String()
 
 	logFile  = exe.LogFileFlag(app)
 	logLevel = exe.LogLevelFlag(app)
@@ -70,6 +84,9 @@ func main() {
 	_, err := rpm.SetMacroDir(*macroDir)
 	logger.PanicOnError(err, "Unable to set rpm macro directory (%s). Error: %v", *macroDir, err)
 
+	buildArch, err := rpm.ResolveTargetArch(*targetArch)
+	logger.PanicOnError(err, "Unable to determine the target architecture. Error: %v", err)
+
 	pkgsToBuildSplit := exe.ParseListArgument(*pkgsToBuild)
 	desiredPackages := make([]*pkgjson.PackageVer, len(pkgsToBuildSplit))
 	for i, pkg := range pkgsToBuildSplit {
@@ -91,7 +108,13 @@ func main() {
 	packagesToRebuild := exe.ParseListArgument(*pkgsToRebuild)
 	packagesToIgnore := exe.ParseListArgument(*pkgsToIgnore)
 
-	err = optimizeGraph(*inputGraphFile, *outputGraphFile, *rpmDir, *distTag, desiredPackages, packagesToRebuild, packagesToIgnore, *invalidateDepChains, *workers)
+	var inputs *buildInputs
+	if *buildManifestDir != "" {
+		inputs, err = newBuildInputs(*buildManifestDir, *specsDir, *macroDir, *rpmmacrosFile, *cachedRPMsDir, *distTag)
+		logger.PanicOnError(err, "Unable to prepare build manifest (%s). Error: %v", *buildManifestDir, err)
+	}
+
+	err = optimizeGraph(*inputGraphFile, *outputGraphFile, *rpmDir, *distTag, buildArch, desiredPackages, packagesToRebuild, packagesToIgnore, *invalidateDepChains || *rebuildMissingDeps, *workers, inputs)
 	logger.PanicOnError(err, "Unable to optimize package graph (%s). Error: %v", *inputGraphFile, err)
 }
 
@@ -111,7 +134,9 @@ func readConfigFile(configFile, baseDirPath string) (packageList []*pkgjson.Pack
 	return
 }
 
-func optimizeGraph(inputFile, outputFile, rpmDir, distTag string, desiredPackages []*pkgjson.PackageVer, packagesToRebuild []string, packagesToIgnore []string, invalidateDepChains bool, workers int) (err error) {
+// optimizeGraph marks every SRPM which does not need to be rebuilt as up to date.
+// If inputs is not nil, SRPMs whose inputs changed since they were last built are rebuilt as well.
+func optimizeGraph(inputFile, outputFile, rpmDir, distTag, targetArch string, desiredPackages []*pkgjson.PackageVer, packagesToRebuild []string, packagesToIgnore []string, invalidateDepChains bool, workers int, inputs *buildInputs) (err error) {
 	const (
 		goalNodeName   = "PackagesToBuild"
 		strictGoalNode = true
@@ -165,7 +190,7 @@ func optimizeGraph(inputFile, outputFile, rpmDir, distTag string, desiredPackage
 
 	// Pass 1 - mark present sub packages
 	logger.Log.Info("Pass 1: Detecting SRPMs that have already been fully built")
-	validPrebuiltSRPMs := markPrebuiltPackages(srpmToNodes, rpmDir, distTag, packagesToRebuild, packagesToIgnore, workers)
+	validPrebuiltSRPMs, manifestEntries := markPrebuiltPackages(subGraph, srpmToNodes, rpmDir, distTag, targetArch, packagesToRebuild, packagesToIgnore, workers, inputs)
 	logger.Log.Debugf("Prebuilt SRPMs: %v", validPrebuiltSRPMs)
 
 	// Pass 2 - if any nested build requirements are missing, rebuild the entire SRPM.
@@ -177,13 +202,20 @@ func optimizeGraph(inputFile, outputFile, rpmDir, distTag string, desiredPackage
 
 	logger.Log.Infof("Prebuilt SRPMs: %v", validPrebuiltSRPMs)
 
+	if inputs != nil {
+		err = inputs.writePendingEntries(srpmToNodes, manifestEntries)
+		if err != nil {
+			return
+		}
+	}
+
 	err = pkggraph.WriteDOTGraphFile(subGraph, outputFile)
 	return
 }
 
-// rpmsProvidesBySpec returns all RPMs produced from a SPEC file, relative to the RPM
+// rpmsProvidesBySpec returns all RPMs produced from a SPEC file when built for targetArch, relative to the RPM
 // directory (i.e. prefixes the path with "%{ARCH}/")
-func rpmsProvidesBySpec(specFile, sourceDir, distTag string) (rpmsProvided []string, err error) {
+func rpmsProvidesBySpec(specFile, sourceDir, distTag, targetArch string) (rpmsProvided []string, err error) {
 	const (
 		// %{nvra} is the default query format, returns %{NAME}-%{VERSION}-%{REVISION}-%{ARCH}
 		queryFormat = "%{ARCH}/%{nvra}\n"
@@ -194,7 +226,7 @@ func rpmsProvidesBySpec(specFile, sourceDir, distTag string) (rpmsProvided []str
 		defines[rpm.DistTagDefine] = distTag
 	}
 
-	result, err := rpm.QuerySPECForBuiltRPMs(specFile, sourceDir, queryFormat, defines)
+	result, err := rpm.QuerySPECForBuiltRPMs(specFile, sourceDir, queryFormat, defines, rpm.TargetArchArgs(targetArch)...)
 	if err != nil {
 		return
 	}
@@ -224,13 +256,14 @@ func findAllRPMS(rpmDir string, rpmsToFind []string) bool {
 }
 
 // markPrebuildSubPackages will update `pkgGraph`
-func markPrebuiltPackages(srpmToNodes map[string][]*pkggraph.PkgNode, rpmDir, distTag string, packagesToRebuild []string, packagesToIgnore []string, workers int) (prebuiltSRPMs []string) {
+// If inputs is not nil, the current build manifest entry of every SRPM is also returned.
+func markPrebuiltPackages(pkgGraph *pkggraph.PkgGraph, srpmToNodes map[string][]*pkggraph.PkgNode, rpmDir, distTag, targetArch string, packagesToRebuild []string, packagesToIgnore []string, workers int, inputs *buildInputs) (prebuiltSRPMs []string, manifestEntries map[string]*buildmanifest.Entry) {
 	allJobs := make(chan *srpmBuildStateJob, len(srpmToNodes))
-	builtSRPMResults := make(chan string, len(srpmToNodes))
+	builtSRPMResults := make(chan *srpmBuildStateResult, len(srpmToNodes))
 
 	// Start the workers now so they begin processing jobs as jobs are buffered
 	for i := 0; i < workers; i++ {
-		go srpmBuildStateWorker(allJobs, builtSRPMResults, rpmDir, distTag, packagesToRebuild, packagesToIgnore)
+		go srpmBuildStateWorker(allJobs, builtSRPMResults, rpmDir, distTag, targetArch, packagesToRebuild, packagesToIgnore, inputs)
 	}
 
 	for srpm, nodes := range srpmToNodes {
@@ -245,6 +278,9 @@ func markPrebuiltPackages(srpmToNodes map[string][]*pkggraph.PkgNode, rpmDir, di
 			specFile:  nodes[defaultNodeToCheck].SpecPath,
 			srpm:      srpm,
 		}
+		if inputs != nil {
+			job.buildRequires = inputs.resolvedBuildRequires(pkgGraph, nodes)
+		}
 		allJobs <- job
 	}
 
@@ -252,19 +288,24 @@ func markPrebuiltPackages(srpmToNodes map[string][]*pkggraph.PkgNode, rpmDir, di
 	close(allJobs)
 
 	prebuiltSRPMs = make([]string, 0)
+	manifestEntries = make(map[string]*buildmanifest.Entry)
 	for i := 0; i < len(srpmToNodes); i++ {
-		builtSRPM := <-builtSRPMResults
+		result := <-builtSRPMResults
+
+		if result.entry != nil {
+			manifestEntries[result.srpm] = result.entry
+		}
 
-		// Skip empty results
-		if builtSRPM == emptyResult {
+		// Skip SRPMs which need to be built
+		if !result.prebuilt {
 			continue
 		}
 
-		for _, n := range srpmToNodes[builtSRPM] {
+		for _, n := range srpmToNodes[result.srpm] {
 			n.State = pkggraph.StateUpToDate
 		}
 
-		prebuiltSRPMs = append(prebuiltSRPMs, builtSRPM)
+		prebuiltSRPMs = append(prebuiltSRPMs, result.srpm)
 	}
 
 	logger.Log.Infof("After removing missing packages, %d of %d SRPMs need to be rebuilt", len(srpmToNodes)-len(prebuiltSRPMs), len(srpmToNodes))
@@ -272,34 +313,45 @@ func markPrebuiltPackages(srpmToNodes map[string][]*pkggraph.PkgNode, rpmDir, di
 	return
 }
 
-func srpmBuildStateWorker(allJobs chan *srpmBuildStateJob, builtSRPMResults chan string, rpmDir, distTag string, packagesToRebuild []string, packagesToIgnore []string) {
-	const specSuffix = ".spec"
-
+func srpmBuildStateWorker(allJobs chan *srpmBuildStateJob, builtSRPMResults chan *srpmBuildStateResult, rpmDir, distTag, targetArch string, packagesToRebuild []string, packagesToIgnore []string, inputs *buildInputs) {
 	// On job failure or skip, continue to the next value in the channel.
 allJobs:
 	for job := range allJobs {
 		logger.Log.Debugf("Scanning %s", job.specFile)
+
+		result := &srpmBuildStateResult{srpm: job.srpm}
+		if inputs != nil {
+			var err error
+			result.entry, err = inputs.entryForSRPM(job)
+			if err != nil {
+				logger.Log.Warnf("Error hashing the inputs of SPEC (%s). Error: %v", job.specFile, err)
+				builtSRPMResults <- result
+				continue allJobs
+			}
+		}
+
 		specName := strings.TrimSuffix(filepath.Base(job.specFile), specSuffix)
 		for _, pkg := range packagesToIgnore {
 			if pkg == specName {
 				logger.Log.Warnf("Marking missing package (%s) as ignored (always assume its built) per user request", pkg)
-				builtSRPMResults <- job.srpm
+				result.prebuilt = true
+				builtSRPMResults <- result
 				continue allJobs
 			}
 		}
 		for _, pkg := range packagesToRebuild {
 			if pkg == specName {
 				logger.Log.Infof("Marking (%s) as rebuild per user request", pkg)
-				builtSRPMResults <- emptyResult
+				builtSRPMResults <- result
 				continue allJobs
 			}
 		}
 
 		// Get a list of paths relative to RPMS/. Each path is prefixed with ${ARCH}/ already
-		rpmsToCheck, err := rpmsProvidesBySpec(job.specFile, job.sourceDir, distTag)
+		rpmsToCheck, err := rpmsProvidesBySpec(job.specFile, job.sourceDir, distTag, targetArch)
 		if err != nil {
 			logger.Log.Warnf("Error processing SPEC (%s). Error: %v", job.specFile, err)
-			builtSRPMResults <- emptyResult
+			builtSRPMResults <- result
 			continue allJobs
 		}
 
@@ -320,12 +372,25 @@ allJobs:
 		foundAll := findAllRPMS(rpmDir, rpmsToCheck)
 		if !foundAll {
 			logger.Log.Debugf("Did not find all RPMs produced by (%s)", job.srpm)
-			builtSRPMResults <- emptyResult
+			builtSRPMResults <- result
 			continue allJobs
 		}
 
+		// Even if every RPM is present, the SRPM must be rebuilt if anything it is built from has changed.
+		if inputs != nil {
+			unchanged, err := inputs.inputsUnchanged(result.entry)
+			if err != nil {
+				logger.Log.Warnf("Error checking the build manifest for (%s). Error: %v", job.srpm, err)
+			}
+			if !unchanged {
+				builtSRPMResults <- result
+				continue allJobs
+			}
+		}
+
 		logger.Log.Debugf("Marking (%s) as already built", job.srpm)
-		builtSRPMResults <- job.srpm
+		result.prebuilt = true
+		builtSRPMResults <- result
 	}
 }
 
@@ -388,7 +453,7 @@ func invalidateIncompleteDependencyChains(pkgGraph *pkggraph.PkgGraph, srpmToNod
 
 		// If we are ignoring the package, never mark it for rebuild even if its dependencies update
 		if !isValid {
-			specName := strings.TrimSuffix(filepath.Base(node.SpecPath), ".spec")
+			specName := strings.TrimSuffix(filepath.Base(node.SpecPath), specSuffix)
 			for _, pkg := range packagesToIgnore {
 				isValid = (pkg == specName)
 				if isValid {
@@ -12,7 +12,7 @@ import (
 	"gopkg.in/alecthomas/kingpin.v2"
 	"microsoft.com/pkggen/internal/exe"
 	"microsoft.com/pkggen/internal/logger"
-	"microsoft.com/pkggen/internal/packagerepo/repocloner/rpmrepocloner"
+	"microsoft.com/pkggen/internal/packagerepo/repocloner"
 	"microsoft.com/pkggen/internal/packagerepo/repoutils"
 	"microsoft.com/pkggen/internal/pkggraph"
 	"microsoft.com/pkggen/internal/pkgjson"
@@ -33,6 +33,7 @@ var (
 	useUpdateRepo        = app.Flag("use-update-repo", "Pull packages from the upstream update repo").Bool()
 	usePreviewRepo       = app.Flag("use-preview-repo", "Pull packages from the upstream preview repo").Bool()
 	disableUpstreamRepos = app.Flag("disable-upstream-repos", "Disables pulling packages from upstream repos").Bool()
+	clonerType           = app.Flag("cloner", "Implementation used to resolve and download packages: 'tdnf' runs tdnf inside the worker chroot, 'repodata' reads the metadata of local repositories directly and does not require root").Default(repoutils.ClonerTDNF).Enum(repoutils.ClonerTypes...)
 
 	tlsClientCert = app.Flag("tls-cert", "TLS client certificate to use when downloading files.").String()
 	tlsClientKey  = app.Flag("tls-key", "TLS client key to use when downloading files.").String()
@@ -85,7 +86,11 @@ func hasUnresolvedNodes(graph *pkggraph.PkgGraph) bool {
 // to satisfy it.
 func resolveGraphNodes(dependencyGraph *pkggraph.PkgGraph, inputSummaryFile, outputSummaryFile string, disableUpstreamRepos bool) (err error) {
 	// Create the worker environment
-	cloner := rpmrepocloner.New()
+	cloner, err := repoutils.NewCloner(*clonerType)
+	if err != nil {
+		return
+	}
+
 	err = cloner.Initialize(*outDir, *tmpDir, *workertar, *existingRpmDir, *useUpdateRepo, *usePreviewRepo, *repoFiles)
 	if err != nil {
 		logger.Log.Errorf("Failed to initialize RPM repo cloner. Error: %s", err)
@@ -145,7 +150,7 @@ func resolveGraphNodes(dependencyGraph *pkggraph.PkgGraph, inputSummaryFile, out
 }
 
 // resolveSingleNode caches the RPM for a single node
-func resolveSingleNode(cloner *rpmrepocloner.RpmRepoCloner, node *pkggraph.PkgNode) (err error) {
+func resolveSingleNode(cloner repocloner.RepoCloner, node *pkggraph.PkgNode) (err error) {
 	const cloneDeps = true
 
 	desiredPackage := node.VersionedPkg
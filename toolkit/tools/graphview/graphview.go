@@ -0,0 +1,44 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+// graphview is a tool to explore a dependency graph through a local web UI and JSON API
+
+package main
+
+import (
+	"net/http"
+	"os"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+	"microsoft.com/pkggen/internal/exe"
+	"microsoft.com/pkggen/internal/logger"
+	"microsoft.com/pkggen/internal/pkggraph"
+)
+
+const defaultAddress = "localhost:8080"
+
+var (
+	app = kingpin.New("graphview", "Serves a local web UI and JSON API to explore a dependency graph")
+
+	inputGraphFile = exe.InputFlag(app, "Path to the DOT graph file to explore.")
+	address        = app.Flag("address", "Address to serve the UI and API on.").Default(defaultAddress).String()
+
+	logFile  = exe.LogFileFlag(app)
+	logLevel = exe.LogLevelFlag(app)
+)
+
+func main() {
+	app.Version(exe.ToolkitVersion)
+	kingpin.MustParse(app.Parse(os.Args[1:]))
+	logger.InitBestEffort(*logFile, *logLevel)
+
+	pkgGraph := pkggraph.NewPkgGraph()
+	err := pkggraph.ReadDOTGraphFile(pkgGraph, *inputGraphFile)
+	logger.PanicOnError(err, "Failed to read DOT graph '%s'.", *inputGraphFile)
+
+	server := newGraphServer(pkgGraph)
+
+	logger.Log.Infof("Serving graph (%s) with %d nodes on http://%s", *inputGraphFile, pkgGraph.Nodes().Len(), *address)
+	err = http.ListenAndServe(*address, server)
+	logger.PanicOnError(err, "Failed to serve on '%s'.", *address)
+}
@@ -0,0 +1,365 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gonum.org/v1/gonum/graph"
+	"gonum.org/v1/gonum/graph/path"
+	"microsoft.com/pkggen/internal/logger"
+	"microsoft.com/pkggen/internal/pkggraph"
+)
+
+const (
+	directionRequires   = "requires"
+	directionDependants = "dependants"
+
+	defaultSearchLimit = 200
+	nodePathPrefix     = "/node/"
+	depsPathSuffix     = "/deps"
+)
+
+// nodeInfo is the JSON representation of a graph node.
+type nodeInfo struct {
+	ID           int64  `json:"ID"`
+	Name         string `json:"Name"` // Human readable summary of the node
+	Package      string `json:"Package,omitempty"`
+	Condition    string `json:"Condition,omitempty"`
+	Version      string `json:"Version,omitempty"`
+	Type         string `json:"Type"`
+	State        string `json:"State"`
+	Color        string `json:"Color"` // Graphviz color of the node's state
+	SpecPath     string `json:"SpecPath,omitempty"`
+	SrpmPath     string `json:"SrpmPath,omitempty"`
+	Architecture string `json:"Architecture,omitempty"`
+}
+
+// edgeInfo is the JSON representation of a dependency, From requires To.
+type edgeInfo struct {
+	From int64 `json:"From"`
+	To   int64 `json:"To"`
+}
+
+// nodesResponse is returned by the /nodes and /path endpoints.
+type nodesResponse struct {
+	Nodes []*nodeInfo `json:"Nodes"`
+}
+
+// depsResponse is returned by the /node/{id}/deps endpoint.
+type depsResponse struct {
+	Node      *nodeInfo   `json:"Node"`
+	Direction string      `json:"Direction"`
+	Recursive bool        `json:"Recursive"`
+	Nodes     []*nodeInfo `json:"Nodes"`
+	Edges     []*edgeInfo `json:"Edges"`
+}
+
+// errorResponse is returned by every endpoint on failure.
+type errorResponse struct {
+	Error string `json:"Error"`
+}
+
+// graphServer serves a read-only view of a dependency graph.
+type graphServer struct {
+	pkgGraph *pkggraph.PkgGraph
+	mux      *http.ServeMux
+}
+
+// newGraphServer creates a server exploring pkgGraph. The graph must not be modified while it is being served.
+func newGraphServer(pkgGraph *pkggraph.PkgGraph) (server *graphServer) {
+	server = &graphServer{
+		pkgGraph: pkgGraph,
+		mux:      http.NewServeMux(),
+	}
+
+	server.mux.HandleFunc("/", server.handleIndex)
+	server.mux.HandleFunc("/nodes", server.handleNodes)
+	server.mux.HandleFunc(nodePathPrefix, server.handleDeps)
+	server.mux.HandleFunc("/path", server.handlePath)
+
+	return
+}
+
+// ServeHTTP implements http.Handler.
+func (s *graphServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	logger.Log.Debugf("%s %s", r.Method, r.URL)
+
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s is not allowed", r.Method))
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// handleIndex serves the web UI.
+func (s *graphServer) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no such page (%s)", r.URL.Path))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, err := w.Write([]byte(indexHTML))
+	if err != nil {
+		logger.Log.Warnf("Failed to write UI: %s", err)
+	}
+}
+
+// handleNodes lists the nodes matching the "package" and "spec" query parameters, case insensitively.
+// Without any parameter every node is listed. At most "limit" nodes are returned.
+func (s *graphServer) handleNodes(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	pkgSearch := strings.ToLower(query.Get("package"))
+	specSearch := strings.ToLower(query.Get("spec"))
+
+	limit := defaultSearchLimit
+	if limitParam := query.Get("limit"); limitParam != "" {
+		var err error
+		limit, err = strconv.Atoi(limitParam)
+		if err != nil || limit <= 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid limit (%s)", limitParam))
+			return
+		}
+	}
+
+	var matches []*pkggraph.PkgNode
+	for _, n := range s.pkgGraph.AllNodes() {
+		if pkgSearch != "" && (n.VersionedPkg == nil || !strings.Contains(strings.ToLower(n.VersionedPkg.Name), pkgSearch)) {
+			continue
+		}
+		if specSearch != "" && !strings.Contains(strings.ToLower(specName(n)), specSearch) {
+			continue
+		}
+		matches = append(matches, n)
+	}
+
+	sortNodes(matches)
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	writeJSON(w, &nodesResponse{Nodes: newNodeInfos(matches)})
+}
+
+// handleDeps lists what a node requires, or what depends on it, depending on the "direction" query parameter.
+// Only direct neighbors are listed unless "recursive" is set.
+func (s *graphServer) handleDeps(w http.ResponseWriter, r *http.Request) {
+	idParam := strings.TrimPrefix(r.URL.Path, nodePathPrefix)
+	if !strings.HasSuffix(idParam, depsPathSuffix) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no such page (%s)", r.URL.Path))
+		return
+	}
+
+	node, err := s.findNode(strings.TrimSuffix(idParam, depsPathSuffix))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	query := r.URL.Query()
+	response := &depsResponse{
+		Node:      newNodeInfo(node),
+		Direction: query.Get("direction"),
+	}
+	if response.Direction == "" {
+		response.Direction = directionRequires
+	}
+	if response.Direction != directionRequires && response.Direction != directionDependants {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid direction (%s), expected '%s' or '%s'", response.Direction, directionRequires, directionDependants))
+		return
+	}
+
+	if recursiveParam := query.Get("recursive"); recursiveParam != "" {
+		response.Recursive, err = strconv.ParseBool(recursiveParam)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid recursive (%s)", recursiveParam))
+			return
+		}
+	}
+
+	var (
+		nodes []*pkggraph.PkgNode
+		edges []*edgeInfo
+	)
+	if response.Recursive {
+		nodes, edges = s.allDependencies(node, response.Direction)
+	} else {
+		nodes, edges = s.directDependencies(node, response.Direction)
+	}
+
+	sortNodes(nodes)
+	response.Nodes = newNodeInfos(nodes)
+	response.Edges = edges
+	writeJSON(w, response)
+}
+
+// handlePath finds the shortest chain of dependencies from the "from" node to the "to" node.
+func (s *graphServer) handlePath(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	from, err := s.findNode(query.Get("from"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	to, err := s.findNode(query.Get("to"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	shortest := path.DijkstraFrom(from, s.pkgGraph)
+	pathNodes, _ := shortest.To(to.ID())
+	if len(pathNodes) == 0 {
+		writeError(w, http.StatusNotFound, fmt.Errorf("%s does not depend on %s", from.FriendlyName(), to.FriendlyName()))
+		return
+	}
+
+	nodes := make([]*pkggraph.PkgNode, 0, len(pathNodes))
+	for _, n := range pathNodes {
+		nodes = append(nodes, n.(*pkggraph.PkgNode).This)
+	}
+
+	writeJSON(w, &nodesResponse{Nodes: newNodeInfos(nodes)})
+}
+
+// directDependencies returns the direct neighbors of node in the given direction.
+func (s *graphServer) directDependencies(node *pkggraph.PkgNode, direction string) (nodes []*pkggraph.PkgNode, edges []*edgeInfo) {
+	var neighbors graph.Nodes
+	if direction == directionRequires {
+		neighbors = s.pkgGraph.From(node.ID())
+	} else {
+		neighbors = s.pkgGraph.To(node.ID())
+	}
+
+	for _, neighbor := range graph.NodesOf(neighbors) {
+		nodes = append(nodes, neighbor.(*pkggraph.PkgNode).This)
+		if direction == directionRequires {
+			edges = append(edges, &edgeInfo{From: node.ID(), To: neighbor.ID()})
+		} else {
+			edges = append(edges, &edgeInfo{From: neighbor.ID(), To: node.ID()})
+		}
+	}
+
+	return
+}
+
+// allDependencies returns every node reachable from node in the given direction, and the edges between them.
+// The served graph is walked breadth first, so no copy of it is needed.
+func (s *graphServer) allDependencies(node *pkggraph.PkgNode, direction string) (nodes []*pkggraph.PkgNode, edges []*edgeInfo) {
+	visited := map[int64]bool{node.ID(): true}
+	queue := []*pkggraph.PkgNode{node}
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		neighbors, currentEdges := s.directDependencies(current, direction)
+		edges = append(edges, currentEdges...)
+
+		for _, neighbor := range neighbors {
+			if visited[neighbor.ID()] {
+				continue
+			}
+			visited[neighbor.ID()] = true
+			nodes = append(nodes, neighbor)
+			queue = append(queue, neighbor)
+		}
+	}
+
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].From != edges[j].From {
+			return edges[i].From < edges[j].From
+		}
+		return edges[i].To < edges[j].To
+	})
+
+	return
+}
+
+// findNode looks up a node by its ID.
+func (s *graphServer) findNode(idParam string) (node *pkggraph.PkgNode, err error) {
+	id, err := strconv.ParseInt(idParam, 10, 64)
+	if err != nil {
+		err = fmt.Errorf("invalid node ID (%s)", idParam)
+		return
+	}
+
+	graphNode := s.pkgGraph.Node(id)
+	if graphNode == nil {
+		err = fmt.Errorf("no node with ID (%d)", id)
+		return
+	}
+
+	node = graphNode.(*pkggraph.PkgNode).This
+	return
+}
+
+func newNodeInfo(n *pkggraph.PkgNode) (info *nodeInfo) {
+	info = &nodeInfo{
+		ID:           n.ID(),
+		Name:         n.FriendlyName(),
+		Type:         n.Type.String(),
+		State:        n.State.String(),
+		Color:        n.DOTColor(),
+		SpecPath:     n.SpecPath,
+		SrpmPath:     n.SrpmPath,
+		Architecture: n.Architecture,
+	}
+	if n.VersionedPkg != nil {
+		info.Package = n.VersionedPkg.Name
+		info.Condition = n.VersionedPkg.Condition
+		info.Version = n.VersionedPkg.Version
+	}
+	return
+}
+
+func newNodeInfos(nodes []*pkggraph.PkgNode) (infos []*nodeInfo) {
+	infos = make([]*nodeInfo, 0, len(nodes))
+	for _, n := range nodes {
+		infos = append(infos, newNodeInfo(n))
+	}
+	return
+}
+
+// specName returns the name of the SPEC a node was built from, without its extension.
+func specName(n *pkggraph.PkgNode) string {
+	return strings.TrimSuffix(filepath.Base(n.SpecPath), ".spec")
+}
+
+// sortNodes orders nodes by name, then ID, so responses are deterministic.
+func sortNodes(nodes []*pkggraph.PkgNode) {
+	sort.Slice(nodes, func(i, j int) bool {
+		iName, jName := nodes[i].FriendlyName(), nodes[j].FriendlyName()
+		if iName != jName {
+			return iName < jName
+		}
+		return nodes[i].ID() < nodes[j].ID()
+	})
+}
+
+func writeJSON(w http.ResponseWriter, response interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		logger.Log.Warnf("Failed to write response: %s", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	logger.Log.Debugf("Request failed (%d): %s", status, err)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encodeErr := json.NewEncoder(w).Encode(&errorResponse{Error: err.Error()})
+	if encodeErr != nil {
+		logger.Log.Warnf("Failed to write error response: %s", encodeErr)
+	}
+}
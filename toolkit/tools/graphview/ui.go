@@ -0,0 +1,164 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package main
+
+// indexHTML is the web UI, it is a thin client of the JSON API.
+const indexHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>graphview</title>
+<style>
+  body { font-family: sans-serif; margin: 0; display: flex; height: 100vh; }
+  #search { width: 35%; padding: 1em; overflow-y: auto; border-right: 1px solid #ccc; }
+  #details { flex: 1; padding: 1em; overflow-y: auto; }
+  input, select, button { margin: 0.2em 0; }
+  ul { list-style: none; padding-left: 0; }
+  li { margin: 0.2em 0; }
+  .node { cursor: pointer; padding: 0.1em 0.4em; border-radius: 0.3em; border: 1px solid #888; display: inline-block; }
+  .node:hover { border-color: #000; }
+  .error { color: red; }
+  table { border-collapse: collapse; }
+  td { padding: 0.1em 0.5em; vertical-align: top; }
+</style>
+</head>
+<body>
+<div id="search">
+  <h3>Search</h3>
+  <select id="searchField">
+    <option value="package">Package</option>
+    <option value="spec">SPEC</option>
+  </select>
+  <input id="searchText" placeholder="name" autofocus>
+  <button onclick="search()">Search</button>
+  <div id="searchError" class="error"></div>
+  <ul id="results"></ul>
+  <h3>Path</h3>
+  <input id="pathFrom" placeholder="from ID" size="8">
+  <input id="pathTo" placeholder="to ID" size="8">
+  <button onclick="findPath()">Find</button>
+  <div id="pathError" class="error"></div>
+  <ul id="path"></ul>
+</div>
+<div id="details">Select a node to see its dependencies.</div>
+<script>
+function get(url) {
+  return fetch(url).then(function(response) {
+    return response.json().then(function(body) {
+      if (!response.ok) {
+        throw new Error(body.Error);
+      }
+      return body;
+    });
+  });
+}
+
+function nodeElement(node) {
+  var element = document.createElement("span");
+  element.className = "node";
+  element.style.background = node.Color;
+  element.textContent = node.Name;
+  element.title = "ID " + node.ID + (node.SpecPath ? ", " + node.SpecPath : "");
+  element.onclick = function() { showNode(node.ID); };
+  return element;
+}
+
+function fillList(list, nodes) {
+  list.innerHTML = "";
+  nodes.forEach(function(node) {
+    var item = document.createElement("li");
+    item.appendChild(nodeElement(node));
+    list.appendChild(item);
+  });
+}
+
+function search() {
+  var field = document.getElementById("searchField").value;
+  var text = document.getElementById("searchText").value;
+  var error = document.getElementById("searchError");
+  error.textContent = "";
+  get("/nodes?" + field + "=" + encodeURIComponent(text)).then(function(body) {
+    fillList(document.getElementById("results"), body.Nodes);
+    if (body.Nodes.length === 0) {
+      error.textContent = "No matching nodes.";
+    }
+  }).catch(function(e) { error.textContent = e.message; });
+}
+
+function findPath() {
+  var from = document.getElementById("pathFrom").value;
+  var to = document.getElementById("pathTo").value;
+  var error = document.getElementById("pathError");
+  error.textContent = "";
+  get("/path?from=" + encodeURIComponent(from) + "&to=" + encodeURIComponent(to)).then(function(body) {
+    fillList(document.getElementById("path"), body.Nodes);
+  }).catch(function(e) {
+    document.getElementById("path").innerHTML = "";
+    error.textContent = e.message;
+  });
+}
+
+function depsSection(id, direction, title) {
+  var section = document.createElement("div");
+  var heading = document.createElement("h4");
+  heading.textContent = title + " ";
+  var expand = document.createElement("button");
+  expand.textContent = "Expand all";
+  heading.appendChild(expand);
+  section.appendChild(heading);
+  var list = document.createElement("ul");
+  section.appendChild(list);
+
+  var load = function(recursive) {
+    get("/node/" + id + "/deps?direction=" + direction + "&recursive=" + recursive).then(function(body) {
+      fillList(list, body.Nodes);
+      heading.firstChild.textContent = title + " (" + body.Nodes.length + ") ";
+    }).catch(function(e) { list.textContent = e.message; });
+  };
+  expand.onclick = function() { load(true); };
+  load(false);
+  return section;
+}
+
+function showNode(id) {
+  var details = document.getElementById("details");
+  get("/node/" + id + "/deps").then(function(body) {
+    var node = body.Node;
+    details.innerHTML = "";
+    details.appendChild(nodeElement(node));
+
+    var table = document.createElement("table");
+    ["ID", "Type", "State", "Package", "Condition", "Version", "Architecture", "SpecPath", "SrpmPath"].forEach(function(key) {
+      if (node[key] === undefined || node[key] === "") {
+        return;
+      }
+      var row = table.insertRow();
+      row.insertCell().textContent = key;
+      row.insertCell().textContent = node[key];
+    });
+    details.appendChild(table);
+
+    var usePath = document.createElement("button");
+    usePath.textContent = "Use as path start";
+    usePath.onclick = function() { document.getElementById("pathFrom").value = node.ID; };
+    details.appendChild(usePath);
+    var usePathEnd = document.createElement("button");
+    usePathEnd.textContent = "Use as path end";
+    usePathEnd.onclick = function() { document.getElementById("pathTo").value = node.ID; };
+    details.appendChild(usePathEnd);
+
+    details.appendChild(depsSection(id, "requires", "Requires"));
+    details.appendChild(depsSection(id, "dependants", "Required by"));
+  }).catch(function(e) { details.textContent = e.message; });
+}
+
+document.getElementById("searchText").addEventListener("keyup", function(event) {
+  if (event.key === "Enter") {
+    search();
+  }
+});
+</script>
+</body>
+</html>
+`
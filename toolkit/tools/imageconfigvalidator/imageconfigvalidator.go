@@ -6,12 +6,17 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 
 	"gopkg.in/alecthomas/kingpin.v2"
 	"microsoft.com/pkggen/imagegen/configuration"
 	"microsoft.com/pkggen/internal/exe"
+	"microsoft.com/pkggen/internal/jsonutils"
 	"microsoft.com/pkggen/internal/logger"
 )
 
@@ -21,12 +26,11 @@ var (
 	logFile  = exe.LogFileFlag(app)
 	logLevel = exe.LogLevelFlag(app)
 
-	input = exe.InputStringFlag(app, "Path to the image config file.")
+	input       = exe.InputStringFlag(app, "Path to the image config file.")
+	baseDirPath = app.Flag("base-dir", "Base directory for relative file paths from the config. Defaults to config's directory.").ExistingDir()
 )
 
 func main() {
-	const returnCodeOnError = 1
-
 	app.Version(exe.ToolkitVersion)
 	kingpin.MustParse(app.Parse(os.Args[1:]))
 	logger.InitBestEffort(*logFile, *logLevel)
@@ -34,25 +38,67 @@ func main() {
 	inPath, err := filepath.Abs(*input)
 	logger.PanicOnError(err, "Error when calculating input path")
 
-	logger.Log.Infof("Reading configuration file (%s)", inPath)
-	config, err := configuration.Load(inPath)
-	if err != nil {
-		logger.Log.Fatalf("Failed while loading image configuration '%s': %s", inPath, err)
+	baseDir := *baseDirPath
+	if baseDir == "" {
+		baseDir = filepath.Dir(inPath)
 	}
 
-	// Basic validation will occur during load, but we can add additional checking here.
-	err = ValidateConfiguration(config)
+	logger.Log.Infof("Reading configuration file (%s)", inPath)
+	problems, err := validateConfigFile(inPath, baseDir)
 	if err != nil {
 		// Log an error here as opposed to panicing to keep the output simple
 		// and only contain the error with the config file.
 		logger.Log.Fatalf("Invalid configuration '%s': %s", inPath, err)
 	}
 
+	if len(problems) != 0 {
+		for _, problem := range problems {
+			logger.Log.Errorf("%s", problem)
+		}
+		logger.Log.Fatalf("Invalid configuration '%s': found %d problem(s)", inPath, len(problems))
+	}
+
+	return
+}
+
+// validateConfigFile loads a config file and validates it. The line and column of every problem found are
+// looked up in the file. Returns an error if the file can not be loaded at all.
+func validateConfigFile(configPath, baseDirPath string) (problems []*configuration.ValidationError, err error) {
+	configData, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return
+	}
+
+	config, err := configuration.Load(configPath)
+	if err != nil {
+		// Syntax errors are found before any part of the config is parsed, so their offset is relative to the whole file.
+		// The offset is just after the invalid character.
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) && syntaxErr.Offset > 0 {
+			location := jsonutils.OffsetToLocation(configData, int(syntaxErr.Offset)-1)
+			err = fmt.Errorf("line %d, column %d: %w", location.Line, location.Column, err)
+		}
+		return
+	}
+
+	problems, err = ValidateConfiguration(config, baseDirPath)
+	if err != nil || len(problems) == 0 {
+		return
+	}
+
+	err = configuration.LocateValidationErrors(configData, problems)
 	return
 }
 
-// ValidateConfiguration will run sanity checks on a configuration structure
-func ValidateConfiguration(config configuration.Config) (err error) {
+// ValidateConfiguration will run sanity checks on a configuration structure.
+// Returns an error if the configuration is not valid, otherwise returns every semantic problem found in it.
+// Relative file paths are resolved against baseDirPath.
+func ValidateConfiguration(config configuration.Config, baseDirPath string) (problems []*configuration.ValidationError, err error) {
 	err = config.IsValid()
+	if err != nil {
+		return
+	}
+
+	problems = config.Validate(baseDirPath)
 	return
 }
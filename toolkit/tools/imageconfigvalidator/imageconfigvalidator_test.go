@@ -38,8 +38,9 @@ func TestShouldSucceedValidatingDefaultConfigs(t *testing.T) {
 			config, err := configuration.Load(configPath)
 			assert.NoError(t, err)
 
-			err = ValidateConfiguration(config)
+			problems, err := ValidateConfiguration(config, configDirectory)
 			assert.NoError(t, err)
+			assert.Empty(t, problems)
 			checkedConfigs++
 		}
 	}
@@ -50,7 +51,7 @@ func TestShouldSucceedValidatingDefaultConfigs(t *testing.T) {
 func TestShouldFailEmptyConfig(t *testing.T) {
 	config := configuration.Config{}
 
-	err := ValidateConfiguration(config)
+	_, err := ValidateConfiguration(config, "")
 	assert.Error(t, err)
 	assert.Equal(t, "config file must provide at least one system configuration inside the [SystemConfigs] field", err.Error())
 }
@@ -59,7 +60,7 @@ func TestShouldFailEmptySystemConfig(t *testing.T) {
 	config := configuration.Config{}
 	config.SystemConfigs = []configuration.SystemConfig{{}}
 
-	err := ValidateConfiguration(config)
+	_, err := ValidateConfiguration(config, "")
 	assert.Error(t, err)
 	assert.Equal(t, "invalid [SystemConfigs]: missing [Name] field", err.Error())
 }
@@ -83,7 +84,7 @@ func TestShouldFailDeeplyNestedParsingError(t *testing.T) {
 			assert.NoError(t, err)
 
 			config.Disks[0].PartitionTableType = configuration.PartitionTableType("not_a_real_partition_type")
-			err = ValidateConfiguration(config)
+			_, err = ValidateConfiguration(config, configDirectory)
 			assert.Error(t, err)
 			assert.Equal(t, "invalid [Disks]: invalid [PartitionTableType]: invalid value for PartitionTableType (not_a_real_partition_type)", err.Error())
 
@@ -92,3 +93,72 @@ func TestShouldFailDeeplyNestedParsingError(t *testing.T) {
 	}
 	assert.Fail(t, "Could not find 'core-efi.json' to test")
 }
+
+func TestShouldReportProblemLocations(t *testing.T) {
+	const config = `{
+    "Disks": [
+        {
+            "PartitionTableType": "gpt",
+            "MaxSize": 1024,
+            "Partitions": [
+                {"ID": "boot", "Start": 1, "End": 9, "FsType": "fat32"},
+                {"ID": "rootfs", "Start": 8, "End": 1024, "FsType": "ntfs"}
+            ]
+        }
+    ],
+    "SystemConfigs": [
+        {
+            "Name": "Test",
+            "PackageLists": ["packages.json"],
+            "KernelOptions": {"default": "kernel"},
+            "PartitionSettings": [
+                {"ID": "boot", "MountPoint": "/boot"},
+                {"ID": "missing", "MountPoint": "/boot"}
+            ],
+            "AdditionalFiles": {"missing.txt": "/etc/missing.txt"},
+            "Users": [
+                {"Name": "test", "PrimaryGroup": "nosuchgroup", "SecondaryGroups": ["wheel"]}
+            ]
+        }
+    ]
+}`
+
+	dir, err := ioutil.TempDir("", "imageconfigvalidator")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	configPath := filepath.Join(dir, "config.json")
+	assert.NoError(t, ioutil.WriteFile(configPath, []byte(config), os.ModePerm))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "packages.json"), []byte("{}"), os.ModePerm))
+
+	problems, err := validateConfigFile(configPath, dir)
+	assert.NoError(t, err)
+
+	var located []string
+	for _, problem := range problems {
+		located = append(located, fmt.Sprintf("%s %d:%d", problem.Path, problem.Line, problem.Column))
+	}
+
+	assert.Equal(t, []string{
+		"$.Disks[0].Partitions[1].FsType 8:69",
+		"$.Disks[0].Partitions[1].Start 8:43",
+		"$.SystemConfigs[0].PartitionSettings[1].ID 19:24",
+		"$.SystemConfigs[0].PartitionSettings[1].MountPoint 19:49",
+		"$.SystemConfigs[0].PartitionSettings 17:34",
+		`$.SystemConfigs[0].AdditionalFiles["missing.txt"] 21:48`,
+		"$.SystemConfigs[0].Users[0].PrimaryGroup 23:50",
+	}, located)
+}
+
+func TestShouldReportSyntaxErrorLocation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "imageconfigvalidator")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	configPath := filepath.Join(dir, "config.json")
+	assert.NoError(t, ioutil.WriteFile(configPath, []byte("{\n    \"Disks\": [,]\n}"), os.ModePerm))
+
+	_, err = validateConfigFile(configPath, dir)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "line 2, column 15")
+}
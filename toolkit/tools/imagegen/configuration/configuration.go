@@ -9,6 +9,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	"microsoft.com/pkggen/internal/file"
 	"microsoft.com/pkggen/internal/jsonutils"
@@ -23,20 +25,34 @@ type Artifact struct {
 	Type        string `json:"Type"`
 }
 
-// Partition defines the size, name and file system type
+// Partition defines the size, name, type and file system type
 // for a partition.
 // "Start" and "End" fields define the offset from the beginning of the disk in MBs.
 // An "End" value of 0 will determine the size of the partition using the next
 // partition's start offset or the value defined by "MaxSize", if this is the last
 // partition on the disk.
+// Alternatively "Size" places the partition right after the previous one, aligned to
+// the disk's "Alignment". It is either a size with a unit (e.g. "512M", "2GiB"), a
+// percentage of the disk (e.g. "20%") or "grow" to take all the space left on the disk.
+// "TypeUUID" sets the GPT partition type, either as a GUID or as a well-known type name
+// (e.g. "linux-root-x86-64", "swap", "home", "xbootldr"), overriding the type picked by "Flags".
+// "Attributes" lists GPT attribute flags to set (e.g. "grow-fs", "read-only", "no-auto").
+// "MkfsOptions" are extra arguments passed to mkfs when formatting the partition, and
+// "Subvolumes" lists the subvolumes created on a btrfs partition (e.g. "@", "@home"),
+// which PartitionSettings can mount.
 type Partition struct {
-	FsType    string     `json:"FsType"`
-	ID        string     `json:"ID"`
-	Name      string     `json:"Name"`
-	End       uint64     `json:"End"`
-	Start     uint64     `json:"Start"`
-	Flags     []string   `json:"Flags"`
-	Artifacts []Artifact `json:"Artifacts"`
+	FsType      string     `json:"FsType"`
+	ID          string     `json:"ID"`
+	Name        string     `json:"Name"`
+	End         uint64     `json:"End"`
+	Start       uint64     `json:"Start"`
+	Size        string     `json:"Size"`
+	TypeUUID    string     `json:"TypeUUID"`
+	Flags       []string   `json:"Flags"`
+	Attributes  []string   `json:"Attributes"`
+	MkfsOptions []string   `json:"MkfsOptions"`
+	Subvolumes  []string   `json:"Subvolumes"`
+	Artifacts   []Artifact `json:"Artifacts"`
 }
 
 // RawBinary allow the users to specify a binary they would
@@ -55,11 +71,31 @@ type TargetDisk struct {
 }
 
 // PartitionSetting holds the mounting information for each partition.
+// "Subvolume" mounts one of the subvolumes of a btrfs partition, a partition
+// may have one setting per subvolume.
 type PartitionSetting struct {
 	RemoveDocs   bool   `json:"RemoveDocs"`
 	ID           string `json:"ID"`
 	MountOptions string `json:"MountOptions"`
 	MountPoint   string `json:"MountPoint"`
+	Subvolume    string `json:"Subvolume"`
+}
+
+// IsValid returns an error if the PartitionSetting is not valid
+func (p *PartitionSetting) IsValid() (err error) {
+	if strings.TrimSpace(p.ID) == "" {
+		return fmt.Errorf("missing [ID] field")
+	}
+
+	// An empty mount point leaves the partition unmounted
+	if p.MountPoint != "" && !filepath.IsAbs(p.MountPoint) {
+		return fmt.Errorf("[MountPoint] (%s) must be an absolute path", p.MountPoint)
+	}
+
+	if p.Subvolume != "" && p.MountPoint == "" {
+		return fmt.Errorf("[Subvolume] (%s) requires a [MountPoint]", p.Subvolume)
+	}
+	return
 }
 
 // PostInstallScript defines a script to be ran after other installation
@@ -69,12 +105,31 @@ type PostInstallScript struct {
 	Path string `json:"Path"`
 }
 
+// IsValid returns an error if the PostInstallScript is not valid
+func (p *PostInstallScript) IsValid() (err error) {
+	if strings.TrimSpace(p.Path) == "" {
+		return fmt.Errorf("missing [Path] field")
+	}
+	return
+}
+
 // Group defines a single group to be created on the new system.
 type Group struct {
 	Name string `json:"Name"`
 	GID  string `json:"GID"`
 }
 
+// IsValid returns an error if the Group is not valid
+func (g *Group) IsValid() (err error) {
+	if strings.TrimSpace(g.Name) == "" {
+		return fmt.Errorf("missing [Name] field")
+	}
+	if err = validateNumericID(g.GID); err != nil {
+		return fmt.Errorf("invalid [GID]: %w", err)
+	}
+	return
+}
+
 // User defines a single user to be created on the new system.
 type User struct {
 	Name                string   `json:"Name"`
@@ -88,6 +143,28 @@ type User struct {
 	StartupCommand      string   `json:"StartupCommand"`
 }
 
+// IsValid returns an error if the User is not valid
+func (u *User) IsValid() (err error) {
+	if strings.TrimSpace(u.Name) == "" {
+		return fmt.Errorf("missing [Name] field")
+	}
+	if err = validateNumericID(u.UID); err != nil {
+		return fmt.Errorf("invalid [UID]: %w", err)
+	}
+	return
+}
+
+// validateNumericID returns an error if id is set but is not a non-negative number, as required for UIDs and GIDs.
+func validateNumericID(id string) (err error) {
+	if id == "" {
+		return
+	}
+	if _, parseErr := strconv.ParseUint(id, 10, 32); parseErr != nil {
+		return fmt.Errorf("(%s) is not a valid ID", id)
+	}
+	return
+}
+
 // RootEncryption enables encryption on the root partition
 type RootEncryption struct {
 	Enable   bool   `json:"Enable"`
@@ -120,6 +197,9 @@ func (c *Config) IsValid() (err error) {
 		if err = sysConfig.IsValid(); err != nil {
 			return fmt.Errorf("invalid [SystemConfigs]: %w", err)
 		}
+		if sysConfig.Encryption.Enable && c.hasVolumeGroups() {
+			return fmt.Errorf("invalid [SystemConfigs]: root encryption can't be combined with [VolumeGroups]")
+		}
 	}
 	defaultFound := false
 	for _, sysConfig := range c.SystemConfigs {
@@ -8,25 +8,87 @@ package configuration
 import (
 	"encoding/json"
 	"fmt"
+
+	"microsoft.com/pkggen/internal/partitiontable"
+	"microsoft.com/pkggen/internal/sizeutils"
 )
 
+// defaultAlignment is the alignment of partitions placed by their "Size" on disks without an "Alignment"
+const defaultAlignment = sizeutils.MiB
+
 // Disk holds the disk partitioning, formatting and size information.
 // It may also define artifacts generated for each disk.
+// "Alignment" (e.g. "4MiB") is what the start of partitions placed by their "Size" is aligned to, 1MiB by default.
+// "VolumeGroups" are LVM volume groups made of the disk's partitions.
 type Disk struct {
 	PartitionTableType PartitionTableType `json:"PartitionTableType"`
 	MaxSize            uint64             `json:"MaxSize"`
+	Alignment          string             `json:"Alignment"`
 	TargetDisk         TargetDisk         `json:"TargetDisk"`
 	Artifacts          []Artifact         `json:"Artifacts"`
 	Partitions         []Partition        `json:"Partitions"`
 	RawBinaries        []RawBinary        `json:"RawBinaries"`
+	VolumeGroups       []VolumeGroup      `json:"VolumeGroups"`
 }
 
-// IsValid returns an error if the PartitionTableType is not valid
+// PartitionExtent is where a partition lies on its disk, in bytes.
+type PartitionExtent struct {
+	Start uint64
+	Size  uint64
+}
+
+// IsValid returns an error if the PartitionTableType, Alignment, Partitions or VolumeGroups are not valid.
+// If the disk has a MaxSize and partitions placed by their Size, the partitions must also fit on it.
 func (d *Disk) IsValid() (err error) {
 	if err = d.PartitionTableType.IsValid(); err != nil {
 		return fmt.Errorf("invalid [PartitionTableType]: %w", err)
 	}
 
+	if _, err = d.alignment(); err != nil {
+		return fmt.Errorf("invalid [Alignment]: %w", err)
+	}
+
+	for i := range d.Partitions {
+		if err = d.validatePartition(&d.Partitions[i]); err != nil {
+			return fmt.Errorf("invalid [Partitions] entry (%s): %w", d.Partitions[i].ID, err)
+		}
+	}
+
+	var (
+		usedPartitions = make(map[string]string)
+		groupNames     = make(map[string]bool)
+		volumeIDs      = make(map[string]bool)
+	)
+	for i := range d.Partitions {
+		volumeIDs[d.Partitions[i].ID] = true
+	}
+	for i := range d.VolumeGroups {
+		volumeGroup := &d.VolumeGroups[i]
+		if err = d.validateVolumeGroup(volumeGroup, usedPartitions); err != nil {
+			return fmt.Errorf("invalid [VolumeGroups] entry (%s): %w", volumeGroup.Name, err)
+		}
+
+		if groupNames[volumeGroup.Name] {
+			return fmt.Errorf("invalid [VolumeGroups]: duplicate volume group name (%s)", volumeGroup.Name)
+		}
+		groupNames[volumeGroup.Name] = true
+
+		for _, logicalVolume := range volumeGroup.LogicalVolumes {
+			if volumeIDs[logicalVolume.ID] {
+				return fmt.Errorf("invalid [VolumeGroups] entry (%s): logical volume ID (%s) is already used by a partition or logical volume", volumeGroup.Name, logicalVolume.ID)
+			}
+			volumeIDs[logicalVolume.ID] = true
+		}
+	}
+
+	// The layout of a disk without a MaxSize depends on the size of the disk it is installed to. Disks laid out
+	// by Start and End alone are checked by Config.Validate, which can locate the offending values.
+	if d.MaxSize != 0 && d.hasSizedPartitions() {
+		if _, err = d.Layout(d.MaxSize * sizeutils.MiB); err != nil {
+			return fmt.Errorf("invalid [Partitions]: %w", err)
+		}
+	}
+
 	// No limits on disk.MaxSize
 
 	// if err = disk.PartitionTableType.IsValid(); err != nil {
@@ -66,3 +128,192 @@ func (d *Disk) UnmarshalJSON(b []byte) (err error) {
 	}
 	return
 }
+
+// Layout computes where each partition lies on a disk of diskSize bytes, in the order the partitions are listed.
+// Partitions placed by their Size follow the partition before them, starting at the disk's alignment. A partition
+// with a "grow" Size takes the space left once every other partition is placed, rounded down to the alignment.
+// Returns an error if the partitions overlap or don't fit on the disk.
+func (d *Disk) Layout(diskSize uint64) (extents []PartitionExtent, err error) {
+	if len(d.Partitions) == 0 {
+		return
+	}
+	if d.PartitionTableType == PartitionTableTypeNone {
+		err = fmt.Errorf("partitions require a [PartitionTableType]")
+		return
+	}
+
+	alignment, err := d.alignment()
+	if err != nil {
+		return
+	}
+
+	table := partitiontable.Table{Type: partitiontable.TableType(d.PartitionTableType)}
+	usableStart, usableEnd := table.UsableStart(), table.UsableEnd(diskSize)
+	if usableEnd > diskSize || usableEnd <= usableStart {
+		err = fmt.Errorf("disk of %d bytes is too small for a partition table", diskSize)
+		return
+	}
+
+	growIndex := -1
+	for i := range d.Partitions {
+		if d.Partitions[i].Size != PartitionSizeGrow {
+			continue
+		}
+		if growIndex != -1 {
+			err = fmt.Errorf("partitions (%s) and (%s) can't both grow", d.Partitions[growIndex].ID, d.Partitions[i].ID)
+			return
+		}
+		growIndex = i
+	}
+
+	// Place the partitions with the growing one empty first, to find the space left for it
+	extents, err = d.layoutPartitions(diskSize, usableStart, usableEnd, alignment, 0)
+	if err != nil {
+		return
+	}
+
+	if growIndex != -1 {
+		var end uint64
+		for _, extent := range extents {
+			if extent.Start+extent.Size > end {
+				end = extent.Start + extent.Size
+			}
+		}
+
+		var growSize uint64
+		if end < usableEnd {
+			growSize = (usableEnd - end) / alignment * alignment
+		}
+		if growSize == 0 {
+			err = fmt.Errorf("no space left on the disk for partition (%s) to grow into", d.Partitions[growIndex].ID)
+			return
+		}
+
+		extents, err = d.layoutPartitions(diskSize, usableStart, usableEnd, alignment, growSize)
+		if err != nil {
+			return
+		}
+	}
+
+	err = d.checkLayout(extents, usableStart, usableEnd)
+	return
+}
+
+// validatePartition checks the partition on its own, then that its type and attributes can be used in the disk's partition table.
+func (d *Disk) validatePartition(partition *Partition) (err error) {
+	if err = partition.IsValid(); err != nil {
+		return
+	}
+
+	if d.PartitionTableType != PartitionTableTypeMbr {
+		return
+	}
+
+	if len(partition.Attributes) != 0 {
+		return fmt.Errorf("[Attributes] are only supported on GPT disks")
+	}
+
+	_, mbrType, _ := partition.PartitionType()
+	if partition.TypeUUID != "" && mbrType == 0 {
+		return fmt.Errorf("[TypeUUID] (%s) has no MBR equivalent", partition.TypeUUID)
+	}
+
+	return
+}
+
+// hasSizedPartitions returns true if any of the disk's partitions is placed by its Size.
+func (d *Disk) hasSizedPartitions() bool {
+	for i := range d.Partitions {
+		if d.Partitions[i].Size != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// alignment returns the disk's Alignment in bytes.
+func (d *Disk) alignment() (alignment uint64, err error) {
+	if d.Alignment == "" {
+		return defaultAlignment, nil
+	}
+
+	alignment, err = sizeutils.SizeAndUnitToBytes(d.Alignment)
+	if err == nil && (alignment == 0 || alignment%partitiontable.SectorSize != 0) {
+		err = fmt.Errorf("alignment (%s) must be a non-zero multiple of %d bytes", d.Alignment, partitiontable.SectorSize)
+	}
+	return
+}
+
+// layoutPartitions places every partition, giving a growing partition growSize bytes. Partitions with a Start are
+// placed where they say, an End of 0 extending them to the next such partition or to usableEnd.
+func (d *Disk) layoutPartitions(diskSize, usableStart, usableEnd, alignment, growSize uint64) (extents []PartitionExtent, err error) {
+	const mib = sizeutils.MiB
+
+	extents = make([]PartitionExtent, len(d.Partitions))
+	previousEnd := usableStart
+
+	for i := range d.Partitions {
+		partition := &d.Partitions[i]
+		extent := &extents[i]
+
+		if partition.Size == "" {
+			extent.Start = partition.Start * mib
+			end := partition.End * mib
+			if partition.End == 0 {
+				end = usableEnd
+				if i+1 < len(d.Partitions) && d.Partitions[i+1].Size == "" && d.Partitions[i+1].Start > partition.Start {
+					end = d.Partitions[i+1].Start * mib
+				}
+			}
+			if end <= extent.Start {
+				err = fmt.Errorf("partition (%s) must end after its [Start] (%d), found %d", partition.ID, partition.Start, end/mib)
+				return
+			}
+			extent.Size = end - extent.Start
+		} else {
+			var bytes, percent uint64
+			bytes, percent, err = partition.parseSize()
+			if err != nil {
+				err = fmt.Errorf("partition (%s) has an invalid [Size]: %w", partition.ID, err)
+				return
+			}
+
+			extent.Start = (previousEnd + alignment - 1) / alignment * alignment
+			switch {
+			case partition.Size == PartitionSizeGrow:
+				extent.Size = growSize
+			case percent != 0:
+				extent.Size = diskSize * percent / 100 / alignment * alignment
+			default:
+				extent.Size = bytes
+			}
+		}
+
+		previousEnd = extent.Start + extent.Size
+	}
+
+	return
+}
+
+// checkLayout checks every partition is within [usableStart, usableEnd) and starts after the partition before it.
+func (d *Disk) checkLayout(extents []PartitionExtent, usableStart, usableEnd uint64) (err error) {
+	var previousEnd uint64
+
+	for i, extent := range extents {
+		id := d.Partitions[i].ID
+		end := extent.Start + extent.Size
+
+		if extent.Size == 0 {
+			return fmt.Errorf("partition (%s) is empty", id)
+		}
+		if extent.Start < usableStart || end > usableEnd {
+			return fmt.Errorf("partition (%s) at bytes %d-%d is outside of the disk's usable bytes %d-%d", id, extent.Start, end, usableStart, usableEnd)
+		}
+		if extent.Start < previousEnd {
+			return fmt.Errorf("partition (%s) overlaps partition (%s)", id, d.Partitions[i-1].ID)
+		}
+		previousEnd = end
+	}
+
+	return
+}
@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"microsoft.com/pkggen/internal/sizeutils"
 )
 
 //TestMain found in configuration_test.go.
@@ -85,3 +86,130 @@ func TestShouldFailParsingInvalidDisk_Disk(t *testing.T) {
 	assert.Error(t, err)
 	assert.Equal(t, "failed to parse [Disk]: failed to parse [PartitionTableType]: invalid value for PartitionTableType (not_a_partition_type)", err.Error())
 }
+
+func sizedDisk(partitions ...Partition) Disk {
+	return Disk{
+		PartitionTableType: PartitionTableTypeGpt,
+		MaxSize:            1024,
+		Partitions:         partitions,
+	}
+}
+
+func TestShouldLayOutSizedPartitions_Disk(t *testing.T) {
+	const diskSize = 1024 * sizeutils.MiB
+
+	disk := sizedDisk(
+		Partition{ID: "boot", Size: "8M", TypeUUID: "esp"},
+		Partition{ID: "rootfs", Size: PartitionSizeGrow, TypeUUID: "linux-root-x86-64"},
+		Partition{ID: "home", Size: "25%", TypeUUID: "home"},
+		Partition{ID: "swap", Size: "1000K", TypeUUID: "swap"},
+	)
+	assert.NoError(t, disk.IsValid())
+
+	extents, err := disk.Layout(diskSize)
+	assert.NoError(t, err)
+	assert.Equal(t, []PartitionExtent{
+		{Start: 1 * sizeutils.MiB, Size: 8 * sizeutils.MiB},
+		{Start: 9 * sizeutils.MiB, Size: 758 * sizeutils.MiB},
+		{Start: 767 * sizeutils.MiB, Size: 256 * sizeutils.MiB},
+		{Start: 1023 * sizeutils.MiB, Size: 1000 * sizeutils.KiB},
+	}, extents)
+}
+
+func TestShouldAlignSizedPartitions_Disk(t *testing.T) {
+	disk := sizedDisk(
+		Partition{ID: "boot", Size: "1000K"},
+		Partition{ID: "rootfs", Size: "100M"},
+	)
+	disk.PartitionTableType = PartitionTableTypeMbr
+	disk.Alignment = "4MiB"
+
+	extents, err := disk.Layout(disk.MaxSize * sizeutils.MiB)
+	assert.NoError(t, err)
+	assert.Equal(t, []PartitionExtent{
+		{Start: 4 * sizeutils.MiB, Size: 1000 * sizeutils.KiB},
+		{Start: 8 * sizeutils.MiB, Size: 100 * sizeutils.MiB},
+	}, extents)
+}
+
+func TestShouldFollowStartAndEndPartitions_Disk(t *testing.T) {
+	disk := sizedDisk(
+		Partition{ID: "boot", Start: 1, End: 9},
+		Partition{ID: "rootfs", Size: PartitionSizeGrow},
+	)
+
+	extents, err := disk.Layout(disk.MaxSize * sizeutils.MiB)
+	assert.NoError(t, err)
+	assert.Equal(t, []PartitionExtent{
+		{Start: 1 * sizeutils.MiB, Size: 8 * sizeutils.MiB},
+		{Start: 9 * sizeutils.MiB, Size: 1014 * sizeutils.MiB},
+	}, extents)
+}
+
+func TestShouldFailSizedPartitionsNotFitting_Disk(t *testing.T) {
+	disk := sizedDisk(
+		Partition{ID: "boot", Size: "8M"},
+		Partition{ID: "rootfs", Size: "100%"},
+	)
+
+	err := disk.IsValid()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "partition (rootfs) at bytes 9437184-1083179008 is outside of the disk's usable bytes")
+}
+
+func TestShouldFailTwoGrowingPartitions_Disk(t *testing.T) {
+	disk := sizedDisk(
+		Partition{ID: "rootfs", Size: PartitionSizeGrow},
+		Partition{ID: "home", Size: PartitionSizeGrow},
+	)
+
+	err := disk.IsValid()
+	assert.Error(t, err)
+	assert.Equal(t, "invalid [Partitions]: partitions (rootfs) and (home) can't both grow", err.Error())
+}
+
+func TestShouldFailGrowingWithoutSpace_Disk(t *testing.T) {
+	disk := sizedDisk(
+		Partition{ID: "rootfs", Size: "1022M"},
+		Partition{ID: "home", Size: PartitionSizeGrow},
+	)
+
+	err := disk.IsValid()
+	assert.Error(t, err)
+	assert.Equal(t, "invalid [Partitions]: no space left on the disk for partition (home) to grow into", err.Error())
+}
+
+func TestShouldFailGPTOnlyFeaturesOnMBR_Disk(t *testing.T) {
+	disk := sizedDisk(Partition{ID: "rootfs", Size: PartitionSizeGrow, Attributes: []string{"grow-fs"}})
+	disk.PartitionTableType = PartitionTableTypeMbr
+
+	err := disk.IsValid()
+	assert.Error(t, err)
+	assert.Equal(t, "invalid [Partitions] entry (rootfs): [Attributes] are only supported on GPT disks", err.Error())
+
+	disk = sizedDisk(Partition{ID: "bios", Size: "1M", TypeUUID: "bios-boot"})
+	disk.PartitionTableType = PartitionTableTypeMbr
+
+	err = disk.IsValid()
+	assert.Error(t, err)
+	assert.Equal(t, "invalid [Partitions] entry (bios): [TypeUUID] (bios-boot) has no MBR equivalent", err.Error())
+}
+
+func TestShouldFailInvalidAlignment_Disk(t *testing.T) {
+	disk := sizedDisk(Partition{ID: "rootfs", Size: PartitionSizeGrow})
+	disk.Alignment = "100B"
+
+	err := disk.IsValid()
+	assert.Error(t, err)
+	assert.Equal(t, "invalid [Alignment]: alignment (100B) must be a non-zero multiple of 512 bytes", err.Error())
+}
+
+func TestShouldLayOutSizedPartitionsWithoutMaxSize_Disk(t *testing.T) {
+	disk := sizedDisk(Partition{ID: "rootfs", Size: "50%"})
+	disk.MaxSize = 0
+	assert.NoError(t, disk.IsValid())
+
+	extents, err := disk.Layout(4 * sizeutils.GiB)
+	assert.NoError(t, err)
+	assert.Equal(t, []PartitionExtent{{Start: 1 * sizeutils.MiB, Size: 2 * sizeutils.GiB}}, extents)
+}
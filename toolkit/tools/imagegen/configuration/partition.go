@@ -0,0 +1,184 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+// Parser for the image builder's configuration schemas.
+
+package configuration
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"microsoft.com/pkggen/internal/partitiontable"
+	"microsoft.com/pkggen/internal/sizeutils"
+)
+
+const (
+	// btrfsFsType is the only file system with subvolumes
+	btrfsFsType = "btrfs"
+	// subvolumeReservedChars can't be used in subvolume names
+	subvolumeReservedChars = ",`&\\ \t\n"
+	// PartitionSizeGrow is the "Size" of a partition taking all the space left on its disk
+	PartitionSizeGrow = "grow"
+	// partitionSizePercentSuffix marks a "Size" given as a percentage of the disk
+	partitionSizePercentSuffix = "%"
+)
+
+// partitionType is a well-known partition type, as found in a GPT and in an MBR.
+// An mbr value of 0 means the type can't be used on an MBR disk.
+type partitionType struct {
+	gpt partitiontable.GUID
+	mbr byte
+}
+
+// partitionTypes are the well-known partition types a "TypeUUID" may name, mostly those of the Discoverable Partitions Specification.
+var partitionTypes = map[string]partitionType{
+	"esp":               {partitiontable.TypeEFISystem, partitiontable.MBRTypeEFISystem},
+	"bios-boot":         {partitiontable.TypeBIOSBoot, 0},
+	"xbootldr":          {partitiontable.TypeLinuxXBOOTLDR, partitiontable.MBRTypeLinuxXBOOTLDR},
+	"linux-generic":     {partitiontable.TypeLinuxFilesystem, partitiontable.MBRTypeLinux},
+	"linux-root-x86-64": {partitiontable.TypeLinuxRootX86_64, partitiontable.MBRTypeLinux},
+	"linux-root-arm64":  {partitiontable.TypeLinuxRootARM64, partitiontable.MBRTypeLinux},
+	"linux-usr-x86-64":  {partitiontable.TypeLinuxUsrX86_64, partitiontable.MBRTypeLinux},
+	"linux-usr-arm64":   {partitiontable.TypeLinuxUsrARM64, partitiontable.MBRTypeLinux},
+	"swap":              {partitiontable.TypeLinuxSwap, partitiontable.MBRTypeLinuxSwap},
+	"home":              {partitiontable.TypeLinuxHome, partitiontable.MBRTypeLinux},
+	"srv":               {partitiontable.TypeLinuxSrv, partitiontable.MBRTypeLinux},
+	"var":               {partitiontable.TypeLinuxVar, partitiontable.MBRTypeLinux},
+	"var-tmp":           {partitiontable.TypeLinuxVarTmp, partitiontable.MBRTypeLinux},
+	"lvm":               {partitiontable.TypeLinuxLVM, partitiontable.MBRTypeLinuxLVM},
+}
+
+// partitionAttributes are the GPT attribute flags an "Attributes" entry may name.
+var partitionAttributes = map[string]uint64{
+	"required":             partitiontable.AttributeRequired,
+	"no-block-io-protocol": partitiontable.AttributeNoBlockIOProtocol,
+	"legacy-bios-bootable": partitiontable.AttributeLegacyBIOSBootable,
+	"grow-fs":              partitiontable.AttributeGrowFS,
+	"read-only":            partitiontable.AttributeReadOnly,
+	"no-auto":              partitiontable.AttributeNoAuto,
+}
+
+// IsValid returns an error if the Partition's Size, TypeUUID, Attributes, MkfsOptions or Subvolumes are not valid
+func (p *Partition) IsValid() (err error) {
+	if p.Size != "" {
+		if p.Start != 0 || p.End != 0 {
+			return fmt.Errorf("[Size] can't be combined with [Start] or [End]")
+		}
+
+		_, _, err = p.parseSize()
+		if err != nil {
+			return fmt.Errorf("invalid [Size]: %w", err)
+		}
+	}
+
+	_, _, err = p.PartitionType()
+	if err != nil {
+		return fmt.Errorf("invalid [TypeUUID]: %w", err)
+	}
+
+	_, err = p.AttributeBits()
+	if err != nil {
+		return fmt.Errorf("invalid [Attributes]: %w", err)
+	}
+
+	if len(p.MkfsOptions) != 0 && p.FsType == "" {
+		return fmt.Errorf("[MkfsOptions] require a [FsType]")
+	}
+
+	err = p.validateSubvolumes()
+	if err != nil {
+		return fmt.Errorf("invalid [Subvolumes]: %w", err)
+	}
+
+	return
+}
+
+// HasSubvolume returns true if the partition's Subvolumes include subvolume.
+func (p *Partition) HasSubvolume(subvolume string) bool {
+	for _, existing := range p.Subvolumes {
+		if existing == subvolume {
+			return true
+		}
+	}
+	return false
+}
+
+// validateSubvolumes checks subvolumes are only given for btrfs, are unique, and are relative paths inside the file system.
+func (p *Partition) validateSubvolumes() (err error) {
+	if len(p.Subvolumes) != 0 && p.FsType != btrfsFsType {
+		return fmt.Errorf("subvolumes require a [FsType] of %s, found (%s)", btrfsFsType, p.FsType)
+	}
+
+	seen := make(map[string]bool)
+	for _, subvolume := range p.Subvolumes {
+		if subvolume == "" || filepath.IsAbs(subvolume) || filepath.Clean(subvolume) != subvolume || strings.HasPrefix(subvolume, "..") {
+			return fmt.Errorf("subvolume (%s) must be a relative path inside the file system", subvolume)
+		}
+		// Subvolume names end up in mount options and in grub configs filled in with sed
+		if strings.ContainsAny(subvolume, subvolumeReservedChars) {
+			return fmt.Errorf("subvolume (%s) can't contain any of (%s)", subvolume, subvolumeReservedChars)
+		}
+		if seen[subvolume] {
+			return fmt.Errorf("duplicate subvolume (%s)", subvolume)
+		}
+		seen[subvolume] = true
+	}
+
+	return
+}
+
+// PartitionType returns the GPT and MBR partition types named by the partition's TypeUUID. A GUID TypeUUID
+// has no MBR equivalent, nor do some well-known types, in which case mbrType is 0.
+// Both types are zero if the partition has no TypeUUID.
+func (p *Partition) PartitionType() (gptType partitiontable.GUID, mbrType byte, err error) {
+	if p.TypeUUID == "" {
+		return
+	}
+
+	if wellKnown, found := partitionTypes[p.TypeUUID]; found {
+		return wellKnown.gpt, wellKnown.mbr, nil
+	}
+
+	gptType, err = partitiontable.ParseGUID(p.TypeUUID)
+	if err != nil {
+		err = fmt.Errorf("(%s) is neither a GUID nor a well-known partition type", p.TypeUUID)
+	}
+	return
+}
+
+// AttributeBits returns the GPT attribute bits set by the partition's Attributes.
+func (p *Partition) AttributeBits() (attributes uint64, err error) {
+	for _, attribute := range p.Attributes {
+		bit, found := partitionAttributes[attribute]
+		if !found {
+			return 0, fmt.Errorf("unknown attribute (%s)", attribute)
+		}
+		attributes |= bit
+	}
+
+	return
+}
+
+// parseSize parses the partition's Size into either a number of bytes or a percentage of the disk.
+// Neither is set for a partition that grows.
+func (p *Partition) parseSize() (bytes, percent uint64, err error) {
+	switch {
+	case p.Size == PartitionSizeGrow:
+		return
+	case strings.HasSuffix(p.Size, partitionSizePercentSuffix):
+		percent, err = strconv.ParseUint(strings.TrimSuffix(p.Size, partitionSizePercentSuffix), 10, 64)
+		if err != nil || percent == 0 || percent > 100 {
+			err = fmt.Errorf("percentage (%s) must be between 1%% and 100%%", p.Size)
+		}
+		return
+	default:
+		bytes, err = sizeutils.SizeAndUnitToBytes(p.Size)
+		if err == nil && (bytes == 0 || bytes%partitiontable.SectorSize != 0) {
+			err = fmt.Errorf("size (%s) must be a non-zero multiple of %d bytes", p.Size, partitiontable.SectorSize)
+		}
+		return
+	}
+}
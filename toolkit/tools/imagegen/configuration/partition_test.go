@@ -0,0 +1,118 @@
+// Copyright Microsoft Corporation.
+// Licensed under the MIT License.
+
+package configuration
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"microsoft.com/pkggen/internal/partitiontable"
+)
+
+//TestMain found in configuration_test.go.
+
+func TestShouldSucceedValidatingSizedPartition_Partition(t *testing.T) {
+	for _, size := range []string{"512M", "2GiB", "1000MB", "20%", "100%", PartitionSizeGrow} {
+		partition := Partition{ID: "rootfs", Size: size}
+		assert.NoError(t, partition.IsValid(), size)
+	}
+}
+
+func TestShouldFailValidatingInvalidSize_Partition(t *testing.T) {
+	for _, size := range []string{"512", "0M", "0%", "101%", "1.5%", "513B", "big"} {
+		partition := Partition{ID: "rootfs", Size: size}
+		assert.Error(t, partition.IsValid(), size)
+	}
+}
+
+func TestShouldFailValidatingSizeWithStart_Partition(t *testing.T) {
+	partition := Partition{ID: "rootfs", Size: "512M", Start: 1}
+
+	err := partition.IsValid()
+	assert.Error(t, err)
+	assert.Equal(t, "[Size] can't be combined with [Start] or [End]", err.Error())
+}
+
+func TestShouldResolveWellKnownType_Partition(t *testing.T) {
+	partition := Partition{TypeUUID: "linux-root-x86-64"}
+
+	gptType, mbrType, err := partition.PartitionType()
+	assert.NoError(t, err)
+	assert.Equal(t, partitiontable.TypeLinuxRootX86_64, gptType)
+	assert.Equal(t, byte(partitiontable.MBRTypeLinux), mbrType)
+
+	partition.TypeUUID = "swap"
+	gptType, mbrType, err = partition.PartitionType()
+	assert.NoError(t, err)
+	assert.Equal(t, partitiontable.TypeLinuxSwap, gptType)
+	assert.Equal(t, byte(partitiontable.MBRTypeLinuxSwap), mbrType)
+}
+
+func TestShouldResolveGUIDType_Partition(t *testing.T) {
+	partition := Partition{TypeUUID: "BC13C2FF-59E6-4262-A352-B275FD6F7172"}
+
+	gptType, mbrType, err := partition.PartitionType()
+	assert.NoError(t, err)
+	assert.Equal(t, partitiontable.TypeLinuxXBOOTLDR, gptType)
+	assert.Equal(t, byte(0), mbrType)
+}
+
+func TestShouldFailResolvingUnknownType_Partition(t *testing.T) {
+	partition := Partition{ID: "rootfs", TypeUUID: "linux-root"}
+
+	err := partition.IsValid()
+	assert.Error(t, err)
+	assert.Equal(t, "invalid [TypeUUID]: (linux-root) is neither a GUID nor a well-known partition type", err.Error())
+}
+
+func TestShouldCombineAttributes_Partition(t *testing.T) {
+	partition := Partition{Attributes: []string{"grow-fs", "no-auto"}}
+
+	attributes, err := partition.AttributeBits()
+	assert.NoError(t, err)
+	assert.Equal(t, partitiontable.AttributeGrowFS|partitiontable.AttributeNoAuto, attributes)
+}
+
+func TestShouldFailUnknownAttribute_Partition(t *testing.T) {
+	partition := Partition{ID: "rootfs", Attributes: []string{"hidden"}}
+
+	err := partition.IsValid()
+	assert.Error(t, err)
+	assert.Equal(t, "invalid [Attributes]: unknown attribute (hidden)", err.Error())
+}
+
+func TestShouldFailMkfsOptionsWithoutFsType_Partition(t *testing.T) {
+	partition := Partition{ID: "rootfs", MkfsOptions: []string{"-L", "root"}}
+
+	err := partition.IsValid()
+	assert.Error(t, err)
+	assert.Equal(t, "[MkfsOptions] require a [FsType]", err.Error())
+}
+
+func TestShouldSucceedValidatingSubvolumes_Partition(t *testing.T) {
+	partition := Partition{ID: "rootfs", FsType: "btrfs", Subvolumes: []string{"@", "@home", "var/log"}}
+	assert.NoError(t, partition.IsValid())
+	assert.True(t, partition.HasSubvolume("@home"))
+	assert.False(t, partition.HasSubvolume("home"))
+}
+
+func TestShouldFailSubvolumesWithoutBtrfs_Partition(t *testing.T) {
+	partition := Partition{ID: "rootfs", FsType: "ext4", Subvolumes: []string{"@"}}
+
+	err := partition.IsValid()
+	assert.Error(t, err)
+	assert.Equal(t, "invalid [Subvolumes]: subvolumes require a [FsType] of btrfs, found (ext4)", err.Error())
+}
+
+func TestShouldFailInvalidSubvolumes_Partition(t *testing.T) {
+	for _, subvolume := range []string{"", "/@", "../@", "@/", "@/../home", "@ home", "@,ro", "@`"} {
+		partition := Partition{ID: "rootfs", FsType: "btrfs", Subvolumes: []string{subvolume}}
+		assert.Error(t, partition.IsValid(), subvolume)
+	}
+
+	partition := Partition{ID: "rootfs", FsType: "btrfs", Subvolumes: []string{"@", "@"}}
+	err := partition.IsValid()
+	assert.Error(t, err)
+	assert.Equal(t, "invalid [Subvolumes]: duplicate subvolume (@)", err.Error())
+}
@@ -61,21 +61,37 @@ func (s *SystemConfig) IsValid() (err error) {
 			}
 		}
 
-		// for _, partitionSetting := range sysConfig.PartitionSettings {
-		// 	if err = partitionSetting.IsValid(); err != nil {
-		// 		return fmt.Errorf("invalid [PartitionSettings]: %w", err)
-		// 	}
-		// }
+		for _, partitionSetting := range s.PartitionSettings {
+			if err = partitionSetting.IsValid(); err != nil {
+				return fmt.Errorf("invalid [PartitionSettings]: %w", err)
+			}
+		}
 	}
 
 	if err = s.KernelCommandLine.IsValid(); err != nil {
 		return fmt.Errorf("invalid [KernelCommandLine]: %w", err)
 	}
 
-	//Validate PartitionSettings
-	//Validate PostInstallScripts
-	//Validate Groups
-	//Validate Users
+	for _, postInstallScript := range s.PostInstallScripts {
+		if err = postInstallScript.IsValid(); err != nil {
+			return fmt.Errorf("invalid [PostInstallScripts]: %w", err)
+		}
+	}
+
+	for _, group := range s.Groups {
+		if err = group.IsValid(); err != nil {
+			return fmt.Errorf("invalid [Groups]: %w", err)
+		}
+	}
+
+	for _, user := range s.Users {
+		if err = user.IsValid(); err != nil {
+			return fmt.Errorf("invalid [Users]: %w", err)
+		}
+	}
+
+	// References between PartitionSettings, Groups and Users and the files they use are checked by Config.Validate
+
 	//Validate Encryption
 
 	return
@@ -97,3 +113,26 @@ func (s *SystemConfig) UnmarshalJSON(b []byte) (err error) {
 	}
 	return
 }
+
+// RootPartitionSetting returns the setting of the partition mounted as the root file system, or nil if there is none.
+func (s *SystemConfig) RootPartitionSetting() *PartitionSetting {
+	const rootMountPoint = "/"
+
+	for i := range s.PartitionSettings {
+		if s.PartitionSettings[i].MountPoint == rootMountPoint {
+			return &s.PartitionSettings[i]
+		}
+	}
+
+	return nil
+}
+
+// RootSubvolume returns the btrfs subvolume mounted as the root file system, or an empty string if
+// the root is not a subvolume.
+func (s *SystemConfig) RootSubvolume() (subvolume string) {
+	if rootSetting := s.RootPartitionSetting(); rootSetting != nil {
+		subvolume = rootSetting.Subvolume
+	}
+
+	return
+}
@@ -0,0 +1,428 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+// Semantic validation of the image builder's configuration schemas.
+
+package configuration
+
+import (
+	"fmt"
+	"sort"
+
+	"microsoft.com/pkggen/internal/file"
+	"microsoft.com/pkggen/internal/jsonutils"
+	"microsoft.com/pkggen/internal/sizeutils"
+)
+
+// supportedFsTypes are the file systems a partition can be formatted with, an empty FsType leaves it unformatted.
+var supportedFsTypes = map[string]bool{
+	"":      true,
+	"fat16": true,
+	"fat32": true,
+	"vfat":  true,
+	"ext2":  true,
+	"ext3":  true,
+	"ext4":  true,
+	"xfs":   true,
+	"btrfs": true,
+	"swap":  true,
+}
+
+// swapFsType formats a partition as swap space, which is added to fstab instead of being mounted
+const swapFsType = "swap"
+
+// defaultGroups are created by the base filesystem, users may join them without listing them in [Groups].
+var defaultGroups = map[string]bool{
+	"root": true, "bin": true, "daemon": true, "sys": true, "adm": true, "tty": true, "disk": true, "lp": true,
+	"mem": true, "kmem": true, "wheel": true, "cdrom": true, "mail": true, "man": true, "dialout": true, "floppy": true,
+	"games": true, "tape": true, "video": true, "audio": true, "utmp": true, "usb": true, "input": true, "kvm": true,
+	"render": true, "systemd-journal": true, "users": true, "nogroup": true,
+}
+
+// ValidationError is a single problem found in a configuration, located by the JSON path of the offending value.
+type ValidationError struct {
+	Path    string `json:"Path"`   // JSON path of the value, e.g. $.SystemConfigs[0].Users[1].PrimaryGroup
+	Line    int    `json:"Line"`   // Line of the value in the config file, 0 if unknown
+	Column  int    `json:"Column"` // Column of the value in the config file, 0 if unknown
+	Message string `json:"Message"`
+}
+
+// Error returns the problem prefixed by its location.
+func (v *ValidationError) Error() string {
+	if v.Line == 0 {
+		return fmt.Sprintf("%s: %s", v.Path, v.Message)
+	}
+	return fmt.Sprintf("%s (line %d, column %d): %s", v.Path, v.Line, v.Column, v.Message)
+}
+
+// validationErrors collects every problem found while validating a configuration.
+type validationErrors []*ValidationError
+
+func (v *validationErrors) add(path, format string, args ...interface{}) {
+	*v = append(*v, &ValidationError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// checkFile records a problem if localPath, resolved against baseDirPath, is not an existing file.
+func (v *validationErrors) checkFile(path, baseDirPath, localPath string) {
+	absPath := file.GetAbsPathWithBase(baseDirPath, localPath)
+	exists, err := file.PathExists(absPath)
+	switch {
+	case err != nil:
+		v.add(path, "unable to access (%s): %s", absPath, err)
+	case !exists:
+		v.add(path, "file (%s) does not exist", absPath)
+	}
+}
+
+// Validate performs a full semantic validation of the configuration, beyond the checks made while loading it,
+// and returns every problem found. Relative file paths are resolved against baseDirPath.
+// The errors do not contain line and column information, use LocateValidationErrors to add it.
+func (c *Config) Validate(baseDirPath string) (problems []*ValidationError) {
+	var found validationErrors
+
+	partitions := c.validateDisks(&found, baseDirPath)
+
+	systemConfigNames := make(map[string]string)
+	for i := range c.SystemConfigs {
+		path := jsonutils.JSONPathIndex(jsonutils.JSONPathMember(jsonutils.JSONPathRoot, "SystemConfigs"), i)
+		systemConfig := &c.SystemConfigs[i]
+
+		if previous, exists := systemConfigNames[systemConfig.Name]; exists {
+			found.add(jsonutils.JSONPathMember(path, "Name"), "duplicate system configuration name (%s), also used by %s", systemConfig.Name, previous)
+		} else {
+			systemConfigNames[systemConfig.Name] = path
+		}
+
+		systemConfig.validate(&found, path, baseDirPath, partitions)
+
+		if systemConfig.Encryption.Enable && c.hasVolumeGroups() {
+			found.add(jsonutils.JSONPathMember(path, "Encryption"), "root encryption can't be combined with [VolumeGroups]")
+		}
+	}
+
+	return found
+}
+
+// hasVolumeGroups returns true if any disk has volume groups.
+func (c *Config) hasVolumeGroups() bool {
+	for i := range c.Disks {
+		if len(c.Disks[i].VolumeGroups) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// LocateValidationErrors sets the line and column of each error using the config file's contents.
+func LocateValidationErrors(configData []byte, problems []*ValidationError) (err error) {
+	locations, err := jsonutils.LocateValues(configData)
+	if err != nil {
+		return
+	}
+
+	for _, validationError := range problems {
+		if location, found := locations.Find(validationError.Path); found {
+			validationError.Line = location.Line
+			validationError.Column = location.Column
+		}
+	}
+	return
+}
+
+// validateDisks validates every disk and returns every partition, keyed by the partition's ID.
+// Logical volumes are returned as partitions too.
+func (c *Config) validateDisks(found *validationErrors, baseDirPath string) (partitions map[string]*Partition) {
+	partitions = make(map[string]*Partition)
+	partitionIDs := make(map[string]string)
+
+	for i := range c.Disks {
+		path := jsonutils.JSONPathIndex(jsonutils.JSONPathMember(jsonutils.JSONPathRoot, "Disks"), i)
+		disk := &c.Disks[i]
+
+		if err := disk.PartitionTableType.IsValid(); err != nil {
+			found.add(jsonutils.JSONPathMember(path, "PartitionTableType"), "%s", err)
+		}
+
+		if _, err := disk.alignment(); err != nil {
+			found.add(jsonutils.JSONPathMember(path, "Alignment"), "%s", err)
+		}
+
+		partitionsPath := jsonutils.JSONPathMember(path, "Partitions")
+		for j, partition := range disk.Partitions {
+			partitionPath := jsonutils.JSONPathIndex(partitionsPath, j)
+
+			switch previous, exists := partitionIDs[partition.ID]; {
+			case partition.ID == "":
+				found.add(jsonutils.JSONPathMember(partitionPath, "ID"), "missing [ID] field")
+			case exists:
+				found.add(jsonutils.JSONPathMember(partitionPath, "ID"), "duplicate partition ID (%s), also used by %s", partition.ID, previous)
+			default:
+				partitionIDs[partition.ID] = partitionPath
+				partitions[partition.ID] = &disk.Partitions[j]
+			}
+
+			if !supportedFsTypes[partition.FsType] {
+				found.add(jsonutils.JSONPathMember(partitionPath, "FsType"), "unknown file system type (%s)", partition.FsType)
+			}
+
+			if err := disk.validatePartition(&disk.Partitions[j]); err != nil {
+				found.add(partitionPath, "%s", err)
+			}
+		}
+
+		if !disk.hasSizedPartitions() {
+			disk.validatePartitionRanges(found, partitionsPath)
+		} else if disk.MaxSize != 0 {
+			if _, err := disk.Layout(disk.MaxSize * sizeutils.MiB); err != nil {
+				found.add(partitionsPath, "%s", err)
+			}
+		}
+
+		volumeGroupsPath := jsonutils.JSONPathMember(path, "VolumeGroups")
+		usedPartitions := make(map[string]string)
+		groupNames := make(map[string]string)
+		for j := range disk.VolumeGroups {
+			volumeGroupPath := jsonutils.JSONPathIndex(volumeGroupsPath, j)
+			volumeGroup := &disk.VolumeGroups[j]
+
+			if err := disk.validateVolumeGroup(volumeGroup, usedPartitions); err != nil {
+				found.add(volumeGroupPath, "%s", err)
+			}
+
+			if previous, exists := groupNames[volumeGroup.Name]; exists {
+				found.add(jsonutils.JSONPathMember(volumeGroupPath, "Name"), "duplicate volume group name (%s), also used by %s", volumeGroup.Name, previous)
+			} else {
+				groupNames[volumeGroup.Name] = volumeGroupPath
+			}
+
+			// Logical volumes are formatted and mounted like partitions, so they share their IDs
+			logicalVolumesPath := jsonutils.JSONPathMember(volumeGroupPath, "LogicalVolumes")
+			for k := range volumeGroup.LogicalVolumes {
+				logicalVolumePath := jsonutils.JSONPathIndex(logicalVolumesPath, k)
+				logicalVolume := &volumeGroup.LogicalVolumes[k]
+
+				if previous, exists := partitionIDs[logicalVolume.ID]; exists {
+					found.add(jsonutils.JSONPathMember(logicalVolumePath, "ID"), "duplicate partition ID (%s), also used by %s", logicalVolume.ID, previous)
+				} else if logicalVolume.ID != "" {
+					partitionIDs[logicalVolume.ID] = logicalVolumePath
+					partition := logicalVolume.AsPartition()
+					partitions[logicalVolume.ID] = &partition
+				}
+
+				if !supportedFsTypes[logicalVolume.FsType] {
+					found.add(jsonutils.JSONPathMember(logicalVolumePath, "FsType"), "unknown file system type (%s)", logicalVolume.FsType)
+				}
+			}
+		}
+
+		rawBinariesPath := jsonutils.JSONPathMember(path, "RawBinaries")
+		for j, rawBinary := range disk.RawBinaries {
+			found.checkFile(jsonutils.JSONPathMember(jsonutils.JSONPathIndex(rawBinariesPath, j), "BinPath"), baseDirPath, rawBinary.BinPath)
+		}
+	}
+
+	return
+}
+
+// validatePartitionRanges checks that partitions end after they start, fit on the disk and do not overlap.
+// An End of 0 extends the partition to the start of the next one, or to the end of the disk.
+func (d *Disk) validatePartitionRanges(found *validationErrors, partitionsPath string) {
+	order := make([]int, len(d.Partitions))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return d.Partitions[order[i]].Start < d.Partitions[order[j]].Start
+	})
+
+	for position, i := range order {
+		partition := d.Partitions[i]
+		endPath := jsonutils.JSONPathMember(jsonutils.JSONPathIndex(partitionsPath, i), "End")
+
+		if partition.End != 0 && partition.End <= partition.Start {
+			found.add(endPath, "partition (%s) must end after its [Start] (%d), found %d", partition.ID, partition.Start, partition.End)
+			continue
+		}
+
+		if d.MaxSize != 0 && partition.End > d.MaxSize {
+			found.add(endPath, "partition (%s) ends at %d, beyond the disk's [MaxSize] (%d)", partition.ID, partition.End, d.MaxSize)
+		}
+
+		if position+1 < len(order) {
+			next := d.Partitions[order[position+1]]
+			if partition.End == 0 && partition.Start == next.Start || partition.End > next.Start {
+				startPath := jsonutils.JSONPathMember(jsonutils.JSONPathIndex(partitionsPath, order[position+1]), "Start")
+				found.add(startPath, "partition (%s) starting at %d overlaps partition (%s)", next.ID, next.Start, partition.ID)
+			}
+		}
+	}
+}
+
+// validate checks the system configuration's references to partitions, groups and files.
+func (s *SystemConfig) validate(found *validationErrors, path, baseDirPath string, partitions map[string]*Partition) {
+	s.validatePartitionSettings(found, path, partitions)
+
+	packageListsPath := jsonutils.JSONPathMember(path, "PackageLists")
+	for i, packageList := range s.PackageLists {
+		found.checkFile(jsonutils.JSONPathIndex(packageListsPath, i), baseDirPath, packageList)
+	}
+
+	additionalFilesPath := jsonutils.JSONPathMember(path, "AdditionalFiles")
+	localFiles := make([]string, 0, len(s.AdditionalFiles))
+	for localFile := range s.AdditionalFiles {
+		localFiles = append(localFiles, localFile)
+	}
+	sort.Strings(localFiles)
+	for _, localFile := range localFiles {
+		found.checkFile(jsonutils.JSONPathMember(additionalFilesPath, localFile), baseDirPath, localFile)
+	}
+
+	postInstallScriptsPath := jsonutils.JSONPathMember(path, "PostInstallScripts")
+	for i, script := range s.PostInstallScripts {
+		scriptPath := jsonutils.JSONPathIndex(postInstallScriptsPath, i)
+		if err := script.IsValid(); err != nil {
+			found.add(scriptPath, "%s", err)
+			continue
+		}
+		found.checkFile(jsonutils.JSONPathMember(scriptPath, "Path"), baseDirPath, script.Path)
+	}
+
+	groups := s.validateGroups(found, path)
+	s.validateUsers(found, path, baseDirPath, groups)
+}
+
+// validatePartitionSettings checks each setting refers to a partition, or a subvolume of one, defined in [Disks]
+// and that mount points are unique.
+func (s *SystemConfig) validatePartitionSettings(found *validationErrors, path string, partitions map[string]*Partition) {
+	const rootMountPoint = "/"
+
+	settingsPath := jsonutils.JSONPathMember(path, "PartitionSettings")
+	settingIDs := make(map[string]string)
+	mountPoints := make(map[string]string)
+
+	for i, setting := range s.PartitionSettings {
+		settingPath := jsonutils.JSONPathIndex(settingsPath, i)
+		idPath := jsonutils.JSONPathMember(settingPath, "ID")
+		mountPointPath := jsonutils.JSONPathMember(settingPath, "MountPoint")
+
+		if err := setting.IsValid(); err != nil {
+			found.add(settingPath, "%s", err)
+			continue
+		}
+
+		partition, exists := partitions[setting.ID]
+		switch {
+		case !exists:
+			found.add(idPath, "partition ID (%s) is not defined in any [Disks] [Partitions]", setting.ID)
+		case partition.FsType == swapFsType && setting.MountPoint != "":
+			found.add(mountPointPath, "swap partition (%s) can't be mounted, it is added to fstab as swap space", setting.ID)
+		case setting.Subvolume != "" && !partition.HasSubvolume(setting.Subvolume):
+			found.add(jsonutils.JSONPathMember(settingPath, "Subvolume"), "subvolume (%s) is not defined in the [Subvolumes] of partition (%s)", setting.Subvolume, setting.ID)
+		}
+
+		// A partition may be mounted once per subvolume
+		settingKey := setting.ID
+		if setting.Subvolume != "" {
+			settingKey = fmt.Sprintf("%s[%s]", setting.ID, setting.Subvolume)
+		}
+		if previous, exists := settingIDs[settingKey]; exists {
+			found.add(idPath, "duplicate partition ID (%s), also used by %s", settingKey, previous)
+		} else {
+			settingIDs[settingKey] = idPath
+		}
+
+		if setting.MountPoint == "" {
+			continue
+		}
+		if previous, exists := mountPoints[setting.MountPoint]; exists {
+			found.add(mountPointPath, "duplicate mount point (%s), also used by %s", setting.MountPoint, previous)
+		} else {
+			mountPoints[setting.MountPoint] = mountPointPath
+		}
+	}
+
+	if len(s.PartitionSettings) != 0 {
+		if _, exists := mountPoints[rootMountPoint]; !exists {
+			found.add(settingsPath, "no partition is mounted at (%s)", rootMountPoint)
+		}
+	}
+}
+
+// validateGroups checks group names and GIDs are unique and returns the name of every group.
+func (s *SystemConfig) validateGroups(found *validationErrors, path string) (groups map[string]bool) {
+	groupsPath := jsonutils.JSONPathMember(path, "Groups")
+	groups = make(map[string]bool)
+	gids := make(map[string]string)
+
+	for i, group := range s.Groups {
+		groupPath := jsonutils.JSONPathIndex(groupsPath, i)
+		if err := group.IsValid(); err != nil {
+			found.add(groupPath, "%s", err)
+			continue
+		}
+
+		if groups[group.Name] {
+			found.add(jsonutils.JSONPathMember(groupPath, "Name"), "duplicate group (%s)", group.Name)
+		}
+		groups[group.Name] = true
+
+		if group.GID == "" {
+			continue
+		}
+		if previous, exists := gids[group.GID]; exists {
+			found.add(jsonutils.JSONPathMember(groupPath, "GID"), "duplicate GID (%s), also used by group (%s)", group.GID, previous)
+		} else {
+			gids[group.GID] = group.Name
+		}
+	}
+
+	return
+}
+
+// validateUsers checks user names and UIDs are unique, the groups they join exist and their SSH keys are present.
+func (s *SystemConfig) validateUsers(found *validationErrors, path, baseDirPath string, groups map[string]bool) {
+	usersPath := jsonutils.JSONPathMember(path, "Users")
+	users := make(map[string]bool)
+	uids := make(map[string]string)
+
+	checkGroup := func(groupPath, group string) {
+		if !groups[group] && !defaultGroups[group] {
+			found.add(groupPath, "group (%s) is not defined in [Groups] and is not a default group", group)
+		}
+	}
+
+	for i, user := range s.Users {
+		userPath := jsonutils.JSONPathIndex(usersPath, i)
+		if err := user.IsValid(); err != nil {
+			found.add(userPath, "%s", err)
+			continue
+		}
+
+		if users[user.Name] {
+			found.add(jsonutils.JSONPathMember(userPath, "Name"), "duplicate user (%s)", user.Name)
+		}
+		users[user.Name] = true
+
+		if user.UID != "" {
+			if previous, exists := uids[user.UID]; exists {
+				found.add(jsonutils.JSONPathMember(userPath, "UID"), "duplicate UID (%s), also used by user (%s)", user.UID, previous)
+			} else {
+				uids[user.UID] = user.Name
+			}
+		}
+
+		if user.PrimaryGroup != "" {
+			checkGroup(jsonutils.JSONPathMember(userPath, "PrimaryGroup"), user.PrimaryGroup)
+		}
+
+		secondaryGroupsPath := jsonutils.JSONPathMember(userPath, "SecondaryGroups")
+		for j, group := range user.SecondaryGroups {
+			checkGroup(jsonutils.JSONPathIndex(secondaryGroupsPath, j), group)
+		}
+
+		sshPubKeyPathsPath := jsonutils.JSONPathMember(userPath, "SSHPubKeyPaths")
+		for j, sshPubKeyPath := range user.SSHPubKeyPaths {
+			found.checkFile(jsonutils.JSONPathIndex(sshPubKeyPathsPath, j), baseDirPath, sshPubKeyPath)
+		}
+	}
+}
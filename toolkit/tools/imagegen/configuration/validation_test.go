@@ -0,0 +1,199 @@
+// Copyright Microsoft Corporation.
+// Licensed under the MIT License.
+
+package configuration
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// validationErrorPaths returns the JSON path of each problem.
+func validationErrorPaths(problems []*ValidationError) (paths []string) {
+	for _, problem := range problems {
+		paths = append(paths, problem.Path)
+	}
+	return
+}
+
+func validTestConfig() Config {
+	return Config{
+		Disks: []Disk{
+			{
+				PartitionTableType: PartitionTableTypeGpt,
+				MaxSize:            1024,
+				Partitions: []Partition{
+					{ID: "boot", FsType: "fat32", Start: 1, End: 9},
+					{ID: "rootfs", FsType: "ext4", Start: 9, End: 0},
+				},
+			},
+		},
+		SystemConfigs: []SystemConfig{
+			{
+				Name: "test",
+				PartitionSettings: []PartitionSetting{
+					{ID: "boot", MountPoint: "/boot/efi"},
+					{ID: "rootfs", MountPoint: "/"},
+				},
+				Groups: []Group{{Name: "test", GID: "1000"}},
+				Users:  []User{{Name: "test", UID: "1000", PrimaryGroup: "test", SecondaryGroups: []string{"wheel"}}},
+			},
+		},
+	}
+}
+
+func TestValidateShouldPassValidConfig(t *testing.T) {
+	config := validTestConfig()
+	assert.Empty(t, config.Validate("."))
+}
+
+func TestValidateShouldFailOverlappingPartitions(t *testing.T) {
+	config := validTestConfig()
+	config.Disks[0].Partitions = append(config.Disks[0].Partitions, Partition{ID: "data", FsType: "ext4", Start: 8, End: 2048})
+
+	paths := validationErrorPaths(config.Validate("."))
+	assert.Equal(t, []string{"$.Disks[0].Partitions[2].Start", "$.Disks[0].Partitions[2].End", "$.Disks[0].Partitions[1].Start"}, paths)
+}
+
+func TestValidateShouldFailUnknownPartitionAndFsType(t *testing.T) {
+	config := validTestConfig()
+	config.Disks[0].Partitions[1].FsType = "zfs"
+	config.SystemConfigs[0].PartitionSettings[0].ID = "esp"
+
+	paths := validationErrorPaths(config.Validate("."))
+	assert.Equal(t, []string{"$.Disks[0].Partitions[1].FsType", "$.SystemConfigs[0].PartitionSettings[0].ID"}, paths)
+}
+
+func TestValidateShouldFailDuplicateMountPoints(t *testing.T) {
+	config := validTestConfig()
+	config.SystemConfigs[0].PartitionSettings[0].MountPoint = "/"
+
+	paths := validationErrorPaths(config.Validate("."))
+	assert.Equal(t, []string{"$.SystemConfigs[0].PartitionSettings[1].MountPoint"}, paths)
+}
+
+func TestValidateShouldFailUndefinedGroups(t *testing.T) {
+	config := validTestConfig()
+	config.SystemConfigs[0].Groups = nil
+	config.SystemConfigs[0].Users[0].SecondaryGroups = append(config.SystemConfigs[0].Users[0].SecondaryGroups, "missing")
+
+	paths := validationErrorPaths(config.Validate("."))
+	assert.Equal(t, []string{"$.SystemConfigs[0].Users[0].PrimaryGroup", "$.SystemConfigs[0].Users[0].SecondaryGroups[1]"}, paths)
+}
+
+func TestValidateShouldResolveFilesAgainstBaseDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "validation")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "packages.json"), []byte("{}"), 0644))
+
+	config := validTestConfig()
+	config.SystemConfigs[0].PackageLists = []string{"packages.json", "missing.json"}
+
+	paths := validationErrorPaths(config.Validate(dir))
+	assert.Equal(t, []string{"$.SystemConfigs[0].PackageLists[1]"}, paths)
+}
+
+func TestLocateValidationErrors(t *testing.T) {
+	configData := []byte("{\n  \"Disks\": [\n    {\"MaxSize\": 1}\n  ]\n}")
+	problems := []*ValidationError{{Path: "$.Disks[0].MaxSize"}, {Path: "$.Disks[0].Partitions[0]"}}
+
+	assert.NoError(t, LocateValidationErrors(configData, problems))
+	assert.Equal(t, 3, problems[0].Line)
+	assert.Equal(t, 17, problems[0].Column)
+	assert.Equal(t, 3, problems[1].Line)
+	assert.Equal(t, 5, problems[1].Column)
+}
+
+func TestValidateShouldFailSizedPartitionsNotFitting(t *testing.T) {
+	config := validTestConfig()
+	config.Disks[0].Partitions = []Partition{
+		{ID: "boot", FsType: "fat32", Size: "8M", TypeUUID: "esp"},
+		{ID: "rootfs", FsType: "ext4", Size: "2G", Attributes: []string{"sideways"}},
+	}
+
+	paths := validationErrorPaths(config.Validate("."))
+	assert.Equal(t, []string{"$.Disks[0].Partitions[1]", "$.Disks[0].Partitions"}, paths)
+}
+
+func TestValidateShouldPassSubvolumesAndSwap(t *testing.T) {
+	config := validTestConfig()
+	config.Disks[0].Partitions[1] = Partition{ID: "rootfs", FsType: "btrfs", Start: 9, End: 900, Subvolumes: []string{"@", "@home"}}
+	config.Disks[0].Partitions = append(config.Disks[0].Partitions, Partition{ID: "swap", FsType: "swap", Start: 900, End: 0})
+	config.SystemConfigs[0].PartitionSettings = []PartitionSetting{
+		{ID: "boot", MountPoint: "/boot/efi"},
+		{ID: "rootfs", MountPoint: "/", Subvolume: "@"},
+		{ID: "rootfs", MountPoint: "/home", Subvolume: "@home"},
+		{ID: "swap"},
+	}
+
+	assert.Empty(t, config.Validate("."))
+	assert.Equal(t, "@", config.SystemConfigs[0].RootSubvolume())
+}
+
+func TestValidateShouldFailMountedSwapAndUndefinedSubvolume(t *testing.T) {
+	config := validTestConfig()
+	config.Disks[0].Partitions[1] = Partition{ID: "rootfs", FsType: "btrfs", Start: 9, End: 900, Subvolumes: []string{"@"}}
+	config.Disks[0].Partitions = append(config.Disks[0].Partitions, Partition{ID: "swap", FsType: "swap", Start: 900, End: 0})
+	config.SystemConfigs[0].PartitionSettings = []PartitionSetting{
+		{ID: "boot", MountPoint: "/boot/efi"},
+		{ID: "rootfs", MountPoint: "/", Subvolume: "@"},
+		{ID: "rootfs", MountPoint: "/home", Subvolume: "@home"},
+		{ID: "swap", MountPoint: "/swap"},
+	}
+
+	paths := validationErrorPaths(config.Validate("."))
+	assert.Equal(t, []string{"$.SystemConfigs[0].PartitionSettings[2].Subvolume", "$.SystemConfigs[0].PartitionSettings[3].MountPoint"}, paths)
+}
+
+func TestValidateShouldPassLogicalVolumes(t *testing.T) {
+	config := validTestConfig()
+	config.Disks[0].Partitions[1] = Partition{ID: "pv", TypeUUID: "lvm", Start: 9, End: 0}
+	config.Disks[0].VolumeGroups = []VolumeGroup{
+		{
+			Name:            "system",
+			PhysicalVolumes: []string{"pv"},
+			LogicalVolumes: []LogicalVolume{
+				{ID: "rootfs", Name: "root", Size: PartitionSizeGrow, FsType: "ext4"},
+				{ID: "swap", Name: "swap", Size: "256M", FsType: "swap"},
+			},
+		},
+	}
+	config.SystemConfigs[0].PartitionSettings = append(config.SystemConfigs[0].PartitionSettings, PartitionSetting{ID: "swap"})
+
+	assert.Empty(t, config.Validate("."))
+}
+
+func TestValidateShouldFailLogicalVolumeProblems(t *testing.T) {
+	config := validTestConfig()
+	config.Disks[0].Partitions[1] = Partition{ID: "pv", TypeUUID: "lvm", Start: 9, End: 0}
+	config.Disks[0].VolumeGroups = []VolumeGroup{
+		{
+			Name:            "system",
+			PhysicalVolumes: []string{"pv"},
+			LogicalVolumes: []LogicalVolume{
+				{ID: "rootfs", Name: "root", Size: PartitionSizeGrow, FsType: "zfs"},
+				{ID: "boot", Name: "boot", Size: "256M", FsType: "ext4"},
+			},
+		},
+		{
+			Name:            "system",
+			PhysicalVolumes: []string{"pv"},
+		},
+	}
+	config.SystemConfigs[0].Encryption.Enable = true
+
+	paths := validationErrorPaths(config.Validate("."))
+	assert.Equal(t, []string{
+		"$.Disks[0].VolumeGroups[0].LogicalVolumes[0].FsType",
+		"$.Disks[0].VolumeGroups[0].LogicalVolumes[1].ID",
+		"$.Disks[0].VolumeGroups[1]",
+		"$.Disks[0].VolumeGroups[1].Name",
+		"$.SystemConfigs[0].Encryption",
+	}, paths)
+}
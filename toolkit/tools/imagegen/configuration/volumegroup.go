@@ -0,0 +1,184 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+// Parser for the image builder's configuration schemas.
+
+package configuration
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// lvmNameRegex matches the names LVM accepts for volume groups and logical volumes
+var lvmNameRegex = regexp.MustCompile(`^[a-zA-Z0-9+_.][a-zA-Z0-9+_.-]*$`)
+
+// VolumeGroup is an LVM volume group spanning one or more of its disk's partitions.
+// "PhysicalVolumes" lists the IDs of the partitions the group is made of, which must not be formatted.
+// "LogicalVolumes" are created in the order they are listed, except for a growing one which is created last.
+type VolumeGroup struct {
+	Name            string          `json:"Name"`
+	PhysicalVolumes []string        `json:"PhysicalVolumes"`
+	LogicalVolumes  []LogicalVolume `json:"LogicalVolumes"`
+}
+
+// LogicalVolume is a volume of a VolumeGroup, formatted and mounted through PartitionSettings like a partition.
+// "Size" is a size and a unit (e.g. "4GiB"), a percentage of the volume group (e.g. "20%"), or "grow" to take
+// the space left in the volume group.
+type LogicalVolume struct {
+	ID          string   `json:"ID"`
+	Name        string   `json:"Name"`
+	Size        string   `json:"Size"`
+	FsType      string   `json:"FsType"`
+	MkfsOptions []string `json:"MkfsOptions"`
+	Subvolumes  []string `json:"Subvolumes"`
+}
+
+// IsValid returns an error if the VolumeGroup's Name or LogicalVolumes are not valid.
+func (v *VolumeGroup) IsValid() (err error) {
+	if err = validateLVMName(v.Name); err != nil {
+		return fmt.Errorf("invalid [Name]: %w", err)
+	}
+
+	if len(v.PhysicalVolumes) == 0 {
+		return fmt.Errorf("volume group (%s) must have at least one entry in [PhysicalVolumes]", v.Name)
+	}
+
+	var (
+		names        = make(map[string]bool)
+		grows        bool
+		totalPercent uint64
+	)
+	for i := range v.LogicalVolumes {
+		logicalVolume := &v.LogicalVolumes[i]
+		if err = logicalVolume.IsValid(); err != nil {
+			return fmt.Errorf("invalid [LogicalVolumes] entry (%s): %w", logicalVolume.ID, err)
+		}
+
+		if names[logicalVolume.Name] {
+			return fmt.Errorf("duplicate logical volume name (%s) in volume group (%s)", logicalVolume.Name, v.Name)
+		}
+		names[logicalVolume.Name] = true
+
+		if logicalVolume.Size == PartitionSizeGrow {
+			if grows {
+				return fmt.Errorf("only one logical volume of volume group (%s) can grow", v.Name)
+			}
+			grows = true
+		}
+
+		partition := logicalVolume.AsPartition()
+		_, percent, _ := partition.parseSize()
+		totalPercent += percent
+	}
+
+	if totalPercent > 100 {
+		return fmt.Errorf("logical volumes of volume group (%s) use %d%% of it", v.Name, totalPercent)
+	}
+
+	return
+}
+
+// IsValid returns an error if the LogicalVolume's ID, Name, Size, MkfsOptions or Subvolumes are not valid.
+func (l *LogicalVolume) IsValid() (err error) {
+	if l.ID == "" {
+		return fmt.Errorf("missing [ID] field")
+	}
+
+	if err = validateLVMName(l.Name); err != nil {
+		return fmt.Errorf("invalid [Name]: %w", err)
+	}
+
+	if l.Size == "" {
+		return fmt.Errorf("missing [Size] field")
+	}
+
+	partition := l.AsPartition()
+	return partition.IsValid()
+}
+
+// AsPartition returns a partition with the logical volume's ID, Size and formatting, so it can be formatted
+// and mounted like one.
+func (l *LogicalVolume) AsPartition() Partition {
+	return Partition{
+		ID:          l.ID,
+		Size:        l.Size,
+		FsType:      l.FsType,
+		MkfsOptions: l.MkfsOptions,
+		Subvolumes:  l.Subvolumes,
+	}
+}
+
+// LVMSize returns the lvcreate option and value sizing the logical volume: "--size" for a size in bytes,
+// or "--extents" for a share of the volume group.
+func (l *LogicalVolume) LVMSize() (option, value string, err error) {
+	partition := l.AsPartition()
+	bytes, percent, err := partition.parseSize()
+	if err != nil {
+		return
+	}
+
+	switch {
+	case l.Size == PartitionSizeGrow:
+		return "--extents", "100%FREE", nil
+	case percent != 0:
+		return "--extents", fmt.Sprintf("%d%%VG", percent), nil
+	default:
+		return "--size", fmt.Sprintf("%db", bytes), nil
+	}
+}
+
+// LogicalVolumePath returns the "<volume group>/<logical volume>" name of the logical volume with the given ID,
+// as used by LVM and dracut, or an empty string if no logical volume of the disk has that ID.
+func (d *Disk) LogicalVolumePath(id string) string {
+	for _, volumeGroup := range d.VolumeGroups {
+		for _, logicalVolume := range volumeGroup.LogicalVolumes {
+			if logicalVolume.ID == id {
+				return fmt.Sprintf("%s/%s", volumeGroup.Name, logicalVolume.Name)
+			}
+		}
+	}
+	return ""
+}
+
+// validateVolumeGroup checks the volume group on its own, then that its physical volumes are unformatted
+// partitions of the disk not used by another volume group. usedPartitions maps each partition used so far
+// to its volume group.
+func (d *Disk) validateVolumeGroup(volumeGroup *VolumeGroup, usedPartitions map[string]string) (err error) {
+	if err = volumeGroup.IsValid(); err != nil {
+		return
+	}
+
+	for _, partitionID := range volumeGroup.PhysicalVolumes {
+		partition := d.partition(partitionID)
+		switch previous, used := usedPartitions[partitionID]; {
+		case partition == nil:
+			return fmt.Errorf("physical volume (%s) is not a partition of the disk", partitionID)
+		case partition.FsType != "":
+			return fmt.Errorf("physical volume (%s) can't be formatted, found [FsType] (%s)", partitionID, partition.FsType)
+		case used:
+			return fmt.Errorf("physical volume (%s) is already used by volume group (%s)", partitionID, previous)
+		}
+		usedPartitions[partitionID] = volumeGroup.Name
+	}
+
+	return
+}
+
+// partition returns the disk's partition with the given ID, or nil if there is none.
+func (d *Disk) partition(id string) *Partition {
+	for i := range d.Partitions {
+		if d.Partitions[i].ID == id {
+			return &d.Partitions[i]
+		}
+	}
+	return nil
+}
+
+// validateLVMName checks name can be used as a volume group or logical volume name.
+func validateLVMName(name string) (err error) {
+	if name == "." || name == ".." || !lvmNameRegex.MatchString(name) {
+		return fmt.Errorf("(%s) must be made of letters, digits and any of (+_.-), and not start with (-)", name)
+	}
+	return
+}
@@ -0,0 +1,126 @@
+// Copyright Microsoft Corporation.
+// Licensed under the MIT License.
+
+package configuration
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//TestMain found in configuration_test.go.
+
+func validTestVolumeGroup() VolumeGroup {
+	return VolumeGroup{
+		Name:            "vg-system",
+		PhysicalVolumes: []string{"pv"},
+		LogicalVolumes: []LogicalVolume{
+			{ID: "rootfs", Name: "root", Size: PartitionSizeGrow, FsType: "ext4"},
+			{ID: "var", Name: "var", Size: "25%", FsType: "xfs"},
+			{ID: "swap", Name: "swap", Size: "512M", FsType: "swap"},
+		},
+	}
+}
+
+func TestShouldSucceedValidatingVolumeGroup_VolumeGroup(t *testing.T) {
+	volumeGroup := validTestVolumeGroup()
+	assert.NoError(t, volumeGroup.IsValid())
+}
+
+func TestShouldFailValidatingInvalidNames_VolumeGroup(t *testing.T) {
+	for _, name := range []string{"", "-vg", "vg/system", "vg system", ".", ".."} {
+		volumeGroup := validTestVolumeGroup()
+		volumeGroup.Name = name
+		assert.Error(t, volumeGroup.IsValid(), name)
+
+		volumeGroup = validTestVolumeGroup()
+		volumeGroup.LogicalVolumes[0].Name = name
+		assert.Error(t, volumeGroup.IsValid(), name)
+	}
+}
+
+func TestShouldFailValidatingLogicalVolumeWithoutSize_VolumeGroup(t *testing.T) {
+	volumeGroup := validTestVolumeGroup()
+	volumeGroup.LogicalVolumes[1].Size = ""
+
+	err := volumeGroup.IsValid()
+	assert.Error(t, err)
+	assert.Equal(t, "invalid [LogicalVolumes] entry (var): missing [Size] field", err.Error())
+}
+
+func TestShouldFailValidatingTwoGrowingLogicalVolumes_VolumeGroup(t *testing.T) {
+	volumeGroup := validTestVolumeGroup()
+	volumeGroup.LogicalVolumes[1].Size = PartitionSizeGrow
+
+	err := volumeGroup.IsValid()
+	assert.Error(t, err)
+	assert.Equal(t, "only one logical volume of volume group (vg-system) can grow", err.Error())
+}
+
+func TestShouldFailValidatingPercentagesOverflowing_VolumeGroup(t *testing.T) {
+	volumeGroup := validTestVolumeGroup()
+	volumeGroup.LogicalVolumes[0].Size = "80%"
+
+	err := volumeGroup.IsValid()
+	assert.Error(t, err)
+	assert.Equal(t, "logical volumes of volume group (vg-system) use 105% of it", err.Error())
+}
+
+func TestShouldFailValidatingDuplicateLogicalVolumeNames_VolumeGroup(t *testing.T) {
+	volumeGroup := validTestVolumeGroup()
+	volumeGroup.LogicalVolumes[1].Name = "root"
+
+	err := volumeGroup.IsValid()
+	assert.Error(t, err)
+	assert.Equal(t, "duplicate logical volume name (root) in volume group (vg-system)", err.Error())
+}
+
+func TestShouldReturnLVMSizes_VolumeGroup(t *testing.T) {
+	volumeGroup := validTestVolumeGroup()
+	expected := [][]string{
+		{"--extents", "100%FREE"},
+		{"--extents", "25%VG"},
+		{"--size", "536870912b"},
+	}
+
+	for i, logicalVolume := range volumeGroup.LogicalVolumes {
+		option, value, err := logicalVolume.LVMSize()
+		assert.NoError(t, err)
+		assert.Equal(t, expected[i], []string{option, value})
+	}
+}
+
+func TestShouldFindLogicalVolumePath_VolumeGroup(t *testing.T) {
+	disk := Disk{VolumeGroups: []VolumeGroup{validTestVolumeGroup()}}
+
+	assert.Equal(t, "vg-system/var", disk.LogicalVolumePath("var"))
+	assert.Equal(t, "", disk.LogicalVolumePath("boot"))
+}
+
+func TestShouldFailValidatingPhysicalVolumes_VolumeGroup(t *testing.T) {
+	disk := Disk{
+		PartitionTableType: PartitionTableTypeGpt,
+		Partitions: []Partition{
+			{ID: "boot", FsType: "fat32", Start: 1, End: 9},
+			{ID: "pv", TypeUUID: "lvm", Start: 9, End: 0},
+		},
+		VolumeGroups: []VolumeGroup{validTestVolumeGroup()},
+	}
+	assert.NoError(t, disk.IsValid())
+
+	disk.VolumeGroups[0].PhysicalVolumes = []string{"boot"}
+	err := disk.IsValid()
+	assert.Error(t, err)
+	assert.Equal(t, "invalid [VolumeGroups] entry (vg-system): physical volume (boot) can't be formatted, found [FsType] (fat32)", err.Error())
+
+	disk.VolumeGroups[0].PhysicalVolumes = []string{"pv", "pv"}
+	err = disk.IsValid()
+	assert.Error(t, err)
+	assert.Equal(t, "invalid [VolumeGroups] entry (vg-system): physical volume (pv) is already used by volume group (vg-system)", err.Error())
+
+	disk.VolumeGroups[0].PhysicalVolumes = []string{"data"}
+	err = disk.IsValid()
+	assert.Error(t, err)
+	assert.Equal(t, "invalid [VolumeGroups] entry (vg-system): physical volume (data) is not a partition of the disk", err.Error())
+}
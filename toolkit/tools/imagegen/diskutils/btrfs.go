@@ -0,0 +1,54 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package diskutils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"microsoft.com/pkggen/internal/logger"
+	"microsoft.com/pkggen/internal/shell"
+)
+
+// createSubvolumes creates subvolumes on the btrfs file system of devPath, mounting it on a temporary directory while doing so.
+// The directories a nested subvolume is created in are created as needed.
+func createSubvolumes(devPath string, subvolumes []string) (err error) {
+	const squashErrors = false
+
+	mountDir, err := ioutil.TempDir("", "btrfs")
+	if err != nil {
+		return
+	}
+	defer os.Remove(mountDir)
+
+	err = shell.ExecuteLive(squashErrors, "mount", "-t", "btrfs", devPath, mountDir)
+	if err != nil {
+		logger.Log.Warnf("Failed to mount (%s) to create subvolumes", devPath)
+		return
+	}
+	defer func() {
+		umountErr := shell.ExecuteLive(squashErrors, "umount", mountDir)
+		if umountErr != nil && err == nil {
+			err = umountErr
+		}
+	}()
+
+	for _, subvolume := range subvolumes {
+		subvolumePath := filepath.Join(mountDir, subvolume)
+		err = os.MkdirAll(filepath.Dir(subvolumePath), os.ModePerm)
+		if err != nil {
+			return
+		}
+
+		_, stderr, err := shell.Execute("btrfs", "subvolume", "create", subvolumePath)
+		if err != nil {
+			logger.Log.Warnf("Failed to create subvolume (%s) on (%s): %v", subvolume, devPath, stderr)
+			return err
+		}
+	}
+
+	logger.Log.Debugf("Created subvolumes %v on (%s)", subvolumes, devPath)
+	return
+}
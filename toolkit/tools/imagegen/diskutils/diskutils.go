@@ -6,10 +6,13 @@
 package diskutils
 
 import (
+	"crypto/rand"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"os"
 	"path/filepath"
-	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -17,8 +20,10 @@ import (
 	"microsoft.com/pkggen/imagegen/configuration"
 	"microsoft.com/pkggen/internal/file"
 	"microsoft.com/pkggen/internal/logger"
+	"microsoft.com/pkggen/internal/partitiontable"
 	"microsoft.com/pkggen/internal/retry"
 	"microsoft.com/pkggen/internal/shell"
+	"microsoft.com/pkggen/internal/sizeutils"
 )
 
 type blockDevicesOutput struct {
@@ -49,100 +54,27 @@ const (
 )
 
 // Unit to byte conversion values
-// See https://www.gnu.org/software/parted/manual/parted.html#unit
 const (
-	B  = 1
-	KB = 1000
-	MB = 1000 * 1000
-	GB = 1000 * 1000 * 1000
-	TB = 1000 * 1000 * 1000 * 1000
-
-	KiB = 1024
-	MiB = 1024 * 1024
-	GiB = 1024 * 1024 * 1024
-	TiB = 1024 * 1024 * 1024 * 1024
+	B  = sizeutils.B
+	KB = sizeutils.KB
+	MB = sizeutils.MB
+	GB = sizeutils.GB
+	TB = sizeutils.TB
+
+	KiB = sizeutils.KiB
+	MiB = sizeutils.MiB
+	GiB = sizeutils.GiB
+	TiB = sizeutils.TiB
 )
 
-var (
-	sizeAndUnitRegexp = regexp.MustCompile(`(\d+)((Ki?|Mi?|Gi?|Ti?)?B)`)
-
-	unitToBytes = map[string]uint64{
-		"B":   B,
-		"KB":  KB,
-		"MB":  MB,
-		"GB":  GB,
-		"TB":  TB,
-		"KiB": KiB,
-		"MiB": MiB,
-		"GiB": GiB,
-		"TiB": TiB,
-	}
-)
-
-// BytesToSizeAndUnit takes a number of bytes and returns friendly representation of a size (for example 100GB).
+// BytesToSizeAndUnit takes a number of bytes and returns friendly representation of a size (for example 100GiB).
 func BytesToSizeAndUnit(bytes uint64) string {
-	var (
-		unitSize  uint64
-		unitCount uint64
-		unitName  string
-	)
-
-	sizes := []uint64{B, KiB, MiB, GiB, TiB}
-
-	// Default to unit "Bytes" to handle the case where bytes is 0
-	unitSize = B
-
-	for _, unit := range sizes {
-		if bytes >= unit {
-			unitSize = unit
-		}
-	}
-
-	for unit, unitBytes := range unitToBytes {
-		if unitBytes == unitSize {
-			unitName = unit
-			break
-		}
-	}
-
-	unitCount = bytes / unitSize
-
-	return fmt.Sprintf("%d%s", unitCount, unitName)
+	return sizeutils.BytesToSizeAndUnit(bytes)
 }
 
-// SizeAndUnitToBytes takes a friendly representation of a size (for example 100GB) and return the number of bytes it represents.
+// SizeAndUnitToBytes takes a friendly representation of a size (for example 100GB or 512M) and return the number of bytes it represents.
 func SizeAndUnitToBytes(sizeAndUnit string) (bytes uint64, err error) {
-	const (
-		sizeIndex = 1
-		unitIndex = 2
-	)
-
-	// Match size and unit.  Examples: 2GB, 512MiB
-	matches := sizeAndUnitRegexp.FindAllStringSubmatch(sizeAndUnit, -1)
-
-	// must be at least one match
-	if len(matches) == 0 || len(matches[0]) <= 2 {
-		err = fmt.Errorf("sizeAndUnit must contain a number and a unit type")
-		return
-	}
-	match := matches[0]
-
-	sizeString := match[sizeIndex]
-	unit := match[unitIndex]
-
-	size, err := strconv.ParseUint(sizeString, 10, 64)
-	if err != nil {
-		return
-	}
-
-	if unitBytes, ok := unitToBytes[unit]; ok {
-		bytes = size * unitBytes
-	} else {
-		err = fmt.Errorf("unknown unit type (%s)", unit)
-		return
-	}
-
-	return
+	return sizeutils.SizeAndUnitToBytes(sizeAndUnit)
 }
 
 // ApplyRawBinaries applies all raw binaries described in disk configuration to the specified disk
@@ -207,7 +139,8 @@ func ZeroDisk(diskPath string, blockSize, size uint64) (err error) {
 
 // SetupLoopbackDevice creates a /dev/loop device for the given disk file
 func SetupLoopbackDevice(diskFilePath string) (devicePath string, err error) {
-	stdout, stderr, err := shell.Execute("losetup", "--show", "-f", diskFilePath)
+	// Scan the partitions so the kernel creates their device nodes
+	stdout, stderr, err := shell.Execute("losetup", "--show", "--partscan", "-f", diskFilePath)
 	if err != nil {
 		logger.Log.Warnf("Failed to create loopback device using losetup: %v", stderr)
 		return
@@ -227,7 +160,7 @@ func DetachLoopbackDevice(diskDevPath string) (err error) {
 	return
 }
 
-// CreatePartitions creates partitions on the specified disk according to the disk config
+// CreatePartitions creates partitions on the specified disk according to the disk config, then its volume groups
 func CreatePartitions(diskDevPath string, disk configuration.Disk, rootEncryption configuration.RootEncryption) (partDevPathMap map[string]string, partIDToFsTypeMap map[string]string, encryptedRoot EncryptedRootDevice, err error) {
 	const (
 		rootFsID = "rootfs"
@@ -236,26 +169,30 @@ func CreatePartitions(diskDevPath string, disk configuration.Disk, rootEncryptio
 	partDevPathMap = make(map[string]string)
 	partIDToFsTypeMap = make(map[string]string)
 
-	// Clear any old partition table info to prevent errors during partition creation
-	_, stderr, err := shell.Execute("sfdisk", "--delete", diskDevPath)
+	diskSize, err := partitiontable.DiskSize(diskDevPath)
+	if err != nil {
+		logger.Log.Warnf("Failed to get the size of disk (%s)", diskDevPath)
+		return
+	}
+
+	// Replace any old partition table with the whole new one at once
+	table, err := NewPartitionTable(disk, diskSize)
 	if err != nil {
-		logger.Log.Warnf("Failed to clear partition table. Expected if the disk is blank: %v", stderr)
+		return
 	}
 
-	// Create new partition table
-	partitionTableType := disk.PartitionTableType
-	_, stderr, err = shell.Execute("parted", diskDevPath, "--script", "mklabel", partitionTableType.String())
+	err = partitiontable.WriteFile(diskDevPath, table)
 	if err != nil {
-		logger.Log.Warnf("Failed to set partition table type using parted: %v", stderr)
+		logger.Log.Warnf("Failed to write partition table: %v", err)
 		return
 	}
 
 	// Partitions assumed to be defined in sorted order
 	for idx, partition := range disk.Partitions {
 		partitionNumber := idx + 1
-		partDevPath, err := CreateSinglePartition(diskDevPath, partitionNumber, partitionTableType.String(), partition)
+		partDevPath, err := InitializeSinglePartition(diskDevPath, partitionNumber)
 		if err != nil {
-			logger.Log.Warnf("Failed to create single partition")
+			logger.Log.Warnf("Failed to initialize single partition")
 			return partDevPathMap, partIDToFsTypeMap, encryptedRoot, err
 		}
 
@@ -274,86 +211,226 @@ func CreatePartitions(diskDevPath string, disk configuration.Disk, rootEncryptio
 
 		partIDToFsTypeMap[partition.ID] = partFsType
 	}
+
+	err = createVolumeGroups(disk, partDevPathMap, partIDToFsTypeMap)
 	return
 }
 
-// CreateSinglePartition creates a single partition based on the partition config
+// CreateSinglePartition adds a single partition based on the partition config to the end of the disk's partition table.
+// The first partition replaces any existing partition table with a new one of partitionTableType.
 func CreateSinglePartition(diskDevPath string, partitionNumber int, partitionTableType string, partition configuration.Partition) (partDevPath string, err error) {
+	diskSize, err := partitiontable.DiskSize(diskDevPath)
+	if err != nil {
+		return
+	}
+
+	var table *partitiontable.Table
+	if partitionNumber == 1 {
+		table, err = newEmptyPartitionTable(configuration.PartitionTableType(partitionTableType))
+	} else {
+		table, err = partitiontable.ReadFile(diskDevPath)
+	}
+	if err != nil {
+		return
+	}
+
+	if len(table.Partitions) != partitionNumber-1 {
+		err = fmt.Errorf("can't create partition %d on (%s), which has %d partitions", partitionNumber, diskDevPath, len(table.Partitions))
+		return
+	}
+
+	// Partitions placed by their Size depend on the partitions around them, so only a Start and End can be used here
+	if partition.Size != "" {
+		err = fmt.Errorf("partition %d - [Size] is not supported when creating a single partition, use [Start] and [End]", partitionNumber)
+		return
+	}
+
+	singlePartitionDisk := configuration.Disk{
+		PartitionTableType: configuration.PartitionTableType(partitionTableType),
+		Partitions:         []configuration.Partition{partition},
+	}
+	extents, err := singlePartitionDisk.Layout(diskSize)
+	if err != nil {
+		return
+	}
+
+	newPartition, err := newTablePartition(table, extents[0], partitionNumber, partition)
+	if err != nil {
+		return
+	}
+	table.Partitions = append(table.Partitions, newPartition)
+
+	err = partitiontable.WriteFile(diskDevPath, table)
+	if err != nil {
+		logger.Log.Warnf("Failed to write partition table: %v", err)
+		return
+	}
+
+	return InitializeSinglePartition(diskDevPath, partitionNumber)
+}
+
+// InitializeSinglePartition waits for the device node of a partition the kernel has read from the disk's partition table,
+// and returns its path. The name, type and flags of the partition are part of the partition table.
+func InitializeSinglePartition(diskDevPath string, partitionNumber int) (partDevPath string, err error) {
 	const (
-		fillToEndOption = "100%"
-		mibFmt          = "%dMiB"
+		totalAttempts = 5
+		retryDuration = time.Second
 	)
-	start := partition.Start
-	end := partition.End
 
-	fsType := partition.FsType
+	// udev may still be creating the device node after the kernel reloaded the partitions
+	err = retry.Run(func() (err error) {
+		partDevPath, err = partitionDevPath(diskDevPath, partitionNumber)
+		return
+	}, totalAttempts, retryDuration)
+	if err != nil {
+		return
+	}
+
+	logger.Log.Debugf("Initializing partition device path: %v", partDevPath)
+	return
+}
+
+// partitionDevPath finds the device node of a partition through sysfs, where every partition of a disk
+// is a subdirectory of the disk holding a "partition" file with its number.
+func partitionDevPath(diskDevPath string, partitionNumber int) (partDevPath string, err error) {
+	const (
+		sysBlockDir = "/sys/class/block"
+		devDir      = "/dev"
+	)
+
+	realDiskDevPath, err := filepath.EvalSymlinks(diskDevPath)
+	if err != nil {
+		return
+	}
+
+	partitionFiles, err := filepath.Glob(filepath.Join(sysBlockDir, filepath.Base(realDiskDevPath), "*", "partition"))
+	if err != nil {
+		return
+	}
 
-	// Currently assumes we only make primary partitions.
-	if end == 0 {
-		_, stderr, err := shell.Execute("parted", diskDevPath, "--script", "mkpart", "primary", fsType, fmt.Sprintf(mibFmt, start), fillToEndOption)
+	for _, partitionFile := range partitionFiles {
+		number, err := ioutil.ReadFile(partitionFile)
 		if err != nil {
-			logger.Log.Warnf("Failed to create partition using parted: %v", stderr)
 			return "", err
 		}
-	} else {
-		_, stderr, err := shell.Execute("parted", diskDevPath, "--script", "mkpart", "primary", fsType, fmt.Sprintf(mibFmt, start), fmt.Sprintf(mibFmt, end))
-		if err != nil {
-			logger.Log.Warnf("Failed to create partition using parted: %v", stderr)
-			return "", err
+
+		if strings.TrimSpace(string(number)) == strconv.Itoa(partitionNumber) {
+			partDevPath = filepath.Join(devDir, filepath.Base(filepath.Dir(partitionFile)))
+			_, err = os.Stat(partDevPath)
+			return partDevPath, err
 		}
 	}
 
-	return InitializeSinglePartition(diskDevPath, partitionNumber, partitionTableType, partition)
+	err = fmt.Errorf("partition %d of (%s) not found", partitionNumber, diskDevPath)
+	return
 }
 
-// InitializeSinglePartition initializes a single partition based on the given partition configuration
-func InitializeSinglePartition(diskDevPath string, partitionNumber int, partitionTableType string, partition configuration.Partition) (partDevPath string, err error) {
-	partitionNumberStr := strconv.Itoa(partitionNumber)
+// NewPartitionTable lays out the partitions of the disk configuration on a disk of diskSize bytes, giving the disk
+// and every GPT partition a random GUID. See configuration.Disk.Layout for where the partitions are placed.
+func NewPartitionTable(disk configuration.Disk, diskSize uint64) (table *partitiontable.Table, err error) {
+	extents, err := disk.Layout(diskSize)
+	if err != nil {
+		return
+	}
 
-	// Detect whether disk dev path is /dev/sdN<y> style or /dev/loopNp<x> style
-	if strings.HasPrefix(diskDevPath, "/dev/sd") {
-		partDevPath = diskDevPath + partitionNumberStr
-	} else {
-		partDevPath = diskDevPath + "p" + partitionNumberStr
+	table, err = newEmptyPartitionTable(disk.PartitionTableType)
+	if err != nil {
+		return
 	}
-	logger.Log.Debugf("Initializing partition device path: %v", partDevPath)
 
-	// Set partition friendly name (only for gpt)
-	if partitionTableType == "gpt" {
-		partitionName := partition.Name
-		_, stderr, err := shell.Execute("parted", diskDevPath, "--script", "name", partitionNumberStr, partitionName)
+	for idx, partitionConfig := range disk.Partitions {
+		partition, err := newTablePartition(table, extents[idx], idx+1, partitionConfig)
 		if err != nil {
-			logger.Log.Warnf("Failed to set partition friendly name using parted: %v", stderr)
-			// Not-fatal
+			return nil, err
 		}
+		table.Partitions = append(table.Partitions, partition)
 	}
 
-	// Set partition flags if necessary
-	for _, flag := range partition.Flags {
-		args := []string{diskDevPath, "--script", "set", partitionNumberStr}
-		var flagToSet string
+	return
+}
+
+// newEmptyPartitionTable returns a partition table of the given type without partitions, with a random disk GUID or signature.
+func newEmptyPartitionTable(partitionTableType configuration.PartitionTableType) (table *partitiontable.Table, err error) {
+	table = &partitiontable.Table{}
+
+	switch partitionTableType {
+	case configuration.PartitionTableTypeGpt:
+		table.Type = partitiontable.TableTypeGPT
+		table.DiskGUID, err = partitiontable.NewGUID()
+	case configuration.PartitionTableTypeMbr:
+		table.Type = partitiontable.TableTypeMBR
+		var signature [4]byte
+		_, err = rand.Read(signature[:])
+		table.DiskSignature = binary.LittleEndian.Uint32(signature[:])
+	default:
+		err = fmt.Errorf("unsupported partition table type (%s)", partitionTableType)
+	}
+
+	return
+}
+
+// newTablePartition converts a partition config placed at extent to a partition table entry. The partition's flags pick
+// its type, unless it has a TypeUUID. Swap partitions default to the swap type.
+func newTablePartition(table *partitiontable.Table, extent configuration.PartitionExtent, partitionNumber int, partitionConfig configuration.Partition) (partition *partitiontable.Partition, err error) {
+	partition = &partitiontable.Partition{
+		Start:   extent.Start,
+		Size:    extent.Size,
+		Type:    partitiontable.TypeLinuxFilesystem,
+		Name:    partitionConfig.Name,
+		MBRType: partitiontable.MBRTypeLinux,
+	}
+
+	if partitionConfig.FsType == "swap" {
+		partition.Type = partitiontable.TypeLinuxSwap
+		partition.MBRType = partitiontable.MBRTypeLinuxSwap
+	}
+
+	for _, flag := range partitionConfig.Flags {
 		switch flag {
 		case "esp":
-			flagToSet = "esp"
+			partition.Type = partitiontable.TypeEFISystem
+			partition.MBRType = partitiontable.MBRTypeEFISystem
 		case "grub", "bios-grub":
-			flagToSet = "bios_grub"
+			partition.Type = partitiontable.TypeBIOSBoot
 		case "boot":
-			flagToSet = "boot"
+			// Matches parted, where "boot" marks the ESP on a GPT disk and the active partition on an MBR disk
+			if table.Type == partitiontable.TableTypeGPT {
+				partition.Type = partitiontable.TypeEFISystem
+			} else {
+				partition.Bootable = true
+			}
 		default:
-			return partDevPath, fmt.Errorf("Partition %v - Unknown partition flag: %v", partitionNumber, flag)
+			return nil, fmt.Errorf("partition %v - Unknown partition flag: %v", partitionNumber, flag)
 		}
+	}
 
-		args = append(args, flagToSet, "on")
-		_, stderr, err := shell.Execute("parted", args...)
+	if partitionConfig.TypeUUID != "" {
+		gptType, mbrType, err := partitionConfig.PartitionType()
 		if err != nil {
-			logger.Log.Warnf("Failed to set flag (%s) using parted: %v", flagToSet, stderr)
+			return nil, fmt.Errorf("partition %v - %w", partitionNumber, err)
+		}
+		if table.Type == partitiontable.TableTypeMBR && mbrType == 0 {
+			return nil, fmt.Errorf("partition %v - Type (%s) has no MBR equivalent", partitionNumber, partitionConfig.TypeUUID)
 		}
+		partition.Type = gptType
+		partition.MBRType = mbrType
+	}
+
+	if table.Type == partitiontable.TableTypeGPT {
+		partition.Attributes, err = partitionConfig.AttributeBits()
+		if err != nil {
+			return nil, fmt.Errorf("partition %v - %w", partitionNumber, err)
+		}
+		partition.GUID, err = partitiontable.NewGUID()
+	} else if len(partitionConfig.Attributes) != 0 {
+		err = fmt.Errorf("partition %v - Attributes are only supported on GPT disks", partitionNumber)
 	}
 
 	return
 }
 
-// FormatSinglePartition formats the given partition to the type specified in the partition configuration
+// FormatSinglePartition formats the given partition to the type specified in the partition configuration,
+// passing mkfs the partition's MkfsOptions. The subvolumes of a btrfs partition are created once it is formatted.
 func FormatSinglePartition(partDevPath string, partition configuration.Partition) (fsType string, err error) {
 	const (
 		totalAttempts = 5
@@ -362,6 +439,11 @@ func FormatSinglePartition(partDevPath string, partition configuration.Partition
 
 	fsType = partition.FsType
 
+	var (
+		mkfsCommand = "mkfs"
+		mkfsArgs    []string
+	)
+
 	// Note: It is possible for the format partition command to fail with error "The file does not exist and no size was specified".
 	// This is due to a possible race condition in Linux/parted where the partition may not actually be ready after being newly created.
 	// To handle such cases, we can retry the command.
@@ -370,24 +452,40 @@ func FormatSinglePartition(partDevPath string, partition configuration.Partition
 		if fsType == "fat32" || fsType == "fat16" {
 			fsType = "vfat"
 		}
-		err = retry.Run(func() error {
-			_, stderr, err := shell.Execute("mkfs", "-t", fsType, partDevPath)
-			if err != nil {
-				logger.Log.Warnf("Failed to format partition using mkfs: %v", stderr)
-				return err
-			}
-
-			return err
-		}, totalAttempts, retryDuration)
-		if err != nil {
-			err = fmt.Errorf("could not format partition with type %v after %v retries", fsType, totalAttempts)
-		}
+		mkfsArgs = []string{"-t", fsType}
+	case "xfs", "btrfs":
+		// Unlike the other mkfs tools, these refuse to overwrite an existing file system unless forced
+		mkfsArgs = []string{"-t", fsType, "-f"}
+	case "swap":
+		mkfsCommand = "mkswap"
 	case "":
 		logger.Log.Debugf("No filesystem type specified. Ignoring for partition: %v", partDevPath)
+		return
 	default:
 		return fsType, fmt.Errorf("Unrecognized filesystem format: %v", fsType)
 	}
 
+	mkfsArgs = append(mkfsArgs, partition.MkfsOptions...)
+	mkfsArgs = append(mkfsArgs, partDevPath)
+
+	err = retry.Run(func() error {
+		_, stderr, err := shell.Execute(mkfsCommand, mkfsArgs...)
+		if err != nil {
+			logger.Log.Warnf("Failed to format partition using %s: %v", mkfsCommand, stderr)
+			return err
+		}
+
+		return err
+	}, totalAttempts, retryDuration)
+	if err != nil {
+		err = fmt.Errorf("could not format partition with type %v after %v retries", fsType, totalAttempts)
+		return
+	}
+
+	if len(partition.Subvolumes) != 0 {
+		err = createSubvolumes(partDevPath, partition.Subvolumes)
+	}
+
 	return
 }
 
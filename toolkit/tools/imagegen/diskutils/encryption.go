@@ -174,9 +174,9 @@ func encryptRootPartition(partDevPath string, partition configuration.Partition,
 	}
 
 	// Create the file system
-	_, stderr, err = shell.Execute("mkfs", "-t", partition.FsType, fullMappedPath)
+	_, err = FormatSinglePartition(fullMappedPath, partition)
 	if err != nil {
-		logger.Log.Warnf("Failed to mkfs for partition %v. Error: %v", partDevPath, stderr)
+		logger.Log.Warnf("Failed to mkfs for partition %v. Error: %v", partDevPath, err)
 	}
 
 	return
@@ -8,7 +8,9 @@ package diskutils
 import (
 	"fmt"
 	"path/filepath"
+	"strings"
 
+	"microsoft.com/pkggen/imagegen/configuration"
 	"microsoft.com/pkggen/internal/logger"
 	"microsoft.com/pkggen/internal/shell"
 )
@@ -48,7 +50,7 @@ func enableLVMForEncryptedRoot(devicePath string) (volumePath string, err error)
 		return
 	}
 
-	err = createLogicalVolume(fullPhysicalVolume, encryptGroupName, encryptVolName)
+	err = createLogicalVolume("--extents", fullPhysicalVolume, encryptGroupName, encryptVolName)
 	if err != nil {
 		return
 	}
@@ -70,8 +72,92 @@ func createPhysicalVolume(devicePath string) (err error) {
 	return
 }
 
-func createVolumeGroup(groupName, devicePath string) (err error) {
-	_, stderr, err := shell.Execute("vgcreate", "-qy", groupName, devicePath)
+// createVolumeGroups creates the disk's volume groups on their partitions, then creates and formats their logical volumes.
+// The device path and file system type of each logical volume are added to partDevPathMap and partIDToFsTypeMap.
+// - partDevPathMap is a map of partition IDs to partition device paths, holding every physical volume
+// - partIDToFsTypeMap is a map of partition IDs to filesystem type
+func createVolumeGroups(disk configuration.Disk, partDevPathMap, partIDToFsTypeMap map[string]string) (err error) {
+	for _, volumeGroup := range disk.VolumeGroups {
+		var devicePaths []string
+		for _, partitionID := range volumeGroup.PhysicalVolumes {
+			devicePath := partDevPathMap[partitionID]
+			err = createPhysicalVolume(devicePath)
+			if err != nil {
+				return
+			}
+			devicePaths = append(devicePaths, devicePath)
+		}
+
+		err = createVolumeGroup(volumeGroup.Name, devicePaths...)
+		if err != nil {
+			return
+		}
+
+		// A growing logical volume takes what is left of the volume group, so it is created last
+		var logicalVolumes, growingVolumes []configuration.LogicalVolume
+		for _, logicalVolume := range volumeGroup.LogicalVolumes {
+			if logicalVolume.Size == configuration.PartitionSizeGrow {
+				growingVolumes = append(growingVolumes, logicalVolume)
+			} else {
+				logicalVolumes = append(logicalVolumes, logicalVolume)
+			}
+		}
+
+		for _, logicalVolume := range append(logicalVolumes, growingVolumes...) {
+			var sizeOption, size string
+			sizeOption, size, err = logicalVolume.LVMSize()
+			if err != nil {
+				return
+			}
+
+			err = createLogicalVolume(sizeOption, size, volumeGroup.Name, logicalVolume.Name)
+			if err != nil {
+				return
+			}
+
+			devicePath := logicalVolumeMapping(volumeGroup.Name, logicalVolume.Name)
+
+			var fsType string
+			fsType, err = FormatSinglePartition(devicePath, logicalVolume.AsPartition())
+			if err != nil {
+				logger.Log.Warnf("Failed to format logical volume (%s)", logicalVolume.ID)
+				return
+			}
+
+			partDevPathMap[logicalVolume.ID] = devicePath
+			partIDToFsTypeMap[logicalVolume.ID] = fsType
+		}
+
+		logger.Log.Infof("Created volume group (%s) with %d logical volumes", volumeGroup.Name, len(volumeGroup.LogicalVolumes))
+	}
+
+	return
+}
+
+// DeactivateVolumeGroups deactivates the disk's volume groups, so the partitions they are made of can be released.
+func DeactivateVolumeGroups(disk configuration.Disk) (err error) {
+	for _, volumeGroup := range disk.VolumeGroups {
+		err = deactivateVolumeGroup(volumeGroup.Name)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// logicalVolumeMapping returns the device mapping path of a logical volume. Device mapper names join the
+// volume group and logical volume names with a dash, doubling the dashes found in either name.
+func logicalVolumeMapping(groupName, volumeName string) string {
+	escape := func(name string) string {
+		return strings.ReplaceAll(name, "-", "--")
+	}
+	return filepath.Join(mappingFilePath, fmt.Sprintf("%s-%s", escape(groupName), escape(volumeName)))
+}
+
+func createVolumeGroup(groupName string, devicePaths ...string) (err error) {
+	vgCreateArgs := append([]string{"-qy", groupName}, devicePaths...)
+	_, stderr, err := shell.Execute("vgcreate", vgCreateArgs...)
 	if err != nil {
 		logger.Log.Warnf("Unable to create volume group %v: %v", groupName, stderr)
 		return
@@ -80,10 +166,10 @@ func createVolumeGroup(groupName, devicePath string) (err error) {
 	return
 }
 
-func createLogicalVolume(extents, groupName, volumeName string) (err error) {
+func createLogicalVolume(sizeOption, size, groupName, volumeName string) (err error) {
 	lvCreateArgs := []string{
-		"--extents",
-		extents,
+		sizeOption,
+		size,
 		groupName,
 		"-n",
 		volumeName,
@@ -98,9 +184,13 @@ func createLogicalVolume(extents, groupName, volumeName string) (err error) {
 }
 
 func deactivateLVM() (err error) {
-	_, stderr, err := shell.Execute("vgchange", "-a", "n", encryptGroupName)
+	return deactivateVolumeGroup(encryptGroupName)
+}
+
+func deactivateVolumeGroup(groupName string) (err error) {
+	_, stderr, err := shell.Execute("vgchange", "-a", "n", groupName)
 	if err != nil {
-		logger.Log.Warnf("Unable to deactivate volume group: %v", stderr)
+		logger.Log.Warnf("Unable to deactivate volume group %v: %v", groupName, stderr)
 		return
 	}
 
@@ -0,0 +1,160 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+// Utilities to assemble partitioned disk images from files, without loop devices or mounts
+
+package diskutils
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"microsoft.com/pkggen/imagegen/configuration"
+	"microsoft.com/pkggen/internal/logger"
+	"microsoft.com/pkggen/internal/partitiontable"
+	"microsoft.com/pkggen/internal/shell"
+)
+
+// CreateSparseDisk creates an empty disk image of disk.MaxSize MiB in workDirPath, without allocating its blocks.
+func CreateSparseDisk(workDirPath, diskName string, disk configuration.Disk) (diskFilePath string, err error) {
+	diskFilePath = filepath.Join(workDirPath, diskName)
+	err = createSparseFile(diskFilePath, disk.MaxSize*MiB)
+	return
+}
+
+// NewFilesystemUUID returns a random UUID in the format blkid reports for the filesystem type.
+// FAT filesystems use an 8 digit volume ID, e.g. "1A2B-3C4D", everything else an RFC 4122 UUID.
+func NewFilesystemUUID(fsType string) (uuid string, err error) {
+	switch fsType {
+	case "fat32", "fat16", "vfat":
+		var volumeID [4]byte
+		_, err = rand.Read(volumeID[:])
+		uuid = fmt.Sprintf("%02X%02X-%02X%02X", volumeID[0], volumeID[1], volumeID[2], volumeID[3])
+	default:
+		var guid partitiontable.GUID
+		guid, err = partitiontable.NewGUID()
+		uuid = guid.String()
+	}
+	return
+}
+
+// CreateFilesystemImage creates a file of size bytes holding a filesystem of fsType with the given UUID (see NewFilesystemUUID).
+// If sourceDir is set the filesystem is populated with its contents, ext filesystems keep ownership and permissions.
+// Requires mkfs.ext2/3/4 with "-d" support for ext filesystems and mkfs.vfat and mcopy for FAT filesystems.
+func CreateFilesystemImage(imagePath string, size uint64, fsType, uuid, sourceDir string) (err error) {
+	err = createSparseFile(imagePath, size)
+	if err != nil {
+		return
+	}
+
+	var stderr string
+
+	switch fsType {
+	case "ext2", "ext3", "ext4":
+		args := []string{"-F", "-q", "-U", uuid}
+		if sourceDir != "" {
+			args = append(args, "-d", sourceDir)
+		}
+		args = append(args, imagePath)
+
+		_, stderr, err = shell.Execute("mkfs."+fsType, args...)
+		if err != nil {
+			logger.Log.Warnf("Failed to create filesystem image using mkfs.%s: %v", fsType, stderr)
+			return
+		}
+	case "fat32", "fat16", "vfat":
+		volumeID := uuid[0:4] + uuid[5:9]
+		_, stderr, err = shell.Execute("mkfs.vfat", "-i", volumeID, imagePath)
+		if err != nil {
+			logger.Log.Warnf("Failed to create filesystem image using mkfs.vfat: %v", stderr)
+			return
+		}
+
+		if sourceDir != "" {
+			err = copyToFatImage(imagePath, sourceDir)
+		}
+	default:
+		err = fmt.Errorf("unsupported filesystem type for a filesystem image: %v", fsType)
+	}
+
+	return
+}
+
+// copyToFatImage recursively copies the contents of sourceDir into the root of a FAT filesystem image using mtools.
+func copyToFatImage(imagePath, sourceDir string) (err error) {
+	entries, err := ioutil.ReadDir(sourceDir)
+	if err != nil || len(entries) == 0 {
+		return
+	}
+
+	// Recursive, preserve attributes, quit on the first error
+	args := []string{"-s", "-p", "-Q", "-i", imagePath}
+	for _, entry := range entries {
+		args = append(args, filepath.Join(sourceDir, entry.Name()))
+	}
+	args = append(args, "::/")
+
+	_, stderr, err := shell.Execute("mcopy", args...)
+	if err != nil {
+		logger.Log.Warnf("Failed to copy files into FAT image using mcopy: %v", stderr)
+	}
+	return
+}
+
+// WritePartitionImage copies a filesystem image into the disk image at the given offset.
+// All-zero blocks are skipped so a sparse disk image stays sparse.
+func WritePartitionImage(diskPath, imagePath string, offset uint64) (err error) {
+	const blockSize = MiB
+
+	image, err := os.Open(imagePath)
+	if err != nil {
+		return
+	}
+	defer image.Close()
+
+	disk, err := os.OpenFile(diskPath, os.O_WRONLY, 0)
+	if err != nil {
+		return
+	}
+	defer disk.Close()
+
+	buffer := make([]byte, blockSize)
+	zeroes := make([]byte, blockSize)
+	position := int64(offset)
+	for {
+		bytesRead, readErr := io.ReadFull(image, buffer)
+		if bytesRead > 0 && !bytes.Equal(buffer[:bytesRead], zeroes[:bytesRead]) {
+			_, err = disk.WriteAt(buffer[:bytesRead], position)
+			if err != nil {
+				return
+			}
+		}
+		position += int64(bytesRead)
+
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+
+	return
+}
+
+// createSparseFile creates a file of size bytes without allocating its blocks, replacing any existing file.
+func createSparseFile(path string, size uint64) (err error) {
+	newFile, err := os.Create(path)
+	if err != nil {
+		return
+	}
+	defer newFile.Close()
+
+	err = newFile.Truncate(int64(size))
+	return
+}
@@ -29,6 +29,7 @@ import (
 const (
 	rootMountPoint = "/"
 	rootUser       = "root"
+	swapFsType     = "swap"
 
 	// /boot directory should be only accesible by root. The directories need the execute bit as well.
 	bootDirectoryFileMode = 0600
@@ -49,6 +50,7 @@ type PackageList struct {
 // - mountPointDevPathMap is a map of mountpoint to partition device path
 // - mountPointToFsTypeMap is a map of mountpoint to filesystem type
 // - mountPointToMountArgsMap is a map of mountpoint to mount arguments to be passed on a call to mount
+// A btrfs subvolume is selected by the "subvol" mount argument, so it is both mounted and written to fstab.
 func CreateMountPointPartitionMap(partDevPathMap, partIDToFsTypeMap map[string]string, config configuration.SystemConfig) (mountPointDevPathMap, mountPointToFsTypeMap, mountPointToMountArgsMap map[string]string) {
 	mountPointDevPathMap = make(map[string]string)
 	mountPointToFsTypeMap = make(map[string]string)
@@ -61,13 +63,39 @@ func CreateMountPointPartitionMap(partDevPathMap, partIDToFsTypeMap map[string]s
 		if ok {
 			mountPointDevPathMap[partitionSetting.MountPoint] = partDevPath
 			mountPointToFsTypeMap[partitionSetting.MountPoint] = partIDToFsTypeMap[partitionSetting.ID]
-			mountPointToMountArgsMap[partitionSetting.MountPoint] = partitionSetting.MountOptions
+			mountPointToMountArgsMap[partitionSetting.MountPoint] = subvolumeMountArgs(partitionSetting.Subvolume, partitionSetting.MountOptions)
 		}
 		logger.Log.Tracef("%v", mountPointDevPathMap)
 	}
 	return
 }
 
+// subvolumeMountArgs adds the option mounting subvolume to mountArgs, if there is a subvolume.
+func subvolumeMountArgs(subvolume, mountArgs string) string {
+	const subvolumeOption = "subvol="
+
+	if subvolume == "" {
+		return mountArgs
+	}
+	if mountArgs == "" {
+		return subvolumeOption + subvolume
+	}
+	return fmt.Sprintf("%s%s,%s", subvolumeOption, subvolume, mountArgs)
+}
+
+// SwapDevicePaths returns the device path of every partition formatted as swap, sorted.
+// - partDevPathMap is a map of partition IDs to partition device paths
+// - partIDToFsTypeMap is a map of partition IDs to filesystem type
+func SwapDevicePaths(partDevPathMap, partIDToFsTypeMap map[string]string) (swapDevPaths []string) {
+	for partID, fsType := range partIDToFsTypeMap {
+		if fsType == swapFsType {
+			swapDevPaths = append(swapDevPaths, partDevPathMap[partID])
+		}
+	}
+	sort.Strings(swapDevPaths)
+	return
+}
+
 // CreateInstallRoot walks through the map of mountpoints and mounts the partitions into installroot
 // - installRoot is the destination path to mount these partitions
 // - mountPointMap is the map of mountpoint to partition device path
@@ -252,12 +280,13 @@ func PackageNamesFromConfig(config configuration.Config) (packageList []*pkgjson
 // - installChroot is a pointer to the install Chroot object
 // - packagesToInstall is a slice of packages to install
 // - config is the systemconfig field from the config file
-// - installMap is a map of mountpoints to physical device paths
+// - installMap is a map of mountpoints to physical device paths, or to "UUID=<uuid>" for filesystems created offline
 // - mountPointToFsTypeMap is a map of mountpoints to filesystem type
 // - mountPointToMountArgsMap is a map of mountpoints to mount options
+// - swapDevPaths are the device paths of swap partitions, or "UUID=<uuid>" for swap space created offline
 // - isRootFS specifies if the installroot is either backed by a directory (rootfs) or a raw disk
 // - encryptedRoot stores information about the encrypted root device if root encryption is enabled
-func PopulateInstallRoot(installChroot *safechroot.Chroot, packagesToInstall []string, config configuration.SystemConfig, installMap, mountPointToFsTypeMap, mountPointToMountArgsMap map[string]string, isRootFS bool, encryptedRoot diskutils.EncryptedRootDevice) (err error) {
+func PopulateInstallRoot(installChroot *safechroot.Chroot, packagesToInstall []string, config configuration.SystemConfig, installMap, mountPointToFsTypeMap, mountPointToMountArgsMap map[string]string, swapDevPaths []string, isRootFS bool, encryptedRoot diskutils.EncryptedRootDevice) (err error) {
 	const (
 		filesystemPkg = "filesystem"
 	)
@@ -315,7 +344,7 @@ func PopulateInstallRoot(installChroot *safechroot.Chroot, packagesToInstall []s
 
 	if !isRootFS {
 		// Configure system files
-		err = configureSystemFiles(installChroot, hostname, installMap, mountPointToFsTypeMap, mountPointToMountArgsMap, encryptedRoot)
+		err = configureSystemFiles(installChroot, hostname, installMap, mountPointToFsTypeMap, mountPointToMountArgsMap, swapDevPaths, encryptedRoot)
 		if err != nil {
 			return
 		}
@@ -413,7 +442,7 @@ func initializeTdnfConfiguration(installRoot string) (err error) {
 	return
 }
 
-func configureSystemFiles(installChroot *safechroot.Chroot, hostname string, installMap, mountPointToFsTypeMap, mountPointToMountArgsMap map[string]string, encryptedRoot diskutils.EncryptedRootDevice) (err error) {
+func configureSystemFiles(installChroot *safechroot.Chroot, hostname string, installMap, mountPointToFsTypeMap, mountPointToMountArgsMap map[string]string, swapDevPaths []string, encryptedRoot diskutils.EncryptedRootDevice) (err error) {
 	// Update hosts file
 	err = updateHosts(installChroot.RootDir(), hostname)
 	if err != nil {
@@ -421,7 +450,7 @@ func configureSystemFiles(installChroot *safechroot.Chroot, hostname string, ins
 	}
 
 	// Update fstab
-	err = updateFstab(installChroot.RootDir(), installMap, mountPointToFsTypeMap, mountPointToMountArgsMap)
+	err = updateFstab(installChroot.RootDir(), installMap, mountPointToFsTypeMap, mountPointToMountArgsMap, swapDevPaths)
 	if err != nil {
 		return
 	}
@@ -521,12 +550,36 @@ func addMachineID(installChroot *safechroot.Chroot) (err error) {
 }
 
 func updateInitramfsForEncrypt(installChroot *safechroot.Chroot) (err error) {
+	const (
+		dracutModules = "dm crypt crypt-gpg crypt-loop lvm"
+		cryptTabPath  = "/etc/crypttab"
+	)
+
+	// Construct list of files to install in initramfs
+	installFiles := fmt.Sprintf("%v %v", cryptTabPath, diskutils.DefaultKeyFilePath)
+
+	return regenerateInitramfs(installChroot, dracutModules, installFiles)
+}
+
+// UpdateInitramfsForLVM regenerates the initramfs with the dracut modules activating logical volumes,
+// so a root file system on a logical volume can be mounted at boot.
+// - installChroot is the installation chroot
+func UpdateInitramfsForLVM(installChroot *safechroot.Chroot) (err error) {
+	const (
+		dracutModules  = "dm lvm"
+		noInstallFiles = ""
+	)
+
+	return regenerateInitramfs(installChroot, dracutModules, noInstallFiles)
+}
+
+// regenerateInitramfs regenerates the image's only initramfs with dracutModules added, and the files in
+// installFiles (space separated) copied into it.
+func regenerateInitramfs(installChroot *safechroot.Chroot, dracutModules, installFiles string) (err error) {
 	err = installChroot.UnsafeRun(func() (err error) {
 		const (
-			libModDir     = "/lib/modules"
-			dracutModules = "dm crypt crypt-gpg crypt-loop lvm"
-			initrdPrefix  = "/boot/initrd.img-"
-			cryptTabPath  = "/etc/crypttab"
+			libModDir    = "/lib/modules"
+			initrdPrefix = "/boot/initrd.img-"
 		)
 
 		initrdPattern := fmt.Sprintf("%v%v", initrdPrefix, "*")
@@ -549,9 +602,6 @@ func updateInitramfsForEncrypt(installChroot *safechroot.Chroot) (err error) {
 		// Get the kernel version
 		kernel := strings.TrimPrefix(initrdImage, initrdPrefix)
 
-		// Construct list of files to install in initramfs
-		installFiles := fmt.Sprintf("%v %v", cryptTabPath, diskutils.DefaultKeyFilePath)
-
 		// Regenerate initramfs via Dracut
 		dracutArgs := []string{
 			"-f",
@@ -559,9 +609,12 @@ func updateInitramfsForEncrypt(installChroot *safechroot.Chroot) (err error) {
 			"--fstab",
 			"--kmoddir", filepath.Join(libModDir, kernel),
 			"--add", dracutModules,
-			"-I", installFiles,
-			initrdImage, kernel,
 		}
+		if installFiles != "" {
+			dracutArgs = append(dracutArgs, "-I", installFiles)
+		}
+		dracutArgs = append(dracutArgs, initrdImage, kernel)
+
 		_, stderr, err := shell.Execute("dracut", dracutArgs...)
 
 		if err != nil {
@@ -575,7 +628,12 @@ func updateInitramfsForEncrypt(installChroot *safechroot.Chroot) (err error) {
 	return
 }
 
-func updateFstab(installRoot string, installMap, mountPointToFsTypeMap, mountPointToMountArgsMap map[string]string) (err error) {
+func updateFstab(installRoot string, installMap, mountPointToFsTypeMap, mountPointToMountArgsMap map[string]string, swapDevPaths []string) (err error) {
+	const (
+		swapMountPoint = "none"
+		noMountArgs    = ""
+	)
+
 	ReportAction("Configuring fstab")
 
 	for mountPoint, devicePath := range installMap {
@@ -586,6 +644,13 @@ func updateFstab(installRoot string, installMap, mountPointToFsTypeMap, mountPoi
 			}
 		}
 	}
+
+	for _, devicePath := range swapDevPaths {
+		err = addEntryToFstab(installRoot, swapMountPoint, devicePath, swapFsType, noMountArgs)
+		if err != nil {
+			return
+		}
+	}
 	return
 }
 
@@ -615,6 +680,9 @@ func addEntryToFstab(installRoot, mountPoint, devicePath, fsType, mountArgs stri
 	var device string
 	if diskutils.IsEncryptedDevice(devicePath) {
 		device = devicePath
+	} else if strings.HasPrefix(devicePath, uuidPrefix) {
+		// Filesystems created offline have no block device to query yet, their UUID is already known
+		device = devicePath
 	} else {
 		uuid, err := GetUUID(devicePath)
 		if err != nil {
@@ -625,9 +693,13 @@ func addEntryToFstab(installRoot, mountPoint, devicePath, fsType, mountArgs stri
 		device = fmt.Sprintf("%v%v", uuidPrefix, uuid)
 	}
 
-	// Note: Rootfs should always have a pass number of 1. All other mountpoints are either 0 or 2
+	// Note: Rootfs should always have a pass number of 1. All other mountpoints are either 0 or 2.
+	// Swap space has nothing to check, and the fsck of xfs and btrfs does nothing at boot.
 	pass := defaultPass
-	if mountPoint == rootfsMountPoint {
+	switch {
+	case fsType == swapFsType || fsType == "xfs" || fsType == "btrfs":
+		pass = disablePass
+	case mountPoint == rootfsMountPoint:
 		pass = rootPass
 	}
 
@@ -684,11 +756,13 @@ func addEntryToCrypttab(installRoot string, devicePath string, encryptedRoot dis
 // - installRoot is the base install directory
 // - rootDevice holds the root partition
 // - bootUUID is the UUID for the boot partition
+// - rootSubvolume is the btrfs subvolume mounted as the root, if any
+// - rootLogicalVolume is the "<volume group>/<logical volume>" holding the root, if the root is on a logical volume
 // - encryptedRoot holds the encrypted root information if encrypted root is enabled
 // - kernelCommandLine contains additional kernel parameters which may be optionally set
 // Note: this boot partition could be different than the boot partition specified in the bootloader.
 // This boot partition specifically indicates where to find the kernel, config files, and initrd
-func InstallGrubCfg(installRoot, rootDevice, bootUUID string, encryptedRoot diskutils.EncryptedRootDevice, kernelCommandLine configuration.KernelCommandLine) (err error) {
+func InstallGrubCfg(installRoot, rootDevice, bootUUID, rootSubvolume, rootLogicalVolume string, encryptedRoot diskutils.EncryptedRootDevice, kernelCommandLine configuration.KernelCommandLine) (err error) {
 	const (
 		assetGrubcfgFile = "/installer/grub2/grub.cfg"
 		grubCfgFile      = "boot/grub2/grub.cfg"
@@ -715,6 +789,13 @@ func InstallGrubCfg(installRoot, rootDevice, bootUUID string, encryptedRoot disk
 		return
 	}
 
+	// Add in the root subvolume, which grub reads /boot through and the kernel mounts
+	err = setGrubCfgRootSubvolume(installGrubCfgFile, rootSubvolume)
+	if err != nil {
+		logger.Log.Warnf("Failed to set the root subvolume in grub.cfg: %v", err)
+		return
+	}
+
 	// Add in rootLuksUUID
 	err = setGrubCfgLuksUUID(installGrubCfgFile, encryptedRoot.LuksUUID)
 	if err != nil {
@@ -723,7 +804,7 @@ func InstallGrubCfg(installRoot, rootDevice, bootUUID string, encryptedRoot disk
 	}
 
 	// Add in logical volumes to active
-	err = setGrubCfgLVM(installGrubCfgFile, encryptedRoot.LuksUUID)
+	err = setGrubCfgLVM(installGrubCfgFile, rootLogicalVolume, encryptedRoot.LuksUUID)
 	if err != nil {
 		logger.Log.Warnf("Failed to set lvm.lv in grub.cfg: %v", err)
 		return
@@ -1114,9 +1195,10 @@ func getPackagesFromJSON(file string) (pkgList PackageList, err error) {
 // - installChroot is a pointer to the install Chroot object
 // - bootType indicates the type of boot loader to add.
 // - bootUUID is the UUID of the boot partition
+// - rootSubvolume is the btrfs subvolume mounted as the root, if any, through which the main grub cfg is found
 // Note: this boot partition could be different than the boot partition specified in the main grub config.
 // This boot partition specifically indicates where to find the main grub cfg
-func InstallBootloader(installChroot *safechroot.Chroot, encryptEnabled bool, bootType, bootUUID, bootDevPath string) (err error) {
+func InstallBootloader(installChroot *safechroot.Chroot, encryptEnabled bool, bootType, bootUUID, rootSubvolume, bootDevPath string) (err error) {
 	const (
 		efiMountPoint  = "/boot/efi"
 		efiBootType    = "efi"
@@ -1134,7 +1216,7 @@ func InstallBootloader(installChroot *safechroot.Chroot, encryptEnabled bool, bo
 		}
 	case efiBootType:
 		efiPath := filepath.Join(installChroot.RootDir(), efiMountPoint)
-		err = installEfiBootloader(encryptEnabled, efiPath, bootUUID)
+		err = installEfiBootloader(encryptEnabled, efiPath, bootUUID, rootSubvolume)
 		if err != nil {
 			return
 		}
@@ -1221,7 +1303,7 @@ func GetPartUUID(device string) (stdout string, err error) {
 // installRoot/boot/efi folder
 // It is expected that shim (bootx64.efi) and grub2 (grub2.efi) are installed
 // into the EFI directory via the package list installation mechanism.
-func installEfiBootloader(encryptEnabled bool, installRoot, bootUUID string) (err error) {
+func installEfiBootloader(encryptEnabled bool, installRoot, bootUUID, rootSubvolume string) (err error) {
 	const (
 		defaultCfgFilename = "grub.cfg"
 		encryptCfgFilename = "grubEncrypt.cfg"
@@ -1250,6 +1332,13 @@ func installEfiBootloader(encryptEnabled bool, installRoot, bootUUID string) (er
 		return
 	}
 
+	// Add in the path of the root subvolume
+	err = setGrubCfgBootPrefix(grubFinalPath, rootSubvolume)
+	if err != nil {
+		logger.Log.Warnf("Failed to set the boot prefix in grub.cfg: %v", err)
+		return
+	}
+
 	// Add in encrypted volume
 	if encryptEnabled {
 		err = setGrubCfgEncryptedVolume(grubFinalPath)
@@ -1355,7 +1444,9 @@ func setGrubCfgIMA(grubPath string, kernelCommandline configuration.KernelComman
 	return
 }
 
-func setGrubCfgLVM(grubPath, luksUUID string) (err error) {
+// setGrubCfgLVM sets the logical volume dracut activates to mount the root, which is either rootLogicalVolume
+// or, for an encrypted root, the encrypted root volume.
+func setGrubCfgLVM(grubPath, rootLogicalVolume, luksUUID string) (err error) {
 	const (
 		lvmPrefix  = "rd.lvm.lv="
 		lvmPattern = "{{.LVM}}"
@@ -1365,6 +1456,8 @@ func setGrubCfgLVM(grubPath, luksUUID string) (err error) {
 	var lvm string
 	if luksUUID != "" {
 		lvm = fmt.Sprintf("%v%v", lvmPrefix, diskutils.GetEncryptedRootVolPath())
+	} else if rootLogicalVolume != "" {
+		lvm = fmt.Sprintf("%v%v", lvmPrefix, rootLogicalVolume)
 	}
 
 	logger.Log.Debugf("Adding lvm('%s') to %s", lvm, grubPath)
@@ -1414,6 +1507,54 @@ func setGrubCfgBootUUID(bootUUID, grubPath string) (err error) {
 	return
 }
 
+// setGrubCfgBootPrefix sets the prefix of /boot paths in a grub config. grub reads btrfs file systems from their
+// top level, so /boot is found under the root subvolume.
+func setGrubCfgBootPrefix(grubPath, rootSubvolume string) (err error) {
+	const (
+		bootPrefixPattern = "{{.BootPrefix}}"
+	)
+	var cmdline configuration.KernelCommandLine
+
+	bootPrefix := ""
+	if rootSubvolume != "" {
+		bootPrefix = "/" + rootSubvolume
+	}
+
+	logger.Log.Debugf("Adding BootPrefix('%s') to %s", bootPrefix, grubPath)
+	err = sed(bootPrefixPattern, bootPrefix, cmdline.GetSedDelimeter(), grubPath)
+	if err != nil {
+		logger.Log.Warnf("Failed to set grub.cfg's bootPrefix: %v", err)
+		return
+	}
+	return
+}
+
+// setGrubCfgRootSubvolume sets the /boot paths of the main grub config and tells the kernel which subvolume to mount as the root.
+func setGrubCfgRootSubvolume(grubPath, rootSubvolume string) (err error) {
+	const (
+		rootFlagsPattern = "{{.RootFlags}}"
+	)
+	var cmdline configuration.KernelCommandLine
+
+	err = setGrubCfgBootPrefix(grubPath, rootSubvolume)
+	if err != nil {
+		return
+	}
+
+	rootFlags := ""
+	if rootSubvolume != "" {
+		rootFlags = fmt.Sprintf("rootflags=subvol=%s", rootSubvolume)
+	}
+
+	logger.Log.Debugf("Adding RootFlags('%s') to %s", rootFlags, grubPath)
+	err = sed(rootFlagsPattern, rootFlags, cmdline.GetSedDelimeter(), grubPath)
+	if err != nil {
+		logger.Log.Warnf("Failed to set grub.cfg's rootFlags: %v", err)
+		return
+	}
+	return
+}
+
 func setGrubCfgEncryptedVolume(grubPath string) (err error) {
 	const (
 		encryptedVolPattern = "{{.EncryptedVolume}}"
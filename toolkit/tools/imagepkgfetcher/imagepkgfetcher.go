@@ -4,6 +4,7 @@
 package main
 
 import (
+	"fmt"
 	"os"
 	"strings"
 
@@ -13,7 +14,6 @@ import (
 	"microsoft.com/pkggen/internal/exe"
 	"microsoft.com/pkggen/internal/logger"
 	"microsoft.com/pkggen/internal/packagerepo/repocloner"
-	"microsoft.com/pkggen/internal/packagerepo/repocloner/rpmrepocloner"
 	"microsoft.com/pkggen/internal/packagerepo/repoutils"
 	"microsoft.com/pkggen/internal/pkggraph"
 	"microsoft.com/pkggen/internal/pkgjson"
@@ -34,6 +34,7 @@ var (
 	useUpdateRepo        = app.Flag("use-update-repo", "Pull packages from the upstream update repo").Bool()
 	usePreviewRepo       = app.Flag("use-preview-repo", "Pull packages from the upstream preview repo").Bool()
 	disableUpstreamRepos = app.Flag("disable-upstream-repos", "Disables pulling packages from upstream repos").Bool()
+	clonerType           = app.Flag("cloner", "Implementation used to resolve and download packages: 'tdnf' runs tdnf inside the worker chroot, 'repodata' reads the metadata of local repositories directly and does not require root").Default(repoutils.ClonerTDNF).Enum(repoutils.ClonerTypes...)
 
 	tlsClientCert = app.Flag("tls-cert", "TLS client certificate to use when downloading files.").String()
 	tlsClientKey  = app.Flag("tls-key", "TLS client key to use when downloading files.").String()
@@ -44,6 +45,9 @@ var (
 	inputSummaryFile  = app.Flag("input-summary-file", "Path to a file with the summary of packages cloned to be restored").String()
 	outputSummaryFile = app.Flag("output-summary-file", "Path to save the summary of packages cloned").String()
 
+	inputLockfile  = app.Flag("input-lockfile", "Path to a lockfile pinning the exact packages to clone, instead of resolving the config's packages").String()
+	outputLockfile = app.Flag("output-lockfile", "Path to save a lockfile pinning the exact packages cloned").String()
+
 	logFile  = exe.LogFileFlag(app)
 	logLevel = exe.LogLevelFlag(app)
 )
@@ -57,8 +61,10 @@ func main() {
 		logger.Log.Fatal("input-graph must be provided if external-only is set.")
 	}
 
-	cloner := rpmrepocloner.New()
-	err := cloner.Initialize(*outDir, *tmpDir, *workertar, *existingRpmDir, *useUpdateRepo, *usePreviewRepo, *repoFiles)
+	cloner, err := repoutils.NewCloner(*clonerType)
+	logger.PanicOnError(err)
+
+	err = cloner.Initialize(*outDir, *tmpDir, *workertar, *existingRpmDir, *useUpdateRepo, *usePreviewRepo, *repoFiles)
 	if err != nil {
 		logger.Log.Panicf("Failed to initialize RPM repo cloner. Error: %s", err)
 	}
@@ -72,10 +78,15 @@ func main() {
 		}
 	}
 
-	if strings.TrimSpace(*inputSummaryFile) != "" {
+	useLockfile := strings.TrimSpace(*inputLockfile) != ""
+	switch {
+	case useLockfile:
+		// If a lockfile was provided, clone exactly the packages it pins.
+		err = restoreLockfile(cloner, *inputLockfile, *configFile, *baseDirPath, *externalOnly, *inputGraph)
+	case strings.TrimSpace(*inputSummaryFile) != "":
 		// If an input summary file was provided, simply restore the cache using the file.
 		err = repoutils.RestoreClonedRepoContents(cloner, *inputSummaryFile)
-	} else {
+	default:
 		err = cloneSystemConfigs(cloner, *configFile, *baseDirPath, *externalOnly, *inputGraph)
 	}
 
@@ -83,27 +94,66 @@ func main() {
 		logger.Log.Panicf("Failed to clone RPM repo. Error: %s", err)
 	}
 
-	logger.Log.Info("Configuring downloaded RPMs as a local repository")
-	err = cloner.ConvertDownloadedPackagesIntoRepo()
-	if err != nil {
-		logger.Log.Panicf("Failed to convert downloaded RPMs into a repo. Error: %s", err)
+	// Restoring a lockfile already converts the packages into a repo to verify them
+	if !useLockfile {
+		logger.Log.Info("Configuring downloaded RPMs as a local repository")
+		err = cloner.ConvertDownloadedPackagesIntoRepo()
+		if err != nil {
+			logger.Log.Panicf("Failed to convert downloaded RPMs into a repo. Error: %s", err)
+		}
 	}
 
 	if strings.TrimSpace(*outputSummaryFile) != "" {
 		err = repoutils.SaveClonedRepoContents(cloner, *outputSummaryFile)
 		logger.PanicOnError(err, "Failed to save cloned repo contents")
 	}
+
+	if strings.TrimSpace(*outputLockfile) != "" {
+		err = repoutils.SaveLockfile(cloner, *outputLockfile)
+		logger.PanicOnError(err, "Failed to save cloned repo lockfile")
+	}
 }
 
 func cloneSystemConfigs(cloner repocloner.RepoCloner, configFile, baseDirPath string, externalOnly bool, inputGraph string) (err error) {
 	const cloneDeps = true
 
+	packageVersionsInConfig, err := packagesInConfig(configFile, baseDirPath, externalOnly, inputGraph)
+	if err != nil {
+		return
+	}
+
+	logger.Log.Infof("Cloning: %v", packageVersionsInConfig)
+	err = cloner.Clone(cloneDeps, packageVersionsInConfig...)
+	return
+}
+
+// restoreLockfile clones the packages pinned by a lockfile and checks it pins every package requested by the config.
+func restoreLockfile(cloner repocloner.RepoCloner, lockfilePath, configFile, baseDirPath string, externalOnly bool, inputGraph string) (err error) {
+	lockfile, err := repoutils.RestoreLockfile(cloner, lockfilePath)
+	if err != nil {
+		return
+	}
+
+	packageVersionsInConfig, err := packagesInConfig(configFile, baseDirPath, externalOnly, inputGraph)
+	if err != nil {
+		return
+	}
+
+	missing := lockfile.MissingPackages(packageVersionsInConfig)
+	if len(missing) != 0 {
+		err = fmt.Errorf("lockfile (%s) does not pin packages requested by the config, it must be regenerated: %v", lockfilePath, missing)
+	}
+	return
+}
+
+// packagesInConfig returns the packages requested by the config, optionally limited to external packages.
+func packagesInConfig(configFile, baseDirPath string, externalOnly bool, inputGraph string) (packageVersionsInConfig []*pkgjson.PackageVer, err error) {
 	cfg, err := configuration.LoadWithAbsolutePaths(configFile, baseDirPath)
 	if err != nil {
 		return
 	}
 
-	packageVersionsInConfig, err := installutils.PackageNamesFromConfig(cfg)
+	packageVersionsInConfig, err = installutils.PackageNamesFromConfig(cfg)
 	if err != nil {
 		return
 	}
@@ -113,13 +163,8 @@ func cloneSystemConfigs(cloner repocloner.RepoCloner, configFile, baseDirPath st
 
 	if externalOnly {
 		packageVersionsInConfig, err = filterExternalPackagesOnly(packageVersionsInConfig, inputGraph)
-		if err != nil {
-			return
-		}
 	}
 
-	logger.Log.Infof("Cloning: %v", packageVersionsInConfig)
-	err = cloner.Clone(cloneDeps, packageVersionsInConfig...)
 	return
 }
 
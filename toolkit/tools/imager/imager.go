@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"gopkg.in/alecthomas/kingpin.v2"
 	"microsoft.com/pkggen/imagegen/configuration"
@@ -18,6 +19,8 @@ import (
 	"microsoft.com/pkggen/internal/file"
 	"microsoft.com/pkggen/internal/logger"
 	"microsoft.com/pkggen/internal/safechroot"
+	"microsoft.com/pkggen/internal/sbom"
+	"microsoft.com/pkggen/internal/shell"
 )
 
 var (
@@ -32,8 +35,13 @@ var (
 	outputDir       = app.Flag("output-dir", "Path to directory to place final image.").ExistingDir()
 	liveInstallFlag = app.Flag("live-install", "Enable to perform a live install to the disk specified in config file.").Bool()
 	emitProgress    = app.Flag("emit-progress", "Write progress updates to stdout, such as percent complete and current action.").Bool()
-	logFile         = exe.LogFileFlag(app)
-	logLevel        = exe.LogLevelFlag(app)
+
+	legalDiskBackends = []string{loopDiskBackend, noLoopDiskBackend}
+	diskBackend       = app.Flag("disk-backend", "How disk images are built. 'loop' partitions and mounts a loop device, 'noloop' installs into a directory and assembles the disk image from files without loop devices or mounting anything (EFI boot only, no encryption). Without root, 'noloop' runs the imager as root of a user namespace using the subordinate IDs in /etc/subuid and /etc/subgid.").PlaceHolder(exe.PlaceHolderize(legalDiskBackends)).Default(loopDiskBackend).Enum(legalDiskBackends...)
+
+	sbomFormats = app.Flag("sbom-format", "Write a Software Bill of Materials listing the installed packages to the output directory in this format. May be repeated.").PlaceHolder(exe.PlaceHolderize(sbom.Formats)).Enums(sbom.Formats...)
+	logFile     = exe.LogFileFlag(app)
+	logLevel    = exe.LogLevelFlag(app)
 )
 
 const (
@@ -56,6 +64,13 @@ func main() {
 	app.Version(exe.ToolkitVersion)
 	kingpin.MustParse(app.Parse(os.Args[1:]))
 
+	// The noloop disk backend needs no root, without it the imager runs itself again as root of a user namespace.
+	// Only that imager opens the log file, so it isn't truncated once the image is being built.
+	if *diskBackend == noLoopDiskBackend {
+		logger.InitStderrLog()
+		enterUserNamespace()
+	}
+
 	logger.InitBestEffort(*logFile, *logLevel)
 
 	if *emitProgress {
@@ -90,13 +105,18 @@ func buildSystemConfig(systemConfig configuration.SystemConfig, disks []configur
 		leaveChrootOnDisk   = false
 	)
 
+	generateSBOM := len(*sbomFormats) > 0
+
 	var (
+		installedPackages  []*sbom.Package
 		isRootFS           bool
 		isLoopDevice       bool
 		isOfflineInstall   bool
 		diskDevPath        string
+		rootLogicalVolume  string
 		kernelPkg          string
 		encryptedRoot      diskutils.EncryptedRootDevice
+		noLoopDiskImage    *noLoopDisk
 		partIDToDevPathMap map[string]string
 		partIDToFsTypeMap  map[string]string
 		extraMountPoints   []*safechroot.MountPoint
@@ -121,6 +141,19 @@ func buildSystemConfig(systemConfig configuration.SystemConfig, disks []configur
 		extraDirectories = append(extraDirectories, additionalExtraDirectories...)
 		extraMountPoints = append(extraMountPoints, additionalExtraMountPoints...)
 		isOfflineInstall = true
+	} else if *diskBackend == noLoopDiskBackend {
+		logger.Log.Info("Staging the disk's contents in the setup chroot")
+		noLoopDiskImage, err = newNoLoopDisk(filepath.Join(buildDir, setupRoot, installRoot), disks[defaultDiskIndex], systemConfig, *liveInstallFlag)
+		if err != nil {
+			return
+		}
+
+		partIDToDevPathMap = noLoopDiskImage.partIDToDevPathMap()
+		partIDToFsTypeMap = noLoopDiskImage.partIDToFsType
+
+		// The disk's contents are installed straight into the setup chroot's install root, which is its staging directory
+		extraDirectories = append(extraDirectories, installRoot)
+		isOfflineInstall = true
 	} else {
 		logger.Log.Info("Creating raw disk in build directory")
 		diskConfig := disks[defaultDiskIndex]
@@ -140,6 +173,22 @@ func buildSystemConfig(systemConfig configuration.SystemConfig, disks []configur
 			defer diskutils.DetachLoopbackDevice(diskDevPath)
 		}
 
+		// Volume groups hold on to their partitions, release them before the disk is detached
+		if len(diskConfig.VolumeGroups) != 0 {
+			defer func() {
+				deactivateErr := diskutils.DeactivateVolumeGroups(diskConfig)
+				if deactivateErr != nil {
+					logger.Log.Warnf("Failed to deactivate volume groups: %s", deactivateErr)
+				}
+			}()
+		}
+
+		if rootSetting := systemConfig.RootPartitionSetting(); rootSetting != nil {
+			rootLogicalVolume = diskConfig.LogicalVolumePath(rootSetting.ID)
+		}
+	}
+
+	if !isRootFS {
 		// Select the best kernel package for this environment
 		kernelPkg, err = installutils.SelectKernelPackage(systemConfig, *liveInstallFlag)
 		if err != nil {
@@ -153,18 +202,26 @@ func buildSystemConfig(systemConfig configuration.SystemConfig, disks []configur
 
 	// Create Parition to Mountpoint map
 	mountPointMap, mountPointToFsTypeMap, mountPointToMountArgsMap := installutils.CreateMountPointPartitionMap(partIDToDevPathMap, partIDToFsTypeMap, systemConfig)
+	swapDevPaths := installutils.SwapDevicePaths(partIDToDevPathMap, partIDToFsTypeMap)
 
 	if isOfflineInstall {
 		// Create setup chroot
-		additionalExtraMountPoints := []*safechroot.MountPoint{
-			safechroot.NewMountPoint(*assets, assetsMountPoint, "", safechroot.BindMountPointFlags, ""),
-			safechroot.NewMountPoint(*localRepo, localRepoMountPoint, "", safechroot.BindMountPointFlags, ""),
-			safechroot.NewMountPoint(filepath.Dir(*repoFile), repoFileMountPoint, "", safechroot.BindMountPointFlags, ""),
+		var setupChroot *safechroot.Chroot
+		setupChrootDir := filepath.Join(buildDir, setupRoot)
+		if noLoopDiskImage != nil {
+			// The noloop backend may run without root, its setup chroot mounts nothing
+			setupChroot = safechroot.NewChrootWithoutMounts(setupChrootDir, existingChrootDir)
+		} else {
+			additionalExtraMountPoints := []*safechroot.MountPoint{
+				safechroot.NewMountPoint(*assets, assetsMountPoint, "", safechroot.BindMountPointFlags, ""),
+				safechroot.NewMountPoint(*localRepo, localRepoMountPoint, "", safechroot.BindMountPointFlags, ""),
+				safechroot.NewMountPoint(filepath.Dir(*repoFile), repoFileMountPoint, "", safechroot.BindMountPointFlags, ""),
+			}
+			extraMountPoints = append(extraMountPoints, additionalExtraMountPoints...)
+
+			setupChroot = safechroot.NewChroot(setupChrootDir, existingChrootDir)
 		}
-		extraMountPoints = append(extraMountPoints, additionalExtraMountPoints...)
 
-		setupChrootDir := filepath.Join(buildDir, setupRoot)
-		setupChroot := safechroot.NewChroot(setupChrootDir, existingChrootDir)
 		err = setupChroot.Initialize(*tdnfTar, extraDirectories, extraMountPoints)
 		if err != nil {
 			logger.Log.Error("Failed to create setup chroot")
@@ -172,6 +229,19 @@ func buildSystemConfig(systemConfig configuration.SystemConfig, disks []configur
 		}
 		defer setupChroot.Close(leaveChrootOnDisk)
 
+		// Without mounts, copy in the directories the loop backend bind-mounts
+		if noLoopDiskImage != nil {
+			err = copyDirsIntoChroot(setupChroot, []safechroot.FileToCopy{
+				{Src: *assets, Dest: assetsMountPoint},
+				{Src: *localRepo, Dest: localRepoMountPoint},
+				{Src: filepath.Dir(*repoFile), Dest: repoFileMountPoint},
+			})
+			if err != nil {
+				logger.Log.Error("Failed to copy the installer's inputs into setup chroot")
+				return
+			}
+		}
+
 		// Before entering the chroot, copy in any and all host files needed and
 		// fix up their paths to be in the tmp directory.
 		err = fixupExtraFilesIntoChroot(setupChroot, &systemConfig)
@@ -180,8 +250,9 @@ func buildSystemConfig(systemConfig configuration.SystemConfig, disks []configur
 			return
 		}
 
-		err = setupChroot.Run(func() error {
-			return buildImage(mountPointMap, mountPointToFsTypeMap, mountPointToMountArgsMap, packagesToInstall, systemConfig, diskDevPath, isRootFS, encryptedRoot)
+		err = setupChroot.Run(func() (err error) {
+			installedPackages, err = buildImage(mountPointMap, mountPointToFsTypeMap, mountPointToMountArgsMap, swapDevPaths, packagesToInstall, systemConfig, diskDevPath, rootLogicalVolume, isRootFS, encryptedRoot, noLoopDiskImage, generateSBOM)
+			return
 		})
 		if err != nil {
 			logger.Log.Error("Failed to build image")
@@ -194,6 +265,15 @@ func buildSystemConfig(systemConfig configuration.SystemConfig, disks []configur
 			return
 		}
 
+		if noLoopDiskImage != nil {
+			// The partitions only exist as filesystem images, which the partition artifacts are copied from
+			partIDToDevPathMap, err = noLoopDiskImage.assemble(buildDir, defaultTempDiskName)
+			if err != nil {
+				logger.Log.Error("Failed to assemble the disk image")
+				return
+			}
+		}
+
 		// Create any partition-based artifacts
 		err = installutils.ExtractPartitionArtifacts(outputDir, defaultDiskIndex, disks[defaultDiskIndex], partIDToDevPathMap)
 		if err != nil {
@@ -213,13 +293,21 @@ func buildSystemConfig(systemConfig configuration.SystemConfig, disks []configur
 			}
 		}
 	} else {
-		err = buildImage(mountPointMap, mountPointToFsTypeMap, mountPointToMountArgsMap, packagesToInstall, systemConfig, diskDevPath, isRootFS, encryptedRoot)
+		installedPackages, err = buildImage(mountPointMap, mountPointToFsTypeMap, mountPointToMountArgsMap, swapDevPaths, packagesToInstall, systemConfig, diskDevPath, rootLogicalVolume, isRootFS, encryptedRoot, noLoopDiskImage, generateSBOM)
 		if err != nil {
 			logger.Log.Error("Failed to build image")
 			return
 		}
 	}
 
+	if generateSBOM {
+		err = writeSBOMs(outputDir, systemConfig.Name, *sbomFormats, installedPackages)
+		if err != nil {
+			logger.Log.Error("Failed to write the image's SBOM")
+			return
+		}
+	}
+
 	// Cleanup encrypted disks
 	if systemConfig.Encryption.Enable {
 		err = diskutils.CleanupEncryptedDisks(encryptedRoot, isOfflineInstall)
@@ -403,6 +491,34 @@ func fixupExtraFilesIntoChroot(installChroot *safechroot.Chroot, config *configu
 	return
 }
 
+// copyDirsIntoChroot replaces each directory 'Dest' in the chroot with a copy of the directory 'Src',
+// so its contents are the same as if 'Src' was bind-mounted there.
+func copyDirsIntoChroot(installChroot *safechroot.Chroot, dirsToCopy []safechroot.FileToCopy) (err error) {
+	const squashErrors = false
+
+	for _, dir := range dirsToCopy {
+		dest := filepath.Join(installChroot.RootDir(), dir.Dest)
+		logger.Log.Debugf("Copying directory '%s' to '%s'", dir.Src, dest)
+
+		err = os.RemoveAll(dest)
+		if err != nil {
+			return
+		}
+
+		err = os.MkdirAll(filepath.Dir(dest), os.ModePerm)
+		if err != nil {
+			return
+		}
+
+		err = shell.ExecuteLive(squashErrors, "cp", "-r", "-L", dir.Src, dest)
+		if err != nil {
+			logger.Log.Errorf("Error copying '%s' into the chroot", dir.Src)
+			return
+		}
+	}
+	return
+}
+
 func cleanupExtraFilesInChroot(installChroot *safechroot.Chroot, config configuration.SystemConfig) (err error) {
 	dirsToRemove := []string{additionalFilesTempDirectory, postInstallScriptTempDirectory, sshPubKeysTempDirectory}
 	for _, dir := range dirsToRemove {
@@ -415,7 +531,12 @@ func cleanupExtraFilesInChroot(installChroot *safechroot.Chroot, config configur
 	return
 }
 
-func buildImage(mountPointMap, mountPointToFsTypeMap, mountPointToMountArgsMap map[string]string, packagesToInstall []string, systemConfig configuration.SystemConfig, diskDevPath string, isRootFS bool, encryptedRoot diskutils.EncryptedRootDevice) (err error) {
+// buildImage installs and configures the image's contents.
+// rootLogicalVolume is the "<volume group>/<logical volume>" holding the root file system, if any.
+// If noLoopDiskImage is set the disk's contents are installed into its staging directory, which is the install root, instead of its partitions.
+// Nothing is mounted into its install chroot.
+// If generateSBOM is set the packages installed in the image are returned.
+func buildImage(mountPointMap, mountPointToFsTypeMap, mountPointToMountArgsMap map[string]string, swapDevPaths, packagesToInstall []string, systemConfig configuration.SystemConfig, diskDevPath, rootLogicalVolume string, isRootFS bool, encryptedRoot diskutils.EncryptedRootDevice, noLoopDiskImage *noLoopDisk, generateSBOM bool) (installedPackages []*sbom.Package, err error) {
 	const (
 		installRoot       = "/installroot"
 		emptyWorkerTar    = ""
@@ -426,8 +547,10 @@ func buildImage(mountPointMap, mountPointToFsTypeMap, mountPointToMountArgsMap m
 	var installMap map[string]string
 
 	// Only invoke CreateInstallRoot for a raw disk. This call will result in mount points being created from a raw disk
-	// into the install root. A rootfs will not have these.
-	if !isRootFS {
+	// into the install root. A rootfs will not have these, and a noloop disk's filesystems don't exist yet.
+	if noLoopDiskImage != nil {
+		installMap = mountPointMap
+	} else if !isRootFS {
 		installMap, err = installutils.CreateInstallRoot(installRoot, mountPointMap, mountPointToMountArgsMap)
 		if err != nil {
 			err = fmt.Errorf("failed to create install root: %s", err)
@@ -437,7 +560,12 @@ func buildImage(mountPointMap, mountPointToFsTypeMap, mountPointToMountArgsMap m
 	}
 
 	// Create new chroot for the new image
-	installChroot := safechroot.NewChroot(installRoot, existingChrootDir)
+	var installChroot *safechroot.Chroot
+	if noLoopDiskImage != nil {
+		installChroot = safechroot.NewChrootWithoutMounts(installRoot, existingChrootDir)
+	} else {
+		installChroot = safechroot.NewChroot(installRoot, existingChrootDir)
+	}
 	extraInstallMountPoints := []*safechroot.MountPoint{}
 	extraDirectories := []string{}
 	err = installChroot.Initialize(emptyWorkerTar, extraDirectories, extraInstallMountPoints)
@@ -448,21 +576,59 @@ func buildImage(mountPointMap, mountPointToFsTypeMap, mountPointToMountArgsMap m
 	defer installChroot.Close(leaveChrootOnDisk)
 
 	// Populate image contents
-	err = installutils.PopulateInstallRoot(installChroot, packagesToInstall, systemConfig, installMap, mountPointToFsTypeMap, mountPointToMountArgsMap, isRootFS, encryptedRoot)
+	err = installutils.PopulateInstallRoot(installChroot, packagesToInstall, systemConfig, installMap, mountPointToFsTypeMap, mountPointToMountArgsMap, swapDevPaths, isRootFS, encryptedRoot)
 	if err != nil {
 		err = fmt.Errorf("failed to populate image contents: %s", err)
 		return
 	}
 
 	// Only configure the bootloader for actual disks, a rootfs does not need one
-	if !isRootFS {
-		err = configureDiskBootloader(systemConfig, installChroot, diskDevPath, installMap, encryptedRoot)
+	if noLoopDiskImage != nil {
+		err = noLoopDiskImage.configureBootloader(systemConfig, installChroot)
+		if err != nil {
+			return
+		}
+	} else if !isRootFS {
+		err = configureDiskBootloader(systemConfig, installChroot, diskDevPath, rootLogicalVolume, installMap, encryptedRoot)
+		if err != nil {
+			return
+		}
+	}
+
+	if generateSBOM {
+		installedPackages, err = sbom.QueryInstalledPackages(installRoot)
+		if err != nil {
+			err = fmt.Errorf("failed to query the packages installed in the image: %s", err)
+		}
 	}
 
 	return
 }
 
-func configureDiskBootloader(systemConfig configuration.SystemConfig, installChroot *safechroot.Chroot, diskDevPath string, installMap map[string]string, encryptedRoot diskutils.EncryptedRootDevice) (err error) {
+// writeSBOMs writes a Software Bill of Materials listing the packages installed in the image to outputDir, once for each format.
+func writeSBOMs(outputDir, imageName string, formats []string, installedPackages []*sbom.Package) (err error) {
+	document := &sbom.Document{
+		Name:        imageName,
+		ToolName:    app.Name,
+		ToolVersion: exe.ToolkitVersion,
+		Created:     time.Now(),
+		Packages:    installedPackages,
+	}
+
+	for _, format := range formats {
+		sbomFile := filepath.Join(outputDir, sbom.FileBaseName+sbom.FileSuffix(format))
+		logger.Log.Infof("Writing %s SBOM listing %d packages to (%s)", format, len(installedPackages), sbomFile)
+
+		err = sbom.WriteDocument(sbomFile, format, document)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func configureDiskBootloader(systemConfig configuration.SystemConfig, installChroot *safechroot.Chroot, diskDevPath, rootLogicalVolume string, installMap map[string]string, encryptedRoot diskutils.EncryptedRootDevice) (err error) {
 	const rootMountPoint = "/"
 
 	var rootDevice string
@@ -483,14 +649,23 @@ func configureDiskBootloader(systemConfig configuration.SystemConfig, installChr
 		}
 	}
 
-	err = installutils.InstallBootloader(installChroot, systemConfig.Encryption.Enable, bootType, bootUUID, diskDevPath)
+	// An encrypted root's initramfs already activates its logical volume
+	if rootLogicalVolume != "" && !systemConfig.Encryption.Enable {
+		err = installutils.UpdateInitramfsForLVM(installChroot)
+		if err != nil {
+			err = fmt.Errorf("failed to add LVM to the initramfs: %s", err)
+			return
+		}
+	}
+
+	err = installutils.InstallBootloader(installChroot, systemConfig.Encryption.Enable, bootType, bootUUID, systemConfig.RootSubvolume(), diskDevPath)
 	if err != nil {
 		err = fmt.Errorf("failed to install bootloader: %s", err)
 		return
 	}
 
-	// Add grub config to image
-	if systemConfig.Encryption.Enable {
+	// Add grub config to image. Logical volumes have no PARTUUID, they are found by their device mapper path.
+	if systemConfig.Encryption.Enable || rootLogicalVolume != "" {
 		rootDevice = installMap[rootMountPoint]
 	} else {
 		var partUUID string
@@ -503,7 +678,7 @@ func configureDiskBootloader(systemConfig configuration.SystemConfig, installChr
 		rootDevice = fmt.Sprintf("PARTUUID=%v", partUUID)
 	}
 
-	err = installutils.InstallGrubCfg(installChroot.RootDir(), rootDevice, bootUUID, encryptedRoot, systemConfig.KernelCommandLine)
+	err = installutils.InstallGrubCfg(installChroot.RootDir(), rootDevice, bootUUID, systemConfig.RootSubvolume(), rootLogicalVolume, encryptedRoot, systemConfig.KernelCommandLine)
 	if err != nil {
 		err = fmt.Errorf("failed to install main grub config file: %s", err)
 		return
@@ -0,0 +1,286 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"microsoft.com/pkggen/imagegen/configuration"
+	"microsoft.com/pkggen/imagegen/diskutils"
+	"microsoft.com/pkggen/imagegen/installutils"
+	"microsoft.com/pkggen/internal/logger"
+	"microsoft.com/pkggen/internal/partitiontable"
+	"microsoft.com/pkggen/internal/safechroot"
+)
+
+// rootMountPoint is where the root partition is mounted
+const rootMountPoint = "/"
+
+const (
+	// loopDiskBackend partitions a loop device backed by the disk image and mounts its filesystems to install into
+	loopDiskBackend = "loop"
+	// noLoopDiskBackend installs into a directory and assembles the disk image from files afterwards
+	noLoopDiskBackend = "noloop"
+)
+
+// noLoopDisk is a disk image built without loop devices or mounting its partitions. The image's contents are installed
+// into a staging directory, which is then split along the configured mount points into one filesystem
+// image per partition. The filesystem images are copied into a disk image behind a partition table written in Go.
+type noLoopDisk struct {
+	config           configuration.Disk
+	table            *partitiontable.Table
+	stagingDir       string            // Directory holding the contents of every partition, as seen from the host
+	partIDToFsUUID   map[string]string // Filesystem UUID of every formatted partition
+	partIDToFsType   map[string]string // Filesystem type of every formatted partition
+	mountPointToPart map[string]int    // Index of the partition mounted at each mount point
+}
+
+// newNoLoopDisk lays out the disk and picks the UUIDs of its filesystems, so fstab and grub can refer to them
+// before they exist. Features which need a block device are rejected.
+// stagingDir is where the disk's contents will be installed, it is not created.
+func newNoLoopDisk(stagingDir string, diskConfig configuration.Disk, systemConfig configuration.SystemConfig, liveInstall bool) (disk *noLoopDisk, err error) {
+	const (
+		realDiskType   = "path"
+		legacyBootType = "legacy"
+	)
+
+	switch {
+	case liveInstall || diskConfig.TargetDisk.Type == realDiskType:
+		err = fmt.Errorf("the %s disk backend builds disk images, it can't install to a real disk", noLoopDiskBackend)
+	case systemConfig.Encryption.Enable:
+		err = fmt.Errorf("the %s disk backend does not support root encryption", noLoopDiskBackend)
+	case len(diskConfig.VolumeGroups) != 0:
+		err = fmt.Errorf("the %s disk backend does not support [VolumeGroups], LVM needs a block device", noLoopDiskBackend)
+	case systemConfig.BootType == legacyBootType:
+		err = fmt.Errorf("the %s disk backend does not support legacy boot, grub2-install needs a block device", noLoopDiskBackend)
+	}
+	if err != nil {
+		return
+	}
+
+	disk = &noLoopDisk{
+		config:           diskConfig,
+		stagingDir:       stagingDir,
+		partIDToFsUUID:   make(map[string]string),
+		partIDToFsType:   make(map[string]string),
+		mountPointToPart: make(map[string]int),
+	}
+
+	disk.table, err = diskutils.NewPartitionTable(diskConfig, diskConfig.MaxSize*diskutils.MiB)
+	if err != nil {
+		return
+	}
+
+	for _, partition := range diskConfig.Partitions {
+		switch partition.FsType {
+		case "":
+			continue
+		case "xfs", "btrfs", "swap":
+			err = fmt.Errorf("the %s disk backend does not support %s partitions, found on partition (%s)", noLoopDiskBackend, partition.FsType, partition.ID)
+			return
+		}
+
+		if len(partition.MkfsOptions) != 0 {
+			err = fmt.Errorf("the %s disk backend does not support [MkfsOptions], found on partition (%s)", noLoopDiskBackend, partition.ID)
+			return
+		}
+
+		disk.partIDToFsUUID[partition.ID], err = diskutils.NewFilesystemUUID(partition.FsType)
+		if err != nil {
+			return
+		}
+
+		fsType := partition.FsType
+		if fsType == "fat32" || fsType == "fat16" {
+			fsType = "vfat"
+		}
+		disk.partIDToFsType[partition.ID] = fsType
+	}
+
+	for _, partitionSetting := range systemConfig.PartitionSettings {
+		for i, partition := range diskConfig.Partitions {
+			if partition.ID == partitionSetting.ID && partitionSetting.MountPoint != "" {
+				disk.mountPointToPart[partitionSetting.MountPoint] = i
+			}
+		}
+	}
+
+	if _, found := disk.mountPointToPart[rootMountPoint]; !found {
+		err = fmt.Errorf("no partition is mounted at (%s)", rootMountPoint)
+	}
+
+	return
+}
+
+// partIDToDevPathMap returns the fstab device of every formatted partition, in place of a device path.
+func (d *noLoopDisk) partIDToDevPathMap() (partIDToDevPathMap map[string]string) {
+	partIDToDevPathMap = make(map[string]string)
+	for partID, uuid := range d.partIDToFsUUID {
+		partIDToDevPathMap[partID] = fmt.Sprintf("UUID=%s", uuid)
+	}
+	return
+}
+
+// configureBootloader installs the EFI bootloader and grub config into the staging directory, using the
+// UUIDs picked for the root filesystem and partition.
+func (d *noLoopDisk) configureBootloader(systemConfig configuration.SystemConfig, installChroot *safechroot.Chroot) (err error) {
+	const (
+		encryptEnabled  = false
+		noBootDevice    = ""
+		noRootSubvolume = ""
+		noRootVolume    = ""
+	)
+
+	rootIndex := d.mountPointToPart[rootMountPoint]
+	bootUUID := d.partIDToFsUUID[d.config.Partitions[rootIndex].ID]
+
+	err = installutils.InstallBootloader(installChroot, encryptEnabled, systemConfig.BootType, bootUUID, noRootSubvolume, noBootDevice)
+	if err != nil {
+		err = fmt.Errorf("failed to install bootloader: %s", err)
+		return
+	}
+
+	rootDevice := fmt.Sprintf("PARTUUID=%v", d.table.PartUUID(rootIndex))
+	err = installutils.InstallGrubCfg(installChroot.RootDir(), rootDevice, bootUUID, noRootSubvolume, noRootVolume, diskutils.EncryptedRootDevice{}, systemConfig.KernelCommandLine)
+	if err != nil {
+		err = fmt.Errorf("failed to install main grub config file: %s", err)
+		return
+	}
+
+	return
+}
+
+// assemble splits the staging directory into one filesystem image per partition and writes them, along with the
+// partition table and raw binaries, to diskName in buildDir. Returns the filesystem image of every formatted partition.
+func (d *noLoopDisk) assemble(buildDir, diskName string) (partIDToImagePath map[string]string, err error) {
+	const partitionsDirName = "noloopdiskpartitions"
+
+	partitionsDir := filepath.Join(buildDir, partitionsDirName)
+	err = os.MkdirAll(partitionsDir, os.ModePerm)
+	if err != nil {
+		return
+	}
+
+	partIDToSourceDir, err := d.splitMountPoints(partitionsDir)
+	if err != nil {
+		return
+	}
+
+	partIDToImagePath = make(map[string]string)
+	for i, partition := range d.config.Partitions {
+		fsType, formatted := d.partIDToFsType[partition.ID]
+		if !formatted {
+			continue
+		}
+
+		sourceDir := partIDToSourceDir[partition.ID]
+		imagePath := filepath.Join(partitionsDir, fmt.Sprintf("%s.img", partition.ID))
+		logger.Log.Infof("Creating %s filesystem image for partition (%s)", fsType, partition.ID)
+		err = diskutils.CreateFilesystemImage(imagePath, d.table.Partitions[i].Size, fsType, d.partIDToFsUUID[partition.ID], sourceDir)
+		if err != nil {
+			err = fmt.Errorf("failed to create filesystem image for partition (%s): %s", partition.ID, err)
+			return
+		}
+		partIDToImagePath[partition.ID] = imagePath
+
+		// Files owned by the image's users can't be removed once the imager leaves its user namespace,
+		// remove them now. The staging directory is removed along with the setup chroot.
+		if sourceDir != "" && sourceDir != d.stagingDir {
+			err = os.RemoveAll(sourceDir)
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	logger.Log.Infof("Assembling disk image (%s)", diskName)
+	diskPath, err := diskutils.CreateSparseDisk(buildDir, diskName, d.config)
+	if err != nil {
+		return
+	}
+
+	err = partitiontable.WriteFile(diskPath, d.table)
+	if err != nil {
+		err = fmt.Errorf("failed to write partition table: %s", err)
+		return
+	}
+
+	for i, partition := range d.config.Partitions {
+		imagePath, formatted := partIDToImagePath[partition.ID]
+		if !formatted {
+			continue
+		}
+
+		err = diskutils.WritePartitionImage(diskPath, imagePath, d.table.Partitions[i].Start)
+		if err != nil {
+			err = fmt.Errorf("failed to write partition (%s) to the disk image: %s", partition.ID, err)
+			return
+		}
+	}
+
+	err = diskutils.ApplyRawBinaries(diskPath, d.config)
+	return
+}
+
+// splitMountPoints moves the contents of every mount point other than the root out of the staging directory,
+// leaving an empty directory with the same permissions behind to mount it on. Nested mount points are moved
+// first so they don't end up in their parent's filesystem. Returns the directory holding each partition's contents.
+func (d *noLoopDisk) splitMountPoints(partitionsDir string) (partIDToSourceDir map[string]string, err error) {
+	partIDToSourceDir = make(map[string]string)
+
+	var mountPoints []string
+	for mountPoint := range d.mountPointToPart {
+		mountPoints = append(mountPoints, mountPoint)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(mountPoints)))
+
+	for _, mountPoint := range mountPoints {
+		partID := d.config.Partitions[d.mountPointToPart[mountPoint]].ID
+		if mountPoint == rootMountPoint {
+			partIDToSourceDir[partID] = d.stagingDir
+			continue
+		}
+
+		stagedPath := filepath.Join(d.stagingDir, mountPoint)
+		sourceDir := filepath.Join(partitionsDir, partID)
+		partIDToSourceDir[partID] = sourceDir
+
+		info, statErr := os.Stat(stagedPath)
+		if os.IsNotExist(statErr) {
+			logger.Log.Debugf("Nothing was installed to (%s), its filesystem will be empty", mountPoint)
+			err = os.MkdirAll(sourceDir, os.ModePerm)
+			if err != nil {
+				return
+			}
+			err = os.MkdirAll(stagedPath, os.ModePerm)
+			if err != nil {
+				return
+			}
+			continue
+		} else if statErr != nil {
+			return nil, statErr
+		}
+
+		err = os.Rename(stagedPath, sourceDir)
+		if err != nil {
+			return
+		}
+
+		err = os.Mkdir(stagedPath, info.Mode().Perm())
+		if err != nil {
+			return
+		}
+
+		// Mkdir is subject to the umask
+		err = os.Chmod(stagedPath, info.Mode().Perm())
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
@@ -0,0 +1,189 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+	"microsoft.com/pkggen/internal/file"
+	"microsoft.com/pkggen/internal/logger"
+	"microsoft.com/pkggen/internal/shell"
+)
+
+const (
+	// userNamespaceEnv tracks how far the imager is through entering its user namespace
+	userNamespaceEnv = "IMAGER_USER_NAMESPACE"
+	// userNamespaceUnmapped is set for the imager started in the new user namespace, before its IDs are mapped
+	userNamespaceUnmapped = "unmapped"
+	// userNamespaceMapped is set for the imager running as root of the user namespace
+	userNamespaceMapped = "mapped"
+
+	// selfExe is the imager's own executable
+	selfExe = "/proc/self/exe"
+
+	subUIDFile = "/etc/subuid"
+	subGIDFile = "/etc/subgid"
+)
+
+// enterUserNamespace runs the imager as root of a new user namespace when it was started without root,
+// letting the noloop disk backend create chroots and files owned by the image's users.
+// The user's own ID is mapped to root and its subordinate IDs from /etc/subuid and /etc/subgid to the
+// image's other users. It only returns in the imager which should build the image, the others exit with its status.
+func enterUserNamespace() {
+	switch os.Getenv(userNamespaceEnv) {
+	case userNamespaceMapped:
+		return
+	case userNamespaceUnmapped:
+		err := waitForIDMapping()
+		logger.PanicOnError(err, "Failed to enter user namespace: %s", err)
+	default:
+		if os.Geteuid() == 0 {
+			return
+		}
+
+		exitCode, err := runInUserNamespace()
+		logger.PanicOnError(err, "Failed to run in a user namespace: %s", err)
+		os.Exit(exitCode)
+	}
+}
+
+// runInUserNamespace starts the imager again in a new user namespace, maps its IDs and waits for it to exit.
+func runInUserNamespace() (exitCode int, err error) {
+	const (
+		rootID             = "0"
+		firstSubordinateID = "1"
+		singleID           = "1"
+		squashErrors       = false
+	)
+
+	subUIDStart, subUIDCount, err := subordinateIDs(subUIDFile)
+	if err != nil {
+		return
+	}
+	subGIDStart, subGIDCount, err := subordinateIDs(subGIDFile)
+	if err != nil {
+		return
+	}
+
+	// The new imager waits for the mapping until the write end of the pipe is closed
+	mappingDone, mappingDoneWriter, err := os.Pipe()
+	if err != nil {
+		return
+	}
+	defer mappingDoneWriter.Close()
+
+	cmd := exec.Command(selfExe, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = userNamespaceEnvironment(userNamespaceUnmapped)
+	cmd.ExtraFiles = []*os.File{mappingDone}
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags: unix.CLONE_NEWUSER,
+		Pdeathsig:  unix.SIGTERM,
+	}
+
+	logger.Log.Infof("Running as root of a new user namespace, with %s subordinate UIDs and %s subordinate GIDs", subUIDCount, subGIDCount)
+	err = cmd.Start()
+	mappingDone.Close()
+	if err != nil {
+		return
+	}
+
+	// Map the user to root and their subordinate IDs to every other ID, starting at 1
+	pid := strconv.Itoa(cmd.Process.Pid)
+	err = shell.ExecuteLive(squashErrors, "newuidmap", pid, rootID, strconv.Itoa(os.Getuid()), singleID, firstSubordinateID, subUIDStart, subUIDCount)
+	if err == nil {
+		err = shell.ExecuteLive(squashErrors, "newgidmap", pid, rootID, strconv.Itoa(os.Getgid()), singleID, firstSubordinateID, subGIDStart, subGIDCount)
+	}
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		err = fmt.Errorf("failed to map IDs into the user namespace, newuidmap and newgidmap are needed: %s", err)
+		return
+	}
+
+	mappingDoneWriter.Close()
+	err = cmd.Wait()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return exitErr.ExitCode(), nil
+	}
+	return
+}
+
+// waitForIDMapping waits until the imager's IDs are mapped into its user namespace, then runs the imager again so it
+// gains root's capabilities in the namespace. Capabilities are only granted when executing as a mapped root.
+func waitForIDMapping() (err error) {
+	const mappingDoneFd = 3
+
+	mappingDone := os.NewFile(mappingDoneFd, "mapping-done")
+	_, err = ioutil.ReadAll(mappingDone)
+	mappingDone.Close()
+	if err != nil {
+		return
+	}
+
+	if os.Getuid() != 0 || os.Getgid() != 0 {
+		return fmt.Errorf("user namespace IDs were not mapped to root")
+	}
+
+	return unix.Exec(selfExe, os.Args, userNamespaceEnvironment(userNamespaceMapped))
+}
+
+// userNamespaceEnvironment returns the current environment with userNamespaceEnv set to state.
+func userNamespaceEnvironment(state string) (env []string) {
+	prefix := fmt.Sprintf("%s=", userNamespaceEnv)
+	for _, variable := range os.Environ() {
+		if !strings.HasPrefix(variable, prefix) {
+			env = append(env, variable)
+		}
+	}
+
+	env = append(env, prefix+state)
+	return
+}
+
+// subordinateIDs returns the start and count of the current user's subordinate IDs listed in idFile.
+func subordinateIDs(idFile string) (start, count string, err error) {
+	const (
+		fieldCount = 3
+		nameField  = 0
+		startField = 1
+		countField = 2
+	)
+
+	currentUser, err := user.Current()
+	if err != nil {
+		return
+	}
+
+	lines, err := file.ReadLines(idFile)
+	if err != nil {
+		err = fmt.Errorf("failed to read subordinate IDs from (%s): %s", idFile, err)
+		return
+	}
+
+	for _, line := range lines {
+		fields := strings.Split(strings.TrimSpace(line), ":")
+		if len(fields) != fieldCount {
+			continue
+		}
+
+		if fields[nameField] == currentUser.Username || fields[nameField] == currentUser.Uid {
+			start, count = fields[startField], fields[countField]
+			return
+		}
+	}
+
+	err = fmt.Errorf("no subordinate IDs are assigned to (%s) in (%s)", currentUser.Username, idFile)
+	return
+}
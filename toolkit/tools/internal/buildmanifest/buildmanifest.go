@@ -0,0 +1,179 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+// Package buildmanifest records the inputs every SRPM was last built from, allowing
+// changed SRPMs to be detected even if their version and release were not bumped.
+//
+// The manifest is a directory with one entry per SRPM. Entries are first written as pending
+// when an SRPM is scheduled for a build, and only committed once the SRPM has been built
+// successfully. This allows independent package builds to update the manifest concurrently.
+package buildmanifest
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"microsoft.com/pkggen/internal/file"
+	"microsoft.com/pkggen/internal/jsonutils"
+)
+
+const (
+	entrySuffix        = ".manifest.json"
+	pendingEntrySuffix = ".manifest.pending.json"
+)
+
+// Inputs holds a hash of every input which affects the output of an SRPM's build.
+type Inputs struct {
+	SpecHash          string `json:"SpecHash"`          // The SPEC file
+	SourcesHash       string `json:"SourcesHash"`       // The signatures file, or the sources themselves if there is no signatures file
+	BuildRequiresHash string `json:"BuildRequiresHash"` // The resolved versions of every BuildRequires
+	MacrosHash        string `json:"MacrosHash"`        // The rpm macros and defines the SRPM is built with
+}
+
+// Entry is the manifest entry of a single SRPM.
+type Entry struct {
+	SrpmPath      string   `json:"SrpmPath"`      // The SRPM which was built
+	Inputs        Inputs   `json:"Inputs"`        // Hashes of the inputs the SRPM was built from
+	BuildRequires []string `json:"BuildRequires"` // The resolved BuildRequires the SRPM was built with, for reference
+}
+
+// ChangedInputs returns the name of every input which differs between two sets of inputs.
+func (i *Inputs) ChangedInputs(other *Inputs) (changed []string) {
+	if i.SpecHash != other.SpecHash {
+		changed = append(changed, "spec")
+	}
+	if i.SourcesHash != other.SourcesHash {
+		changed = append(changed, "sources")
+	}
+	if i.BuildRequiresHash != other.BuildRequiresHash {
+		changed = append(changed, "build requires")
+	}
+	if i.MacrosHash != other.MacrosHash {
+		changed = append(changed, "macros")
+	}
+	return
+}
+
+// EntryPath returns the path of the committed entry for an SRPM.
+func EntryPath(manifestDir, srpmPath string) string {
+	return filepath.Join(manifestDir, filepath.Base(srpmPath)+entrySuffix)
+}
+
+// PendingEntryPath returns the path of the pending entry for an SRPM.
+func PendingEntryPath(manifestDir, srpmPath string) string {
+	return filepath.Join(manifestDir, filepath.Base(srpmPath)+pendingEntrySuffix)
+}
+
+// ReadEntry reads the committed entry for an SRPM. Returns a nil entry if the SRPM has no entry.
+func ReadEntry(manifestDir, srpmPath string) (entry *Entry, err error) {
+	entryPath := EntryPath(manifestDir, srpmPath)
+
+	exists, err := file.PathExists(entryPath)
+	if err != nil || !exists {
+		return
+	}
+
+	entry = &Entry{}
+	err = jsonutils.ReadJSONFile(entryPath, entry)
+	return
+}
+
+// WriteEntry commits an entry directly, replacing any previous entry for the same SRPM.
+func WriteEntry(manifestDir string, entry *Entry) (err error) {
+	err = os.MkdirAll(manifestDir, os.ModePerm)
+	if err != nil {
+		return
+	}
+
+	return jsonutils.WriteJSONFile(EntryPath(manifestDir, entry.SrpmPath), entry)
+}
+
+// WritePendingEntry records the inputs an SRPM is about to be built from.
+// The entry only takes effect once CommitPendingEntry is called after a successful build.
+func WritePendingEntry(manifestDir string, entry *Entry) (err error) {
+	err = os.MkdirAll(manifestDir, os.ModePerm)
+	if err != nil {
+		return
+	}
+
+	return jsonutils.WriteJSONFile(PendingEntryPath(manifestDir, entry.SrpmPath), entry)
+}
+
+// CommitPendingEntry replaces the committed entry of an SRPM with its pending entry.
+// Does nothing if the SRPM has no pending entry.
+func CommitPendingEntry(manifestDir, srpmPath string) (err error) {
+	pendingPath := PendingEntryPath(manifestDir, srpmPath)
+
+	exists, err := file.PathExists(pendingPath)
+	if err != nil || !exists {
+		return
+	}
+
+	return os.Rename(pendingPath, EntryPath(manifestDir, srpmPath))
+}
+
+// HashStrings returns a sha256 of a list of strings. The order of the strings does not matter.
+func HashStrings(values []string) string {
+	sorted := make([]string, len(values))
+	copy(sorted, values)
+	sort.Strings(sorted)
+
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(strings.Join(sorted, "\n"))))
+}
+
+// HashFiles returns a sha256 of the name and contents of every file. The order of the files does not matter.
+// Files which do not exist are skipped.
+func HashFiles(paths []string) (hash string, err error) {
+	var fileHashes []string
+
+	for _, path := range paths {
+		var (
+			exists   bool
+			fileHash string
+		)
+
+		exists, err = file.PathExists(path)
+		if err != nil {
+			return
+		}
+		if !exists {
+			continue
+		}
+
+		fileHash, err = file.GenerateSHA256(path)
+		if err != nil {
+			return
+		}
+		fileHashes = append(fileHashes, fmt.Sprintf("%s %s", filepath.Base(path), fileHash))
+	}
+
+	hash = HashStrings(fileHashes)
+	return
+}
+
+// HashDirectory returns a sha256 of the name and contents of every regular file directly inside a directory,
+// skipping any file for which skip returns true. skip may be nil.
+func HashDirectory(dir string, skip func(name string) bool) (hash string, err error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	var paths []string
+	for _, info := range infos {
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		if skip != nil && skip(info.Name()) {
+			continue
+		}
+		paths = append(paths, filepath.Join(dir, info.Name()))
+	}
+
+	return HashFiles(paths)
+}
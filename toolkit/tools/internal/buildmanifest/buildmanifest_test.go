@@ -0,0 +1,123 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package buildmanifest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"microsoft.com/pkggen/internal/logger"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitStderrLog()
+	os.Exit(m.Run())
+}
+
+func TestHashStringsIgnoresOrder(t *testing.T) {
+	assert.Equal(t, HashStrings([]string{"a-1.0", "b-2.0"}), HashStrings([]string{"b-2.0", "a-1.0"}))
+	assert.NotEqual(t, HashStrings([]string{"a-1.0", "b-2.0"}), HashStrings([]string{"a-1.0", "b-2.1"}))
+}
+
+func TestHashStringsDoesNotModifyInput(t *testing.T) {
+	values := []string{"b", "a"}
+	HashStrings(values)
+	assert.Equal(t, []string{"b", "a"}, values)
+}
+
+func TestHashDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "buildmanifest")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "foo.spec"), []byte("Name: foo"), os.ModePerm))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "foo.tar.gz"), []byte("sources"), os.ModePerm))
+
+	skipSpec := func(name string) bool { return name == "foo.spec" }
+
+	hash, err := HashDirectory(dir, skipSpec)
+	assert.NoError(t, err)
+
+	// Changing a skipped file does not change the hash
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "foo.spec"), []byte("Name: bar"), os.ModePerm))
+	unchangedHash, err := HashDirectory(dir, skipSpec)
+	assert.NoError(t, err)
+	assert.Equal(t, hash, unchangedHash)
+
+	// Changing a source does
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "foo.tar.gz"), []byte("new sources"), os.ModePerm))
+	changedHash, err := HashDirectory(dir, skipSpec)
+	assert.NoError(t, err)
+	assert.NotEqual(t, hash, changedHash)
+}
+
+func TestHashFilesSkipsMissingFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "buildmanifest")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	existing := filepath.Join(dir, "macros")
+	assert.NoError(t, ioutil.WriteFile(existing, []byte("%dist .cm1"), os.ModePerm))
+
+	hash, err := HashFiles([]string{existing})
+	assert.NoError(t, err)
+
+	hashWithMissing, err := HashFiles([]string{existing, filepath.Join(dir, "missing")})
+	assert.NoError(t, err)
+	assert.Equal(t, hash, hashWithMissing)
+}
+
+func TestChangedInputs(t *testing.T) {
+	previous := &Inputs{SpecHash: "spec", SourcesHash: "sources", BuildRequiresHash: "reqs", MacrosHash: "macros"}
+
+	current := *previous
+	assert.Empty(t, previous.ChangedInputs(&current))
+
+	current.SpecHash = "new spec"
+	current.MacrosHash = "new macros"
+	assert.Equal(t, []string{"spec", "macros"}, previous.ChangedInputs(&current))
+}
+
+func TestReadMissingEntry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "buildmanifest")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	entry, err := ReadEntry(dir, "foo-1.0-1.src.rpm")
+	assert.NoError(t, err)
+	assert.Nil(t, entry)
+}
+
+func TestPendingEntryOnlyTakesEffectOnCommit(t *testing.T) {
+	const srpm = "/srpms/foo-1.0-1.src.rpm"
+
+	dir, err := ioutil.TempDir("", "buildmanifest")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	built := &Entry{SrpmPath: srpm, Inputs: Inputs{SpecHash: "old"}}
+	assert.NoError(t, WriteEntry(dir, built))
+
+	pending := &Entry{SrpmPath: srpm, Inputs: Inputs{SpecHash: "new"}, BuildRequires: []string{"bar-2.0-1"}}
+	assert.NoError(t, WritePendingEntry(dir, pending))
+
+	entry, err := ReadEntry(dir, srpm)
+	assert.NoError(t, err)
+	assert.Equal(t, built, entry)
+
+	assert.NoError(t, CommitPendingEntry(dir, srpm))
+
+	entry, err = ReadEntry(dir, srpm)
+	assert.NoError(t, err)
+	assert.Equal(t, pending, entry)
+
+	// Committing again with no pending entry is a no-op
+	assert.NoError(t, CommitPendingEntry(dir, srpm))
+	entry, err = ReadEntry(dir, srpm)
+	assert.NoError(t, err)
+	assert.Equal(t, pending, entry)
+}
@@ -0,0 +1,432 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package buildreport
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"microsoft.com/pkggen/internal/jsonutils"
+	"microsoft.com/pkggen/internal/pkggraph"
+)
+
+// slackEpsilon absorbs floating point noise when deciding if an SRPM has no slack.
+const slackEpsilon = 1e-6
+
+// SrpmTiming is the schedule of a single SRPM when every SRPM starts as soon as its dependencies are built.
+type SrpmTiming struct {
+	SrpmName              string  `json:"SrpmName"`              // The base name of the SRPM
+	DurationSeconds       float64 `json:"DurationSeconds"`       // How long the SRPM takes to build
+	Estimated             bool    `json:"Estimated"`             // The SRPM had no timing, DurationSeconds is the median of the known timings
+	EarliestStartSeconds  float64 `json:"EarliestStartSeconds"`  // The earliest the SRPM can start building
+	EarliestFinishSeconds float64 `json:"EarliestFinishSeconds"` // The earliest the SRPM can finish building
+	LatestStartSeconds    float64 `json:"LatestStartSeconds"`    // The latest the SRPM can start without delaying the build
+	SlackSeconds          float64 `json:"SlackSeconds"`          // How long the SRPM may be delayed without delaying the build
+	Critical              bool    `json:"Critical"`              // The SRPM has no slack
+}
+
+// SpeedupCandidate is an SRPM whose faster build would shorten the overall build.
+type SpeedupCandidate struct {
+	SrpmName        string  `json:"SrpmName"`        // The base name of the SRPM
+	DurationSeconds float64 `json:"DurationSeconds"` // How long the SRPM takes to build
+	SavingSeconds   float64 `json:"SavingSeconds"`   // How much shorter the critical path gets if the SRPM took no time to build
+}
+
+// BuildTimeReport is the result of analyzing how long it takes to build every SRPM in a graph.
+type BuildTimeReport struct {
+	Workers                  int                 `json:"Workers"`                  // The number of concurrent builds the wall times are computed for
+	TotalWorkSeconds         float64             `json:"TotalWorkSeconds"`         // The sum of the build times of every SRPM
+	CriticalPathSeconds      float64             `json:"CriticalPathSeconds"`      // The length of the longest chain of dependent SRPM builds
+	MinimumWallTimeSeconds   float64             `json:"MinimumWallTimeSeconds"`   // The lower bound of the build time: the critical path or the total work split across the workers
+	SimulatedWallTimeSeconds float64             `json:"SimulatedWallTimeSeconds"` // The build time when the workers always pick the ready SRPM with the longest remaining chain
+	EstimatedSRPMs           int                 `json:"EstimatedSRPMs"`           // How many SRPMs had no timing
+	CriticalPath             []string            `json:"CriticalPath"`             // The SRPMs on the critical path, in build order
+	SpeedupCandidates        []*SpeedupCandidate `json:"SpeedupCandidates"`        // The SRPMs whose speed-up shortens the build the most
+	Srpms                    []*SrpmTiming       `json:"Srpms"`                    // Every SRPM, sorted by slack
+}
+
+// buildJob is an SRPM along with the SRPMs which must be built before it.
+type buildJob struct {
+	timing       *SrpmTiming
+	dependencies map[*buildJob]bool
+	dependants   map[*buildJob]bool
+}
+
+// ReadBuildTimings reads a JSON file mapping SRPM names to their build time in seconds.
+// SRPM paths are accepted as keys and reduced to their base name.
+func ReadBuildTimings(path string) (timings map[string]float64, err error) {
+	rawTimings := make(map[string]float64)
+	err = jsonutils.ReadJSONFile(path, &rawTimings)
+	if err != nil {
+		return
+	}
+
+	timings = make(map[string]float64, len(rawTimings))
+	for srpm, seconds := range rawTimings {
+		timings[filepath.Base(srpm)] = seconds
+	}
+	return
+}
+
+// BuildTimingsFromSummary returns the build time in seconds of every successfully built SRPM in a summary.
+// Failed and blocked builds are skipped since their time says nothing about a complete build.
+func BuildTimingsFromSummary(summary *BuildSummary) (timings map[string]float64) {
+	timings = make(map[string]float64)
+	for _, result := range summary.Results {
+		if result.Status != StatusBuilt {
+			continue
+		}
+		timings[filepath.Base(result.SrpmPath)] = result.WallTimeSeconds
+	}
+	return
+}
+
+// AnalyzeBuildTime models a full build of every SRPM in pkgGraph using the build times in timings,
+// keyed by SRPM base name. SRPMs without a timing are assumed to take the median of the known timings.
+// The report lists up to topCount speed-up candidates, and computes wall times for the given number of workers.
+func AnalyzeBuildTime(pkgGraph *pkggraph.PkgGraph, timings map[string]float64, workers, topCount int) (report *BuildTimeReport, err error) {
+	if workers <= 0 {
+		err = fmt.Errorf("the number of workers must be greater than zero, found %d", workers)
+		return
+	}
+
+	jobs := srpmBuildJobs(pkgGraph)
+	if len(jobs) == 0 {
+		err = fmt.Errorf("the graph has no SRPMs to build")
+		return
+	}
+
+	report = &BuildTimeReport{Workers: workers}
+	report.EstimatedSRPMs, err = assignDurations(jobs, timings)
+	if err != nil {
+		return
+	}
+
+	order, err := topologicalOrder(jobs)
+	if err != nil {
+		return
+	}
+
+	for _, job := range order {
+		report.TotalWorkSeconds += job.timing.DurationSeconds
+	}
+
+	var lastJob *buildJob
+	report.CriticalPathSeconds, lastJob = scheduleEarliest(order, nil)
+	report.CriticalPath = criticalPath(lastJob)
+	scheduleLatest(order, report.CriticalPathSeconds)
+
+	report.MinimumWallTimeSeconds = report.TotalWorkSeconds / float64(workers)
+	if report.CriticalPathSeconds > report.MinimumWallTimeSeconds {
+		report.MinimumWallTimeSeconds = report.CriticalPathSeconds
+	}
+	report.SimulatedWallTimeSeconds = simulateBuild(order, workers)
+	report.SpeedupCandidates = speedupCandidates(order, report.CriticalPathSeconds, topCount)
+
+	for _, job := range order {
+		report.Srpms = append(report.Srpms, job.timing)
+	}
+	sort.Slice(report.Srpms, func(i, j int) bool {
+		if report.Srpms[i].SlackSeconds != report.Srpms[j].SlackSeconds {
+			return report.Srpms[i].SlackSeconds < report.Srpms[j].SlackSeconds
+		}
+		return report.Srpms[i].SrpmName < report.Srpms[j].SrpmName
+	})
+
+	return
+}
+
+// srpmBuildJobs collapses the build nodes of pkgGraph into one job per SRPM.
+// A job depends on another SRPM if one of its build nodes reaches a build node of that SRPM
+// through run, meta or remote nodes. The bootstrap build of an SRPM is a separate job.
+func srpmBuildJobs(pkgGraph *pkggraph.PkgGraph) (jobs map[string]*buildJob) {
+	const bootstrapJobSuffix = " (bootstrap)"
+
+	jobs = make(map[string]*buildJob)
+	jobForNode := func(n *pkggraph.PkgNode) *buildJob {
+		srpmName := filepath.Base(n.SrpmPath)
+		if n.Bootstrap {
+			srpmName += bootstrapJobSuffix
+		}
+		job, found := jobs[srpmName]
+		if !found {
+			job = &buildJob{
+				timing:       &SrpmTiming{SrpmName: srpmName},
+				dependencies: make(map[*buildJob]bool),
+				dependants:   make(map[*buildJob]bool),
+			}
+			jobs[srpmName] = job
+		}
+		return job
+	}
+
+	visited := make(map[*buildJob]map[int64]bool)
+	for _, buildNode := range pkgGraph.AllBuildNodes() {
+		job := jobForNode(buildNode)
+		if visited[job] == nil {
+			visited[job] = make(map[int64]bool)
+		}
+
+		pending := []*pkggraph.PkgNode{buildNode}
+		for len(pending) > 0 {
+			n := pending[len(pending)-1]
+			pending = pending[:len(pending)-1]
+
+			dependencies := pkgGraph.From(n.ID())
+			for dependencies.Next() {
+				dependency := dependencies.Node().(*pkggraph.PkgNode)
+				if visited[job][dependency.ID()] {
+					continue
+				}
+				visited[job][dependency.ID()] = true
+
+				if dependency.Type != pkggraph.TypeBuild {
+					pending = append(pending, dependency)
+					continue
+				}
+
+				// The build node's own dependencies are walked when it is reached by the outer loop
+				dependencyJob := jobForNode(dependency)
+				if dependencyJob != job {
+					job.dependencies[dependencyJob] = true
+					dependencyJob.dependants[job] = true
+				}
+			}
+		}
+	}
+
+	return
+}
+
+// assignDurations sets the duration of every job, estimating the ones missing from timings.
+func assignDurations(jobs map[string]*buildJob, timings map[string]float64) (estimated int, err error) {
+	var known []float64
+	for srpmName, job := range jobs {
+		if seconds, found := timings[srpmName]; found {
+			known = append(known, seconds)
+			job.timing.DurationSeconds = seconds
+		}
+	}
+
+	if len(known) == 0 {
+		err = fmt.Errorf("none of the %d SRPMs in the graph have a build timing", len(jobs))
+		return
+	}
+
+	sort.Float64s(known)
+	median := known[len(known)/2]
+	if len(known)%2 == 0 {
+		median = (known[len(known)/2-1] + median) / 2
+	}
+
+	for srpmName, job := range jobs {
+		if _, found := timings[srpmName]; !found {
+			job.timing.DurationSeconds = median
+			job.timing.Estimated = true
+			estimated++
+		}
+	}
+	return
+}
+
+// topologicalOrder returns the jobs ordered so every job comes after its dependencies.
+func topologicalOrder(jobs map[string]*buildJob) (order []*buildJob, err error) {
+	remaining := make(map[*buildJob]int, len(jobs))
+	var ready []*buildJob
+	for _, job := range jobs {
+		remaining[job] = len(job.dependencies)
+		if remaining[job] == 0 {
+			ready = append(ready, job)
+		}
+	}
+
+	for len(ready) > 0 {
+		job := ready[len(ready)-1]
+		ready = ready[:len(ready)-1]
+		order = append(order, job)
+
+		for dependant := range job.dependants {
+			remaining[dependant]--
+			if remaining[dependant] == 0 {
+				ready = append(ready, dependant)
+			}
+		}
+	}
+
+	if len(order) != len(jobs) {
+		var cycle []string
+		for job, count := range remaining {
+			if count > 0 {
+				cycle = append(cycle, job.timing.SrpmName)
+			}
+		}
+		sort.Strings(cycle)
+		err = fmt.Errorf("SRPMs depend on each other and cannot be ordered: %s", strings.Join(cycle, ", "))
+	}
+	return
+}
+
+// scheduleEarliest computes the earliest start and finish of every job in order, with an unlimited number of workers.
+// If skip is set, it is treated as if it took no time to build.
+// Returns the length of the critical path and the job which finishes last.
+func scheduleEarliest(order []*buildJob, skip *buildJob) (length float64, lastJob *buildJob) {
+	for _, job := range order {
+		start := 0.0
+		for dependency := range job.dependencies {
+			if dependency.timing.EarliestFinishSeconds > start {
+				start = dependency.timing.EarliestFinishSeconds
+			}
+		}
+
+		duration := job.timing.DurationSeconds
+		if job == skip {
+			duration = 0
+		}
+
+		job.timing.EarliestStartSeconds = start
+		job.timing.EarliestFinishSeconds = start + duration
+		if lastJob == nil || job.timing.EarliestFinishSeconds > length {
+			length = job.timing.EarliestFinishSeconds
+			lastJob = job
+		}
+	}
+	return
+}
+
+// scheduleLatest computes the latest start and the slack of every job in order, given the length of the critical path.
+func scheduleLatest(order []*buildJob, length float64) {
+	for i := len(order) - 1; i >= 0; i-- {
+		job := order[i]
+		finish := length
+		for dependant := range job.dependants {
+			if dependant.timing.LatestStartSeconds < finish {
+				finish = dependant.timing.LatestStartSeconds
+			}
+		}
+
+		job.timing.LatestStartSeconds = finish - job.timing.DurationSeconds
+		job.timing.SlackSeconds = job.timing.LatestStartSeconds - job.timing.EarliestStartSeconds
+		job.timing.Critical = job.timing.SlackSeconds < slackEpsilon
+	}
+}
+
+// criticalPath walks back from lastJob through the dependencies which delayed each job the most.
+func criticalPath(lastJob *buildJob) (path []string) {
+	for job := lastJob; job != nil; {
+		path = append([]string{job.timing.SrpmName}, path...)
+
+		var next *buildJob
+		for dependency := range job.dependencies {
+			if next == nil || dependency.timing.EarliestFinishSeconds > next.timing.EarliestFinishSeconds ||
+				(dependency.timing.EarliestFinishSeconds == next.timing.EarliestFinishSeconds && dependency.timing.SrpmName < next.timing.SrpmName) {
+				next = dependency
+			}
+		}
+		job = next
+	}
+	return
+}
+
+// speedupCandidates returns up to topCount jobs on the critical path, sorted by how much shorter
+// the critical path gets if they took no time to build.
+// The earliest schedule of every job is restored before returning.
+func speedupCandidates(order []*buildJob, length float64, topCount int) (candidates []*SpeedupCandidate) {
+	for _, job := range order {
+		if !job.timing.Critical || job.timing.DurationSeconds == 0 {
+			continue
+		}
+
+		shortened, _ := scheduleEarliest(order, job)
+		if saving := length - shortened; saving > slackEpsilon {
+			candidates = append(candidates, &SpeedupCandidate{
+				SrpmName:        job.timing.SrpmName,
+				DurationSeconds: job.timing.DurationSeconds,
+				SavingSeconds:   saving,
+			})
+		}
+	}
+	scheduleEarliest(order, nil)
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].SavingSeconds != candidates[j].SavingSeconds {
+			return candidates[i].SavingSeconds > candidates[j].SavingSeconds
+		}
+		return candidates[i].SrpmName < candidates[j].SrpmName
+	})
+
+	if len(candidates) > topCount {
+		candidates = candidates[:topCount]
+	}
+	return
+}
+
+// simulateBuild returns how long building every job takes with a fixed number of workers.
+// Whenever a worker is free it picks the ready job with the longest chain of dependants left to build,
+// which is close to optimal in practice.
+func simulateBuild(order []*buildJob, workers int) (wallTime float64) {
+	// The remaining chain of a job is its own duration plus the longest remaining chain of its dependants
+	remainingChain := make(map[*buildJob]float64, len(order))
+	for i := len(order) - 1; i >= 0; i-- {
+		job := order[i]
+		longest := 0.0
+		for dependant := range job.dependants {
+			if remainingChain[dependant] > longest {
+				longest = remainingChain[dependant]
+			}
+		}
+		remainingChain[job] = job.timing.DurationSeconds + longest
+	}
+
+	type runningJob struct {
+		job    *buildJob
+		finish float64
+	}
+
+	var (
+		now     float64
+		ready   []*buildJob
+		running []runningJob
+	)
+
+	remaining := make(map[*buildJob]int, len(order))
+	for _, job := range order {
+		remaining[job] = len(job.dependencies)
+		if remaining[job] == 0 {
+			ready = append(ready, job)
+		}
+	}
+
+	for len(ready) > 0 || len(running) > 0 {
+		sort.Slice(ready, func(i, j int) bool {
+			if remainingChain[ready[i]] != remainingChain[ready[j]] {
+				return remainingChain[ready[i]] > remainingChain[ready[j]]
+			}
+			return ready[i].timing.SrpmName < ready[j].timing.SrpmName
+		})
+		for len(ready) > 0 && len(running) < workers {
+			running = append(running, runningJob{job: ready[0], finish: now + ready[0].timing.DurationSeconds})
+			ready = ready[1:]
+		}
+
+		// Advance to the next job to finish
+		sort.SliceStable(running, func(i, j int) bool {
+			return running[i].finish < running[j].finish
+		})
+		finished := running[0]
+		running = running[1:]
+		now = finished.finish
+
+		for dependant := range finished.job.dependants {
+			remaining[dependant]--
+			if remaining[dependant] == 0 {
+				ready = append(ready, dependant)
+			}
+		}
+	}
+
+	wallTime = now
+	return
+}
@@ -0,0 +1,176 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package buildreport
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"microsoft.com/pkggen/internal/pkggraph"
+	"microsoft.com/pkggen/internal/pkgjson"
+)
+
+// addTestSrpm adds a build and a run node for an SRPM producing a single package of the same name.
+func addTestSrpm(t *testing.T, g *pkggraph.PkgGraph, name string) (runNode, buildNode *pkggraph.PkgNode) {
+	pkgVer := &pkgjson.PackageVer{Name: name, Condition: "=", Version: "1.0"}
+	srpmPath := filepath.Join("SRPMS", name+"-1.0-1.src.rpm")
+
+	runNode, err := g.AddPkgNode(pkgVer, pkggraph.StateMeta, pkggraph.TypeRun, srpmPath, name+".spec", "", "x86_64", "")
+	assert.NoError(t, err)
+	buildNode, err = g.AddPkgNode(pkgVer, pkggraph.StateBuild, pkggraph.TypeBuild, srpmPath, name+".spec", "", "x86_64", "")
+	assert.NoError(t, err)
+	g.SetEdge(g.NewEdge(runNode, buildNode))
+	return
+}
+
+// buildTimeTestGraph creates a graph where "b" and "c" need "a", and "d" needs both "b" and "c".
+// "e" and "f" have no dependencies.
+func buildTimeTestGraph(t *testing.T) (g *pkggraph.PkgGraph) {
+	g = pkggraph.NewPkgGraph()
+	aRun, _ := addTestSrpm(t, g, "a")
+	bRun, bBuild := addTestSrpm(t, g, "b")
+	cRun, cBuild := addTestSrpm(t, g, "c")
+	_, dBuild := addTestSrpm(t, g, "d")
+	addTestSrpm(t, g, "e")
+	addTestSrpm(t, g, "f")
+
+	g.SetEdge(g.NewEdge(bBuild, aRun))
+	g.SetEdge(g.NewEdge(cBuild, aRun))
+
+	// "d" reaches "b" and "c" through a meta node
+	g.AddMetaNode([]*pkggraph.PkgNode{dBuild}, []*pkggraph.PkgNode{bRun, cRun})
+	return
+}
+
+var buildTimeTestTimings = map[string]float64{
+	"a-1.0-1.src.rpm": 10,
+	"b-1.0-1.src.rpm": 20,
+	"c-1.0-1.src.rpm": 3,
+	"d-1.0-1.src.rpm": 5,
+	"e-1.0-1.src.rpm": 4,
+}
+
+func findTiming(report *BuildTimeReport, srpmName string) *SrpmTiming {
+	for _, timing := range report.Srpms {
+		if timing.SrpmName == srpmName {
+			return timing
+		}
+	}
+	return nil
+}
+
+func TestAnalyzeBuildTime(t *testing.T) {
+	report, err := AnalyzeBuildTime(buildTimeTestGraph(t), buildTimeTestTimings, 2, 2)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 2, report.Workers)
+	assert.Equal(t, 1, report.EstimatedSRPMs)
+	assert.Equal(t, 47.0, report.TotalWorkSeconds)
+	assert.Equal(t, 35.0, report.CriticalPathSeconds)
+	assert.Equal(t, 35.0, report.MinimumWallTimeSeconds)
+	assert.Equal(t, 35.0, report.SimulatedWallTimeSeconds)
+	assert.Equal(t, []string{"a-1.0-1.src.rpm", "b-1.0-1.src.rpm", "d-1.0-1.src.rpm"}, report.CriticalPath)
+	assert.Equal(t, []*SpeedupCandidate{
+		{SrpmName: "b-1.0-1.src.rpm", DurationSeconds: 20, SavingSeconds: 17},
+		{SrpmName: "a-1.0-1.src.rpm", DurationSeconds: 10, SavingSeconds: 10},
+	}, report.SpeedupCandidates)
+}
+
+func TestAnalyzeBuildTimeSlack(t *testing.T) {
+	report, err := AnalyzeBuildTime(buildTimeTestGraph(t), buildTimeTestTimings, 2, 2)
+	assert.NoError(t, err)
+	assert.Len(t, report.Srpms, 6)
+
+	assert.Equal(t, &SrpmTiming{
+		SrpmName:              "c-1.0-1.src.rpm",
+		DurationSeconds:       3,
+		EarliestStartSeconds:  10,
+		EarliestFinishSeconds: 13,
+		LatestStartSeconds:    27,
+		SlackSeconds:          17,
+	}, findTiming(report, "c-1.0-1.src.rpm"))
+
+	// "f" has no timing and takes the median of the others
+	assert.Equal(t, &SrpmTiming{
+		SrpmName:              "f-1.0-1.src.rpm",
+		DurationSeconds:       5,
+		Estimated:             true,
+		EarliestFinishSeconds: 5,
+		LatestStartSeconds:    30,
+		SlackSeconds:          30,
+	}, findTiming(report, "f-1.0-1.src.rpm"))
+
+	assert.True(t, findTiming(report, "d-1.0-1.src.rpm").Critical)
+	assert.Equal(t, "e-1.0-1.src.rpm", report.Srpms[len(report.Srpms)-1].SrpmName)
+}
+
+func TestAnalyzeBuildTimeSingleWorker(t *testing.T) {
+	report, err := AnalyzeBuildTime(buildTimeTestGraph(t), buildTimeTestTimings, 1, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 47.0, report.MinimumWallTimeSeconds)
+	assert.Equal(t, 47.0, report.SimulatedWallTimeSeconds)
+	assert.Len(t, report.SpeedupCandidates, 3)
+}
+
+func TestAnalyzeBuildTimeShouldFailWithoutTimings(t *testing.T) {
+	_, err := AnalyzeBuildTime(buildTimeTestGraph(t), map[string]float64{}, 2, 2)
+	assert.Error(t, err)
+}
+
+func TestAnalyzeBuildTimeShouldFailOnSrpmCycles(t *testing.T) {
+	g := pkggraph.NewPkgGraph()
+	aRun, aBuild := addTestSrpm(t, g, "a")
+	bRun, bBuild := addTestSrpm(t, g, "b")
+	g.SetEdge(g.NewEdge(aBuild, bRun))
+	g.SetEdge(g.NewEdge(bBuild, aRun))
+
+	_, err := AnalyzeBuildTime(g, buildTimeTestTimings, 2, 2)
+	assert.Error(t, err)
+}
+
+func TestAnalyzeBuildTimeBootstrap(t *testing.T) {
+	g := pkggraph.NewPkgGraph()
+	aRun, aBuild := addTestSrpm(t, g, "a")
+	bRun, bBuild := addTestSrpm(t, g, "b")
+	g.SetEdge(g.NewEdge(aBuild, bRun))
+
+	// "b" needs the bootstrap build of "a" instead of the regular one, which would be a cycle
+	aBootstrapBuild, err := g.AddBootstrapNode(aBuild)
+	assert.NoError(t, err)
+	aBootstrapRun, err := g.AddBootstrapNode(aRun)
+	assert.NoError(t, err)
+	g.SetEdge(g.NewEdge(aBootstrapRun, aBootstrapBuild))
+	g.SetEdge(g.NewEdge(bBuild, aBootstrapRun))
+
+	report, err := AnalyzeBuildTime(g, buildTimeTestTimings, 2, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a-1.0-1.src.rpm (bootstrap)", "b-1.0-1.src.rpm", "a-1.0-1.src.rpm"}, report.CriticalPath)
+	assert.Equal(t, 1, report.EstimatedSRPMs)
+}
+
+func TestReadBuildTimings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "buildreport")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "timings.json")
+	err = ioutil.WriteFile(path, []byte(`{"SRPMS/a-1.0-1.src.rpm": 10.5, "b-1.0-1.src.rpm": 2}`), 0644)
+	assert.NoError(t, err)
+
+	timings, err := ReadBuildTimings(path)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]float64{"a-1.0-1.src.rpm": 10.5, "b-1.0-1.src.rpm": 2}, timings)
+}
+
+func TestBuildTimingsFromSummary(t *testing.T) {
+	summary := &BuildSummary{Results: []*SrpmResult{
+		{SrpmPath: "SRPMS/a-1.0-1.src.rpm", Status: StatusBuilt, WallTimeSeconds: 10},
+		{SrpmPath: "SRPMS/b-1.0-1.src.rpm", Status: StatusFailed, WallTimeSeconds: 2},
+	}}
+
+	assert.Equal(t, map[string]float64{"a-1.0-1.src.rpm": 10}, BuildTimingsFromSummary(summary))
+}
@@ -0,0 +1,219 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package buildreport
+
+import (
+	"bufio"
+	"os"
+	"sort"
+	"strings"
+
+	"microsoft.com/pkggen/internal/jsonutils"
+	"microsoft.com/pkggen/internal/pkgjson"
+)
+
+// EdgeType is the kind of dependency an edge of the graph represents.
+type EdgeType string
+
+// Valid values for EdgeType type
+const (
+	EdgeBuild     EdgeType = "Build"     // A SPEC needs a package to build
+	EdgeRun       EdgeType = "Run"       // A package needs another package to run
+	EdgeBuiltFrom EdgeType = "BuiltFrom" // A package needs its SPEC to be built
+	EdgeMeta      EdgeType = "Meta"      // A meta node needs a package, such as an operand of a rich dependency
+)
+
+// Requirement tags which create edges in the graph
+const (
+	TagRequires      = "Requires"
+	TagBuildRequires = "BuildRequires"
+)
+
+// CycleReport explains every dependency cycle which could not be fixed while building the graph.
+type CycleReport struct {
+	Cycles          []*Cycle      `json:"Cycles"`          // The unfixable cycles
+	SuggestedBreaks []*CycleBreak `json:"SuggestedBreaks"` // A small set of edges which breaks every cycle once removed
+}
+
+// Cycle is a single dependency cycle, listed as the edges followed from its first node back to itself.
+type Cycle struct {
+	Reason string       `json:"Reason"` // Why the cycle could not be fixed
+	Edges  []*CycleEdge `json:"Edges"`  // The edges of the cycle, in order
+}
+
+// CycleEdge is an edge of a dependency cycle along with the SPEC requirements which created it.
+type CycleEdge struct {
+	From    string               `json:"From"`    // The node which depends on To
+	To      string               `json:"To"`      // The node which is depended on
+	Type    EdgeType             `json:"Type"`    // The kind of dependency
+	Origins []*RequirementOrigin `json:"Origins"` // The requirements which created the edge, empty for implicit edges
+}
+
+// RequirementOrigin is a Requires or BuildRequires of a SPEC.
+type RequirementOrigin struct {
+	SpecPath    string `json:"SpecPath"`           // The SPEC listing the requirement
+	Tag         string `json:"Tag"`                // Requires or BuildRequires
+	Requirement string `json:"Requirement"`        // The requirement as parsed from the SPEC
+	Line        int    `json:"Line,omitempty"`     // The line of the SPEC listing the requirement, if it could be found
+	LineText    string `json:"LineText,omitempty"` // The text of that line
+}
+
+// CycleBreak is an edge suggested for removal to break dependency cycles.
+type CycleBreak struct {
+	Edge       *CycleEdge `json:"Edge"`       // The edge to remove
+	Bootstrap  bool       `json:"Bootstrap"`  // The edge only comes from BuildRequires, so it may be removed by bootstrapping its SPEC
+	CycleCount int        `json:"CycleCount"` // How many of the cycles which were not already broken contain the edge
+}
+
+// AddCycle records an unfixable cycle in the report.
+func (r *CycleReport) AddCycle(reason string, edges []*CycleEdge) {
+	r.Cycles = append(r.Cycles, &Cycle{
+		Reason: reason,
+		Edges:  edges,
+	})
+}
+
+// IsBootstrapCandidate returns true if the edge was only created by BuildRequires.
+func (e *CycleEdge) IsBootstrapCandidate() bool {
+	if len(e.Origins) == 0 {
+		return false
+	}
+	for _, origin := range e.Origins {
+		if origin.Tag != TagBuildRequires {
+			return false
+		}
+	}
+	return true
+}
+
+// SuggestBreaks greedily picks edges which break every cycle once removed.
+// Only edges created by a SPEC requirement are considered. The edge shared by the most cycles
+// which are not already broken is picked first, bootstrap candidates are preferred on ties.
+func (r *CycleReport) SuggestBreaks() {
+	type candidate struct {
+		edge   *CycleEdge
+		cycles map[int]bool
+	}
+
+	candidates := make(map[string]*candidate)
+	for i, cycle := range r.Cycles {
+		for _, edge := range cycle.Edges {
+			if len(edge.Origins) == 0 {
+				continue
+			}
+
+			key := edge.From + "\x00" + edge.To
+			if candidates[key] == nil {
+				candidates[key] = &candidate{edge: edge, cycles: make(map[int]bool)}
+			}
+			candidates[key].cycles[i] = true
+		}
+	}
+
+	keys := make([]string, 0, len(candidates))
+	for key := range candidates {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	r.SuggestedBreaks = nil
+	broken := make(map[int]bool)
+	for {
+		var (
+			best      *candidate
+			bestCount int
+		)
+		for _, key := range keys {
+			current := candidates[key]
+			count := 0
+			for i := range current.cycles {
+				if !broken[i] {
+					count++
+				}
+			}
+
+			switch {
+			case count == 0:
+				continue
+			case count > bestCount, count == bestCount && current.edge.IsBootstrapCandidate() && !best.edge.IsBootstrapCandidate():
+				best, bestCount = current, count
+			}
+		}
+
+		if best == nil {
+			return
+		}
+
+		for i := range best.cycles {
+			broken[i] = true
+		}
+		r.SuggestedBreaks = append(r.SuggestedBreaks, &CycleBreak{
+			Edge:       best.edge,
+			Bootstrap:  best.edge.IsBootstrapCandidate(),
+			CycleCount: bestCount,
+		})
+	}
+}
+
+// FindRequirementLine searches a SPEC file for the line listing a requirement with the given tag, such as
+// "BuildRequires: foo >= 1.0". Tags with qualifiers, such as "Requires(post):", are matched as well.
+// Returns a line number of 0 if no line lists the requirement, for example if it was created by a macro.
+func FindRequirementLine(specPath, tag string, requirement *pkgjson.PackageVer) (lineNumber int, lineText string, err error) {
+	specFile, err := os.Open(specPath)
+	if err != nil {
+		return
+	}
+	defer specFile.Close()
+
+	name := requirementSearchName(requirement)
+	lowerTag := strings.ToLower(tag)
+
+	scanner := bufio.NewScanner(specFile)
+	for currentLine := 1; scanner.Scan(); currentLine++ {
+		line := strings.TrimSpace(scanner.Text())
+		lowerLine := strings.ToLower(line)
+		if !strings.HasPrefix(lowerLine, lowerTag+":") && !strings.HasPrefix(lowerLine, lowerTag+"(") {
+			continue
+		}
+
+		separator := strings.Index(line, ":")
+		if separator < 0 {
+			continue
+		}
+
+		values := strings.FieldsFunc(line[separator+1:], func(r rune) bool {
+			return r == ' ' || r == '\t' || r == ','
+		})
+		for _, value := range values {
+			if value == name || strings.TrimLeft(value, "(") == name {
+				lineNumber, lineText = currentLine, line
+				return
+			}
+		}
+	}
+
+	err = scanner.Err()
+	return
+}
+
+// requirementSearchName returns the package name to look for in a SPEC for a requirement.
+// Rich dependencies are searched for by their first package.
+func requirementSearchName(requirement *pkgjson.PackageVer) string {
+	for requirement.IsRich() && len(requirement.Operands) > 0 {
+		requirement = requirement.Operands[0]
+	}
+	return requirement.Name
+}
+
+// ReadCycleReport reads a CycleReport from a JSON file.
+func ReadCycleReport(path string) (report *CycleReport, err error) {
+	report = &CycleReport{}
+	err = jsonutils.ReadJSONFile(path, report)
+	return
+}
+
+// WriteCycleReport writes a CycleReport to a JSON file.
+func WriteCycleReport(path string, report *CycleReport) (err error) {
+	return jsonutils.WriteJSONFile(path, report)
+}
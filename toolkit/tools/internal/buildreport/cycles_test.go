@@ -0,0 +1,120 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package buildreport
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"microsoft.com/pkggen/internal/pkgjson"
+)
+
+func cycleTestEdge(from, to string, tags ...string) (edge *CycleEdge) {
+	edge = &CycleEdge{From: from, To: to, Type: EdgeMeta}
+	for _, tag := range tags {
+		edge.Origins = append(edge.Origins, &RequirementOrigin{Tag: tag})
+	}
+	return
+}
+
+func TestIsBootstrapCandidate(t *testing.T) {
+	assert.True(t, cycleTestEdge("a", "b", TagBuildRequires).IsBootstrapCandidate())
+	assert.True(t, cycleTestEdge("a", "b", TagBuildRequires, TagBuildRequires).IsBootstrapCandidate())
+	assert.False(t, cycleTestEdge("a", "b", TagBuildRequires, TagRequires).IsBootstrapCandidate())
+	assert.False(t, cycleTestEdge("a", "b").IsBootstrapCandidate())
+}
+
+func TestSuggestBreaksShouldPickSharedEdges(t *testing.T) {
+	report := &CycleReport{}
+	report.AddCycle("", []*CycleEdge{cycleTestEdge("a", "b", TagRequires), cycleTestEdge("b", "a", TagRequires)})
+	report.AddCycle("", []*CycleEdge{cycleTestEdge("a", "b", TagRequires), cycleTestEdge("b", "c", TagRequires), cycleTestEdge("c", "a", TagRequires)})
+	report.AddCycle("", []*CycleEdge{cycleTestEdge("d", "e", TagRequires), cycleTestEdge("e", "d")})
+
+	report.SuggestBreaks()
+	assert.Len(t, report.SuggestedBreaks, 2)
+	assert.Equal(t, "a", report.SuggestedBreaks[0].Edge.From)
+	assert.Equal(t, "b", report.SuggestedBreaks[0].Edge.To)
+	assert.Equal(t, 2, report.SuggestedBreaks[0].CycleCount)
+
+	// Edges without an origin are never suggested
+	assert.Equal(t, "d", report.SuggestedBreaks[1].Edge.From)
+	assert.Equal(t, 1, report.SuggestedBreaks[1].CycleCount)
+}
+
+func TestSuggestBreaksShouldPreferBootstrapCandidates(t *testing.T) {
+	report := &CycleReport{}
+	report.AddCycle("", []*CycleEdge{cycleTestEdge("a", "b", TagRequires), cycleTestEdge("b", "a", TagBuildRequires)})
+
+	report.SuggestBreaks()
+	assert.Len(t, report.SuggestedBreaks, 1)
+	assert.True(t, report.SuggestedBreaks[0].Bootstrap)
+	assert.Equal(t, "b", report.SuggestedBreaks[0].Edge.From)
+}
+
+func TestSuggestBreaksShouldSkipUnbreakableCycles(t *testing.T) {
+	report := &CycleReport{}
+	report.AddCycle("", []*CycleEdge{cycleTestEdge("a", "b"), cycleTestEdge("b", "a")})
+
+	report.SuggestBreaks()
+	assert.Empty(t, report.SuggestedBreaks)
+}
+
+func TestFindRequirementLine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "buildreport")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	specPath := filepath.Join(dir, "test.spec")
+	spec := `Name: test
+BuildRequires:  gcc, foo-devel >= 1.0
+buildrequires: (bar or baz)
+Requires(post): foo
+Requires: foo-libs
+%{?with_qux:Requires: qux}
+`
+	err = ioutil.WriteFile(specPath, []byte(spec), 0644)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		tag          string
+		requirement  *pkgjson.PackageVer
+		expectedLine int
+		expectedText string
+	}{
+		{TagBuildRequires, &pkgjson.PackageVer{Name: "foo-devel", Condition: ">=", Version: "1.0"}, 2, "BuildRequires:  gcc, foo-devel >= 1.0"},
+		{TagBuildRequires, &pkgjson.PackageVer{Name: "(bar or baz)", Operator: pkgjson.OperatorOr, Operands: []*pkgjson.PackageVer{{Name: "bar"}, {Name: "baz"}}}, 3, "buildrequires: (bar or baz)"},
+		{TagRequires, &pkgjson.PackageVer{Name: "foo"}, 4, "Requires(post): foo"},
+		{TagRequires, &pkgjson.PackageVer{Name: "foo-libs"}, 5, "Requires: foo-libs"},
+		{TagRequires, &pkgjson.PackageVer{Name: "qux"}, 0, ""},
+		{TagRequires, &pkgjson.PackageVer{Name: "gcc"}, 0, ""},
+	}
+
+	for _, test := range tests {
+		line, text, err := FindRequirementLine(specPath, test.tag, test.requirement)
+		assert.NoError(t, err)
+		assert.Equal(t, test.expectedLine, line, test.requirement.Name)
+		assert.Equal(t, test.expectedText, text, test.requirement.Name)
+	}
+}
+
+func TestCycleReportRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "buildreport")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	report := &CycleReport{}
+	report.AddCycle("unresolvable", []*CycleEdge{cycleTestEdge("a", "b", TagBuildRequires), cycleTestEdge("b", "a")})
+	report.SuggestBreaks()
+
+	path := filepath.Join(dir, "cycles.json")
+	err = WriteCycleReport(path, report)
+	assert.NoError(t, err)
+
+	readReport, err := ReadCycleReport(path)
+	assert.NoError(t, err)
+	assert.Equal(t, report, readReport)
+}
@@ -0,0 +1,39 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package buildreport
+
+import (
+	"path/filepath"
+
+	"microsoft.com/pkggen/internal/jsonutils"
+	"microsoft.com/pkggen/internal/rpmcompare"
+)
+
+// ReproducibilityFileSuffix is appended to the name of an SRPM to get the name of its reproducibility report.
+const ReproducibilityFileSuffix = ".reproducibility.json"
+
+// ReproducibilityReport records whether building an SRPM twice produced identical RPMs.
+type ReproducibilityReport struct {
+	SrpmPath        string                   `json:"SrpmPath"`        // The SRPM which was built
+	SourceDateEpoch int64                    `json:"SourceDateEpoch"` // SOURCE_DATE_EPOCH both builds used, taken from the SPEC's changelog
+	Reproducible    bool                     `json:"Reproducible"`    // True if both builds produced identical RPMs
+	Differences     []*rpmcompare.Difference `json:"Differences"`     // Every header field and file which differed between the builds
+}
+
+// ReproducibilityReportPath returns the path of the reproducibility report for an SRPM inside reportsDir.
+func ReproducibilityReportPath(reportsDir, srpmPath string) string {
+	return filepath.Join(reportsDir, filepath.Base(srpmPath)+ReproducibilityFileSuffix)
+}
+
+// ReadReproducibilityReport reads a ReproducibilityReport from a JSON file.
+func ReadReproducibilityReport(path string) (report *ReproducibilityReport, err error) {
+	report = &ReproducibilityReport{}
+	err = jsonutils.ReadJSONFile(path, report)
+	return
+}
+
+// WriteReproducibilityReport writes a ReproducibilityReport to a JSON file.
+func WriteReproducibilityReport(path string, report *ReproducibilityReport) (err error) {
+	return jsonutils.WriteJSONFile(path, report)
+}
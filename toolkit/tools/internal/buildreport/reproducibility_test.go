@@ -0,0 +1,40 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package buildreport
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"microsoft.com/pkggen/internal/rpmcompare"
+)
+
+func TestReproducibilityReportPath(t *testing.T) {
+	assert.Equal(t, "/logs/foo-1.0-1.src.rpm.reproducibility.json", ReproducibilityReportPath("/logs", "/srpms/foo-1.0-1.src.rpm"))
+}
+
+func TestReproducibilityReportRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "buildreport")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	report := &ReproducibilityReport{
+		SrpmPath:        "foo.src.rpm",
+		SourceDateEpoch: 1600000000,
+		Differences: []*rpmcompare.Difference{
+			{RPM: "foo.rpm", Path: "/usr/bin/foo", Field: "digest", First: "abc", Second: "xyz"},
+		},
+	}
+
+	path := filepath.Join(dir, "report.json")
+	err = WriteReproducibilityReport(path, report)
+	assert.NoError(t, err)
+
+	readReport, err := ReadReproducibilityReport(path)
+	assert.NoError(t, err)
+	assert.Equal(t, report, readReport)
+}
@@ -0,0 +1,193 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package buildreport
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"microsoft.com/pkggen/internal/jsonutils"
+)
+
+// BuildStatus is the outcome of building a single SRPM.
+type BuildStatus string
+
+// Valid values for BuildStatus type
+const (
+	StatusBuilt   BuildStatus = "Built"   // The SRPM was built successfully
+	StatusFailed  BuildStatus = "Failed"  // The SRPM failed to build
+	StatusBlocked BuildStatus = "Blocked" // The SRPM was not built because one of its dependencies failed to build
+)
+
+// ResultFileSuffix is appended to the name of an SRPM to get the name of its result file.
+const ResultFileSuffix = ".result.json"
+
+var (
+	// Log lines are formatted by logrus as: time="..." level=<level> msg="<message>"
+	logLineRegex = regexp.MustCompile(`level=(\w+) msg=("(?:[^"\\]|\\.)*"|\S*)`)
+)
+
+// SrpmResult is the result of building a single SRPM.
+type SrpmResult struct {
+	SrpmPath        string      `json:"SrpmPath"`        // The SRPM which was built
+	Status          BuildStatus `json:"Status"`          // The outcome of the build
+	Attempts        int         `json:"Attempts"`        // How many times the build was attempted
+	WallTimeSeconds float64     `json:"WallTimeSeconds"` // Total time spent on every attempt
+	BuiltRPMs       []string    `json:"BuiltRPMs"`       // The RPMs produced by the build
+	LogPath         string      `json:"LogPath"`         // The log file of the build
+	FirstError      string      `json:"FirstError"`      // The first error reported by a failed build
+}
+
+// BuildSummary is the result of building every SRPM in a package build.
+type BuildSummary struct {
+	Results []*SrpmResult `json:"Results"`
+}
+
+// ResultFilePath returns the path of the result file for an SRPM inside resultsDir.
+func ResultFilePath(resultsDir, srpmPath string) string {
+	return filepath.Join(resultsDir, filepath.Base(srpmPath)+ResultFileSuffix)
+}
+
+// ReadSrpmResult reads an SrpmResult from a JSON file.
+func ReadSrpmResult(path string) (result *SrpmResult, err error) {
+	result = &SrpmResult{}
+	err = jsonutils.ReadJSONFile(path, result)
+	return
+}
+
+// WriteSrpmResult writes an SrpmResult to a JSON file.
+func WriteSrpmResult(path string, result *SrpmResult) (err error) {
+	return jsonutils.WriteJSONFile(path, result)
+}
+
+// ReadBuildSummary reads a BuildSummary from a JSON file.
+func ReadBuildSummary(path string) (summary *BuildSummary, err error) {
+	summary = &BuildSummary{}
+	err = jsonutils.ReadJSONFile(path, summary)
+	return
+}
+
+// WriteBuildSummary writes a BuildSummary to a JSON file.
+func WriteBuildSummary(path string, summary *BuildSummary) (err error) {
+	return jsonutils.WriteJSONFile(path, summary)
+}
+
+// CollectBuildSummary creates a BuildSummary from every SRPM result file found in resultsDir.
+// Results are sorted by SRPM name.
+func CollectBuildSummary(resultsDir string) (summary *BuildSummary, err error) {
+	summary = &BuildSummary{}
+
+	files, err := ioutil.ReadDir(resultsDir)
+	if err != nil {
+		return
+	}
+
+	for _, info := range files {
+		if info.IsDir() || !strings.HasSuffix(info.Name(), ResultFileSuffix) {
+			continue
+		}
+
+		var result *SrpmResult
+		result, err = ReadSrpmResult(filepath.Join(resultsDir, info.Name()))
+		if err != nil {
+			return
+		}
+		summary.Results = append(summary.Results, result)
+	}
+
+	summary.Sort()
+	return
+}
+
+// RemoveResultFiles deletes every SRPM result file in resultsDir, so results from a previous build are not
+// collected along with the current one. A missing resultsDir is not an error.
+func RemoveResultFiles(resultsDir string) (err error) {
+	files, err := ioutil.ReadDir(resultsDir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return
+	}
+
+	for _, info := range files {
+		if info.IsDir() || !strings.HasSuffix(info.Name(), ResultFileSuffix) {
+			continue
+		}
+
+		err = os.Remove(filepath.Join(resultsDir, info.Name()))
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// Sort orders the results by SRPM name.
+func (s *BuildSummary) Sort() {
+	sort.Slice(s.Results, func(i, j int) bool {
+		return filepath.Base(s.Results[i].SrpmPath) < filepath.Base(s.Results[j].SrpmPath)
+	})
+}
+
+// Count returns the number of results with a given status.
+func (s *BuildSummary) Count(status BuildStatus) (count int) {
+	for _, result := range s.Results {
+		if result.Status == status {
+			count++
+		}
+	}
+	return
+}
+
+// FirstErrorLine scans a build log and returns the message of the first error it contains.
+// Both messages logged at error level or above and warnings passed through from tools
+// such as rpmbuild (which prefix their errors with "error:") are considered errors.
+// Returns an empty string if no error is found.
+func FirstErrorLine(logPath string) (line string, err error) {
+	const toolErrorPrefix = "error:"
+
+	logFile, err := os.Open(logPath)
+	if err != nil {
+		return
+	}
+	defer logFile.Close()
+
+	scanner := bufio.NewScanner(logFile)
+	for scanner.Scan() {
+		matches := logLineRegex.FindStringSubmatch(scanner.Text())
+		if len(matches) == 0 {
+			continue
+		}
+
+		level, msg := matches[1], matches[2]
+		if unquoted, unquoteErr := strconv.Unquote(msg); unquoteErr == nil {
+			msg = unquoted
+		}
+		msg = strings.TrimSpace(msg)
+
+		switch level {
+		case "panic", "fatal", "error":
+			line = msg
+		default:
+			if strings.HasPrefix(strings.ToLower(msg), toolErrorPrefix) {
+				line = msg
+			}
+		}
+
+		if line != "" {
+			return
+		}
+	}
+
+	err = scanner.Err()
+	return
+}
@@ -0,0 +1,113 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package buildreport
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFirstErrorLineFromTool(t *testing.T) {
+	const log = `time="2020-01-01T00:00:00Z" level=info msg="Building (foo.src.rpm)"
+time="2020-01-01T00:00:01Z" level=warning msg="error: Bad exit status from /var/tmp/rpm-tmp.1 (%build)"
+time="2020-01-01T00:00:02Z" level=error msg="Failed to build SRPM 'foo.src.rpm'."
+`
+	dir, err := ioutil.TempDir("", "buildreport")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	logPath := filepath.Join(dir, "foo.log")
+	assert.NoError(t, ioutil.WriteFile(logPath, []byte(log), os.ModePerm))
+
+	line, err := FirstErrorLine(logPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "error: Bad exit status from /var/tmp/rpm-tmp.1 (%build)", line)
+}
+
+func TestFirstErrorLineFromLevel(t *testing.T) {
+	const log = `time="2020-01-01T00:00:00Z" level=warning msg="Failed package build attempt (foo.src.rpm), error (exit status 1)"
+time="2020-01-01T00:00:01Z" level=error msg=boom
+time="2020-01-01T00:00:02Z" level=panic msg="exit status 1"
+`
+	dir, err := ioutil.TempDir("", "buildreport")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	logPath := filepath.Join(dir, "foo.log")
+	assert.NoError(t, ioutil.WriteFile(logPath, []byte(log), os.ModePerm))
+
+	line, err := FirstErrorLine(logPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "boom", line)
+}
+
+func TestFirstErrorLineNoError(t *testing.T) {
+	const log = `time="2020-01-01T00:00:00Z" level=info msg="Building (foo.src.rpm)"
+`
+	dir, err := ioutil.TempDir("", "buildreport")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	logPath := filepath.Join(dir, "foo.log")
+	assert.NoError(t, ioutil.WriteFile(logPath, []byte(log), os.ModePerm))
+
+	line, err := FirstErrorLine(logPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "", line)
+
+	_, err = FirstErrorLine(filepath.Join(dir, "missing.log"))
+	assert.Error(t, err)
+}
+
+func TestCollectBuildSummary(t *testing.T) {
+	dir, err := ioutil.TempDir("", "buildreport")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	results := []*SrpmResult{
+		{SrpmPath: "/srpms/b.src.rpm", Status: StatusFailed, Attempts: 2, FirstError: "error: oops"},
+		{SrpmPath: "/srpms/a.src.rpm", Status: StatusBuilt, Attempts: 1, BuiltRPMs: []string{"a-1.rpm"}},
+		{SrpmPath: "/srpms/c.src.rpm", Status: StatusBlocked},
+	}
+	for _, result := range results {
+		assert.NoError(t, WriteSrpmResult(ResultFilePath(dir, result.SrpmPath), result))
+	}
+	// Other files, such as build logs, must be ignored
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "a.src.rpm.log"), []byte("log"), os.ModePerm))
+
+	summary, err := CollectBuildSummary(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, []*SrpmResult{results[1], results[0], results[2]}, summary.Results)
+	assert.Equal(t, 1, summary.Count(StatusBuilt))
+	assert.Equal(t, 1, summary.Count(StatusFailed))
+	assert.Equal(t, 1, summary.Count(StatusBlocked))
+}
+
+func TestRemoveResultFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "buildreport")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	resultPath := ResultFilePath(dir, "/srpms/a.src.rpm")
+	logPath := filepath.Join(dir, "a.src.rpm.log")
+	assert.NoError(t, WriteSrpmResult(resultPath, &SrpmResult{SrpmPath: "/srpms/a.src.rpm", Status: StatusFailed}))
+	assert.NoError(t, ioutil.WriteFile(logPath, []byte("log"), os.ModePerm))
+
+	assert.NoError(t, RemoveResultFiles(dir))
+	_, err = os.Stat(resultPath)
+	assert.True(t, os.IsNotExist(err))
+	// Build logs are kept
+	_, err = os.Stat(logPath)
+	assert.NoError(t, err)
+
+	summary, err := CollectBuildSummary(dir)
+	assert.NoError(t, err)
+	assert.Empty(t, summary.Results)
+
+	assert.NoError(t, RemoveResultFiles(filepath.Join(dir, "missing")))
+}
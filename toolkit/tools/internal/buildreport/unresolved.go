@@ -0,0 +1,68 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+// Package buildreport defines the machine readable reports produced while building packages.
+package buildreport
+
+import (
+	"fmt"
+	"strings"
+
+	"microsoft.com/pkggen/internal/jsonutils"
+	"microsoft.com/pkggen/internal/pkgjson"
+)
+
+// UnresolvedReport lists every BuildRequires of an SRPM which could not be satisfied.
+type UnresolvedReport struct {
+	SrpmPath   string                   `json:"SrpmPath"`   // The SRPM which could not be built
+	Unresolved []*UnresolvedRequirement `json:"Unresolved"` // The requirements which could not be satisfied
+}
+
+// UnresolvedRequirement is a single BuildRequires which could not be satisfied.
+type UnresolvedRequirement struct {
+	Requirement *pkgjson.PackageVer `json:"Requirement"` // The BuildRequires as listed in the SPEC
+	Reason      string              `json:"Reason"`      // Why the requirement could not be satisfied
+}
+
+// AddRequirement records an unresolved requirement in the report.
+func (r *UnresolvedReport) AddRequirement(requirement *pkgjson.PackageVer, reason string) {
+	r.Unresolved = append(r.Unresolved, &UnresolvedRequirement{
+		Requirement: requirement,
+		Reason:      reason,
+	})
+}
+
+// String formats the report with one requirement per line.
+func (r *UnresolvedReport) String() string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "%d unresolved BuildRequires for (%s):", len(r.Unresolved), r.SrpmPath)
+	for _, unresolved := range r.Unresolved {
+		fmt.Fprintf(&builder, "\n\t'%s': %s", FormatRequirement(unresolved.Requirement), unresolved.Reason)
+	}
+	return builder.String()
+}
+
+// ReadUnresolvedReport reads an UnresolvedReport from a JSON file.
+func ReadUnresolvedReport(path string) (report *UnresolvedReport, err error) {
+	report = &UnresolvedReport{}
+	err = jsonutils.ReadJSONFile(path, report)
+	return
+}
+
+// WriteUnresolvedReport writes an UnresolvedReport to a JSON file.
+func WriteUnresolvedReport(path string, report *UnresolvedReport) (err error) {
+	return jsonutils.WriteJSONFile(path, report)
+}
+
+// FormatRequirement formats a requirement the way it would appear in a SPEC file.
+func FormatRequirement(pkgVer *pkgjson.PackageVer) string {
+	var builder strings.Builder
+	builder.WriteString(pkgVer.Name)
+	if pkgVer.Version != "" {
+		fmt.Fprintf(&builder, " %s %s", pkgVer.Condition, pkgVer.Version)
+	}
+	if pkgVer.SVersion != "" {
+		fmt.Fprintf(&builder, ", %s %s", pkgVer.SCondition, pkgVer.SVersion)
+	}
+	return builder.String()
+}
@@ -0,0 +1,51 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package buildreport
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"microsoft.com/pkggen/internal/logger"
+	"microsoft.com/pkggen/internal/pkgjson"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitStderrLog()
+	os.Exit(m.Run())
+}
+
+func TestFormatRequirement(t *testing.T) {
+	assert.Equal(t, "foo", FormatRequirement(&pkgjson.PackageVer{Name: "foo"}))
+	assert.Equal(t, "foo >= 1.0", FormatRequirement(&pkgjson.PackageVer{Name: "foo", Condition: ">=", Version: "1.0"}))
+	assert.Equal(t, "foo >= 1.0, < 2.0", FormatRequirement(&pkgjson.PackageVer{Name: "foo", Condition: ">=", Version: "1.0", SCondition: "<", SVersion: "2.0"}))
+}
+
+func TestReportString(t *testing.T) {
+	report := &UnresolvedReport{SrpmPath: "foo.src.rpm"}
+	report.AddRequirement(&pkgjson.PackageVer{Name: "bar"}, "not available")
+	report.AddRequirement(&pkgjson.PackageVer{Name: "/bin/baz"}, "not available")
+
+	assert.Equal(t, "2 unresolved BuildRequires for (foo.src.rpm):\n\t'bar': not available\n\t'/bin/baz': not available", report.String())
+}
+
+func TestReportRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "buildreport")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	report := &UnresolvedReport{SrpmPath: "foo.src.rpm"}
+	report.AddRequirement(&pkgjson.PackageVer{Name: "bar", Condition: "=", Version: "1.0"}, "not available")
+
+	path := filepath.Join(dir, "report.json")
+	err = WriteUnresolvedReport(path, report)
+	assert.NoError(t, err)
+
+	readReport, err := ReadUnresolvedReport(path)
+	assert.NoError(t, err)
+	assert.Equal(t, report, readReport)
+}
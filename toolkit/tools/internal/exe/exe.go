@@ -50,6 +50,11 @@ func LogLevelFlag(k *kingpin.Application) *string {
 	return k.Flag(logger.LevelsFlag, logger.LevelsHelp).PlaceHolder(logger.LevelsPlaceholder).Enum(logger.Levels()...)
 }
 
+// TargetArchFlag registers a target architecture flag for k and returns the passed value
+func TargetArchFlag(k *kingpin.Application) *string {
+	return k.Flag("target-arch", "The rpm architecture to build packages for (e.g. aarch64). Defaults to the host's architecture.").String()
+}
+
 // PlaceHolderize takes a list of available inputs and returns a corresponding placeholder
 func PlaceHolderize(thing []string) string {
 	return fmt.Sprintf("(%s)", strings.Join(thing, "|"))
@@ -0,0 +1,299 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package jsonutils
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// JSONPathRoot is the JSON path of a document's root value.
+const JSONPathRoot = "$"
+
+// identifierKey matches object keys which can be used in a JSON path without quoting them.
+var identifierKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Location is the position of a value inside a JSON document. Line and Column start at 1.
+type Location struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+// ValueLocations maps the JSON path of every value in a document to its location.
+type ValueLocations struct {
+	exact  map[string]Location
+	folded map[string]Location
+}
+
+// JSONPathMember returns the JSON path of the member called key inside the object at parent.
+func JSONPathMember(parent, key string) string {
+	if identifierKey.MatchString(key) {
+		return fmt.Sprintf("%s.%s", parent, key)
+	}
+	return fmt.Sprintf("%s[%s]", parent, strconv.Quote(key))
+}
+
+// JSONPathIndex returns the JSON path of the element at index inside the array at parent.
+func JSONPathIndex(parent string, index int) string {
+	return fmt.Sprintf("%s[%d]", parent, index)
+}
+
+// LocateValues finds the location of every value in a JSON document.
+func LocateValues(data []byte) (locations *ValueLocations, err error) {
+	locator := &valueLocator{
+		data:       data,
+		lineStarts: []int{0},
+		locations: &ValueLocations{
+			exact:  make(map[string]Location),
+			folded: make(map[string]Location),
+		},
+	}
+	for i, char := range data {
+		if char == '\n' {
+			locator.lineStarts = append(locator.lineStarts, i+1)
+		}
+	}
+
+	err = locator.value(JSONPathRoot)
+	if err != nil {
+		return
+	}
+
+	locator.skipWhitespace()
+	if locator.offset != len(data) {
+		err = locator.errorf("unexpected data after the top-level value")
+		return
+	}
+
+	locations = locator.locations
+	return
+}
+
+// Find returns the location of the value at path. Object keys are matched case-insensitively if there is no exact
+// match, as encoding/json does. If the path does not exist, the location of its closest existing parent is returned.
+func (v *ValueLocations) Find(path string) (location Location, found bool) {
+	for path != "" {
+		location, found = v.exact[path]
+		if found {
+			return
+		}
+
+		location, found = v.folded[strings.ToLower(path)]
+		if found {
+			return
+		}
+
+		path = parentJSONPath(path)
+	}
+	return
+}
+
+// OffsetToLocation converts a byte offset inside data to a Location.
+func OffsetToLocation(data []byte, offset int) (location Location) {
+	if offset > len(data) {
+		offset = len(data)
+	}
+
+	lineStart := 0
+	location = Location{Offset: offset, Line: 1}
+	for i := 0; i < offset; i++ {
+		if data[i] == '\n' {
+			location.Line++
+			lineStart = i + 1
+		}
+	}
+	location.Column = utf8.RuneCount(data[lineStart:offset]) + 1
+	return
+}
+
+// parentJSONPath returns the path of the value containing path, or an empty string for the root.
+func parentJSONPath(path string) (parent string) {
+	lastSegment := -1
+	inQuotes := false
+	for i := 0; i < len(path); i++ {
+		switch {
+		case inQuotes && path[i] == '\\':
+			i++
+		case path[i] == '"':
+			inQuotes = !inQuotes
+		case !inQuotes && (path[i] == '.' || path[i] == '['):
+			lastSegment = i
+		}
+	}
+
+	if lastSegment < 0 {
+		return ""
+	}
+	return path[:lastSegment]
+}
+
+// valueLocator is a minimal JSON scanner which records the location of each value it reads.
+type valueLocator struct {
+	data       []byte
+	offset     int
+	lineStarts []int
+	locations  *ValueLocations
+}
+
+// location returns the Location of the current offset.
+func (l *valueLocator) location() Location {
+	line := sort.Search(len(l.lineStarts), func(i int) bool { return l.lineStarts[i] > l.offset })
+	lineStart := l.lineStarts[line-1]
+	return Location{
+		Offset: l.offset,
+		Line:   line,
+		Column: utf8.RuneCount(l.data[lineStart:l.offset]) + 1,
+	}
+}
+
+func (l *valueLocator) errorf(format string, args ...interface{}) error {
+	location := l.location()
+	return fmt.Errorf("line %d, column %d: %s", location.Line, location.Column, fmt.Sprintf(format, args...))
+}
+
+func (l *valueLocator) skipWhitespace() {
+	for l.offset < len(l.data) && strings.IndexByte(" \t\r\n", l.data[l.offset]) >= 0 {
+		l.offset++
+	}
+}
+
+func (l *valueLocator) expect(char byte) (err error) {
+	l.skipWhitespace()
+	if l.offset >= len(l.data) || l.data[l.offset] != char {
+		return l.errorf("expected '%c'", char)
+	}
+	l.offset++
+	return
+}
+
+func (l *valueLocator) value(path string) (err error) {
+	l.skipWhitespace()
+	if l.offset >= len(l.data) {
+		return l.errorf("unexpected end of data")
+	}
+
+	location := l.location()
+	l.locations.exact[path] = location
+	l.locations.folded[strings.ToLower(path)] = location
+
+	switch l.data[l.offset] {
+	case '{':
+		return l.object(path)
+	case '[':
+		return l.array(path)
+	case '"':
+		_, err = l.str()
+		return
+	default:
+		start := l.offset
+		for l.offset < len(l.data) && strings.IndexByte(" \t\r\n,]}", l.data[l.offset]) < 0 {
+			l.offset++
+		}
+		if start == l.offset {
+			return l.errorf("unexpected character '%c'", l.data[l.offset])
+		}
+		return
+	}
+}
+
+func (l *valueLocator) object(path string) (err error) {
+	// Skip the opening brace
+	l.offset++
+
+	l.skipWhitespace()
+	if l.offset < len(l.data) && l.data[l.offset] == '}' {
+		l.offset++
+		return
+	}
+
+	for {
+		l.skipWhitespace()
+		if l.offset >= len(l.data) || l.data[l.offset] != '"' {
+			return l.errorf("expected an object key")
+		}
+
+		var key string
+		key, err = l.str()
+		if err != nil {
+			return
+		}
+
+		err = l.expect(':')
+		if err != nil {
+			return
+		}
+
+		err = l.value(JSONPathMember(path, key))
+		if err != nil {
+			return
+		}
+
+		l.skipWhitespace()
+		if l.offset < len(l.data) && l.data[l.offset] == '}' {
+			l.offset++
+			return
+		}
+
+		err = l.expect(',')
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (l *valueLocator) array(path string) (err error) {
+	// Skip the opening bracket
+	l.offset++
+
+	l.skipWhitespace()
+	if l.offset < len(l.data) && l.data[l.offset] == ']' {
+		l.offset++
+		return
+	}
+
+	for index := 0; ; index++ {
+		err = l.value(JSONPathIndex(path, index))
+		if err != nil {
+			return
+		}
+
+		l.skipWhitespace()
+		if l.offset < len(l.data) && l.data[l.offset] == ']' {
+			l.offset++
+			return
+		}
+
+		err = l.expect(',')
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (l *valueLocator) str() (value string, err error) {
+	start := l.offset
+
+	// Skip the opening quote
+	l.offset++
+	for l.offset < len(l.data) {
+		switch l.data[l.offset] {
+		case '\\':
+			l.offset += 2
+		case '"':
+			l.offset++
+			err = json.Unmarshal(l.data[start:l.offset], &value)
+			return
+		default:
+			l.offset++
+		}
+	}
+
+	return "", l.errorf("unterminated string")
+}
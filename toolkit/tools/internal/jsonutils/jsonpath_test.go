@@ -0,0 +1,85 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package jsonutils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testDocument = `{
+    "Name": "test",
+    "List": [1, {"Nested": true}],
+    "Map": {"some/path": "value", "ÜberKey": null}
+}`
+
+func TestJSONPaths(t *testing.T) {
+	assert.Equal(t, "$.Name", JSONPathMember(JSONPathRoot, "Name"))
+	assert.Equal(t, `$["some/path"]`, JSONPathMember(JSONPathRoot, "some/path"))
+	assert.Equal(t, "$.List[2]", JSONPathIndex(JSONPathMember(JSONPathRoot, "List"), 2))
+}
+
+func TestLocateValues(t *testing.T) {
+	locations, err := LocateValues([]byte(testDocument))
+	assert.NoError(t, err)
+
+	tests := []struct {
+		path   string
+		line   int
+		column int
+	}{
+		{"$", 1, 1},
+		{"$.Name", 2, 13},
+		{"$.List[0]", 3, 14},
+		{"$.List[1].Nested", 3, 28},
+		{`$.Map["some/path"]`, 4, 26},
+		{`$.Map["ÜberKey"]`, 4, 46},
+	}
+
+	for _, test := range tests {
+		location, found := locations.Find(test.path)
+		assert.True(t, found, test.path)
+		assert.Equal(t, test.line, location.Line, test.path)
+		assert.Equal(t, test.column, location.Column, test.path)
+	}
+}
+
+func TestFindShouldFallBackToParent(t *testing.T) {
+	locations, err := LocateValues([]byte(testDocument))
+	assert.NoError(t, err)
+
+	// Members are matched case-insensitively, as encoding/json does
+	location, found := locations.Find("$.list[1].nested")
+	assert.True(t, found)
+	assert.Equal(t, 28, location.Column)
+
+	// Missing values resolve to their closest parent
+	location, found = locations.Find(`$.List[1].Missing["a.b"]`)
+	assert.True(t, found)
+	assert.Equal(t, 3, location.Line)
+	assert.Equal(t, 17, location.Column)
+}
+
+func TestLocateValuesShouldFailOnInvalidJSON(t *testing.T) {
+	invalid := []string{
+		``,
+		`{"a": }`,
+		`{"a": 1,}`,
+		`[1 2]`,
+		`{"a": "unterminated}`,
+		`{} {}`,
+	}
+
+	for _, document := range invalid {
+		_, err := LocateValues([]byte(document))
+		assert.Error(t, err, document)
+	}
+}
+
+func TestOffsetToLocation(t *testing.T) {
+	data := []byte("ab\nçd\n")
+	assert.Equal(t, Location{Offset: 0, Line: 1, Column: 1}, OffsetToLocation(data, 0))
+	assert.Equal(t, Location{Offset: 5, Line: 2, Column: 2}, OffsetToLocation(data, 5))
+}
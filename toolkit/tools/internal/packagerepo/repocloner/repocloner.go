@@ -30,6 +30,7 @@ type RepoCloner interface {
 	SearchAndClone(cloneDeps bool, singlePackageToClone *pkgjson.PackageVer) error
 	ConvertDownloadedPackagesIntoRepo() error
 	ClonedRepoContents() (repoContents *RepoContents, err error)
+	ClonedPackageOrigins() (origins map[string]string, err error)
 	CloneDirectory() string
 	Close() error
 }
@@ -0,0 +1,352 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package repodatacloner
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"microsoft.com/pkggen/internal/file"
+	"microsoft.com/pkggen/internal/logger"
+	"microsoft.com/pkggen/internal/packagerepo/repocloner"
+	"microsoft.com/pkggen/internal/packagerepo/repodata"
+	"microsoft.com/pkggen/internal/packagerepo/repomanager/rpmrepomanager"
+	"microsoft.com/pkggen/internal/pkgjson"
+	"microsoft.com/pkggen/internal/shell"
+)
+
+const (
+	builtRepoID   = "local-repo"
+	cachedRepoID  = "upstream-cache-repo"
+	fetcherRepoID = "fetcher-cloned-repo"
+	updateRepoID  = "mariner-official-update"
+	previewRepoID = "mariner-preview"
+
+	basearchVariable = "$basearch"
+)
+
+// repoDefinition is a single repository section of a repo file.
+type repoDefinition struct {
+	id      string
+	baseURL string
+	enabled bool
+}
+
+// RepodataCloner represents an RPM repository cloner which resolves packages by reading the
+// repositories' metadata directly, instead of running tdnf inside a chroot. It does not require root,
+// but only supports local repositories.
+type RepodataCloner struct {
+	cloneDir    string
+	metadataDir string
+	arch        string
+	resolver    *repodata.Resolver
+	origins     map[string]string
+}
+
+// New creates a new RepodataCloner
+func New() *RepodataCloner {
+	return &RepodataCloner{
+		origins: make(map[string]string),
+	}
+}
+
+// Initialize initializes repodatacloner, enabling Clone() to be called.
+//  - destinationDir is the directory to save RPMs
+//  - tmpDir is the directory to generate missing repository metadata in
+//  - workerTar is unused, no chroot is created
+//  - existingRpmsDir is the directory with prebuilt RPMs
+//  - useUpdateRepo if set, the upstream update repository will be used.
+//  - usePreviewRepo if set, the upstream preview repository will be used.
+//  - repoDefinitions is a list of repo files to use when cloning RPMs
+func (r *RepodataCloner) Initialize(destinationDir, tmpDir, workerTar, existingRpmsDir string, useUpdateRepo, usePreviewRepo bool, repoDefinitions []string) (err error) {
+	const metadataDirPrefix = "repodatacloner"
+
+	err = os.MkdirAll(destinationDir, os.ModePerm)
+	if err != nil {
+		logger.Log.Warnf("Could not create download directory (%s)", destinationDir)
+		return
+	}
+	r.cloneDir = destinationDir
+
+	err = os.MkdirAll(tmpDir, os.ModePerm)
+	if err != nil {
+		return
+	}
+	r.metadataDir, err = ioutil.TempDir(tmpDir, metadataDirPrefix)
+	if err != nil {
+		return
+	}
+
+	stdout, stderr, err := shell.Execute("uname", "-m")
+	if err != nil {
+		logger.Log.Warnf("Could not fetch current architecture from shell: %v", stderr)
+		return
+	}
+	r.arch = strings.TrimSpace(stdout)
+
+	// Consider the built RPMs first, then the already cached (e.g. toolchain), and finally all remote packages.
+	// The built and cached RPMs may not have metadata, so generate it outside of their directories.
+	var repos []*repodata.Repo
+	for _, localRepo := range []repoDefinition{{id: builtRepoID, baseURL: existingRpmsDir}, {id: cachedRepoID, baseURL: destinationDir}} {
+		var repo *repodata.Repo
+		repo, err = r.loadLocalRPMs(localRepo.id, localRepo.baseURL)
+		if err != nil {
+			return
+		}
+		repos = append(repos, repo)
+	}
+
+	for _, repoFile := range repoDefinitions {
+		var definitions []repoDefinition
+		definitions, err = readRepoFile(repoFile)
+		if err != nil {
+			return
+		}
+
+		for _, definition := range definitions {
+			switch {
+			case !definition.enabled:
+				continue
+			case definition.id == builtRepoID || definition.id == cachedRepoID || definition.id == fetcherRepoID:
+				// These point inside the tdnf worker chroot, the directories they refer to are already loaded above
+				continue
+			case definition.id == updateRepoID && !useUpdateRepo:
+				continue
+			case definition.id == previewRepoID && !usePreviewRepo:
+				continue
+			}
+
+			var repo *repodata.Repo
+			repo, err = r.loadRepo(definition)
+			if err != nil {
+				return
+			}
+			if repo != nil {
+				repos = append(repos, repo)
+			}
+		}
+	}
+
+	r.resolver = repodata.NewResolver(r.arch, repos...)
+	return
+}
+
+// AddNetworkFiles is a no-op, only local repositories are supported.
+func (r *RepodataCloner) AddNetworkFiles(tlsClientCert, tlsClientKey string) (err error) {
+	if tlsClientCert != "" || tlsClientKey != "" {
+		logger.Log.Warn("Ignoring TLS client certificate, only local repositories are supported")
+	}
+	return
+}
+
+// Clone clones the provided list of packages.
+// If cloneDeps is set, package dependencies will also be cloned.
+// It will automatically resolve packages that describe a provide or file from a package.
+func (r *RepodataCloner) Clone(cloneDeps bool, packagesToClone ...*pkgjson.PackageVer) (err error) {
+	var pkgs []*repodata.Package
+
+	if cloneDeps {
+		pkgs, err = r.resolver.ResolveWithDependencies(packagesToClone...)
+		if err != nil {
+			return
+		}
+	} else {
+		for _, pkgVer := range packagesToClone {
+			var pkg *repodata.Package
+			pkg, err = r.resolver.Resolve(pkgVer)
+			if err != nil {
+				return
+			}
+			pkgs = append(pkgs, pkg)
+		}
+	}
+
+	for _, pkg := range pkgs {
+		err = r.clonePackage(pkg)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// SearchAndClone attempts to find a package which supplies the requested file or package. It
+// wraps Clone() to acquire the requested package once found.
+func (r *RepodataCloner) SearchAndClone(cloneDeps bool, singlePackageToClone *pkgjson.PackageVer) (err error) {
+	const strictComparisonOperator = "="
+
+	pkg, err := r.resolver.Resolve(singlePackageToClone)
+	if err != nil {
+		logger.Log.Errorf("Failed to lookup dependency '%s'", singlePackageToClone.Name)
+		return
+	}
+
+	logger.Log.Warnf("Translated '%s' to package '%s'", singlePackageToClone.Name, pkg.Name)
+
+	err = r.Clone(cloneDeps, &pkgjson.PackageVer{Name: pkg.Name, Epoch: pkg.Epoch, Version: pkg.VersionRelease(), Condition: strictComparisonOperator})
+	return
+}
+
+// ConvertDownloadedPackagesIntoRepo initializes the downloaded RPMs into an RPM repository.
+func (r *RepodataCloner) ConvertDownloadedPackagesIntoRepo() (err error) {
+	err = rpmrepomanager.OrganizePackagesByArch(r.cloneDir, r.cloneDir)
+	if err != nil {
+		return
+	}
+
+	err = rpmrepomanager.CreateRepo(r.cloneDir)
+	return
+}
+
+// ClonedRepoContents returns the packages contained in the cloned repository.
+func (r *RepodataCloner) ClonedRepoContents() (repoContents *repocloner.RepoContents, err error) {
+	repo, err := repodata.Load(fetcherRepoID, r.cloneDir, r.cloneDir)
+	if err != nil {
+		return
+	}
+
+	pkgs := append([]*repodata.Package(nil), repo.Packages...)
+	sort.Slice(pkgs, func(i, j int) bool {
+		if pkgs[i].Name != pkgs[j].Name {
+			return pkgs[i].Name < pkgs[j].Name
+		}
+		return pkgs[i].Arch < pkgs[j].Arch
+	})
+
+	repoContents = &repocloner.RepoContents{}
+	for _, pkg := range pkgs {
+		// The distribution tag is the last component of the release, e.g. "cm1" in "4.cm1"
+		release, distribution := pkg.Release, ""
+		if index := strings.LastIndex(release, "."); index >= 0 {
+			release, distribution = release[:index], release[index+1:]
+		}
+
+		repoContents.Repo = append(repoContents.Repo, &repocloner.RepoPackage{
+			Name:         pkg.Name,
+			Version:      fmt.Sprintf("%s-%s", pkg.Version, release),
+			Architecture: pkg.Arch,
+			Distribution: distribution,
+		})
+	}
+
+	return
+}
+
+// ClonedPackageOrigins returns the ID of the repository each package was resolved from, keyed by the package's
+// RPM file name. Only packages resolved by this cloner are included.
+func (r *RepodataCloner) ClonedPackageOrigins() (origins map[string]string, err error) {
+	origins = make(map[string]string, len(r.origins))
+	for rpmName, repoID := range r.origins {
+		origins[rpmName] = repoID
+	}
+	return
+}
+
+// CloneDirectory returns the directory where cloned packages are saved.
+func (r *RepodataCloner) CloneDirectory() string {
+	return r.cloneDir
+}
+
+// Close removes the metadata generated by the cloner.
+func (r *RepodataCloner) Close() error {
+	return os.RemoveAll(r.metadataDir)
+}
+
+// clonePackage copies a package's RPM into the clone directory, unless it is already present.
+func (r *RepodataCloner) clonePackage(pkg *repodata.Package) (err error) {
+	rpmName := filepath.Base(pkg.Location)
+	r.origins[rpmName] = pkg.Repo.ID
+
+	for _, dst := range []string{filepath.Join(r.cloneDir, rpmName), filepath.Join(r.cloneDir, pkg.Arch, rpmName)} {
+		exists, _ := file.PathExists(dst)
+		if exists {
+			logger.Log.Debugf("%s already cloned, skipping", rpmName)
+			return
+		}
+	}
+
+	logger.Log.Debugf("Cloning: %s from repository (%s)", pkg, pkg.Repo.ID)
+	return file.Copy(pkg.Path(), filepath.Join(r.cloneDir, rpmName))
+}
+
+// loadRepo loads the metadata of a repository from a repo file. Repositories which are not local are skipped.
+func (r *RepodataCloner) loadRepo(definition repoDefinition) (repo *repodata.Repo, err error) {
+	baseURL := strings.ReplaceAll(definition.baseURL, basearchVariable, r.arch)
+	baseDir, err := repodata.BaseDirFromURL(baseURL)
+	if err != nil {
+		logger.Log.Warnf("Skipping repository (%s): %s", definition.id, err)
+		err = nil
+		return
+	}
+
+	logger.Log.Infof("Loading repository (%s) from (%s)", definition.id, baseDir)
+	return repodata.Load(definition.id, baseDir, baseDir)
+}
+
+// loadLocalRPMs loads the metadata of a directory of RPMs, generating it in the cloner's metadata directory.
+// The directory itself is left untouched.
+func (r *RepodataCloner) loadLocalRPMs(id, rpmsDir string) (repo *repodata.Repo, err error) {
+	metadataDir := filepath.Join(r.metadataDir, id)
+	err = os.MkdirAll(metadataDir, os.ModePerm)
+	if err != nil {
+		return
+	}
+
+	logger.Log.Infof("Generating repository (%s) metadata for (%s)", id, rpmsDir)
+	_, stderr, err := shell.Execute("createrepo", "--outputdir", metadataDir, rpmsDir)
+	if err != nil {
+		logger.Log.Warn(stderr)
+		return
+	}
+
+	return repodata.Load(id, metadataDir, rpmsDir)
+}
+
+// readRepoFile parses the repository sections of a repo file.
+func readRepoFile(repoFilePath string) (definitions []repoDefinition, err error) {
+	repoFile, err := os.Open(repoFilePath)
+	if err != nil {
+		return
+	}
+	defer repoFile.Close()
+
+	var current *repoDefinition
+	scanner := bufio.NewScanner(repoFile)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";"):
+			continue
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			definitions = append(definitions, repoDefinition{id: strings.TrimSpace(line[1 : len(line)-1]), enabled: true})
+			current = &definitions[len(definitions)-1]
+			continue
+		case current == nil:
+			continue
+		}
+
+		keyValue := strings.SplitN(line, "=", 2)
+		if len(keyValue) != 2 {
+			continue
+		}
+
+		key, value := strings.TrimSpace(keyValue[0]), strings.TrimSpace(keyValue[1])
+		switch key {
+		case "baseurl":
+			current.baseURL = value
+		case "enabled":
+			current.enabled = value == "1"
+		}
+	}
+
+	err = scanner.Err()
+	return
+}
@@ -36,6 +36,9 @@ var (
 
 	// Every valid line will be of the form: <package_name>.<architecture> <version>.<dist>  fetcher-cloned-repo
 	listedPackageRegex = regexp.MustCompile(`^\s*(?P<Name>[a-zA-Z0-9_+-]+)\.(?P<Arch>[a-zA-Z0-9_+-]+)\s*(?P<Version>[a-zA-Z0-9._+-]+)\.(?P<Dist>[a-zA-Z0-9_+-]+)\s*fetcher-cloned-repo`)
+
+	// Every valid line will be of the form: <package_name>.<architecture> <version>.<dist>  <repo_id>
+	availablePackageRegex = regexp.MustCompile(`^\s*(?P<Name>[a-zA-Z0-9_+-]+)\.(?P<Arch>[a-zA-Z0-9_+-]+)\s*(?P<Version>[a-zA-Z0-9._+-]+)\.(?P<Dist>[a-zA-Z0-9_+-]+)\s*(?P<Repo>[a-zA-Z0-9._+-]+)\s*$`)
 )
 
 const (
@@ -47,6 +50,21 @@ const (
 	listMaxMatchLen    = iota
 )
 
+const (
+	availableMatchSubString = iota
+	availablePackageName    = iota
+	availablePackageArch    = iota
+	availablePackageVersion = iota
+	availablePackageDist    = iota
+	availablePackageRepo    = iota
+	availableMaxMatchLen    = iota
+)
+
+const (
+	builtRepoID  = "local-repo"
+	cachedRepoID = "upstream-cache-repo"
+)
+
 // RpmRepoCloner represents an RPM repository cloner.
 type RpmRepoCloner struct {
 	chroot         *safechroot.Chroot
@@ -247,9 +265,7 @@ func (r *RpmRepoCloner) Clone(cloneDeps bool, packagesToClone ...*pkgjson.Packag
 		lessThanOrEqualComparisonOperator = "<="
 		versionSuffixFormat               = "-%s"
 
-		builtRepoID  = "local-repo"
-		cachedRepoID = "upstream-cache-repo"
-		allRepoIDs   = "*"
+		allRepoIDs = "*"
 	)
 
 	for _, pkg := range packagesToClone {
@@ -259,7 +275,7 @@ func (r *RpmRepoCloner) Clone(cloneDeps bool, packagesToClone ...*pkgjson.Packag
 		// Treat <= as =
 		// Treat > and >= as "latest"
 		if pkg.Condition == strictComparisonOperator || pkg.Condition == lessThanOrEqualComparisonOperator {
-			builder.WriteString(fmt.Sprintf(versionSuffixFormat, pkg.Version))
+			builder.WriteString(fmt.Sprintf(versionSuffixFormat, pkg.EVR()))
 		}
 
 		pkgName := builder.String()
@@ -412,6 +428,77 @@ func (r *RpmRepoCloner) ClonedRepoContents() (repoContents *repocloner.RepoConte
 	return
 }
 
+// ClonedPackageOrigins returns the ID of the repository each cloned package is available from, keyed by the
+// package's RPM file name. If several repositories offer the same package the one tdnf prefers when cloning is used.
+// Packages tdnf does not list as available are omitted.
+func (r *RpmRepoCloner) ClonedPackageOrigins() (origins map[string]string, err error) {
+	repoPriorities := map[string]int{
+		builtRepoID:  0,
+		cachedRepoID: 1,
+	}
+	const defaultPriority = 2
+
+	repoContents, err := r.ClonedRepoContents()
+	if err != nil {
+		return
+	}
+
+	clonedRPMs := make(map[string]bool)
+	for _, pkg := range repoContents.Repo {
+		clonedRPMs[fmt.Sprintf("%s-%s.%s.%s.rpm", pkg.Name, pkg.Version, pkg.Distribution, pkg.Architecture)] = true
+	}
+
+	origins = make(map[string]string)
+	priority := func(repoID string) int {
+		if value, found := repoPriorities[repoID]; found {
+			return value
+		}
+		return defaultPriority
+	}
+
+	onStdout := func(args ...interface{}) {
+		if len(args) == 0 {
+			return
+		}
+
+		line := args[0].(string)
+		matches := availablePackageRegex.FindStringSubmatch(line)
+		if len(matches) != availableMaxMatchLen {
+			return
+		}
+
+		repoID := matches[availablePackageRepo]
+		rpmName := fmt.Sprintf("%s-%s.%s.%s.rpm", matches[availablePackageName], matches[availablePackageVersion], matches[availablePackageDist], matches[availablePackageArch])
+		if !clonedRPMs[rpmName] || repoID == fetcherRepoID {
+			return
+		}
+
+		if previous, found := origins[rpmName]; !found || priority(repoID) < priority(previous) {
+			origins[rpmName] = repoID
+		}
+	}
+
+	err = r.chroot.Run(func() (err error) {
+		tdnfArgs := []string{
+			"list",
+			"available",
+			fmt.Sprintf("--disablerepo=%s", fetcherRepoID),
+		}
+
+		if !r.useUpdateRepo {
+			tdnfArgs = append(tdnfArgs, fmt.Sprintf("--disablerepo=%s", updateRepoID))
+		}
+
+		if !r.usePreviewRepo {
+			tdnfArgs = append(tdnfArgs, fmt.Sprintf("--disablerepo=%s", previewRepoID))
+		}
+
+		return shell.ExecuteLiveWithCallback(onStdout, logger.Log.Warn, "tdnf", tdnfArgs...)
+	})
+
+	return
+}
+
 // CloneDirectory returns the directory where cloned packages are saved.
 func (r *RpmRepoCloner) CloneDirectory() string {
 	return r.cloneDir
@@ -0,0 +1,412 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package repodata
+
+import (
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ulikunitz/xz"
+	"microsoft.com/pkggen/internal/logger"
+	"microsoft.com/pkggen/internal/pkgjson"
+)
+
+const (
+	// RepoDataDir is the directory inside a repository holding its metadata.
+	RepoDataDir = "repodata"
+
+	repoMDFile        = "repomd.xml"
+	primaryDataType   = "primary"
+	fileListsDataType = "filelists"
+	fileURLScheme     = "file"
+)
+
+// conditions maps the comparison flags used in repository metadata to the conditions used by pkgjson.
+var conditions = map[string]string{
+	"EQ": "=",
+	"LT": "<",
+	"LE": "<=",
+	"GT": ">",
+	"GE": ">=",
+}
+
+// Repo is the metadata of an RPM repository.
+type Repo struct {
+	ID       string     // Identifier of the repository, used when logging
+	BaseDir  string     // Directory package locations are relative to
+	Packages []*Package // Every package in the repository
+
+	fileListsPath   string
+	fileListsLoaded bool
+	packagesByID    map[string]*Package
+	provides        map[string][]*Package
+	files           map[string][]*Package
+}
+
+// Package is a single package described by a repository's metadata.
+type Package struct {
+	Name      string
+	Arch      string
+	Epoch     string
+	Version   string
+	Release   string
+	Checksum  string // The package's ID, as used to match filelists entries
+	Location  string // Path of the RPM, relative to the repository's BaseDir
+	SourceRPM string
+	Provides  []*pkgjson.PackageVer
+	Requires  []*pkgjson.PackageVer
+	Files     []string // Files owned by the package, only complete once the repository's file lists are loaded
+
+	Repo *Repo
+}
+
+type repoMD struct {
+	Data []repoMDData `xml:"data"`
+}
+
+type repoMDData struct {
+	Type     string         `xml:"type,attr"`
+	Location repoMDLocation `xml:"location"`
+}
+
+type repoMDLocation struct {
+	Href string `xml:"href,attr"`
+}
+
+type primaryMetadata struct {
+	Packages []primaryPackage `xml:"package"`
+}
+
+type primaryPackage struct {
+	Type     string         `xml:"type,attr"`
+	Name     string         `xml:"name"`
+	Arch     string         `xml:"arch"`
+	Version  packageVersion `xml:"version"`
+	Checksum string         `xml:"checksum"`
+	Location repoMDLocation `xml:"location"`
+	Format   primaryFormat  `xml:"format"`
+}
+
+type packageVersion struct {
+	Epoch   string `xml:"epoch,attr"`
+	Version string `xml:"ver,attr"`
+	Release string `xml:"rel,attr"`
+}
+
+type primaryFormat struct {
+	SourceRPM string          `xml:"sourcerpm"`
+	Provides  []metadataEntry `xml:"provides>entry"`
+	Requires  []metadataEntry `xml:"requires>entry"`
+	Files     []string        `xml:"file"`
+}
+
+type metadataEntry struct {
+	Name    string `xml:"name,attr"`
+	Flags   string `xml:"flags,attr"`
+	Epoch   string `xml:"epoch,attr"`
+	Version string `xml:"ver,attr"`
+	Release string `xml:"rel,attr"`
+}
+
+type fileListsMetadata struct {
+	Packages []fileListsPackage `xml:"package"`
+}
+
+type fileListsPackage struct {
+	ID    string   `xml:"pkgid,attr"`
+	Files []string `xml:"file"`
+}
+
+// BaseDirFromURL converts a repository's base URL into a local directory.
+// Only plain paths and file:// URLs are supported.
+func BaseDirFromURL(baseURL string) (baseDir string, err error) {
+	parsedURL, err := url.Parse(baseURL)
+	if err != nil {
+		return
+	}
+
+	switch parsedURL.Scheme {
+	case "":
+		baseDir = baseURL
+	case fileURLScheme:
+		baseDir = parsedURL.Path
+	default:
+		err = fmt.Errorf("unsupported repository URL (%s), only local repositories are supported", baseURL)
+	}
+
+	return
+}
+
+// Load reads the primary metadata of a repository. metadataDir is the directory containing the repository's
+// repodata directory, baseDir is the directory the package locations are relative to. They are usually the same,
+// unless the metadata was generated outside of the repository.
+// File lists are only read once they are needed, see LoadFileLists.
+func Load(id, metadataDir, baseDir string) (repo *Repo, err error) {
+	repoMDPath := filepath.Join(metadataDir, RepoDataDir, repoMDFile)
+	logger.Log.Debugf("Loading repository (%s) metadata from (%s)", id, repoMDPath)
+
+	var index repoMD
+	err = decodeXMLFile(repoMDPath, &index)
+	if err != nil {
+		return
+	}
+
+	var primaryPath string
+	repo = &Repo{
+		ID:           id,
+		BaseDir:      baseDir,
+		packagesByID: make(map[string]*Package),
+		provides:     make(map[string][]*Package),
+		files:        make(map[string][]*Package),
+	}
+	for _, data := range index.Data {
+		switch data.Type {
+		case primaryDataType:
+			primaryPath = filepath.Join(metadataDir, data.Location.Href)
+		case fileListsDataType:
+			repo.fileListsPath = filepath.Join(metadataDir, data.Location.Href)
+		}
+	}
+
+	if primaryPath == "" {
+		err = fmt.Errorf("repository metadata (%s) does not list any primary data", repoMDPath)
+		return
+	}
+
+	var primary primaryMetadata
+	err = decodeXMLFile(primaryPath, &primary)
+	if err != nil {
+		return
+	}
+
+	for _, primaryPkg := range primary.Packages {
+		if primaryPkg.Type != "" && primaryPkg.Type != "rpm" {
+			continue
+		}
+		repo.addPackage(newPackage(repo, primaryPkg))
+	}
+
+	logger.Log.Debugf("Repository (%s) contains %d packages", id, len(repo.Packages))
+	return
+}
+
+// LoadFileLists reads the complete list of files owned by each package in the repository.
+// The primary metadata only lists commonly required files, such as those in /etc or bin directories.
+func (r *Repo) LoadFileLists() (err error) {
+	if r.fileListsLoaded {
+		return
+	}
+	r.fileListsLoaded = true
+
+	if r.fileListsPath == "" {
+		logger.Log.Debugf("Repository (%s) has no file lists", r.ID)
+		return
+	}
+
+	logger.Log.Debugf("Loading repository (%s) file lists from (%s)", r.ID, r.fileListsPath)
+
+	var fileLists fileListsMetadata
+	err = decodeXMLFile(r.fileListsPath, &fileLists)
+	if err != nil {
+		return
+	}
+
+	for _, fileListsPkg := range fileLists.Packages {
+		pkg, found := r.packagesByID[fileListsPkg.ID]
+		if !found {
+			logger.Log.Warnf("Repository (%s) file lists reference unknown package ID (%s)", r.ID, fileListsPkg.ID)
+			continue
+		}
+
+		for _, path := range fileListsPkg.Files {
+			if !pkg.ownsFile(path) {
+				pkg.Files = append(pkg.Files, path)
+				r.files[path] = append(r.files[path], pkg)
+			}
+		}
+	}
+
+	return
+}
+
+// FindProviders returns the packages in the repository providing the name of the requirement, regardless of version.
+// Requirements starting with '/' are matched against the files owned by the packages.
+func (r *Repo) FindProviders(name string) (providers []*Package) {
+	if strings.HasPrefix(name, "/") {
+		return r.files[name]
+	}
+	return r.provides[name]
+}
+
+// VersionRelease returns the package's version and release, separated with a '-'.
+func (p *Package) VersionRelease() string {
+	return joinVersionRelease(p.Version, p.Release)
+}
+
+// EVR returns the package's epoch, version and release in the [epoch:]version-release form.
+func (p *Package) EVR() string {
+	return (&pkgjson.PackageVer{Epoch: p.Epoch, Version: p.VersionRelease()}).EVR()
+}
+
+// String returns the package's name, version, release and architecture.
+func (p *Package) String() string {
+	return fmt.Sprintf("%s-%s.%s", p.Name, p.VersionRelease(), p.Arch)
+}
+
+// Path returns the location of the package's RPM on disk.
+func (p *Package) Path() string {
+	return filepath.Join(p.Repo.BaseDir, p.Location)
+}
+
+// Satisfies returns true if the package provides a version of the requirement within its interval.
+func (p *Package) Satisfies(requirement *pkgjson.PackageVer) (satisfies bool, err error) {
+	if strings.HasPrefix(requirement.Name, "/") {
+		satisfies = p.ownsFile(requirement.Name)
+		return
+	}
+
+	requiredInterval, err := requirement.Interval()
+	if err != nil {
+		return
+	}
+
+	for _, provide := range p.Provides {
+		if provide.Name != requirement.Name {
+			continue
+		}
+
+		var providedInterval pkgjson.PackageVerInterval
+		providedInterval, err = provide.Interval()
+		if err != nil {
+			return
+		}
+
+		if providedInterval.Satisfies(&requiredInterval) {
+			satisfies = true
+			return
+		}
+	}
+
+	return
+}
+
+func (p *Package) ownsFile(path string) bool {
+	for _, ownedFile := range p.Files {
+		if ownedFile == path {
+			return true
+		}
+	}
+	return false
+}
+
+// addPackage adds pkg to the repository and its indexes.
+func (r *Repo) addPackage(pkg *Package) {
+	r.Packages = append(r.Packages, pkg)
+	r.packagesByID[pkg.Checksum] = pkg
+
+	providedNames := map[string]bool{pkg.Name: true}
+	r.provides[pkg.Name] = append(r.provides[pkg.Name], pkg)
+	for _, provide := range pkg.Provides {
+		if !providedNames[provide.Name] {
+			providedNames[provide.Name] = true
+			r.provides[provide.Name] = append(r.provides[provide.Name], pkg)
+		}
+	}
+
+	for _, path := range pkg.Files {
+		r.files[path] = append(r.files[path], pkg)
+	}
+}
+
+// newPackage converts a package from the primary metadata.
+func newPackage(repo *Repo, primaryPkg primaryPackage) (pkg *Package) {
+	pkg = &Package{
+		Name:      primaryPkg.Name,
+		Arch:      primaryPkg.Arch,
+		Epoch:     primaryPkg.Version.Epoch,
+		Version:   primaryPkg.Version.Version,
+		Release:   primaryPkg.Version.Release,
+		Checksum:  strings.TrimSpace(primaryPkg.Checksum),
+		Location:  primaryPkg.Location.Href,
+		SourceRPM: primaryPkg.Format.SourceRPM,
+		Files:     primaryPkg.Format.Files,
+		Repo:      repo,
+	}
+
+	// Every package implicitly provides its own name and version
+	selfProvided := false
+	for _, entry := range primaryPkg.Format.Provides {
+		provide := entry.packageVer()
+		pkg.Provides = append(pkg.Provides, provide)
+		selfProvided = selfProvided || provide.Name == pkg.Name
+	}
+	if !selfProvided {
+		pkg.Provides = append(pkg.Provides, &pkgjson.PackageVer{Name: pkg.Name, Epoch: pkg.Epoch, Version: pkg.VersionRelease(), Condition: "="})
+	}
+
+	for _, entry := range primaryPkg.Format.Requires {
+		pkg.Requires = append(pkg.Requires, entry.packageVer())
+	}
+
+	return
+}
+
+// packageVer converts a provides or requires entry into a PackageVer.
+func (e *metadataEntry) packageVer() *pkgjson.PackageVer {
+	pkgVer := &pkgjson.PackageVer{Name: e.Name}
+	if e.Flags != "" {
+		pkgVer.Condition = conditions[e.Flags]
+		pkgVer.Epoch = e.Epoch
+		pkgVer.Version = joinVersionRelease(e.Version, e.Release)
+	}
+	return pkgVer
+}
+
+func joinVersionRelease(version, release string) string {
+	if release == "" {
+		return version
+	}
+	return fmt.Sprintf("%s-%s", version, release)
+}
+
+// decodeXMLFile decodes an XML file, decompressing it first based on its extension.
+func decodeXMLFile(path string, data interface{}) (err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+	switch filepath.Ext(path) {
+	case ".gz":
+		var gzipReader *gzip.Reader
+		gzipReader, err = gzip.NewReader(file)
+		if err != nil {
+			return
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	case ".xz":
+		reader, err = xz.NewReader(file)
+		if err != nil {
+			return
+		}
+	case ".xml":
+	default:
+		return fmt.Errorf("unsupported repository metadata compression (%s)", path)
+	}
+
+	err = xml.NewDecoder(reader).Decode(data)
+	if err != nil {
+		err = fmt.Errorf("failed to parse (%s): %w", path, err)
+	}
+	return
+}
@@ -0,0 +1,219 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package repodata
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"microsoft.com/pkggen/internal/logger"
+	"microsoft.com/pkggen/internal/pkgjson"
+)
+
+const testRepoMD = `<?xml version="1.0" encoding="UTF-8"?>
+<repomd xmlns="http://linux.duke.edu/metadata/repo" xmlns:rpm="http://linux.duke.edu/metadata/rpm">
+  <revision>1</revision>
+  <data type="primary">
+    <location href="repodata/primary.xml.gz"/>
+  </data>
+  <data type="filelists">
+    <location href="repodata/filelists.xml"/>
+  </data>
+</repomd>`
+
+const testPrimary = `<?xml version="1.0" encoding="UTF-8"?>
+<metadata xmlns="http://linux.duke.edu/metadata/common" xmlns:rpm="http://linux.duke.edu/metadata/rpm" packages="5">
+<package type="rpm">
+  <name>bash</name>
+  <arch>x86_64</arch>
+  <version epoch="0" ver="4.4.18" rel="4.cm1"/>
+  <checksum type="sha256" pkgid="YES">bash-id</checksum>
+  <location href="x86_64/bash-4.4.18-4.cm1.x86_64.rpm"/>
+  <format>
+    <rpm:sourcerpm>bash-4.4.18-4.cm1.src.rpm</rpm:sourcerpm>
+    <rpm:provides>
+      <rpm:entry name="bash" flags="EQ" epoch="0" ver="4.4.18" rel="4.cm1"/>
+      <rpm:entry name="/bin/sh"/>
+    </rpm:provides>
+    <rpm:requires>
+      <rpm:entry name="rpmlib(CompressedFileNames)" flags="LE" epoch="0" ver="3.0.4" rel="1"/>
+      <rpm:entry name="glibc" flags="GE" epoch="0" ver="2.28"/>
+      <rpm:entry name="/usr/bin/locale"/>
+    </rpm:requires>
+    <file>/bin/bash</file>
+  </format>
+</package>
+<package type="rpm">
+  <name>glibc</name>
+  <arch>x86_64</arch>
+  <version epoch="0" ver="2.28" rel="9.cm1"/>
+  <checksum type="sha256" pkgid="YES">glibc-old-id</checksum>
+  <location href="x86_64/glibc-2.28-9.cm1.x86_64.rpm"/>
+  <format>
+    <rpm:provides>
+      <rpm:entry name="libc.so.6()(64bit)"/>
+    </rpm:provides>
+  </format>
+</package>
+<package type="rpm">
+  <name>glibc</name>
+  <arch>x86_64</arch>
+  <version epoch="0" ver="2.28" rel="10.cm1"/>
+  <checksum type="sha256" pkgid="YES">glibc-id</checksum>
+  <location href="x86_64/glibc-2.28-10.cm1.x86_64.rpm"/>
+  <format>
+    <rpm:provides>
+      <rpm:entry name="glibc" flags="EQ" epoch="0" ver="2.28" rel="10.cm1"/>
+      <rpm:entry name="libc.so.6()(64bit)"/>
+    </rpm:provides>
+  </format>
+</package>
+<package type="rpm">
+  <name>glibc</name>
+  <arch>aarch64</arch>
+  <version epoch="0" ver="2.29" rel="1.cm1"/>
+  <checksum type="sha256" pkgid="YES">glibc-aarch64-id</checksum>
+  <location href="aarch64/glibc-2.29-1.cm1.aarch64.rpm"/>
+  <format/>
+</package>
+<package type="rpm">
+  <name>glibc-locales</name>
+  <arch>noarch</arch>
+  <version epoch="0" ver="2.28" rel="10.cm1"/>
+  <checksum type="sha256" pkgid="YES">locales-id</checksum>
+  <location href="noarch/glibc-locales-2.28-10.cm1.noarch.rpm"/>
+  <format>
+    <rpm:requires>
+      <rpm:entry name="glibc" flags="EQ" epoch="0" ver="2.28" rel="10.cm1"/>
+    </rpm:requires>
+  </format>
+</package>
+</metadata>`
+
+const testFileLists = `<?xml version="1.0" encoding="UTF-8"?>
+<filelists xmlns="http://linux.duke.edu/metadata/filelists" packages="2">
+<package pkgid="bash-id" name="bash" arch="x86_64">
+  <version epoch="0" ver="4.4.18" rel="4.cm1"/>
+  <file>/bin/bash</file>
+  <file type="dir">/etc/skel</file>
+</package>
+<package pkgid="locales-id" name="glibc-locales" arch="noarch">
+  <version epoch="0" ver="2.28" rel="10.cm1"/>
+  <file>/usr/bin/locale</file>
+</package>
+</filelists>`
+
+func TestMain(m *testing.M) {
+	logger.InitStderrLog()
+	os.Exit(m.Run())
+}
+
+// createTestRepo writes the test repository metadata into a temporary directory.
+func createTestRepo(t *testing.T) (repoDir string) {
+	repoDir, err := ioutil.TempDir("", "repodata")
+	assert.NoError(t, err)
+
+	repoDataDir := filepath.Join(repoDir, RepoDataDir)
+	assert.NoError(t, os.MkdirAll(repoDataDir, os.ModePerm))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(repoDataDir, repoMDFile), []byte(testRepoMD), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(repoDataDir, "filelists.xml"), []byte(testFileLists), 0644))
+
+	primaryFile, err := os.Create(filepath.Join(repoDataDir, "primary.xml.gz"))
+	assert.NoError(t, err)
+	defer primaryFile.Close()
+
+	gzipWriter := gzip.NewWriter(primaryFile)
+	_, err = gzipWriter.Write([]byte(testPrimary))
+	assert.NoError(t, err)
+	assert.NoError(t, gzipWriter.Close())
+
+	return
+}
+
+func loadTestRepo(t *testing.T) (repo *Repo, cleanup func()) {
+	repoDir := createTestRepo(t)
+	repo, err := Load("test", repoDir, repoDir)
+	assert.NoError(t, err)
+
+	return repo, func() { os.RemoveAll(repoDir) }
+}
+
+func TestLoad(t *testing.T) {
+	repo, cleanup := loadTestRepo(t)
+	defer cleanup()
+
+	assert.Len(t, repo.Packages, 5)
+
+	bash := repo.Packages[0]
+	assert.Equal(t, "bash-4.4.18-4.cm1.x86_64", bash.String())
+	assert.Equal(t, "bash-id", bash.Checksum)
+	assert.Equal(t, "bash-4.4.18-4.cm1.src.rpm", bash.SourceRPM)
+	assert.Equal(t, filepath.Join(repo.BaseDir, "x86_64/bash-4.4.18-4.cm1.x86_64.rpm"), bash.Path())
+	assert.Equal(t, []string{"/bin/bash"}, bash.Files)
+	assert.Equal(t, []*pkgjson.PackageVer{
+		{Name: "bash", Epoch: "0", Version: "4.4.18-4.cm1", Condition: "="},
+		{Name: "/bin/sh"},
+	}, bash.Provides)
+	assert.Equal(t, &pkgjson.PackageVer{Name: "glibc", Epoch: "0", Version: "2.28", Condition: ">="}, bash.Requires[1])
+
+	// Packages without an explicit self-provide still provide themselves
+	assert.Contains(t, repo.Packages[1].Provides, &pkgjson.PackageVer{Name: "glibc", Epoch: "0", Version: "2.28-9.cm1", Condition: "="})
+}
+
+func TestLoadShouldFailWithoutMetadata(t *testing.T) {
+	dir, err := ioutil.TempDir("", "repodata")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	_, err = Load("empty", dir, dir)
+	assert.Error(t, err)
+}
+
+func TestLoadFileLists(t *testing.T) {
+	repo, cleanup := loadTestRepo(t)
+	defer cleanup()
+
+	assert.Empty(t, repo.FindProviders("/usr/bin/locale"))
+	assert.NoError(t, repo.LoadFileLists())
+
+	providers := repo.FindProviders("/usr/bin/locale")
+	assert.Len(t, providers, 1)
+	assert.Equal(t, "glibc-locales", providers[0].Name)
+
+	// Files already listed in the primary metadata are not duplicated
+	assert.Equal(t, []string{"/bin/bash", "/etc/skel"}, repo.Packages[0].Files)
+}
+
+func TestBaseDirFromURL(t *testing.T) {
+	dir, err := BaseDirFromURL("file:///localrpms")
+	assert.NoError(t, err)
+	assert.Equal(t, "/localrpms", dir)
+
+	dir, err = BaseDirFromURL("/some/dir")
+	assert.NoError(t, err)
+	assert.Equal(t, "/some/dir", dir)
+
+	_, err = BaseDirFromURL("https://packages.microsoft.com/cbl-mariner/1.0/prod/base/x86_64")
+	assert.Error(t, err)
+}
+
+func TestSatisfiesShouldCompareEpochs(t *testing.T) {
+	repo, cleanup := loadTestRepo(t)
+	defer cleanup()
+
+	bash := repo.Packages[0]
+	assert.Equal(t, "0:4.4.18-4.cm1", bash.EVR())
+
+	satisfies, err := bash.Satisfies(&pkgjson.PackageVer{Name: "bash", Version: "4.4", Condition: ">="})
+	assert.NoError(t, err)
+	assert.True(t, satisfies)
+
+	satisfies, err = bash.Satisfies(&pkgjson.PackageVer{Name: "bash", Epoch: "1", Version: "1.0", Condition: ">="})
+	assert.NoError(t, err)
+	assert.False(t, satisfies)
+}
@@ -0,0 +1,157 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package repodata
+
+import (
+	"fmt"
+	"strings"
+
+	"microsoft.com/pkggen/internal/logger"
+	"microsoft.com/pkggen/internal/pkgjson"
+	"microsoft.com/pkggen/internal/versioncompare"
+)
+
+const (
+	noArch = "noarch"
+
+	// rpmlibPrefix marks requirements on features of rpm itself, which no package provides
+	rpmlibPrefix = "rpmlib("
+)
+
+// Resolver resolves requirements against a set of repositories.
+type Resolver struct {
+	repos []*Repo
+	arch  string
+}
+
+// NewResolver creates a resolver for packages built for arch or noarch, arch may be empty to allow any architecture.
+// Repositories are considered in the order given: a requirement is resolved from the first repository
+// with a matching package, picking the highest version it offers.
+func NewResolver(arch string, repos ...*Repo) *Resolver {
+	return &Resolver{
+		repos: repos,
+		arch:  arch,
+	}
+}
+
+// Resolve finds the best package satisfying the requirement. The requirement may be a package name,
+// a virtual provide or an absolute file path.
+func (r *Resolver) Resolve(requirement *pkgjson.PackageVer) (pkg *Package, err error) {
+	for _, repo := range r.repos {
+		var candidates []*Package
+		candidates, err = r.findCandidates(repo, requirement)
+		if err != nil {
+			return
+		}
+
+		for _, candidate := range candidates {
+			if pkg == nil || versioncompare.New(candidate.EVR()).Compare(versioncompare.New(pkg.EVR())) > 0 {
+				pkg = candidate
+			}
+		}
+
+		if pkg != nil {
+			logger.Log.Debugf("Resolved (%s) to (%s) from repository (%s)", requirement.Name, pkg, repo.ID)
+			return
+		}
+	}
+
+	err = fmt.Errorf("no package provides (%s)", requirement)
+	return
+}
+
+// ResolveWithDependencies resolves the requirements and, recursively, every package they require.
+// A requirement already satisfied by a selected package does not pull in another provider.
+func (r *Resolver) ResolveWithDependencies(requirements ...*pkgjson.PackageVer) (pkgs []*Package, err error) {
+	type pendingRequirement struct {
+		requirement *pkgjson.PackageVer
+		requiredBy  *Package
+	}
+
+	selected := make(map[*Package]bool)
+	queue := make([]pendingRequirement, 0, len(requirements))
+	for _, requirement := range requirements {
+		queue = append(queue, pendingRequirement{requirement: requirement})
+	}
+
+	for len(queue) > 0 {
+		pending := queue[0]
+		queue = queue[1:]
+
+		if strings.HasPrefix(pending.requirement.Name, rpmlibPrefix) {
+			continue
+		}
+
+		var satisfied bool
+		satisfied, err = r.isSatisfied(pkgs, pending.requirement)
+		if err != nil {
+			return
+		}
+		if satisfied {
+			continue
+		}
+
+		var pkg *Package
+		pkg, err = r.Resolve(pending.requirement)
+		if err != nil {
+			if pending.requiredBy != nil {
+				err = fmt.Errorf("%w, required by (%s)", err, pending.requiredBy)
+			}
+			return
+		}
+
+		if selected[pkg] {
+			continue
+		}
+		selected[pkg] = true
+		pkgs = append(pkgs, pkg)
+
+		for _, requirement := range pkg.Requires {
+			queue = append(queue, pendingRequirement{requirement: requirement, requiredBy: pkg})
+		}
+	}
+
+	return
+}
+
+// findCandidates returns the packages in repo which satisfy the requirement and match the resolver's architecture.
+// File lists are loaded if the primary metadata does not list a required file.
+func (r *Resolver) findCandidates(repo *Repo, requirement *pkgjson.PackageVer) (candidates []*Package, err error) {
+	providers := repo.FindProviders(requirement.Name)
+	if len(providers) == 0 && strings.HasPrefix(requirement.Name, "/") {
+		err = repo.LoadFileLists()
+		if err != nil {
+			return
+		}
+		providers = repo.FindProviders(requirement.Name)
+	}
+
+	for _, provider := range providers {
+		if r.arch != "" && provider.Arch != r.arch && provider.Arch != noArch {
+			continue
+		}
+
+		var satisfies bool
+		satisfies, err = provider.Satisfies(requirement)
+		if err != nil {
+			return
+		}
+		if satisfies {
+			candidates = append(candidates, provider)
+		}
+	}
+
+	return
+}
+
+// isSatisfied returns true if any of the packages satisfies the requirement.
+func (r *Resolver) isSatisfied(pkgs []*Package, requirement *pkgjson.PackageVer) (satisfied bool, err error) {
+	for _, pkg := range pkgs {
+		satisfied, err = pkg.Satisfies(requirement)
+		if err != nil || satisfied {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,106 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package repodata
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"microsoft.com/pkggen/internal/pkgjson"
+)
+
+func packageNames(pkgs []*Package) (names []string) {
+	for _, pkg := range pkgs {
+		names = append(names, pkg.String())
+	}
+	return
+}
+
+func TestResolveShouldPickHighestVersion(t *testing.T) {
+	repo, cleanup := loadTestRepo(t)
+	defer cleanup()
+
+	resolver := NewResolver("x86_64", repo)
+	pkg, err := resolver.Resolve(&pkgjson.PackageVer{Name: "glibc"})
+	assert.NoError(t, err)
+	assert.Equal(t, "glibc-2.28-10.cm1.x86_64", pkg.String())
+
+	pkg, err = resolver.Resolve(&pkgjson.PackageVer{Name: "libc.so.6()(64bit)"})
+	assert.NoError(t, err)
+	assert.Equal(t, "glibc-2.28-10.cm1.x86_64", pkg.String())
+}
+
+func TestResolveShouldHonorVersionInterval(t *testing.T) {
+	repo, cleanup := loadTestRepo(t)
+	defer cleanup()
+
+	resolver := NewResolver("x86_64", repo)
+	pkg, err := resolver.Resolve(&pkgjson.PackageVer{Name: "glibc", Version: "2.28-10", Condition: "<"})
+	assert.NoError(t, err)
+	assert.Equal(t, "glibc-2.28-9.cm1.x86_64", pkg.String())
+
+	_, err = resolver.Resolve(&pkgjson.PackageVer{Name: "glibc", Version: "2.29", Condition: ">="})
+	assert.Error(t, err)
+}
+
+func TestResolveShouldFilterArchitecture(t *testing.T) {
+	repo, cleanup := loadTestRepo(t)
+	defer cleanup()
+
+	pkg, err := NewResolver("aarch64", repo).Resolve(&pkgjson.PackageVer{Name: "glibc"})
+	assert.NoError(t, err)
+	assert.Equal(t, "glibc-2.29-1.cm1.aarch64", pkg.String())
+
+	pkg, err = NewResolver("", repo).Resolve(&pkgjson.PackageVer{Name: "glibc"})
+	assert.NoError(t, err)
+	assert.Equal(t, "aarch64", pkg.Arch)
+}
+
+func TestResolveShouldFindFileProviders(t *testing.T) {
+	repo, cleanup := loadTestRepo(t)
+	defer cleanup()
+
+	resolver := NewResolver("x86_64", repo)
+	pkg, err := resolver.Resolve(&pkgjson.PackageVer{Name: "/bin/bash"})
+	assert.NoError(t, err)
+	assert.Equal(t, "bash", pkg.Name)
+
+	// Only present in the file lists
+	pkg, err = resolver.Resolve(&pkgjson.PackageVer{Name: "/usr/bin/locale"})
+	assert.NoError(t, err)
+	assert.Equal(t, "glibc-locales", pkg.Name)
+}
+
+func TestResolveShouldPreferEarlierRepos(t *testing.T) {
+	repo, cleanup := loadTestRepo(t)
+	defer cleanup()
+
+	otherRepo, otherCleanup := loadTestRepo(t)
+	defer otherCleanup()
+
+	pkg, err := NewResolver("x86_64", otherRepo, repo).Resolve(&pkgjson.PackageVer{Name: "bash"})
+	assert.NoError(t, err)
+	assert.Equal(t, otherRepo, pkg.Repo)
+}
+
+func TestResolveWithDependencies(t *testing.T) {
+	repo, cleanup := loadTestRepo(t)
+	defer cleanup()
+
+	pkgs, err := NewResolver("x86_64", repo).ResolveWithDependencies(&pkgjson.PackageVer{Name: "bash"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"bash-4.4.18-4.cm1.x86_64",
+		"glibc-2.28-10.cm1.x86_64",
+		"glibc-locales-2.28-10.cm1.noarch",
+	}, packageNames(pkgs))
+}
+
+func TestResolveWithDependenciesShouldReportRequiringPackage(t *testing.T) {
+	repo, cleanup := loadTestRepo(t)
+	defer cleanup()
+
+	_, err := NewResolver("aarch64", repo).ResolveWithDependencies(&pkgjson.PackageVer{Name: "glibc-locales"})
+	assert.EqualError(t, err, "no package provides (glibc:C:'='V:'0:2.28-10.cm1',C2:''V2:''), required by (glibc-locales-2.28-10.cm1.noarch)")
+}
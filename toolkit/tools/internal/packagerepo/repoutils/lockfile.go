@@ -0,0 +1,227 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package repoutils
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"microsoft.com/pkggen/internal/file"
+	"microsoft.com/pkggen/internal/jsonutils"
+	"microsoft.com/pkggen/internal/logger"
+	"microsoft.com/pkggen/internal/packagerepo/repocloner"
+	"microsoft.com/pkggen/internal/pkgjson"
+	"microsoft.com/pkggen/internal/rpm"
+)
+
+// LockfileVersion is the version of the lockfile format written by SaveLockfile.
+const LockfileVersion = 1
+
+// queryPackage queries an RPM file, tests replace it since rpm may not be installed.
+var queryPackage = rpm.QueryPackage
+
+// Lockfile pins the exact packages of a cloned repository.
+type Lockfile struct {
+	Version  int              `json:"Version"`
+	Packages []*LockedPackage `json:"Packages"`
+}
+
+// LockedPackage is a single package pinned by a lockfile.
+type LockedPackage struct {
+	Name    string `json:"Name"`
+	Epoch   string `json:"Epoch"`
+	Version string `json:"Version"`
+	Release string `json:"Release"`
+	Arch    string `json:"Arch"`
+	Repo    string `json:"Repo"`   // ID of the repository the package was cloned from, empty if unknown
+	SHA256  string `json:"SHA256"` // Checksum of the package's RPM
+}
+
+// NEVRA returns the package's name, epoch, version, release and architecture.
+func (p *LockedPackage) NEVRA() string {
+	epoch := ""
+	if p.Epoch != "" && p.Epoch != "0" {
+		epoch = fmt.Sprintf("%s:", p.Epoch)
+	}
+	return fmt.Sprintf("%s-%s%s-%s.%s", p.Name, epoch, p.Version, p.Release, p.Arch)
+}
+
+// RPMFileName returns the file name of the package's RPM.
+func (p *LockedPackage) RPMFileName() string {
+	return fmt.Sprintf("%s-%s-%s.%s.rpm", p.Name, p.Version, p.Release, p.Arch)
+}
+
+// SaveLockfile writes a lockfile pinning every package in a cloner's repo contents to `dstFile`.
+// The cloner's packages must already have been converted into a repo.
+func SaveLockfile(cloner repocloner.RepoCloner, dstFile string) (err error) {
+	const (
+		queryFormat          = "%{NAME}\t%{EPOCH}\t%{VERSION}\t%{RELEASE}\t%{ARCH}"
+		queryPackageArgument = "-p"
+		queryFieldCount      = 5
+		noEpoch              = "(none)"
+	)
+
+	logger.Log.Infof("Saving cloned repository lockfile to (%s)", dstFile)
+
+	repo, err := cloner.ClonedRepoContents()
+	if err != nil {
+		return
+	}
+
+	origins, err := cloner.ClonedPackageOrigins()
+	if err != nil {
+		return
+	}
+
+	lockfile := &Lockfile{Version: LockfileVersion}
+	for _, pkg := range repo.Repo {
+		rpmName := fmt.Sprintf("%s-%s.%s.%s.rpm", pkg.Name, pkg.Version, pkg.Distribution, pkg.Architecture)
+		rpmPath := filepath.Join(cloner.CloneDirectory(), pkg.Architecture, rpmName)
+
+		var results []string
+		results, err = queryPackage(rpmPath, queryFormat, rpm.DefaultDefines(), queryPackageArgument)
+		if err != nil {
+			return
+		}
+
+		fields := strings.Split(strings.Join(results, ""), "\t")
+		if len(fields) != queryFieldCount {
+			return fmt.Errorf("unexpected rpm query result for (%s): %v", rpmPath, results)
+		}
+
+		lockedPkg := &LockedPackage{
+			Name:    fields[0],
+			Epoch:   fields[1],
+			Version: fields[2],
+			Release: fields[3],
+			Arch:    fields[4],
+			Repo:    origins[rpmName],
+		}
+		if lockedPkg.Epoch == noEpoch {
+			lockedPkg.Epoch = ""
+		}
+
+		lockedPkg.SHA256, err = file.GenerateSHA256(rpmPath)
+		if err != nil {
+			return
+		}
+
+		if lockedPkg.Repo == "" {
+			logger.Log.Warnf("Unable to determine which repository (%s) was cloned from", lockedPkg.NEVRA())
+		}
+
+		lockfile.Packages = append(lockfile.Packages, lockedPkg)
+	}
+
+	err = jsonutils.WriteJSONFile(dstFile, lockfile)
+	return
+}
+
+// RestoreLockfile clones exactly the packages pinned by the lockfile at `srcFile`, then converts them into a repo.
+// It fails if any pinned package is unavailable or its checksum differs from the lockfile.
+func RestoreLockfile(cloner repocloner.RepoCloner, srcFile string) (lockfile *Lockfile, err error) {
+	const (
+		cloneDeps        = false
+		packageCondition = "="
+	)
+
+	logger.Log.Infof("Restoring cloned repository from lockfile (%s)", srcFile)
+
+	err = jsonutils.ReadJSONFile(srcFile, &lockfile)
+	if err != nil {
+		return
+	}
+
+	if lockfile.Version != LockfileVersion {
+		err = fmt.Errorf("unsupported lockfile version (%d) in (%s), expected %d", lockfile.Version, srcFile, LockfileVersion)
+		return
+	}
+
+	for _, pkg := range lockfile.Packages {
+		// Skip packages that are already present with the pinned contents, this is expected for the toolchain
+		rpmPath := lockedPackagePath(cloner, pkg)
+		exists, _ := file.PathExists(rpmPath)
+		if exists {
+			var matches bool
+			matches, err = checksumMatches(rpmPath, pkg.SHA256)
+			if err != nil {
+				return
+			}
+			if matches {
+				logger.Log.Debugf("%s already exists, skipping clone", pkg.NEVRA())
+				continue
+			}
+		}
+
+		logger.Log.Infof("Restoring (%s)", pkg.NEVRA())
+		err = cloner.Clone(cloneDeps, &pkgjson.PackageVer{
+			Name:      pkg.Name,
+			Epoch:     pkg.Epoch,
+			Version:   fmt.Sprintf("%s-%s", pkg.Version, pkg.Release),
+			Condition: packageCondition,
+		})
+		if err != nil {
+			err = fmt.Errorf("failed to clone locked package (%s): %w", pkg.NEVRA(), err)
+			return
+		}
+	}
+
+	err = cloner.ConvertDownloadedPackagesIntoRepo()
+	if err != nil {
+		return
+	}
+
+	// Verify every pinned package was cloned with the expected contents.
+	for _, pkg := range lockfile.Packages {
+		rpmPath := lockedPackagePath(cloner, pkg)
+
+		var matches bool
+		matches, err = checksumMatches(rpmPath, pkg.SHA256)
+		if err != nil {
+			err = fmt.Errorf("locked package (%s) is unavailable: %w", pkg.NEVRA(), err)
+			return
+		}
+		if !matches {
+			err = fmt.Errorf("locked package (%s) does not match the lockfile's checksum (%s)", pkg.NEVRA(), pkg.SHA256)
+			return
+		}
+	}
+
+	return
+}
+
+// MissingPackages returns the names of the requested packages which the lockfile does not pin.
+// Requests for files or virtual provides cannot be checked and are ignored.
+func (l *Lockfile) MissingPackages(requested []*pkgjson.PackageVer) (missing []string) {
+	locked := make(map[string]bool)
+	for _, pkg := range l.Packages {
+		locked[pkg.Name] = true
+	}
+
+	for _, pkgVer := range requested {
+		if strings.HasPrefix(pkgVer.Name, "/") || strings.Contains(pkgVer.Name, "(") {
+			continue
+		}
+		if !locked[pkgVer.Name] {
+			missing = append(missing, pkgVer.Name)
+		}
+	}
+	return
+}
+
+// lockedPackagePath returns where a locked package is stored once cloned and converted into a repo.
+func lockedPackagePath(cloner repocloner.RepoCloner, pkg *LockedPackage) string {
+	return filepath.Join(cloner.CloneDirectory(), pkg.Arch, pkg.RPMFileName())
+}
+
+func checksumMatches(path, expectedSHA256 string) (matches bool, err error) {
+	sha256, err := file.GenerateSHA256(path)
+	if err != nil {
+		return
+	}
+
+	matches = strings.EqualFold(sha256, expectedSHA256)
+	return
+}
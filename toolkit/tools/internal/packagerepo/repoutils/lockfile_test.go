@@ -0,0 +1,259 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package repoutils
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"microsoft.com/pkggen/internal/file"
+	"microsoft.com/pkggen/internal/jsonutils"
+	"microsoft.com/pkggen/internal/logger"
+	"microsoft.com/pkggen/internal/packagerepo/repocloner"
+	"microsoft.com/pkggen/internal/pkgjson"
+)
+
+// fakeCloner is a RepoCloner whose remote repository is an in-memory set of RPM files.
+type fakeCloner struct {
+	cloneDir string
+	contents *repocloner.RepoContents
+	origins  map[string]string
+	remote   map[string]*fakeRPM // Available RPMs, by name-[epoch:]version-release
+	cloned   []*pkgjson.PackageVer
+}
+
+type fakeRPM struct {
+	arch     string
+	fileName string
+	data     string
+}
+
+func (c *fakeCloner) Initialize(destinationDir, tmpDir, workerTar, existingRpmsDir string, useUpdateRepo, usePreviewRepo bool, repoDefinitions []string) error {
+	return nil
+}
+
+func (c *fakeCloner) AddNetworkFiles(tlsClientCert, tlsClientKey string) error {
+	return nil
+}
+
+func (c *fakeCloner) Clone(cloneDeps bool, packagesToClone ...*pkgjson.PackageVer) error {
+	for _, pkgVer := range packagesToClone {
+		c.cloned = append(c.cloned, pkgVer)
+
+		rpm, found := c.remote[fmt.Sprintf("%s-%s", pkgVer.Name, pkgVer.EVR())]
+		if !found {
+			return fmt.Errorf("no package provides (%s)", pkgVer)
+		}
+
+		archDir := filepath.Join(c.cloneDir, rpm.arch)
+		err := os.MkdirAll(archDir, os.ModePerm)
+		if err != nil {
+			return err
+		}
+		err = ioutil.WriteFile(filepath.Join(archDir, rpm.fileName), []byte(rpm.data), os.ModePerm)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *fakeCloner) SearchAndClone(cloneDeps bool, singlePackageToClone *pkgjson.PackageVer) error {
+	return c.Clone(cloneDeps, singlePackageToClone)
+}
+
+func (c *fakeCloner) ConvertDownloadedPackagesIntoRepo() error {
+	return nil
+}
+
+func (c *fakeCloner) ClonedRepoContents() (*repocloner.RepoContents, error) {
+	return c.contents, nil
+}
+
+func (c *fakeCloner) ClonedPackageOrigins() (map[string]string, error) {
+	return c.origins, nil
+}
+
+func (c *fakeCloner) CloneDirectory() string {
+	return c.cloneDir
+}
+
+func (c *fakeCloner) Close() error {
+	return nil
+}
+
+// newFakeCloner returns a cloner with an empty clone directory under a new temporary directory.
+func newFakeCloner(t *testing.T) (cloner *fakeCloner, tmpDir string) {
+	tmpDir, err := ioutil.TempDir("", "lockfile")
+	assert.NoError(t, err)
+
+	cloner = &fakeCloner{
+		cloneDir: filepath.Join(tmpDir, "clone"),
+		remote:   make(map[string]*fakeRPM),
+	}
+	return
+}
+
+// writeTestLockfile writes a lockfile pinning pkg with the checksum of data.
+func writeTestLockfile(t *testing.T, path string, pkg *LockedPackage, data string) {
+	dataFile := path + ".data"
+	assert.NoError(t, ioutil.WriteFile(dataFile, []byte(data), os.ModePerm))
+
+	checksum, err := file.GenerateSHA256(dataFile)
+	assert.NoError(t, err)
+	pkg.SHA256 = checksum
+
+	assert.NoError(t, jsonutils.WriteJSONFile(path, &Lockfile{Version: LockfileVersion, Packages: []*LockedPackage{pkg}}))
+}
+
+func TestMain(m *testing.M) {
+	logger.InitStderrLog()
+	os.Exit(m.Run())
+}
+
+func TestLockedPackageNames(t *testing.T) {
+	pkg := &LockedPackage{Name: "libstdc++", Epoch: "1", Version: "9.1.0", Release: "1.cm1", Arch: "x86_64"}
+	assert.Equal(t, "libstdc++-1:9.1.0-1.cm1.x86_64", pkg.NEVRA())
+	assert.Equal(t, "libstdc++-9.1.0-1.cm1.x86_64.rpm", pkg.RPMFileName())
+
+	pkg.Epoch = "0"
+	assert.Equal(t, "libstdc++-9.1.0-1.cm1.x86_64", pkg.NEVRA())
+}
+
+func TestLockfileMissingPackages(t *testing.T) {
+	lockfile := &Lockfile{
+		Version:  LockfileVersion,
+		Packages: []*LockedPackage{{Name: "bash"}, {Name: "glibc"}},
+	}
+
+	requested := []*pkgjson.PackageVer{
+		{Name: "bash"},
+		{Name: "kernel"},
+		{Name: "/usr/bin/locale"},
+		{Name: "libc.so.6()(64bit)"},
+	}
+	assert.Equal(t, []string{"kernel"}, lockfile.MissingPackages(requested))
+}
+
+func TestSaveLockfile(t *testing.T) {
+	cloner, tmpDir := newFakeCloner(t)
+	defer os.RemoveAll(tmpDir)
+
+	const rpmName = "libstdc++-9.1.0-1.cm1.x86_64.rpm"
+	rpmPath := filepath.Join(cloner.cloneDir, "x86_64", rpmName)
+	assert.NoError(t, os.MkdirAll(filepath.Dir(rpmPath), os.ModePerm))
+	assert.NoError(t, ioutil.WriteFile(rpmPath, []byte("libstdc++"), os.ModePerm))
+
+	cloner.contents = &repocloner.RepoContents{Repo: []*repocloner.RepoPackage{
+		{Name: "libstdc++", Version: "9.1.0-1", Distribution: "cm1", Architecture: "x86_64"},
+	}}
+	cloner.origins = map[string]string{rpmName: "mariner-official-base"}
+
+	defer func(original func(string, string, map[string]string, ...string) ([]string, error)) {
+		queryPackage = original
+	}(queryPackage)
+	queryPackage = func(packageFile, queryFormat string, defines map[string]string, extraArgs ...string) ([]string, error) {
+		assert.Equal(t, rpmPath, packageFile)
+		return []string{"libstdc++\t1\t9.1.0\t1.cm1\tx86_64"}, nil
+	}
+
+	lockfilePath := filepath.Join(tmpDir, "packages.lock.json")
+	assert.NoError(t, SaveLockfile(cloner, lockfilePath))
+
+	var lockfile Lockfile
+	assert.NoError(t, jsonutils.ReadJSONFile(lockfilePath, &lockfile))
+
+	checksum, err := file.GenerateSHA256(rpmPath)
+	assert.NoError(t, err)
+
+	assert.Equal(t, LockfileVersion, lockfile.Version)
+	assert.Equal(t, []*LockedPackage{{
+		Name:    "libstdc++",
+		Epoch:   "1",
+		Version: "9.1.0",
+		Release: "1.cm1",
+		Arch:    "x86_64",
+		Repo:    "mariner-official-base",
+		SHA256:  checksum,
+	}}, lockfile.Packages)
+}
+
+func TestRestoreLockfile(t *testing.T) {
+	cloner, tmpDir := newFakeCloner(t)
+	defer os.RemoveAll(tmpDir)
+
+	pkg := &LockedPackage{Name: "libstdc++", Epoch: "1", Version: "9.1.0", Release: "1.cm1", Arch: "x86_64"}
+	lockfilePath := filepath.Join(tmpDir, "packages.lock.json")
+	writeTestLockfile(t, lockfilePath, pkg, "libstdc++")
+	cloner.remote["libstdc++-1:9.1.0-1.cm1"] = &fakeRPM{arch: "x86_64", fileName: pkg.RPMFileName(), data: "libstdc++"}
+
+	lockfile, err := RestoreLockfile(cloner, lockfilePath)
+	assert.NoError(t, err)
+	assert.Len(t, lockfile.Packages, 1)
+
+	assert.Equal(t, []*pkgjson.PackageVer{{Name: "libstdc++", Epoch: "1", Version: "9.1.0-1.cm1", Condition: "="}}, cloner.cloned)
+	exists, _ := file.PathExists(filepath.Join(cloner.cloneDir, "x86_64", pkg.RPMFileName()))
+	assert.True(t, exists)
+}
+
+func TestRestoreLockfileShouldSkipPackagesAlreadyPresent(t *testing.T) {
+	cloner, tmpDir := newFakeCloner(t)
+	defer os.RemoveAll(tmpDir)
+
+	pkg := &LockedPackage{Name: "bash", Version: "4.4.18", Release: "4.cm1", Arch: "x86_64"}
+	lockfilePath := filepath.Join(tmpDir, "packages.lock.json")
+	writeTestLockfile(t, lockfilePath, pkg, "bash")
+
+	rpmPath := filepath.Join(cloner.cloneDir, "x86_64", pkg.RPMFileName())
+	assert.NoError(t, os.MkdirAll(filepath.Dir(rpmPath), os.ModePerm))
+	assert.NoError(t, ioutil.WriteFile(rpmPath, []byte("bash"), os.ModePerm))
+
+	_, err := RestoreLockfile(cloner, lockfilePath)
+	assert.NoError(t, err)
+	assert.Empty(t, cloner.cloned)
+}
+
+func TestRestoreLockfileShouldFailWhenPinnedPackageIsUnavailable(t *testing.T) {
+	cloner, tmpDir := newFakeCloner(t)
+	defer os.RemoveAll(tmpDir)
+
+	pkg := &LockedPackage{Name: "bash", Version: "4.4.18", Release: "4.cm1", Arch: "x86_64"}
+	lockfilePath := filepath.Join(tmpDir, "packages.lock.json")
+	writeTestLockfile(t, lockfilePath, pkg, "bash")
+	cloner.remote["bash-4.4.18-5.cm1"] = &fakeRPM{arch: "x86_64", fileName: "bash-4.4.18-5.cm1.x86_64.rpm", data: "bash"}
+
+	_, err := RestoreLockfile(cloner, lockfilePath)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "bash-4.4.18-4.cm1.x86_64")
+}
+
+func TestRestoreLockfileShouldFailOnChecksumMismatch(t *testing.T) {
+	cloner, tmpDir := newFakeCloner(t)
+	defer os.RemoveAll(tmpDir)
+
+	pkg := &LockedPackage{Name: "bash", Version: "4.4.18", Release: "4.cm1", Arch: "x86_64"}
+	lockfilePath := filepath.Join(tmpDir, "packages.lock.json")
+	writeTestLockfile(t, lockfilePath, pkg, "bash")
+	cloner.remote["bash-4.4.18-4.cm1"] = &fakeRPM{arch: "x86_64", fileName: pkg.RPMFileName(), data: "rebuilt bash"}
+
+	_, err := RestoreLockfile(cloner, lockfilePath)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "does not match the lockfile's checksum")
+}
+
+func TestRestoreLockfileShouldFailOnUnsupportedVersion(t *testing.T) {
+	cloner, tmpDir := newFakeCloner(t)
+	defer os.RemoveAll(tmpDir)
+
+	lockfilePath := filepath.Join(tmpDir, "packages.lock.json")
+	assert.NoError(t, jsonutils.WriteJSONFile(lockfilePath, &Lockfile{Version: LockfileVersion + 1}))
+
+	_, err := RestoreLockfile(cloner, lockfilePath)
+	assert.Error(t, err)
+	assert.Empty(t, cloner.cloned)
+}
@@ -11,9 +11,21 @@ import (
 	"microsoft.com/pkggen/internal/jsonutils"
 	"microsoft.com/pkggen/internal/logger"
 	"microsoft.com/pkggen/internal/packagerepo/repocloner"
+	"microsoft.com/pkggen/internal/packagerepo/repocloner/repodatacloner"
+	"microsoft.com/pkggen/internal/packagerepo/repocloner/rpmrepocloner"
 	"microsoft.com/pkggen/internal/pkgjson"
 )
 
+const (
+	// ClonerTDNF selects the cloner which runs tdnf inside a worker chroot.
+	ClonerTDNF = "tdnf"
+	// ClonerRepodata selects the cloner which reads local repository metadata directly, without a chroot.
+	ClonerRepodata = "repodata"
+)
+
+// ClonerTypes lists the supported repo cloner types.
+var ClonerTypes = []string{ClonerTDNF, ClonerRepodata}
+
 // RestoreClonedRepoContents restores a cloner's repo contents using a JSON file at `srcFile`.
 // Will convert the cloned content into a repo and verify its content is correct.
 //
@@ -102,3 +114,16 @@ func SaveClonedRepoContents(cloner repocloner.RepoCloner, dstFile string) (err e
 	err = jsonutils.WriteJSONFile(dstFile, repo)
 	return
 }
+
+// NewCloner creates a repo cloner of the requested type, one of ClonerTypes.
+func NewCloner(clonerType string) (cloner repocloner.RepoCloner, err error) {
+	switch clonerType {
+	case ClonerTDNF:
+		cloner = rpmrepocloner.New()
+	case ClonerRepodata:
+		cloner = repodatacloner.New()
+	default:
+		err = fmt.Errorf("unknown repo cloner type (%s)", clonerType)
+	}
+	return
+}
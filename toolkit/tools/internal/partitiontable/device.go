@@ -0,0 +1,127 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package partitiontable
+
+import (
+	"fmt"
+	"os"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+	"microsoft.com/pkggen/internal/logger"
+	"microsoft.com/pkggen/internal/retry"
+)
+
+// ReadFile reads the partition table of a disk image file or block device.
+func ReadFile(diskPath string) (table *Table, err error) {
+	disk, err := os.Open(diskPath)
+	if err != nil {
+		return
+	}
+	defer disk.Close()
+
+	diskSize, _, err := diskSizeOf(disk)
+	if err != nil {
+		return
+	}
+
+	table, err = Read(disk, diskSize)
+	if err != nil {
+		err = fmt.Errorf("failed to read partition table of (%s): %w", diskPath, err)
+	}
+	return
+}
+
+// WriteFile writes the partition table to a disk image file or block device, replacing any partition table already on it.
+// Block devices are flushed and the kernel re-reads their partition table, so the partitions' device nodes match the new table.
+func WriteFile(diskPath string, table *Table) (err error) {
+	disk, err := os.OpenFile(diskPath, os.O_RDWR, 0)
+	if err != nil {
+		return
+	}
+	defer disk.Close()
+
+	diskSize, isBlockDevice, err := diskSizeOf(disk)
+	if err != nil {
+		return
+	}
+
+	err = table.Write(disk, diskSize)
+	if err != nil {
+		err = fmt.Errorf("failed to write partition table to (%s): %w", diskPath, err)
+		return
+	}
+
+	err = disk.Sync()
+	if err != nil || !isBlockDevice {
+		return
+	}
+
+	err = reloadPartitions(disk)
+	if err != nil {
+		err = fmt.Errorf("failed to reload the partitions of (%s): %w", diskPath, err)
+	}
+	return
+}
+
+// DiskSize returns the size in bytes of a disk image file or block device.
+func DiskSize(diskPath string) (diskSize uint64, err error) {
+	disk, err := os.Open(diskPath)
+	if err != nil {
+		return
+	}
+	defer disk.Close()
+
+	diskSize, _, err = diskSizeOf(disk)
+	return
+}
+
+// diskSizeOf returns the size of an open disk image file or block device, and whether it is a block device.
+// Block devices must use SectorSize logical sectors.
+func diskSizeOf(disk *os.File) (diskSize uint64, isBlockDevice bool, err error) {
+	info, err := disk.Stat()
+	if err != nil {
+		return
+	}
+
+	if info.Mode()&os.ModeDevice == 0 {
+		diskSize = uint64(info.Size())
+		return
+	}
+
+	isBlockDevice = true
+	sectorSize, err := unix.IoctlGetInt(int(disk.Fd()), unix.BLKSSZGET)
+	if err != nil {
+		return
+	}
+	if sectorSize != SectorSize {
+		err = fmt.Errorf("(%s) uses %d byte sectors, only %d byte sectors are supported", disk.Name(), sectorSize, SectorSize)
+		return
+	}
+
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, disk.Fd(), unix.BLKGETSIZE64, uintptr(unsafe.Pointer(&diskSize)))
+	if errno != 0 {
+		err = errno
+	}
+	return
+}
+
+// reloadPartitions asks the kernel to re-read the partition table of a block device. The device may briefly be busy
+// while udev probes it after the write, so this is retried.
+func reloadPartitions(disk *os.File) (err error) {
+	const (
+		totalAttempts = 5
+		retryDuration = time.Second
+	)
+
+	err = retry.Run(func() error {
+		reloadErr := unix.IoctlSetInt(int(disk.Fd()), unix.BLKRRPART, 0)
+		if reloadErr != nil {
+			logger.Log.Debugf("Failed to reload the partitions of (%s): %v", disk.Name(), reloadErr)
+		}
+		return reloadErr
+	}, totalAttempts, retryDuration)
+	return
+}
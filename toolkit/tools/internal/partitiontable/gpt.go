@@ -0,0 +1,343 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package partitiontable
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"unicode/utf16"
+
+	"microsoft.com/pkggen/internal/logger"
+)
+
+// GPT layout, see the UEFI specification chapter 5 "GUID Partition Table (GPT) Disk Layout"
+const (
+	gptSignature      = "EFI PART"
+	gptRevision       = 0x00010000
+	gptHeaderSize     = 92
+	gptEntryCount     = 128
+	gptEntrySize      = 128
+	gptNameLength     = 36
+	gptHeaderLBA      = 1
+	gptEntriesLBA     = 2
+	gptEntriesSectors = gptEntryCount * gptEntrySize / SectorSize
+	// gptMaxEntriesSize bounds the entry array read from a disk, other tools never use more than the 16KiB written here
+	gptMaxEntriesSize = 1024 * 1024
+)
+
+// gptHeader is the on-disk GPT header, excluding the reserved space filling the rest of its sector.
+type gptHeader struct {
+	Signature         [8]byte
+	Revision          uint32
+	HeaderSize        uint32
+	HeaderCRC32       uint32
+	Reserved          uint32
+	MyLBA             uint64
+	AlternateLBA      uint64
+	FirstUsableLBA    uint64
+	LastUsableLBA     uint64
+	DiskGUID          [16]byte
+	PartitionEntryLBA uint64
+	EntryCount        uint32
+	EntrySize         uint32
+	EntriesCRC32      uint32
+}
+
+// gptEntry is a single on-disk GPT partition entry.
+type gptEntry struct {
+	Type       [16]byte
+	GUID       [16]byte
+	StartLBA   uint64
+	EndLBA     uint64
+	Attributes uint64
+	Name       [gptNameLength]uint16
+}
+
+// writeGPT writes a protective MBR, the primary GPT at the start of the disk and the backup GPT at its end.
+func (t *Table) writeGPT(disk io.WriterAt, diskSectors uint64) (err error) {
+	const minimumSectors = 1 + 2*(1+gptEntriesSectors) + 1
+
+	if diskSectors < minimumSectors {
+		return fmt.Errorf("disk of %d sectors is too small for a GPT", diskSectors)
+	}
+	if len(t.Partitions) > gptEntryCount {
+		return fmt.Errorf("GPT supports at most %d partitions, got %d", gptEntryCount, len(t.Partitions))
+	}
+
+	lastLBA := diskSectors - 1
+	backupEntriesLBA := lastLBA - gptEntriesSectors
+	firstUsableLBA := uint64(gptEntriesLBA + gptEntriesSectors)
+	lastUsableLBA := backupEntriesLBA - 1
+
+	err = t.validatePartitions(firstUsableLBA, lastUsableLBA)
+	if err != nil {
+		return
+	}
+
+	entries, err := t.encodeGPTEntries()
+	if err != nil {
+		return
+	}
+
+	primary := gptHeader{
+		Revision:          gptRevision,
+		HeaderSize:        gptHeaderSize,
+		MyLBA:             gptHeaderLBA,
+		AlternateLBA:      lastLBA,
+		FirstUsableLBA:    firstUsableLBA,
+		LastUsableLBA:     lastUsableLBA,
+		DiskGUID:          encodeGPTGUID(t.DiskGUID),
+		PartitionEntryLBA: gptEntriesLBA,
+		EntryCount:        gptEntryCount,
+		EntrySize:         gptEntrySize,
+		EntriesCRC32:      crc32.ChecksumIEEE(entries),
+	}
+	copy(primary.Signature[:], gptSignature)
+
+	backup := primary
+	backup.MyLBA = lastLBA
+	backup.AlternateLBA = gptHeaderLBA
+	backup.PartitionEntryLBA = backupEntriesLBA
+
+	protectiveSectors := diskSectors - 1
+	protectiveMBR := &Table{
+		Type: TableTypeMBR,
+		Partitions: []*Partition{
+			{
+				Start:   gptHeaderLBA * SectorSize,
+				Size:    protectiveSectors * SectorSize,
+				MBRType: MBRTypeProtective,
+			},
+		},
+	}
+
+	err = protectiveMBR.writeMBR(disk, diskSectors)
+	if err != nil {
+		return
+	}
+
+	for _, header := range []gptHeader{primary, backup} {
+		err = writeAt(disk, entries, header.PartitionEntryLBA)
+		if err != nil {
+			return
+		}
+
+		err = writeGPTHeader(disk, header)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// encodeGPTEntries returns the full partition entry array, unused entries are zeroed.
+func (t *Table) encodeGPTEntries() (entries []byte, err error) {
+	buffer := &bytes.Buffer{}
+
+	for i := 0; i < gptEntryCount; i++ {
+		entry := gptEntry{}
+		if i < len(t.Partitions) {
+			partition := t.Partitions[i]
+			name := utf16.Encode([]rune(partition.Name))
+			if len(name) > gptNameLength {
+				return nil, fmt.Errorf("partition %d's name (%s) is longer than %d characters", i+1, partition.Name, gptNameLength)
+			}
+
+			entry.Type = encodeGPTGUID(partition.Type)
+			entry.GUID = encodeGPTGUID(partition.GUID)
+			entry.StartLBA = partition.Start / SectorSize
+			entry.EndLBA = entry.StartLBA + partition.Size/SectorSize - 1
+			entry.Attributes = partition.Attributes
+			copy(entry.Name[:], name)
+		}
+
+		err = binary.Write(buffer, binary.LittleEndian, &entry)
+		if err != nil {
+			return
+		}
+	}
+
+	entries = buffer.Bytes()
+	return
+}
+
+// writeGPTHeader computes the header's CRC and writes it to its sector.
+func writeGPTHeader(disk io.WriterAt, header gptHeader) (err error) {
+	buffer := &bytes.Buffer{}
+
+	header.HeaderCRC32 = 0
+	err = binary.Write(buffer, binary.LittleEndian, &header)
+	if err != nil {
+		return
+	}
+	header.HeaderCRC32 = crc32.ChecksumIEEE(buffer.Bytes())
+
+	buffer.Reset()
+	err = binary.Write(buffer, binary.LittleEndian, &header)
+	if err != nil {
+		return
+	}
+
+	sector := make([]byte, SectorSize)
+	copy(sector, buffer.Bytes())
+	err = writeAt(disk, sector, header.MyLBA)
+	return
+}
+
+// readGPT reads the primary GPT, falling back to the backup GPT at the end of the disk if the primary is corrupt.
+func readGPT(disk io.ReaderAt, diskSectors uint64) (table *Table, err error) {
+	table, err = readGPTAt(disk, gptHeaderLBA, diskSectors)
+	if err == nil {
+		return
+	}
+
+	logger.Log.Warnf("Primary GPT is invalid, reading the backup GPT: %v", err)
+	table, backupErr := readGPTAt(disk, diskSectors-1, diskSectors)
+	if backupErr != nil {
+		err = fmt.Errorf("primary GPT is invalid (%v) and so is the backup GPT (%v)", err, backupErr)
+		return
+	}
+
+	return table, nil
+}
+
+// readGPTAt reads and verifies the GPT header at headerLBA, and the partition entries it points to.
+// Unused entries must come after every used entry.
+func readGPTAt(disk io.ReaderAt, headerLBA, diskSectors uint64) (table *Table, err error) {
+	sector := make([]byte, SectorSize)
+	_, err = disk.ReadAt(sector, int64(headerLBA*SectorSize))
+	if err != nil {
+		return
+	}
+
+	header := gptHeader{}
+	err = binary.Read(bytes.NewReader(sector), binary.LittleEndian, &header)
+	if err != nil {
+		return
+	}
+
+	if string(header.Signature[:]) != gptSignature {
+		return nil, fmt.Errorf("no GPT header at sector %d", headerLBA)
+	}
+	if header.HeaderSize < gptHeaderSize || header.HeaderSize > SectorSize {
+		return nil, fmt.Errorf("GPT header at sector %d has an invalid size (%d)", headerLBA, header.HeaderSize)
+	}
+
+	headerBytes := append([]byte{}, sector[:header.HeaderSize]...)
+	binary.LittleEndian.PutUint32(headerBytes[16:20], 0)
+	if crc32.ChecksumIEEE(headerBytes) != header.HeaderCRC32 {
+		return nil, fmt.Errorf("GPT header at sector %d has an invalid CRC", headerLBA)
+	}
+	if header.MyLBA != headerLBA {
+		return nil, fmt.Errorf("GPT header at sector %d claims to be at sector %d", headerLBA, header.MyLBA)
+	}
+
+	entriesSize := uint64(header.EntryCount) * uint64(header.EntrySize)
+	if header.EntrySize < gptEntrySize || header.EntrySize%8 != 0 || entriesSize > gptMaxEntriesSize {
+		return nil, fmt.Errorf("GPT header at sector %d has an unsupported entry array (%d entries of %d bytes)", headerLBA, header.EntryCount, header.EntrySize)
+	}
+	if header.PartitionEntryLBA+(entriesSize+SectorSize-1)/SectorSize > diskSectors {
+		return nil, fmt.Errorf("GPT entry array at sector %d is beyond the end of the disk", header.PartitionEntryLBA)
+	}
+
+	entries := make([]byte, entriesSize)
+	_, err = disk.ReadAt(entries, int64(header.PartitionEntryLBA*SectorSize))
+	if err != nil {
+		return
+	}
+	if crc32.ChecksumIEEE(entries) != header.EntriesCRC32 {
+		return nil, fmt.Errorf("GPT entry array at sector %d has an invalid CRC", header.PartitionEntryLBA)
+	}
+
+	table = &Table{
+		Type:     TableTypeGPT,
+		DiskGUID: decodeGPTGUID(header.DiskGUID),
+	}
+
+	emptyEntry := false
+	for i := uint32(0); i < header.EntryCount; i++ {
+		entry := gptEntry{}
+		err = binary.Read(bytes.NewReader(entries[i*header.EntrySize:]), binary.LittleEndian, &entry)
+		if err != nil {
+			return
+		}
+
+		if entry.Type == [16]byte{} {
+			emptyEntry = true
+			continue
+		}
+		if emptyEntry {
+			return nil, fmt.Errorf("GPT partition %d follows an empty entry, which is not supported", i+1)
+		}
+		if entry.EndLBA < entry.StartLBA {
+			return nil, fmt.Errorf("GPT partition %d ends before it starts", i+1)
+		}
+
+		name := entry.Name[:]
+		for len(name) > 0 && name[len(name)-1] == 0 {
+			name = name[:len(name)-1]
+		}
+
+		table.Partitions = append(table.Partitions, &Partition{
+			Start:      entry.StartLBA * SectorSize,
+			Size:       (entry.EndLBA - entry.StartLBA + 1) * SectorSize,
+			Type:       decodeGPTGUID(entry.Type),
+			GUID:       decodeGPTGUID(entry.GUID),
+			Name:       string(utf16.Decode(name)),
+			Attributes: entry.Attributes,
+		})
+	}
+
+	return
+}
+
+// clearGPT zeroes the primary and backup GPT headers, if there are any, so the disk is no longer seen as a GPT disk.
+func clearGPT(disk Disk, diskSectors uint64) (err error) {
+	sector := make([]byte, SectorSize)
+	for _, headerLBA := range []uint64{gptHeaderLBA, diskSectors - 1} {
+		_, err = disk.ReadAt(sector, int64(headerLBA*SectorSize))
+		if err != nil {
+			return
+		}
+		if string(sector[:len(gptSignature)]) != gptSignature {
+			continue
+		}
+
+		logger.Log.Debugf("Clearing stale GPT header at sector %d", headerLBA)
+		err = writeAt(disk, make([]byte, SectorSize), headerLBA)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// encodeGPTGUID converts a GUID to its mixed-endian GPT encoding, where the first three fields are little-endian.
+func encodeGPTGUID(guid GUID) (encoded [16]byte) {
+	binary.LittleEndian.PutUint32(encoded[0:4], binary.BigEndian.Uint32(guid[0:4]))
+	binary.LittleEndian.PutUint16(encoded[4:6], binary.BigEndian.Uint16(guid[4:6]))
+	binary.LittleEndian.PutUint16(encoded[6:8], binary.BigEndian.Uint16(guid[6:8]))
+	copy(encoded[8:], guid[8:])
+	return
+}
+
+// decodeGPTGUID converts a GUID from its mixed-endian GPT encoding.
+func decodeGPTGUID(encoded [16]byte) (guid GUID) {
+	binary.BigEndian.PutUint32(guid[0:4], binary.LittleEndian.Uint32(encoded[0:4]))
+	binary.BigEndian.PutUint16(guid[4:6], binary.LittleEndian.Uint16(encoded[4:6]))
+	binary.BigEndian.PutUint16(guid[6:8], binary.LittleEndian.Uint16(encoded[6:8]))
+	copy(guid[8:], encoded[8:])
+	return
+}
+
+// writeAt writes data starting at the given sector.
+func writeAt(disk io.WriterAt, data []byte, lba uint64) (err error) {
+	_, err = disk.WriteAt(data, int64(lba*SectorSize))
+	return
+}
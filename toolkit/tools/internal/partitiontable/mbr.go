@@ -0,0 +1,130 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package partitiontable
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// MBR layout. Only the disk signature, partition entries and boot signature are written,
+// any boot code in the first 440 bytes of the disk is preserved.
+const (
+	mbrStatusOffset    = 0
+	mbrFirstCHSOffset  = 1
+	mbrTypeOffset      = 4
+	mbrLastCHSOffset   = 5
+	mbrStartLBAOffset  = 8
+	mbrSectorsOffset   = 12
+	mbrSignatureOffset = 440
+	mbrEntriesOffset   = 446
+	mbrEntryCount      = 4
+	mbrEntrySize       = 16
+	mbrBootSignature   = 0xaa55
+	mbrActiveFlag      = 0x80
+	mbrFirstUsableLBA  = 1
+)
+
+// MBR partition types of extended partitions, which hold further logical partitions
+var mbrExtendedTypes = map[byte]bool{0x05: true, 0x0f: true, 0x85: true}
+
+// mbrMaxCHS is the CHS address used for every partition. CHS addressing can't describe modern disks,
+// so partitions are located by their LBA fields only.
+var mbrMaxCHS = [3]byte{0xfe, 0xff, 0xff}
+
+// writeMBR writes an MBR partition table with at most four primary partitions.
+func (t *Table) writeMBR(disk io.WriterAt, diskSectors uint64) (err error) {
+	if len(t.Partitions) > mbrEntryCount {
+		return fmt.Errorf("MBR supports at most %d partitions, got %d", mbrEntryCount, len(t.Partitions))
+	}
+
+	err = t.validatePartitions(mbrFirstUsableLBA, diskSectors-1)
+	if err != nil {
+		return
+	}
+
+	// Disk signature, 2 reserved bytes, 4 partition entries and the boot signature
+	data := make([]byte, SectorSize-mbrSignatureOffset)
+	binary.LittleEndian.PutUint32(data, t.DiskSignature)
+
+	for i, partition := range t.Partitions {
+		startLBA := partition.Start / SectorSize
+		sectors := partition.Size / SectorSize
+		if startLBA > math.MaxUint32 {
+			return fmt.Errorf("partition %d starts beyond the 2TiB an MBR can address", i+1)
+		}
+		if sectors > math.MaxUint32 {
+			// A protective MBR covers as much of a large disk as it can
+			if partition.MBRType != MBRTypeProtective {
+				return fmt.Errorf("partition %d is larger than the 2TiB an MBR can address", i+1)
+			}
+			sectors = math.MaxUint32
+		}
+
+		entry := data[mbrEntriesOffset-mbrSignatureOffset+i*mbrEntrySize:][:mbrEntrySize]
+		if partition.Bootable {
+			entry[mbrStatusOffset] = mbrActiveFlag
+		}
+		copy(entry[mbrFirstCHSOffset:], mbrMaxCHS[:])
+		entry[mbrTypeOffset] = partition.MBRType
+		copy(entry[mbrLastCHSOffset:], mbrMaxCHS[:])
+		binary.LittleEndian.PutUint32(entry[mbrStartLBAOffset:], uint32(startLBA))
+		binary.LittleEndian.PutUint32(entry[mbrSectorsOffset:], uint32(sectors))
+	}
+
+	binary.LittleEndian.PutUint16(data[len(data)-2:], mbrBootSignature)
+
+	_, err = disk.WriteAt(data, mbrSignatureOffset)
+	return
+}
+
+// readMBR reads the four primary partitions of an MBR. Empty entries must come after every used entry,
+// and extended partitions are not supported.
+func readMBR(disk io.ReaderAt, diskSectors uint64) (table *Table, err error) {
+	if diskSectors == 0 {
+		return nil, fmt.Errorf("disk is empty")
+	}
+
+	sector := make([]byte, SectorSize)
+	_, err = disk.ReadAt(sector, 0)
+	if err != nil {
+		return
+	}
+
+	if binary.LittleEndian.Uint16(sector[SectorSize-2:]) != mbrBootSignature {
+		return nil, fmt.Errorf("disk has no partition table")
+	}
+
+	table = &Table{
+		Type:          TableTypeMBR,
+		DiskSignature: binary.LittleEndian.Uint32(sector[mbrSignatureOffset:]),
+	}
+
+	emptyEntry := false
+	for i := 0; i < mbrEntryCount; i++ {
+		entry := sector[mbrEntriesOffset+i*mbrEntrySize:][:mbrEntrySize]
+		partitionType := entry[mbrTypeOffset]
+		if partitionType == 0 {
+			emptyEntry = true
+			continue
+		}
+		if emptyEntry {
+			return nil, fmt.Errorf("MBR partition %d follows an empty entry, which is not supported", i+1)
+		}
+		if mbrExtendedTypes[partitionType] {
+			return nil, fmt.Errorf("MBR partition %d is an extended partition, which is not supported", i+1)
+		}
+
+		table.Partitions = append(table.Partitions, &Partition{
+			Start:    uint64(binary.LittleEndian.Uint32(entry[mbrStartLBAOffset:])) * SectorSize,
+			Size:     uint64(binary.LittleEndian.Uint32(entry[mbrSectorsOffset:])) * SectorSize,
+			MBRType:  partitionType,
+			Bootable: entry[mbrStatusOffset]&mbrActiveFlag != 0,
+		})
+	}
+
+	return
+}
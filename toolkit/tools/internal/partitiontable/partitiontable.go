@@ -0,0 +1,277 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+// Package partitiontable reads and writes GPT and MBR partition tables directly on disk image files
+// and block devices, without parted or sfdisk.
+
+package partitiontable
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// SectorSize is the logical sector size, in bytes, of the disks partition tables are written for
+const SectorSize = 512
+
+// TableType is the kind of partition table
+type TableType string
+
+const (
+	// TableTypeGPT is a GUID Partition Table
+	TableTypeGPT TableType = "gpt"
+	// TableTypeMBR is a Master Boot Record partition table
+	TableTypeMBR TableType = "mbr"
+)
+
+// GUID is a globally unique identifier, stored in the byte order of its string representation.
+// The GPT on-disk encoding (the first three fields little-endian) is handled when the table is read or written.
+type GUID [16]byte
+
+// Well-known GPT partition types
+var (
+	// TypeEFISystem is the type of an EFI System Partition
+	TypeEFISystem = MustParseGUID("c12a7328-f81f-11d2-ba4b-00a0c93ec93b")
+	// TypeBIOSBoot is the type of the partition GRUB embeds its core image in on legacy boot GPT disks
+	TypeBIOSBoot = MustParseGUID("21686148-6449-6e6f-744e-656564454649")
+	// TypeLinuxFilesystem is the type of a generic Linux filesystem partition
+	TypeLinuxFilesystem = MustParseGUID("0fc63daf-8483-4772-8e79-3d69d8477de4")
+	// TypeLinuxLVM is the type of an LVM physical volume
+	TypeLinuxLVM = MustParseGUID("e6d6d379-f507-44c2-a23c-238f2a3df928")
+)
+
+// GPT partition types of the Discoverable Partitions Specification, which lets systemd find and mount partitions by type
+var (
+	// TypeLinuxRootX86_64 is the type of the root partition of an x86-64 system
+	TypeLinuxRootX86_64 = MustParseGUID("4f68bce3-e8cd-4db1-96e7-fbcaf984b709")
+	// TypeLinuxRootARM64 is the type of the root partition of an ARM64 system
+	TypeLinuxRootARM64 = MustParseGUID("b921b045-1df0-41c3-af44-4c6f280d3fae")
+	// TypeLinuxUsrX86_64 is the type of the /usr partition of an x86-64 system
+	TypeLinuxUsrX86_64 = MustParseGUID("8484680c-9521-48c6-9c11-b0720656f69e")
+	// TypeLinuxUsrARM64 is the type of the /usr partition of an ARM64 system
+	TypeLinuxUsrARM64 = MustParseGUID("b0e01050-ee5f-4390-949a-9101b17104e9")
+	// TypeLinuxSwap is the type of a swap partition
+	TypeLinuxSwap = MustParseGUID("0657fd6d-a4ab-43c4-84e5-0933c84b4f4f")
+	// TypeLinuxHome is the type of the /home partition
+	TypeLinuxHome = MustParseGUID("933ac7e1-2eb4-4f13-b844-0e14e2aef915")
+	// TypeLinuxSrv is the type of the /srv partition
+	TypeLinuxSrv = MustParseGUID("3b8f8425-20e0-4f3b-907f-1a25a76f98e8")
+	// TypeLinuxVar is the type of the /var partition
+	TypeLinuxVar = MustParseGUID("4d21b016-b534-45c2-a9fb-5c16e091fd2d")
+	// TypeLinuxVarTmp is the type of the /var/tmp partition
+	TypeLinuxVarTmp = MustParseGUID("7ec6f557-3bc5-4aca-b293-16ef5df639d1")
+	// TypeLinuxXBOOTLDR is the type of the Extended Boot Loader partition, mounted at /boot
+	TypeLinuxXBOOTLDR = MustParseGUID("bc13c2ff-59e6-4262-a352-b275fd6f7172")
+)
+
+// GPT partition attribute bits. Bits 0-2 are defined by the UEFI specification, bits 48-63 by the partition type;
+// the ones listed here are those the Discoverable Partitions Specification defines for Linux partition types.
+const (
+	// AttributeRequired marks a partition the platform needs to function, which must not be deleted
+	AttributeRequired = uint64(1) << 0
+	// AttributeNoBlockIOProtocol tells the firmware not to produce an EFI_BLOCK_IO_PROTOCOL for the partition
+	AttributeNoBlockIOProtocol = uint64(1) << 1
+	// AttributeLegacyBIOSBootable marks the partition legacy BIOS firmware should boot
+	AttributeLegacyBIOSBootable = uint64(1) << 2
+	// AttributeGrowFS asks systemd-growfs to grow the partition's filesystem to fill the partition
+	AttributeGrowFS = uint64(1) << 59
+	// AttributeReadOnly asks for the partition to be mounted read-only
+	AttributeReadOnly = uint64(1) << 60
+	// AttributeNoAuto excludes the partition from automatic discovery and mounting
+	AttributeNoAuto = uint64(1) << 63
+)
+
+// Well-known MBR partition types
+const (
+	// MBRTypeLinux is the type of a Linux filesystem partition
+	MBRTypeLinux = 0x83
+	// MBRTypeLinuxSwap is the type of a Linux swap partition
+	MBRTypeLinuxSwap = 0x82
+	// MBRTypeLinuxLVM is the type of an LVM physical volume
+	MBRTypeLinuxLVM = 0x8e
+	// MBRTypeLinuxXBOOTLDR is the type of the Extended Boot Loader partition
+	MBRTypeLinuxXBOOTLDR = 0xea
+	// MBRTypeEFISystem is the type of an EFI System Partition
+	MBRTypeEFISystem = 0xef
+	// MBRTypeProtective marks the single partition of a protective MBR covering a GPT disk
+	MBRTypeProtective = 0xee
+)
+
+// Partition is a single entry of a partition table.
+type Partition struct {
+	Start      uint64 // Offset of the partition's first byte, a multiple of SectorSize
+	Size       uint64 // Size of the partition in bytes, a multiple of SectorSize
+	Type       GUID   // GPT partition type
+	GUID       GUID   // GPT unique partition GUID, used as the partition's PARTUUID
+	Name       string // GPT partition name, at most 36 UTF-16 code units
+	Attributes uint64 // GPT attribute bits
+	MBRType    byte   // MBR partition type
+	Bootable   bool   // MBR active flag
+}
+
+// Disk is where a partition table is read from and written to, such as an *os.File of a disk image or block device.
+type Disk interface {
+	io.ReaderAt
+	io.WriterAt
+}
+
+// Table is a partition table and the partitions it describes, in order.
+type Table struct {
+	Type          TableType    // Kind of partition table
+	DiskGUID      GUID         // GPT disk GUID
+	DiskSignature uint32       // MBR disk signature
+	Partitions    []*Partition // Partitions in the order they are numbered, starting at 1
+}
+
+// NewGUID returns a random (version 4) GUID.
+func NewGUID() (guid GUID, err error) {
+	_, err = rand.Read(guid[:])
+	if err != nil {
+		return
+	}
+
+	guid[6] = (guid[6] & 0x0f) | 0x40
+	guid[8] = (guid[8] & 0x3f) | 0x80
+	return
+}
+
+// ParseGUID parses a GUID in its canonical form, e.g. "c12a7328-f81f-11d2-ba4b-00a0c93ec93b". Case is ignored.
+func ParseGUID(guidString string) (guid GUID, err error) {
+	const (
+		guidLength = 36
+		separator  = "-"
+	)
+
+	if len(guidString) != guidLength || strings.Count(guidString, separator) != 4 {
+		err = fmt.Errorf("invalid GUID (%s)", guidString)
+		return
+	}
+
+	bytes, err := hex.DecodeString(strings.Replace(guidString, separator, "", -1))
+	if err != nil {
+		err = fmt.Errorf("invalid GUID (%s): %v", guidString, err)
+		return
+	}
+
+	copy(guid[:], bytes)
+	return
+}
+
+// MustParseGUID parses a GUID, panicking if it is invalid. Used for well-known GUIDs.
+func MustParseGUID(guidString string) (guid GUID) {
+	guid, err := ParseGUID(guidString)
+	if err != nil {
+		panic(err)
+	}
+	return
+}
+
+// String returns the canonical lowercase form of the GUID.
+func (g GUID) String() string {
+	return fmt.Sprintf("%x-%x-%x-%x-%x", g[0:4], g[4:6], g[6:8], g[8:10], g[10:])
+}
+
+// PartUUID returns the PARTUUID the kernel and blkid report for the partition at index (0 based).
+// GPT partitions use their unique GUID, MBR partitions the disk signature followed by the partition number.
+func (t *Table) PartUUID(index int) string {
+	if t.Type == TableTypeMBR {
+		return fmt.Sprintf("%08x-%02x", t.DiskSignature, index+1)
+	}
+	return t.Partitions[index].GUID.String()
+}
+
+// UsableStart returns the offset of the first byte partitions may use. A GPT reserves the start of the disk for its
+// header and entries, an MBR only its first sector.
+func (t *Table) UsableStart() (start uint64) {
+	start = mbrFirstUsableLBA * SectorSize
+	if t.Type == TableTypeGPT {
+		start = (gptEntriesLBA + gptEntriesSectors) * SectorSize
+	}
+	return
+}
+
+// UsableEnd returns the offset one past the last byte partitions may use on a disk of diskSize bytes.
+// A GPT reserves the end of the disk for its backup.
+func (t *Table) UsableEnd(diskSize uint64) (end uint64) {
+	end = diskSize
+	if t.Type == TableTypeGPT {
+		end -= (1 + gptEntriesSectors) * SectorSize
+	}
+	return
+}
+
+// Read reads the partition table of a disk of diskSize bytes.
+// A GPT is read from its primary copy, falling back to the backup at the end of the disk if the primary is corrupt.
+func Read(disk io.ReaderAt, diskSize uint64) (table *Table, err error) {
+	if diskSize%SectorSize != 0 {
+		return nil, fmt.Errorf("disk size (%d) is not a multiple of the sector size (%d)", diskSize, SectorSize)
+	}
+
+	table, err = readMBR(disk, diskSize/SectorSize)
+	if err != nil {
+		return
+	}
+
+	for _, partition := range table.Partitions {
+		if partition.MBRType == MBRTypeProtective {
+			return readGPT(disk, diskSize/SectorSize)
+		}
+	}
+
+	return
+}
+
+// Write writes the partition table to a disk of diskSize bytes, replacing any partition table already on it.
+// Only the sectors holding the table are written, the contents of the partitions are left untouched.
+func (t *Table) Write(disk Disk, diskSize uint64) (err error) {
+	if diskSize%SectorSize != 0 {
+		return fmt.Errorf("disk size (%d) is not a multiple of the sector size (%d)", diskSize, SectorSize)
+	}
+
+	switch t.Type {
+	case TableTypeGPT:
+		err = t.writeGPT(disk, diskSize/SectorSize)
+	case TableTypeMBR:
+		err = t.writeMBR(disk, diskSize/SectorSize)
+		if err != nil {
+			return
+		}
+		// Tools prefer a GPT over an MBR, so any GPT left over from a previous table must go
+		err = clearGPT(disk, diskSize/SectorSize)
+	default:
+		err = fmt.Errorf("unknown partition table type (%s)", t.Type)
+	}
+
+	return
+}
+
+// validatePartitions checks that every partition is sector aligned, lies within [firstLBA, lastLBA] and doesn't
+// overlap the partitions before it.
+func (t *Table) validatePartitions(firstLBA, lastLBA uint64) (err error) {
+	var previousEnd uint64
+
+	for i, partition := range t.Partitions {
+		number := i + 1
+		if partition.Start%SectorSize != 0 || partition.Size%SectorSize != 0 {
+			return fmt.Errorf("partition %d is not aligned to the sector size (%d)", number, SectorSize)
+		}
+		if partition.Size == 0 {
+			return fmt.Errorf("partition %d is empty", number)
+		}
+
+		startLBA := partition.Start / SectorSize
+		endLBA := startLBA + partition.Size/SectorSize - 1
+		if startLBA < firstLBA || endLBA > lastLBA {
+			return fmt.Errorf("partition %d (sectors %d-%d) is outside of the usable sectors (%d-%d)", number, startLBA, endLBA, firstLBA, lastLBA)
+		}
+		if startLBA < previousEnd {
+			return fmt.Errorf("partition %d overlaps the partition before it", number)
+		}
+		previousEnd = endLBA + 1
+	}
+
+	return
+}
@@ -0,0 +1,350 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package partitiontable
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"microsoft.com/pkggen/internal/logger"
+)
+
+const (
+	testDiskSize = 64 * 1024 * 1024
+	mib          = 1024 * 1024
+)
+
+func TestMain(m *testing.M) {
+	logger.InitStderrLog()
+	os.Exit(m.Run())
+}
+
+// writeTestDisk writes the table to a sparse file and returns its contents.
+func writeTestDisk(t *testing.T, table *Table) (contents []byte, err error) {
+	diskFile, err := ioutil.TempFile("", "partitiontable")
+	assert.NoError(t, err)
+	defer os.Remove(diskFile.Name())
+	defer diskFile.Close()
+
+	assert.NoError(t, diskFile.Truncate(testDiskSize))
+
+	err = table.Write(diskFile, testDiskSize)
+	if err != nil {
+		return
+	}
+
+	contents, err = ioutil.ReadFile(diskFile.Name())
+	assert.NoError(t, err)
+	return
+}
+
+func testGPTTable() *Table {
+	return &Table{
+		Type:     TableTypeGPT,
+		DiskGUID: MustParseGUID("01234567-89ab-cdef-0123-456789abcdef"),
+		Partitions: []*Partition{
+			{
+				Start:      1 * mib,
+				Size:       8 * mib,
+				Type:       TypeEFISystem,
+				GUID:       MustParseGUID("11111111-2222-3333-4444-555555555555"),
+				Name:       "boot",
+				Attributes: 1,
+			},
+			{
+				Start: 9 * mib,
+				Size:  32 * mib,
+				Type:  TypeLinuxFilesystem,
+				GUID:  MustParseGUID("66666666-7777-8888-9999-aaaaaaaaaaaa"),
+				Name:  "rootfs",
+			},
+		},
+	}
+}
+
+func sector(contents []byte, lba uint64) []byte {
+	return contents[lba*SectorSize : (lba+1)*SectorSize]
+}
+
+func TestParseGUID(t *testing.T) {
+	guid, err := ParseGUID("C12A7328-F81F-11D2-BA4B-00A0C93EC93B")
+	assert.NoError(t, err)
+	assert.Equal(t, TypeEFISystem, guid)
+	assert.Equal(t, "c12a7328-f81f-11d2-ba4b-00a0c93ec93b", guid.String())
+}
+
+func TestParseGUIDShouldFailOnInvalidGUID(t *testing.T) {
+	for _, guid := range []string{"", "c12a7328f81f11d2ba4b00a0c93ec93b", "c12a7328-f81f-11d2-ba4b-00a0c93ec93g"} {
+		_, err := ParseGUID(guid)
+		assert.Error(t, err, guid)
+	}
+}
+
+func TestNewGUID(t *testing.T) {
+	guid, err := NewGUID()
+	assert.NoError(t, err)
+
+	other, err := NewGUID()
+	assert.NoError(t, err)
+	assert.NotEqual(t, guid, other)
+
+	// Version 4, RFC 4122 variant
+	assert.Equal(t, byte(0x40), guid[6]&0xf0)
+	assert.Equal(t, byte(0x80), guid[8]&0xc0)
+}
+
+func TestWriteGPT(t *testing.T) {
+	contents, err := writeTestDisk(t, testGPTTable())
+	assert.NoError(t, err)
+
+	lastLBA := uint64(testDiskSize/SectorSize - 1)
+
+	// Protective MBR covering the whole disk
+	mbr := sector(contents, 0)
+	assert.Equal(t, byte(MBRTypeProtective), mbr[mbrEntriesOffset+4])
+	assert.Equal(t, uint32(1), binary.LittleEndian.Uint32(mbr[mbrEntriesOffset+8:]))
+	assert.Equal(t, uint32(lastLBA), binary.LittleEndian.Uint32(mbr[mbrEntriesOffset+12:]))
+	assert.Equal(t, uint16(mbrBootSignature), binary.LittleEndian.Uint16(mbr[510:]))
+
+	for _, headerLBA := range []uint64{gptHeaderLBA, lastLBA} {
+		header := sector(contents, headerLBA)
+		assert.Equal(t, gptSignature, string(header[0:8]))
+
+		// Header CRC is computed with the CRC field zeroed
+		headerCopy := append([]byte{}, header[:gptHeaderSize]...)
+		binary.LittleEndian.PutUint32(headerCopy[16:], 0)
+		assert.Equal(t, crc32.ChecksumIEEE(headerCopy), binary.LittleEndian.Uint32(header[16:]))
+
+		assert.Equal(t, headerLBA, binary.LittleEndian.Uint64(header[24:]))
+		assert.Equal(t, uint64(34), binary.LittleEndian.Uint64(header[40:]))
+		assert.Equal(t, lastLBA-33, binary.LittleEndian.Uint64(header[48:]))
+		// Disk GUID is mixed-endian
+		assert.Equal(t, []byte{0x67, 0x45, 0x23, 0x01, 0xab, 0x89, 0xef, 0xcd, 0x01, 0x23}, header[56:66])
+
+		entriesLBA := binary.LittleEndian.Uint64(header[72:])
+		entries := contents[entriesLBA*SectorSize : entriesLBA*SectorSize+gptEntryCount*gptEntrySize]
+		assert.Equal(t, crc32.ChecksumIEEE(entries), binary.LittleEndian.Uint32(header[88:]))
+
+		// Second partition's first and last sectors
+		rootEntry := entries[gptEntrySize:]
+		assert.Equal(t, uint64(9*mib/SectorSize), binary.LittleEndian.Uint64(rootEntry[32:]))
+		assert.Equal(t, uint64(41*mib/SectorSize-1), binary.LittleEndian.Uint64(rootEntry[40:]))
+		assert.Equal(t, []byte{'r', 0, 'o', 0, 'o', 0, 't', 0, 'f', 0, 's', 0, 0, 0}, rootEntry[56:70])
+
+		// First partition's attributes
+		assert.Equal(t, uint64(1), binary.LittleEndian.Uint64(entries[48:]))
+	}
+}
+
+func TestWriteGPTShouldFailOnOverlap(t *testing.T) {
+	table := testGPTTable()
+	table.Partitions[1].Start = 8 * mib
+
+	_, err := writeTestDisk(t, table)
+	assert.Error(t, err)
+}
+
+func TestWriteGPTShouldFailOutsideUsableSectors(t *testing.T) {
+	table := testGPTTable()
+	table.Partitions[0].Start = 0
+
+	_, err := writeTestDisk(t, table)
+	assert.Error(t, err)
+
+	table = testGPTTable()
+	table.Partitions[1].Size = testDiskSize - 9*mib
+
+	_, err = writeTestDisk(t, table)
+	assert.Error(t, err)
+}
+
+func TestWriteGPTShouldFailOnLongName(t *testing.T) {
+	table := testGPTTable()
+	table.Partitions[0].Name = "a-partition-name-longer-than-36-characters"
+
+	_, err := writeTestDisk(t, table)
+	assert.Error(t, err)
+}
+
+func TestWriteMBR(t *testing.T) {
+	table := &Table{
+		Type:          TableTypeMBR,
+		DiskSignature: 0x1234abcd,
+		Partitions: []*Partition{
+			{Start: 1 * mib, Size: 8 * mib, MBRType: MBRTypeEFISystem, Bootable: true},
+			{Start: 9 * mib, Size: 55 * mib, MBRType: MBRTypeLinux},
+		},
+	}
+
+	contents, err := writeTestDisk(t, table)
+	assert.NoError(t, err)
+
+	mbr := sector(contents, 0)
+	assert.Equal(t, uint32(0x1234abcd), binary.LittleEndian.Uint32(mbr[mbrSignatureOffset:]))
+	assert.Equal(t, uint16(mbrBootSignature), binary.LittleEndian.Uint16(mbr[510:]))
+
+	boot := mbr[mbrEntriesOffset:]
+	assert.Equal(t, byte(mbrActiveFlag), boot[0])
+	assert.Equal(t, byte(MBRTypeEFISystem), boot[4])
+	assert.Equal(t, uint32(1*mib/SectorSize), binary.LittleEndian.Uint32(boot[8:]))
+	assert.Equal(t, uint32(8*mib/SectorSize), binary.LittleEndian.Uint32(boot[12:]))
+
+	root := mbr[mbrEntriesOffset+mbrEntrySize:]
+	assert.Equal(t, byte(0), root[0])
+	assert.Equal(t, byte(MBRTypeLinux), root[4])
+
+	assert.Equal(t, "1234abcd-02", table.PartUUID(1))
+}
+
+func TestWriteMBRShouldFailWithTooManyPartitions(t *testing.T) {
+	table := &Table{Type: TableTypeMBR}
+	for i := uint64(0); i < 5; i++ {
+		table.Partitions = append(table.Partitions, &Partition{Start: (i + 1) * mib, Size: mib, MBRType: MBRTypeLinux})
+	}
+
+	_, err := writeTestDisk(t, table)
+	assert.Error(t, err)
+}
+
+func TestPartUUID(t *testing.T) {
+	assert.Equal(t, "66666666-7777-8888-9999-aaaaaaaaaaaa", testGPTTable().PartUUID(1))
+}
+
+// writeTestFile writes the table to a new sparse file, which the caller must remove.
+func writeTestFile(t *testing.T, table *Table) (diskPath string) {
+	diskFile, err := ioutil.TempFile("", "partitiontable")
+	assert.NoError(t, err)
+	defer diskFile.Close()
+
+	diskPath = diskFile.Name()
+	assert.NoError(t, diskFile.Truncate(testDiskSize))
+	assert.NoError(t, WriteFile(diskPath, table))
+	return
+}
+
+// corruptSector overwrites a sector of a disk file with garbage.
+func corruptSector(t *testing.T, diskPath string, lba uint64) {
+	diskFile, err := os.OpenFile(diskPath, os.O_WRONLY, 0)
+	assert.NoError(t, err)
+	defer diskFile.Close()
+
+	_, err = diskFile.WriteAt([]byte("garbage"), int64(lba*SectorSize+20))
+	assert.NoError(t, err)
+}
+
+func TestReadGPT(t *testing.T) {
+	table := testGPTTable()
+	diskPath := writeTestFile(t, table)
+	defer os.Remove(diskPath)
+
+	readTable, err := ReadFile(diskPath)
+	assert.NoError(t, err)
+	assert.Equal(t, table, readTable)
+}
+
+func TestReadGPTShouldFallBackToBackup(t *testing.T) {
+	table := testGPTTable()
+	diskPath := writeTestFile(t, table)
+	defer os.Remove(diskPath)
+
+	corruptSector(t, diskPath, gptHeaderLBA)
+
+	readTable, err := ReadFile(diskPath)
+	assert.NoError(t, err)
+	assert.Equal(t, table, readTable)
+}
+
+func TestReadGPTShouldFallBackToBackupOnCorruptEntries(t *testing.T) {
+	table := testGPTTable()
+	diskPath := writeTestFile(t, table)
+	defer os.Remove(diskPath)
+
+	corruptSector(t, diskPath, gptEntriesLBA)
+
+	readTable, err := ReadFile(diskPath)
+	assert.NoError(t, err)
+	assert.Equal(t, table, readTable)
+}
+
+func TestReadGPTShouldFailWhenBothCopiesAreCorrupt(t *testing.T) {
+	diskPath := writeTestFile(t, testGPTTable())
+	defer os.Remove(diskPath)
+
+	corruptSector(t, diskPath, gptHeaderLBA)
+	corruptSector(t, diskPath, testDiskSize/SectorSize-1)
+
+	_, err := ReadFile(diskPath)
+	assert.Error(t, err)
+}
+
+func TestReadMBR(t *testing.T) {
+	table := &Table{
+		Type:          TableTypeMBR,
+		DiskSignature: 0x1234abcd,
+		Partitions: []*Partition{
+			{Start: 1 * mib, Size: 8 * mib, MBRType: MBRTypeEFISystem, Bootable: true},
+			{Start: 9 * mib, Size: 55 * mib, MBRType: MBRTypeLinux},
+		},
+	}
+	diskPath := writeTestFile(t, table)
+	defer os.Remove(diskPath)
+
+	readTable, err := ReadFile(diskPath)
+	assert.NoError(t, err)
+	assert.Equal(t, table, readTable)
+}
+
+func TestReadShouldFailWithoutPartitionTable(t *testing.T) {
+	diskFile, err := ioutil.TempFile("", "partitiontable")
+	assert.NoError(t, err)
+	defer os.Remove(diskFile.Name())
+	defer diskFile.Close()
+	assert.NoError(t, diskFile.Truncate(testDiskSize))
+
+	_, err = ReadFile(diskFile.Name())
+	assert.Error(t, err)
+}
+
+func TestWriteMBRShouldReplaceGPT(t *testing.T) {
+	diskPath := writeTestFile(t, testGPTTable())
+	defer os.Remove(diskPath)
+
+	table := &Table{
+		Type:       TableTypeMBR,
+		Partitions: []*Partition{{Start: 1 * mib, Size: 8 * mib, MBRType: MBRTypeLinux}},
+	}
+	assert.NoError(t, WriteFile(diskPath, table))
+
+	contents, err := ioutil.ReadFile(diskPath)
+	assert.NoError(t, err)
+	assert.NotEqual(t, gptSignature, string(sector(contents, gptHeaderLBA)[0:8]))
+	assert.NotEqual(t, gptSignature, string(sector(contents, testDiskSize/SectorSize-1)[0:8]))
+
+	readTable, err := ReadFile(diskPath)
+	assert.NoError(t, err)
+	assert.Equal(t, table, readTable)
+}
+
+func TestDiskSize(t *testing.T) {
+	diskPath := writeTestFile(t, testGPTTable())
+	defer os.Remove(diskPath)
+
+	diskSize, err := DiskSize(diskPath)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(testDiskSize), diskSize)
+}
+
+func TestUsableRange(t *testing.T) {
+	gpt := &Table{Type: TableTypeGPT}
+	assert.Equal(t, uint64(34*SectorSize), gpt.UsableStart())
+	assert.Equal(t, uint64(testDiskSize-33*SectorSize), gpt.UsableEnd(testDiskSize))
+
+	mbr := &Table{Type: TableTypeMBR}
+	assert.Equal(t, uint64(SectorSize), mbr.UsableStart())
+	assert.Equal(t, uint64(testDiskSize), mbr.UsableEnd(testDiskSize))
+}
@@ -0,0 +1,364 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package pkggraph
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// GraphDiff describes how a package graph changed between two versions.
+// Nodes are matched by their type and versioned package, meta nodes by the nodes they connect.
+type GraphDiff struct {
+	AddedNodes      []*DiffNode      `json:"AddedNodes"`      // Nodes only found in the new graph
+	RemovedNodes    []*DiffNode      `json:"RemovedNodes"`    // Nodes only found in the old graph
+	VersionChanges  []*VersionChange `json:"VersionChanges"`  // Packages found in both graphs with a different version
+	AddedEdges      []*DiffEdge      `json:"AddedEdges"`      // Dependencies only found in the new graph
+	RemovedEdges    []*DiffEdge      `json:"RemovedEdges"`    // Dependencies only found in the old graph
+	AddedCycles     []*DiffCycle     `json:"AddedCycles"`     // Cycles broken by the grapher only in the new graph
+	RemovedCycles   []*DiffCycle     `json:"RemovedCycles"`   // Cycles broken by the grapher only in the old graph
+	AddedRebuilds   []*DiffNode      `json:"AddedRebuilds"`   // Build nodes which must be rebuilt only in the new graph
+	RemovedRebuilds []*DiffNode      `json:"RemovedRebuilds"` // Build nodes which must be rebuilt only in the old graph
+}
+
+// DiffNode is a node which differs between two graphs.
+type DiffNode struct {
+	Label    string `json:"Label"`    // Description of the node used to match it between graphs
+	Type     string `json:"Type"`     // The type of the node
+	Name     string `json:"Name"`     // The package or goal name of the node
+	Version  string `json:"Version"`  // The version constraints of the node
+	SrpmPath string `json:"SrpmPath"` // The SRPM which provides the node
+}
+
+// VersionChange is a package whose version differs between two graphs.
+type VersionChange struct {
+	Type       string `json:"Type"`       // The type of the node
+	Name       string `json:"Name"`       // The package name of the node
+	OldVersion string `json:"OldVersion"` // The version constraints in the old graph
+	NewVersion string `json:"NewVersion"` // The version constraints in the new graph
+}
+
+// DiffEdge is a dependency which differs between two graphs, identified by the labels of its nodes.
+type DiffEdge struct {
+	From string `json:"From"` // The node which depends on To
+	To   string `json:"To"`   // The node which is depended on
+}
+
+// DiffCycle is a cycle between the packages of a single SRPM which the grapher broke with a meta node.
+type DiffCycle struct {
+	SrpmPath string   `json:"SrpmPath"` // The SRPM providing every package in the cycle
+	Packages []string `json:"Packages"` // The names of the packages in the cycle
+}
+
+// IsEmpty returns true if the two graphs are equivalent.
+func (d *GraphDiff) IsEmpty() bool {
+	return len(d.AddedNodes) == 0 && len(d.RemovedNodes) == 0 && len(d.VersionChanges) == 0 &&
+		len(d.AddedEdges) == 0 && len(d.RemovedEdges) == 0 &&
+		len(d.AddedCycles) == 0 && len(d.RemovedCycles) == 0 &&
+		len(d.AddedRebuilds) == 0 && len(d.RemovedRebuilds) == 0
+}
+
+// DiffGraphs compares oldGraph to newGraph.
+// Package nodes are matched by type, name and version. A package node of a given type and name which is
+// found once in each graph with different versions is reported as a version change rather than as a
+// removed and an added node, and its edges are compared as if the version had not changed.
+func DiffGraphs(oldGraph, newGraph *PkgGraph) (diff *GraphDiff) {
+	diff = &GraphDiff{}
+
+	oldLabels := packageLabels(oldGraph)
+	newLabels := packageLabels(newGraph)
+	diff.matchVersionChanges(oldLabels, newLabels)
+	addMetaLabels(oldGraph, oldLabels)
+	addMetaLabels(newGraph, newLabels)
+
+	diff.AddedNodes, diff.RemovedNodes = diffNodes(oldLabels, newLabels, func(n *PkgNode) bool { return true })
+	diff.AddedRebuilds, diff.RemovedRebuilds = diffNodes(oldLabels, newLabels, func(n *PkgNode) bool {
+		return n.Type == TypeBuild && n.State == StateBuild
+	})
+	diff.AddedEdges, diff.RemovedEdges = diffEdges(oldGraph, oldLabels, newGraph, newLabels)
+	diff.AddedCycles, diff.RemovedCycles = diffCycles(oldGraph, newGraph)
+
+	return
+}
+
+// nodeVersion formats the version constraints of a node, such as ">=1.0,<2.0".
+func nodeVersion(n *PkgNode) (version string) {
+	pkgVer := n.VersionedPkg
+	if pkgVer == nil || pkgVer.IsRich() {
+		return
+	}
+
+	if pkgVer.Condition != "" || pkgVer.Version != "" {
+		version = pkgVer.Condition + pkgVer.EVR()
+	}
+	if pkgVer.SCondition != "" || pkgVer.SVersion != "" {
+		version = fmt.Sprintf("%s,%s%s", version, pkgVer.SCondition, pkgVer.SEVR())
+	}
+	return
+}
+
+// nodeName returns the package or goal name of a node.
+func nodeName(n *PkgNode) string {
+	switch {
+	case n.Type == TypeGoal:
+		return n.GoalName
+	case n.VersionedPkg != nil:
+		return n.VersionedPkg.Name
+	default:
+		return ""
+	}
+}
+
+// nodeType returns the type of a node, prefixed with "Bootstrap" for the nodes of bootstrap builds.
+func nodeType(n *PkgNode) string {
+	if n.Bootstrap {
+		return "Bootstrap" + n.Type.String()
+	}
+	return n.Type.String()
+}
+
+// packageLabel describes a non-meta node by its type, name and version, such as "Run foo =1.0-1".
+func packageLabel(n *PkgNode) (label string) {
+	label = fmt.Sprintf("%s %s", nodeType(n), nodeName(n))
+	if version := nodeVersion(n); version != "" {
+		label = fmt.Sprintf("%s %s", label, version)
+	}
+	return
+}
+
+// isCycleMetaNode returns true if the node was added by the grapher to break a cycle between the packages of an SRPM.
+func isCycleMetaNode(n *PkgNode) bool {
+	return n.Type == TypePureMeta && n.VersionedPkg == nil && n.SrpmPath != ""
+}
+
+// packageLabels labels every node of a graph except for the meta nodes.
+func packageLabels(g *PkgGraph) (labels map[*PkgNode]string) {
+	labels = make(map[*PkgNode]string)
+	for _, n := range g.AllNodes() {
+		if n.Type != TypePureMeta {
+			labels[n] = packageLabel(n)
+		}
+	}
+	return
+}
+
+// matchVersionChanges pairs the nodes of each graph which share a type and name but have no exact match in the other graph.
+// The old node of every pair is relabeled to match the new node.
+func (d *GraphDiff) matchVersionChanges(oldLabels, newLabels map[*PkgNode]string) {
+	oldUnmatched := unmatchedByName(oldLabels, newLabels)
+	newUnmatched := unmatchedByName(newLabels, oldLabels)
+
+	for key, oldNodes := range oldUnmatched {
+		newNodes := newUnmatched[key]
+		if len(oldNodes) != 1 || len(newNodes) != 1 {
+			continue
+		}
+
+		oldNode, newNode := oldNodes[0], newNodes[0]
+		d.VersionChanges = append(d.VersionChanges, &VersionChange{
+			Type:       nodeType(oldNode),
+			Name:       nodeName(oldNode),
+			OldVersion: nodeVersion(oldNode),
+			NewVersion: nodeVersion(newNode),
+		})
+		oldLabels[oldNode] = newLabels[newNode]
+	}
+
+	sort.Slice(d.VersionChanges, func(i, j int) bool {
+		if d.VersionChanges[i].Name != d.VersionChanges[j].Name {
+			return d.VersionChanges[i].Name < d.VersionChanges[j].Name
+		}
+		return d.VersionChanges[i].Type < d.VersionChanges[j].Type
+	})
+}
+
+// unmatchedByName groups the nodes of labels which have more copies than in otherLabels by their type and name.
+func unmatchedByName(labels, otherLabels map[*PkgNode]string) (unmatched map[string][]*PkgNode) {
+	unmatched = make(map[string][]*PkgNode)
+	otherNodes := nodesByLabel(otherLabels)
+	for label, nodes := range nodesByLabel(labels) {
+		if len(nodes) <= len(otherNodes[label]) {
+			continue
+		}
+
+		for _, n := range nodes[len(otherNodes[label]):] {
+			key := fmt.Sprintf("%s %s", nodeType(n), nodeName(n))
+			unmatched[key] = append(unmatched[key], n)
+		}
+	}
+	return
+}
+
+// addMetaLabels labels every meta node of a graph.
+// Rich dependencies are labeled by their expression, cycle meta nodes by their SRPM and the nodes in the cycle,
+// and other meta nodes by the nodes they depend on.
+func addMetaLabels(g *PkgGraph, labels map[*PkgNode]string) {
+	var labelOf func(n *PkgNode) string
+	labelOf = func(n *PkgNode) string {
+		if label, found := labels[n]; found {
+			return label
+		}
+
+		if n.VersionedPkg != nil {
+			labels[n] = fmt.Sprintf("%s %s", n.Type.String(), n.VersionedPkg.Name)
+			return labels[n]
+		}
+
+		// Use a placeholder while the neighbors are labeled in case meta nodes depend on each other in a cycle
+		labels[n] = n.Type.String()
+
+		neighbors := g.From(n.ID())
+		if isCycleMetaNode(n) {
+			neighbors = g.To(n.ID())
+		}
+
+		var neighborLabels []string
+		for neighbors.Next() {
+			neighborLabels = append(neighborLabels, labelOf(neighbors.Node().(*PkgNode).This))
+		}
+		sort.Strings(neighborLabels)
+
+		if isCycleMetaNode(n) {
+			labels[n] = fmt.Sprintf("%s cycle in %s [%s]", n.Type.String(), n.SrpmPath, strings.Join(neighborLabels, ", "))
+		} else {
+			labels[n] = fmt.Sprintf("%s [%s]", n.Type.String(), strings.Join(neighborLabels, ", "))
+		}
+		return labels[n]
+	}
+
+	for _, n := range g.AllNodes() {
+		labelOf(n)
+	}
+}
+
+// nodesByLabel groups nodes by their label, sorting each group by node ID.
+func nodesByLabel(labels map[*PkgNode]string) (nodes map[string][]*PkgNode) {
+	nodes = make(map[string][]*PkgNode)
+	for n, label := range labels {
+		nodes[label] = append(nodes[label], n)
+	}
+	for _, group := range nodes {
+		sort.Slice(group, func(i, j int) bool { return group[i].ID() < group[j].ID() })
+	}
+	return
+}
+
+// diffNodes returns the nodes accepted by filter which have more copies in one graph than in the other.
+func diffNodes(oldLabels, newLabels map[*PkgNode]string, filter func(n *PkgNode) bool) (added, removed []*DiffNode) {
+	filterNodes := func(labels map[*PkgNode]string) (filtered map[string][]*PkgNode) {
+		filtered = make(map[string][]*PkgNode)
+		for label, nodes := range nodesByLabel(labels) {
+			for _, n := range nodes {
+				if filter(n) {
+					filtered[label] = append(filtered[label], n)
+				}
+			}
+		}
+		return
+	}
+
+	oldNodes := filterNodes(oldLabels)
+	newNodes := filterNodes(newLabels)
+	extraNodes := func(nodes, otherNodes map[string][]*PkgNode) (extra []*DiffNode) {
+		for label, group := range nodes {
+			if len(group) <= len(otherNodes[label]) {
+				continue
+			}
+
+			for _, n := range group[len(otherNodes[label]):] {
+				extra = append(extra, &DiffNode{
+					Label:    label,
+					Type:     nodeType(n),
+					Name:     nodeName(n),
+					Version:  nodeVersion(n),
+					SrpmPath: n.SrpmPath,
+				})
+			}
+		}
+		sort.Slice(extra, func(i, j int) bool { return extra[i].Label < extra[j].Label })
+		return
+	}
+
+	return extraNodes(newNodes, oldNodes), extraNodes(oldNodes, newNodes)
+}
+
+// diffEdges returns the edges, identified by the labels of their nodes, which are only found in one of the graphs.
+func diffEdges(oldGraph *PkgGraph, oldLabels map[*PkgNode]string, newGraph *PkgGraph, newLabels map[*PkgNode]string) (added, removed []*DiffEdge) {
+	edgeSet := func(g *PkgGraph, labels map[*PkgNode]string) (edges map[DiffEdge]bool) {
+		edges = make(map[DiffEdge]bool)
+		for _, n := range g.AllNodes() {
+			dependencies := g.From(n.ID())
+			for dependencies.Next() {
+				dependency := dependencies.Node().(*PkgNode).This
+				edges[DiffEdge{From: labels[n], To: labels[dependency]}] = true
+			}
+		}
+		return
+	}
+
+	oldEdges := edgeSet(oldGraph, oldLabels)
+	newEdges := edgeSet(newGraph, newLabels)
+	extraEdges := func(edges, otherEdges map[DiffEdge]bool) (extra []*DiffEdge) {
+		for edge := range edges {
+			if !otherEdges[edge] {
+				extraEdge := edge
+				extra = append(extra, &extraEdge)
+			}
+		}
+		sort.Slice(extra, func(i, j int) bool {
+			if extra[i].From != extra[j].From {
+				return extra[i].From < extra[j].From
+			}
+			return extra[i].To < extra[j].To
+		})
+		return
+	}
+
+	return extraEdges(newEdges, oldEdges), extraEdges(oldEdges, newEdges)
+}
+
+// diffCycles returns the cycles broken by the grapher which are only found in one of the graphs.
+func diffCycles(oldGraph, newGraph *PkgGraph) (added, removed []*DiffCycle) {
+	cycleSet := func(g *PkgGraph) (cycles map[string]*DiffCycle) {
+		cycles = make(map[string]*DiffCycle)
+		for _, n := range g.AllNodes() {
+			if !isCycleMetaNode(n) {
+				continue
+			}
+
+			cycle := &DiffCycle{SrpmPath: n.SrpmPath}
+			members := make(map[string]bool)
+			cycleNodes := g.To(n.ID())
+			for cycleNodes.Next() {
+				members[nodeName(cycleNodes.Node().(*PkgNode).This)] = true
+			}
+			for name := range members {
+				cycle.Packages = append(cycle.Packages, name)
+			}
+			sort.Strings(cycle.Packages)
+
+			cycles[fmt.Sprintf("%s [%s]", cycle.SrpmPath, strings.Join(cycle.Packages, ", "))] = cycle
+		}
+		return
+	}
+
+	oldCycles := cycleSet(oldGraph)
+	newCycles := cycleSet(newGraph)
+	extraCycles := func(cycles, otherCycles map[string]*DiffCycle) (extra []*DiffCycle) {
+		var keys []string
+		for key := range cycles {
+			if otherCycles[key] == nil {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			extra = append(extra, cycles[key])
+		}
+		return
+	}
+
+	return extraCycles(newCycles, oldCycles), extraCycles(oldCycles, newCycles)
+}
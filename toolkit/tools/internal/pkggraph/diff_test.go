@@ -0,0 +1,136 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package pkggraph
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"microsoft.com/pkggen/internal/pkgjson"
+)
+
+// addDiffTestPackage adds a run and a build node for a package built from an SRPM of the same name.
+func addDiffTestPackage(t *testing.T, g *PkgGraph, name, version string, state NodeState) (runNode, buildNode *PkgNode) {
+	pkgVer := &pkgjson.PackageVer{Name: name, Condition: "=", Version: version}
+	srpmPath := name + ".src.rpm"
+
+	runNode, err := g.AddPkgNode(pkgVer, StateMeta, TypeRun, srpmPath, name+".spec", "", "x86_64", "")
+	assert.NoError(t, err)
+	buildNode, err = g.AddPkgNode(pkgVer, state, TypeBuild, srpmPath, name+".spec", "", "x86_64", "")
+	assert.NoError(t, err)
+	g.SetEdge(g.NewEdge(runNode, buildNode))
+	return
+}
+
+// diffTestGraph creates a graph where "bar" needs "foo" to build.
+func diffTestGraph(t *testing.T, fooVersion string, fooState NodeState) (g *PkgGraph) {
+	g = NewPkgGraph()
+	fooRun, _ := addDiffTestPackage(t, g, "foo", fooVersion, fooState)
+	_, barBuild := addDiffTestPackage(t, g, "bar", "1.0", StateBuild)
+	g.SetEdge(g.NewEdge(barBuild, fooRun))
+	return
+}
+
+func TestDiffGraphsShouldFindNoChanges(t *testing.T) {
+	diff := DiffGraphs(diffTestGraph(t, "1.0", StateBuild), diffTestGraph(t, "1.0", StateBuild))
+	assert.True(t, diff.IsEmpty())
+}
+
+func TestDiffGraphsVersionChange(t *testing.T) {
+	diff := DiffGraphs(diffTestGraph(t, "1.0", StateBuild), diffTestGraph(t, "2.0", StateBuild))
+
+	assert.Equal(t, []*VersionChange{
+		{Type: "Build", Name: "foo", OldVersion: "=1.0", NewVersion: "=2.0"},
+		{Type: "Run", Name: "foo", OldVersion: "=1.0", NewVersion: "=2.0"},
+	}, diff.VersionChanges)
+	assert.Empty(t, diff.AddedNodes)
+	assert.Empty(t, diff.RemovedNodes)
+	assert.Empty(t, diff.AddedEdges)
+	assert.Empty(t, diff.RemovedEdges)
+	assert.Empty(t, diff.AddedRebuilds)
+}
+
+func TestDiffGraphsAddedPackage(t *testing.T) {
+	newGraph := diffTestGraph(t, "1.0", StateBuild)
+	bazRun, _ := addDiffTestPackage(t, newGraph, "baz", "3.0", StateUpToDate)
+	barBuild, err := newGraph.FindExactPkgNodeFromPkg(&pkgjson.PackageVer{Name: "bar", Condition: "=", Version: "1.0"})
+	assert.NoError(t, err)
+	newGraph.SetEdge(newGraph.NewEdge(barBuild.BuildNode, bazRun))
+
+	diff := DiffGraphs(diffTestGraph(t, "1.0", StateBuild), newGraph)
+
+	assert.Equal(t, []*DiffNode{
+		{Label: "Build baz =3.0", Type: "Build", Name: "baz", Version: "=3.0", SrpmPath: "baz.src.rpm"},
+		{Label: "Run baz =3.0", Type: "Run", Name: "baz", Version: "=3.0", SrpmPath: "baz.src.rpm"},
+	}, diff.AddedNodes)
+	assert.Equal(t, []*DiffEdge{
+		{From: "Build bar =1.0", To: "Run baz =3.0"},
+		{From: "Run baz =3.0", To: "Build baz =3.0"},
+	}, diff.AddedEdges)
+	assert.Empty(t, diff.RemovedNodes)
+	assert.Empty(t, diff.RemovedEdges)
+	assert.Empty(t, diff.AddedRebuilds)
+}
+
+func TestDiffGraphsRemovedEdge(t *testing.T) {
+	newGraph := diffTestGraph(t, "1.0", StateBuild)
+	fooRun, err := newGraph.FindExactPkgNodeFromPkg(&pkgjson.PackageVer{Name: "foo", Condition: "=", Version: "1.0"})
+	assert.NoError(t, err)
+	barBuild, err := newGraph.FindExactPkgNodeFromPkg(&pkgjson.PackageVer{Name: "bar", Condition: "=", Version: "1.0"})
+	assert.NoError(t, err)
+	newGraph.RemoveEdge(barBuild.BuildNode.ID(), fooRun.RunNode.ID())
+
+	diff := DiffGraphs(diffTestGraph(t, "1.0", StateBuild), newGraph)
+	assert.Equal(t, []*DiffEdge{{From: "Build bar =1.0", To: "Run foo =1.0"}}, diff.RemovedEdges)
+	assert.Empty(t, diff.AddedEdges)
+}
+
+func TestDiffGraphsRebuilds(t *testing.T) {
+	diff := DiffGraphs(diffTestGraph(t, "1.0", StateUpToDate), diffTestGraph(t, "1.0", StateBuild))
+
+	assert.Equal(t, []*DiffNode{
+		{Label: "Build foo =1.0", Type: "Build", Name: "foo", Version: "=1.0", SrpmPath: "foo.src.rpm"},
+	}, diff.AddedRebuilds)
+	assert.Empty(t, diff.RemovedRebuilds)
+	assert.Empty(t, diff.AddedNodes)
+}
+
+func TestDiffGraphsCycles(t *testing.T) {
+	newGraph := diffTestGraph(t, "1.0", StateBuild)
+	fooRun, _ := addDiffTestPackage(t, newGraph, "foo-libs", "1.0", StateBuild)
+	fooDevelRun, _ := addDiffTestPackage(t, newGraph, "foo-devel", "1.0", StateBuild)
+
+	// Mimic a cycle between two subpackages broken by the grapher
+	metaNode := newGraph.AddMetaNode([]*PkgNode{fooRun, fooDevelRun}, nil)
+	metaNode.SrpmPath = "foo.src.rpm"
+
+	diff := DiffGraphs(diffTestGraph(t, "1.0", StateBuild), newGraph)
+	assert.Equal(t, []*DiffCycle{
+		{SrpmPath: "foo.src.rpm", Packages: []string{"foo-devel", "foo-libs"}},
+	}, diff.AddedCycles)
+	assert.Empty(t, diff.RemovedCycles)
+	assert.Contains(t, diff.AddedEdges, &DiffEdge{
+		From: "Run foo-libs =1.0",
+		To:   "PureMeta cycle in foo.src.rpm [Run foo-devel =1.0, Run foo-libs =1.0]",
+	})
+
+	diff = DiffGraphs(newGraph, diffTestGraph(t, "1.0", StateBuild))
+	assert.Len(t, diff.RemovedCycles, 1)
+	assert.Empty(t, diff.AddedCycles)
+}
+
+func TestDiffGraphsBootstrap(t *testing.T) {
+	newGraph := diffTestGraph(t, "1.0", StateBuild)
+	foo, err := newGraph.FindExactPkgNodeFromPkg(&pkgjson.PackageVer{Name: "foo", Condition: "=", Version: "1.0"})
+	assert.NoError(t, err)
+	_, err = newGraph.AddBootstrapNode(foo.BuildNode)
+	assert.NoError(t, err)
+
+	diff := DiffGraphs(diffTestGraph(t, "1.0", StateBuild), newGraph)
+	assert.Equal(t, []*DiffNode{
+		{Label: "BootstrapBuild foo =1.0", Type: "BootstrapBuild", Name: "foo", Version: "=1.0", SrpmPath: "foo.src.rpm"},
+	}, diff.AddedNodes)
+	assert.Empty(t, diff.VersionChanges)
+	assert.Empty(t, diff.RemovedNodes)
+}
@@ -25,18 +25,20 @@ import (
 	"microsoft.com/pkggen/internal/versioncompare"
 )
 
-// NodeState indicates if a node is a package node (build, upToDate,unresolved,cached) or a meta node (meta)
+// NodeState indicates if a node is a package node (build, upToDate,unresolved,cached,buildError,blocked) or a meta node (meta)
 type NodeState int
 
 // Valid values for NodeState type
 const (
-	StateUnknown    NodeState = iota        // Unknown state
-	StateMeta       NodeState = iota        // Meta nodes do not represent actual build artifacts, but additional nodes used for managing dependencies
-	StateBuild      NodeState = iota        // A package from a local SRPM which should be built from source
-	StateUpToDate   NodeState = iota        // A local RPM is already built and is available
-	StateUnresolved NodeState = iota        // A dependency is not available locally and must be acquired from a remote repo
-	StateCached     NodeState = iota        // A dependency was not available locally, but is now available in the chache
-	StateMAX        NodeState = StateCached // Max allowable state
+	StateUnknown    NodeState = iota         // Unknown state
+	StateMeta       NodeState = iota         // Meta nodes do not represent actual build artifacts, but additional nodes used for managing dependencies
+	StateBuild      NodeState = iota         // A package from a local SRPM which should be built from source
+	StateUpToDate   NodeState = iota         // A local RPM is already built and is available
+	StateUnresolved NodeState = iota         // A dependency is not available locally and must be acquired from a remote repo
+	StateCached     NodeState = iota         // A dependency was not available locally, but is now available in the chache
+	StateBuildError NodeState = iota         // A package from a local SRPM which failed to build
+	StateBlocked    NodeState = iota         // A package which can't be built or used because one of its dependencies failed to build
+	StateMAX        NodeState = StateBlocked // Max allowable state
 )
 
 // NodeType indicates the general node type (build, run, goal, remote).
@@ -73,6 +75,7 @@ type PkgNode struct {
 	Architecture string              // The architecture of the resulting package built.
 	SourceRepo   string              // The location this package was acquired from
 	GoalName     string              // Optional string for goal nodes
+	Bootstrap    bool                // The node belongs to the bootstrap build of its SRPM (see AddBootstrapNode)
 	This         *PkgNode            // Self reference since the graph library returns nodes by value, not reference
 }
 
@@ -109,6 +112,10 @@ func (n NodeState) String() string {
 		return "Unresolved"
 	case StateCached:
 		return "Cached"
+	case StateBuildError:
+		return "BuildError"
+	case StateBlocked:
+		return "Blocked"
 	default:
 		logger.Log.Panic("Invalid NodeState encountered when serializing to string!")
 		return "error"
@@ -149,6 +156,10 @@ func (n *PkgNode) DOTColor() string {
 		return "crimson"
 	case StateCached:
 		return "darkorchid"
+	case StateBuildError:
+		return "red"
+	case StateBlocked:
+		return "darkorange"
 	default:
 		logger.Log.Panic("Invalid NodeState encountered when serializing to color!")
 		return "error"
@@ -289,6 +300,12 @@ func (g *PkgGraph) addToLookup(pkgNode *PkgNode, deferSort bool) (err error) {
 		return
 	}
 
+	// Bootstrap builds provide the same packages as the regular builds, only explicit edges lead to them
+	if pkgNode.Bootstrap {
+		logger.Log.Tracef("Skipping %+v, bootstrap nodes are not tracked for lookup", pkgNode)
+		return
+	}
+
 	_, err = g.validateNodeForLookup(pkgNode)
 	if err != nil {
 		return
@@ -382,6 +399,43 @@ func (g *PkgGraph) AddPkgNode(versionedPkg *pkgjson.PackageVer, nodestate NodeSt
 	return
 }
 
+// AddBootstrapNode adds a copy of a "Run" or "Build" node for the bootstrap build of its SRPM. Bootstrap
+// nodes are not recorded in the lookup table, dependencies only lead to them through edges added explicitly.
+func (g *PkgGraph) AddBootstrapNode(node *PkgNode) (bootstrapNode *PkgNode, err error) {
+	if node.Type != TypeRun && node.Type != TypeBuild {
+		err = fmt.Errorf("can't bootstrap %s, only run and build nodes may be bootstrapped", node.FriendlyName())
+		return
+	}
+	if node.Bootstrap {
+		err = fmt.Errorf("%s is already a bootstrap node", node.FriendlyName())
+		return
+	}
+
+	bootstrapNode = &PkgNode{
+		nodeID:       g.NewNode().ID(),
+		VersionedPkg: node.VersionedPkg,
+		State:        node.State,
+		Type:         node.Type,
+		SrpmPath:     node.SrpmPath,
+		SpecPath:     node.SpecPath,
+		SourceDir:    node.SourceDir,
+		Architecture: node.Architecture,
+		SourceRepo:   node.SourceRepo,
+		Bootstrap:    true,
+	}
+	bootstrapNode.This = bootstrapNode
+
+	// g.AddNode will panic on error (such as duplicate node IDs)
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("adding bootstrap node failed for %s", node.FriendlyName())
+		}
+	}()
+	g.AddNode(bootstrapNode)
+
+	return
+}
+
 // FindDoubleConditionalPkgNodeFromPkg has the same behavior as FindConditionalPkgNodeFromPkg but supports two conditionals
 func (g *PkgGraph) FindDoubleConditionalPkgNodeFromPkg(pkgVer *pkgjson.PackageVer) (lookupEntry *LookupNode, err error) {
 	var (
@@ -477,6 +531,45 @@ func (g *PkgGraph) AllNodesFrom(rootNode *PkgNode) []*PkgNode {
 	return nodes
 }
 
+// MarkDependantsBlocked marks every node which transitively depends on a failed build node as StateBlocked.
+// Nodes which are already available (up-to-date or cached) do not need the failed node and are not traversed.
+// Returns the nodes which were newly marked as blocked.
+func (g *PkgGraph) MarkDependantsBlocked(failedNode *PkgNode) (blockedNodes []*PkgNode, err error) {
+	if failedNode.Type != TypeBuild || failedNode.State != StateBuildError {
+		err = fmt.Errorf("%s is not a failed build node", failedNode)
+		return
+	}
+
+	visited := map[int64]bool{failedNode.ID(): true}
+	toVisit := []*PkgNode{failedNode}
+	for len(toVisit) > 0 {
+		var n *PkgNode
+		n, toVisit = toVisit[0], toVisit[1:]
+
+		for _, dependant := range graph.NodesOf(g.To(n.ID())) {
+			dependantNode := dependant.(*PkgNode).This
+			if visited[dependantNode.ID()] {
+				continue
+			}
+			visited[dependantNode.ID()] = true
+
+			switch dependantNode.State {
+			case StateUpToDate, StateCached:
+				continue
+			case StateBuildError, StateBlocked:
+				// Already failed, but anything depending on it is still blocked.
+			default:
+				dependantNode.State = StateBlocked
+				blockedNodes = append(blockedNodes, dependantNode)
+			}
+
+			toVisit = append(toVisit, dependantNode)
+		}
+	}
+
+	return
+}
+
 // AllRunNodes returns a list of all run nodes in the graph
 func (g *PkgGraph) AllRunNodes() []*PkgNode {
 	count := 0
@@ -531,8 +624,14 @@ func (n PkgNode) SetDOTID(id string) {
 func (n *PkgNode) FriendlyName() string {
 	switch n.Type {
 	case TypeBuild:
+		if n.Bootstrap {
+			return fmt.Sprintf("%s-%s-BOOTSTRAP-BUILD<%s>", n.VersionedPkg.Name, n.VersionedPkg.Version, n.State.String())
+		}
 		return fmt.Sprintf("%s-%s-BUILD<%s>", n.VersionedPkg.Name, n.VersionedPkg.Version, n.State.String())
 	case TypeRun:
+		if n.Bootstrap {
+			return fmt.Sprintf("%s-%s-BOOTSTRAP-RUN<%s>", n.VersionedPkg.Name, n.VersionedPkg.Version, n.State.String())
+		}
 		return fmt.Sprintf("%s-%s-RUN<%s>", n.VersionedPkg.Name, n.VersionedPkg.Version, n.State.String())
 	case TypeRemote:
 		ver1 := fmt.Sprintf("%s%s", n.VersionedPkg.Condition, n.VersionedPkg.Version)
@@ -544,6 +643,9 @@ func (n *PkgNode) FriendlyName() string {
 	case TypeGoal:
 		return fmt.Sprintf("%s", n.GoalName)
 	case TypePureMeta:
+		if n.VersionedPkg != nil {
+			return fmt.Sprintf("Meta(%d)<%s>", n.ID(), n.VersionedPkg.Name)
+		}
 		return fmt.Sprintf("Meta(%d)", n.ID())
 	default:
 		return "UNKNOWN NODE TYPE"
@@ -589,7 +691,8 @@ func (n *PkgNode) Equal(otherNode *PkgNode) bool {
 		n.SourceDir == otherNode.SourceDir &&
 		n.Architecture == otherNode.Architecture &&
 		n.SourceRepo == otherNode.SourceRepo &&
-		n.GoalName == otherNode.GoalName
+		n.GoalName == otherNode.GoalName &&
+		n.Bootstrap == otherNode.Bootstrap
 }
 
 func registerTypes() {
@@ -654,6 +757,11 @@ func (n PkgNode) MarshalBinary() (data []byte, err error) {
 		err = fmt.Errorf("encoding GoalName: %s", err.Error())
 		return
 	}
+	err = encoder.Encode(n.Bootstrap)
+	if err != nil {
+		err = fmt.Errorf("encoding Bootstrap: %s", err.Error())
+		return
+	}
 	return outBuffer.Bytes(), err
 }
 
@@ -713,6 +821,14 @@ func (n *PkgNode) UnmarshalBinary(inBuffer []byte) (err error) {
 		err = fmt.Errorf("decoding GoalName: %s", err.Error())
 		return
 	}
+	// Graphs written before bootstrap builds were supported end here
+	err = decoder.Decode(&n.Bootstrap)
+	if err == io.EOF {
+		err = nil
+	} else if err != nil {
+		err = fmt.Errorf("decoding Bootstrap: %s", err.Error())
+		return
+	}
 	n.This = n
 	return
 }
@@ -953,6 +1069,42 @@ func (g *PkgGraph) CreateSubGraph(rootNode *PkgNode) (subGraph *PkgGraph, err er
 	return
 }
 
+// BuildRequiresGraph returns a copy of graphIn which only contains the nodes in nodeList and everything they
+// require, directly or indirectly. A meta node linking to every node in nodeList is added as the root of the graph.
+func BuildRequiresGraph(graphIn *PkgGraph, nodeList []*PkgNode) (graphOut *PkgGraph, err error) {
+	// Make a copy of the graph
+	newGraph, err := graphIn.DeepCopy()
+	if err != nil {
+		return
+	}
+
+	// Add a goal node to all the things we care about
+	root := newGraph.AddMetaNode(nil, nodeList)
+	graphOut, err = newGraph.CreateSubGraph(root)
+	return
+}
+
+// BuildDependsOnGraph returns a reversed copy of graphIn which only contains the nodes in nodeList and everything
+// depending on them, directly or indirectly. A meta node linking to every node in nodeList is added as the root of the graph.
+func BuildDependsOnGraph(graphIn *PkgGraph, nodeList []*PkgNode) (graphOut *PkgGraph, err error) {
+	// Make a copy of the graph
+	reversedGraph, err := graphIn.DeepCopy()
+	if err != nil {
+		return
+	}
+
+	// Then reverse every edge in the graph
+	for _, edge := range graph.EdgesOf(reversedGraph.Edges()) {
+		reversedGraph.RemoveEdge(edge.From().ID(), edge.To().ID())
+		reversedGraph.SetEdge(edge.ReversedEdge())
+	}
+
+	// Add a goal node to all the things we care about
+	root := reversedGraph.AddMetaNode(nil, nodeList)
+	graphOut, err = reversedGraph.CreateSubGraph(root)
+	return
+}
+
 // WriteDOTGraphFile writes the graph to a DOT graph format file
 func WriteDOTGraphFile(g graph.Directed, filename string) (err error) {
 	logger.Log.Infof("Writing DOT graph to %s", filename)
@@ -288,6 +288,8 @@ func TestNodeStateString(t *testing.T) {
 	assert.Equal(t, "UpToDate", StateUpToDate.String())
 	assert.Equal(t, "Unresolved", StateUnresolved.String())
 	assert.Equal(t, "Cached", StateCached.String())
+	assert.Equal(t, "BuildError", StateBuildError.String())
+	assert.Equal(t, "Blocked", StateBlocked.String())
 	var s NodeState
 	s = -1
 	assert.Panics(t, func() { _ = s.String() })
@@ -833,6 +835,82 @@ func TestMetaNodeAddPkg(t *testing.T) {
 	assert.Equal(t, 5, len(g.AllNodesFrom(c.RunNode)))
 }
 
+// Make sure meta nodes representing rich dependencies survive being encoded and decoded.
+func TestEncodeDecodeRichMetaNodeDOT(t *testing.T) {
+	gOut, err := buildTestGraphHelper()
+	assert.NoError(t, err)
+
+	richDependency, err := pkgjson.ParseRichDependency("(A or (C >= 2 if B))")
+	assert.NoError(t, err)
+
+	a, _ := gOut.FindBestPkgNode(&pkgjson.PackageVer{Name: "A"})
+	meta := gOut.AddMetaNode(nil, []*PkgNode{a.RunNode})
+	meta.VersionedPkg = richDependency
+	assert.Equal(t, fmt.Sprintf("Meta(%d)<(A or (C >= 2 if B))>", meta.ID()), meta.FriendlyName())
+
+	var buf bytes.Buffer
+	err = WriteDOTGraph(gOut, &buf)
+	assert.NoError(t, err)
+
+	gIn := NewPkgGraph()
+	err = ReadDOTGraph(gIn, &buf)
+	assert.NoError(t, err)
+
+	metaIn := gIn.Node(meta.ID()).(*PkgNode)
+	assert.Equal(t, TypePureMeta, metaIn.Type)
+	assert.Equal(t, richDependency, metaIn.VersionedPkg)
+	assert.Equal(t, 1, gIn.From(meta.ID()).Len())
+}
+
+// Make sure bootstrap nodes stay out of the lookup table, even after being encoded and decoded.
+func TestBootstrapNode(t *testing.T) {
+	gOut, err := buildTestGraphHelper()
+	assert.NoError(t, err)
+
+	a, err := gOut.FindExactPkgNodeFromPkg(&pkgA)
+	assert.NoError(t, err)
+	bootstrapBuild, err := gOut.AddBootstrapNode(a.BuildNode)
+	assert.NoError(t, err)
+	bootstrapRun, err := gOut.AddBootstrapNode(a.RunNode)
+	assert.NoError(t, err)
+	gOut.SetEdge(gOut.NewEdge(bootstrapRun, bootstrapBuild))
+
+	assert.True(t, bootstrapBuild.Bootstrap)
+	assert.Equal(t, "A-1-BOOTSTRAP-BUILD<Build>", bootstrapBuild.FriendlyName())
+	assert.False(t, bootstrapBuild.Equal(a.BuildNode))
+
+	_, err = gOut.AddBootstrapNode(bootstrapBuild)
+	assert.Error(t, err)
+
+	var buf bytes.Buffer
+	err = WriteDOTGraph(gOut, &buf)
+	assert.NoError(t, err)
+
+	gIn := NewPkgGraph()
+	err = ReadDOTGraph(gIn, &buf)
+	assert.NoError(t, err)
+
+	bootstrapIn := gIn.Node(bootstrapBuild.ID()).(*PkgNode)
+	assert.True(t, bootstrapIn.Bootstrap)
+
+	aIn, err := gIn.FindExactPkgNodeFromPkg(&pkgA)
+	assert.NoError(t, err)
+	assert.False(t, aIn.BuildNode.Bootstrap)
+	assert.False(t, aIn.RunNode.Bootstrap)
+}
+
+// Only run and build nodes may be bootstrapped.
+func TestBootstrapNodeInvalidType(t *testing.T) {
+	g, err := buildTestGraphHelper()
+	assert.NoError(t, err)
+
+	goal, err := g.AddGoalNode("test", nil, false)
+	assert.NoError(t, err)
+
+	_, err = g.AddBootstrapNode(goal)
+	assert.Error(t, err)
+}
+
 // Test encoding and decoding a DOT formatted graph
 func TestEncodeDecodeDOT(t *testing.T) {
 
@@ -851,6 +929,34 @@ func TestEncodeDecodeDOT(t *testing.T) {
 	checkTestGraph(t, gIn)
 }
 
+// Make sure the failure states survive being encoded and decoded.
+func TestEncodeDecodeFailureStatesDOT(t *testing.T) {
+	gOut, err := buildTestGraphHelper()
+	assert.NoError(t, err)
+
+	cBuild, err := gOut.FindExactPkgNodeFromPkg(&pkgC)
+	assert.NoError(t, err)
+	cBuild.BuildNode.State = StateBuildError
+	aBuild, err := gOut.FindExactPkgNodeFromPkg(&pkgA)
+	assert.NoError(t, err)
+	aBuild.BuildNode.State = StateBlocked
+
+	var buf bytes.Buffer
+	err = WriteDOTGraph(gOut, &buf)
+	assert.NoError(t, err)
+
+	gIn := NewPkgGraph()
+	err = ReadDOTGraph(gIn, &buf)
+	assert.NoError(t, err)
+
+	cBuild, err = gIn.FindExactPkgNodeFromPkg(&pkgC)
+	assert.NoError(t, err)
+	assert.Equal(t, StateBuildError, cBuild.BuildNode.State)
+	aBuild, err = gIn.FindExactPkgNodeFromPkg(&pkgA)
+	assert.NoError(t, err)
+	assert.Equal(t, StateBlocked, aBuild.BuildNode.State)
+}
+
 // Test the deep copy functionality works as expected.
 func TestDeepCopy(t *testing.T) {
 
@@ -939,6 +1045,80 @@ func TestReferenceDOTFile(t *testing.T) {
 	assert.Equal(t, 0, bytes.Compare(bytesFromCode, bytesFromFile))
 }
 
+// Check that a failed build blocks everything which depends on it, and nothing else.
+func TestMarkDependantsBlocked(t *testing.T) {
+	g, err := buildTestGraphHelper()
+	assert.NoError(t, err)
+
+	c, err := g.FindExactPkgNodeFromPkg(&pkgC)
+	assert.NoError(t, err)
+	c.BuildNode.State = StateBuildError
+
+	blockedNodes, err := g.MarkDependantsBlocked(c.BuildNode)
+	assert.NoError(t, err)
+
+	mustBlock := []*PkgNode{
+		pkgCRun,
+		pkgBBuild,
+		pkgBRun,
+		pkgABuild,
+		pkgARun,
+	}
+	assert.Equal(t, len(mustBlock), len(blockedNodes))
+	for _, mustHave := range mustBlock {
+		found := false
+		for _, n := range blockedNodes {
+			found = found || (n.Type == mustHave.Type && n.VersionedPkg.Name == mustHave.VersionedPkg.Name && n.VersionedPkg.Version == mustHave.VersionedPkg.Version)
+		}
+		assert.True(t, found)
+	}
+
+	for _, n := range g.AllNodes() {
+		if n.State == StateBlocked {
+			assert.Contains(t, blockedNodes, n)
+		}
+	}
+	assert.Equal(t, StateBuildError, c.BuildNode.State)
+
+	c2, err := g.FindExactPkgNodeFromPkg(&pkgC2)
+	assert.NoError(t, err)
+	assert.Equal(t, StateBuild, c2.BuildNode.State)
+	assert.Equal(t, StateMeta, c2.RunNode.State)
+}
+
+// Only failed build nodes can block their dependants.
+func TestMarkDependantsBlockedNotFailed(t *testing.T) {
+	g, err := buildTestGraphHelper()
+	assert.NoError(t, err)
+
+	c, err := g.FindExactPkgNodeFromPkg(&pkgC)
+	assert.NoError(t, err)
+
+	_, err = g.MarkDependantsBlocked(c.BuildNode)
+	assert.Error(t, err)
+	_, err = g.MarkDependantsBlocked(c.RunNode)
+	assert.Error(t, err)
+}
+
+// Up-to-date nodes do not need the failed node, so they and their dependants are not blocked.
+func TestMarkDependantsBlockedStopsAtUpToDate(t *testing.T) {
+	g, err := buildTestGraphHelper()
+	assert.NoError(t, err)
+
+	c, err := g.FindExactPkgNodeFromPkg(&pkgC)
+	assert.NoError(t, err)
+	c.BuildNode.State = StateBuildError
+	b, err := g.FindExactPkgNodeFromPkg(&pkgB)
+	assert.NoError(t, err)
+	b.BuildNode.State = StateUpToDate
+
+	blockedNodes, err := g.MarkDependantsBlocked(c.BuildNode)
+	assert.NoError(t, err)
+	assert.Equal(t, []*PkgNode{c.RunNode}, blockedNodes)
+	assert.Equal(t, StateUpToDate, b.BuildNode.State)
+	assert.Equal(t, StateMeta, b.RunNode.State)
+}
+
 // Make sure we can extract a subgraph
 func TestSubgraph(t *testing.T) {
 	g, err := buildTestGraphHelper()
@@ -1000,3 +1180,63 @@ func TestEncodingSubGraph(t *testing.T) {
 	assert.Equal(t, len(component), len(subGraph.AllNodes()))
 	assert.Equal(t, len(component), len(gCopy.AllNodes()))
 }
+
+// Make sure the requires graph contains everything a node needs, plus a root meta node
+func TestBuildRequiresGraph(t *testing.T) {
+	g, err := buildTestGraphHelper()
+	assert.NoError(t, err)
+
+	root, err := g.FindBestPkgNode(&pkgjson.PackageVer{Name: "B"})
+	assert.NoError(t, err)
+	requiresGraph, err := BuildRequiresGraph(g, []*PkgNode{root.RunNode})
+	assert.NoError(t, err)
+
+	component := []*PkgNode{
+		pkgBRun,
+		pkgBBuild,
+		pkgCRun,
+		pkgCBuild,
+		pkgD2Unresolved,
+		pkgD3Unresolved,
+	}
+	for _, mustHave := range component {
+		found := false
+		for _, n := range requiresGraph.AllNodes() {
+			found = found || mustHave.Equal(n)
+		}
+		assert.True(t, found)
+	}
+	assert.Equal(t, len(component)+1, len(requiresGraph.AllNodes()))
+
+	// The original graph is left untouched
+	checkTestGraph(t, g)
+}
+
+// Make sure the depends on graph contains everything depending on a node, plus a root meta node
+func TestBuildDependsOnGraph(t *testing.T) {
+	g, err := buildTestGraphHelper()
+	assert.NoError(t, err)
+
+	root, err := g.FindBestPkgNode(&pkgjson.PackageVer{Name: "C", Version: "3-3"})
+	assert.NoError(t, err)
+	dependsOnGraph, err := BuildDependsOnGraph(g, []*PkgNode{root.RunNode})
+	assert.NoError(t, err)
+
+	component := []*PkgNode{
+		pkgCRun,
+		pkgBBuild,
+		pkgBRun,
+		pkgABuild,
+		pkgARun,
+	}
+	for _, mustHave := range component {
+		found := false
+		for _, n := range dependsOnGraph.AllNodes() {
+			found = found || mustHave.Equal(n)
+		}
+		assert.True(t, found)
+	}
+	assert.Equal(t, len(component)+1, len(dependsOnGraph.AllNodes()))
+
+	checkTestGraph(t, g)
+}
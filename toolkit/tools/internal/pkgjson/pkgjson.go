@@ -5,6 +5,7 @@ package pkgjson
 
 import (
 	"fmt"
+	"strings"
 
 	"microsoft.com/pkggen/internal/versioncompare"
 
@@ -17,16 +18,23 @@ type PackageRepo struct {
 	Repo []*Package `json:"Repo"`
 }
 
-// PackageVer is a representation of a package with name and version information
+// PackageVer is a representation of a package with name and version information.
+// Versions may also carry their epoch inline as an "epoch:" prefix, in which case Epoch and SEpoch are left empty.
+// A rich (boolean) dependency sets Operator and Operands instead of a version, its Name is the full expression.
 type PackageVer struct {
-	Name       string `json:"Name"`       // Name of the package
-	Version    string `json:"Version"`    // Version number of the package
-	Condition  string `json:"Condition"`  // Condition to place on the version number ("<", "=<", "=", ">=", ">")
-	SVersion   string `json:"SVersion"`   // Secondary version number to express bounded versions for dependencies
-	SCondition string `json:"SCondition"` // Secondary version condition to express bounded versions for dependencies
+	Name       string        `json:"Name"`               // Name of the package
+	Epoch      string        `json:"Epoch,omitempty"`    // Epoch of the version number
+	Version    string        `json:"Version"`            // Version number of the package
+	Condition  string        `json:"Condition"`          // Condition to place on the version number ("<", "=<", "=", ">=", ">")
+	SEpoch     string        `json:"SEpoch,omitempty"`   // Epoch of the secondary version number
+	SVersion   string        `json:"SVersion"`           // Secondary version number to express bounded versions for dependencies
+	SCondition string        `json:"SCondition"`         // Secondary version condition to express bounded versions for dependencies
+	Operator   string        `json:"Operator,omitempty"` // Boolean operator of a rich dependency ("and", "or", "if", "unless", "with", "without")
+	Operands   []*PackageVer `json:"Operands,omitempty"` // Operands of a rich dependency, in the order they appear in the expression
 }
 
-// PackageVerInterval encodes the version interval a given PackageVer struct represents
+// PackageVerInterval encodes the version interval a given PackageVer struct represents.
+// The bounds include the epoch of the versions they were created from.
 type PackageVerInterval struct {
 	LowerBound     *versioncompare.TolerantVersion // Lower bound on the range of valid versions
 	UpperBound     *versioncompare.TolerantVersion // Upper bound on the range of valid versions
@@ -35,7 +43,50 @@ type PackageVerInterval struct {
 }
 
 func (pkgVer *PackageVer) String() string {
-	return fmt.Sprintf("%s:C:'%s'V:'%s',C2:'%s'V2:'%s'", pkgVer.Name, pkgVer.Condition, pkgVer.Version, pkgVer.SCondition, pkgVer.SVersion)
+	return fmt.Sprintf("%s:C:'%s'V:'%s',C2:'%s'V2:'%s'", pkgVer.Name, pkgVer.Condition, pkgVer.EVR(), pkgVer.SCondition, pkgVer.SEVR())
+}
+
+// EVR returns the version prefixed with its epoch, if any, e.g. "1:2.0-3".
+func (pkgVer *PackageVer) EVR() string {
+	return joinEpoch(pkgVer.Epoch, pkgVer.Version)
+}
+
+// SEVR returns the secondary version prefixed with its epoch, if any.
+func (pkgVer *PackageVer) SEVR() string {
+	return joinEpoch(pkgVer.SEpoch, pkgVer.SVersion)
+}
+
+// ParseDependency parses a single dependency as printed by rpm, either "name", "name condition version",
+// or a rich dependency such as "(foo or bar)".
+func ParseDependency(dependency string) (pkgVer *PackageVer, err error) {
+	const (
+		nameField      = iota
+		conditionField = iota
+		versionField   = iota
+	)
+
+	if strings.HasPrefix(dependency, "(") {
+		return ParseRichDependency(dependency)
+	}
+
+	fields := strings.Split(dependency, " ")
+	switch {
+	case len(fields) == 1:
+		pkgVer = &PackageVer{Name: fields[nameField]}
+	case len(fields) > versionField:
+		pkgVer = &PackageVer{Name: fields[nameField], Condition: fields[conditionField], Version: fields[versionField]}
+	default:
+		err = fmt.Errorf("dependency (%s) has a condition but no version", dependency)
+	}
+
+	return
+}
+
+func joinEpoch(epoch, version string) string {
+	if epoch == "" || version == "" {
+		return version
+	}
+	return fmt.Sprintf("%s:%s", epoch, version)
 }
 
 // Package is a representation of a package with name and version information
@@ -47,6 +98,9 @@ type Package struct {
 	Architecture  string        `json:"Architecture"`  // The architecture of the package
 	Requires      []*PackageVer `json:"Requires"`      // List of targets this spec requires to install
 	BuildRequires []*PackageVer `json:"BuildRequires"` // List of targets this spec requires to build
+
+	Bootstrap              bool          `json:"Bootstrap,omitempty"`              // The spec may be built in bootstrap mode to break BuildRequires cycles
+	BootstrapBuildRequires []*PackageVer `json:"BootstrapBuildRequires,omitempty"` // List of targets this spec requires to build in bootstrap mode
 }
 
 // ParsePackageJSON reads a package list json file
@@ -78,13 +132,13 @@ func (pkgVer *PackageVer) Interval() (interval PackageVerInterval, err error) {
 		fallthrough
 	case pkgVer.SVersion == "" && pkgVer.Version != "":
 		fallthrough
-	case pkgVer.Version == pkgVer.SVersion && pkgVer.Condition == pkgVer.SCondition:
+	case pkgVer.EVR() == pkgVer.SEVR() && pkgVer.Condition == pkgVer.SCondition:
 		// Only one version set, or duplicated version data
 		if pkgVer.Version != "" {
-			v1 = versioncompare.New(pkgVer.Version)
+			v1 = versioncompare.New(pkgVer.EVR())
 			c1 = pkgVer.Condition
 		} else {
-			v1 = versioncompare.New(pkgVer.SVersion)
+			v1 = versioncompare.New(pkgVer.SEVR())
 			c1 = pkgVer.SCondition
 		}
 
@@ -116,9 +170,9 @@ func (pkgVer *PackageVer) Interval() (interval PackageVerInterval, err error) {
 		}
 	case pkgVer.Version != "" && pkgVer.SVersion != "":
 		// Explicit version information for both (duplicate version data is handled above)
-		v1 = versioncompare.New(pkgVer.Version)
+		v1 = versioncompare.New(pkgVer.EVR())
 		c1 = pkgVer.Condition
-		v2 = versioncompare.New(pkgVer.SVersion)
+		v2 = versioncompare.New(pkgVer.SEVR())
 		c2 = pkgVer.SCondition
 
 		if v1.Compare(v2) < 0 {
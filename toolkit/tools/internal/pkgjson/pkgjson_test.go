@@ -367,3 +367,70 @@ func TestIntervalCompareWithHigherExclusion(t *testing.T) {
 	assert.Equal(t, -1, intervalLow.Compare(&intervalHigh))
 	assert.Equal(t, 1, intervalHigh.Compare(&intervalLow))
 }
+
+func TestEVR(t *testing.T) {
+	assert.Equal(t, "1.0-2", (&PackageVer{Version: "1.0-2"}).EVR())
+	assert.Equal(t, "3:1.0-2", (&PackageVer{Epoch: "3", Version: "1.0-2"}).EVR())
+	assert.Equal(t, "", (&PackageVer{Epoch: "3"}).EVR())
+	assert.Equal(t, "4:2.0", (&PackageVer{SEpoch: "4", SVersion: "2.0"}).SEVR())
+}
+
+func TestIntervalShouldIncludeEpoch(t *testing.T) {
+	p1 := &PackageVer{Epoch: "1", Version: "1.0", Condition: ">=", SEpoch: "1", SVersion: "2.0", SCondition: "<"}
+	interval, err := p1.Interval()
+	assert.NoError(t, err)
+	assert.Equal(t, "[1:1.0,1:2.0)", interval.String())
+
+	// A higher epoch outranks any version without one
+	p2 := &PackageVer{Version: "5.0", Condition: "="}
+	interval2, err := p2.Interval()
+	assert.NoError(t, err)
+	assert.False(t, interval.Satisfies(&interval2))
+
+	p3 := &PackageVer{Version: "1:1.5", Condition: "="}
+	interval3, err := p3.Interval()
+	assert.NoError(t, err)
+	assert.True(t, interval.Satisfies(&interval3))
+}
+
+func TestIntervalShouldHandleTilde(t *testing.T) {
+	p1 := &PackageVer{Version: "1.0", Condition: ">="}
+	interval, err := p1.Interval()
+	assert.NoError(t, err)
+
+	preRelease := &PackageVer{Version: "1.0~rc1", Condition: "="}
+	preReleaseInterval, err := preRelease.Interval()
+	assert.NoError(t, err)
+	assert.False(t, interval.Satisfies(&preReleaseInterval))
+
+	postRelease := &PackageVer{Version: "1.0^git1", Condition: "="}
+	postReleaseInterval, err := postRelease.Interval()
+	assert.NoError(t, err)
+	assert.True(t, interval.Satisfies(&postReleaseInterval))
+}
+
+func TestDuplicateVersionWithEpoch(t *testing.T) {
+	p1 := &PackageVer{Epoch: "1", Version: "1.0", Condition: "=", SEpoch: "1", SVersion: "1.0", SCondition: "="}
+	interval, err := p1.Interval()
+	assert.NoError(t, err)
+	assert.Equal(t, "[1:1.0,1:1.0]", interval.String())
+}
+
+func TestParseDependency(t *testing.T) {
+	pkgVer, err := ParseDependency("gettext")
+	assert.NoError(t, err)
+	assert.Equal(t, &PackageVer{Name: "gettext"}, pkgVer)
+
+	pkgVer, err = ParseDependency("gettext >= 0.19")
+	assert.NoError(t, err)
+	assert.Equal(t, &PackageVer{Name: "gettext", Condition: ">=", Version: "0.19"}, pkgVer)
+
+	pkgVer, err = ParseDependency("(foo or bar)")
+	assert.NoError(t, err)
+	assert.True(t, pkgVer.IsRich())
+}
+
+func TestParseDependencyShouldFailWithoutVersion(t *testing.T) {
+	_, err := ParseDependency("gettext >=")
+	assert.Error(t, err)
+}
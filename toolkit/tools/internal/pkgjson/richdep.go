@@ -0,0 +1,233 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package pkgjson
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Boolean operators of RPM rich dependencies
+const (
+	OperatorAnd     = "and"     // All operands are required
+	OperatorOr      = "or"      // At least one operand is required
+	OperatorIf      = "if"      // The first operand is required if the second is installed, otherwise the optional "else" operand is
+	OperatorUnless  = "unless"  // The first operand is required unless the second is installed, otherwise the optional "else" operand is
+	OperatorWith    = "with"    // A single package must satisfy all operands
+	OperatorWithout = "without" // A single package must satisfy the first operand but not the second
+
+	elseKeyword = "else"
+)
+
+// richOperators lists every operator which may join operands of a rich dependency.
+var richOperators = map[string]bool{
+	OperatorAnd:     true,
+	OperatorOr:      true,
+	OperatorIf:      true,
+	OperatorUnless:  true,
+	OperatorWith:    true,
+	OperatorWithout: true,
+}
+
+// comparisonOperators lists every operator which may follow the name of a simple dependency.
+var comparisonOperators = map[string]string{
+	"<":  "<",
+	"<=": "<=",
+	"=<": "<=",
+	"=":  "=",
+	"==": "=",
+	">=": ">=",
+	"=>": ">=",
+	">":  ">",
+}
+
+// IsRich returns true if the PackageVer is a rich (boolean) dependency rather than a single package.
+func (pkgVer *PackageVer) IsRich() bool {
+	return pkgVer.Operator != ""
+}
+
+// ParseRichDependency parses an RPM rich dependency such as "(foo >= 1.0 or (bar if baz))" into a tree of PackageVers.
+// The Name of each rich node is set to its normalized expression so it can be identified like any other dependency.
+func ParseRichDependency(expression string) (pkgVer *PackageVer, err error) {
+	parser := &richParser{tokens: tokenizeRichDependency(expression)}
+
+	pkgVer, err = parser.parseExpression()
+	if err == nil && !parser.done() {
+		err = fmt.Errorf("unexpected (%s) after the end of the expression", parser.peek())
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to parse rich dependency (%s): %w", expression, err)
+	}
+
+	return
+}
+
+// richParser is a recursive descent parser over the tokens of a rich dependency.
+type richParser struct {
+	tokens []string
+	next   int
+}
+
+func (p *richParser) done() bool {
+	return p.next >= len(p.tokens)
+}
+
+func (p *richParser) peek() string {
+	if p.done() {
+		return ""
+	}
+	return p.tokens[p.next]
+}
+
+func (p *richParser) pop() (token string) {
+	token = p.peek()
+	p.next++
+	return
+}
+
+func (p *richParser) expect(token string) (err error) {
+	if p.done() {
+		return fmt.Errorf("expected (%s) but reached the end of the expression", token)
+	}
+	if found := p.pop(); found != token {
+		return fmt.Errorf("expected (%s) but found (%s)", token, found)
+	}
+	return
+}
+
+// parseExpression parses a parenthesized expression: "(" operand [operator operand]... ")".
+// "and", "or" and "with" may be chained, "if" and "unless" may be followed by an "else" operand.
+func (p *richParser) parseExpression() (pkgVer *PackageVer, err error) {
+	err = p.expect("(")
+	if err != nil {
+		return
+	}
+
+	first, err := p.parseOperand()
+	if err != nil {
+		return
+	}
+
+	// A single parenthesized operand has no operator
+	if p.peek() == ")" {
+		p.pop()
+		pkgVer = first
+		return
+	}
+
+	operator := p.pop()
+	if !richOperators[operator] {
+		err = fmt.Errorf("unknown operator (%s)", operator)
+		return
+	}
+
+	pkgVer = &PackageVer{Operator: operator, Operands: []*PackageVer{first}}
+	for {
+		var operand *PackageVer
+		operand, err = p.parseOperand()
+		if err != nil {
+			return
+		}
+		pkgVer.Operands = append(pkgVer.Operands, operand)
+
+		token := p.peek()
+		switch {
+		case token == ")":
+			p.pop()
+			pkgVer.Name = pkgVer.expression()
+			return
+		case token == elseKeyword && len(pkgVer.Operands) == 2 && (operator == OperatorIf || operator == OperatorUnless):
+			p.pop()
+		case token == operator && (operator == OperatorAnd || operator == OperatorOr || operator == OperatorWith):
+			p.pop()
+		case token == "":
+			err = fmt.Errorf("missing closing parenthesis")
+			return
+		default:
+			err = fmt.Errorf("unexpected (%s) after operand of (%s)", token, operator)
+			return
+		}
+	}
+}
+
+// parseOperand parses either a nested expression or a simple dependency: name [comparison version].
+func (p *richParser) parseOperand() (pkgVer *PackageVer, err error) {
+	token := p.peek()
+	switch {
+	case token == "(":
+		return p.parseExpression()
+	case token == "" || token == ")" || richOperators[token] || token == elseKeyword:
+		err = fmt.Errorf("expected a package name but found (%s)", token)
+		return
+	}
+
+	pkgVer = &PackageVer{Name: p.pop()}
+	if condition, found := comparisonOperators[p.peek()]; found {
+		p.pop()
+		version := p.peek()
+		if version == "" || version == ")" || version == "(" {
+			err = fmt.Errorf("missing version after (%s %s)", pkgVer.Name, condition)
+			return
+		}
+		pkgVer.Condition = condition
+		pkgVer.Version = p.pop()
+	}
+
+	return
+}
+
+// expression renders a rich dependency back into its normalized textual form.
+func (pkgVer *PackageVer) expression() string {
+	if !pkgVer.IsRich() {
+		if pkgVer.Condition == "" {
+			return pkgVer.Name
+		}
+		return fmt.Sprintf("%s %s %s", pkgVer.Name, pkgVer.Condition, pkgVer.EVR())
+	}
+
+	operands := make([]string, 0, len(pkgVer.Operands))
+	for _, operand := range pkgVer.Operands {
+		operands = append(operands, operand.expression())
+	}
+
+	separator := fmt.Sprintf(" %s ", pkgVer.Operator)
+	if (pkgVer.Operator == OperatorIf || pkgVer.Operator == OperatorUnless) && len(operands) == 3 {
+		return fmt.Sprintf("(%s%s%s %s %s)", operands[0], separator, operands[1], elseKeyword, operands[2])
+	}
+	return fmt.Sprintf("(%s)", strings.Join(operands, separator))
+}
+
+// tokenizeRichDependency splits a rich dependency into parentheses, operators and names.
+// Parentheses which are part of a name, such as in "perl(Foo::Bar)", are kept with the name.
+func tokenizeRichDependency(expression string) (tokens []string) {
+	for i := 0; i < len(expression); {
+		c := expression[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, string(c))
+			i++
+		default:
+			start := i
+			depth := 0
+			for i < len(expression) {
+				c = expression[i]
+				if c == ' ' || c == '\t' || (c == ')' && depth == 0) {
+					break
+				}
+				switch c {
+				case '(':
+					depth++
+				case ')':
+					depth--
+				}
+				i++
+			}
+			tokens = append(tokens, expression[start:i])
+		}
+	}
+
+	return
+}
@@ -0,0 +1,93 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package pkgjson
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRichDependencyOr(t *testing.T) {
+	pkgVer, err := ParseRichDependency("(foo >= 1.0 or bar)")
+	assert.NoError(t, err)
+	assert.True(t, pkgVer.IsRich())
+	assert.Equal(t, "(foo >= 1.0 or bar)", pkgVer.Name)
+	assert.Equal(t, OperatorOr, pkgVer.Operator)
+	assert.Equal(t, []*PackageVer{
+		{Name: "foo", Condition: ">=", Version: "1.0"},
+		{Name: "bar"},
+	}, pkgVer.Operands)
+}
+
+func TestParseRichDependencyShouldChainOperators(t *testing.T) {
+	pkgVer, err := ParseRichDependency("(a and b and c)")
+	assert.NoError(t, err)
+	assert.Equal(t, OperatorAnd, pkgVer.Operator)
+	assert.Len(t, pkgVer.Operands, 3)
+}
+
+func TestParseRichDependencyShouldNest(t *testing.T) {
+	pkgVer, err := ParseRichDependency("(python3 or (python2  if  legacy(python) else python-any = 1:2.0))")
+	assert.NoError(t, err)
+	assert.Equal(t, "(python3 or (python2 if legacy(python) else python-any = 1:2.0))", pkgVer.Name)
+	assert.Len(t, pkgVer.Operands, 2)
+
+	nested := pkgVer.Operands[1]
+	assert.True(t, nested.IsRich())
+	assert.Equal(t, OperatorIf, nested.Operator)
+	assert.Equal(t, []*PackageVer{
+		{Name: "python2"},
+		{Name: "legacy(python)"},
+		{Name: "python-any", Condition: "=", Version: "1:2.0"},
+	}, nested.Operands)
+}
+
+func TestParseRichDependencyShouldHandleEveryOperator(t *testing.T) {
+	for _, expression := range []string{
+		"(a and b)",
+		"(a or b)",
+		"(a if b)",
+		"(a if b else c)",
+		"(a unless b)",
+		"(a unless b else c)",
+		"(a with b)",
+		"(a without b)",
+	} {
+		pkgVer, err := ParseRichDependency(expression)
+		assert.NoError(t, err, expression)
+		assert.Equal(t, expression, pkgVer.Name)
+	}
+}
+
+func TestParseRichDependencyShouldNormalizeConditions(t *testing.T) {
+	pkgVer, err := ParseRichDependency("(a == 1 or b =< 2 or c => 3)")
+	assert.NoError(t, err)
+	assert.Equal(t, "(a = 1 or b <= 2 or c >= 3)", pkgVer.Name)
+}
+
+func TestParseRichDependencySingleOperand(t *testing.T) {
+	pkgVer, err := ParseRichDependency("(perl(Foo::Bar) >= 1.0)")
+	assert.NoError(t, err)
+	assert.False(t, pkgVer.IsRich())
+	assert.Equal(t, &PackageVer{Name: "perl(Foo::Bar)", Condition: ">=", Version: "1.0"}, pkgVer)
+}
+
+func TestParseRichDependencyShouldFailOnInvalidExpressions(t *testing.T) {
+	for _, expression := range []string{
+		"",
+		"foo",
+		"(a or b",
+		"(a or b))",
+		"(a or b and c)",
+		"(a if b else c else d)",
+		"(a and b else c)",
+		"(a xor b)",
+		"(a >= )",
+		"(or b)",
+	} {
+		_, err := ParseRichDependency(expression)
+		assert.Error(t, err, expression)
+	}
+}
@@ -5,11 +5,13 @@ package rpm
 
 import (
 	"fmt"
+	"runtime"
 	"strings"
 
 	"microsoft.com/pkggen/internal/file"
 	"microsoft.com/pkggen/internal/logger"
 	"microsoft.com/pkggen/internal/shell"
+	"microsoft.com/pkggen/internal/sliceutils"
 )
 
 const (
@@ -19,6 +21,12 @@ const (
 	// QueryHeaderArgument specifies the srpm argument to be used with rpm tools
 	QueryHeaderArgument = "--srpm"
 
+	// TargetArgument specifies the target architecture argument to be used with rpm tools
+	TargetArgument = "--target"
+
+	// NoArch specifies the architecture of packages which can be installed on any architecture
+	NoArch = "noarch"
+
 	// DistTagDefine specifies the dist tag option for rpm tool commands
 	DistTagDefine = "dist"
 
@@ -37,16 +45,68 @@ const (
 	// WithCheckDefine specifies the with_check option for rpm tool commands
 	WithCheckDefine = "with_check"
 
+	// BootstrapDefine specifies the with_bootstrap option for rpm tool commands, set when a SPEC is built in bootstrap mode
+	BootstrapDefine = "with_bootstrap"
+
 	// NoCompatibleArchError specifies the error message when processing a SPEC written for a different architecture.
 	NoCompatibleArchError = "error: No compatible architectures found for build"
 )
 
+var (
+	// goArchToRpmArch maps GOARCH values to the matching rpm architecture
+	goArchToRpmArch = map[string]string{
+		"amd64": "x86_64",
+		"arm64": "aarch64",
+	}
+)
+
 const (
 	rpmProgram      = "rpm"
 	rpmSpecProgram  = "rpmspec"
 	rpmBuildProgram = "rpmbuild"
 )
 
+// GetRpmArch converts a GOARCH value (e.g. runtime.GOARCH) into the matching rpm architecture.
+func GetRpmArch(goArch string) (rpmArch string, err error) {
+	rpmArch, found := goArchToRpmArch[goArch]
+	if !found {
+		err = fmt.Errorf("unknown GOARCH detected (%s)", goArch)
+	}
+	return
+}
+
+// GetHostArch returns the rpm architecture of the machine the toolkit is running on.
+func GetHostArch() (hostArch string, err error) {
+	return GetRpmArch(runtime.GOARCH)
+}
+
+// ResolveTargetArch returns targetArch, or the host's architecture if targetArch is empty.
+func ResolveTargetArch(targetArch string) (resolvedArch string, err error) {
+	if targetArch != "" {
+		resolvedArch = targetArch
+		return
+	}
+
+	return GetHostArch()
+}
+
+// TargetArchArgs returns the extra arguments needed for rpm tools to evaluate a SPEC or SRPM for targetArch.
+func TargetArchArgs(targetArch string) []string {
+	return []string{TargetArgument, targetArch}
+}
+
+// ArchAllowed returns true if the ExclusiveArch and ExcludeArch lists of a SPEC allow it to be built for arch.
+// An empty ExclusiveArch list allows every architecture.
+func ArchAllowed(arch string, exclusiveArch, excludeArch []string) bool {
+	const notFound = -1
+
+	if len(exclusiveArch) != 0 && sliceutils.Find(exclusiveArch, arch) == notFound {
+		return false
+	}
+
+	return sliceutils.Find(excludeArch, arch) == notFound
+}
+
 // SetMacroDir adds RPM_CONFIGDIR=$(newMacroDir) into the shell's environment for the duration of a program.
 // To restore the environment the caller can use shell.SetEnvironment() with the returned origenv.
 // On an empty string argument return success immediately and do not modify the environment.
@@ -158,10 +218,11 @@ func QuerySPEC(specFile, sourceDir, queryFormat string, defines map[string]strin
 }
 
 // QuerySPECForBuiltRPMs queries a SPEC file with queryFormat. Returns only the subpackages, which generate a .rpm file.
-func QuerySPECForBuiltRPMs(specFile, sourceDir, queryFormat string, defines map[string]string) (result []string, err error) {
+func QuerySPECForBuiltRPMs(specFile, sourceDir, queryFormat string, defines map[string]string, extraArgs ...string) (result []string, err error) {
 	const builtRPMsSwitch = "--builtrpms"
 
-	return QuerySPEC(specFile, sourceDir, queryFormat, defines, builtRPMsSwitch)
+	extraArgs = append(extraArgs, builtRPMsSwitch)
+	return QuerySPEC(specFile, sourceDir, queryFormat, defines, extraArgs...)
 }
 
 // QueryPackage queries an RPM or SRPM file with queryFormat. Returns the output split by line and trimmed.
@@ -174,6 +235,20 @@ func QueryPackage(packageFile, queryFormat string, defines map[string]string, ex
 	return executeRpmCommand(rpmProgram, args...)
 }
 
+// QueryInstalledPackages queries every package installed under installRoot with queryFormat. Returns the output split by line and trimmed.
+func QueryInstalledPackages(installRoot, queryFormat string, defines map[string]string, extraArgs ...string) (result []string, err error) {
+	const (
+		allPackagesArg = "-a"
+		queryArg       = "-q"
+		rootArg        = "--root"
+	)
+
+	extraArgs = append(extraArgs, rootArg, installRoot, queryArg)
+	args := formatCommandArgs(extraArgs, allPackagesArg, queryFormat, defines)
+
+	return executeRpmCommand(rpmProgram, args...)
+}
+
 // BuildRPMFromSRPM builds an RPM from the given SRPM file
 func BuildRPMFromSRPM(srpmFile string, defines map[string]string, extraArgs ...string) (err error) {
 	const (
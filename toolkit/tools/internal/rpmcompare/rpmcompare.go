@@ -0,0 +1,244 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+// Package rpmcompare finds the differences between two sets of RPMs built from the same SRPM.
+package rpmcompare
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"microsoft.com/pkggen/internal/rpm"
+)
+
+const (
+	// FieldPresence is reported when an RPM was only produced by one of the builds.
+	FieldPresence = "presence"
+
+	present = "present"
+	missing = "missing"
+
+	queryPackageArgument = "-p"
+	rpmExtension         = ".rpm"
+)
+
+// Difference is a single field which differs between two builds of an RPM.
+type Difference struct {
+	RPM    string `json:"RPM"`    // File name of the RPM
+	Path   string `json:"Path"`   // File in the RPM's payload, empty for header fields and missing RPMs
+	Field  string `json:"Field"`  // Header tag or file attribute which differs
+	First  string `json:"First"`  // Value in the first build
+	Second string `json:"Second"` // Value in the second build
+}
+
+// String returns a single line description of the difference.
+func (d *Difference) String() string {
+	location := d.RPM
+	if d.Path != "" {
+		location = fmt.Sprintf("%s:%s", d.RPM, d.Path)
+	}
+	return fmt.Sprintf("%s %s: (%s) != (%s)", location, d.Field, d.First, d.Second)
+}
+
+// headerTags are the header fields compared between builds, in report order.
+// Signature tags are never compared since they are not part of the build's output.
+var headerTags = []string{
+	"NAME", "EPOCH", "VERSION", "RELEASE", "ARCH", "LICENSE", "SUMMARY", "GROUP", "URL", "VENDOR",
+	"SOURCERPM", "BUILDTIME", "BUILDHOST", "OPTFLAGS", "RPMVERSION", "PAYLOADCOMPRESSOR", "PAYLOADDIGEST",
+	"PROVIDENEVRS", "REQUIRENEVRS", "CONFLICTNEVRS", "OBSOLETENEVRS",
+}
+
+// arrayHeaderTags hold several values, which are joined by spaces.
+var arrayHeaderTags = map[string]bool{
+	"PAYLOADDIGEST": true,
+	"PROVIDENEVRS":  true,
+	"REQUIRENEVRS":  true,
+	"CONFLICTNEVRS": true,
+	"OBSOLETENEVRS": true,
+}
+
+// fileAttributes are the attributes compared for every file in an RPM's payload, in the order they are queried.
+// The file's name is queried last since it is the only field which may contain whitespace.
+var fileAttributes = []string{"mode", "user", "group", "size", "digest", "mtime", "linkto"}
+
+const fileQueryFormat = "[%{FILEMODES:octal}\t%{FILEUSERNAME}\t%{FILEGROUPNAME}\t%{FILESIZES}\t%{FILEDIGESTS}\t%{FILEMTIMES}\t%{FILELINKTOS}\t%{FILENAMES}\n]"
+
+// rpmDescription holds the parts of an RPM which are compared.
+type rpmDescription struct {
+	header map[string]string
+	files  map[string]map[string]string // File path -> attribute -> value
+}
+
+// CompareDirs compares every RPM found under firstDir with the RPM of the same name under secondDir.
+// Returns every difference found, an empty result means the two builds are identical.
+func CompareDirs(firstDir, secondDir string) (differences []*Difference, err error) {
+	firstRPMs, err := findRPMs(firstDir)
+	if err != nil {
+		return
+	}
+	secondRPMs, err := findRPMs(secondDir)
+	if err != nil {
+		return
+	}
+
+	var firstNames, secondNames []string
+	for name := range firstRPMs {
+		firstNames = append(firstNames, name)
+	}
+	for name := range secondRPMs {
+		secondNames = append(secondNames, name)
+	}
+
+	for _, name := range sortedUnion(firstNames, secondNames) {
+		firstPath, inFirst := firstRPMs[name]
+		secondPath, inSecond := secondRPMs[name]
+
+		switch {
+		case !inFirst:
+			differences = append(differences, &Difference{RPM: name, Field: FieldPresence, First: missing, Second: present})
+		case !inSecond:
+			differences = append(differences, &Difference{RPM: name, Field: FieldPresence, First: present, Second: missing})
+		default:
+			var first, second *rpmDescription
+			first, err = describeRPM(firstPath)
+			if err != nil {
+				return
+			}
+			second, err = describeRPM(secondPath)
+			if err != nil {
+				return
+			}
+			differences = append(differences, compareDescriptions(name, first, second)...)
+		}
+	}
+
+	return
+}
+
+// findRPMs returns the path of every RPM under dir, keyed by file name.
+func findRPMs(dir string) (rpms map[string]string, err error) {
+	rpms = make(map[string]string)
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		if info.Mode().IsRegular() && strings.HasSuffix(info.Name(), rpmExtension) {
+			rpms[info.Name()] = path
+		}
+		return nil
+	})
+	return
+}
+
+// describeRPM queries the header fields and payload files of an RPM.
+func describeRPM(rpmFile string) (description *rpmDescription, err error) {
+	var headerQuery strings.Builder
+	for _, tag := range headerTags {
+		if arrayHeaderTags[tag] {
+			fmt.Fprintf(&headerQuery, "%s=[%%{%s} ]\n", tag, tag)
+		} else {
+			fmt.Fprintf(&headerQuery, "%s=%%{%s}\n", tag, tag)
+		}
+	}
+
+	headerLines, err := rpm.QueryPackage(rpmFile, headerQuery.String(), nil, queryPackageArgument)
+	if err != nil {
+		return
+	}
+
+	fileLines, err := rpm.QueryPackage(rpmFile, fileQueryFormat, nil, queryPackageArgument)
+	if err != nil {
+		return
+	}
+
+	description = &rpmDescription{
+		header: parseHeader(headerLines),
+	}
+	description.files, err = parseFiles(fileLines)
+	return
+}
+
+// parseHeader parses lines formatted as "TAG=value".
+func parseHeader(lines []string) (header map[string]string) {
+	header = make(map[string]string)
+	for _, line := range lines {
+		tag, value := line, ""
+		if separator := strings.Index(line, "="); separator >= 0 {
+			tag, value = line[:separator], strings.TrimSpace(line[separator+1:])
+		}
+		header[tag] = value
+	}
+	return
+}
+
+// parseFiles parses the output of fileQueryFormat.
+func parseFiles(lines []string) (files map[string]map[string]string, err error) {
+	files = make(map[string]map[string]string)
+	for _, line := range lines {
+		fields := strings.SplitN(line, "\t", len(fileAttributes)+1)
+		if len(fields) != len(fileAttributes)+1 {
+			err = fmt.Errorf("unexpected file query result (%s)", line)
+			return
+		}
+
+		attributes := make(map[string]string, len(fileAttributes))
+		for i, attribute := range fileAttributes {
+			attributes[attribute] = fields[i]
+		}
+		files[fields[len(fileAttributes)]] = attributes
+	}
+	return
+}
+
+// compareDescriptions returns every difference between two builds of the RPM called name.
+func compareDescriptions(name string, first, second *rpmDescription) (differences []*Difference) {
+	for _, tag := range headerTags {
+		if first.header[tag] != second.header[tag] {
+			differences = append(differences, &Difference{RPM: name, Field: tag, First: first.header[tag], Second: second.header[tag]})
+		}
+	}
+
+	var firstPaths, secondPaths []string
+	for path := range first.files {
+		firstPaths = append(firstPaths, path)
+	}
+	for path := range second.files {
+		secondPaths = append(secondPaths, path)
+	}
+
+	for _, path := range sortedUnion(firstPaths, secondPaths) {
+		firstAttributes, inFirst := first.files[path]
+		secondAttributes, inSecond := second.files[path]
+
+		switch {
+		case !inFirst:
+			differences = append(differences, &Difference{RPM: name, Path: path, Field: FieldPresence, First: missing, Second: present})
+		case !inSecond:
+			differences = append(differences, &Difference{RPM: name, Path: path, Field: FieldPresence, First: present, Second: missing})
+		default:
+			for _, attribute := range fileAttributes {
+				if firstAttributes[attribute] != secondAttributes[attribute] {
+					differences = append(differences, &Difference{RPM: name, Path: path, Field: attribute, First: firstAttributes[attribute], Second: secondAttributes[attribute]})
+				}
+			}
+		}
+	}
+
+	return
+}
+
+// sortedUnion returns the sorted, unique strings found in either list.
+func sortedUnion(first, second []string) (union []string) {
+	unique := make(map[string]bool, len(first)+len(second))
+	for _, value := range append(first, second...) {
+		if !unique[value] {
+			unique[value] = true
+			union = append(union, value)
+		}
+	}
+	sort.Strings(union)
+	return
+}
@@ -0,0 +1,115 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package rpmcompare
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseHeader(t *testing.T) {
+	header := parseHeader([]string{"NAME=foo", "SUMMARY=a = b", "EPOCH=(none)", "PROVIDENEVRS=foo = 1-1 foo(x86-64) = 1-1", "EMPTY="})
+
+	assert.Equal(t, map[string]string{
+		"NAME":         "foo",
+		"SUMMARY":      "a = b",
+		"EPOCH":        "(none)",
+		"PROVIDENEVRS": "foo = 1-1 foo(x86-64) = 1-1",
+		"EMPTY":        "",
+	}, header)
+}
+
+func TestParseFiles(t *testing.T) {
+	files, err := parseFiles([]string{
+		"100755\troot\troot\t12\tabc\t1600000000\t\t/usr/bin/foo",
+		"120777\troot\troot\t3\t\t1600000000\tfoo\t/usr/bin/foo link",
+	})
+	assert.NoError(t, err)
+
+	assert.Len(t, files, 2)
+	assert.Equal(t, "100755", files["/usr/bin/foo"]["mode"])
+	assert.Equal(t, "abc", files["/usr/bin/foo"]["digest"])
+	assert.Equal(t, "foo", files["/usr/bin/foo link"]["linkto"])
+}
+
+func TestParseFilesShouldFailOnMissingFields(t *testing.T) {
+	_, err := parseFiles([]string{"100755\troot\t/usr/bin/foo"})
+	assert.Error(t, err)
+}
+
+func TestCompareIdenticalDescriptions(t *testing.T) {
+	description := &rpmDescription{
+		header: map[string]string{"NAME": "foo", "BUILDTIME": "1600000000"},
+		files:  map[string]map[string]string{"/usr/bin/foo": {"digest": "abc"}},
+	}
+
+	assert.Empty(t, compareDescriptions("foo.rpm", description, description))
+}
+
+func TestCompareDescriptions(t *testing.T) {
+	first := &rpmDescription{
+		header: map[string]string{"NAME": "foo", "BUILDTIME": "1600000000"},
+		files: map[string]map[string]string{
+			"/usr/bin/foo":      {"digest": "abc", "mtime": "1600000000"},
+			"/usr/share/first":  {"digest": "def"},
+			"/usr/share/common": {"digest": "ghi"},
+		},
+	}
+	second := &rpmDescription{
+		header: map[string]string{"NAME": "foo", "BUILDTIME": "1600000001"},
+		files: map[string]map[string]string{
+			"/usr/bin/foo":      {"digest": "xyz", "mtime": "1600000000"},
+			"/usr/share/common": {"digest": "ghi"},
+			"/usr/share/second": {"digest": "jkl"},
+		},
+	}
+
+	expected := []*Difference{
+		{RPM: "foo.rpm", Field: "BUILDTIME", First: "1600000000", Second: "1600000001"},
+		{RPM: "foo.rpm", Path: "/usr/bin/foo", Field: "digest", First: "abc", Second: "xyz"},
+		{RPM: "foo.rpm", Path: "/usr/share/first", Field: FieldPresence, First: present, Second: missing},
+		{RPM: "foo.rpm", Path: "/usr/share/second", Field: FieldPresence, First: missing, Second: present},
+	}
+
+	assert.Equal(t, expected, compareDescriptions("foo.rpm", first, second))
+}
+
+func TestCompareDirsShouldReportMissingRPMs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rpmcompare")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	firstDir := filepath.Join(dir, "first")
+	secondDir := filepath.Join(dir, "second")
+	assert.NoError(t, os.MkdirAll(filepath.Join(firstDir, "x86_64"), os.ModePerm))
+	assert.NoError(t, os.MkdirAll(filepath.Join(secondDir, "noarch"), os.ModePerm))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(firstDir, "x86_64", "foo-1-1.x86_64.rpm"), []byte{}, os.ModePerm))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(secondDir, "noarch", "foo-1-1.noarch.rpm"), []byte{}, os.ModePerm))
+
+	differences, err := CompareDirs(firstDir, secondDir)
+	assert.NoError(t, err)
+
+	expected := []*Difference{
+		{RPM: "foo-1-1.noarch.rpm", Field: FieldPresence, First: missing, Second: present},
+		{RPM: "foo-1-1.x86_64.rpm", Field: FieldPresence, First: present, Second: missing},
+	}
+	assert.Equal(t, expected, differences)
+}
+
+func TestSortedUnion(t *testing.T) {
+	assert.Equal(t, []string{"a", "b", "c"}, sortedUnion([]string{"c", "a"}, []string{"b", "a"}))
+	assert.Empty(t, sortedUnion(nil, nil))
+}
+
+func TestDifferenceString(t *testing.T) {
+	headerDifference := &Difference{RPM: "foo.rpm", Field: "BUILDTIME", First: "1", Second: "2"}
+	assert.Equal(t, "foo.rpm BUILDTIME: (1) != (2)", headerDifference.String())
+
+	fileDifference := &Difference{RPM: "foo.rpm", Path: "/usr/bin/foo", Field: "digest", First: "abc", Second: "xyz"}
+	assert.Equal(t, "foo.rpm:/usr/bin/foo digest: (abc) != (xyz)", fileDifference.String())
+}
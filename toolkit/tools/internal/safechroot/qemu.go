@@ -0,0 +1,114 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package safechroot
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"microsoft.com/pkggen/internal/file"
+	"microsoft.com/pkggen/internal/logger"
+	"microsoft.com/pkggen/internal/rpm"
+)
+
+const (
+	// binfmtMiscDir is where the kernel's binfmt_misc filesystem is mounted.
+	binfmtMiscDir = "/proc/sys/fs/binfmt_misc"
+
+	// binfmtRegisterFile is written to register a new binfmt_misc rule.
+	binfmtRegisterFile = "register"
+
+	// binfmtFixBinaryFlag makes the kernel open the interpreter when the rule is registered,
+	// so it keeps working for processes inside a chroot which do not contain it.
+	binfmtFixBinaryFlag = "F"
+)
+
+// qemuBinfmt describes how the kernel recognizes the ELF binaries of an architecture, matching the rules
+// registered by qemu's qemu-binfmt-conf.sh script.
+type qemuBinfmt struct {
+	qemuArch string
+	magic    string
+	mask     string
+}
+
+// qemuBinfmts maps rpm architectures to the binfmt_misc rule for their qemu user mode emulator.
+var qemuBinfmts = map[string]qemuBinfmt{
+	"x86_64": {
+		qemuArch: "x86_64",
+		magic:    `\x7fELF\x02\x01\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02\x00\x3e\x00`,
+		mask:     `\xff\xff\xff\xff\xff\xfe\xfe\x00\xff\xff\xff\xff\xff\xff\xff\xff\xfe\xff\xff\xff`,
+	},
+	"aarch64": {
+		qemuArch: "aarch64",
+		magic:    `\x7fELF\x02\x01\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02\x00\xb7\x00`,
+		mask:     `\xff\xff\xff\xff\xff\xff\xff\x00\xff\xff\xff\xff\xff\xff\xff\xff\xfe\xff\xff\xff`,
+	},
+}
+
+// RegisterQemuUserStatic allows the Chroot to run binaries built for targetArch using the host's qemu-user-static emulator.
+// The emulator is copied into the chroot and registered with the kernel's binfmt_misc handler unless a rule for it
+// already exists. The registration is system wide and is left in place once the Chroot is closed.
+// Does nothing if targetArch is the host's architecture.
+func (c *Chroot) RegisterQemuUserStatic(targetArch string) (err error) {
+	hostArch, err := rpm.GetHostArch()
+	if err != nil || targetArch == hostArch {
+		return
+	}
+
+	binfmt, found := qemuBinfmts[targetArch]
+	if !found {
+		err = fmt.Errorf("unable to emulate architecture (%s), no qemu binfmt rule is known for it", targetArch)
+		return
+	}
+
+	interpreterName := fmt.Sprintf("qemu-%s-static", binfmt.qemuArch)
+	interpreter, err := exec.LookPath(interpreterName)
+	if err != nil {
+		err = fmt.Errorf("unable to find (%s), is qemu-user-static installed? Error: %v", interpreterName, err)
+		return
+	}
+
+	// Rules registered without the fix binary flag (e.g. by the host's distribution) look for the
+	// interpreter inside the chroot, so place a copy of it at the same path.
+	logger.Log.Infof("Using (%s) to run %s binaries in chroot (%s)", interpreter, targetArch, c.rootDir)
+	err = c.AddFiles(FileToCopy{Src: interpreter, Dest: interpreter})
+	if err != nil {
+		return
+	}
+
+	return registerBinfmt(binfmtMiscDir, interpreterName, binfmt, interpreter)
+}
+
+// registerBinfmt registers a binfmt_misc rule called name in binfmtDir, unless a rule with that name already exists.
+func registerBinfmt(binfmtDir, name string, binfmt qemuBinfmt, interpreter string) (err error) {
+	exists, err := file.PathExists(filepath.Join(binfmtDir, name))
+	if err != nil {
+		return
+	}
+	if exists {
+		logger.Log.Debugf("binfmt_misc rule (%s) is already registered", name)
+		return
+	}
+
+	registerFile, err := os.OpenFile(filepath.Join(binfmtDir, binfmtRegisterFile), os.O_WRONLY, 0)
+	if err != nil {
+		err = fmt.Errorf("unable to register (%s), is binfmt_misc mounted at (%s)? Error: %v", name, binfmtDir, err)
+		return
+	}
+	defer registerFile.Close()
+
+	logger.Log.Debugf("Registering binfmt_misc rule (%s)", name)
+	_, err = registerFile.WriteString(binfmtRule(name, binfmt, interpreter))
+	return
+}
+
+// binfmtRule formats a binfmt_misc rule matching binaries by their magic number.
+func binfmtRule(name string, binfmt qemuBinfmt, interpreter string) string {
+	const magicType = "M"
+
+	// Format is :name:type:offset:magic:mask:interpreter:flags
+	return fmt.Sprintf(":%s:%s::%s:%s:%s:%s", name, magicType, binfmt.magic, binfmt.mask, interpreter, binfmtFixBinaryFlag)
+}
@@ -0,0 +1,89 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package safechroot
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"microsoft.com/pkggen/internal/rpm"
+)
+
+const testInterpreter = "/usr/bin/qemu-aarch64-static"
+
+// newFakeBinfmtDir creates a temporary directory mimicking binfmt_misc, with an empty register file.
+// The caller removes it.
+func newFakeBinfmtDir(t *testing.T, name string) (binfmtDir string) {
+	binfmtDir, err := ioutil.TempDir("", name)
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(binfmtDir, binfmtRegisterFile), []byte{}, os.ModePerm))
+	return
+}
+
+func TestBinfmtRuleFormat(t *testing.T) {
+	const expectedRule = `:qemu-aarch64-static:M::\x7fELF\x02\x01\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02\x00\xb7\x00:` +
+		`\xff\xff\xff\xff\xff\xff\xff\x00\xff\xff\xff\xff\xff\xff\xff\xff\xfe\xff\xff\xff:/usr/bin/qemu-aarch64-static:F`
+
+	assert.Equal(t, expectedRule, binfmtRule("qemu-aarch64-static", qemuBinfmts["aarch64"], testInterpreter))
+}
+
+func TestRegisterBinfmtShouldWriteRule(t *testing.T) {
+	binfmtDir := newFakeBinfmtDir(t, "TestRegisterBinfmtShouldWriteRule")
+	defer os.RemoveAll(binfmtDir)
+
+	err := registerBinfmt(binfmtDir, "qemu-aarch64-static", qemuBinfmts["aarch64"], testInterpreter)
+	assert.NoError(t, err)
+
+	contents, err := ioutil.ReadFile(filepath.Join(binfmtDir, binfmtRegisterFile))
+	assert.NoError(t, err)
+	assert.Equal(t, binfmtRule("qemu-aarch64-static", qemuBinfmts["aarch64"], testInterpreter), string(contents))
+}
+
+func TestRegisterBinfmtShouldSkipExistingRule(t *testing.T) {
+	binfmtDir := newFakeBinfmtDir(t, "TestRegisterBinfmtShouldSkipExistingRule")
+	defer os.RemoveAll(binfmtDir)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(binfmtDir, "qemu-aarch64-static"), []byte("enabled\n"), os.ModePerm))
+
+	err := registerBinfmt(binfmtDir, "qemu-aarch64-static", qemuBinfmts["aarch64"], testInterpreter)
+	assert.NoError(t, err)
+
+	contents, err := ioutil.ReadFile(filepath.Join(binfmtDir, binfmtRegisterFile))
+	assert.NoError(t, err)
+	assert.Empty(t, contents)
+}
+
+func TestRegisterBinfmtShouldFailWithoutBinfmtMisc(t *testing.T) {
+	binfmtDir, err := ioutil.TempDir("", "TestRegisterBinfmtShouldFailWithoutBinfmtMisc")
+	assert.NoError(t, err)
+	defer os.RemoveAll(binfmtDir)
+
+	err = registerBinfmt(binfmtDir, "qemu-aarch64-static", qemuBinfmts["aarch64"], testInterpreter)
+	assert.Error(t, err)
+}
+
+func TestRegisterQemuUserStaticShouldSkipHostArch(t *testing.T) {
+	hostArch, err := rpm.GetHostArch()
+	assert.NoError(t, err)
+
+	// The chroot is never initialized, nothing should be copied into it
+	dir := filepath.Join(tmpDir, "TestRegisterQemuUserStaticShouldSkipHostArch")
+	chroot := &Chroot{rootDir: dir}
+
+	err = chroot.RegisterQemuUserStatic(hostArch)
+	assert.NoError(t, err)
+
+	_, err = os.Stat(dir)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRegisterQemuUserStaticShouldFailForUnknownArch(t *testing.T) {
+	dir := filepath.Join(tmpDir, "TestRegisterQemuUserStaticShouldFailForUnknownArch")
+	chroot := &Chroot{rootDir: dir}
+
+	err := chroot.RegisterQemuUserStatic("unknownarch")
+	assert.Error(t, err)
+}
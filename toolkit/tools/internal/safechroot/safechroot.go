@@ -51,6 +51,7 @@ type Chroot struct {
 	mountPoints []*MountPoint
 
 	isExistingDir bool
+	withoutMounts bool
 }
 
 // inChrootMutex guards against multiple Chroots entering their respective Chroots
@@ -144,6 +145,14 @@ func NewChroot(rootDir string, isExistingDir bool) *Chroot {
 	return c
 }
 
+// NewChrootWithoutMounts creates a new Chroot struct which mounts nothing, not even the kernel filesystems
+// under /dev, /proc, /sys and /run. Unlike NewChroot it can be initialized without root, as root of a user namespace.
+func NewChrootWithoutMounts(rootDir string, isExistingDir bool) *Chroot {
+	c := NewChroot(rootDir, isExistingDir)
+	c.withoutMounts = true
+	return c
+}
+
 // Initialize initializes a Chroot, creating directories and mount points.
 // - tarPath is an optional path to a tar file that will be extracted at the root of the chroot.
 // - extraDirectories is an optional slice of additional directories that should be created before attempting to
@@ -156,6 +165,11 @@ func (c *Chroot) Initialize(tarPath string, extraDirectories []string, extraMoun
 	// On failed initialization, cleanup all chroot files
 	const leaveChrootOnDisk = false
 
+	if c.withoutMounts && len(extraMountPoints) != 0 {
+		err = fmt.Errorf("chroot (%s) was created without mounts, it can't mount (%s)", c.rootDir, extraMountPoints[0].target)
+		return
+	}
+
 	// Acquire a lock on the global activeChrootsMutex to ensure SIGTERM
 	// teardown doesnt happen mid-initialization.
 	activeChrootsMutex.Lock()
@@ -206,7 +220,7 @@ func (c *Chroot) Initialize(tarPath string, extraDirectories []string, extraMoun
 
 	// Extract a given tarball if necessary
 	if tarPath != "" {
-		err = extractWorkerTar(c.rootDir, tarPath)
+		err = extractWorkerTar(c.rootDir, tarPath, c.withoutMounts)
 		if err != nil {
 			logger.Log.Warnf("Could not extract worker tar (%s)", err)
 			return
@@ -225,7 +239,10 @@ func (c *Chroot) Initialize(tarPath string, extraDirectories []string, extraMoun
 	// mount is only supported in regular pipeline
 	if buildpipeline.IsRegularBuild() {
 		// Create kernel mountpoints
-		allMountPoints := append(defaultMountPoints(), extraMountPoints...)
+		var allMountPoints []*MountPoint
+		if !c.withoutMounts {
+			allMountPoints = append(defaultMountPoints(), extraMountPoints...)
+		}
 
 		// Mount with the original unsorted order. Assumes the order of mounts is important.
 		err = c.createMountPoints(allMountPoints)
@@ -533,14 +550,22 @@ func (c *Chroot) createMountPoints(allMountPoints []*MountPoint) (err error) {
 	return
 }
 
-// extractWorkerTar uses tar with gzip or pigz to setup a chroot directory using a rootfs tar
-func extractWorkerTar(chroot string, workerTar string) (err error) {
+// extractWorkerTar uses tar with gzip or pigz to setup a chroot directory using a rootfs tar.
+// If skipDevices is set the contents of /dev are not extracted, since device nodes can only be created by root.
+func extractWorkerTar(chroot string, workerTar string, skipDevices bool) (err error) {
+	const devicesPattern = "./dev/*"
+
 	gzipTool, err := systemdependency.GzipTool()
 	if err != nil {
 		return err
 	}
 
+	args := []string{"-I", gzipTool, "-xf", workerTar, "-C", chroot}
+	if skipDevices {
+		args = append(args, "--exclude", devicesPattern)
+	}
+
 	logger.Log.Debugf("Using (%s) to extract tar", gzipTool)
-	_, _, err = shell.Execute("tar", "-I", gzipTool, "-xf", workerTar, "-C", chroot)
+	_, _, err = shell.Execute("tar", args...)
 	return
 }
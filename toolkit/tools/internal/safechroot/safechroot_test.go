@@ -127,6 +127,47 @@ func TestCloseShouldLeaveRootOnRequest(t *testing.T) {
 	}
 }
 
+func TestInitializeWithoutMountsShouldRejectMountPoints(t *testing.T) {
+	if buildpipeline.IsRegularBuild() {
+		// this test only apply to "regular build" pipeline
+		extraMountPoints := []*MountPoint{NewMountPoint(testDir, "/testdata", "", BindMountPointFlags, "")}
+		extraDirectories := []string{}
+
+		dir := filepath.Join(tmpDir, "TestInitializeWithoutMountsShouldRejectMountPoints")
+		chroot := NewChrootWithoutMounts(dir, isExistingDir)
+
+		err := chroot.Initialize(emptyPath, extraDirectories, extraMountPoints)
+		assert.Error(t, err)
+
+		_, err = os.Stat(dir)
+		assert.True(t, os.IsNotExist(err))
+	}
+}
+
+func TestCloseWithoutMountsShouldRemoveRoot(t *testing.T) {
+	if buildpipeline.IsRegularBuild() {
+		// this test only apply to "regular build" pipeline
+		extraMountPoints := []*MountPoint{}
+		extraDirectories := []string{"installroot"}
+
+		dir := filepath.Join(tmpDir, "TestCloseWithoutMountsShouldRemoveRoot")
+		chroot := NewChrootWithoutMounts(dir, isExistingDir)
+
+		err := chroot.Initialize(emptyPath, extraDirectories, extraMountPoints)
+		assert.NoError(t, err)
+		assert.Empty(t, chroot.mountPoints)
+
+		_, err = os.Stat(filepath.Join(dir, "installroot"))
+		assert.NoError(t, err)
+
+		err = chroot.Close(defaultLeaveOnDisk)
+		assert.NoError(t, err)
+
+		_, err = os.Stat(dir)
+		assert.True(t, os.IsNotExist(err))
+	}
+}
+
 func TestRootDirShouldReturnRootDir(t *testing.T) {
 	if buildpipeline.IsRegularBuild() {
 		// this test only apply to "regular build" pipeline
@@ -0,0 +1,121 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package sbom
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"microsoft.com/pkggen/internal/jsonutils"
+)
+
+const (
+	cycloneDXFormat        = "CycloneDX"
+	cycloneDXSpecVersion   = "1.3"
+	cycloneDXImageType     = "operating-system"
+	cycloneDXPackageType   = "library"
+	cycloneDXSourceRPMProp = "rpm:sourcerpm"
+	cycloneDXArchProp      = "rpm:arch"
+	cycloneDXPropPrefix    = "rpm:"
+)
+
+type cycloneDXBOM struct {
+	BOMFormat    string               `json:"bomFormat"`
+	SpecVersion  string               `json:"specVersion"`
+	SerialNumber string               `json:"serialNumber"`
+	Version      int                  `json:"version"`
+	Metadata     cycloneDXMetadata    `json:"metadata"`
+	Components   []cycloneDXComponent `json:"components"`
+}
+
+type cycloneDXMetadata struct {
+	Timestamp string             `json:"timestamp"`
+	Tools     []cycloneDXTool    `json:"tools"`
+	Component cycloneDXComponent `json:"component"`
+}
+
+type cycloneDXTool struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type cycloneDXComponent struct {
+	Type       string              `json:"type"`
+	BOMRef     string              `json:"bom-ref,omitempty"`
+	Publisher  string              `json:"publisher,omitempty"`
+	Name       string              `json:"name"`
+	Version    string              `json:"version,omitempty"`
+	Licenses   []cycloneDXLicense  `json:"licenses,omitempty"`
+	PURL       string              `json:"purl,omitempty"`
+	Properties []cycloneDXProperty `json:"properties,omitempty"`
+}
+
+type cycloneDXLicense struct {
+	License cycloneDXLicenseName `json:"license"`
+}
+
+type cycloneDXLicenseName struct {
+	Name string `json:"name"`
+}
+
+type cycloneDXProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// writeCycloneDX writes the document as CycloneDX JSON.
+func writeCycloneDX(path string, document *Document) (err error) {
+	uuid, err := newUUID()
+	if err != nil {
+		return
+	}
+
+	return jsonutils.WriteJSONFile(path, newCycloneDXBOM(document, uuid))
+}
+
+// newCycloneDXBOM converts the document to CycloneDX, uuid is used as the BOM's serial number.
+func newCycloneDXBOM(document *Document, uuid string) (bom *cycloneDXBOM) {
+	const bomVersion = 1
+
+	bom = &cycloneDXBOM{
+		BOMFormat:    cycloneDXFormat,
+		SpecVersion:  cycloneDXSpecVersion,
+		SerialNumber: fmt.Sprintf("urn:uuid:%s", uuid),
+		Version:      bomVersion,
+		Metadata: cycloneDXMetadata{
+			Timestamp: document.Created.UTC().Format(time.RFC3339),
+			Tools:     []cycloneDXTool{{Name: document.ToolName, Version: document.ToolVersion}},
+			Component: cycloneDXComponent{Type: cycloneDXImageType, Name: document.Name},
+		},
+		Components: []cycloneDXComponent{},
+	}
+
+	for _, pkg := range document.Packages {
+		component := cycloneDXComponent{
+			Type:       cycloneDXPackageType,
+			BOMRef:     pkg.PackageURL(),
+			Publisher:  pkg.Vendor,
+			Name:       pkg.Name,
+			Version:    pkg.EVR(),
+			PURL:       pkg.PackageURL(),
+			Properties: []cycloneDXProperty{{Name: cycloneDXArchProp, Value: pkg.Arch}},
+		}
+
+		if pkg.License != "" {
+			component.Licenses = []cycloneDXLicense{{License: cycloneDXLicenseName{Name: pkg.License}}}
+		}
+		if pkg.SourceRPM != "" {
+			component.Properties = append(component.Properties, cycloneDXProperty{Name: cycloneDXSourceRPMProp, Value: pkg.SourceRPM})
+		}
+		// CycloneDX hashes must be of the component itself, rpm's header digests are recorded as properties instead.
+		for _, digest := range pkg.HeaderDigests {
+			component.Properties = append(component.Properties, cycloneDXProperty{Name: cycloneDXPropPrefix + strings.ToLower(digest.Tag), Value: digest.Value})
+		}
+
+		bom.Components = append(bom.Components, component)
+	}
+
+	return
+}
@@ -0,0 +1,200 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+// Package sbom generates Software Bills of Materials listing the RPMs installed in an image.
+package sbom
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"microsoft.com/pkggen/internal/rpm"
+)
+
+const (
+	// FormatSPDX is an SPDX 2.2 JSON document.
+	FormatSPDX = "spdx"
+	// FormatCycloneDX is a CycloneDX 1.3 JSON BOM.
+	FormatCycloneDX = "cyclonedx"
+
+	// FileBaseName is the name, without its format suffix, of an SBOM describing a whole image.
+	FileBaseName = "sbom"
+
+	// purlNamespace is the namespace used in the package URL of every RPM.
+	purlNamespace = "mariner"
+
+	// rpmNone is returned by rpm queries for tags a package does not have.
+	rpmNone = "(none)"
+
+	// gpgPubKeyName is the name of the pseudo-packages rpm uses to track imported GPG keys.
+	gpgPubKeyName = "gpg-pubkey"
+)
+
+// Formats lists every supported SBOM format.
+var Formats = []string{FormatSPDX, FormatCycloneDX}
+
+// fileSuffixes maps each format to the suffix of the files it is written to.
+var fileSuffixes = map[string]string{
+	FormatSPDX:      ".spdx.json",
+	FormatCycloneDX: ".cdx.json",
+}
+
+// HeaderDigest is a digest rpm recorded for a package's header, or header and payload for SIGMD5.
+// These identify the package but are not checksums of its RPM file.
+type HeaderDigest struct {
+	Tag   string // rpm tag holding the digest, such as SHA256HEADER
+	Value string
+}
+
+// Package describes an installed RPM.
+type Package struct {
+	Name          string
+	Epoch         string
+	Version       string
+	Release       string
+	Arch          string
+	License       string
+	Vendor        string
+	SourceRPM     string
+	HeaderDigests []HeaderDigest
+}
+
+// Document holds everything needed to write an SBOM.
+type Document struct {
+	Name        string    // Name of the image the SBOM describes
+	ToolName    string    // Tool which generated the SBOM
+	ToolVersion string    // Version of the tool which generated the SBOM
+	Created     time.Time // Time the SBOM was generated
+	Packages    []*Package
+}
+
+// FileSuffix returns the suffix for files of the given format, such as ".spdx.json".
+func FileSuffix(format string) string {
+	return fileSuffixes[format]
+}
+
+// EVR returns the package's [epoch:]version-release.
+func (p *Package) EVR() string {
+	if p.Epoch != "" {
+		return fmt.Sprintf("%s:%s-%s", p.Epoch, p.Version, p.Release)
+	}
+	return p.VersionRelease()
+}
+
+// VersionRelease returns the package's version-release.
+func (p *Package) VersionRelease() string {
+	return fmt.Sprintf("%s-%s", p.Version, p.Release)
+}
+
+// PackageURL returns the purl (https://github.com/package-url/purl-spec) identifying the package.
+func (p *Package) PackageURL() string {
+	qualifiers := url.Values{}
+	qualifiers.Set("arch", p.Arch)
+	if p.Epoch != "" {
+		qualifiers.Set("epoch", p.Epoch)
+	}
+
+	return fmt.Sprintf("pkg:rpm/%s/%s@%s?%s", purlNamespace, url.PathEscape(p.Name), url.PathEscape(p.VersionRelease()), qualifiers.Encode())
+}
+
+// packageFields are queried for every installed package, in order, separated by tabs.
+var packageFields = []string{"NAME", "EPOCH", "VERSION", "RELEASE", "ARCH", "LICENSE", "VENDOR", "SOURCERPM", "SHA256HEADER", "SHA1HEADER", "SIGMD5"}
+
+// headerDigestFields are the fields in packageFields holding header digests.
+var headerDigestFields = []string{"SHA256HEADER", "SHA1HEADER", "SIGMD5"}
+
+// QueryInstalledPackages returns every RPM installed under installRoot, sorted as reported by rpm.
+func QueryInstalledPackages(installRoot string) (packages []*Package, err error) {
+	var queryFormat strings.Builder
+	for i, field := range packageFields {
+		if i != 0 {
+			queryFormat.WriteString("\t")
+		}
+		fmt.Fprintf(&queryFormat, "%%{%s}", field)
+	}
+	queryFormat.WriteString("\n")
+
+	lines, err := rpm.QueryInstalledPackages(installRoot, queryFormat.String(), nil)
+	if err != nil {
+		return
+	}
+
+	for _, line := range lines {
+		var pkg *Package
+		pkg, err = parsePackage(line)
+		if err != nil {
+			return
+		}
+		if pkg.Name == gpgPubKeyName {
+			continue
+		}
+		packages = append(packages, pkg)
+	}
+
+	return
+}
+
+// parsePackage parses a single line of package query output.
+func parsePackage(line string) (pkg *Package, err error) {
+	values := strings.Split(line, "\t")
+	if len(values) != len(packageFields) {
+		err = fmt.Errorf("unexpected package query result (%s)", line)
+		return
+	}
+
+	fields := make(map[string]string, len(packageFields))
+	for i, field := range packageFields {
+		if values[i] != rpmNone {
+			fields[field] = values[i]
+		}
+	}
+
+	pkg = &Package{
+		Name:      fields["NAME"],
+		Epoch:     fields["EPOCH"],
+		Version:   fields["VERSION"],
+		Release:   fields["RELEASE"],
+		Arch:      fields["ARCH"],
+		License:   fields["LICENSE"],
+		Vendor:    fields["VENDOR"],
+		SourceRPM: fields["SOURCERPM"],
+	}
+
+	for _, field := range headerDigestFields {
+		if fields[field] != "" {
+			pkg.HeaderDigests = append(pkg.HeaderDigests, HeaderDigest{Tag: field, Value: fields[field]})
+		}
+	}
+
+	return
+}
+
+// WriteDocument writes an SBOM in the given format to path.
+func WriteDocument(path, format string, document *Document) (err error) {
+	switch format {
+	case FormatSPDX:
+		err = writeSPDX(path, document)
+	case FormatCycloneDX:
+		err = writeCycloneDX(path, document)
+	default:
+		err = fmt.Errorf("unsupported SBOM format (%s)", format)
+	}
+	return
+}
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() (uuid string, err error) {
+	var bytes [16]byte
+	_, err = rand.Read(bytes[:])
+	if err != nil {
+		return
+	}
+
+	bytes[6] = (bytes[6] & 0x0f) | 0x40
+	bytes[8] = (bytes[8] & 0x3f) | 0x80
+	uuid = fmt.Sprintf("%x-%x-%x-%x-%x", bytes[0:4], bytes[4:6], bytes[6:8], bytes[8:10], bytes[10:])
+	return
+}
@@ -0,0 +1,163 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package sbom
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"microsoft.com/pkggen/internal/logger"
+)
+
+const testUUID = "01234567-89ab-4cde-8f01-23456789abcd"
+
+var testDocument = &Document{
+	Name:        "core-efi",
+	ToolName:    "imager",
+	ToolVersion: "1.0",
+	Created:     time.Date(2020, time.October, 1, 12, 0, 0, 0, time.UTC),
+	Packages: []*Package{
+		{
+			Name:          "bash",
+			Version:       "4.4.18",
+			Release:       "4.cm1",
+			Arch:          "x86_64",
+			License:       "GPLv3+",
+			Vendor:        "Microsoft Corporation",
+			SourceRPM:     "bash-4.4.18-4.cm1.src.rpm",
+			HeaderDigests: []HeaderDigest{{Tag: "SHA256HEADER", Value: "abc"}, {Tag: "SIGMD5", Value: "def"}},
+		},
+		{
+			Name:    "libstdc++",
+			Epoch:   "1",
+			Version: "9.1.0",
+			Release: "1.cm1",
+			Arch:    "x86_64",
+		},
+	},
+}
+
+func TestMain(m *testing.M) {
+	logger.InitStderrLog()
+	os.Exit(m.Run())
+}
+
+func TestParsePackage(t *testing.T) {
+	pkg, err := parsePackage("libstdc++\t1\t9.1.0\t1.cm1\tx86_64\tGPLv3+\t(none)\tgcc-9.1.0-1.cm1.src.rpm\tabc\t(none)\tdef")
+	assert.NoError(t, err)
+
+	expected := &Package{
+		Name:          "libstdc++",
+		Epoch:         "1",
+		Version:       "9.1.0",
+		Release:       "1.cm1",
+		Arch:          "x86_64",
+		License:       "GPLv3+",
+		SourceRPM:     "gcc-9.1.0-1.cm1.src.rpm",
+		HeaderDigests: []HeaderDigest{{Tag: "SHA256HEADER", Value: "abc"}, {Tag: "SIGMD5", Value: "def"}},
+	}
+	assert.Equal(t, expected, pkg)
+}
+
+func TestParsePackageShouldFailOnMissingFields(t *testing.T) {
+	_, err := parsePackage("bash\t(none)\t4.4.18")
+	assert.Error(t, err)
+}
+
+func TestPackageEVR(t *testing.T) {
+	assert.Equal(t, "4.4.18-4.cm1", testDocument.Packages[0].EVR())
+	assert.Equal(t, "1:9.1.0-1.cm1", testDocument.Packages[1].EVR())
+}
+
+func TestPackageURL(t *testing.T) {
+	assert.Equal(t, "pkg:rpm/mariner/bash@4.4.18-4.cm1?arch=x86_64", testDocument.Packages[0].PackageURL())
+	assert.Equal(t, "pkg:rpm/mariner/libstdc++@9.1.0-1.cm1?arch=x86_64&epoch=1", testDocument.Packages[1].PackageURL())
+}
+
+func TestSPDXDocument(t *testing.T) {
+	spdx := newSPDXDocument(testDocument, testUUID)
+
+	assert.Equal(t, "SPDX-2.2", spdx.SPDXVersion)
+	assert.Equal(t, "https://spdx.org/spdxdocs/core-efi-"+testUUID, spdx.DocumentNamespace)
+	assert.Equal(t, "2020-10-01T12:00:00Z", spdx.CreationInfo.Created)
+	assert.Equal(t, []string{"Tool: imager-1.0"}, spdx.CreationInfo.Creators)
+	assert.Len(t, spdx.Packages, 2)
+	assert.Len(t, spdx.Relationships, 2)
+
+	bash := spdx.Packages[0]
+	assert.Equal(t, "SPDXRef-RPM-bash-4.4.18-4.cm1.x86-64", bash.SPDXID)
+	assert.Equal(t, "4.4.18-4.cm1", bash.VersionInfo)
+	assert.Equal(t, "Organization: Microsoft Corporation", bash.Supplier)
+	assert.Equal(t, "RPM License tag: GPLv3+", bash.LicenseComments)
+	assert.Equal(t, "Built from source RPM bash-4.4.18-4.cm1.src.rpm", bash.SourceInfo)
+	assert.Equal(t, []spdxAnnotation{
+		{AnnotationDate: "2020-10-01T12:00:00Z", AnnotationType: "OTHER", Annotator: "Tool: imager-1.0", Comment: "RPM header digest SHA256HEADER: abc"},
+		{AnnotationDate: "2020-10-01T12:00:00Z", AnnotationType: "OTHER", Annotator: "Tool: imager-1.0", Comment: "RPM header digest SIGMD5: def"},
+	}, bash.Annotations)
+	assert.Equal(t, "pkg:rpm/mariner/bash@4.4.18-4.cm1?arch=x86_64", bash.ExternalRefs[0].ReferenceLocator)
+
+	libstdcxx := spdx.Packages[1]
+	assert.Equal(t, spdxNoAssertion, libstdcxx.Supplier)
+	assert.Empty(t, libstdcxx.LicenseComments)
+	assert.Empty(t, libstdcxx.Annotations)
+
+	validID := regexp.MustCompile(`^SPDXRef-[a-zA-Z0-9.-]+$`)
+	for i, pkg := range spdx.Packages {
+		assert.Regexp(t, validID, pkg.SPDXID)
+		assert.Equal(t, spdxRelationship{SPDXElementID: spdxDocumentID, RelationshipType: "DESCRIBES", RelatedSPDXElement: pkg.SPDXID}, spdx.Relationships[i])
+	}
+}
+
+func TestCycloneDXBOM(t *testing.T) {
+	bom := newCycloneDXBOM(testDocument, testUUID)
+
+	assert.Equal(t, "CycloneDX", bom.BOMFormat)
+	assert.Equal(t, "urn:uuid:"+testUUID, bom.SerialNumber)
+	assert.Equal(t, "2020-10-01T12:00:00Z", bom.Metadata.Timestamp)
+	assert.Equal(t, cycloneDXComponent{Type: "operating-system", Name: "core-efi"}, bom.Metadata.Component)
+	assert.Len(t, bom.Components, 2)
+
+	bash := bom.Components[0]
+	assert.Equal(t, "pkg:rpm/mariner/bash@4.4.18-4.cm1?arch=x86_64", bash.PURL)
+	assert.Equal(t, []cycloneDXLicense{{License: cycloneDXLicenseName{Name: "GPLv3+"}}}, bash.Licenses)
+	assert.Contains(t, bash.Properties, cycloneDXProperty{Name: "rpm:sha256header", Value: "abc"})
+	assert.Contains(t, bash.Properties, cycloneDXProperty{Name: "rpm:sigmd5", Value: "def"})
+	assert.Contains(t, bash.Properties, cycloneDXProperty{Name: "rpm:sourcerpm", Value: "bash-4.4.18-4.cm1.src.rpm"})
+
+	assert.Equal(t, "1:9.1.0-1.cm1", bom.Components[1].Version)
+	assert.Empty(t, bom.Components[1].Licenses)
+}
+
+func TestWriteDocument(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sbom")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, format := range Formats {
+		path := filepath.Join(dir, FileBaseName+FileSuffix(format))
+		assert.NoError(t, WriteDocument(path, format, testDocument), format)
+
+		contents, err := ioutil.ReadFile(path)
+		assert.NoError(t, err)
+		assert.True(t, json.Valid(contents), format)
+	}
+
+	assert.Error(t, WriteDocument(filepath.Join(dir, "sbom.txt"), "text", testDocument))
+}
+
+func TestNewUUID(t *testing.T) {
+	first, err := newUUID()
+	assert.NoError(t, err)
+	second, err := newUUID()
+	assert.NoError(t, err)
+
+	assert.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, first)
+	assert.NotEqual(t, first, second)
+}
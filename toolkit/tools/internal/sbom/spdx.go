@@ -0,0 +1,157 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package sbom
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"microsoft.com/pkggen/internal/jsonutils"
+)
+
+const (
+	spdxVersion        = "SPDX-2.2"
+	spdxDataLicense    = "CC0-1.0"
+	spdxDocumentID     = "SPDXRef-DOCUMENT"
+	spdxNoAssertion    = "NOASSERTION"
+	spdxNamespaceBase  = "https://spdx.org/spdxdocs"
+	spdxDescribes      = "DESCRIBES"
+	spdxPackageRefs    = "PACKAGE-MANAGER"
+	spdxPurlRefType    = "purl"
+	spdxAnnotationType = "OTHER"
+)
+
+// spdxInvalidIDCharacters matches the characters which may not be used in an SPDX identifier.
+var spdxInvalidIDCharacters = regexp.MustCompile(`[^a-zA-Z0-9.-]`)
+
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	Name             string            `json:"name"`
+	SPDXID           string            `json:"SPDXID"`
+	VersionInfo      string            `json:"versionInfo"`
+	Supplier         string            `json:"supplier"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	SourceInfo       string            `json:"sourceInfo,omitempty"`
+	LicenseConcluded string            `json:"licenseConcluded"`
+	LicenseDeclared  string            `json:"licenseDeclared"`
+	LicenseComments  string            `json:"licenseComments,omitempty"`
+	CopyrightText    string            `json:"copyrightText"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs"`
+	Annotations      []spdxAnnotation  `json:"annotations,omitempty"`
+}
+
+type spdxAnnotation struct {
+	AnnotationDate string `json:"annotationDate"`
+	AnnotationType string `json:"annotationType"`
+	Annotator      string `json:"annotator"`
+	Comment        string `json:"comment"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+// writeSPDX writes the document as SPDX JSON.
+func writeSPDX(path string, document *Document) (err error) {
+	uuid, err := newUUID()
+	if err != nil {
+		return
+	}
+
+	return jsonutils.WriteJSONFile(path, newSPDXDocument(document, uuid))
+}
+
+// newSPDXDocument converts the document to SPDX, uuid makes the document's namespace unique.
+func newSPDXDocument(document *Document, uuid string) (spdx *spdxDocument) {
+	created := document.Created.UTC().Format(time.RFC3339)
+	creator := fmt.Sprintf("Tool: %s-%s", document.ToolName, document.ToolVersion)
+
+	spdx = &spdxDocument{
+		SPDXVersion:       spdxVersion,
+		DataLicense:       spdxDataLicense,
+		SPDXID:            spdxDocumentID,
+		Name:              document.Name,
+		DocumentNamespace: fmt.Sprintf("%s/%s-%s", spdxNamespaceBase, spdxInvalidIDCharacters.ReplaceAllString(document.Name, "-"), uuid),
+		CreationInfo: spdxCreationInfo{
+			Created:  created,
+			Creators: []string{creator},
+		},
+		Packages:      []spdxPackage{},
+		Relationships: []spdxRelationship{},
+	}
+
+	for _, pkg := range document.Packages {
+		id := fmt.Sprintf("SPDXRef-RPM-%s", spdxInvalidIDCharacters.ReplaceAllString(fmt.Sprintf("%s-%s.%s", pkg.Name, pkg.EVR(), pkg.Arch), "-"))
+
+		spdxPkg := spdxPackage{
+			Name:             pkg.Name,
+			SPDXID:           id,
+			VersionInfo:      pkg.EVR(),
+			Supplier:         spdxNoAssertion,
+			DownloadLocation: spdxNoAssertion,
+			// RPM license tags are not guaranteed to be valid SPDX license expressions, so they are only recorded as a comment.
+			LicenseConcluded: spdxNoAssertion,
+			LicenseDeclared:  spdxNoAssertion,
+			CopyrightText:    spdxNoAssertion,
+			ExternalRefs: []spdxExternalRef{{
+				ReferenceCategory: spdxPackageRefs,
+				ReferenceType:     spdxPurlRefType,
+				ReferenceLocator:  pkg.PackageURL(),
+			}},
+		}
+
+		if pkg.Vendor != "" {
+			spdxPkg.Supplier = fmt.Sprintf("Organization: %s", pkg.Vendor)
+		}
+		if pkg.License != "" {
+			spdxPkg.LicenseComments = fmt.Sprintf("RPM License tag: %s", pkg.License)
+		}
+		if pkg.SourceRPM != "" {
+			spdxPkg.SourceInfo = fmt.Sprintf("Built from source RPM %s", pkg.SourceRPM)
+		}
+		// SPDX package checksums must be of the package file, rpm's header digests are recorded as annotations instead.
+		for _, digest := range pkg.HeaderDigests {
+			spdxPkg.Annotations = append(spdxPkg.Annotations, spdxAnnotation{
+				AnnotationDate: created,
+				AnnotationType: spdxAnnotationType,
+				Annotator:      creator,
+				Comment:        fmt.Sprintf("RPM header digest %s: %s", digest.Tag, digest.Value),
+			})
+		}
+
+		spdx.Packages = append(spdx.Packages, spdxPkg)
+		spdx.Relationships = append(spdx.Relationships, spdxRelationship{
+			SPDXElementID:      spdxDocumentID,
+			RelationshipType:   spdxDescribes,
+			RelatedSPDXElement: id,
+		})
+	}
+
+	return
+}
@@ -0,0 +1,96 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+// Package sizeutils converts between byte counts and their friendly representations, such as 512MiB.
+
+package sizeutils
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// Unit to byte conversion values
+// See https://www.gnu.org/software/parted/manual/parted.html#unit
+const (
+	B  = 1
+	KB = 1000
+	MB = 1000 * 1000
+	GB = 1000 * 1000 * 1000
+	TB = 1000 * 1000 * 1000 * 1000
+
+	KiB = 1024
+	MiB = 1024 * 1024
+	GiB = 1024 * 1024 * 1024
+	TiB = 1024 * 1024 * 1024 * 1024
+)
+
+var (
+	sizeAndUnitRegexp = regexp.MustCompile(`^(\d+)([KMGT]i?B|[KMGT]|B)$`)
+
+	// The single letter units are shorthands for the binary units, as used by sfdisk and systemd-repart
+	unitToBytes = map[string]uint64{
+		"B":   B,
+		"KB":  KB,
+		"MB":  MB,
+		"GB":  GB,
+		"TB":  TB,
+		"KiB": KiB,
+		"MiB": MiB,
+		"GiB": GiB,
+		"TiB": TiB,
+		"K":   KiB,
+		"M":   MiB,
+		"G":   GiB,
+		"T":   TiB,
+	}
+
+	// Units BytesToSizeAndUnit picks from, from smallest to largest
+	friendlyUnits = []string{"B", "KiB", "MiB", "GiB", "TiB"}
+)
+
+// BytesToSizeAndUnit takes a number of bytes and returns friendly representation of a size (for example 100GiB).
+// The size is rounded down to the largest binary unit it is at least one of.
+func BytesToSizeAndUnit(bytes uint64) string {
+	// Default to unit "Bytes" to handle the case where bytes is 0
+	unitName := friendlyUnits[0]
+
+	for _, unit := range friendlyUnits {
+		if bytes >= unitToBytes[unit] {
+			unitName = unit
+		}
+	}
+
+	return fmt.Sprintf("%d%s", bytes/unitToBytes[unitName], unitName)
+}
+
+// SizeAndUnitToBytes takes a friendly representation of a size (for example 100GB) and return the number of bytes it represents.
+// Units may be decimal (KB, MB, ...), binary (KiB, MiB, ...) or a single letter shorthand for the binary unit (K, M, ...).
+func SizeAndUnitToBytes(sizeAndUnit string) (bytes uint64, err error) {
+	const (
+		sizeIndex = 1
+		unitIndex = 2
+	)
+
+	// Match size and unit.  Examples: 2GB, 512MiB, 512M
+	match := sizeAndUnitRegexp.FindStringSubmatch(sizeAndUnit)
+	if match == nil {
+		err = fmt.Errorf("size (%s) must be a number followed by a unit type", sizeAndUnit)
+		return
+	}
+
+	size, err := strconv.ParseUint(match[sizeIndex], 10, 64)
+	if err != nil {
+		return
+	}
+
+	unitBytes := unitToBytes[match[unitIndex]]
+	if size > ^uint64(0)/unitBytes {
+		err = fmt.Errorf("size (%s) is too large", sizeAndUnit)
+		return
+	}
+
+	bytes = size * unitBytes
+	return
+}
@@ -0,0 +1,54 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package sizeutils
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"microsoft.com/pkggen/internal/logger"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitStderrLog()
+	os.Exit(m.Run())
+}
+
+func TestSizeAndUnitToBytes(t *testing.T) {
+	sizes := map[string]uint64{
+		"0B":     0,
+		"512B":   512,
+		"2KB":    2 * KB,
+		"2GB":    2 * GB,
+		"512MiB": 512 * MiB,
+		"3TiB":   3 * TiB,
+		"512M":   512 * MiB,
+		"4K":     4 * KiB,
+		"1G":     GiB,
+		"1T":     TiB,
+	}
+
+	for sizeAndUnit, expected := range sizes {
+		bytes, err := SizeAndUnitToBytes(sizeAndUnit)
+		assert.NoError(t, err, sizeAndUnit)
+		assert.Equal(t, expected, bytes, sizeAndUnit)
+	}
+}
+
+func TestSizeAndUnitToBytesShouldFailOnInvalidSize(t *testing.T) {
+	for _, sizeAndUnit := range []string{"", "512", "MiB", "-1MiB", "1.5GiB", "512Mi", "512 MiB", "512MiBs", "20%", "99999999999T"} {
+		_, err := SizeAndUnitToBytes(sizeAndUnit)
+		assert.Error(t, err, sizeAndUnit)
+	}
+}
+
+func TestBytesToSizeAndUnit(t *testing.T) {
+	assert.Equal(t, "0B", BytesToSizeAndUnit(0))
+	assert.Equal(t, "1023B", BytesToSizeAndUnit(1023))
+	assert.Equal(t, "1KiB", BytesToSizeAndUnit(KiB))
+	assert.Equal(t, "512MiB", BytesToSizeAndUnit(512*MiB+1))
+	assert.Equal(t, "100GiB", BytesToSizeAndUnit(100*GiB))
+	assert.Equal(t, "2TiB", BytesToSizeAndUnit(2*TiB))
+}
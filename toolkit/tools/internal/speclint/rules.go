@@ -0,0 +1,210 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package speclint
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"microsoft.com/pkggen/internal/logger"
+	"microsoft.com/pkggen/internal/pkgjson"
+)
+
+// checkParse reports SPECs which could not be parsed, and so were skipped by every other rule.
+func checkParse(specs []*Spec) (findings []*Finding) {
+	for _, spec := range specs {
+		if spec.ParseErr != nil {
+			findings = append(findings, &Finding{
+				SpecPath: spec.Path,
+				Message:  fmt.Sprintf("Failed to parse the SPEC, no other rule checked it: %v", spec.ParseErr),
+			})
+		}
+	}
+	return
+}
+
+// checkNameDirectory reports SPECs whose Name doesn't match the directory they are in.
+func checkNameDirectory(specs []*Spec) (findings []*Finding) {
+	for _, spec := range specs {
+		if spec.Parsed == nil {
+			continue
+		}
+
+		dirName := filepath.Base(filepath.Dir(spec.Path))
+		if spec.Parsed.Name != dirName {
+			findings = append(findings, &Finding{
+				SpecPath: spec.Path,
+				Message:  fmt.Sprintf("Name (%s) does not match the SPEC's directory (%s)", spec.Parsed.Name, dirName),
+			})
+		}
+	}
+	return
+}
+
+// checkReleaseDist reports SPECs whose Release doesn't end with the dist tag.
+func checkReleaseDist(specs []*Spec) (findings []*Finding) {
+	for _, spec := range specs {
+		if spec.Parsed == nil || strings.HasSuffix(spec.Parsed.Release, distTagPlaceholder) {
+			continue
+		}
+
+		release := strings.Replace(spec.Parsed.Release, distTagPlaceholder, "%{?dist}", -1)
+		findings = append(findings, &Finding{
+			SpecPath: spec.Path,
+			Message:  fmt.Sprintf("Release (%s) does not end with %%{?dist}", release),
+		})
+	}
+	return
+}
+
+// checkSourceSignatures reports Source files which have no signature in the SPEC's signatures file.
+func checkSourceSignatures(specs []*Spec) (findings []*Finding) {
+	for _, spec := range specs {
+		if spec.Parsed == nil || len(spec.Parsed.Sources) == 0 {
+			continue
+		}
+
+		if spec.SignaturesErr != nil {
+			findings = append(findings, &Finding{
+				SpecPath: spec.Path,
+				Message:  fmt.Sprintf("Failed to read the signatures file (%s): %v", spec.SignaturesPath, spec.SignaturesErr),
+			})
+			continue
+		}
+
+		for _, source := range spec.Parsed.Sources {
+			if _, found := spec.Signatures[source]; !found {
+				findings = append(findings, &Finding{
+					SpecPath: spec.Path,
+					Message:  fmt.Sprintf("Source (%s) has no signature in (%s)", source, spec.SignaturesPath),
+				})
+			}
+		}
+	}
+	return
+}
+
+// checkBuildRequires reports BuildRequires which no package built from the SPECs provides.
+// File dependencies, rpmlib() dependencies and rich dependencies are not checked.
+func checkBuildRequires(specs []*Spec) (findings []*Finding) {
+	const (
+		dynamicDependencyPrefix = "rpmlib("
+		fileDependencyPrefix    = "/"
+	)
+
+	providers := make(map[string][]*pkgjson.PackageVer)
+	for _, spec := range buildableSpecs(specs) {
+		for _, pkg := range spec.Parsed.Packages {
+			for _, provides := range pkg.Provides {
+				provider, err := pkgjson.ParseDependency(provides)
+				if err != nil {
+					logger.Log.Warnf("Ignoring Provides (%s) of (%s): %v", provides, spec.Path, err)
+					continue
+				}
+				providers[provider.Name] = append(providers[provider.Name], provider)
+			}
+		}
+	}
+
+	for _, spec := range buildableSpecs(specs) {
+		for _, buildRequires := range spec.Parsed.BuildRequires {
+			requirement, err := pkgjson.ParseDependency(buildRequires)
+			if err != nil {
+				findings = append(findings, &Finding{
+					SpecPath: spec.Path,
+					Message:  fmt.Sprintf("BuildRequires (%s) is invalid: %v", buildRequires, err),
+				})
+				continue
+			}
+
+			if requirement.IsRich() || strings.HasPrefix(requirement.Name, fileDependencyPrefix) || strings.HasPrefix(requirement.Name, dynamicDependencyPrefix) {
+				continue
+			}
+
+			if !isProvided(requirement, providers[requirement.Name]) {
+				findings = append(findings, &Finding{
+					SpecPath: spec.Path,
+					Message:  fmt.Sprintf("BuildRequires (%s) is not provided by any SPEC", buildRequires),
+				})
+			}
+		}
+	}
+	return
+}
+
+// isProvided returns true if one of the providers satisfies the requirement.
+func isProvided(requirement *pkgjson.PackageVer, providers []*pkgjson.PackageVer) bool {
+	requiredInterval, err := requirement.Interval()
+	if err != nil {
+		logger.Log.Warnf("Unable to check the version of (%s): %v", requirement.Name, err)
+		return len(providers) != 0
+	}
+
+	for _, provider := range providers {
+		providedInterval, err := provider.Interval()
+		if err != nil {
+			continue
+		}
+		if providedInterval.Satisfies(&requiredInterval) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkDuplicateProvides reports Provides which packages from more than one SPEC provide.
+// The architecture specific copy of a package's own name, e.g. "foo(x86-64)" for "foo", is not checked separately.
+func checkDuplicateProvides(specs []*Spec) (findings []*Finding) {
+	// The SPECs providing each name, a SPEC is only listed once per name
+	providers := make(map[string][]string)
+
+	for _, spec := range buildableSpecs(specs) {
+		provided := make(map[string]bool)
+		for _, pkg := range spec.Parsed.Packages {
+			for _, provides := range pkg.Provides {
+				provider, err := pkgjson.ParseDependency(provides)
+				if err != nil || provided[provider.Name] || isArchProvides(spec, pkg.Name, provider) {
+					continue
+				}
+				provided[provider.Name] = true
+				providers[provider.Name] = append(providers[provider.Name], spec.Path)
+			}
+		}
+	}
+
+	for name, specPaths := range providers {
+		if len(specPaths) < 2 {
+			continue
+		}
+
+		sort.Strings(specPaths)
+		for i, specPath := range specPaths {
+			others := append(append([]string{}, specPaths[:i]...), specPaths[i+1:]...)
+			findings = append(findings, &Finding{
+				SpecPath: specPath,
+				Message:  fmt.Sprintf("Provides (%s) is also provided by (%s)", name, strings.Join(others, ", ")),
+			})
+		}
+	}
+	return
+}
+
+// isArchProvides returns true if provider is the implicit architecture specific Provides of a package,
+// e.g. "foo(x86-64) = 1.0-1" for "foo". Other Provides using the package's name, such as "perl(Carp)", have their own version.
+func isArchProvides(spec *Spec, pkgName string, provider *pkgjson.PackageVer) bool {
+	return strings.HasPrefix(provider.Name, pkgName+"(") && provider.Version == spec.Parsed.EVR()
+}
+
+// buildableSpecs returns the SPECs which were parsed and can be built for the target architecture.
+func buildableSpecs(specs []*Spec) (buildable []*Spec) {
+	for _, spec := range specs {
+		if spec.Parsed != nil && spec.Buildable {
+			buildable = append(buildable, spec)
+		}
+	}
+	return
+}
@@ -0,0 +1,47 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package speclint
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteSARIF(t *testing.T) {
+	rules := DefaultRules()
+	report := &Report{
+		SpecCount: 1,
+		Findings: []*Finding{
+			{RuleID: "release-dist", Severity: SeverityError, SpecPath: "SPECS/foo bar/foo.spec", Message: "Release (1) does not end with %{?dist}"},
+		},
+	}
+
+	var out bytes.Buffer
+	assert.NoError(t, WriteSARIF(&out, report, rules, "1.0"))
+
+	var log sarifLog
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &log))
+	assert.Equal(t, "2.1.0", log.Version)
+	assert.Len(t, log.Runs, 1)
+
+	driver := log.Runs[0].Tool.Driver
+	assert.Equal(t, "speclint", driver.Name)
+	assert.Len(t, driver.Rules, len(rules))
+
+	results := log.Runs[0].Results
+	assert.Len(t, results, 1)
+	assert.Equal(t, "release-dist", driver.Rules[results[0].RuleIndex].ID)
+	assert.Equal(t, SeverityError, results[0].Level)
+	assert.Equal(t, "SPECS/foo%20bar/foo.spec", results[0].Locations[0].PhysicalLocation.ArtifactLocation.URI)
+}
+
+func TestWriteSARIFShouldListEmptyResults(t *testing.T) {
+	var out bytes.Buffer
+	assert.NoError(t, WriteSARIF(&out, &Report{}, nil, ""))
+	assert.Contains(t, out.String(), `"results": []`)
+	assert.Contains(t, out.String(), `"rules": []`)
+}
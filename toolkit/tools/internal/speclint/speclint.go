@@ -0,0 +1,194 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package speclint
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"microsoft.com/pkggen/internal/logger"
+	"microsoft.com/pkggen/internal/rpm"
+	"microsoft.com/pkggen/internal/specparser"
+	"microsoft.com/pkggen/internal/specsignatures"
+)
+
+// Severity is how serious a finding is. The values match the SARIF result levels.
+type Severity string
+
+const (
+	// SeverityError marks a problem which breaks the build or its reproducibility
+	SeverityError Severity = "error"
+	// SeverityWarning marks a problem which should be fixed, but doesn't break the build
+	SeverityWarning Severity = "warning"
+)
+
+// distTagPlaceholder is what %{dist} expands to while linting, so rules can tell if the release uses it.
+const distTagPlaceholder = ".speclint_dist"
+
+// Spec is a SPEC file to lint, along with everything the rules need to know about it.
+type Spec struct {
+	Path           string            // Path to the SPEC file
+	Parsed         *specparser.Spec  // The parsed SPEC, nil if it could not be parsed
+	ParseErr       error             // Why the SPEC could not be parsed
+	Buildable      bool              // The SPEC can be built for the architecture it was parsed for
+	SignaturesPath string            // Path to the SPEC's signatures file
+	Signatures     map[string]string // Signatures of the SPEC's sources, by file name
+	SignaturesErr  error             // Why the signatures file could not be read
+}
+
+// Finding is a single problem found by a rule.
+type Finding struct {
+	RuleID   string   `json:"RuleID"`   // ID of the rule which found the problem
+	Severity Severity `json:"Severity"` // Severity of the rule
+	SpecPath string   `json:"SpecPath"` // Path to the SPEC file with the problem
+	Message  string   `json:"Message"`  // Description of the problem
+}
+
+// Report is the result of linting a set of SPECs.
+type Report struct {
+	SpecCount int        `json:"SpecCount"` // Number of SPECs linted
+	Findings  []*Finding `json:"Findings"`  // Every problem found, sorted by SPEC and rule
+}
+
+// Rule is a single check run across every SPEC. Rules are given all SPECs at once so they may compare them.
+type Rule struct {
+	ID          string                         // Unique name of the rule, used to disable it and in reports
+	Description string                         // One line description of what the rule checks
+	Severity    Severity                       // Severity of the rule's findings
+	Check       func(specs []*Spec) []*Finding // Returns the problems found, the rule's ID and severity are filled in by Lint
+}
+
+// DefaultRules returns every rule speclint knows about.
+func DefaultRules() []*Rule {
+	return []*Rule{
+		{
+			ID:          "parse",
+			Description: "The SPEC can be parsed.",
+			Severity:    SeverityWarning,
+			Check:       checkParse,
+		},
+		{
+			ID:          "name-directory",
+			Description: "The Name of the SPEC matches the directory it is in.",
+			Severity:    SeverityError,
+			Check:       checkNameDirectory,
+		},
+		{
+			ID:          "release-dist",
+			Description: "The Release of the SPEC ends with %{?dist}.",
+			Severity:    SeverityError,
+			Check:       checkReleaseDist,
+		},
+		{
+			ID:          "source-signatures",
+			Description: "Every Source of the SPEC has a signature in the SPEC's *.signatures.json file.",
+			Severity:    SeverityError,
+			Check:       checkSourceSignatures,
+		},
+		{
+			ID:          "buildrequires-provided",
+			Description: "Every BuildRequires of the SPEC is provided by a package built from one of the SPECs.",
+			Severity:    SeverityError,
+			Check:       checkBuildRequires,
+		},
+		{
+			ID:          "duplicate-provides",
+			Description: "No other SPEC provides the same Provides as the SPEC.",
+			Severity:    SeverityWarning,
+			Check:       checkDuplicateProvides,
+		},
+	}
+}
+
+// SelectRules returns the rules whose ID is not in disabledIDs.
+// Returns an error if one of disabledIDs does not match any rule.
+func SelectRules(rules []*Rule, disabledIDs []string) (selected []*Rule, err error) {
+	disabled := make(map[string]bool)
+	for _, id := range disabledIDs {
+		disabled[id] = true
+	}
+
+	for _, rule := range rules {
+		if disabled[rule.ID] {
+			delete(disabled, rule.ID)
+			continue
+		}
+		selected = append(selected, rule)
+	}
+
+	for id := range disabled {
+		err = fmt.Errorf("unknown rule (%s)", id)
+		return
+	}
+
+	return
+}
+
+// LoadSpecs parses every SPEC file with parser, and reads its signatures file.
+// A SPEC which can't be parsed is still returned, with ParseErr set.
+func LoadSpecs(parser *specparser.Parser, specFiles []string) (specs []*Spec) {
+	for _, specFile := range specFiles {
+		spec := &Spec{
+			Path:           specFile,
+			SignaturesPath: specsignatures.PathForSpec(specFile),
+		}
+
+		defines := rpm.DefaultDefines()
+		defines[rpm.DistTagDefine] = distTagPlaceholder
+		defines[rpm.SourceDirDefine] = filepath.Dir(specFile)
+
+		spec.Parsed, spec.ParseErr = parser.ParseFile(specFile, defines)
+		if spec.ParseErr != nil {
+			logger.Log.Debugf("Failed to parse (%s). Error: %v", specFile, spec.ParseErr)
+		} else {
+			spec.Buildable = spec.Parsed.BuildableOn(parser.Arch())
+		}
+
+		spec.Signatures, spec.SignaturesErr = specsignatures.Read(spec.SignaturesPath)
+
+		specs = append(specs, spec)
+	}
+
+	return
+}
+
+// Lint runs every rule across the SPECs.
+func Lint(specs []*Spec, rules []*Rule) (report *Report) {
+	report = &Report{SpecCount: len(specs), Findings: []*Finding{}}
+
+	for _, rule := range rules {
+		findings := rule.Check(specs)
+		logger.Log.Debugf("Rule (%s) found %d problem(s)", rule.ID, len(findings))
+
+		for _, finding := range findings {
+			finding.RuleID = rule.ID
+			finding.Severity = rule.Severity
+		}
+		report.Findings = append(report.Findings, findings...)
+	}
+
+	sort.SliceStable(report.Findings, func(i, j int) bool {
+		left, right := report.Findings[i], report.Findings[j]
+		if left.SpecPath != right.SpecPath {
+			return left.SpecPath < right.SpecPath
+		}
+		if left.RuleID != right.RuleID {
+			return left.RuleID < right.RuleID
+		}
+		return left.Message < right.Message
+	})
+
+	return
+}
+
+// Count returns the number of findings with a given severity.
+func (r *Report) Count(severity Severity) (count int) {
+	for _, finding := range r.Findings {
+		if finding.Severity == severity {
+			count++
+		}
+	}
+	return
+}
@@ -0,0 +1,192 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package speclint
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"microsoft.com/pkggen/internal/logger"
+	"microsoft.com/pkggen/internal/specparser"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitStderrLog()
+	os.Exit(m.Run())
+}
+
+const (
+	goodSpec = `Name:           good
+Version:        1.0
+Release:        1%{?dist}
+Source0:        https://example.com/%{name}-%{version}.tar.gz
+BuildRequires:  other-devel >= 2.0
+
+%description
+Good.
+`
+	otherSpec = `Name:           other
+Version:        2.1
+Release:        3%{?dist}
+Source0:        %{name}-%{version}.tar.gz
+Source1:        extra.conf
+
+%description
+Other.
+
+%package devel
+Summary:        Headers
+Provides:       shared-virtual
+
+%description devel
+Headers.
+`
+	badSpec = `Name:           misnamed
+Version:        1.0
+Release:        1
+BuildRequires:  missing
+BuildRequires:  other-devel >= 3.0
+BuildRequires:  /usr/bin/sh
+BuildRequires:  (missing or other)
+Provides:       shared-virtual
+
+%description
+Bad.
+`
+)
+
+// writeTestSpec writes a SPEC, and its signatures file if signatures is not empty, into a directory named after the SPEC.
+func writeTestSpec(t *testing.T, specsDir, name, contents, signatures string) (specFile string) {
+	specDir := filepath.Join(specsDir, name)
+	assert.NoError(t, os.MkdirAll(specDir, os.ModePerm))
+
+	specFile = filepath.Join(specDir, name+".spec")
+	assert.NoError(t, ioutil.WriteFile(specFile, []byte(contents), os.ModePerm))
+	if signatures != "" {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(specDir, name+".signatures.json"), []byte(signatures), os.ModePerm))
+	}
+	return
+}
+
+func lintTestSpecs(t *testing.T, rules []*Rule) (report *Report, specsDir string) {
+	specsDir, err := ioutil.TempDir("", "speclint")
+	assert.NoError(t, err)
+
+	specFiles := []string{
+		writeTestSpec(t, specsDir, "good", goodSpec, `{"Signatures": {"good-1.0.tar.gz": "abc"}}`),
+		writeTestSpec(t, specsDir, "other", otherSpec, `{"Signatures": {"other-2.1.tar.gz": "abc"}}`),
+		writeTestSpec(t, specsDir, "bad", badSpec, ""),
+		writeTestSpec(t, specsDir, "broken", "Name: broken\n", ""),
+	}
+
+	report = Lint(LoadSpecs(specparser.NewParser("x86_64"), specFiles), rules)
+	return
+}
+
+// findingsOf returns the findings of a rule as "<spec directory>: <message>".
+func findingsOf(report *Report, ruleID string) (findings []string) {
+	for _, finding := range report.Findings {
+		if finding.RuleID == ruleID {
+			findings = append(findings, filepath.Base(filepath.Dir(finding.SpecPath))+": "+finding.Message)
+		}
+	}
+	return
+}
+
+func TestLint(t *testing.T) {
+	report, specsDir := lintTestSpecs(t, DefaultRules())
+	defer os.RemoveAll(specsDir)
+
+	assert.Equal(t, 4, report.SpecCount)
+	assert.Equal(t, 5, report.Count(SeverityError))
+	assert.Equal(t, 3, report.Count(SeverityWarning))
+
+	// Findings are sorted by SPEC, then by rule
+	assert.Equal(t, filepath.Join(specsDir, "bad", "bad.spec"), report.Findings[0].SpecPath)
+	assert.Equal(t, "buildrequires-provided", report.Findings[0].RuleID)
+	assert.Equal(t, SeverityError, report.Findings[0].Severity)
+}
+
+func TestLintParse(t *testing.T) {
+	report, specsDir := lintTestSpecs(t, DefaultRules())
+	defer os.RemoveAll(specsDir)
+
+	findings := findingsOf(report, "parse")
+	assert.Len(t, findings, 1)
+	assert.Contains(t, findings[0], "broken: Failed to parse the SPEC")
+}
+
+func TestLintNameDirectory(t *testing.T) {
+	report, specsDir := lintTestSpecs(t, DefaultRules())
+	defer os.RemoveAll(specsDir)
+
+	assert.Equal(t, []string{"bad: Name (misnamed) does not match the SPEC's directory (bad)"}, findingsOf(report, "name-directory"))
+}
+
+func TestLintReleaseDist(t *testing.T) {
+	report, specsDir := lintTestSpecs(t, DefaultRules())
+	defer os.RemoveAll(specsDir)
+
+	assert.Equal(t, []string{"bad: Release (1) does not end with %{?dist}"}, findingsOf(report, "release-dist"))
+}
+
+func TestLintSourceSignatures(t *testing.T) {
+	report, specsDir := lintTestSpecs(t, DefaultRules())
+	defer os.RemoveAll(specsDir)
+
+	signaturesPath := filepath.Join(specsDir, "other", "other.signatures.json")
+	assert.Equal(t, []string{"other: Source (extra.conf) has no signature in (" + signaturesPath + ")"}, findingsOf(report, "source-signatures"))
+}
+
+func TestLintBuildRequires(t *testing.T) {
+	report, specsDir := lintTestSpecs(t, DefaultRules())
+	defer os.RemoveAll(specsDir)
+
+	assert.Equal(t, []string{
+		"bad: BuildRequires (missing) is not provided by any SPEC",
+		"bad: BuildRequires (other-devel >= 3.0) is not provided by any SPEC",
+	}, findingsOf(report, "buildrequires-provided"))
+}
+
+func TestLintDuplicateProvides(t *testing.T) {
+	report, specsDir := lintTestSpecs(t, DefaultRules())
+	defer os.RemoveAll(specsDir)
+
+	assert.Equal(t, []string{
+		"bad: Provides (shared-virtual) is also provided by (" + filepath.Join(specsDir, "other", "other.spec") + ")",
+		"other: Provides (shared-virtual) is also provided by (" + filepath.Join(specsDir, "bad", "bad.spec") + ")",
+	}, findingsOf(report, "duplicate-provides"))
+}
+
+func TestSelectRules(t *testing.T) {
+	rules, err := SelectRules(DefaultRules(), []string{"parse", "duplicate-provides"})
+	assert.NoError(t, err)
+	assert.Len(t, rules, len(DefaultRules())-2)
+
+	report, specsDir := lintTestSpecs(t, rules)
+	defer os.RemoveAll(specsDir)
+	assert.Empty(t, findingsOf(report, "parse"))
+	assert.Empty(t, findingsOf(report, "duplicate-provides"))
+}
+
+func TestSelectRulesShouldFailOnUnknownRule(t *testing.T) {
+	_, err := SelectRules(DefaultRules(), []string{"not-a-rule"})
+	assert.Error(t, err)
+}
+
+func TestLintCustomRule(t *testing.T) {
+	rule := &Rule{
+		ID:       "custom",
+		Severity: SeverityWarning,
+		Check: func(specs []*Spec) (findings []*Finding) {
+			return []*Finding{{SpecPath: specs[0].Path, Message: "Custom"}}
+		},
+	}
+
+	report := Lint([]*Spec{{Path: "a.spec"}}, []*Rule{rule})
+	assert.Equal(t, []*Finding{{RuleID: "custom", Severity: SeverityWarning, SpecPath: "a.spec", Message: "Custom"}}, report.Findings)
+}
@@ -0,0 +1,350 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package specparser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// exprValue is the result of evaluating an expression, either an integer or a string.
+type exprValue struct {
+	isString bool
+	str      string
+	num      int64
+}
+
+// String returns the value the way rpm prints it.
+func (v exprValue) String() string {
+	if v.isString {
+		return v.str
+	}
+	return strconv.FormatInt(v.num, 10)
+}
+
+// isTrue returns true for non-zero integers and non-empty strings.
+func (v exprValue) isTrue() bool {
+	if v.isString {
+		return v.str != ""
+	}
+	return v.num != 0
+}
+
+func numValue(num int64) exprValue {
+	return exprValue{num: num}
+}
+
+func boolValue(value bool) exprValue {
+	if value {
+		return numValue(1)
+	}
+	return numValue(0)
+}
+
+// exprParser is a recursive descent parser for the expressions used by %if and %[...].
+// The grammar follows rpm's:
+//
+//	ternary    = logicalOr [ "?" ternary ":" ternary ]
+//	logicalOr  = logicalAnd { "||" logicalAnd }
+//	logicalAnd = comparison { "&&" comparison }
+//	comparison = additive { ( "==" | "!=" | "<" | "<=" | ">" | ">=" ) additive }
+//	additive   = term { ( "+" | "-" ) term }
+//	term       = unary { ( "*" | "/" ) unary }
+//	unary      = ( "!" | "-" ) unary | primary
+//	primary    = number | string | word | "(" ternary ")"
+type exprParser struct {
+	tokens []string
+	pos    int
+}
+
+// evaluateExpression evaluates an expression which has already had its macros expanded.
+func evaluateExpression(expression string) (value exprValue, err error) {
+	tokens, err := tokenizeExpression(expression)
+	if err != nil {
+		return
+	}
+	if len(tokens) == 0 {
+		err = fmt.Errorf("empty expression")
+		return
+	}
+
+	parser := &exprParser{tokens: tokens}
+	value, err = parser.ternary()
+	if err != nil {
+		return
+	}
+
+	if parser.pos != len(parser.tokens) {
+		err = fmt.Errorf("unexpected (%s) in expression (%s)", parser.tokens[parser.pos], expression)
+	}
+	return
+}
+
+// tokenizeExpression splits an expression into numbers, quoted strings, words and operators.
+func tokenizeExpression(expression string) (tokens []string, err error) {
+	twoCharOperators := []string{"==", "!=", "<=", ">=", "&&", "||"}
+
+	for i := 0; i < len(expression); {
+		c := expression[i]
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '"':
+			end := strings.IndexByte(expression[i+1:], '"')
+			if end < 0 {
+				err = fmt.Errorf("unterminated string in expression (%s)", expression)
+				return
+			}
+			tokens = append(tokens, expression[i:i+end+2])
+			i += end + 2
+		case isNameChar(c) || c == '.':
+			start := i
+			for i < len(expression) && (isNameChar(expression[i]) || expression[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, expression[start:i])
+		default:
+			operator := ""
+			for _, candidate := range twoCharOperators {
+				if strings.HasPrefix(expression[i:], candidate) {
+					operator = candidate
+					break
+				}
+			}
+			if operator == "" {
+				if !strings.ContainsRune("!<>+-*/()?:", rune(c)) {
+					err = fmt.Errorf("unexpected character (%c) in expression (%s)", c, expression)
+					return
+				}
+				operator = string(c)
+			}
+			tokens = append(tokens, operator)
+			i += len(operator)
+		}
+	}
+
+	return
+}
+
+func (p *exprParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *exprParser) next() string {
+	token := p.peek()
+	p.pos++
+	return token
+}
+
+func (p *exprParser) ternary() (value exprValue, err error) {
+	value, err = p.logicalOr()
+	if err != nil || p.peek() != "?" {
+		return
+	}
+	p.next()
+
+	whenTrue, err := p.ternary()
+	if err != nil {
+		return
+	}
+	if p.next() != ":" {
+		err = fmt.Errorf("expected ':' in conditional expression")
+		return
+	}
+	whenFalse, err := p.ternary()
+	if err != nil {
+		return
+	}
+
+	if value.isTrue() {
+		value = whenTrue
+	} else {
+		value = whenFalse
+	}
+	return
+}
+
+func (p *exprParser) logicalOr() (value exprValue, err error) {
+	value, err = p.logicalAnd()
+	for err == nil && p.peek() == "||" {
+		p.next()
+
+		var right exprValue
+		right, err = p.logicalAnd()
+		value = boolValue(value.isTrue() || right.isTrue())
+	}
+	return
+}
+
+func (p *exprParser) logicalAnd() (value exprValue, err error) {
+	value, err = p.comparison()
+	for err == nil && p.peek() == "&&" {
+		p.next()
+
+		var right exprValue
+		right, err = p.comparison()
+		value = boolValue(value.isTrue() && right.isTrue())
+	}
+	return
+}
+
+func (p *exprParser) comparison() (value exprValue, err error) {
+	value, err = p.additive()
+	for err == nil {
+		operator := p.peek()
+		switch operator {
+		case "==", "!=", "<", "<=", ">", ">=":
+		default:
+			return
+		}
+		p.next()
+
+		var right exprValue
+		right, err = p.additive()
+		if err != nil {
+			return
+		}
+		value, err = compareValues(operator, value, right)
+	}
+	return
+}
+
+func (p *exprParser) additive() (value exprValue, err error) {
+	value, err = p.term()
+	for err == nil && (p.peek() == "+" || p.peek() == "-") {
+		operator := p.next()
+
+		var right exprValue
+		right, err = p.term()
+		if err != nil {
+			return
+		}
+
+		switch {
+		case value.isString && right.isString && operator == "+":
+			value = exprValue{isString: true, str: value.str + right.str}
+		case value.isString || right.isString:
+			err = fmt.Errorf("invalid operands for (%s)", operator)
+		case operator == "+":
+			value = numValue(value.num + right.num)
+		default:
+			value = numValue(value.num - right.num)
+		}
+	}
+	return
+}
+
+func (p *exprParser) term() (value exprValue, err error) {
+	value, err = p.unary()
+	for err == nil && (p.peek() == "*" || p.peek() == "/") {
+		operator := p.next()
+
+		var right exprValue
+		right, err = p.unary()
+		if err != nil {
+			return
+		}
+
+		switch {
+		case value.isString || right.isString:
+			err = fmt.Errorf("invalid operands for (%s)", operator)
+		case operator == "*":
+			value = numValue(value.num * right.num)
+		case right.num == 0:
+			err = fmt.Errorf("division by zero")
+		default:
+			value = numValue(value.num / right.num)
+		}
+	}
+	return
+}
+
+func (p *exprParser) unary() (value exprValue, err error) {
+	switch p.peek() {
+	case "!":
+		p.next()
+		value, err = p.unary()
+		value = boolValue(!value.isTrue())
+	case "-":
+		p.next()
+		value, err = p.unary()
+		if err == nil && value.isString {
+			err = fmt.Errorf("invalid operand for unary (-)")
+		}
+		value = numValue(-value.num)
+	default:
+		value, err = p.primary()
+	}
+	return
+}
+
+func (p *exprParser) primary() (value exprValue, err error) {
+	token := p.next()
+
+	switch {
+	case token == "":
+		err = fmt.Errorf("unexpected end of expression")
+	case token == "(":
+		value, err = p.ternary()
+		if err == nil && p.next() != ")" {
+			err = fmt.Errorf("expected ')' in expression")
+		}
+	case token[0] == '"':
+		value = exprValue{isString: true, str: token[1 : len(token)-1]}
+	case token[0] >= '0' && token[0] <= '9':
+		var num int64
+		num, err = strconv.ParseInt(token, 10, 64)
+		if err != nil {
+			err = fmt.Errorf("invalid number (%s) in expression", token)
+		}
+		value = numValue(num)
+	case isNameStart(token[0]):
+		// Older versions of rpm allowed unquoted words, treat them as strings.
+		value = exprValue{isString: true, str: token}
+	default:
+		err = fmt.Errorf("unexpected (%s) in expression", token)
+	}
+	return
+}
+
+// compareValues applies a comparison operator to two values of the same type.
+func compareValues(operator string, left, right exprValue) (result exprValue, err error) {
+	if left.isString != right.isString {
+		err = fmt.Errorf("types of (%s) and (%s) do not match for (%s)", left, right, operator)
+		return
+	}
+
+	var compared int
+	if left.isString {
+		compared = strings.Compare(left.str, right.str)
+	} else {
+		switch {
+		case left.num < right.num:
+			compared = -1
+		case left.num > right.num:
+			compared = 1
+		}
+	}
+
+	switch operator {
+	case "==":
+		result = boolValue(compared == 0)
+	case "!=":
+		result = boolValue(compared != 0)
+	case "<":
+		result = boolValue(compared < 0)
+	case "<=":
+		result = boolValue(compared <= 0)
+	case ">":
+		result = boolValue(compared > 0)
+	case ">=":
+		result = boolValue(compared >= 0)
+	}
+	return
+}
@@ -0,0 +1,69 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package specparser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvaluateExpression(t *testing.T) {
+	tests := []struct {
+		expression string
+		expected   string
+		isTrue     bool
+	}{
+		{"0", "0", false},
+		{"1", "1", true},
+		{"07", "7", true},
+		{"!0", "1", true},
+		{"!1", "0", false},
+		{"-3 + 5", "2", true},
+		{"2 * 3 - 6", "0", false},
+		{"7 / 2", "3", true},
+		{"1 && 0", "0", false},
+		{"1 || 0", "1", true},
+		{"0 && 1 || 1", "1", true},
+		{"(1 + 1) * 2", "4", true},
+		{"1 + 1 * 2", "3", true},
+		{"7 > 6", "1", true},
+		{"7 <= 6", "0", false},
+		{"0 == 0", "1", true},
+		{"0 != 0", "0", false},
+		{`"a" == "a"`, "1", true},
+		{`"a" < "b"`, "1", true},
+		{`"" != ""`, "0", false},
+		{`""`, "", false},
+		{`"text"`, "text", true},
+		{"1 ? 2 : 3", "2", true},
+		{"0 ? 2 : 0", "0", false},
+		{"x86_64", "x86_64", true},
+	}
+
+	for _, test := range tests {
+		value, err := evaluateExpression(test.expression)
+		assert.NoError(t, err, test.expression)
+		assert.Equal(t, test.expected, value.String(), test.expression)
+		assert.Equal(t, test.isTrue, value.isTrue(), test.expression)
+	}
+}
+
+func TestEvaluateInvalidExpression(t *testing.T) {
+	invalid := []string{
+		"",
+		"1 +",
+		"(1",
+		"1 2",
+		`"a" == 1`,
+		`"unterminated`,
+		"1 / 0",
+		"%{undefined}",
+	}
+
+	for _, expression := range invalid {
+		_, err := evaluateExpression(expression)
+		assert.Error(t, err, expression)
+	}
+}
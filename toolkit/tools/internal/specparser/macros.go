@@ -0,0 +1,463 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package specparser
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// maxExpansionDepth guards against self referencing macros.
+	maxExpansionDepth = 64
+)
+
+// macro is a single rpm macro definition.
+type macro struct {
+	body       string
+	parametric bool // The macro was defined with an option list, e.g. %define foo(a:) ...
+}
+
+// macroTable holds every macro defined while parsing a SPEC file.
+type macroTable map[string]*macro
+
+// clone returns a copy of the table, so definitions made while parsing a SPEC do not leak into other SPECs.
+func (m macroTable) clone() (copied macroTable) {
+	copied = make(macroTable, len(m))
+	for name, definition := range m {
+		copied[name] = definition
+	}
+	return
+}
+
+// define sets a macro to an unexpanded body.
+func (m macroTable) define(name, body string) {
+	m[name] = &macro{body: body}
+}
+
+// undefine removes a macro.
+func (m macroTable) undefine(name string) {
+	delete(m, name)
+}
+
+// isDefined returns true if a macro is defined.
+func (m macroTable) isDefined(name string) bool {
+	_, found := m[name]
+	return found
+}
+
+// defineFromLine parses the arguments of a %define or %global line, or of a line from a macro file,
+// such as "name(opts) body" and defines the macro. If expandNow is set the body is expanded before
+// being stored, matching the behavior of %global.
+func (m macroTable) defineFromLine(definition string, expandNow bool) (err error) {
+	definition = strings.TrimSpace(definition)
+
+	nameEnd := 0
+	for nameEnd < len(definition) && isNameChar(definition[nameEnd]) {
+		nameEnd++
+	}
+	name := definition[:nameEnd]
+	if name == "" {
+		return fmt.Errorf("invalid macro definition (%s)", definition)
+	}
+
+	rest := definition[nameEnd:]
+	parametric := strings.HasPrefix(rest, "(")
+	if parametric {
+		optionsEnd := strings.Index(rest, ")")
+		if optionsEnd < 0 {
+			return fmt.Errorf("unterminated option list in macro definition (%s)", definition)
+		}
+		rest = rest[optionsEnd+1:]
+	}
+
+	body := strings.TrimSpace(rest)
+	if expandNow && !parametric {
+		expanded, expandErr := m.expand(body)
+		// Bodies which can't be expanded (such as shell commands) are stored unexpanded,
+		// they only cause an error if they are used by a tag the parser cares about.
+		if expandErr == nil {
+			body = expanded
+		}
+	}
+
+	m[name] = &macro{body: body, parametric: parametric}
+	return
+}
+
+// loadFile defines every macro found in an rpm macro file.
+func (m macroTable) loadFile(macroFile string) (err error) {
+	contents, err := ioutil.ReadFile(macroFile)
+	if err != nil {
+		return
+	}
+
+	for _, line := range joinContinuedLines(strings.Split(string(contents), "\n")) {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "%") {
+			continue
+		}
+
+		err = m.defineFromLine(line[1:], false)
+		if err != nil {
+			return fmt.Errorf("%s: %v", macroFile, err)
+		}
+	}
+
+	return
+}
+
+// expand expands every macro in a string.
+func (m macroTable) expand(input string) (output string, err error) {
+	return m.expandDepth(input, 0)
+}
+
+func (m macroTable) expandDepth(input string, depth int) (output string, err error) {
+	if depth > maxExpansionDepth {
+		err = fmt.Errorf("macro expansion of (%s) is too deeply nested", input)
+		return
+	}
+
+	// Most strings contain no macros at all, avoid building a new string for them.
+	if !strings.Contains(input, "%") {
+		return input, nil
+	}
+
+	var builder strings.Builder
+	for i := 0; i < len(input); {
+		if input[i] != '%' || i+1 == len(input) {
+			builder.WriteByte(input[i])
+			i++
+			continue
+		}
+
+		var (
+			expanded string
+			consumed int
+		)
+
+		switch next := input[i+1]; {
+		case next == '%':
+			expanded, consumed = "%", 2
+		case next == '{':
+			end := matchingClose(input, i+1)
+			if end < 0 {
+				err = fmt.Errorf("unterminated macro in (%s)", input)
+				return
+			}
+			expanded, err = m.expandBraced(input[i+2:end], depth)
+			consumed = end + 1 - i
+		case next == '[':
+			end := matchingClose(input, i+1)
+			if end < 0 {
+				err = fmt.Errorf("unterminated expression in (%s)", input)
+				return
+			}
+			expanded, err = m.expandExpression(input[i+2:end], depth)
+			consumed = end + 1 - i
+		case next == '(':
+			err = fmt.Errorf("shell expansion is not supported (%s)", input[i:])
+		case next == '?' || next == '!' || isNameStart(next):
+			expanded, consumed, err = m.expandBare(input[i:], depth)
+		default:
+			expanded, consumed = "%", 1
+		}
+
+		if err != nil {
+			return
+		}
+
+		builder.WriteString(expanded)
+		i += consumed
+	}
+
+	output = builder.String()
+	return
+}
+
+// expandBare expands a macro written without braces, such as %name, %?name or %!?name.
+// Returns the expansion and the number of characters of input it consumed.
+func (m macroTable) expandBare(input string, depth int) (expanded string, consumed int, err error) {
+	negate, conditional := false, false
+
+	i := 1
+	for ; i < len(input) && (input[i] == '!' || input[i] == '?'); i++ {
+		if input[i] == '!' {
+			negate = !negate
+		} else {
+			conditional = true
+		}
+	}
+
+	nameStart := i
+	for i < len(input) && isNameChar(input[i]) {
+		i++
+	}
+	name := input[nameStart:i]
+	consumed = i
+
+	if name == "" {
+		expanded, consumed = "%", 1
+		return
+	}
+
+	// Macros may also be defined inline, e.g. %{!?foo: %global foo bar}. The definition runs to the end of the line.
+	if !conditional && (name == "define" || name == "global" || name == "undefine") {
+		arguments := input[consumed:]
+		if end := strings.IndexByte(arguments, '\n'); end >= 0 {
+			arguments = arguments[:end]
+		}
+		consumed += len(arguments)
+
+		if name == "undefine" {
+			m.undefine(strings.TrimSpace(arguments))
+		} else {
+			err = m.defineFromLine(arguments, name == "global")
+		}
+		return
+	}
+
+	definition, defined := m[name]
+	switch {
+	case conditional && negate:
+		expanded = ""
+	case conditional && !defined:
+		expanded = ""
+	case !defined:
+		expanded = input[:consumed]
+	default:
+		expanded, err = m.expandDepth(definition.body, depth+1)
+	}
+
+	return
+}
+
+// expandBraced expands the contents of a %{...} macro.
+func (m macroTable) expandBraced(inner string, depth int) (expanded string, err error) {
+	negate, conditional := false, false
+
+	i := 0
+	for ; i < len(inner) && (inner[i] == '!' || inner[i] == '?'); i++ {
+		if inner[i] == '!' {
+			negate = !negate
+		} else {
+			conditional = true
+		}
+	}
+	body := inner[i:]
+
+	if conditional {
+		name, alternative, hasAlternative := splitOnce(body, ":")
+		defined := m.isDefined(name)
+
+		switch {
+		case negate && !defined && hasAlternative:
+			return m.expandDepth(alternative, depth+1)
+		case negate:
+			return "", nil
+		case !defined:
+			return "", nil
+		case hasAlternative:
+			return m.expandDepth(alternative, depth+1)
+		default:
+			return m.expandDepth(m[name].body, depth+1)
+		}
+	}
+
+	if definition, found := m[body]; found {
+		return m.expandDepth(definition.body, depth+1)
+	}
+
+	if expanded, handled, builtinErr := m.expandBuiltin(body, depth); handled {
+		return expanded, builtinErr
+	}
+
+	// Undefined macros are left as is, the same as rpm does.
+	expanded = "%{" + inner + "}"
+	return
+}
+
+// expandBuiltin handles rpm's builtin macros, such as %{expand:...} and %{with foo}.
+// handled is false if body is not a supported builtin.
+func (m macroTable) expandBuiltin(body string, depth int) (expanded string, handled bool, err error) {
+	if name, argument, found := splitOnce(body, " "); found {
+		argument = strings.TrimSpace(argument)
+		handled = true
+
+		switch name {
+		case "with":
+			expanded = boolString(m.isDefined("with_" + argument))
+		case "without":
+			expanded = boolString(m.isDefined("without_" + argument))
+		case "defined":
+			expanded = boolString(m.isDefined(argument))
+		case "undefined":
+			expanded = boolString(!m.isDefined(argument))
+		default:
+			handled = false
+		}
+
+		if handled {
+			return
+		}
+	}
+
+	name, argument, found := splitOnce(body, ":")
+	if !found {
+		return
+	}
+
+	handled = true
+	switch name {
+	case "lua":
+		err = fmt.Errorf("lua macros are not supported (%%{%s})", body)
+		return
+	case "expr":
+		expanded, err = m.expandExpression(argument, depth)
+		return
+	case "S":
+		expanded, err = m.expandDepth("%{SOURCE"+argument+"}", depth+1)
+		return
+	case "P":
+		expanded, err = m.expandDepth("%{PATCH"+argument+"}", depth+1)
+		return
+	}
+
+	argument, err = m.expandDepth(argument, depth+1)
+	if err != nil {
+		return
+	}
+
+	switch name {
+	case "expand":
+		expanded, err = m.expandDepth(argument, depth+1)
+	case "basename":
+		expanded = path.Base(argument)
+	case "dirname":
+		expanded = path.Dir(argument)
+	case "suffix":
+		expanded = strings.TrimPrefix(filepath.Ext(argument), ".")
+	case "lower":
+		expanded = strings.ToLower(argument)
+	case "upper":
+		expanded = strings.ToUpper(argument)
+	case "shrink":
+		expanded = strings.Join(strings.Fields(argument), " ")
+	case "quote":
+		expanded = argument
+	case "url2path", "u2p":
+		expanded = urlToPath(argument)
+	case "echo", "warn", "verbose", "getenv":
+		expanded = ""
+	case "error":
+		err = fmt.Errorf("spec raised an error: %s", argument)
+	default:
+		handled = false
+	}
+
+	return
+}
+
+// expandExpression evaluates a %[...] or %{expr:...} expression.
+func (m macroTable) expandExpression(expression string, depth int) (result string, err error) {
+	expression, err = m.expandDepth(expression, depth+1)
+	if err != nil {
+		return
+	}
+
+	value, err := evaluateExpression(expression)
+	if err != nil {
+		return
+	}
+
+	result = value.String()
+	return
+}
+
+// joinContinuedLines joins lines ending with a backslash with the line after them.
+func joinContinuedLines(lines []string) (joined []string) {
+	var current strings.Builder
+	continuing := false
+
+	for _, line := range lines {
+		trimmed := strings.TrimRight(line, " \t\r")
+		if strings.HasSuffix(trimmed, `\`) {
+			current.WriteString(strings.TrimSuffix(trimmed, `\`))
+			current.WriteString("\n")
+			continuing = true
+			continue
+		}
+
+		current.WriteString(line)
+		joined = append(joined, current.String())
+		current.Reset()
+		continuing = false
+	}
+
+	if continuing {
+		joined = append(joined, current.String())
+	}
+
+	return
+}
+
+// matchingClose returns the index of the bracket closing the one at input[open], or -1 if there is none.
+func matchingClose(input string, open int) int {
+	openChar := input[open]
+	closeChar := map[byte]byte{'{': '}', '[': ']', '(': ')'}[openChar]
+
+	level := 0
+	for i := open; i < len(input); i++ {
+		switch input[i] {
+		case openChar:
+			level++
+		case closeChar:
+			level--
+			if level == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// splitOnce splits a string around the first instance of sep.
+func splitOnce(input, sep string) (before, after string, found bool) {
+	index := strings.Index(input, sep)
+	if index < 0 {
+		return input, "", false
+	}
+	return input[:index], input[index+len(sep):], true
+}
+
+// urlToPath returns the path component of a URL, or the input if it is not a URL.
+func urlToPath(url string) string {
+	_, rest, found := splitOnce(url, "://")
+	if !found {
+		return url
+	}
+	_, urlPath, found := splitOnce(rest, "/")
+	if !found {
+		return "/"
+	}
+	return "/" + urlPath
+}
+
+func boolString(value bool) string {
+	if value {
+		return "1"
+	}
+	return "0"
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || (c >= '0' && c <= '9')
+}
@@ -0,0 +1,134 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package specparser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testMacros() macroTable {
+	macros := make(macroTable)
+	macros.define("name", "foo")
+	macros.define("version", "1.2.3")
+	macros.define("dist", ".cm1")
+	macros.define("nested", "%{name}-%{version}")
+	macros.define("empty", "")
+	return macros
+}
+
+func TestExpandMacros(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"no macros", "no macros"},
+		{"%{name}", "foo"},
+		{"%name-%version", "foo-1.2.3"},
+		{"%{nested}", "foo-1.2.3"},
+		{"1%{?dist}", "1.cm1"},
+		{"1%{?missing}", "1"},
+		{"1%?dist", "1.cm1"},
+		{"%{?dist:yes}", "yes"},
+		{"%{?missing:yes}", ""},
+		{"%{!?missing:no}", "no"},
+		{"%{!?dist:no}", ""},
+		{"%{?empty:set}", "set"},
+		{"%{undefined_macro}", "%{undefined_macro}"},
+		{"%undefined_macro", "%undefined_macro"},
+		{"100%%", "100%"},
+		{"%{expand:%%{name}}", "foo"},
+		{"%{basename:/a/b/c.tar.gz}", "c.tar.gz"},
+		{"%{dirname:/a/b/c.tar.gz}", "/a/b"},
+		{"%{upper:%{name}}", "FOO"},
+		{"%[1 + 2]", "3"},
+		{"%{expr:2 * 3}", "6"},
+		{"%{defined name} %{undefined name}", "1 0"},
+	}
+
+	macros := testMacros()
+	for _, test := range tests {
+		expanded, err := macros.expand(test.input)
+		assert.NoError(t, err, test.input)
+		assert.Equal(t, test.expected, expanded, test.input)
+	}
+}
+
+func TestExpandUnsupportedMacros(t *testing.T) {
+	macros := testMacros()
+
+	_, err := macros.expand("%(echo foo)")
+	assert.Error(t, err)
+
+	_, err = macros.expand("%{lua: print('foo')}")
+	assert.Error(t, err)
+
+	_, err = macros.expand("%{name")
+	assert.Error(t, err)
+}
+
+func TestExpandSelfReferencingMacro(t *testing.T) {
+	macros := testMacros()
+	macros.define("loop", "%{loop}")
+
+	_, err := macros.expand("%{loop}")
+	assert.Error(t, err)
+}
+
+func TestDefineIsLazyGlobalIsNot(t *testing.T) {
+	macros := testMacros()
+
+	assert.NoError(t, macros.defineFromLine("lazy %{version}", false))
+	assert.NoError(t, macros.defineFromLine("eager %{version}", true))
+	macros.define("version", "2.0")
+
+	lazy, err := macros.expand("%{lazy}")
+	assert.NoError(t, err)
+	assert.Equal(t, "2.0", lazy)
+
+	eager, err := macros.expand("%{eager}")
+	assert.NoError(t, err)
+	assert.Equal(t, "1.2.3", eager)
+}
+
+func TestInlineDefinition(t *testing.T) {
+	macros := testMacros()
+
+	expanded, err := macros.expand("%{!?python3_sitelib: %global python3_sitelib /usr/lib/python3}")
+	assert.NoError(t, err)
+	assert.Equal(t, " ", expanded)
+
+	sitelib, err := macros.expand("%{python3_sitelib}")
+	assert.NoError(t, err)
+	assert.Equal(t, "/usr/lib/python3", sitelib)
+}
+
+func TestGlobalWithShellIsStoredUnexpanded(t *testing.T) {
+	macros := testMacros()
+
+	assert.NoError(t, macros.defineFromLine("majmin %(echo %{version} | cut -d. -f1-2)", true))
+	assert.True(t, macros.isDefined("majmin"))
+
+	_, err := macros.expand("%{majmin}")
+	assert.Error(t, err)
+}
+
+func TestParametricMacroDefinition(t *testing.T) {
+	macros := testMacros()
+
+	assert.NoError(t, macros.defineFromLine("with_args(a:b) -a %{-a*}", true))
+	assert.True(t, macros["with_args"].parametric)
+	assert.Equal(t, "-a %{-a*}", macros["with_args"].body)
+}
+
+func TestJoinContinuedLines(t *testing.T) {
+	lines := []string{
+		`%first one \`,
+		`two`,
+		`%second three`,
+	}
+
+	assert.Equal(t, []string{"%first one \ntwo", "%second three"}, joinContinuedLines(lines))
+}
@@ -0,0 +1,792 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+// Package specparser extracts package information from SPEC files without invoking rpm.
+//
+// Only the subset of rpm's macro language commonly used in SPEC preambles is supported:
+// %define, %global, %undefine, %bcond_with(out), conditional macros such as %{?dist},
+// %if/%ifarch/%ifnarch/%elif/%else/%endif blocks, %include, and the %package sections.
+// Shell (%(...)) and lua macros are not evaluated, a SPEC which needs one to compute a
+// tag the parser reads fails to parse.
+package specparser
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"microsoft.com/pkggen/internal/rpm"
+)
+
+const (
+	// NoArch is the architecture of packages which do not depend on the machine architecture.
+	NoArch = rpm.NoArch
+
+	defaultShell = "/bin/sh"
+	luaPrefix    = "<lua>"
+)
+
+var (
+	// Preamble lines are formatted as "Tag: value" or "Tag(qualifier): value"
+	tagRegex = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9]*)\s*(\([^)]*\))?\s*:\s*(.*)$`)
+
+	// Sections which end the preamble of the previous section.
+	sectionKeywords = map[string]bool{
+		"package": true, "description": true, "prep": true, "build": true, "install": true, "check": true,
+		"clean": true, "files": true, "changelog": true, "conf": true, "generate_buildrequires": true,
+		"sepolicy": true, "patchlist": true, "sourcelist": true,
+		"pre": true, "post": true, "preun": true, "postun": true, "pretrans": true, "posttrans": true, "verifyscript": true,
+		"triggerprein": true, "triggerin": true, "triggerun": true, "triggerpostun": true,
+		"filetriggerin": true, "filetriggerun": true, "filetriggerpostun": true,
+		"transfiletriggerin": true, "transfiletriggerun": true, "transfiletriggerpostun": true,
+	}
+
+	// Sections which hold a scriptlet, rpm adds a dependency on the scriptlet's interpreter to the package.
+	scriptletSections = map[string]bool{
+		"pre": true, "post": true, "preun": true, "postun": true, "pretrans": true, "posttrans": true, "verifyscript": true,
+		"triggerprein": true, "triggerin": true, "triggerun": true, "triggerpostun": true,
+		"filetriggerin": true, "filetriggerun": true, "filetriggerpostun": true,
+		"transfiletriggerin": true, "transfiletriggerun": true, "transfiletriggerpostun": true,
+	}
+
+	// Section options which take a value.
+	sectionOptionsWithValue = map[string]bool{"-p": true, "-f": true, "-P": true}
+
+	// Architecture aliases rpm defines for use in %ifarch and ExclusiveArch.
+	archMacros = map[string]string{
+		"ix86":   "i386 i486 i586 i686 pentium3 pentium4 athlon geode",
+		"arm":    "armv3l armv4b armv4l armv4tl armv5tl armv5tel armv5tejl armv6l armv6hl armv7l armv7hl armv7hnl",
+		"arm64":  "aarch64",
+		"x86_64": "x86_64 amd64 em64t",
+	}
+
+	// ISA names used for the %{_isa} suffix of architecture specific provides, e.g. foo(x86-64).
+	isaNames = map[string]string{
+		"x86_64":  "x86-64",
+		"aarch64": "aarch-64",
+	}
+)
+
+// Package is a binary package produced by a SPEC.
+type Package struct {
+	Name     string   // Full name of the package
+	Arch     string   // Architecture of the package, either the build architecture or NoArch
+	Provides []string // Dependencies the package provides, including the implicit "name = EVR"
+	Requires []string // Dependencies the package requires, including scriptlet interpreters
+}
+
+// Spec is the information extracted from a SPEC file.
+type Spec struct {
+	Name          string
+	Epoch         string
+	Version       string
+	Release       string
+	BuildRequires []string
+	Sources       []string // File names of the Source tags, in the order they appear
+	ExclusiveArch []string
+	ExcludeArch   []string
+	Packages      []*Package // The main package is always first
+}
+
+// EVR returns the [epoch:]version-release of the SPEC.
+func (s *Spec) EVR() string {
+	if s.Epoch != "" {
+		return fmt.Sprintf("%s:%s-%s", s.Epoch, s.Version, s.Release)
+	}
+	return fmt.Sprintf("%s-%s", s.Version, s.Release)
+}
+
+// SrpmName returns the file name of the SRPM the SPEC produces.
+func (s *Spec) SrpmName() string {
+	return fmt.Sprintf("%s-%s-%s.src.rpm", s.Name, s.Version, s.Release)
+}
+
+// BuildableOn returns true if the SPEC's ExclusiveArch and ExcludeArch tags allow it to be built for arch.
+func (s *Spec) BuildableOn(arch string) bool {
+	return rpm.ArchAllowed(arch, s.ExclusiveArch, s.ExcludeArch)
+}
+
+// Parser parses SPEC files for a single build architecture.
+// A Parser is safe to use concurrently once its macros have been set up.
+type Parser struct {
+	arch   string
+	macros macroTable
+}
+
+// NewParser creates a parser which evaluates SPEC files as if they were built on arch.
+func NewParser(arch string) (parser *Parser) {
+	parser = &Parser{
+		arch:   arch,
+		macros: make(macroTable),
+	}
+
+	parser.macros.define("nil", "")
+	parser.macros.define("_arch", arch)
+	parser.macros.define("_target_cpu", arch)
+	parser.macros.define("_build_arch", arch)
+	parser.macros.define("_os", "linux")
+	parser.macros.define("_target_os", "linux")
+	for name, value := range archMacros {
+		parser.macros.define(name, value)
+	}
+	if isaName, found := isaNames[arch]; found {
+		parser.macros.define("_isa", fmt.Sprintf("(%s)", isaName))
+	}
+
+	return
+}
+
+// Arch returns the architecture the parser evaluates SPEC files for.
+func (p *Parser) Arch() string {
+	return p.arch
+}
+
+// Define sets a macro for every SPEC parsed, the same as passing "-D 'name value'" to rpm.
+func (p *Parser) Define(name, value string) {
+	p.macros.define(name, value)
+}
+
+// LoadMacroFile defines every macro found in an rpm macro file.
+func (p *Parser) LoadMacroFile(macroFile string) (err error) {
+	return p.macros.loadFile(macroFile)
+}
+
+// LoadMacroDir loads the macro files found in an rpm configuration directory (i.e. one set as RPM_CONFIGDIR),
+// in the same order rpm does: macros, macros.d/macros.*, then the macros of the build architecture's platform.
+func (p *Parser) LoadMacroDir(macroDir string) (err error) {
+	macroFiles := []string{filepath.Join(macroDir, "macros")}
+
+	dropInFiles, err := filepath.Glob(filepath.Join(macroDir, "macros.d", "macros.*"))
+	if err != nil {
+		return
+	}
+	macroFiles = append(macroFiles, dropInFiles...)
+	macroFiles = append(macroFiles, filepath.Join(macroDir, "platform", fmt.Sprintf("%s-linux", p.arch), "macros"))
+
+	for _, macroFile := range macroFiles {
+		if _, statErr := os.Stat(macroFile); statErr != nil {
+			continue
+		}
+
+		err = p.LoadMacroFile(macroFile)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// ParseFile parses a SPEC file. defines are set in addition to the parser's macros,
+// the same as passing "-D 'name value'" to rpm.
+func (p *Parser) ParseFile(specFile string, defines map[string]string) (spec *Spec, err error) {
+	lines, err := readLines(specFile)
+	if err != nil {
+		return
+	}
+
+	state := &parseState{
+		arch:     p.arch,
+		specFile: specFile,
+		specDir:  filepath.Dir(specFile),
+		macros:   p.macros.clone(),
+		spec:     &Spec{},
+		section:  preambleSection,
+	}
+	for name, value := range defines {
+		state.macros.define(name, value)
+	}
+
+	err = state.parseLines(lines)
+	if err != nil {
+		return
+	}
+
+	err = state.finish()
+	if err != nil {
+		return
+	}
+
+	spec = state.spec
+	return
+}
+
+// SplitDependencies splits the value of a dependency tag such as "foo >= 1.0, bar" into individual dependencies.
+// Rich dependencies, e.g. "(foo or bar)", are kept as a single dependency.
+func SplitDependencies(value string) (dependencies []string) {
+	var tokens []string
+
+	for i := 0; i < len(value); {
+		c := value[i]
+		switch {
+		case c == ' ' || c == '\t' || c == ',':
+			i++
+		case c == '(':
+			end := matchingClose(value, i)
+			if end < 0 {
+				end = len(value) - 1
+			}
+			tokens = append(tokens, value[i:end+1])
+			i = end + 1
+		case isOperatorChar(c):
+			start := i
+			for i < len(value) && isOperatorChar(value[i]) {
+				i++
+			}
+			tokens = append(tokens, value[start:i])
+		default:
+			start := i
+			for i < len(value) && !strings.ContainsRune(" \t,", rune(value[i])) && !isOperatorChar(value[i]) {
+				// Dependencies such as "perl(Foo::Bar)" contain parentheses
+				if value[i] == '(' {
+					if end := matchingClose(value, i); end > 0 {
+						i = end
+					}
+				}
+				i++
+			}
+			tokens = append(tokens, value[start:i])
+		}
+	}
+
+	for i := 0; i < len(tokens); i++ {
+		if i+2 < len(tokens) && isOperatorChar(tokens[i+1][0]) {
+			operator := tokens[i+1]
+			if operator == "==" {
+				operator = "="
+			}
+			dependencies = append(dependencies, fmt.Sprintf("%s %s %s", tokens[i], operator, tokens[i+2]))
+			i += 2
+			continue
+		}
+		dependencies = append(dependencies, tokens[i])
+	}
+
+	return
+}
+
+const (
+	preambleSection = "preamble"
+	otherSection    = ""
+)
+
+// conditionalFrame tracks a single %if block.
+type conditionalFrame struct {
+	parentActive bool // The block containing this %if is being parsed
+	active       bool // The current branch of this %if is being parsed
+	taken        bool // A branch of this %if has already been parsed
+}
+
+// parseState is the state of a single SPEC being parsed.
+type parseState struct {
+	arch     string
+	specFile string
+	specDir  string
+	macros   macroTable
+	spec     *Spec
+
+	section      string
+	pkg          *Package // The package the current section applies to
+	mainArch     string   // BuildArch of the main package, inherited by sub-packages
+	packageArchs map[*Package]string
+	conditionals []*conditionalFrame
+	lineNumber   int
+}
+
+// active returns true if the current line is not inside a false %if branch.
+func (s *parseState) active() bool {
+	if len(s.conditionals) == 0 {
+		return true
+	}
+	return s.conditionals[len(s.conditionals)-1].active
+}
+
+func (s *parseState) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%s:%d: %s", s.specFile, s.lineNumber, fmt.Sprintf(format, args...))
+}
+
+func (s *parseState) parseLines(lines []string) (err error) {
+	for i := 0; i < len(lines); i++ {
+		s.lineNumber = i + 1
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		keyword, arguments := splitKeyword(trimmed)
+
+		handled, condErr := s.handleConditional(keyword, arguments)
+		if condErr != nil {
+			return condErr
+		}
+		if handled || !s.active() {
+			continue
+		}
+
+		// Macro definitions may span several lines
+		if keyword == "define" || keyword == "global" {
+			for strings.HasSuffix(strings.TrimRight(line, " \t"), `\`) && i+1 < len(lines) {
+				i++
+				line = strings.TrimSuffix(strings.TrimRight(line, " \t"), `\`) + "\n" + lines[i]
+			}
+			_, arguments = splitKeyword(strings.TrimSpace(line))
+		}
+
+		switch {
+		case keyword == "define" || keyword == "global":
+			err = s.macros.defineFromLine(arguments, keyword == "global")
+		case keyword == "undefine":
+			s.macros.undefine(strings.TrimSpace(arguments))
+		case keyword == "bcond_with":
+			s.defineBuildCondition(strings.TrimSpace(arguments), false)
+		case keyword == "bcond_without":
+			s.defineBuildCondition(strings.TrimSpace(arguments), true)
+		case keyword == "include":
+			var included []string
+			included, err = s.readInclude(arguments)
+			if err == nil {
+				lines = append(lines[:i+1], append(included, lines[i+1:]...)...)
+			}
+		case keyword == "dnl":
+		case sectionKeywords[keyword]:
+			err = s.startSection(keyword, arguments)
+		case s.section == preambleSection || s.section == "package":
+			err = s.parsePreambleLine(trimmed)
+		}
+
+		if err != nil {
+			return
+		}
+	}
+
+	if len(s.conditionals) != 0 {
+		return s.errorf("missing %%endif")
+	}
+	return
+}
+
+// handleConditional processes %if, %ifarch, %ifnarch, %ifos, %ifnos, %elif*, %else and %endif lines.
+func (s *parseState) handleConditional(keyword, arguments string) (handled bool, err error) {
+	switch keyword {
+	case "if", "ifarch", "ifnarch", "ifos", "ifnos":
+		frame := &conditionalFrame{parentActive: s.active()}
+		if frame.parentActive {
+			frame.active, err = s.evaluateCondition(keyword, arguments)
+			frame.taken = frame.active
+		}
+		s.conditionals = append(s.conditionals, frame)
+	case "elif", "elifarch", "elifnarch", "elifos", "elifnos":
+		if len(s.conditionals) == 0 {
+			return true, s.errorf("%%%s without %%if", keyword)
+		}
+		frame := s.conditionals[len(s.conditionals)-1]
+		frame.active = false
+		if frame.parentActive && !frame.taken {
+			frame.active, err = s.evaluateCondition(strings.Replace(keyword, "elif", "if", 1), arguments)
+			frame.taken = frame.active
+		}
+	case "else":
+		if len(s.conditionals) == 0 {
+			return true, s.errorf("%%else without %%if")
+		}
+		frame := s.conditionals[len(s.conditionals)-1]
+		frame.active = frame.parentActive && !frame.taken
+		frame.taken = true
+	case "endif":
+		if len(s.conditionals) == 0 {
+			return true, s.errorf("%%endif without %%if")
+		}
+		s.conditionals = s.conditionals[:len(s.conditionals)-1]
+	default:
+		return false, nil
+	}
+
+	return true, err
+}
+
+// evaluateCondition evaluates the arguments of an %if style line.
+func (s *parseState) evaluateCondition(keyword, arguments string) (result bool, err error) {
+	expanded, err := s.macros.expand(arguments)
+	if err != nil {
+		return false, s.errorf("%v", err)
+	}
+
+	switch keyword {
+	case "ifarch", "ifnarch":
+		result = contains(splitList(expanded), s.arch)
+		if keyword == "ifnarch" {
+			result = !result
+		}
+	case "ifos", "ifnos":
+		result = contains(splitList(expanded), "linux")
+		if keyword == "ifnos" {
+			result = !result
+		}
+	default:
+		var value exprValue
+		value, err = evaluateExpression(expanded)
+		if err != nil {
+			return false, s.errorf("%v", err)
+		}
+		result = value.isTrue()
+	}
+
+	return
+}
+
+// defineBuildCondition implements %bcond_with and %bcond_without, which enable an optional feature
+// if "--with <name>" (or "--without <name>") is passed to rpmbuild.
+func (s *parseState) defineBuildCondition(name string, enabledByDefault bool) {
+	switch {
+	case enabledByDefault && !s.macros.isDefined("_without_"+name):
+		s.macros.define("with_"+name, "1")
+	case enabledByDefault:
+		s.macros.define("without_"+name, "1")
+	case s.macros.isDefined("_with_" + name):
+		s.macros.define("with_"+name, "1")
+	default:
+		s.macros.define("without_"+name, "1")
+	}
+}
+
+// readInclude reads the lines of a file included with %include.
+func (s *parseState) readInclude(arguments string) (lines []string, err error) {
+	includePath, err := s.macros.expand(strings.TrimSpace(arguments))
+	if err != nil {
+		return nil, s.errorf("%v", err)
+	}
+	if !filepath.IsAbs(includePath) {
+		includePath = filepath.Join(s.specDir, includePath)
+	}
+
+	lines, err = readLines(includePath)
+	if err != nil {
+		err = s.errorf("failed to include (%s): %v", includePath, err)
+	}
+	return
+}
+
+// startSection handles the line starting a new section, e.g. "%package -n foo" or "%post -p /sbin/ldconfig".
+func (s *parseState) startSection(keyword, arguments string) (err error) {
+	expanded, err := s.macros.expand(arguments)
+	if err != nil {
+		return s.errorf("%v", err)
+	}
+
+	name, absoluteName, interpreter := parseSectionArguments(expanded)
+	s.section = keyword
+
+	if keyword == "package" {
+		if name == "" {
+			return s.errorf("%%package without a name")
+		}
+		s.pkg = s.addPackage(s.packageName(name, absoluteName))
+		return
+	}
+
+	if !scriptletSections[keyword] {
+		return
+	}
+
+	// rpm adds a dependency on the interpreter of every scriptlet
+	pkg := s.findPackage(s.packageName(name, absoluteName))
+	if pkg == nil {
+		return s.errorf("%%%s refers to unknown package (%s)", keyword, s.packageName(name, absoluteName))
+	}
+	if interpreter == "" {
+		interpreter = defaultShell
+	}
+	if !strings.HasPrefix(interpreter, luaPrefix) {
+		pkg.Requires = appendUnique(pkg.Requires, interpreter)
+	}
+
+	return
+}
+
+// parsePreambleLine handles a "Tag: value" line in the preamble of the main package or a %package section.
+func (s *parseState) parsePreambleLine(line string) (err error) {
+	if line == "" || strings.HasPrefix(line, "#") {
+		return
+	}
+
+	// Lines made entirely of macros may expand to several tags, e.g. %{?systemd_requires}
+	if !tagRegex.MatchString(line) {
+		expanded, expandErr := s.macros.expand(line)
+		if expandErr != nil {
+			return s.errorf("%v", expandErr)
+		}
+		for _, expandedLine := range strings.Split(expanded, "\n") {
+			expandedLine = strings.TrimSpace(expandedLine)
+			if tagRegex.MatchString(expandedLine) {
+				err = s.parseTag(expandedLine)
+				if err != nil {
+					return
+				}
+			}
+		}
+		return
+	}
+
+	return s.parseTag(line)
+}
+
+// parseTag records the value of a single preamble tag.
+func (s *parseState) parseTag(line string) (err error) {
+	const (
+		tagField   = 1
+		valueField = 3
+	)
+
+	matches := tagRegex.FindStringSubmatch(line)
+	tag := strings.ToLower(matches[tagField])
+
+	value, expandErr := s.macros.expand(matches[valueField])
+	if expandErr != nil {
+		// Tags the parser does not use are allowed to contain macros it can't expand.
+		if !isUsedTag(tag) {
+			return
+		}
+		return s.errorf("failed to expand (%s): %v", matches[tagField], expandErr)
+	}
+	value = strings.TrimSpace(value)
+
+	if s.section == preambleSection && s.pkg == nil && tag != "name" && isPackageTag(tag) {
+		return s.errorf("tag (%s) appears before the Name tag", matches[tagField])
+	}
+
+	switch {
+	case tag == "name":
+		if s.section != preambleSection {
+			return s.errorf("the Name tag may only appear in the main preamble")
+		}
+		s.spec.Name = value
+		s.macros.define("name", value)
+		s.pkg = s.addPackage(value)
+	case tag == "version":
+		s.spec.Version = value
+		s.macros.define("version", value)
+	case tag == "release":
+		s.spec.Release = value
+		s.macros.define("release", value)
+	case tag == "epoch":
+		s.spec.Epoch = value
+		s.macros.define("epoch", value)
+	case tag == "buildrequires" || tag == "buildprereq":
+		s.spec.BuildRequires = append(s.spec.BuildRequires, SplitDependencies(value)...)
+	case tag == "requires" || tag == "prereq":
+		s.pkg.Requires = append(s.pkg.Requires, SplitDependencies(value)...)
+	case tag == "provides":
+		s.pkg.Provides = append(s.pkg.Provides, SplitDependencies(value)...)
+	case tag == "buildarch" || tag == "buildarchitectures":
+		archs := splitList(value)
+		if len(archs) == 0 {
+			return
+		}
+		if s.section == preambleSection {
+			s.mainArch = archs[0]
+		}
+		s.packageArchs[s.pkg] = archs[0]
+	case tag == "exclusivearch":
+		s.spec.ExclusiveArch = append(s.spec.ExclusiveArch, splitList(value)...)
+	case tag == "excludearch":
+		s.spec.ExcludeArch = append(s.spec.ExcludeArch, splitList(value)...)
+	case strings.HasPrefix(tag, "source") || strings.HasPrefix(tag, "patch"):
+		s.defineSourceMacro(matches[tagField], value)
+		if strings.HasPrefix(tag, "source") {
+			s.spec.Sources = append(s.spec.Sources, filepath.Base(urlToPath(value)))
+		}
+	}
+
+	return
+}
+
+// defineSourceMacro defines %{SOURCEn} or %{PATCHn} for a SourceN or PatchN tag.
+func (s *parseState) defineSourceMacro(tag, value string) {
+	upperTag := strings.ToUpper(tag)
+	prefix := "SOURCE"
+	if strings.HasPrefix(upperTag, "PATCH") {
+		prefix = "PATCH"
+	}
+
+	number := strings.TrimPrefix(upperTag, prefix)
+	if number == "" {
+		number = "0"
+	}
+
+	sourceDir, err := s.macros.expand("%{_sourcedir}")
+	if err != nil || strings.HasPrefix(sourceDir, "%") {
+		sourceDir = s.specDir
+	}
+
+	s.macros.define(prefix+number, filepath.Join(sourceDir, filepath.Base(urlToPath(value))))
+}
+
+// finish validates the parsed SPEC and adds the dependencies rpm implicitly adds to every package.
+func (s *parseState) finish() (err error) {
+	if s.spec.Name == "" || s.spec.Version == "" || s.spec.Release == "" {
+		return fmt.Errorf("%s: missing Name, Version or Release tag", s.specFile)
+	}
+
+	evr := s.spec.EVR()
+	isa, _ := s.macros.expand("%{?_isa}")
+
+	for _, pkg := range s.spec.Packages {
+		pkg.Arch = s.arch
+		if arch, found := s.packageArchs[pkg]; found {
+			pkg.Arch = arch
+		} else if s.mainArch != "" {
+			pkg.Arch = s.mainArch
+		}
+
+		pkg.Provides = append(pkg.Provides, fmt.Sprintf("%s = %s", pkg.Name, evr))
+		if pkg.Arch != NoArch && isa != "" {
+			pkg.Provides = append(pkg.Provides, fmt.Sprintf("%s%s = %s", pkg.Name, isa, evr))
+		}
+	}
+
+	return
+}
+
+// packageName returns the full name of a package referred to by a section, e.g. "%files devel" or "%files -n foo".
+func (s *parseState) packageName(name string, absoluteName bool) string {
+	switch {
+	case name == "":
+		return s.spec.Name
+	case absoluteName:
+		return name
+	default:
+		return fmt.Sprintf("%s-%s", s.spec.Name, name)
+	}
+}
+
+func (s *parseState) addPackage(name string) (pkg *Package) {
+	if s.packageArchs == nil {
+		s.packageArchs = make(map[*Package]string)
+	}
+
+	pkg = &Package{Name: name}
+	s.spec.Packages = append(s.spec.Packages, pkg)
+	return
+}
+
+func (s *parseState) findPackage(name string) *Package {
+	for _, pkg := range s.spec.Packages {
+		if pkg.Name == name {
+			return pkg
+		}
+	}
+	return nil
+}
+
+// splitKeyword splits a line such as "%package -n foo" into "package" and "-n foo".
+// Returns an empty keyword if the line does not start with a %keyword.
+func splitKeyword(line string) (keyword, arguments string) {
+	if !strings.HasPrefix(line, "%") {
+		return
+	}
+
+	end := 1
+	for end < len(line) && isNameChar(line[end]) {
+		end++
+	}
+
+	// The keyword must be followed by whitespace or the end of the line, e.g. "%if" but not "%{name}" or "%iffy"
+	if end < len(line) && line[end] != ' ' && line[end] != '\t' {
+		return
+	}
+
+	return line[1:end], strings.TrimSpace(line[end:])
+}
+
+// parseSectionArguments extracts the package name and interpreter from the arguments of a section line.
+func parseSectionArguments(arguments string) (name string, absoluteName bool, interpreter string) {
+	fields := strings.Fields(arguments)
+
+	for i := 0; i < len(fields); i++ {
+		field := fields[i]
+		switch {
+		case field == "--":
+			// Trigger conditions follow
+			return
+		case field == "-n":
+			absoluteName = true
+		case sectionOptionsWithValue[field]:
+			if i+1 < len(fields) {
+				if field == "-p" {
+					interpreter = fields[i+1]
+				}
+				i++
+			}
+		case strings.HasPrefix(field, "-"):
+		case name == "":
+			name = field
+		}
+	}
+
+	return
+}
+
+// isUsedTag returns true for the tags the parser extracts information from.
+func isUsedTag(tag string) bool {
+	switch tag {
+	case "name", "version", "release", "epoch", "buildrequires", "buildprereq", "requires", "prereq",
+		"provides", "buildarch", "buildarchitectures", "exclusivearch", "excludearch":
+		return true
+	}
+	return false
+}
+
+// isPackageTag returns true for tags which apply to the package of the current section.
+func isPackageTag(tag string) bool {
+	switch tag {
+	case "requires", "prereq", "provides", "buildarch", "buildarchitectures":
+		return true
+	}
+	return false
+}
+
+// readLines reads a file into a list of lines.
+func readLines(path string) (lines []string, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), 1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+
+	err = scanner.Err()
+	return
+}
+
+// splitList splits a whitespace or comma separated list.
+func splitList(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return r == ' ' || r == '\t' || r == ',' || r == '\n'
+	})
+}
+
+func isOperatorChar(c byte) bool {
+	return c == '<' || c == '>' || c == '='
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func appendUnique(list []string, value string) []string {
+	if contains(list, value) {
+		return list
+	}
+	return append(list, value)
+}
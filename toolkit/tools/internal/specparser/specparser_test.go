@@ -0,0 +1,364 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package specparser
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testDefines = map[string]string{
+	"dist":       ".cm1",
+	"with_check": "1",
+}
+
+// parseTestSpec writes a SPEC to a temporary directory and parses it.
+func parseTestSpec(t *testing.T, arch, contents string, extraFiles map[string]string) (spec *Spec, err error) {
+	dir, err := ioutil.TempDir("", "specparser")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for name, extraContents := range extraFiles {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(extraContents), os.ModePerm))
+	}
+
+	specFile := filepath.Join(dir, "test.spec")
+	assert.NoError(t, ioutil.WriteFile(specFile, []byte(contents), os.ModePerm))
+
+	return NewParser(arch).ParseFile(specFile, testDefines)
+}
+
+func TestParseBasicSpec(t *testing.T) {
+	const contents = `Summary:        Access control list utilities
+Name:           acl
+Version:        2.2.53
+Release:        4%{?dist}
+Source0:        https://example.com/%{name}-%{version}.tar.gz
+Requires:       libacl = %{version}-%{release}
+BuildRequires:  attr-devel, gettext >= 0.19
+BuildRequires:  libtool
+
+%description
+Utilities.
+
+%package -n     libacl
+Summary:        Library
+Requires:       attr
+
+%description -n libacl
+Library.
+
+%package devel
+Summary:        Headers
+Requires:       libacl = %{version}-%{release}
+Provides:       acl-headers
+
+%post -n libacl -p /sbin/ldconfig
+%postun -n libacl
+/sbin/ldconfig
+
+%files
+%{_bindir}/getfacl
+
+%changelog
+* Mon Jan 01 2020 Someone <someone@example.com> - 2.2.53-4
+- Requires: not-a-tag
+`
+
+	spec, err := parseTestSpec(t, "x86_64", contents, nil)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "acl", spec.Name)
+	assert.Equal(t, "2.2.53", spec.Version)
+	assert.Equal(t, "4.cm1", spec.Release)
+	assert.Equal(t, "acl-2.2.53-4.cm1.src.rpm", spec.SrpmName())
+	assert.Equal(t, []string{"attr-devel", "gettext >= 0.19", "libtool"}, spec.BuildRequires)
+	assert.Equal(t, []string{"acl-2.2.53.tar.gz"}, spec.Sources)
+
+	assert.Len(t, spec.Packages, 3)
+
+	acl := spec.Packages[0]
+	assert.Equal(t, "acl", acl.Name)
+	assert.Equal(t, "x86_64", acl.Arch)
+	assert.Equal(t, []string{"acl = 2.2.53-4.cm1", "acl(x86-64) = 2.2.53-4.cm1"}, acl.Provides)
+	assert.Equal(t, []string{"libacl = 2.2.53-4.cm1"}, acl.Requires)
+
+	libacl := spec.Packages[1]
+	assert.Equal(t, "libacl", libacl.Name)
+	assert.Equal(t, []string{"attr", "/sbin/ldconfig", "/bin/sh"}, libacl.Requires)
+
+	devel := spec.Packages[2]
+	assert.Equal(t, "acl-devel", devel.Name)
+	assert.Equal(t, []string{"acl-headers", "acl-devel = 2.2.53-4.cm1", "acl-devel(x86-64) = 2.2.53-4.cm1"}, devel.Provides)
+}
+
+func TestParseEpoch(t *testing.T) {
+	const contents = `Name: foo
+Epoch: 2
+Version: 1.0
+Release: 1
+Requires: bar = %{?epoch:%epoch:}%{version}-%{release}
+BuildArch: noarch
+`
+
+	spec, err := parseTestSpec(t, "x86_64", contents, nil)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "2:1.0-1", spec.EVR())
+	assert.Equal(t, "foo-1.0-1.src.rpm", spec.SrpmName())
+
+	// noarch packages do not get an architecture specific provide
+	foo := spec.Packages[0]
+	assert.Equal(t, NoArch, foo.Arch)
+	assert.Equal(t, []string{"foo = 2:1.0-1"}, foo.Provides)
+	assert.Equal(t, []string{"bar = 2:1.0-1"}, foo.Requires)
+}
+
+func TestParseConditionals(t *testing.T) {
+	const contents = `%define with_feature 1
+%global major 3
+%bcond_without docs
+%bcond_with experimental
+
+Name: foo
+Version: %{major}.1
+Release: 1%{?dist}
+
+%if %{with_feature}
+BuildRequires: feature-devel
+%else
+BuildRequires: no-feature-devel
+%endif
+
+%if 0%{?rhel} && 0%{?rhel} <= 7
+BuildRequires: rhel-devel
+%elif "%{_arch}" == "x86_64"
+BuildRequires: x86-devel
+%else
+BuildRequires: other-devel
+%endif
+
+%if %{with docs}
+BuildRequires: doc-tools
+%endif
+
+%if %{with experimental}
+BuildRequires: experimental-tools
+%endif
+
+%ifarch aarch64
+BuildRequires: arm-only
+%endif
+
+%ifnarch aarch64
+BuildRequires: not-arm
+%endif
+
+%ifarch %{ix86} x86_64
+BuildRequires: intel
+%if 0
+BuildRequires: nested-false
+%endif
+%endif
+
+%if 0
+%if 1
+BuildRequires: inside-false
+%else
+BuildRequires: inside-false-else
+%endif
+%endif
+
+%description
+`
+
+	spec, err := parseTestSpec(t, "x86_64", contents, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "3.1", spec.Version)
+	assert.Equal(t, []string{"feature-devel", "x86-devel", "doc-tools", "not-arm", "intel"}, spec.BuildRequires)
+
+	spec, err = parseTestSpec(t, "aarch64", contents, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"feature-devel", "other-devel", "doc-tools", "arm-only"}, spec.BuildRequires)
+}
+
+func TestParseConditionalPackage(t *testing.T) {
+	const contents = `Name: foo
+Version: 1
+Release: 1
+
+%description
+
+%ifarch x86_64
+%package intel
+Summary: Intel only
+Requires: foo
+
+%description intel
+%endif
+
+%files
+`
+
+	spec, err := parseTestSpec(t, "x86_64", contents, nil)
+	assert.NoError(t, err)
+	assert.Len(t, spec.Packages, 2)
+
+	spec, err = parseTestSpec(t, "aarch64", contents, nil)
+	assert.NoError(t, err)
+	assert.Len(t, spec.Packages, 1)
+}
+
+func TestParseExclusiveArch(t *testing.T) {
+	const contents = `Name: foo
+Version: 1
+Release: 1
+ExclusiveArch: %{ix86} x86_64
+ExcludeArch: i686
+`
+
+	spec, err := parseTestSpec(t, "x86_64", contents, nil)
+	assert.NoError(t, err)
+
+	assert.True(t, spec.BuildableOn("x86_64"))
+	assert.True(t, spec.BuildableOn("i386"))
+	assert.False(t, spec.BuildableOn("i686"))
+	assert.False(t, spec.BuildableOn("aarch64"))
+}
+
+func TestParseSubpackageBuildArch(t *testing.T) {
+	const contents = `Name: foo
+Version: 1
+Release: 1
+
+%package doc
+Summary: Docs
+BuildArch: noarch
+`
+
+	spec, err := parseTestSpec(t, "x86_64", contents, nil)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "x86_64", spec.Packages[0].Arch)
+	assert.Equal(t, NoArch, spec.Packages[1].Arch)
+	assert.Equal(t, []string{"foo-doc = 1-1"}, spec.Packages[1].Provides)
+}
+
+func TestParseInclude(t *testing.T) {
+	const contents = `Name: foo
+Version: 1
+Release: 1
+Source1: common.inc
+%include %{SOURCE1}
+`
+
+	files := map[string]string{"common.inc": "BuildRequires: included-devel\n"}
+
+	spec, err := parseTestSpec(t, "x86_64", contents, files)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"included-devel"}, spec.BuildRequires)
+}
+
+func TestParseMultilineDefine(t *testing.T) {
+	const contents = `%define requirements \
+Requires: first \
+Requires: second
+
+Name: foo
+Version: 1
+Release: 1
+%{requirements}
+`
+
+	spec, err := parseTestSpec(t, "x86_64", contents, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"first", "second"}, spec.Packages[0].Requires)
+}
+
+func TestParseUnusedTagWithShellMacro(t *testing.T) {
+	const contents = `%global majmin %(echo 1.0)
+Name: foo
+Version: 1.0.3
+Release: 1
+Source0: https://example.com/%{majmin}/foo.tar.gz
+`
+
+	_, err := parseTestSpec(t, "x86_64", contents, nil)
+	assert.NoError(t, err)
+}
+
+func TestParseUsedTagWithShellMacro(t *testing.T) {
+	const contents = `%global majmin %(echo 1.0)
+Name: foo
+Version: 1.0.3
+Release: 1
+BuildRequires: bar >= %{majmin}
+`
+
+	_, err := parseTestSpec(t, "x86_64", contents, nil)
+	assert.Error(t, err)
+}
+
+func TestParseInvalidSpecs(t *testing.T) {
+	invalid := map[string]string{
+		"missing version": "Name: foo\nRelease: 1\n",
+		"missing endif":   "Name: foo\nVersion: 1\nRelease: 1\n%if 1\n",
+		"extra endif":     "Name: foo\nVersion: 1\nRelease: 1\n%endif\n",
+		"bad expression":  "Name: foo\nVersion: 1\nRelease: 1\n%if 1 +\n%endif\n",
+		"unknown package": "Name: foo\nVersion: 1\nRelease: 1\n%post bar\n",
+	}
+
+	for name, contents := range invalid {
+		_, err := parseTestSpec(t, "x86_64", contents, nil)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestSplitDependencies(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected []string
+	}{
+		{"foo", []string{"foo"}},
+		{"foo bar", []string{"foo", "bar"}},
+		{"foo, bar", []string{"foo", "bar"}},
+		{"foo >= 1.0, bar", []string{"foo >= 1.0", "bar"}},
+		{"foo>=1.0 bar<2", []string{"foo >= 1.0", "bar < 2"}},
+		{"foo == 1", []string{"foo = 1"}},
+		{"perl(Foo::Bar) >= 1.0", []string{"perl(Foo::Bar) >= 1.0"}},
+		{"(foo or bar) baz", []string{"(foo or bar)", "baz"}},
+		{"/bin/sh", []string{"/bin/sh"}},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, SplitDependencies(test.value), test.value)
+	}
+}
+
+func TestLoadMacroDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "specparser")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "macros.d"), os.ModePerm))
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "platform", "x86_64-linux"), os.ModePerm))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "macros"), []byte("%_prefix /usr\n%_bindir %{_prefix}/bin\n%overridden base\n"), os.ModePerm))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "macros.d", "macros.extra"), []byte("# Comment\n%multi first \\\n  second\n"), os.ModePerm))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "platform", "x86_64-linux", "macros"), []byte("%overridden platform\n"), os.ModePerm))
+
+	parser := NewParser("x86_64")
+	assert.NoError(t, parser.LoadMacroDir(dir))
+
+	expanded, err := parser.macros.expand("%{_bindir} %{overridden}")
+	assert.NoError(t, err)
+	assert.Equal(t, "/usr/bin platform", expanded)
+
+	expanded, err = parser.macros.expand("%{multi}")
+	assert.NoError(t, err)
+	assert.Equal(t, "first \n  second", expanded)
+}
@@ -0,0 +1,58 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package specsignatures
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"microsoft.com/pkggen/internal/jsonutils"
+	"microsoft.com/pkggen/internal/logger"
+)
+
+// FileSignaturesWrapper is the content of a SPEC's signatures file, mapping the name of every source file to its SHA256 hash.
+type FileSignaturesWrapper struct {
+	FileSignatures map[string]string `json:"Signatures"`
+}
+
+// PathForSpec returns the path of the signatures file next to a SPEC file, e.g. "foo.signatures.json" for "foo.spec".
+func PathForSpec(specFilePath string) string {
+	const (
+		specSuffix          = ".spec"
+		signatureFileSuffix = "signatures.json"
+	)
+
+	specName := strings.TrimSuffix(filepath.Base(specFilePath), specSuffix)
+	signatureFileName := fmt.Sprintf("%s.%s", specName, signatureFileSuffix)
+	signatureFileDirPath := filepath.Dir(specFilePath)
+
+	return filepath.Join(signatureFileDirPath, signatureFileName)
+}
+
+// Read reads the signatures of a signatures file. A missing file is not an error, since some SPECs
+// don't have any sources, and returns an empty map.
+func Read(signaturesFilePath string) (readSignatures map[string]string, err error) {
+	var signaturesWrapper FileSignaturesWrapper
+	signaturesWrapper.FileSignatures = make(map[string]string)
+
+	err = jsonutils.ReadJSONFile(signaturesFilePath, &signaturesWrapper)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// Non-fatal as some SPECs may not have sources
+			logger.Log.Debugf("The signatures file (%s) doesn't exist, will not pre-populate signatures.", signaturesFilePath)
+			err = nil
+		} else {
+			logger.Log.Errorf("Failed to read the signatures file (%s): %v.", signaturesFilePath, err)
+		}
+	}
+
+	return signaturesWrapper.FileSignatures, err
+}
+
+// Write saves signatures into a signatures file.
+func Write(signaturesFilePath string, signatures map[string]string) (err error) {
+	return jsonutils.WriteJSONFile(signaturesFilePath, FileSignaturesWrapper{FileSignatures: signatures})
+}
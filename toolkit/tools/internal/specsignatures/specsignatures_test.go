@@ -0,0 +1,55 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package specsignatures
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"microsoft.com/pkggen/internal/logger"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitStderrLog()
+	os.Exit(m.Run())
+}
+
+func TestPathForSpec(t *testing.T) {
+	assert.Equal(t, filepath.Join("SPECS", "acl", "acl.signatures.json"), PathForSpec(filepath.Join("SPECS", "acl", "acl.spec")))
+}
+
+func TestWriteAndRead(t *testing.T) {
+	dir, err := ioutil.TempDir("", "specsignatures")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "acl.signatures.json")
+	signatures := map[string]string{"acl-2.2.53.tar.gz": "06be9865c6f418d851ff4494e12406568353b891ffe1f596b34693c387af26c7"}
+	assert.NoError(t, Write(path, signatures))
+
+	read, err := Read(path)
+	assert.NoError(t, err)
+	assert.Equal(t, signatures, read)
+}
+
+func TestReadMissingFile(t *testing.T) {
+	read, err := Read(filepath.Join("does", "not", "exist.signatures.json"))
+	assert.NoError(t, err)
+	assert.Empty(t, read)
+}
+
+func TestReadInvalidFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "specsignatures")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "acl.signatures.json")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("{"), os.ModePerm))
+
+	_, err = Read(path)
+	assert.Error(t, err)
+}
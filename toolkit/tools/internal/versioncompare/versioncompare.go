@@ -5,22 +5,25 @@ package versioncompare
 
 import (
 	"fmt"
-	"regexp"
-	"strconv"
 	"strings"
 )
 
-var (
-	componentRegex = regexp.MustCompile(`(\d+|[a-z]+)`)
+const (
+	lessThan     = -1
+	equalTo      = 0
+	greaterThan  = 1
+	defaultEpoch = "0"
 )
 
-// TolerantVersion is a flexible version representation
+// TolerantVersion is a flexible version representation of the form [epoch:]version[-release].
+// Versions are compared the same way rpm's rpmvercmp does, see Compare.
 type TolerantVersion struct {
-	versionComponents []uint64
-	releaseComponents []uint64
-	isMaxVer          bool
-	isMinVer          bool
-	original          string
+	epoch    string
+	version  string
+	release  string
+	isMaxVer bool
+	isMinVer bool
+	original string
 }
 
 // New returns new TolerantVersion
@@ -59,105 +62,205 @@ func (v *TolerantVersion) CompareWithConditional(condition string, b *TolerantVe
 	}
 }
 
-// Compare compares this version and the argument version and returns 1 if the argument's version is higher,
-// -1 if argument's version is lower and 0 if they are equal (three-way comparison)
+// Compare compares this version and the argument version and returns 1 if the argument's version is lower,
+// -1 if argument's version is higher and 0 if they are equal (three-way comparison).
+// Epochs are compared first, a missing epoch is treated as 0. Versions are compared next and releases last,
+// the releases are only compared if both versions have one.
 func (v *TolerantVersion) Compare(other *TolerantVersion) int {
-	const (
-		lessThan     = -1
-		equalTo      = 0
-		greatherThan = 1
-	)
-
 	switch {
 	case v.isMaxVer && other.isMaxVer:
 		fallthrough
 	case v.isMinVer && other.isMinVer:
 		return equalTo
 	case v.isMaxVer || other.isMinVer:
-		return greatherThan
+		return greaterThan
 	case v.isMinVer || other.isMaxVer:
 		return lessThan
 	}
 
-	for i := range v.versionComponents {
-		if i == len(other.versionComponents) {
-			return greatherThan
-		}
-		if v.versionComponents[i] < other.versionComponents[i] {
-			return lessThan
-		}
-		if v.versionComponents[i] > other.versionComponents[i] {
-			return greatherThan
-		}
+	if result := rpmvercmp(v.Epoch(), other.Epoch()); result != equalTo {
+		return result
 	}
-	if len(v.versionComponents) < len(other.versionComponents) {
-		return lessThan
+
+	if result := rpmvercmp(v.version, other.version); result != equalTo {
+		return result
 	}
 
 	// Only check the release components if both versions request it.
-	if len(v.releaseComponents) > 0 && len(other.releaseComponents) > 0 {
-		for i := range v.releaseComponents {
-			if i == len(other.releaseComponents) {
-				return greatherThan
-			}
-			if v.releaseComponents[i] < other.releaseComponents[i] {
-				return lessThan
-			}
-			if v.releaseComponents[i] > other.releaseComponents[i] {
-				return greatherThan
-			}
-		}
-		if len(v.releaseComponents) < len(other.releaseComponents) {
-			return lessThan
-		}
+	if v.release != "" && other.release != "" {
+		return rpmvercmp(v.release, other.release)
 	}
 
 	return equalTo
 }
 
+// Epoch returns the version's epoch, or "0" if it has none.
+func (v *TolerantVersion) Epoch() string {
+	if v.epoch == "" {
+		return defaultEpoch
+	}
+	return v.epoch
+}
+
 // String returns the original string representation of the version
 func (v *TolerantVersion) String() string {
 	return v.original
 }
 
-// parse takes an arbitrary versionString and fills v with the processed version information
+// parse splits an [epoch:]version[-release] string the same way rpm does: the epoch is a
+// leading run of digits followed by ':' and the release follows the last '-'.
 func (v *TolerantVersion) parse(versionString string) {
-	var (
-		versionSubstring, releaseSubstring string
-	)
-	// Split off any release number if present. '-' is an illegal character for versions so we can split on it
-	splitString := strings.Split(versionString, "-")
-	versionSubstring = splitString[0]
-	if len(splitString) > 1 {
-		releaseSubstring = splitString[1]
-	} else {
-		releaseSubstring = ""
+	remainder := versionString
+
+	digits := 0
+	for digits < len(remainder) && isDigit(remainder[digits]) {
+		digits++
+	}
+	if digits < len(remainder) && remainder[digits] == ':' {
+		v.epoch = remainder[:digits]
+		remainder = remainder[digits+1:]
 	}
 
-	rawComponents := componentRegex.FindAllString(versionSubstring, -1)
-	v.versionComponents = make([]uint64, len(rawComponents))
-	for i := range rawComponents {
-		// Base36 to support lowercase characters
-		// 64bits to support at least 12 characters (12 times 'z')
-		intComponent, err := strconv.ParseUint(rawComponents[i], 36, 64)
-		if err == nil {
-			v.versionComponents[i] = intComponent
-		}
-		// On error keep default value (0)
+	if index := strings.LastIndex(remainder, "-"); index >= 0 {
+		v.release = remainder[index+1:]
+		remainder = remainder[:index]
 	}
 
-	// Run again if we have a release version as well
-	if releaseSubstring != "" {
-		rawComponents = componentRegex.FindAllString(releaseSubstring, -1)
-		v.releaseComponents = make([]uint64, len(rawComponents))
-		for i := range rawComponents {
-			// Base36 to support lowercase characters
-			// 64bits to support at least 12 characters (12 times 'z')
-			intComponent, err := strconv.ParseUint(rawComponents[i], 36, 64)
-			if err == nil {
-				v.releaseComponents[i] = intComponent
+	v.version = remainder
+}
+
+// rpmvercmp compares two version or release strings the same way rpm does.
+//
+// Both strings are split into segments of ASCII digits or ASCII letters, any other characters only separate
+// segments. Segments are compared in order: numeric segments numerically, alphabetic segments lexically, and
+// a numeric segment is always newer than an alphabetic one. A '~' sorts before anything, even the end of the
+// string, so "1.0~rc1" is older than "1.0". A '^' sorts after the end of the string but before anything else,
+// so "1.0^git1" is newer than "1.0" but older than "1.0.1". If all segments are equal, the string with
+// segments left over is newer.
+func rpmvercmp(a, b string) int {
+	if a == b {
+		return equalTo
+	}
+
+	one, two := 0, 0
+	for one < len(a) || two < len(b) {
+		for one < len(a) && !isAlphaNumeric(a[one]) && a[one] != '~' && a[one] != '^' {
+			one++
+		}
+		for two < len(b) && !isAlphaNumeric(b[two]) && b[two] != '~' && b[two] != '^' {
+			two++
+		}
+
+		// Handle the tilde separator, it sorts before everything else
+		if byteAt(a, one) == '~' || byteAt(b, two) == '~' {
+			if byteAt(a, one) != '~' {
+				return greaterThan
 			}
-			// On error keep default value (0)
+			if byteAt(b, two) != '~' {
+				return lessThan
+			}
+			one++
+			two++
+			continue
 		}
+
+		// Handle the caret separator. It is similar to the tilde, except that if one
+		// of the strings ends (base version), the other is considered as higher version.
+		if byteAt(a, one) == '^' || byteAt(b, two) == '^' {
+			if one == len(a) {
+				return lessThan
+			}
+			if two == len(b) {
+				return greaterThan
+			}
+			if a[one] != '^' {
+				return greaterThan
+			}
+			if b[two] != '^' {
+				return lessThan
+			}
+			one++
+			two++
+			continue
+		}
+
+		// If we ran to the end of either, we are finished with the loop
+		if one == len(a) || two == len(b) {
+			break
+		}
+
+		// Grab the first completely alpha or completely numeric segment
+		isNumeric := isDigit(a[one])
+		segmentEnd := isAlpha
+		if isNumeric {
+			segmentEnd = isDigit
+		}
+
+		endOne, endTwo := one, two
+		for endOne < len(a) && segmentEnd(a[endOne]) {
+			endOne++
+		}
+		for endTwo < len(b) && segmentEnd(b[endTwo]) {
+			endTwo++
+		}
+
+		// The segments are of different types, numeric segments are always newer than alpha segments
+		if endTwo == two {
+			if isNumeric {
+				return greaterThan
+			}
+			return lessThan
+		}
+
+		segmentOne, segmentTwo := a[one:endOne], b[two:endTwo]
+		if isNumeric {
+			// Throw away any leading zeros, whichever number has more digits wins
+			segmentOne = strings.TrimLeft(segmentOne, "0")
+			segmentTwo = strings.TrimLeft(segmentTwo, "0")
+
+			if len(segmentOne) > len(segmentTwo) {
+				return greaterThan
+			}
+			if len(segmentTwo) > len(segmentOne) {
+				return lessThan
+			}
+		}
+
+		// Equal length numbers compare the same as strings
+		if result := strings.Compare(segmentOne, segmentTwo); result != equalTo {
+			return result
+		}
+
+		one, two = endOne, endTwo
+	}
+
+	// Whichever version still has characters left over wins
+	switch {
+	case one == len(a) && two == len(b):
+		return equalTo
+	case one == len(a):
+		return lessThan
+	default:
+		return greaterThan
 	}
 }
+
+// byteAt returns the byte at index, or 0 past the end of the string.
+func byteAt(s string, index int) byte {
+	if index < len(s) {
+		return s[index]
+	}
+	return 0
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isAlpha(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isAlphaNumeric(c byte) bool {
+	return isDigit(c) || isAlpha(c)
+}
@@ -9,11 +9,12 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
+// The garbage strings avoid '~' and '^', which are meaningful separators.
 const (
-	emojiHighString    = "1🤷‍♂️2@3( •_•)>⌐■~■ab~52(⌐■_■)67👩‍💻"
-	emojiHighStringAlt = "1👌2🤣3🤢ab~52*^&%$67(•_•)"
-	emojiLowString     = "1🤷‍♂️2@3( •_•)>⌐■~■ab~42(⌐■_■)67👩‍💻"
-	emojiMidString     = "1👌2🤣3🤢ab~52*^&%$6"
+	emojiHighString    = "1🤷‍♂️2@3( •_•)>⌐■#■ab#52(⌐■_■)67👩‍💻"
+	emojiHighStringAlt = "1👌2🤣3🤢ab#52*&%$67(•_•)"
+	emojiLowString     = "1🤷‍♂️2@3( •_•)>⌐■#■ab#42(⌐■_■)67👩‍💻"
+	emojiMidString     = "1👌2🤣3🤢ab#52*&%$6"
 )
 
 func TestCompareShouldProcessHigherVersion(t *testing.T) {
@@ -199,3 +200,160 @@ func TestInvalidConditional(t *testing.T) {
 	_, err := low.CompareWithConditional("?", high)
 	assert.Error(t, err)
 }
+
+// rpmTestVectors are the rpmvercmp test cases from rpm's own test suite (tests/rpmvercmp.at).
+var rpmTestVectors = []struct {
+	a        string
+	b        string
+	expected int
+}{
+	{"1.0", "1.0", 0},
+	{"1.0", "2.0", -1},
+	{"2.0", "1.0", 1},
+	{"2.0.1", "2.0.1", 0},
+	{"2.0", "2.0.1", -1},
+	{"2.0.1", "2.0", 1},
+	{"2.0.1a", "2.0.1a", 0},
+	{"2.0.1a", "2.0.1", 1},
+	{"2.0.1", "2.0.1a", -1},
+	{"5.5p1", "5.5p1", 0},
+	{"5.5p1", "5.5p2", -1},
+	{"5.5p2", "5.5p1", 1},
+	{"5.5p10", "5.5p10", 0},
+	{"5.5p1", "5.5p10", -1},
+	{"5.5p10", "5.5p1", 1},
+	{"10xyz", "10.1xyz", -1},
+	{"10.1xyz", "10xyz", 1},
+	{"xyz10", "xyz10", 0},
+	{"xyz10", "xyz10.1", -1},
+	{"xyz10.1", "xyz10", 1},
+	{"xyz.4", "xyz.4", 0},
+	{"xyz.4", "8", -1},
+	{"8", "xyz.4", 1},
+	{"xyz.4", "2", -1},
+	{"2", "xyz.4", 1},
+	{"5.5p2", "5.6p1", -1},
+	{"5.6p1", "5.5p2", 1},
+	{"5.6p1", "6.5p1", -1},
+	{"6.5p1", "5.6p1", 1},
+	{"6.0.rc1", "6.0", 1},
+	{"6.0", "6.0.rc1", -1},
+	{"10b2", "10a1", 1},
+	{"10a2", "10b2", -1},
+	{"1.0aa", "1.0aa", 0},
+	{"1.0a", "1.0aa", -1},
+	{"1.0aa", "1.0a", 1},
+	{"10.0001", "10.0001", 0},
+	{"10.0001", "10.1", 0},
+	{"10.1", "10.0001", 0},
+	{"10.0001", "10.0039", -1},
+	{"10.0039", "10.0001", 1},
+	{"4.999.9", "5.0", -1},
+	{"5.0", "4.999.9", 1},
+	{"20101121", "20101121", 0},
+	{"20101121", "20101122", -1},
+	{"20101122", "20101121", 1},
+	{"2_0", "2_0", 0},
+	{"2.0", "2_0", 0},
+	{"2_0", "2.0", 0},
+	{"a", "a", 0},
+	{"a+", "a+", 0},
+	{"a+", "a_", 0},
+	{"a_", "a+", 0},
+	{"+a", "+a", 0},
+	{"+a", "_a", 0},
+	{"_a", "+a", 0},
+	{"+_", "+_", 0},
+	{"_+", "+_", 0},
+	{"_+", "_+", 0},
+	{"+", "_", 0},
+	{"_", "+", 0},
+	{"1.0~rc1", "1.0~rc1", 0},
+	{"1.0~rc1", "1.0", -1},
+	{"1.0", "1.0~rc1", 1},
+	{"1.0~rc1", "1.0~rc2", -1},
+	{"1.0~rc2", "1.0~rc1", 1},
+	{"1.0~rc1~git123", "1.0~rc1~git123", 0},
+	{"1.0~rc1~git123", "1.0~rc1", -1},
+	{"1.0~rc1", "1.0~rc1~git123", 1},
+	{"1.0^", "1.0^", 0},
+	{"1.0^", "1.0", 1},
+	{"1.0", "1.0^", -1},
+	{"1.0^git1", "1.0^git1", 0},
+	{"1.0^git1", "1.0", 1},
+	{"1.0", "1.0^git1", -1},
+	{"1.0^git1", "1.0^git2", -1},
+	{"1.0^git2", "1.0^git1", 1},
+	{"1.0^git1", "1.01", -1},
+	{"1.01", "1.0^git1", 1},
+	{"1.0^20160101", "1.0^20160101", 0},
+	{"1.0^20160101", "1.0.1", -1},
+	{"1.0.1", "1.0^20160101", 1},
+	{"1.0^20160101^git1", "1.0^20160101^git1", 0},
+	{"1.0^20160102", "1.0^20160101^git1", 1},
+	{"1.0^20160101^git1", "1.0^20160102", -1},
+	{"1.0~rc1^git1", "1.0~rc1^git1", 0},
+	{"1.0~rc1^git1", "1.0~rc1", 1},
+	{"1.0~rc1", "1.0~rc1^git1", -1},
+	{"1.0^git1~pre", "1.0^git1~pre", 0},
+	{"1.0^git1", "1.0^git1~pre", 1},
+	{"1.0^git1~pre", "1.0^git1", -1},
+}
+
+func TestCompareShouldMatchRpmTestVectors(t *testing.T) {
+	for _, test := range rpmTestVectors {
+		assert.Equal(t, test.expected, New(test.a).Compare(New(test.b)), "%s vs %s", test.a, test.b)
+	}
+}
+
+func TestCompareShouldHandleEpochs(t *testing.T) {
+	tests := []struct {
+		a        string
+		b        string
+		expected int
+	}{
+		{"1:1.0", "2.0", 1},
+		{"2.0", "1:1.0", -1},
+		{"0:1.0", "1.0", 0},
+		{"1:1.0", "1:1.0", 0},
+		{"1:1.0", "2:0.1", -1},
+		{"10:1.0", "9:1.0", 1},
+		{"1:1.0-1", "1:1.0-2", -1},
+		{"1:1.0-5", "1:1.0", 0},
+		{"1:1.0-5", "1.0-5", 1},
+		{"1:1.0~rc1-1.cm1", "1:1.0-1.cm1", -1},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, New(test.a).Compare(New(test.b)), "%s vs %s", test.a, test.b)
+	}
+}
+
+func TestParseShouldSplitEpochVersionRelease(t *testing.T) {
+	tests := []struct {
+		input   string
+		epoch   string
+		version string
+		release string
+	}{
+		{"1.0", "0", "1.0", ""},
+		{"2:1.0", "2", "1.0", ""},
+		{"2:1.0-3.cm1", "2", "1.0", "3.cm1"},
+		{"1.0-3.cm1", "0", "1.0", "3.cm1"},
+		{"a:1.0", "0", "a:1.0", ""},
+		{":1.0", "0", "1.0", ""},
+	}
+
+	for _, test := range tests {
+		v := New(test.input)
+		assert.Equal(t, test.epoch, v.Epoch(), test.input)
+		assert.Equal(t, test.version, v.version, test.input)
+		assert.Equal(t, test.release, v.release, test.input)
+		assert.Equal(t, test.input, v.String())
+	}
+}
+
+func TestCompareShouldOrderReleasesWithTilde(t *testing.T) {
+	assert.Equal(t, -1, New("1.0-1~beta").Compare(New("1.0-1")))
+	assert.Equal(t, 1, New("1.0-1^post").Compare(New("1.0-1")))
+}
@@ -6,6 +6,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -15,10 +16,13 @@ import (
 	"time"
 
 	"gopkg.in/alecthomas/kingpin.v2"
+	"microsoft.com/pkggen/internal/buildmanifest"
+	"microsoft.com/pkggen/internal/buildreport"
 	"microsoft.com/pkggen/internal/exe"
 	"microsoft.com/pkggen/internal/file"
 	"microsoft.com/pkggen/internal/logger"
 	"microsoft.com/pkggen/internal/packagerepo/repomanager/rpmrepomanager"
+	"microsoft.com/pkggen/internal/pkgjson"
 	"microsoft.com/pkggen/internal/retry"
 	"microsoft.com/pkggen/internal/rpm"
 	"microsoft.com/pkggen/internal/safechroot"
@@ -49,6 +53,14 @@ var (
 	rpmmacrosFile        = app.Flag("rpmmacros-file", "Optional file path to an rpmmacros file for rpmbuild to use").ExistingFile()
 	retryAttempts        = app.Flag("retry-attempts", "Sets the number of times pkgworker will retry building the package").Default(defaultRetryAttempts).Int()
 	runCheck             = app.Flag("run-check", "Run the check during package build").Bool()
+	unresolvedReportFile = app.Flag("unresolved-report", "Optional file path to write a JSON report of any BuildRequires which could not be installed").String()
+	resultFile           = app.Flag("result-file", "Optional file path to write a JSON summary of the build's result").String()
+	buildManifestDir     = app.Flag("build-manifest-dir", "Optional build manifest directory, the SRPM's pending manifest entry is committed once it is built").String()
+	targetArch           = exe.TargetArchFlag(app)
+	bootstrap            = app.Flag("bootstrap", "Build the SRPM in bootstrap mode, with the with_bootstrap define set to reduce its BuildRequires").Bool()
+
+	verifyReproducible        = app.Flag("verify-reproducible", "Build the SRPM twice in separate chroots with SOURCE_DATE_EPOCH set from its changelog and compare the RPMs produced").Bool()
+	reproducibilityReportFile = app.Flag("reproducibility-report", "Optional file path to write a JSON report of every difference between the two builds made by --verify-reproducible").String()
 
 	logFile  = exe.LogFileFlag(app)
 	logLevel = exe.LogLevelFlag(app)
@@ -58,11 +70,25 @@ var (
 	greaterThanOrEqualRegex = regexp.MustCompile(` '?>='? [^ ]*`)
 	equalToRegex            = regexp.MustCompile(` '?='? `)
 	lessThanOrEqualToRegex  = regexp.MustCompile(` '?<='? `)
+
+	// Every unavailable package will be reported as: No package <package> available
+	unresolvedPackageRegex = regexp.MustCompile(`^No package (.+) available`)
 )
 
+// unresolvedBuildRequiresError is returned when tdnf could not find a package for one or more BuildRequires.
+type unresolvedBuildRequiresError struct {
+	report *buildreport.UnresolvedReport
+}
+
+func (e *unresolvedBuildRequiresError) Error() string {
+	return e.report.String()
+}
+
 func main() {
 	const (
-		retryDuration = time.Second
+		retryDuration         = time.Second
+		bootstrapChrootSuffix = "-bootstrap"
+		bootstrapEnabled      = "1"
 	)
 
 	app.Version(exe.ToolkitVersion)
@@ -75,6 +101,9 @@ func main() {
 	srpmsDirAbsPath, err := filepath.Abs(*srpmsDirPath)
 	logger.PanicOnError(err, "Unable to find absolute path for SRPMs directory '%s'", *srpmsDirPath)
 
+	buildArch, err := rpm.ResolveTargetArch(*targetArch)
+	logger.PanicOnError(err, "Unable to determine the target architecture. Error: %v", err)
+
 	srpmName := strings.TrimSuffix(filepath.Base(*srpmFile), ".src.rpm")
 	chrootDir := filepath.Join(*workDir, srpmName)
 
@@ -83,17 +112,85 @@ func main() {
 	defines[rpm.DistroReleaseVersionDefine] = *distroReleaseVersion
 	defines[rpm.DistroBuildNumberDefine] = *distroBuildNumber
 
+	if *bootstrap {
+		logger.Log.Infof("Building (%s) in bootstrap mode", srpmName)
+		chrootDir += bootstrapChrootSuffix
+		defines[rpm.BootstrapDefine] = bootstrapEnabled
+	}
+
+	var (
+		builtRPMs     []string
+		attempts      int
+		noBuildEnv    []string
+		unresolvedErr *unresolvedBuildRequiresError
+	)
+
+	startTime := time.Now()
 	err = retry.Run(func() error {
-		err = buildSRPMInChroot(chrootDir, rpmsDirAbsPath, *workerTar, *srpmFile, *repoFile, *rpmmacrosFile, defines, *noCleanup, *runCheck)
+		attempts++
+		if *verifyReproducible {
+			builtRPMs, err = verifyReproducibleBuild(chrootDir, rpmsDirAbsPath, *workerTar, *srpmFile, *repoFile, *rpmmacrosFile, buildArch, *reproducibilityReportFile, defines, *noCleanup, *runCheck)
+		} else {
+			builtRPMs, err = buildSRPMInChroot(chrootDir, rpmsDirAbsPath, rpmsDirAbsPath, *workerTar, *srpmFile, *repoFile, *rpmmacrosFile, buildArch, defines, noBuildEnv, *noCleanup, *runCheck)
+		}
 		if err != nil {
 			logger.Log.Warnf("Failed package build attempt (%v), error (%v)", *srpmFile, err)
 		}
+
+		// Missing BuildRequires will still be missing on the next attempt, stop retrying so the scheduler can resolve them
+		if errors.As(err, &unresolvedErr) {
+			return nil
+		}
 		return err
 	}, *retryAttempts, retryDuration)
+	if unresolvedErr != nil {
+		err = unresolvedErr
+	}
+
+	if *resultFile != "" {
+		writeResult(*resultFile, *srpmFile, *logFile, builtRPMs, attempts, time.Since(startTime), err)
+	}
+
+	if unresolvedErr != nil && *unresolvedReportFile != "" {
+		reportErr := buildreport.WriteUnresolvedReport(*unresolvedReportFile, unresolvedErr.report)
+		logger.WarningOnError(reportErr, "Failed to write unresolved BuildRequires report '%s'.", *unresolvedReportFile)
+	}
 	logger.PanicOnError(err, "Failed to build SRPM '%s'. For details see log file: %s.", *srpmFile, *logFile)
 
 	err = copySRPMToOutput(*srpmFile, srpmsDirAbsPath)
 	logger.PanicOnError(err, "Failed to copy SRPM '%s' to output directory '%s'.", *srpmFile, rpmsDirAbsPath)
+
+	if *buildManifestDir != "" {
+		err = buildmanifest.CommitPendingEntry(*buildManifestDir, *srpmFile)
+		logger.WarningOnError(err, "Failed to update the build manifest '%s' for SRPM '%s'.", *buildManifestDir, *srpmFile)
+	}
+}
+
+// writeResult saves a summary of the build's result.
+func writeResult(path, srpmFile, buildLogFile string, builtRPMs []string, attempts int, wallTime time.Duration, buildErr error) {
+	result := &buildreport.SrpmResult{
+		SrpmPath:        srpmFile,
+		Status:          buildreport.StatusBuilt,
+		Attempts:        attempts,
+		WallTimeSeconds: wallTime.Seconds(),
+		BuiltRPMs:       builtRPMs,
+		LogPath:         buildLogFile,
+	}
+
+	if buildErr != nil {
+		result.Status = buildreport.StatusFailed
+		result.BuiltRPMs = nil
+
+		if buildLogFile != "" {
+			result.FirstError, _ = buildreport.FirstErrorLine(buildLogFile)
+		}
+		if result.FirstError == "" {
+			result.FirstError = strings.SplitN(buildErr.Error(), "\n", 2)[0]
+		}
+	}
+
+	err := buildreport.WriteSrpmResult(path, result)
+	logger.WarningOnError(err, "Failed to write build result '%s'.", path)
 }
 
 func copySRPMToOutput(srpmFilePath, srpmOutputDirPath string) (err error) {
@@ -107,7 +204,12 @@ func copySRPMToOutput(srpmFilePath, srpmOutputDirPath string) (err error) {
 	return
 }
 
-func buildSRPMInChroot(chrootDir, rpmDirPath, workerTar, srpmFile, repoFile, rpmmacrosFile string, defines map[string]string, noCleanup bool, runCheck bool) (err error) {
+// buildSRPMInChroot builds an SRPM for targetArch inside a new chroot created from workerTar.
+// The packages in rpmDirPath are available to install BuildRequires from, the RPMs built are moved to outputDir.
+// buildEnv holds extra environment variables to set for rpmbuild.
+// If targetArch is not the host's architecture workerTar must contain a targetArch chroot,
+// its binaries are run using qemu-user-static.
+func buildSRPMInChroot(chrootDir, rpmDirPath, outputDir, workerTar, srpmFile, repoFile, rpmmacrosFile, targetArch string, defines map[string]string, buildEnv []string, noCleanup bool, runCheck bool) (builtRPMs []string, err error) {
 	const (
 		existingChrootDir = false
 		squashErrors      = false
@@ -134,24 +236,31 @@ func buildSRPMInChroot(chrootDir, rpmDirPath, workerTar, srpmFile, repoFile, rpm
 	}
 	defer chroot.Close(noCleanup)
 
+	err = chroot.RegisterQemuUserStatic(targetArch)
+	if err != nil {
+		return
+	}
+
 	// Place extra files that will be needed to build into the chroot
 	srpmFileInChroot, err := copyFilesIntoChroot(chroot, srpmFile, repoFile, rpmmacrosFile)
 	if err != nil {
 		return
 	}
 
-	var builtRPMs []string
-
 	err = chroot.Run(func() (err error) {
-		return buildRPMFromSRPMInChroot(srpmFileInChroot, runCheck, defines)
+		return buildRPMFromSRPMInChroot(srpmFileInChroot, runCheck, targetArch, defines, buildEnv)
 	})
 
+	if unresolvedErr, ok := err.(*unresolvedBuildRequiresError); ok {
+		unresolvedErr.report.SrpmPath = srpmFile
+	}
+
 	if err != nil {
 		return
 	}
 
 	rpmBuildOutputDir := filepath.Join(chroot.RootDir(), chrootRpmBuildRoot, rpmDirName)
-	builtRPMs, err = moveBuiltRPMs(rpmBuildOutputDir, rpmDirPath)
+	builtRPMs, err = moveBuiltRPMs(rpmBuildOutputDir, outputDir)
 	if err != nil {
 		return
 	}
@@ -161,7 +270,15 @@ func buildSRPMInChroot(chrootDir, rpmDirPath, workerTar, srpmFile, repoFile, rpm
 	return
 }
 
-func buildRPMFromSRPMInChroot(srpmFile string, runCheck bool, defines map[string]string) (err error) {
+func buildRPMFromSRPMInChroot(srpmFile string, runCheck bool, targetArch string, defines map[string]string, buildEnv []string) (err error) {
+	targetArgs := rpm.TargetArchArgs(targetArch)
+
+	// The chroot's environment is restored once the build is done
+	if len(buildEnv) > 0 {
+		env := append([]string{}, shell.CurrentEnvironment()...)
+		shell.SetEnvironment(append(env, buildEnv...))
+	}
+
 	// Convert /localrpms into a repository that a package manager can use
 	err = rpmrepomanager.CreateRepo(chrootLocalRpmsDir)
 	if err != nil {
@@ -175,7 +292,7 @@ func buildRPMFromSRPMInChroot(srpmFile string, runCheck bool, defines map[string
 	}
 
 	// Query and install the build requirements for this SRPM
-	err = installBuildRequires(defines)
+	err = installBuildRequires(targetArch, defines)
 	if err != nil {
 		return
 	}
@@ -191,9 +308,9 @@ func buildRPMFromSRPMInChroot(srpmFile string, runCheck bool, defines map[string
 
 	// Build the SRPM
 	if runCheck {
-		err = rpm.BuildRPMFromSRPM(srpmFile, defines)
+		err = rpm.BuildRPMFromSRPM(srpmFile, defines, targetArgs...)
 	} else {
-		err = rpm.BuildRPMFromSRPM(srpmFile, defines, "--nocheck")
+		err = rpm.BuildRPMFromSRPM(srpmFile, defines, append(targetArgs, "--nocheck")...)
 	}
 
 	return
@@ -236,12 +353,10 @@ func moveBuiltRPMs(rpmOutDir, dstDir string) (builtRPMs []string, err error) {
 	return
 }
 
-func installBuildRequires(defines map[string]string) (err error) {
+func installBuildRequires(targetArch string, defines map[string]string) (err error) {
 	// Query the BuildRequires fields from this spec and turn them into an array of PackageVersions
 	const (
 		emptyQueryFormat        = ""
-		unresolvedOutputPrefix  = "No package"
-		unresolvedOutputPostfix = "available"
 		alreadyInstalledPostfix = "is already installed."
 		noMatchingPackagesErr   = "Error(1011) : No matching packages"
 	)
@@ -259,7 +374,7 @@ func installBuildRequires(defines map[string]string) (err error) {
 	specFile := filepath.Join(specDir, allSpecFiles[0].Name())
 	logger.Log.Debugf("Querying SPEC (%s)", specFile)
 	sourceDir := filepath.Join(chrootRpmBuildRoot, "SOURCES")
-	buildRequires, err := rpm.QuerySPEC(specFile, sourceDir, emptyQueryFormat, defines, rpm.BuildRequiresArgument)
+	buildRequires, err := rpm.QuerySPEC(specFile, sourceDir, emptyQueryFormat, defines, append(rpm.TargetArchArgs(targetArch), rpm.BuildRequiresArgument)...)
 	if err != nil {
 		return
 	}
@@ -270,6 +385,9 @@ func installBuildRequires(defines map[string]string) (err error) {
 
 		installArgs = append(installArgs, defaultArgs...)
 
+		// Track which BuildRequires each tdnf argument came from so unresolved packages can be reported accurately.
+		installArgToBuildReq := make(map[string]string)
+
 		for _, pkg := range buildRequires {
 			// Replace version conditionals with tdnf friendly version:
 			// - replace >= with "latest" (no version)
@@ -277,9 +395,11 @@ func installBuildRequires(defines map[string]string) (err error) {
 			buildReq := greaterThanOrEqualRegex.ReplaceAllString(pkg, "")
 			buildReq = equalToRegex.ReplaceAllString(buildReq, "-")
 			buildReq = lessThanOrEqualToRegex.ReplaceAllString(buildReq, "-")
+			buildReq = strings.TrimSpace(buildReq)
 
 			// Add each package to the installArgs
-			installArgs = append(installArgs, strings.TrimSpace(buildReq))
+			installArgs = append(installArgs, buildReq)
+			installArgToBuildReq[buildReq] = pkg
 		}
 
 		var (
@@ -307,18 +427,88 @@ func installBuildRequires(defines map[string]string) (err error) {
 
 		if err == nil {
 			// TDNF will ignore unavailable packages that have been requested to be installed without reporting an error code.
-			// Search the stdout of TDNF for such a failure and warn the user.
-			// This may happen if a SPEC requires the the path to a tool (e.g. /bin/cp), so mark it as a warning for now.
-			splitStdout := strings.Split(stdout, "\n")
-			for _, line := range splitStdout {
-				trimmedLine := strings.TrimSpace(line)
+			// Search the stdout of TDNF for such failures and report every one of them.
+			err = findUnresolvedBuildRequires(stdout, installArgToBuildReq)
+		}
+	}
 
-				// If a package was not available, update err
-				if strings.HasPrefix(trimmedLine, unresolvedOutputPrefix) && strings.HasSuffix(trimmedLine, unresolvedOutputPostfix) {
-					logger.Log.Warnf("Unable to install buildrequires: %s", trimmedLine)
-				}
+	return
+}
+
+// findUnresolvedBuildRequires scans the output of a tdnf install for packages which were not available.
+// Returns an unresolvedBuildRequiresError listing every BuildRequires which could not be installed.
+//
+// A SPEC may require the path to a tool (e.g. /bin/cp) which no package explicitly provides,
+// such requirements are satisfied if the file is already present in the chroot.
+func findUnresolvedBuildRequires(tdnfOutput string, installArgToBuildReq map[string]string) (err error) {
+	const unresolvedReason = "no package providing it is available"
+
+	report := &buildreport.UnresolvedReport{}
+
+	splitStdout := strings.Split(tdnfOutput, "\n")
+	for _, line := range splitStdout {
+		trimmedLine := strings.TrimSpace(line)
+
+		matches := unresolvedPackageRegex.FindStringSubmatch(trimmedLine)
+		if len(matches) == 0 {
+			continue
+		}
+
+		installArg := matches[1]
+		if strings.HasPrefix(installArg, "/") {
+			exists, _ := file.PathExists(installArg)
+			if exists {
+				logger.Log.Debugf("No package provides (%s), but it is already present", installArg)
+				continue
 			}
 		}
+
+		buildReq, found := installArgToBuildReq[installArg]
+		if !found {
+			buildReq = installArg
+		}
+
+		logger.Log.Warnf("Unable to install buildrequires: %s", trimmedLine)
+		report.AddRequirement(parseBuildRequires(buildReq), unresolvedReason)
+	}
+
+	if len(report.Unresolved) > 0 {
+		err = &unresolvedBuildRequiresError{report: report}
+	}
+
+	return
+}
+
+// parseBuildRequires converts a single BuildRequires as reported by rpmspec (e.g. "foo >= 1.0" or "(foo or bar)") into a PackageVer.
+// A rich dependency which can't be parsed is kept whole as the PackageVer's name.
+func parseBuildRequires(buildReq string) (pkgVer *pkgjson.PackageVer) {
+	const (
+		nameField      = iota
+		conditionField = iota
+		versionField   = iota
+		fieldCount     = iota
+	)
+
+	if strings.HasPrefix(buildReq, "(") {
+		var err error
+		pkgVer, err = pkgjson.ParseRichDependency(buildReq)
+		if err != nil {
+			logger.Log.Warnf("Unable to parse BuildRequires (%s): %s", buildReq, err)
+			pkgVer = &pkgjson.PackageVer{Name: buildReq}
+		}
+		return
+	}
+
+	fields := strings.Fields(buildReq)
+	if len(fields) == 0 {
+		pkgVer = &pkgjson.PackageVer{Name: buildReq}
+		return
+	}
+
+	pkgVer = &pkgjson.PackageVer{Name: fields[nameField]}
+	if len(fields) == fieldCount {
+		pkgVer.Condition = fields[conditionField]
+		pkgVer.Version = fields[versionField]
 	}
 
 	return
@@ -0,0 +1,127 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"microsoft.com/pkggen/internal/buildreport"
+	"microsoft.com/pkggen/internal/logger"
+	"microsoft.com/pkggen/internal/rpm"
+	"microsoft.com/pkggen/internal/rpmcompare"
+)
+
+// reproducibleDefines are passed to rpmbuild so the RPMs built only depend on SOURCE_DATE_EPOCH.
+var reproducibleDefines = map[string]string{
+	"use_source_date_epoch_as_buildtime": "1",
+	"clamp_mtime_to_source_date_epoch":   "1",
+	"_buildhost":                         "reproducible",
+}
+
+// verifyReproducibleBuild builds an SRPM twice, each time in a new chroot with SOURCE_DATE_EPOCH set to the
+// time of the SPEC's latest changelog entry, and compares the RPMs produced by both builds.
+// A build which is not reproducible is reported but is not considered a failure.
+// The RPMs from the first build are moved to rpmDirPath.
+func verifyReproducibleBuild(chrootDir, rpmDirPath, workerTar, srpmFile, repoFile, rpmmacrosFile, targetArch, reportFile string, defines map[string]string, noCleanup bool, runCheck bool) (builtRPMs []string, err error) {
+	const (
+		secondChrootSuffix = "-second"
+		outputDirPrefix    = "reproducible-rpms"
+	)
+
+	epoch, err := sourceDateEpoch(srpmFile)
+	if err != nil {
+		return
+	}
+
+	buildDefines := make(map[string]string, len(defines)+len(reproducibleDefines))
+	for name, value := range defines {
+		buildDefines[name] = value
+	}
+	for name, value := range reproducibleDefines {
+		buildDefines[name] = value
+	}
+	buildEnv := []string{fmt.Sprintf("SOURCE_DATE_EPOCH=%d", epoch)}
+
+	firstOutputDir, err := ioutil.TempDir("", outputDirPrefix)
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(firstOutputDir)
+
+	secondOutputDir, err := ioutil.TempDir("", outputDirPrefix)
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(secondOutputDir)
+
+	logger.Log.Infof("Verifying (%s) builds reproducibly with SOURCE_DATE_EPOCH=%d", srpmFile, epoch)
+
+	_, err = buildSRPMInChroot(chrootDir, rpmDirPath, firstOutputDir, workerTar, srpmFile, repoFile, rpmmacrosFile, targetArch, buildDefines, buildEnv, noCleanup, runCheck)
+	if err != nil {
+		return
+	}
+
+	_, err = buildSRPMInChroot(chrootDir+secondChrootSuffix, rpmDirPath, secondOutputDir, workerTar, srpmFile, repoFile, rpmmacrosFile, targetArch, buildDefines, buildEnv, noCleanup, runCheck)
+	if err != nil {
+		return
+	}
+
+	differences, err := rpmcompare.CompareDirs(firstOutputDir, secondOutputDir)
+	if err != nil {
+		err = fmt.Errorf("failed to compare the builds of (%s). Error: %v", srpmFile, err)
+		return
+	}
+
+	if len(differences) == 0 {
+		logger.Log.Infof("(%s) built reproducibly", srpmFile)
+	} else {
+		var lines []string
+		for _, difference := range differences {
+			lines = append(lines, difference.String())
+		}
+		logger.Log.Warnf("(%s) did not build reproducibly, %d difference(s):\n%s", srpmFile, len(differences), strings.Join(lines, "\n"))
+	}
+
+	if reportFile != "" {
+		report := &buildreport.ReproducibilityReport{
+			SrpmPath:        srpmFile,
+			SourceDateEpoch: epoch,
+			Reproducible:    len(differences) == 0,
+			Differences:     differences,
+		}
+		reportErr := buildreport.WriteReproducibilityReport(reportFile, report)
+		logger.WarningOnError(reportErr, "Failed to write reproducibility report '%s'.", reportFile)
+	}
+
+	builtRPMs, err = moveBuiltRPMs(firstOutputDir, rpmDirPath)
+	return
+}
+
+// sourceDateEpoch returns the time of the latest changelog entry in an SRPM, as used for SOURCE_DATE_EPOCH.
+func sourceDateEpoch(srpmFile string) (epoch int64, err error) {
+	const (
+		queryFormat          = "%{CHANGELOGTIME}\n"
+		queryPackageArgument = "-p"
+	)
+
+	results, err := rpm.QueryPackage(srpmFile, queryFormat, nil, queryPackageArgument)
+	if err != nil {
+		return
+	}
+
+	if len(results) == 0 {
+		err = fmt.Errorf("unable to find a changelog entry in (%s)", srpmFile)
+		return
+	}
+
+	epoch, err = strconv.ParseInt(results[0], 10, 64)
+	if err != nil {
+		err = fmt.Errorf("unable to parse the changelog time (%s) of (%s). Error: %v", results[0], srpmFile, err)
+	}
+	return
+}
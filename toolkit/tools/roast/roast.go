@@ -16,6 +16,7 @@ import (
 	"microsoft.com/pkggen/internal/exe"
 	"microsoft.com/pkggen/internal/file"
 	"microsoft.com/pkggen/internal/logger"
+	"microsoft.com/pkggen/internal/sbom"
 	"microsoft.com/pkggen/roast/formats"
 )
 
@@ -113,12 +114,17 @@ func generateImageArtifacts(workers int, inDir, outDir, releaseVersion, imageTag
 
 	logger.Log.Infof("Converting (%d) artifacts", numberOfArtifacts)
 
+	sbomFiles, err := findSBOMs(inDir)
+	if err != nil {
+		return
+	}
+
 	convertRequests := make(chan *convertRequest, numberOfArtifacts)
 	convertedResults := make(chan *convertResult, numberOfArtifacts)
 
 	// Start the workers now so they begin working as soon as a new job is buffered.
 	for i := 0; i < workers; i++ {
-		go artifactConverterWorker(convertRequests, convertedResults, releaseVersion, tmpDir, imageTag, outDir)
+		go artifactConverterWorker(convertRequests, convertedResults, sbomFiles, releaseVersion, tmpDir, imageTag, outDir)
 	}
 
 	for i, disk := range config.Disks {
@@ -162,7 +168,9 @@ func generateImageArtifacts(workers int, inDir, outDir, releaseVersion, imageTag
 	return
 }
 
-func artifactConverterWorker(convertRequests chan *convertRequest, convertedResults chan *convertResult, releaseVersion, tmpDir, imageTag, outDir string) {
+// artifactConverterWorker converts each artifact sent on convertRequests and moves it to outDir.
+// Every SBOM in sbomFiles (format -> path) is copied next to the converted artifact.
+func artifactConverterWorker(convertRequests chan *convertRequest, convertedResults chan *convertResult, sbomFiles map[string]string, releaseVersion, tmpDir, imageTag, outDir string) {
 	const (
 		initrdArtifactType = "initrd"
 	)
@@ -217,7 +225,12 @@ func artifactConverterWorker(convertRequests chan *convertRequest, convertedResu
 			if err != nil {
 				logger.Log.Errorf("Failed to move (%s) to (%s). Error: %s", workingArtifactPath, finalFile, err)
 			} else {
-				result.convertedFile = finalFile
+				err = copySBOMs(sbomFiles, finalFile)
+				if err != nil {
+					logger.Log.Errorf("Failed to copy the SBOM for (%s). Error: %s", finalFile, err)
+				} else {
+					result.convertedFile = finalFile
+				}
 			}
 		}
 
@@ -225,6 +238,37 @@ func artifactConverterWorker(convertRequests chan *convertRequest, convertedResu
 	}
 }
 
+// findSBOMs returns the SBOMs written by the imager to inDir, keyed by their format.
+func findSBOMs(inDir string) (sbomFiles map[string]string, err error) {
+	sbomFiles = make(map[string]string)
+	for _, format := range sbom.Formats {
+		sbomFile := filepath.Join(inDir, sbom.FileBaseName+sbom.FileSuffix(format))
+
+		var exists bool
+		exists, err = file.PathExists(sbomFile)
+		if err != nil {
+			return
+		}
+
+		if exists {
+			logger.Log.Debugf("Found %s SBOM (%s)", format, sbomFile)
+			sbomFiles[format] = sbomFile
+		}
+	}
+	return
+}
+
+// copySBOMs copies each SBOM next to an artifact, named after the artifact.
+func copySBOMs(sbomFiles map[string]string, artifactFile string) (err error) {
+	for format, sbomFile := range sbomFiles {
+		err = file.Copy(sbomFile, artifactFile+sbom.FileSuffix(format))
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
 func convertArtifact(artifactName, outDir, format, imageTag, input string, isInputFile, appendExtension bool) (outputFile string, err error) {
 	typeConverter, err := converterFactory(format)
 	if err != nil {
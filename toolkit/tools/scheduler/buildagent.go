@@ -0,0 +1,172 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"microsoft.com/pkggen/internal/buildreport"
+	"microsoft.com/pkggen/internal/file"
+	"microsoft.com/pkggen/internal/logger"
+	"microsoft.com/pkggen/internal/shell"
+)
+
+// buildAgent holds the settings needed to build a single SRPM with the pkgworker tool.
+//
+// Each build is run in its own pkgworker process: a chroot applies to an entire process and
+// safechroot only allows one active chroot per process, so builds inside a single process would be serialized.
+type buildAgent struct {
+	pkgWorkerTool        string
+	workDir              string
+	workerTar            string
+	repoFile             string
+	rpmsDir              string
+	srpmsDir             string
+	cacheDir             string
+	buildLogsDir         string
+	rpmmacrosFile        string
+	distTag              string
+	distroReleaseVersion string
+	distroBuildNumber    string
+	retryAttempts        int
+	runCheck             bool
+	buildManifestDir     string
+	targetArch           string
+	verifyReproducible   bool
+	noCleanup            bool
+}
+
+// buildRequest asks for a single SRPM to be built.
+type buildRequest struct {
+	key       string // The key of the build nodes the request was made for
+	srpmPath  string // The SRPM to build
+	bootstrap bool   // Build the SRPM in bootstrap mode
+}
+
+// buildWorker builds each SRPM sent on buildRequests and reports the outcome on buildResults.
+// It will exit once buildRequests is closed.
+func buildWorker(agent *buildAgent, buildRequests <-chan *buildRequest, buildResults chan<- *buildResult) {
+	for request := range buildRequests {
+		result := &buildResult{key: request.key, srpmPath: request.srpmPath}
+		result.unresolved, result.err = agent.buildSRPM(request.srpmPath, request.bootstrap)
+		buildResults <- result
+	}
+}
+
+// buildSRPM builds a single SRPM using pkgworker. The output of the build is stored in its own log file.
+// If the build failed due to unresolved BuildRequires, the report generated by pkgworker is returned.
+// Bootstrap builds are always followed by a regular build of the SRPM, which records the build's result,
+// build manifest entry and reproducibility report.
+func (a *buildAgent) buildSRPM(srpmPath string, bootstrap bool) (unresolved *buildreport.UnresolvedReport, err error) {
+	const squashErrors = true
+
+	srpmName := filepath.Base(srpmPath)
+	buildLogFile := a.logFilePath(srpmPath)
+	reportFile := a.unresolvedReportPath(srpmPath)
+	if bootstrap {
+		buildLogFile = a.bootstrapLogFilePath(srpmPath)
+	}
+
+	// Remove any report left behind by a previous attempt, pkgworker only writes one on failure.
+	err = os.RemoveAll(reportFile)
+	if err != nil {
+		return
+	}
+
+	args := []string{
+		fmt.Sprintf("--input=%s", srpmPath),
+		fmt.Sprintf("--work-dir=%s", a.workDir),
+		fmt.Sprintf("--worker-tar=%s", a.workerTar),
+		fmt.Sprintf("--repo-file=%s", a.repoFile),
+		fmt.Sprintf("--rpms-dir=%s", a.rpmsDir),
+		fmt.Sprintf("--srpms-dir=%s", a.srpmsDir),
+		fmt.Sprintf("--cache-dir=%s", a.cacheDir),
+		fmt.Sprintf("--dist-tag=%s", a.distTag),
+		fmt.Sprintf("--distro-release-version=%s", a.distroReleaseVersion),
+		fmt.Sprintf("--distro-build-number=%s", a.distroBuildNumber),
+		fmt.Sprintf("--retry-attempts=%d", a.retryAttempts),
+		fmt.Sprintf("--unresolved-report=%s", reportFile),
+		fmt.Sprintf("--log-file=%s", buildLogFile),
+	}
+
+	if bootstrap {
+		args = append(args, "--bootstrap")
+	} else {
+		args = append(args, fmt.Sprintf("--result-file=%s", buildreport.ResultFilePath(a.buildLogsDir, srpmPath)))
+	}
+
+	if a.rpmmacrosFile != "" {
+		args = append(args, fmt.Sprintf("--rpmmacros-file=%s", a.rpmmacrosFile))
+	}
+
+	if a.runCheck {
+		args = append(args, "--run-check")
+	}
+
+	if a.buildManifestDir != "" && !bootstrap {
+		args = append(args, fmt.Sprintf("--build-manifest-dir=%s", a.buildManifestDir))
+	}
+
+	if a.targetArch != "" {
+		args = append(args, fmt.Sprintf("--target-arch=%s", a.targetArch))
+	}
+
+	if a.verifyReproducible && !bootstrap {
+		args = append(args, "--verify-reproducible", fmt.Sprintf("--reproducibility-report=%s", buildreport.ReproducibilityReportPath(a.buildLogsDir, srpmPath)))
+	}
+
+	if a.noCleanup {
+		args = append(args, "--no-cleanup")
+	}
+
+	if bootstrap {
+		logger.Log.Infof("Building (%s) in bootstrap mode", srpmName)
+	} else {
+		logger.Log.Infof("Building (%s)", srpmName)
+	}
+	err = shell.ExecuteLive(squashErrors, a.pkgWorkerTool, args...)
+	if err == nil {
+		return
+	}
+
+	err = fmt.Errorf("%s. For details see log file: %s", err, buildLogFile)
+
+	reportExists, _ := file.PathExists(reportFile)
+	if reportExists {
+		var reportErr error
+		unresolved, reportErr = buildreport.ReadUnresolvedReport(reportFile)
+		if reportErr != nil {
+			logger.Log.Warnf("Failed to read unresolved BuildRequires report '%s'. Error: %s", reportFile, reportErr)
+			unresolved = nil
+		}
+	}
+
+	return
+}
+
+// logFilePath returns the path of the log file for an SRPM's build.
+func (a *buildAgent) logFilePath(srpmPath string) string {
+	return filepath.Join(a.buildLogsDir, fmt.Sprintf("%s.log", filepath.Base(srpmPath)))
+}
+
+// bootstrapLogFilePath returns the path of the log file for the bootstrap build of an SRPM.
+func (a *buildAgent) bootstrapLogFilePath(srpmPath string) string {
+	return filepath.Join(a.buildLogsDir, fmt.Sprintf("%s.bootstrap.log", filepath.Base(srpmPath)))
+}
+
+// writeBlockedResult records that an SRPM was never built because one of its dependencies failed.
+func (a *buildAgent) writeBlockedResult(srpmPath string) (err error) {
+	result := &buildreport.SrpmResult{
+		SrpmPath: srpmPath,
+		Status:   buildreport.StatusBlocked,
+	}
+	return buildreport.WriteSrpmResult(buildreport.ResultFilePath(a.buildLogsDir, srpmPath), result)
+}
+
+// unresolvedReportPath returns the path of the unresolved BuildRequires report for an SRPM's build.
+func (a *buildAgent) unresolvedReportPath(srpmPath string) string {
+	return filepath.Join(a.buildLogsDir, fmt.Sprintf("%s.unresolved.json", filepath.Base(srpmPath)))
+}
@@ -0,0 +1,227 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"gonum.org/v1/gonum/graph/topo"
+	"microsoft.com/pkggen/internal/buildreport"
+	"microsoft.com/pkggen/internal/logger"
+	"microsoft.com/pkggen/internal/packagerepo/repocloner/rpmrepocloner"
+	"microsoft.com/pkggen/internal/pkggraph"
+	"microsoft.com/pkggen/internal/pkgjson"
+)
+
+// Reasons reported for BuildRequires which could not be satisfied.
+const (
+	reasonNotInGraph        = "no node in the package graph provides it and fetching from remote repositories is disabled"
+	reasonProvidedBySelf    = "it is only provided by the SRPM being built"
+	reasonProviderFailed    = "the SRPM providing it failed to build"
+	reasonProviderBlocked   = "the SRPM providing it is blocked by a failed build"
+	reasonProviderCycle     = "the SRPM providing it depends on the SRPM being built"
+	reasonAlreadyAttempted  = "it is still unavailable after being resolved once"
+	reasonFetchFailedFormat = "failed to fetch it from the remote repositories: %s"
+)
+
+// remoteFetcher holds the settings needed to fetch packages from remote repositories.
+type remoteFetcher struct {
+	destinationDir       string
+	tmpDir               string
+	workerTar            string
+	existingRpmsDir      string
+	repoFiles            []string
+	tlsClientCert        string
+	tlsClientKey         string
+	useUpdateRepo        bool
+	usePreviewRepo       bool
+	disableUpstreamRepos bool
+}
+
+// dependencyResolver attempts to satisfy the BuildRequires a package worker could not install.
+// A requirement is satisfied by either scheduling the local SRPM which provides it ahead of the
+// failed build, or by fetching a package which provides it into the cache directory.
+type dependencyResolver struct {
+	pkgGraph  *pkggraph.PkgGraph
+	fetcher   *remoteFetcher               // Optional, remote fetching is disabled if nil
+	cloner    *rpmrepocloner.RpmRepoCloner // Lazily initialized on the first fetch
+	clonerErr error                        // Set if the cloner failed to initialize, no further attempts are made
+	attempted map[string]map[string]bool   // Requirements which have already been resolved, per SRPM
+}
+
+// newDependencyResolver creates a dependencyResolver for pkgGraph. fetcher may be nil to disable fetching remote packages.
+func newDependencyResolver(pkgGraph *pkggraph.PkgGraph, fetcher *remoteFetcher) *dependencyResolver {
+	return &dependencyResolver{
+		pkgGraph:  pkgGraph,
+		fetcher:   fetcher,
+		attempted: make(map[string]map[string]bool),
+	}
+}
+
+// resolve attempts to satisfy every requirement in an unresolved report for the build of key.
+// Returns the keys of the local builds which must finish before key is rebuilt, and a report of
+// every requirement which could not be satisfied. If the report is empty the build should be retried.
+func (r *dependencyResolver) resolve(state *buildState, key string, report *buildreport.UnresolvedReport) (providerKeys []string, unresolved *buildreport.UnresolvedReport) {
+	unresolved = &buildreport.UnresolvedReport{SrpmPath: report.SrpmPath}
+	var fetched []*pkgjson.PackageVer
+
+	attempted, found := r.attempted[report.SrpmPath]
+	if !found {
+		attempted = make(map[string]bool)
+		r.attempted[report.SrpmPath] = attempted
+	}
+
+	for _, requirement := range report.Unresolved {
+		pkgVer := requirement.Requirement
+		requirementName := buildreport.FormatRequirement(pkgVer)
+
+		if attempted[requirementName] {
+			unresolved.AddRequirement(pkgVer, reasonAlreadyAttempted)
+			continue
+		}
+		attempted[requirementName] = true
+
+		providerKey, reason := r.scheduleProvider(state, key, pkgVer)
+		if providerKey != "" {
+			logger.Log.Infof("Scheduling (%s) before (%s) to provide '%s'", providerKey, key, requirementName)
+			providerKeys = append(providerKeys, providerKey)
+			continue
+		}
+
+		if reason == "" {
+			reason = r.fetch(pkgVer)
+			if reason == "" {
+				logger.Log.Infof("Fetched a package providing '%s' for (%s)", requirementName, report.SrpmPath)
+				fetched = append(fetched, pkgVer)
+				continue
+			}
+		}
+
+		unresolved.AddRequirement(pkgVer, reason)
+	}
+
+	if len(fetched) > 0 {
+		err := r.cloner.ConvertDownloadedPackagesIntoRepo()
+		if err != nil {
+			logger.Log.Errorf("Failed to convert downloaded RPMs into a repo. Error: %s", err)
+			for _, pkgVer := range fetched {
+				unresolved.AddRequirement(pkgVer, fmt.Sprintf(reasonFetchFailedFormat, err))
+			}
+		}
+	}
+
+	return
+}
+
+// scheduleProvider looks up the local build which provides pkgVer and makes key depend on it.
+// Returns the key of the provider, or a reason if the requirement can not be satisfied by a local build.
+// Returns neither if no local build provides the requirement.
+func (r *dependencyResolver) scheduleProvider(state *buildState, key string, pkgVer *pkgjson.PackageVer) (providerKey, reason string) {
+	lookupEntry, err := r.pkgGraph.FindBestPkgNode(pkgVer)
+	if err != nil {
+		logger.Log.Warnf("Failed to lookup '%s' in the graph. Error: %s", pkgVer.Name, err)
+		return
+	}
+
+	if lookupEntry == nil || lookupEntry.BuildNode == nil {
+		return
+	}
+
+	switch lookupEntry.BuildNode.State {
+	case pkggraph.StateBuild:
+	case pkggraph.StateBuildError:
+		reason = reasonProviderFailed
+		return
+	case pkggraph.StateBlocked:
+		reason = reasonProviderBlocked
+		return
+	default:
+		// The provider is already available, it can only be fetched.
+		return
+	}
+
+	candidateKey := nodeKey(lookupEntry.BuildNode)
+	if candidateKey == key {
+		reason = reasonProvidedBySelf
+		return
+	}
+
+	buildNodes := state.keyToNodes[key]
+	for _, buildNode := range buildNodes {
+		if topo.PathExistsIn(r.pkgGraph, lookupEntry.RunNode, buildNode) {
+			reason = reasonProviderCycle
+			return
+		}
+	}
+
+	// Record the missing dependency in the graph so the saved graph reflects the real build order.
+	for _, buildNode := range buildNodes {
+		r.pkgGraph.SetEdge(r.pkgGraph.NewEdge(buildNode, lookupEntry.RunNode))
+	}
+
+	providerKey = candidateKey
+	return
+}
+
+// fetch downloads a package providing pkgVer into the cache directory. Returns a reason if the fetch failed.
+func (r *dependencyResolver) fetch(pkgVer *pkgjson.PackageVer) (reason string) {
+	const cloneDeps = true
+
+	if r.fetcher == nil {
+		reason = reasonNotInGraph
+		return
+	}
+
+	err := r.initializeCloner()
+	if err == nil {
+		err = r.cloner.SearchAndClone(cloneDeps, pkgVer)
+	}
+
+	if err != nil {
+		reason = fmt.Sprintf(reasonFetchFailedFormat, err)
+	}
+
+	return
+}
+
+// initializeCloner creates the RPM repo cloner used to fetch remote packages if it does not exist yet.
+func (r *dependencyResolver) initializeCloner() (err error) {
+	if r.cloner != nil || r.clonerErr != nil {
+		return r.clonerErr
+	}
+
+	defer func() {
+		r.clonerErr = err
+	}()
+
+	f := r.fetcher
+	cloner := rpmrepocloner.New()
+	// Initialize will cleanup after itself on failure.
+	err = cloner.Initialize(f.destinationDir, f.tmpDir, f.workerTar, f.existingRpmsDir, f.useUpdateRepo, f.usePreviewRepo, f.repoFiles)
+	if err != nil {
+		logger.Log.Errorf("Failed to initialize RPM repo cloner. Error: %s", err)
+		return
+	}
+
+	if !f.disableUpstreamRepos {
+		tlsKey, tlsCert := strings.TrimSpace(f.tlsClientKey), strings.TrimSpace(f.tlsClientCert)
+		err = cloner.AddNetworkFiles(tlsCert, tlsKey)
+		if err != nil {
+			logger.Log.Errorf("Failed to customize RPM repo cloner. Error: %s", err)
+			cloner.Close()
+			return
+		}
+	}
+
+	r.cloner = cloner
+	return
+}
+
+// close releases the RPM repo cloner, if one was created.
+func (r *dependencyResolver) close() {
+	if r.cloner != nil {
+		r.cloner.Close()
+	}
+}
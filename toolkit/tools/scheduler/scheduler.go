@@ -0,0 +1,402 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+// scheduler is a tool to build all the SRPMs in a package graph in dependency order
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+	"microsoft.com/pkggen/internal/buildreport"
+	"microsoft.com/pkggen/internal/exe"
+	"microsoft.com/pkggen/internal/logger"
+	"microsoft.com/pkggen/internal/pkggraph"
+	"microsoft.com/pkggen/unravel/formats"
+)
+
+const (
+	defaultRetryAttempts = "1"
+	buildKeyPrefix       = "BUILD_"
+	bootstrapKeyPrefix   = "BOOTSTRAP_"
+)
+
+var (
+	app = kingpin.New("scheduler", "A tool to build the SRPMs in a dependency graph using a pool of package workers.")
+
+	inputGraphFile  = exe.InputFlag(app, "Path to the DOT graph file to build.")
+	outputGraphFile = exe.OutputFlag(app, "Path to save the DOT graph file with updated build states.")
+
+	workers       = app.Flag("workers", "Number of concurrent package builds.").Default(strconv.Itoa(runtime.NumCPU())).Int()
+	stopOnFailure = app.Flag("stop-on-failure", "Stop scheduling new builds after the first package build failure.").Bool()
+
+	pkgWorkerTool        = app.Flag("pkg-worker", "Full path to the pkgworker tool.").Required().ExistingFile()
+	workDir              = app.Flag("work-dir", "The directory to create the build folders in.").Required().String()
+	workerTar            = app.Flag("worker-tar", "Full path to worker_chroot.tar.gz").Required().ExistingFile()
+	repoFile             = app.Flag("repo-file", "Full path to local.repo").Required().ExistingFile()
+	rpmsDir              = app.Flag("rpms-dir", "The directory to use as the local repo and to submit RPM packages to").Required().ExistingDir()
+	srpmsDir             = app.Flag("srpms-dir", "The output directory for source RPM packages").Required().String()
+	cacheDir             = app.Flag("cache-dir", "The cache directory containing downloaded dependency RPMS from CBL-Mariner Base").Required().ExistingDir()
+	buildLogsDir         = app.Flag("build-logs-dir", "Directory to store the log of each package build in.").Required().String()
+	noCleanup            = app.Flag("no-cleanup", "Whether or not to delete the choot folders after the builds are done").Bool()
+	distTag              = app.Flag("dist-tag", "The distribution tag the SPEC will be built with.").Required().String()
+	distroReleaseVersion = app.Flag("distro-release-version", "The distro release version that the SRPM will be built with").Required().String()
+	distroBuildNumber    = app.Flag("distro-build-number", "The distro build number that the SRPM will be built with").Required().String()
+	rpmmacrosFile        = app.Flag("rpmmacros-file", "Optional file path to an rpmmacros file for rpmbuild to use").ExistingFile()
+	retryAttempts        = app.Flag("retry-attempts", "Sets the number of times pkgworker will retry building a package").Default(defaultRetryAttempts).Int()
+	runCheck             = app.Flag("run-check", "Run the check during package builds").Bool()
+	buildManifestDir     = app.Flag("build-manifest-dir", "Optional build manifest directory for pkgworker to record successful builds in").String()
+	targetArch           = exe.TargetArchFlag(app)
+	verifyReproducible   = app.Flag("verify-reproducible", "Build each package twice and verify the builds are reproducible").Bool()
+
+	fetchRepoFiles       = app.Flag("fetch-repo-file", "Full path to a repo file to fetch unresolved BuildRequires from. Fetching is disabled if none are provided").ExistingFiles()
+	fetchTmpDir          = app.Flag("fetch-tmp-dir", "Directory to store temporary files while fetching unresolved BuildRequires.").String()
+	useUpdateRepo        = app.Flag("use-update-repo", "Fetch packages from the upstream update repo").Bool()
+	usePreviewRepo       = app.Flag("use-preview-repo", "Fetch packages from the upstream preview repo").Bool()
+	disableUpstreamRepos = app.Flag("disable-upstream-repos", "Disables fetching packages from upstream repos").Bool()
+	tlsClientCert        = app.Flag("tls-cert", "TLS client certificate to use when downloading files.").String()
+	tlsClientKey         = app.Flag("tls-key", "TLS client key to use when downloading files.").String()
+
+	logFile  = exe.LogFileFlag(app)
+	logLevel = exe.LogLevelFlag(app)
+)
+
+// buildResult is the outcome of a single SRPM build.
+type buildResult struct {
+	key        string
+	srpmPath   string
+	err        error
+	unresolved *buildreport.UnresolvedReport // Set if the build failed due to unresolved BuildRequires
+}
+
+func main() {
+	app.Version(exe.ToolkitVersion)
+	kingpin.MustParse(app.Parse(os.Args[1:]))
+	logger.InitBestEffort(*logFile, *logLevel)
+
+	if *workers <= 0 {
+		logger.Log.Panicf("Value in --workers must be greater than zero. Found %d", *workers)
+	}
+
+	pkgGraph := pkggraph.NewPkgGraph()
+	err := pkggraph.ReadDOTGraphFile(pkgGraph, *inputGraphFile)
+	logger.PanicOnError(err, "Failed to read graph file '%s'.", *inputGraphFile)
+
+	// Results of SRPMs which are not rebuilt this time would otherwise end up in the build summary.
+	err = buildreport.RemoveResultFiles(*buildLogsDir)
+	logger.PanicOnError(err, "Failed to remove previous build results from '%s'.", *buildLogsDir)
+
+	agent := &buildAgent{
+		pkgWorkerTool:        *pkgWorkerTool,
+		workDir:              *workDir,
+		workerTar:            *workerTar,
+		repoFile:             *repoFile,
+		rpmsDir:              *rpmsDir,
+		srpmsDir:             *srpmsDir,
+		cacheDir:             *cacheDir,
+		buildLogsDir:         *buildLogsDir,
+		rpmmacrosFile:        *rpmmacrosFile,
+		distTag:              *distTag,
+		distroReleaseVersion: *distroReleaseVersion,
+		distroBuildNumber:    *distroBuildNumber,
+		retryAttempts:        *retryAttempts,
+		runCheck:             *runCheck,
+		buildManifestDir:     *buildManifestDir,
+		targetArch:           *targetArch,
+		verifyReproducible:   *verifyReproducible,
+		noCleanup:            *noCleanup,
+	}
+
+	var fetcher *remoteFetcher
+	if len(*fetchRepoFiles) > 0 {
+		fetcher = &remoteFetcher{
+			destinationDir:       *cacheDir,
+			tmpDir:               *fetchTmpDir,
+			workerTar:            *workerTar,
+			existingRpmsDir:      *rpmsDir,
+			repoFiles:            *fetchRepoFiles,
+			tlsClientCert:        *tlsClientCert,
+			tlsClientKey:         *tlsClientKey,
+			useUpdateRepo:        *useUpdateRepo,
+			usePreviewRepo:       *usePreviewRepo,
+			disableUpstreamRepos: *disableUpstreamRepos,
+		}
+	}
+
+	resolver := newDependencyResolver(pkgGraph, fetcher)
+	failedSRPMs, buildErr := buildGraph(pkgGraph, agent, resolver, *workers, *stopOnFailure)
+	resolver.close()
+
+	// Always save the graph, it records which packages were built and which failed.
+	err = pkggraph.WriteDOTGraphFile(pkgGraph, *outputGraphFile)
+	logger.PanicOnError(err, "Failed to write graph file '%s'.", *outputGraphFile)
+
+	logger.PanicOnError(buildErr, "Failed to build all packages. Failed SRPMs: %v", failedSRPMs)
+	logger.Log.Info("Successfully built all packages.")
+}
+
+// nodeKey groups every build node of an SRPM into a single unit of work, while every other
+// node is tracked on its own. This mirrors how the workplan Makefile names its targets.
+// The bootstrap build of an SRPM is a separate unit of work from its regular build.
+func nodeKey(n *pkggraph.PkgNode) string {
+	if n.Type == pkggraph.TypeBuild {
+		if n.Bootstrap {
+			return bootstrapKeyPrefix + n.SrpmPath
+		}
+		return buildKeyPrefix + n.SrpmPath
+	}
+	return fmt.Sprintf("%s_%d", n.Type.String(), n.ID())
+}
+
+// buildNodesByKey returns every build node in the graph which still needs to be built, grouped by nodeKey.
+func buildNodesByKey(pkgGraph *pkggraph.PkgGraph) (keyToNodes map[string][]*pkggraph.PkgNode) {
+	keyToNodes = make(map[string][]*pkggraph.PkgNode)
+	for _, n := range pkgGraph.AllNodes() {
+		if n.Type == pkggraph.TypeBuild && n.State == pkggraph.StateBuild {
+			key := nodeKey(n)
+			keyToNodes[key] = append(keyToNodes[key], n)
+		}
+	}
+	return
+}
+
+// buildState tracks the progress of building a graph.
+type buildState struct {
+	blocking   formats.BlockPkgsList          // Keys which are blocking a given key
+	blockedBy  formats.BlockPkgsList          // Keys a given key is still waiting on
+	keyToNodes map[string][]*pkggraph.PkgNode // Build nodes which still need to be built, grouped by key
+	queued     map[string]bool                // Keys which have already been added to readyKeys
+	readyKeys  []string                       // Keys which are no longer blocked, in the order they should be processed
+}
+
+// newBuildState creates a buildState for every node in pkgGraph.
+func newBuildState(pkgGraph *pkggraph.PkgGraph) (state *buildState) {
+	blocking, blockedBy := formats.GraphToMapsByKey(pkgGraph, nodeKey)
+	state = &buildState{
+		blocking:   blocking,
+		blockedBy:  blockedBy,
+		keyToNodes: buildNodesByKey(pkgGraph),
+		queued:     make(map[string]bool),
+	}
+
+	allKeys := make([]string, 0, len(blockedBy))
+	for key := range blockedBy {
+		allKeys = append(allKeys, key)
+	}
+	state.queueReady(allKeys)
+
+	return
+}
+
+// queueReady adds every key which is no longer blocked by anything to the ready list.
+func (s *buildState) queueReady(keys []string) {
+	sort.Strings(keys)
+	for _, key := range keys {
+		if !s.queued[key] && len(s.blockedBy[key]) == 0 {
+			s.queued[key] = true
+			s.readyKeys = append(s.readyKeys, key)
+		}
+	}
+}
+
+// nextReady pops the next unblocked key. Returns false if nothing is ready.
+func (s *buildState) nextReady() (key string, found bool) {
+	if len(s.readyKeys) == 0 {
+		return
+	}
+	key, s.readyKeys = s.readyKeys[0], s.readyKeys[1:]
+	found = true
+	return
+}
+
+// markDone removes a satisfied key, unblocking anything which was waiting on it.
+func (s *buildState) markDone(key string) {
+	unblocked := make([]string, 0, len(s.blocking[key]))
+	for dependant := range s.blocking[key] {
+		delete(s.blockedBy[dependant], key)
+		unblocked = append(unblocked, dependant)
+	}
+	delete(s.blocking, key)
+	delete(s.blockedBy, key)
+	s.queueReady(unblocked)
+}
+
+// addDependency blocks key until dependency is done. key must not be queued.
+func (s *buildState) addDependency(key, dependency string) {
+	if s.blocking[dependency] == nil {
+		s.blocking[dependency] = make(formats.BlockingPkgs)
+	}
+	if s.blockedBy[key] == nil {
+		s.blockedBy[key] = make(formats.BlockingPkgs)
+	}
+	s.blocking[dependency][key] = true
+	s.blockedBy[key][dependency] = true
+}
+
+// requeue allows a key which was already processed to be processed again once it is no longer blocked.
+func (s *buildState) requeue(key string) {
+	s.queued[key] = false
+	s.queueReady([]string{key})
+}
+
+// setNodesState updates the state of every build node belonging to key.
+func (s *buildState) setNodesState(key string, state pkggraph.NodeState) {
+	for _, n := range s.keyToNodes[key] {
+		n.State = state
+	}
+}
+
+// buildGraph walks the graph leaves-first and builds every SRPM which is marked as StateBuild.
+// A build is only dispatched once everything it depends on is satisfied, at most `workers` builds run at once.
+// If a build fails due to unresolved BuildRequires, resolver is used to satisfy them and the build is retried.
+// Nodes of successfully built SRPMs are marked StateUpToDate, nodes of failed SRPMs are marked StateBuildError.
+// Anything depending on a failed SRPM is marked StateBlocked.
+func buildGraph(pkgGraph *pkggraph.PkgGraph, agent *buildAgent, resolver *dependencyResolver, workers int, stopOnFailure bool) (failedSRPMs []string, err error) {
+	var (
+		builtCount   int
+		activeBuilds int
+		stopping     bool
+	)
+
+	state := newBuildState(pkgGraph)
+	totalBuilds := len(state.keyToNodes)
+	logger.Log.Infof("Scheduling %d SRPM builds with %d workers", totalBuilds, workers)
+
+	// Every SRPM may be requested more than once if its BuildRequires have to be resolved,
+	// at most `workers` requests and results are pending at any given time.
+	buildRequests := make(chan *buildRequest, workers)
+	buildResults := make(chan *buildResult, workers)
+	defer close(buildRequests)
+
+	for i := 0; i < workers; i++ {
+		go buildWorker(agent, buildRequests, buildResults)
+	}
+
+	for {
+		// Dispatch everything that is ready, nodes which do not need a build are satisfied immediately.
+		for !stopping && activeBuilds < workers {
+			key, found := state.nextReady()
+			if !found {
+				break
+			}
+
+			nodes, needsBuild := state.keyToNodes[key]
+			if !needsBuild {
+				state.markDone(key)
+				continue
+			}
+
+			activeBuilds++
+			buildRequests <- &buildRequest{
+				key:       key,
+				srpmPath:  nodes[0].SrpmPath,
+				bootstrap: nodes[0].Bootstrap,
+			}
+		}
+
+		if activeBuilds == 0 {
+			break
+		}
+
+		result := <-buildResults
+		activeBuilds--
+		key := result.key
+
+		if result.err != nil && result.unresolved != nil && !stopping {
+			if resolveBuildRequires(state, resolver, agent, key, result.unresolved) {
+				continue
+			}
+		}
+
+		if result.err != nil {
+			logger.Log.Errorf("Failed to build SRPM '%s'. Error: %s", result.srpmPath, result.err)
+			failedSRPMs = append(failedSRPMs, result.srpmPath)
+			state.setNodesState(key, pkggraph.StateBuildError)
+			blockDependants(pkgGraph, state.keyToNodes[key])
+
+			if stopOnFailure && !stopping {
+				logger.Log.Warnf("--stop-on-failure set, waiting for %d active builds to finish", activeBuilds)
+				stopping = true
+			}
+			continue
+		}
+
+		builtCount++
+		logger.Log.Infof("Built SRPM '%s' (%d/%d)", result.srpmPath, builtCount, totalBuilds)
+		state.setNodesState(key, pkggraph.StateUpToDate)
+		state.markDone(key)
+	}
+
+	writeBlockedResults(agent, state)
+
+	unbuiltCount := totalBuilds - builtCount - len(failedSRPMs)
+	if len(failedSRPMs) > 0 {
+		sort.Strings(failedSRPMs)
+		err = fmt.Errorf("%d SRPMs failed to build, %d SRPMs were not built", len(failedSRPMs), unbuiltCount)
+		return
+	}
+
+	if unbuiltCount > 0 {
+		err = fmt.Errorf("%d SRPMs could not be scheduled, the graph may contain a cycle", unbuiltCount)
+	}
+
+	return
+}
+
+// writeBlockedResults saves a build result for every SRPM which was never built.
+func writeBlockedResults(agent *buildAgent, state *buildState) {
+	for _, nodes := range state.keyToNodes {
+		n := nodes[0]
+		if n.State == pkggraph.StateUpToDate || n.State == pkggraph.StateBuildError {
+			continue
+		}
+
+		// Results are only recorded for regular builds, which always follow a bootstrap build
+		if n.Bootstrap {
+			continue
+		}
+
+		err := agent.writeBlockedResult(n.SrpmPath)
+		logger.WarningOnError(err, "Failed to write the build result of '%s'.", n.SrpmPath)
+	}
+}
+
+// blockDependants marks everything depending on the failed build nodes as blocked.
+func blockDependants(pkgGraph *pkggraph.PkgGraph, failedNodes []*pkggraph.PkgNode) {
+	for _, n := range failedNodes {
+		blockedNodes, err := pkgGraph.MarkDependantsBlocked(n)
+		if err != nil {
+			logger.Log.Warnf("Failed to block the dependants of '%s'. Error: %s", n.FriendlyName(), err)
+			continue
+		}
+		logger.Log.Debugf("%d nodes are blocked by '%s'", len(blockedNodes), n.FriendlyName())
+	}
+}
+
+// resolveBuildRequires attempts to satisfy the unresolved BuildRequires of a failed build.
+// Returns true if the build of key has been requeued, otherwise the remaining unresolved
+// requirements are logged and saved next to the build's log.
+func resolveBuildRequires(state *buildState, resolver *dependencyResolver, agent *buildAgent, key string, report *buildreport.UnresolvedReport) (requeued bool) {
+	providerKeys, unresolved := resolver.resolve(state, key, report)
+	if len(unresolved.Unresolved) > 0 {
+		logger.Log.Error(unresolved.String())
+
+		reportPath := agent.unresolvedReportPath(report.SrpmPath)
+		err := buildreport.WriteUnresolvedReport(reportPath, unresolved)
+		logger.WarningOnError(err, "Failed to write unresolved BuildRequires report '%s'.", reportPath)
+		return
+	}
+
+	for _, providerKey := range providerKeys {
+		state.addDependency(key, providerKey)
+	}
+	state.requeue(key)
+
+	requeued = true
+	return
+}
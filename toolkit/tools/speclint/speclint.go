@@ -0,0 +1,124 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+// speclint is a tool to find common problems in SPEC files before they are built
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+	"microsoft.com/pkggen/internal/exe"
+	"microsoft.com/pkggen/internal/logger"
+	"microsoft.com/pkggen/internal/rpm"
+	"microsoft.com/pkggen/internal/speclint"
+	"microsoft.com/pkggen/internal/specparser"
+)
+
+const (
+	formatText  = "text"
+	formatJSON  = "json"
+	formatSARIF = "sarif"
+)
+
+const (
+	failOnError   = "error"
+	failOnWarning = "warning"
+	failOnNever   = "never"
+)
+
+var (
+	app = kingpin.New("speclint", "Checks every SPEC for missing source signatures, Releases without the dist tag, BuildRequires nothing provides, duplicate Provides and Names which don't match their directory.")
+
+	dir        = exe.InputDirFlag(app, "Directory to scan for SPECS")
+	macroDir   = app.Flag("macro-dir", "Directory containing rpm macros.").Default("").String()
+	targetArch = exe.TargetArchFlag(app)
+
+	disabledRules = app.Flag("disable-rules", "Space separated list of rules to skip.").String()
+
+	output = app.Flag("output", "Optional path to save the report to. Defaults to stdout.").String()
+
+	legalFormats = []string{formatText, formatJSON, formatSARIF}
+	format       = app.Flag("format", "Format to render the report in.").PlaceHolder(exe.PlaceHolderize(legalFormats)).Default(formatText).Enum(legalFormats...)
+
+	legalFailOn = []string{failOnError, failOnWarning, failOnNever}
+	failOn      = app.Flag("fail-on", "Lowest severity of finding which makes the tool fail.").PlaceHolder(exe.PlaceHolderize(legalFailOn)).Default(failOnError).Enum(legalFailOn...)
+
+	logFile  = exe.LogFileFlag(app)
+	logLevel = exe.LogLevelFlag(app)
+)
+
+func main() {
+	app.Version(exe.ToolkitVersion)
+	kingpin.MustParse(app.Parse(os.Args[1:]))
+	logger.InitBestEffort(*logFile, *logLevel)
+
+	rules, err := speclint.SelectRules(speclint.DefaultRules(), exe.ParseListArgument(*disabledRules))
+	logger.PanicOnError(err, "Invalid --disable-rules.")
+
+	buildArch, err := rpm.ResolveTargetArch(*targetArch)
+	logger.PanicOnError(err, "Unable to determine the target architecture. Error: %v", err)
+
+	parser := specparser.NewParser(buildArch)
+	if *macroDir != "" {
+		err = parser.LoadMacroDir(*macroDir)
+		logger.PanicOnError(err, "Unable to load the rpm macros in (%s). Error: %v", *macroDir, err)
+	}
+
+	specFiles, err := filepath.Glob(filepath.Join(*dir, "**/*.spec"))
+	logger.PanicOnError(err, "Failed to find *.spec files. Check that %s is the correct directory. Error: %v", *dir, err)
+
+	logger.Log.Infof("Linting %d SPECs with %d rules", len(specFiles), len(rules))
+	report := speclint.Lint(speclint.LoadSpecs(parser, specFiles), rules)
+
+	out := os.Stdout
+	if *output != "" {
+		out, err = os.Create(*output)
+		logger.PanicOnError(err, "Failed to create output file '%s'.", *output)
+		defer out.Close()
+	}
+
+	switch *format {
+	case formatText:
+		err = printReport(out, report)
+	case formatJSON:
+		err = writeJSON(out, report)
+	case formatSARIF:
+		err = speclint.WriteSARIF(out, report, rules, exe.ToolkitVersion)
+	}
+	logger.PanicOnError(err, "Failed to render the lint report.")
+
+	errors, warnings := report.Count(speclint.SeverityError), report.Count(speclint.SeverityWarning)
+	if (*failOn == failOnError && errors != 0) || (*failOn == failOnWarning && errors+warnings != 0) {
+		logger.Log.Fatalf("Found %d error(s) and %d warning(s) in %d SPECs", errors, warnings, report.SpecCount)
+	}
+}
+
+// printReport renders every finding on its own line, followed by a summary.
+func printReport(out io.Writer, report *speclint.Report) (err error) {
+	for _, finding := range report.Findings {
+		_, err = fmt.Fprintf(out, "%s: %s: %s [%s]\n", finding.SpecPath, finding.Severity, finding.Message, finding.RuleID)
+		if err != nil {
+			return
+		}
+	}
+
+	_, err = fmt.Fprintf(out, "Linted %d SPECs: %d error(s), %d warning(s).\n", report.SpecCount, report.Count(speclint.SeverityError), report.Count(speclint.SeverityWarning))
+	return
+}
+
+// writeJSON renders the report as indented JSON.
+func writeJSON(out io.Writer, report *speclint.Report) (err error) {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return
+	}
+
+	_, err = fmt.Fprintln(out, string(data))
+	return
+}
@@ -0,0 +1,181 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"microsoft.com/pkggen/internal/logger"
+	"microsoft.com/pkggen/internal/pkgjson"
+	"microsoft.com/pkggen/internal/rpm"
+	"microsoft.com/pkggen/internal/specparser"
+)
+
+// comparisonStats counts how often the native spec parser agreed with rpmspec.
+type comparisonStats struct {
+	mutex      sync.Mutex
+	matched    int
+	mismatched int
+	failed     int
+}
+
+// logSummary logs the result of every comparison.
+func (c *comparisonStats) logSummary() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	total := c.matched + c.mismatched + c.failed
+	logger.Log.Infof("Native spec parser matched rpmspec for %d of %d specs (%d differed, %d failed to parse)", c.matched, total, c.mismatched, c.failed)
+}
+
+func (c *comparisonStats) record(matched, failed bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	switch {
+	case failed:
+		c.failed++
+	case matched:
+		c.matched++
+	default:
+		c.mismatched++
+	}
+}
+
+// newNativeParser creates a spec parser for targetArch which uses the macros in macroDir.
+func newNativeParser(macroDir, targetArch string) (parser *specparser.Parser, err error) {
+	parser = specparser.NewParser(targetArch)
+	if macroDir != "" {
+		err = parser.LoadMacroDir(macroDir)
+	}
+
+	return
+}
+
+// readSpecNative parses a spec file with the native spec parser, producing the same output as readSpecRpmspec.
+// ok is false if the spec can't be built for the parser's architecture.
+func readSpecNative(parser *specparser.Parser, specfile, sourcedir, srpmDir string, defines map[string]string) (providerList []*pkgjson.Package, ok bool, err error) {
+	nativeDefines := make(map[string]string, len(defines)+1)
+	for name, value := range defines {
+		nativeDefines[name] = value
+	}
+	nativeDefines[rpm.SourceDirDefine] = sourcedir
+
+	spec, err := parser.ParseFile(specfile, nativeDefines)
+	if err != nil {
+		return
+	}
+
+	if !spec.BuildableOn(parser.Arch()) {
+		logger.Log.Debugf(`Skipping (%s) since it cannot be built for architecture (%s).`, specfile, parser.Arch())
+		return
+	}
+
+	srpmPath := filepath.Join(srpmDir, spec.SrpmName())
+	for _, pkg := range spec.Packages {
+		for _, provides := range pkg.Provides {
+			// Each provider gets its own copy of the requirements since condensePackageVersionArray modifies them
+			providerList = append(providerList, &pkgjson.Package{
+				Provides:      parsePackageVersions(provides)[0],
+				SrpmPath:      srpmPath,
+				Architecture:  pkg.Arch,
+				Requires:      filterOutDynamicDependencies(parsePackageVersionList(pkg.Requires)),
+				BuildRequires: parsePackageVersionList(spec.BuildRequires),
+			})
+		}
+	}
+
+	ok = true
+	return
+}
+
+// compareWithNative parses a spec file with the native spec parser and logs every difference from the rpmspec result.
+func compareWithNative(parser *specparser.Parser, stats *comparisonStats, specfile, sourcedir, srpmDir string, defines map[string]string, rpmspecList []*pkgjson.Package) {
+	nativeList, ok, err := readSpecNative(parser, specfile, sourcedir, srpmDir, defines)
+	if err != nil {
+		logger.Log.Warnf("Native spec parser could not parse (%s). Error: %v", specfile, err)
+		stats.record(false, true)
+		return
+	}
+
+	// Match the post-processing done on the rpmspec result
+	if ok {
+		for _, pkg := range nativeList {
+			pkg.Requires = condensePackageVersionArray(pkg.Requires, specfile)
+			pkg.BuildRequires = condensePackageVersionArray(pkg.BuildRequires, specfile)
+		}
+	}
+
+	onlyRpmspec, onlyNative := diffLines(describePackages(rpmspecList), describePackages(nativeList))
+	if len(onlyRpmspec) == 0 && len(onlyNative) == 0 {
+		stats.record(true, false)
+		return
+	}
+
+	var diff strings.Builder
+	for _, line := range onlyRpmspec {
+		fmt.Fprintf(&diff, "\n\t- %s", line)
+	}
+	for _, line := range onlyNative {
+		fmt.Fprintf(&diff, "\n\t+ %s", line)
+	}
+	logger.Log.Warnf("Native spec parser differs from rpmspec for (%s) (- rpmspec, + native):%s", specfile, diff.String())
+	stats.record(false, false)
+}
+
+// describePackages turns a list of packages into a sorted list of lines which can be compared.
+func describePackages(packages []*pkgjson.Package) (lines []string) {
+	describeVersions := func(pkgVers []*pkgjson.PackageVer) string {
+		described := make([]string, 0, len(pkgVers))
+		for _, pkgVer := range pkgVers {
+			described = append(described, pkgVer.String())
+		}
+		sort.Strings(described)
+		return strings.Join(described, " ")
+	}
+
+	// Every provider of a package repeats its requirements, only describe them once
+	unique := make(map[string]bool)
+	for _, pkg := range packages {
+		unique[fmt.Sprintf("provides %s srpm=%s arch=%s", pkg.Provides, filepath.Base(pkg.SrpmPath), pkg.Architecture)] = true
+		unique[fmt.Sprintf("%s requires [%s]", pkg.Provides.Name, describeVersions(pkg.Requires))] = true
+		unique[fmt.Sprintf("buildrequires [%s]", describeVersions(pkg.BuildRequires))] = true
+	}
+
+	for line := range unique {
+		lines = append(lines, line)
+	}
+	sort.Strings(lines)
+	return
+}
+
+// diffLines returns the lines only found in a, and the lines only found in b.
+func diffLines(a, b []string) (onlyA, onlyB []string) {
+	counts := make(map[string]int)
+	for _, line := range a {
+		counts[line]++
+	}
+	for _, line := range b {
+		counts[line]--
+	}
+
+	for _, line := range a {
+		if counts[line] > 0 {
+			onlyA = append(onlyA, line)
+			counts[line]--
+		}
+	}
+	for _, line := range b {
+		if counts[line] < 0 {
+			onlyB = append(onlyB, line)
+			counts[line]++
+		}
+	}
+
+	return
+}
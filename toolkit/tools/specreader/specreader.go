@@ -15,6 +15,7 @@ import (
 
 	"microsoft.com/pkggen/internal/file"
 	"microsoft.com/pkggen/internal/rpm"
+	"microsoft.com/pkggen/internal/specparser"
 
 	"gopkg.in/alecthomas/kingpin.v2"
 	"microsoft.com/pkggen/internal/exe"
@@ -26,6 +27,12 @@ const (
 	defaultWorkerCount = "10"
 )
 
+const (
+	parserRpmspec = "rpmspec"
+	parserNative  = "native"
+	parserCompare = "compare"
+)
+
 var (
 	app      = kingpin.New("specreader", "A tool to parse spec dependencies into JSON")
 	dir      = exe.InputDirFlag(app, "Directory to scan for SPECS")
@@ -34,6 +41,13 @@ var (
 	srpmDir  = app.Flag("srpm-dir", "Directory containing SRPMs.").Required().ExistingDir()
 	macroDir = app.Flag("macro-dir", "Directory containing rpm macros.").Default("").String()
 	distTag  = app.Flag("dist-tag", "The distribution tag the SPEC will be built with.").Required().String()
+
+	targetArch     = exe.TargetArchFlag(app)
+	bootstrapSpecs = app.Flag("bootstrap-specs", "Space seperated list of SPECs (name of the spec file) which may be built in bootstrap mode to break BuildRequires cycles. Their BuildRequires are also read with the bootstrap define set.").String()
+
+	legalParsers = []string{parserRpmspec, parserNative, parserCompare}
+	specParser   = app.Flag("spec-parser", "How to parse the SPEC files. 'native' parses them without rpmspec, falling back to rpmspec for SPECs it can't handle. 'compare' uses rpmspec and reports every difference from the native parser.").PlaceHolder(exe.PlaceHolderize(legalParsers)).Default(parserRpmspec).Enum(legalParsers...)
+
 	logFile  = exe.LogFileFlag(app)
 	logLevel = exe.LogLevelFlag(app)
 )
@@ -59,6 +73,9 @@ func main() {
 	_, err = rpm.SetMacroDir(*macroDir)
 	logger.PanicOnError(err, "Unable to set rpm macro directory (%s). Error: %v", *macroDir, err)
 
+	buildArch, err := rpm.ResolveTargetArch(*targetArch)
+	logger.PanicOnError(err, "Unable to determine the target architecture. Error: %v", err)
+
 	// Find the filepath for each spec in the SPECS directory.
 	specsearch, err := filepath.Abs(filepath.Join(*dir, "**/*.spec"))
 	if err == nil {
@@ -68,12 +85,30 @@ func main() {
 		logger.Log.Panicf("Failed to find *.spec files. Check that %s is the correct directory. Error: %v", *dir, err)
 	}
 
+	var (
+		parser *specparser.Parser
+		stats  *comparisonStats
+	)
+	if *specParser != parserRpmspec {
+		parser, err = newNativeParser(*macroDir, buildArch)
+		logger.PanicOnError(err, "Unable to set up the native spec parser. Error: %v", err)
+	}
+	if *specParser == parserCompare {
+		stats = &comparisonStats{}
+	}
+
+	bootstrapSpecSet := make(map[string]bool)
+	for _, specName := range exe.ParseListArgument(*bootstrapSpecs) {
+		bootstrapSpecSet[specName] = true
+	}
+
 	ch := make(chan []*pkgjson.Package)
 	sem := make(chan int, *workers)
 
 	for _, file := range specFiles {
+		bootstrap := bootstrapSpecSet[strings.TrimSuffix(filepath.Base(file), ".spec")]
 		wg.Add(1)
-		go readspec(file, *distTag, *srpmDir, &wg, ch, sem)
+		go readspec(file, *distTag, *srpmDir, buildArch, bootstrap, parser, stats, &wg, ch, sem)
 	}
 
 	// Set a goroutine to wait for all workers to finish so it can clean up the channel.
@@ -87,6 +122,10 @@ func main() {
 		packageList = append(packageList, specparsed...)
 	}
 
+	if stats != nil {
+		stats.logSummary()
+	}
+
 	packageRepo.Repo = packageList
 	sortPackages(&packageRepo)
 	b, err := json.MarshalIndent(&packageRepo, "", "  ")
@@ -102,7 +141,7 @@ func main() {
 
 // sortPackages orders the package lists into reasonable and deterministic orders.
 // Sort the main package list by "Name", "Version", "SRPM"
-// Sort each nested Requires/BuildRequires by "Name", "Version"
+// Sort each nested Requires/BuildRequires/BootstrapBuildRequires by "Name", "Version"
 func sortPackages(packageRepo *pkgjson.PackageRepo) {
 	sort.Slice(packageRepo.Repo, func(i, j int) bool {
 		iName := packageRepo.Repo[i].Provides.Name + packageRepo.Repo[i].Provides.Version + packageRepo.Repo[i].SrpmPath
@@ -121,24 +160,26 @@ func sortPackages(packageRepo *pkgjson.PackageRepo) {
 			jName := pkg.BuildRequires[j].Name + pkg.BuildRequires[j].Version
 			return strings.Compare(iName, jName) < 0
 		})
+		sort.Slice(pkg.BootstrapBuildRequires, func(i, j int) bool {
+			iName := pkg.BootstrapBuildRequires[i].Name + pkg.BootstrapBuildRequires[i].Version
+			jName := pkg.BootstrapBuildRequires[j].Name + pkg.BootstrapBuildRequires[j].Version
+			return strings.Compare(iName, jName) < 0
+		})
 	}
 }
 
 // readspec is a goroutine that takes a full filepath to a spec file and scrapes it into the Specdef structure
+// as it would be built for targetArch.
 // Concurrency is limited by the size of the semaphore channel passed in. Too many goroutines at once can deplete
 // available filehandles.
-func readspec(specfile, distTag, srpmDir string, wg *sync.WaitGroup, ch chan []*pkgjson.Package, sem chan int) {
-	const (
-		emptyQueryFormat      = ""
-		queryProvidedPackages = `srpm %{NAME}-%{VERSION}-%{RELEASE}.src.rpm\n[provides %{PROVIDENEVRS}\n][requires %{REQUIRENEVRS}\n][arch %{ARCH}\n]`
-	)
-
+// If parser is not nil the spec is parsed natively, unless stats is also set in which case the native result
+// is only compared against rpmspec's.
+// If bootstrap is set the spec is read a second time in bootstrap mode to record its bootstrap BuildRequires.
+func readspec(specfile, distTag, srpmDir, targetArch string, bootstrap bool, parser *specparser.Parser, stats *comparisonStats, wg *sync.WaitGroup, ch chan []*pkgjson.Package, sem chan int) {
 	var (
-		sourcedir         string
-		results           []string
-		providerList      []*pkgjson.Package
-		buildRequiresList []*pkgjson.PackageVer
-		err               error
+		sourcedir    string
+		providerList []*pkgjson.Package
+		ok           bool
 	)
 
 	sourcedir = filepath.Dir(specfile)
@@ -153,40 +194,122 @@ func readspec(specfile, distTag, srpmDir string, wg *sync.WaitGroup, ch chan []*
 		wg.Done()
 	}()
 
+	if stats != nil {
+		providerList, ok = readSpecRpmspec(specfile, sourcedir, srpmDir, targetArch, defines)
+	} else {
+		providerList, ok = readSpecWithParser(parser, specfile, sourcedir, srpmDir, targetArch, defines)
+	}
+
+	if !ok {
+		return
+	}
+
+	// Every package provided by a spec will have the same BuildRequires and SrpmPath
+	for i := range providerList {
+		providerList[i].SpecPath = specfile
+		providerList[i].SourceDir = sourcedir
+		providerList[i].Requires = condensePackageVersionArray(providerList[i].Requires, specfile)
+		providerList[i].BuildRequires = condensePackageVersionArray(providerList[i].BuildRequires, specfile)
+	}
+
+	if bootstrap {
+		readBootstrapBuildRequires(parser, specfile, sourcedir, srpmDir, distTag, targetArch, providerList)
+	}
+
+	if stats != nil {
+		compareWithNative(parser, stats, specfile, sourcedir, srpmDir, defines, providerList)
+	}
+
+	// Submit the result to the main thread, the defered function will clear the semaphore.
+	ch <- providerList
+}
+
+// readSpecWithParser parses a spec file natively if parser is set, falling back to rpmspec if the native
+// parser can't handle it. Otherwise the spec is queried with rpmspec.
+func readSpecWithParser(parser *specparser.Parser, specfile, sourcedir, srpmDir, targetArch string, defines map[string]string) (providerList []*pkgjson.Package, ok bool) {
+	if parser != nil {
+		var err error
+		providerList, ok, err = readSpecNative(parser, specfile, sourcedir, srpmDir, defines)
+		if err == nil {
+			return
+		}
+		logger.Log.Warnf("Native spec parser could not parse (%s), falling back to rpmspec. Error: %v", specfile, err)
+	}
+
+	return readSpecRpmspec(specfile, sourcedir, srpmDir, targetArch, defines)
+}
+
+// readBootstrapBuildRequires reads a spec file a second time in bootstrap mode, and marks every package
+// it provides as bootstrappable with the BuildRequires found.
+func readBootstrapBuildRequires(parser *specparser.Parser, specfile, sourcedir, srpmDir, distTag, targetArch string, providerList []*pkgjson.Package) {
+	const bootstrapEnabled = "1"
+
+	defines := rpm.DefaultDefines()
+	defines[rpm.DistTagDefine] = distTag
+	defines[rpm.BootstrapDefine] = bootstrapEnabled
+
+	bootstrapList, ok := readSpecWithParser(parser, specfile, sourcedir, srpmDir, targetArch, defines)
+	if !ok || len(bootstrapList) == 0 {
+		logger.Log.Warnf("Failed to read (%s) in bootstrap mode, it will not be bootstrapped", specfile)
+		return
+	}
+
+	// Every package provided by a spec will have the same BuildRequires
+	bootstrapBuildRequires := condensePackageVersionArray(bootstrapList[0].BuildRequires, specfile)
+	logger.Log.Debugf("(%s) has %d BuildRequires in bootstrap mode, %d otherwise", specfile, len(bootstrapBuildRequires), len(providerList[0].BuildRequires))
+
+	for _, provider := range providerList {
+		provider.Bootstrap = true
+		provider.BootstrapBuildRequires = bootstrapBuildRequires
+	}
+}
+
+// readSpecRpmspec queries a spec file with rpmspec.
+// ok is false if the spec could not be parsed or can't be built for targetArch.
+func readSpecRpmspec(specfile, sourcedir, srpmDir, targetArch string, defines map[string]string) (providerList []*pkgjson.Package, ok bool) {
+	const (
+		emptyQueryFormat      = ""
+		queryProvidedPackages = `srpm %{NAME}-%{VERSION}-%{RELEASE}.src.rpm\n[provides %{PROVIDENEVRS}\n][requires %{REQUIRENEVRS}\n][arch %{ARCH}\n]`
+	)
+
+	var (
+		results           []string
+		buildRequiresList []*pkgjson.PackageVer
+		err               error
+	)
+
+	targetArgs := rpm.TargetArchArgs(targetArch)
+
 	// Sanity check that rpmspec can read the spec file so we dont flood the log with warning if it cant.
-	_, err = rpm.QuerySPEC(specfile, sourcedir, emptyQueryFormat, defines)
+	_, err = rpm.QuerySPEC(specfile, sourcedir, emptyQueryFormat, defines, targetArgs...)
 	if err != nil {
 		logger.Log.Warnf(`rpmspec could not parse %s`, specfile)
 		return
 	}
 
-	if !specArchMatchesBuild(specfile, sourcedir, defines) {
-		logger.Log.Debugf(`Skipping (%s) since it cannot be built on current architecture.`, specfile)
+	if !specArchMatchesBuild(specfile, sourcedir, targetArch, defines) {
+		logger.Log.Debugf(`Skipping (%s) since it cannot be built for architecture (%s).`, specfile, targetArch)
 		return
 	}
 
 	// Find every package that the spec provides
-	results, err = rpm.QuerySPEC(specfile, sourcedir, queryProvidedPackages, defines)
+	results, err = rpm.QuerySPEC(specfile, sourcedir, queryProvidedPackages, defines, targetArgs...)
 	if err == nil && len(results) != 0 {
 		providerList = parseProvides(srpmDir, results)
 	}
 
 	// Query the BuildRequires fields from this spec and turn them into an array of PackageVersions
-	results, err = rpm.QuerySPEC(specfile, sourcedir, emptyQueryFormat, defines, rpm.BuildRequiresArgument)
+	results, err = rpm.QuerySPEC(specfile, sourcedir, emptyQueryFormat, defines, append(targetArgs, rpm.BuildRequiresArgument)...)
 	if err == nil && len(results) != 0 {
 		buildRequiresList = parsePackageVersionList(results)
 	}
 
-	// Every package provided by a spec will have the same BuildRequires and SrpmPath
 	for i := range providerList {
-		providerList[i].SpecPath = specfile
-		providerList[i].SourceDir = sourcedir
-		providerList[i].Requires = condensePackageVersionArray(providerList[i].Requires, specfile)
-		providerList[i].BuildRequires = condensePackageVersionArray(buildRequiresList, specfile)
+		providerList[i].BuildRequires = buildRequiresList
 	}
 
-	// Submit the result to the main thread, the defered function will clear the semaphore.
-	ch <- providerList
+	ok = true
+	return
 }
 
 // parseProvides parses a newline separated list of Provides, Requires, and Arch from a single spec file.
@@ -249,32 +372,16 @@ func parseProvides(srpmDir string, list []string) (providerlist []*pkgjson.Packa
 }
 
 // parsePackageVersions takes a package name and splits it into a set of PackageVer structures.
-// Normally a list of length 1 is returned, however parsePackageVersions is also responsible for
-// identifying if the package name is an "or" condition and returning all options.
+// Normally a list of length 1 is returned. Rich dependencies such as "(foo or bar)" are returned as a single
+// PackageVer holding the whole expression tree, see 'docs/how_it_works/3_package_building.md#rich-dependencies'.
 func parsePackageVersions(packagename string) (newpkgs []*pkgjson.PackageVer) {
-	const (
-		NameField      = iota
-		ConditionField = iota
-		VersionField   = iota
-	)
-
-	packageSplit := minArrayLength(strings.Split(packagename, " "), 1)
-
-	// If first character of the packagename is a "(" then its an "or" condition
-	if packagename[0] == '(' {
-		return parseOrCondition(packagename)
+	newpkg, err := pkgjson.ParseDependency(packagename)
+	if err != nil {
+		logger.Log.Panicf("Unable to parse dependency. Error: %v", err)
 	}
 
-	newpkg := &pkgjson.PackageVer{Name: packageSplit[NameField]}
-	if len(packageSplit) == 1 {
-		// Nothing to do, no condition or version was found.
-	} else if packageSplit[ConditionField] != "or" {
-		newpkg.Condition = packageSplit[ConditionField]
-		newpkg.Version = packageSplit[VersionField]
-	} else {
-		// Replace the name with the first name that appears in (foo or bar)
-		substr := packageSplit[NameField][1:]
-		newpkg.Name = substr
+	if newpkg.IsRich() {
+		logger.Log.Debugf("Rich dependency found (%s)", newpkg.Name)
 	}
 
 	return append(newpkgs, newpkg)
@@ -324,19 +431,6 @@ func condensePackageVersionArray(packagelist []*pkgjson.PackageVer, specfile str
 	return
 }
 
-// parseOrCondition splits a package name like (foo or bar) and returns both foo and bar as separate requirements.
-func parseOrCondition(packagename string) (versions []*pkgjson.PackageVer) {
-	logger.Log.Warnf("'OR' clause found (%s), make sure both packages are available. Please refer to 'docs/how_it_works/3_package_building.md#or-clauses' for explanation of limitations.", packagename)
-	packagename = strings.ReplaceAll(packagename, "(", "")
-	packagename = strings.ReplaceAll(packagename, ")", "")
-	packageSplit := minArrayLength(strings.Split(packagename, " or "), 1)
-	versions = make([]*pkgjson.PackageVer, 0, len(packageSplit))
-	for _, condition := range packageSplit {
-		versions = append(versions, parsePackageVersions(condition)...)
-	}
-	return versions
-}
-
 // minArrayLength checks that a string array is >= a minimum length and panics
 // explicitly if the condition is not met rather than letting an index into the array
 // crash later.
@@ -371,35 +465,34 @@ func filterOutDynamicDependencies(pkgVers []*pkgjson.PackageVer) (filteredPkgVer
 	return
 }
 
-// specArchMatchesBuild verifies ExclusiveArch tag against the machine architecture.
-func specArchMatchesBuild(specfile, sourcedir string, defines map[string]string) (shouldBeBuilt bool) {
+// specArchMatchesBuild verifies the ExclusiveArch and ExcludeArch tags against the target architecture.
+func specArchMatchesBuild(specfile, sourcedir, targetArch string, defines map[string]string) (shouldBeBuilt bool) {
 	const (
-		queryExclusiveArch = "%{ARCH}\n%{EXCLUSIVEARCH}\n"
-		noExclusiveArch    = "(none)"
+		exclusiveArchTag = "exclusivearch"
+		excludeArchTag   = "excludearch"
+		queryArchLists   = exclusiveArchTag + " [%{EXCLUSIVEARCH} ]\n" + excludeArchTag + " [%{EXCLUDEARCH} ]\n"
 	)
 
-	const (
-		MachineArchField   = iota
-		ExclusiveArchField = iota
-		MinimumFieldsCount = iota
-	)
+	var exclusiveArch, excludeArch []string
 
-	// Sanity check that this SPEC is meant to be built for the current machine architecture
-	exclusiveArchList, err := rpm.QuerySPEC(specfile, sourcedir, queryExclusiveArch, defines, rpm.QueryHeaderArgument)
+	args := append(rpm.TargetArchArgs(targetArch), rpm.QueryHeaderArgument)
+	archLists, err := rpm.QuerySPEC(specfile, sourcedir, queryArchLists, defines, args...)
 	if err != nil {
 		logger.Log.Warnf("Failed to query SPEC (%s), error: %s", specfile, err)
 		return
 	}
 
-	if len(exclusiveArchList) < MinimumFieldsCount {
-		logger.Log.Warnf("The query for spec architecture did not return enough lines!")
-		return
-	}
-
-	if exclusiveArchList[ExclusiveArchField] == noExclusiveArch ||
-		exclusiveArchList[ExclusiveArchField] == exclusiveArchList[MachineArchField] {
-		shouldBeBuilt = true
+	// Each line is a tag followed by the (possibly empty) list of architectures set by it
+	for _, line := range archLists {
+		fields := strings.Fields(line)
+		switch fields[0] {
+		case exclusiveArchTag:
+			exclusiveArch = fields[1:]
+		case excludeArchTag:
+			excludeArch = fields[1:]
+		}
 	}
 
+	shouldBeBuilt = rpm.ArchAllowed(targetArch, exclusiveArch, excludeArch)
 	return
 }
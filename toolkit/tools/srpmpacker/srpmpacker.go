@@ -18,9 +18,9 @@ import (
 	"microsoft.com/pkggen/internal/exe"
 	"microsoft.com/pkggen/internal/network"
 
-	"microsoft.com/pkggen/internal/jsonutils"
 	"microsoft.com/pkggen/internal/retry"
 	"microsoft.com/pkggen/internal/rpm"
+	"microsoft.com/pkggen/internal/specsignatures"
 
 	"microsoft.com/pkggen/internal/directory"
 	"microsoft.com/pkggen/internal/file"
@@ -29,10 +29,6 @@ import (
 	"microsoft.com/pkggen/internal/logger"
 )
 
-type fileSignaturesWrapper struct {
-	FileSignatures map[string]string `json:"Signatures"`
-}
-
 const (
 	srpmOutDir     = "SRPMS"
 	srpmSPECDir    = "SPECS"
@@ -379,7 +375,7 @@ func packSRPMWorker(allSpecStates chan *specState, results chan *packResult, dis
 		}
 
 		// Setup a source retrieval configuration based on the provided template
-		signaturesFilePath := specPathToSignaturesPath(specState.specFile)
+		signaturesFilePath := specsignatures.PathForSpec(specState.specFile)
 		srcConfig, err := initializeSourceConfig(templateSrcConfig, signaturesFilePath)
 		logger.PanicOnError(err)
 
@@ -396,49 +392,18 @@ func packSRPMWorker(allSpecStates chan *specState, results chan *packResult, dis
 	}
 }
 
-func specPathToSignaturesPath(specFilePath string) string {
-	const (
-		specSuffix          = ".spec"
-		signatureFileSuffix = "signatures.json"
-	)
-
-	specName := strings.TrimSuffix(filepath.Base(specFilePath), specSuffix)
-	signatureFileName := fmt.Sprintf("%s.%s", specName, signatureFileSuffix)
-	signatureFileDirPath := filepath.Dir(specFilePath)
-
-	return filepath.Join(signatureFileDirPath, signatureFileName)
-}
-
 func initializeSourceConfig(templateSrcConfig sourceRetrievalConfiguration, signaturesFilePath string) (srcConfig sourceRetrievalConfiguration, err error) {
 	srcConfig = templateSrcConfig
 	srcConfig.localSourceDir = filepath.Dir(signaturesFilePath)
 
 	// Read the signatures file for the SPEC sources if applicable
 	if srcConfig.signatureHandling != signatureSkipCheck {
-		srcConfig.signatureLookup, err = readSignatures(signaturesFilePath)
+		srcConfig.signatureLookup, err = specsignatures.Read(signaturesFilePath)
 	}
 
 	return srcConfig, err
 }
 
-func readSignatures(signaturesFilePath string) (readSignatures map[string]string, err error) {
-	var signaturesWrapper fileSignaturesWrapper
-	signaturesWrapper.FileSignatures = make(map[string]string)
-
-	err = jsonutils.ReadJSONFile(signaturesFilePath, &signaturesWrapper)
-	if err != nil {
-		if os.IsNotExist(err) {
-			// Non-fatal as some SPECs may not have sources
-			logger.Log.Debugf("The signatures file (%s) doesn't exist, will not pre-populate signatures.", signaturesFilePath)
-			err = nil
-		} else {
-			logger.Log.Errorf("Failed to read the signatures file (%s): %v.", signaturesFilePath, err)
-		}
-	}
-
-	return signaturesWrapper.FileSignatures, err
-}
-
 // packSingleSPEC will pack a given SPEC file into an SRPM.
 func packSingleSPEC(specFile, srpmFile, signaturesFile, buildDir, outDir, distTag string, srcConfig sourceRetrievalConfiguration) (outputPath string, err error) {
 	srpmName := filepath.Base(srpmFile)
@@ -503,11 +468,7 @@ func updateSignaturesIfApplicable(signaturesFile string, srcConfig sourceRetriev
 	if srcConfig.signatureHandling == signatureUpdate && !reflect.DeepEqual(srcConfig.signatureLookup, currentSignatures) {
 		logger.Log.Infof("Updating (%s)", signaturesFile)
 
-		outputSignatures := fileSignaturesWrapper{
-			FileSignatures: currentSignatures,
-		}
-
-		err = jsonutils.WriteJSONFile(signaturesFile, outputSignatures)
+		err = specsignatures.Write(signaturesFile, currentSignatures)
 		if err != nil {
 			logger.Log.Warnf("Unable to update signatures file (%s)", signaturesFile)
 			return
@@ -28,10 +28,28 @@ type Unravel interface {
 	Save(io.StringWriter) error
 }
 
+// NodeKey returns the name a node is tracked under in a BlockPkgsList.
+// Nodes which share a key are treated as a single unit of work.
+type NodeKey func(n *pkggraph.PkgNode) string
+
 // GraphToMaps takes PkgGraph and returns two blockPkgsLists,
 // The first one says what packages are blocking a queried package
 // The second one says what packages are blocked by a queried package
+// Nodes of bootstrap builds are tracked separately from the regular build of their SRPM.
 func GraphToMaps(g *pkggraph.PkgGraph) (blocking, blockedBy BlockPkgsList) {
+	const bootstrapKeyPrefix = "BOOTSTRAP_"
+
+	return GraphToMapsByKey(g, func(n *pkggraph.PkgNode) string {
+		if n.Bootstrap {
+			return bootstrapKeyPrefix + n.SrpmPath
+		}
+		return n.SrpmPath
+	})
+}
+
+// GraphToMapsByKey behaves like GraphToMaps, but groups nodes using the provided key
+// instead of their SRPM path.
+func GraphToMapsByKey(g *pkggraph.PkgGraph, key NodeKey) (blocking, blockedBy BlockPkgsList) {
 	blocking = make(BlockPkgsList)
 	blockedBy = make(BlockPkgsList)
 
@@ -40,31 +58,33 @@ func GraphToMaps(g *pkggraph.PkgGraph) (blocking, blockedBy BlockPkgsList) {
 
 	for potentialDependencies.Next() {
 		dep := potentialDependencies.Node().(*pkggraph.PkgNode)
+		depKey := key(dep)
 		logger.Log.Tracef("Processing depnode %s", dep.FriendlyName())
 		// All nodes need to be created in BlockedBy
 		// Since a node with no dependency represents a leaf node
 		// But wouldn't be created otherwise
-		if blockedBy[dep.SrpmPath] == nil {
-			blockedBy[dep.SrpmPath] = make(BlockingPkgs)
+		if blockedBy[depKey] == nil {
+			blockedBy[depKey] = make(BlockingPkgs)
 		}
 
 		dependants := g.To(dep.ID())
 
 		for dependants.Next() {
 			dependant := dependants.Node().(*pkggraph.PkgNode)
-			if dependant.SrpmPath == dep.SrpmPath {
+			dependantKey := key(dependant)
+			if dependantKey == depKey {
 				continue
 			}
-			if blockedBy[dependant.SrpmPath] == nil {
-				blockedBy[dependant.SrpmPath] = make(BlockingPkgs)
+			if blockedBy[dependantKey] == nil {
+				blockedBy[dependantKey] = make(BlockingPkgs)
 			}
-			if blocking[dep.SrpmPath] == nil {
-				blocking[dep.SrpmPath] = make(BlockingPkgs)
+			if blocking[depKey] == nil {
+				blocking[depKey] = make(BlockingPkgs)
 			}
 
-			blockedBy[dependant.SrpmPath][dep.SrpmPath] = true
-			blocking[dep.SrpmPath][dependant.SrpmPath] = true
-			logger.Log.Tracef("Dependency of %s -> %s", dependant.SrpmPath, dep.SrpmPath)
+			blockedBy[dependantKey][depKey] = true
+			blocking[depKey][dependantKey] = true
+			logger.Log.Tracef("Dependency of %s -> %s", dependantKey, depKey)
 		}
 	}
 	return blocking, blockedBy
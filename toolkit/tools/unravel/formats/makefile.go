@@ -12,7 +12,7 @@ import (
 	"microsoft.com/pkggen/internal/pkggraph"
 )
 
-type commandFormatter = func(string) string
+type commandFormatter = func(string, bool) string
 
 // Makefile implements Unravel, producing a Makefile which expresses the build order
 type Makefile struct {
@@ -23,8 +23,8 @@ type Makefile struct {
 // NewMakefile returns new *Makefile, saving internally the graph representation
 // The original graph representation is not retained nor modified
 // command is used to format SRPM into a worker invocation
-// Input to the command is going to be the package's SRPM name (with .src.rpm)
-func NewMakefile(g *pkggraph.PkgGraph, command func(string) string) *Makefile {
+// Input to the command is going to be the package's SRPM name (with .src.rpm), and whether it is a bootstrap build
+func NewMakefile(g *pkggraph.PkgGraph, command func(string, bool) string) *Makefile {
 	copyG, err := g.DeepCopy()
 	if err != nil {
 		logger.Log.Panic("Error when copying graph: ", err)
@@ -69,7 +69,7 @@ func (m *Makefile) Save(w io.StringWriter) (err error) {
 				w.WriteString(fmt.Sprintf("%s: ;\n", currentNodeAsTarget))
 			case currentNode.State == pkggraph.StateBuild:
 				// Build node target should call the command according to the passed cmdFormat
-				w.WriteString(fmt.Sprintf("%s:\n\t%s\n", currentNodeAsTarget, m.cmdFormat(currentNode.SrpmPath)))
+				w.WriteString(fmt.Sprintf("%s:\n\t%s\n", currentNodeAsTarget, m.cmdFormat(currentNode.SrpmPath, currentNode.Bootstrap)))
 			}
 
 			// Mark the target as created to avoid redefining targets
@@ -123,7 +123,11 @@ func formatNodeAsTarget(n *pkggraph.PkgNode) (target string, err error) {
 	case pkggraph.TypePureMeta:
 		target = fmt.Sprintf("PUREMETA_%d", n.ID())
 	case pkggraph.TypeBuild:
-		target = fmt.Sprintf("BUILD_%s", n.SrpmPath)
+		if n.Bootstrap {
+			target = fmt.Sprintf("BOOTSTRAP_%s", n.SrpmPath)
+		} else {
+			target = fmt.Sprintf("BUILD_%s", n.SrpmPath)
+		}
 	case pkggraph.TypeRun:
 		target = fmt.Sprintf("RUN_%d_%s_%s", n.ID(), n.SrpmPath, n.VersionedPkg.Name)
 
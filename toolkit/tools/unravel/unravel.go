@@ -34,6 +34,9 @@ var (
 	distroReleaseVersion = app.Flag("distro-release-version", "The distro release version that the SRPM will be built with").Required().String()
 	distroBuildNumber    = app.Flag("distro-build-number", "The distro build number that the SRPM will be built with").Required().String()
 	retryAttempts        = app.Flag("retry-attempts", "Sets the number of times pkgworker will retry building the package").Default(defaultRetryAttempts).Int()
+	buildManifestDir     = app.Flag("build-manifest-dir", "Optional build manifest directory for pkgworker to record successful builds in").String()
+	targetArch           = exe.TargetArchFlag(app)
+	verifyReproducible   = app.Flag("verify-reproducible", "Sets whether or not pkgworker should build each package twice and verify the builds are reproducible").Default("n").String()
 
 	legalFormats = []string{formatLinear, formatMakefile}
 	format       = app.Flag("format", "Output format").PlaceHolder(exe.PlaceHolderize(legalFormats)).Required().Enum(legalFormats...)
@@ -54,13 +57,18 @@ func main() {
 		u = formats.NewLinear(g)
 	case formatMakefile:
 		const (
-			pkgWorkerCommandFmt      = `MAKEFLAGS= $(go-pkgworker) --input=%s --retry-attempts=%d --cache-dir=%s %s --work-dir=$(CHROOT_DIR) --worker-tar=$(chroot_worker) --repo-file=$(pkggen_local_repo) --rpms-dir=$(RPMS_DIR) --srpms-dir=$(SRPMS_DIR) --rpmmacros-file=$(TOOLCHAIN_MANIFESTS_DIR)/macros.override --dist-tag=%s --distro-release-version=%s --distro-build-number=%s --log-file=$(LOGS_DIR)/pkggen/rpmbuilding/%s.log`
+			pkgWorkerBaseFmt         = `MAKEFLAGS= $(go-pkgworker) --input=%s --retry-attempts=%d --cache-dir=%s %s --work-dir=$(CHROOT_DIR) --worker-tar=$(chroot_worker) --repo-file=$(pkggen_local_repo) --rpms-dir=$(RPMS_DIR) --srpms-dir=$(SRPMS_DIR) --rpmmacros-file=$(TOOLCHAIN_MANIFESTS_DIR)/macros.override --dist-tag=%s --distro-release-version=%s --distro-build-number=%s`
+			pkgWorkerCommandFmt      = pkgWorkerBaseFmt + ` --log-file=$(LOGS_DIR)/pkggen/rpmbuilding/%s.log --result-file=$(LOGS_DIR)/pkggen/rpmbuilding/%s.result.json%s`
+			bootstrapCommandFmt      = pkgWorkerBaseFmt + ` --bootstrap --log-file=$(LOGS_DIR)/pkggen/rpmbuilding/%s.bootstrap.log%s`
 			continueOnFailurePostfix = ` || echo "%s" >> $(LOGS_DIR)/pkggen/failures.txt`
 			stopOnFailurePostfix     = ` || { echo "%s" >> $(LOGS_DIR)/pkggen/failures.txt ; echo "--stop-on-failure set, halting on package build failure" ; exit 1 ; }`
+			reproducibleSettingFmt   = ` --verify-reproducible --reproducibility-report=$(LOGS_DIR)/pkggen/rpmbuilding/%s.reproducibility.json`
 		)
 
 		var postfix string
 		var checkSetting string
+		var manifestSetting string
+		var archSetting string
 
 		if *stopOnFailure {
 			postfix = stopOnFailurePostfix
@@ -74,9 +82,28 @@ func main() {
 			checkSetting = " "
 		}
 
-		u = formats.NewMakefile(g, func(srpmPath string) string {
+		if *buildManifestDir != "" {
+			manifestSetting = fmt.Sprintf(" --build-manifest-dir=%s", *buildManifestDir)
+		}
+
+		if *targetArch != "" {
+			archSetting = fmt.Sprintf(" --target-arch=%s", *targetArch)
+		}
+
+		u = formats.NewMakefile(g, func(srpmPath string, bootstrap bool) string {
 			srpmName := filepath.Base(srpmPath)
-			return fmt.Sprintf(pkgWorkerCommandFmt+postfix, srpmPath, *retryAttempts, *cacheDir, checkSetting, *distTag, *distroReleaseVersion, *distroBuildNumber, srpmName, srpmName)
+
+			// Bootstrap builds are always followed by a regular build, which records the result and the build manifest entry
+			if bootstrap {
+				return fmt.Sprintf(bootstrapCommandFmt+postfix, srpmPath, *retryAttempts, *cacheDir, checkSetting, *distTag, *distroReleaseVersion, *distroBuildNumber, srpmName, archSetting, srpmName)
+			}
+
+			var reproducibleSetting string
+			if *verifyReproducible == "y" {
+				reproducibleSetting = fmt.Sprintf(reproducibleSettingFmt, srpmName)
+			}
+
+			return fmt.Sprintf(pkgWorkerCommandFmt+postfix, srpmPath, *retryAttempts, *cacheDir, checkSetting, *distTag, *distroReleaseVersion, *distroBuildNumber, srpmName, srpmName, manifestSetting+archSetting+reproducibleSetting, srpmName)
 		})
 	default:
 		logger.Log.Panicf("Wrong output format encountered: %s. Allowed: %s", *format, legalFormats)